@@ -11,19 +11,105 @@ var addCmd = &cobra.Command{
 	Use:     "add [url]...",
 	Aliases: []string{"get"},
 	Short:   "Add a new download to the running Surge instance",
-	Long:    `Add one or more URLs to the download queue of a running Surge instance.`,
+	Long: `Add one or more URLs to the download queue of a running Surge instance.
+
+With --input-file, every download listed in the file is queued and the
+command waits for them all, then prints a summary and exits non-zero if any
+failed. Each line holds a URL (with comma-separated mirrors), optionally
+followed by an output name and a "type:hex" checksum:
+
+  https://example.com/a.iso
+  https://example.com/b.iso  renamed.iso  sha256:9f86d081...
+
+The type is md5, sha1, sha224, sha256, sha384, sha512, blake2b (BLAKE2b-512),
+blake3 or xxh3 (XXH3-64). --md5, --sha1, --sha256 or --checksum type:hex
+check a single download the same way, and --signature with --keyring checks
+it against a detached OpenPGP signature (a URL or a file) made with one of
+the keyring's public keys. A file that does not match fails and is kept with
+a .corrupt suffix.
+
+--accept-type and --reject-type ask the server of every URL for its media
+type with a HEAD request before queueing it, and skip those that are not
+wanted, e.g. --accept-type video/*,application/pdf. URLs whose server does
+not say are queued.
+
+--expect-header "Content-Type: application/zip" and --expect-size 12345 make
+a download fail before anything is written when the server answers with
+another type or size, so a pipeline never saves an HTML error page as its
+artifact. A header value also matches one with parameters, such as
+"text/html; charset=utf-8" for "text/html".`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Initialize Global State (needed for config/paths)
 		initializeGlobalState()
 
 		batchFile, _ := cmd.Flags().GetString("batch")
+		inputFile, _ := cmd.Flags().GetString("input-file")
 		output, _ := cmd.Flags().GetString("output")
+		resume, _ := cmd.Flags().GetBool("resume")
+		opts, err := downloadOptionFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		mediaTypes, err := typeFilterFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if opts.Checksum != "" && (inputFile != "" || batchFile != "" || len(mirrorArgs(cmd, args)) != 1) {
+			fmt.Fprintln(os.Stderr, "Error: --md5, --sha1, --sha256 and --checksum check a single download; use --input-file for several")
+			os.Exit(1)
+		}
+		if opts.Signature != "" && (inputFile != "" || batchFile != "" || len(mirrorArgs(cmd, args)) != 1) {
+			fmt.Fprintln(os.Stderr, "Error: --signature checks a single download")
+			os.Exit(1)
+		}
+		if opts.ExpectSize > 0 && (inputFile != "" || batchFile != "" || len(mirrorArgs(cmd, args)) != 1) {
+			fmt.Fprintln(os.Stderr, "Error: --expect-size checks a single download")
+			os.Exit(1)
+		}
+
+		if inputFile != "" {
+			reqs, err := readInputFile(inputFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading input file: %v\n", err)
+				os.Exit(1)
+			}
+			for _, arg := range mirrorArgs(cmd, args) {
+				expanded, err := expandArg(arg)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", arg, err)
+					os.Exit(1)
+				}
+				reqs = append(reqs, expanded...)
+			}
+			if mediaTypes.active() {
+				if reqs = filterByType(reqs, func(req DownloadRequest) string { return req.URL }, mediaTypes); len(reqs) == 0 {
+					fmt.Fprintln(os.Stderr, "No downloads left to queue.")
+					os.Exit(1)
+				}
+			}
+			for i := range reqs {
+				opts.apply(&reqs[i])
+			}
+			port := readActivePort()
+			if port == 0 {
+				fmt.Println("Error: Surge is not running.")
+				fmt.Println("Start it with 'surge server start' first.")
+				os.Exit(1)
+			}
+			if failed := runBatch(reqs, output, resume, port); failed > 0 {
+				os.Exit(1)
+			}
+			return
+		}
 
 		// Collect URLs
 		var urls []string
 
 		// 1. URLs from args
-		urls = append(urls, args...)
+		urls = append(urls, mirrorArgs(cmd, args)...)
 
 		// 2. URLs from batch file
 		if batchFile != "" {
@@ -39,6 +125,16 @@ var addCmd = &cobra.Command{
 			cmd.Help()
 			return
 		}
+		if mediaTypes.active() {
+			primary := func(arg string) string {
+				url, _ := ParseURLArg(arg)
+				return url
+			}
+			if urls = filterByType(urls, primary, mediaTypes); len(urls) == 0 {
+				fmt.Fprintln(os.Stderr, "No downloads left to queue.")
+				os.Exit(1)
+			}
+		}
 
 		// Check if Surge is running
 		port := readActivePort()
@@ -49,7 +145,12 @@ var addCmd = &cobra.Command{
 		}
 
 		// Send downloads to server
-		count := processDownloads(urls, output, port)
+		var count int
+		if resume {
+			count = resumeDownloads(urls, output, port)
+		} else {
+			count = processDownloads(urls, output, opts, port)
+		}
 
 		if count > 0 {
 			fmt.Printf("Successfully added %d downloads.\n", count)
@@ -60,5 +161,46 @@ var addCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().StringP("batch", "b", "", "File containing URLs to download (one per line)")
+	addCmd.Flags().StringP("input-file", "i", "", "File listing downloads with optional names and checksums; waits for them and summarizes")
 	addCmd.Flags().StringP("output", "o", "", "Output directory")
+	addCmd.Flags().BoolP("mirror", "m", false, "Treat the URLs as mirrors of one file and download from all of them")
+	addCmd.Flags().Bool("resume", false, "Continue an interrupted download of the same URL instead of starting over")
+	addCmd.Flags().String("proxy", "", "Proxy for these downloads: http://, https://, socks5:// or socks5h:// URL, or \"none\" to connect directly")
+	addCmd.Flags().String("socks5", "", "SOCKS5 proxy [user:password@]host:port for these downloads")
+	addCmd.Flags().StringArrayP("header", "H", nil, "Send this \"Name: value\" header with every request of these downloads (repeatable)")
+	addCmd.Flags().StringP("user", "u", "", "Log in with HTTP basic authentication as user:password")
+	addCmd.Flags().String("bearer", "", "Send this token as \"Authorization: Bearer <token>\"")
+	addCmd.Flags().String("cookies-from-browser", "", "Send the cookies chrome or firefox has for these downloads' sites")
+	addCmd.Flags().String("load-cookies", "", "Send the cookies of this cookies.txt file (Netscape format) to the sites they belong to")
+	addCmd.Flags().String("schedule", "", "Hold these downloads until HH:MM or \"YYYY-MM-DD HH:MM\", or keep them to a daily HH:MM-HH:MM window, pausing when it closes")
+	addCmd.Flags().String("priority", "", "Queue these downloads ahead of (high) or behind (low) normal ones")
+	addCmd.Flags().String("md5", "", "Check the completed download against this MD5 digest (hex)")
+	addCmd.Flags().String("sha1", "", "Check the completed download against this SHA-1 digest (hex)")
+	addCmd.Flags().String("sha256", "", "Check the completed download against this SHA-256 digest (hex)")
+	addCmd.Flags().String("checksum", "", "Check the completed download against this type:hex digest, e.g. sha512:..., blake2b:..., blake3:... or xxh3:...")
+	addCmd.Flags().String("signature", "", "Check the completed download against this detached OpenPGP signature (URL or file, e.g. file.iso.asc)")
+	addCmd.Flags().String("keyring", "", "Public keys (gpg --export, binary or armored) the --signature must be made with")
+	addCmd.Flags().StringArray("expect-header", nil, "Fail before writing anything unless the server answers with this \"Name: value\" header, e.g. \"Content-Type: application/zip\" (repeatable)")
+	addCmd.Flags().Int64("expect-size", 0, "Fail before writing anything unless the server reports this size in bytes")
+	addPostActionFlags(addCmd, "these downloads")
+	addTypeFilterFlags(addCmd, "downloads")
+}
+
+// resumeDownloads asks the server to continue unfinished downloads of urls,
+// starting new ones for URLs it has no saved progress for
+func resumeDownloads(urls []string, outputDir string, port int) int {
+	count := 0
+	for _, arg := range urls {
+		url, mirrors := ParseURLArg(arg)
+		if url == "" {
+			continue
+		}
+		err := sendRequestToServer(DownloadRequest{URL: url, Mirrors: mirrors, Path: outputDir, Resume: true}, port)
+		if err != nil {
+			fmt.Printf("Error adding %s: %v\n", url, err)
+			continue
+		}
+		count++
+	}
+	return count
 }
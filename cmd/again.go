@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+var againCmd = &cobra.Command{
+	Use:   "again <ID|URL>",
+	Short: "Download a file from history again",
+	Long: `Re-run a past download with the settings recorded in history: the same URL,
+mirrors, output directory, filename, request headers and checksum. Accepts a download ID (or prefix) or the
+original URL, in which case the most recent matching entry is used.
+
+If the original file is still present, the new copy gets a numbered name.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Println("Error: Surge is not running.")
+			fmt.Println("Start Surge first, then run 'surge again' to queue the download.")
+			os.Exit(1)
+		}
+
+		entry, err := findHistoryEntry(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := sendRequestToServer(againRequest(entry), port); err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", entry.URL, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Queued %s again (from %s)\n", entry.Filename, shortID(entry.ID))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(againCmd)
+}
+
+// findHistoryEntry looks up a past download by ID prefix or by its original URL.
+// When several entries share the URL, the most recently completed one wins.
+func findHistoryEntry(arg string) (*types.DownloadEntry, error) {
+	if strings.Contains(arg, "://") {
+		downloads, err := state.ListAllDownloads()
+		if err != nil {
+			return nil, err
+		}
+		var best *types.DownloadEntry
+		for i := range downloads {
+			d := &downloads[i]
+			if d.URL != arg {
+				continue
+			}
+			if best == nil || d.CompletedAt > best.CompletedAt {
+				best = d
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("no download for %s in history", arg)
+		}
+		return best, nil
+	}
+
+	id, err := resolveDownloadID(arg)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := state.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("download %s not found in history", arg)
+	}
+	return entry, nil
+}
+
+// againRequest rebuilds the original download request from a history entry
+func againRequest(entry *types.DownloadEntry) DownloadRequest {
+	req := DownloadRequest{
+		URL:      entry.URL,
+		Filename: entry.Filename,
+		Mirrors:  entry.Mirrors,
+		Checksum: entry.Checksum,
+	}
+	if len(entry.Headers) > 0 {
+		req.Headers = make(map[string]string, len(entry.Headers))
+		for name, values := range entry.Headers {
+			req.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+	if entry.DestPath != "" {
+		req.Path = filepath.Dir(entry.DestPath)
+	}
+	return req
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/aria2"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+var aria2Cmd = &cobra.Command{
+	Use:   "aria2",
+	Short: "Move partial downloads between aria2 and Surge",
+	Long: `Continue aria2 downloads in Surge, or hand Surge downloads to aria2, without
+losing the data already downloaded. aria2 keeps its progress in a ".aria2"
+control file next to the data file.`,
+}
+
+var aria2ImportCmd = &cobra.Command{
+	Use:   "import <file> <url>",
+	Short: "Continue an interrupted aria2 download in Surge",
+	Long: `Take over the partial aria2 download in <file> (or <file>.aria2) of <url>.
+The data file is moved to Surge's working file and the control file is
+removed. The download continues on the running Surge instance, or the next
+time Surge starts. BitTorrent control files are not supported.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		id, err := importAria2(args[0], args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if port := readActivePort(); port > 0 {
+			if resumeDownloads([]string{args[1]}, "", port) == 0 {
+				os.Exit(1)
+			}
+			fmt.Printf("Imported and resumed download %s\n", shortID(id))
+			return
+		}
+		fmt.Printf("Imported download %s. Start Surge to continue it.\n", shortID(id))
+	},
+}
+
+var aria2ExportCmd = &cobra.Command{
+	Use:   "export <ID>",
+	Short: "Hand an unfinished Surge download over to aria2",
+	Long: `Write an aria2 control file for an unfinished download and move its data
+to the destination path, where 'aria2c --continue' picks it up. The
+download is removed from Surge. Surge must not be running.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		if readActivePort() > 0 {
+			fmt.Fprintln(os.Stderr, "Error: Surge is running. Stop it first so it does not touch the download.")
+			os.Exit(1)
+		}
+		id, err := resolveDownloadID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		entry, err := exportAria2(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Exported download %s. Continue it with:\n", shortID(id))
+		fmt.Printf("  aria2c --continue -d %q -o %q %q\n", filepath.Dir(entry.DestPath), filepath.Base(entry.DestPath), entry.URL)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aria2Cmd)
+	aria2Cmd.AddCommand(aria2ImportCmd)
+	aria2Cmd.AddCommand(aria2ExportCmd)
+}
+
+// importAria2 turns the aria2 download in path into a queued Surge download
+// of rawURL and returns its ID
+func importAria2(path, rawURL string) (string, error) {
+	destPath := utils.EnsureAbsPath(strings.TrimSuffix(path, aria2.Suffix))
+	url, mirrors := ParseURLArg(rawURL)
+	if url == "" {
+		return "", fmt.Errorf("invalid URL %q", rawURL)
+	}
+	settings, err := config.LoadSettings()
+	if err != nil {
+		settings = config.DefaultSettings()
+	}
+	if err := settings.CheckURL(append([]string{url}, mirrors...)...); err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(destPath + aria2.Suffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to open control file: %w", err)
+	}
+	control, err := aria2.Read(f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	tasks, done := control.Remaining()
+	if len(tasks) == 0 {
+		return "", errors.New("the aria2 download is already complete")
+	}
+	if info, err := os.Stat(destPath); err != nil || !info.Mode().IsRegular() {
+		return "", fmt.Errorf("data file %s not found", destPath)
+	}
+
+	id := types.NewDownloadID()
+	workingPath := types.WorkingPath(destPath, id, false)
+	if err := os.Rename(destPath, workingPath); err != nil {
+		return "", fmt.Errorf("failed to move data file: %w", err)
+	}
+	err = state.SaveState(url, destPath, &types.DownloadState{
+		ID:         id,
+		URL:        url,
+		DestPath:   destPath,
+		Filename:   filepath.Base(destPath),
+		TotalSize:  control.TotalLength,
+		Downloaded: done,
+		Tasks:      tasks,
+		Mirrors:    mirrors,
+	})
+	if err == nil {
+		err = state.UpdateStatus(id, "queued")
+	}
+	if err != nil {
+		os.Rename(workingPath, destPath)
+		return "", fmt.Errorf("failed to save download: %w", err)
+	}
+	if err := os.Remove(destPath + aria2.Suffix); err != nil {
+		utils.Debug("Failed to remove aria2 control file: %v", err)
+	}
+	return id, nil
+}
+
+// exportAria2 writes an aria2 control file for unfinished download id, moves
+// its working file to the destination and forgets the download
+func exportAria2(id string) (*types.DownloadEntry, error) {
+	entry, err := state.GetDownload(id)
+	if err != nil || entry == nil {
+		return nil, fmt.Errorf("download %s not found", id)
+	}
+	if entry.Status == "completed" {
+		return nil, errors.New("the download is already complete")
+	}
+	saved, err := state.LoadState(entry.URL, entry.DestPath)
+	if err != nil || saved.TotalSize <= 0 || len(saved.Tasks) == 0 {
+		return nil, errors.New("the download has no saved progress to export")
+	}
+
+	var workingPath string
+	for _, candidate := range types.WorkingPathCandidates(entry.DestPath, id) {
+		if _, err := os.Stat(candidate); err == nil {
+			workingPath = candidate
+			break
+		}
+	}
+	if workingPath == "" {
+		return nil, errors.New("the download's working file is missing")
+	}
+	if _, err := os.Lstat(entry.DestPath); err == nil {
+		return nil, fmt.Errorf("%s already exists", entry.DestPath)
+	}
+
+	controlPath := entry.DestPath + aria2.Suffix
+	f, err := os.OpenFile(controlPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control file: %w", err)
+	}
+	err = aria2.Write(f, aria2.FromRemaining(saved.TotalSize, aria2.DefaultPieceLength, saved.Tasks))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(workingPath, entry.DestPath)
+	}
+	if err != nil {
+		os.Remove(controlPath)
+		return nil, fmt.Errorf("failed to export download: %w", err)
+	}
+	if err := state.RemoveFromMasterList(id); err != nil {
+		utils.Debug("Failed to remove exported download: %v", err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/aria2"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestAria2_ImportExport(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	// An aria2 download with its second and fourth pieces still missing
+	const total = 4 * aria2.DefaultPieceLength
+	remaining := []types.Task{
+		{Offset: aria2.DefaultPieceLength, Length: aria2.DefaultPieceLength},
+		{Offset: 3 * aria2.DefaultPieceLength, Length: aria2.DefaultPieceLength},
+	}
+	dataPath := filepath.Join(tempDir, "disk.img")
+	if err := os.WriteFile(dataPath, make([]byte, total), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeControl := func(path string, c *aria2.Control) {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := aria2.Write(f, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeControl(dataPath+aria2.Suffix, aria2.FromRemaining(total, aria2.DefaultPieceLength, remaining))
+
+	id, err := importAria2(dataPath+aria2.Suffix, "https://example.com/disk.img")
+	if err != nil {
+		t.Fatalf("importAria2() failed: %v", err)
+	}
+	if _, err := os.Stat(types.WorkingPath(dataPath, id, false)); err != nil {
+		t.Errorf("data was not moved to the working file: %v", err)
+	}
+	if _, err := os.Stat(dataPath + aria2.Suffix); !os.IsNotExist(err) {
+		t.Error("control file should be removed after the import")
+	}
+	entry, err := state.GetDownload(id)
+	if err != nil || entry == nil || entry.Status != "queued" {
+		t.Fatalf("imported entry = %+v (%v), want a queued download", entry, err)
+	}
+	saved, err := state.LoadState(entry.URL, dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Tasks, remaining) || saved.Downloaded != 2*aria2.DefaultPieceLength {
+		t.Errorf("imported state = %v tasks, %d downloaded", saved.Tasks, saved.Downloaded)
+	}
+
+	// And back to aria2
+	if _, err := exportAria2(id); err != nil {
+		t.Fatalf("exportAria2() failed: %v", err)
+	}
+	f, err := os.Open(dataPath + aria2.Suffix)
+	if err != nil {
+		t.Fatalf("control file not written: %v", err)
+	}
+	defer f.Close()
+	control, err := aria2.Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := control.Remaining(); !reflect.DeepEqual(tasks, remaining) {
+		t.Errorf("exported remaining = %v, want %v", tasks, remaining)
+	}
+	if info, err := os.Stat(dataPath); err != nil || info.Size() != total {
+		t.Errorf("data file not back in place: %v", err)
+	}
+	if entry, _ := state.GetDownload(id); entry != nil {
+		t.Error("exported download should be removed from Surge")
+	}
+
+	// A control file without its data is refused and left alone
+	orphan := filepath.Join(tempDir, "orphan.iso")
+	writeControl(orphan+aria2.Suffix, aria2.FromRemaining(total, aria2.DefaultPieceLength, remaining))
+	if _, err := importAria2(orphan, "https://example.com/orphan.iso"); err == nil {
+		t.Error("importAria2() without a data file should fail")
+	}
+	if _, err := os.Stat(orphan + aria2.Suffix); err != nil {
+		t.Error("control file of a failed import should be kept")
+	}
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// envAria2Secret is read when --aria2-rpc-secret is not given
+const envAria2Secret = "SURGE_ARIA2_SECRET"
+
+// aria2Version is the aria2 version reported to extensions, which some of
+// them check before sending downloads
+const aria2Version = "1.37.0"
+
+// aria2Unauthorized is the error code aria2 answers a wrong secret with
+const aria2Unauthorized = 1
+
+// addAria2RPCFlags registers the flags of the listener for browser
+// extensions made for aria2
+func addAria2RPCFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("aria2-rpc-port", 0, "Accept downloads from browser extensions made for aria2 on 127.0.0.1:<port>/jsonrpc (aria2 uses 6800)")
+	cmd.Flags().String("aria2-rpc-secret", "", "Secret token the extensions must send (default $"+envAria2Secret+")")
+}
+
+// startAria2RPC opens the aria2 listener if --aria2-rpc-port is set. It only
+// listens on loopback and always requires a secret, as any web page can
+// make the browser send requests to localhost.
+func startAria2RPC(cmd *cobra.Command, apiPort int, defaultOutputDir string) error {
+	port, _ := cmd.Flags().GetInt("aria2-rpc-port")
+	if port <= 0 {
+		return nil
+	}
+	secret, _ := cmd.Flags().GetString("aria2-rpc-secret")
+	if secret == "" {
+		secret = os.Getenv(envAria2Secret)
+	}
+	if secret == "" {
+		return fmt.Errorf("--aria2-rpc-port requires --aria2-rpc-secret or $%s, the secret set in the extension", envAria2Secret)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("could not bind aria2 RPC to port %d: %w", port, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/jsonrpc", aria2RPCHandler(secret, newAPIMux(apiPort, defaultOutputDir)))
+	go func() {
+		server := &http.Server{Handler: mux}
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			utils.Debug("aria2 RPC server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// aria2RPCHandler serves the part of aria2's JSON-RPC interface that "send
+// to aria2" extensions use, adding downloads through api
+func aria2RPCHandler(secret string, api http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		msg, err := io.ReadAll(io.LimitReader(r.Body, maxRPCBytes))
+		if err != nil {
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		var resp any
+		msg = bytes.TrimSpace(msg)
+		if len(msg) > 0 && msg[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(msg, &batch); err != nil {
+				resp = rpcFailure(nil, rpcParseError, "Parse error: "+err.Error())
+			} else {
+				responses := make([]*rpcResponse, 0, len(batch))
+				for _, raw := range batch {
+					responses = append(responses, handleAria2Request(r.Context(), secret, api, raw))
+				}
+				resp = responses
+			}
+		} else {
+			resp = handleAria2Request(r.Context(), secret, api, msg)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// handleAria2Request answers one aria2 call. Unlike /rpc, aria2 answers
+// requests without an id too, and extensions rely on that.
+func handleAria2Request(ctx context.Context, secret string, api http.Handler, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpcFailure(nil, rpcParseError, "Parse error: "+err.Error())
+	}
+	if req.ID == nil {
+		req.ID = json.RawMessage("null")
+	}
+	var params []json.RawMessage
+	if len(req.Params) > 0 && json.Unmarshal(req.Params, &params) != nil {
+		return rpcFailure(req.ID, rpcInvalidParams, "Invalid params: expected an array")
+	}
+
+	// The secret comes first, as "token:<secret>"
+	var token string
+	if len(params) > 0 && json.Unmarshal(params[0], &token) == nil && strings.HasPrefix(token, "token:") {
+		params = params[1:]
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte("token:"+secret)) != 1 {
+		return rpcFailure(req.ID, aria2Unauthorized, "Unauthorized")
+	}
+
+	var result any
+	var rpcErr *rpcError
+	switch req.Method {
+	case "aria2.addUri":
+		result, rpcErr = aria2AddURI(ctx, api, params)
+	case "aria2.getVersion":
+		result = map[string]any{"version": aria2Version, "enabledFeatures": []string{"HTTPS"}}
+	case "aria2.getGlobalStat":
+		var active, waiting int
+		if GlobalPool != nil {
+			active, waiting = GlobalPool.ActiveCount(), GlobalPool.QueueLength()
+		}
+		// aria2 sends every number as a string
+		result = map[string]string{
+			"downloadSpeed":   "0",
+			"uploadSpeed":     "0",
+			"numActive":       strconv.Itoa(active),
+			"numWaiting":      strconv.Itoa(waiting),
+			"numStopped":      "0",
+			"numStoppedTotal": "0",
+		}
+	default:
+		rpcErr = &rpcError{Code: rpcMethodNotFound, Message: "Method not found: " + req.Method}
+	}
+	if rpcErr != nil {
+		return &rpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+// aria2AddURI adds the download of aria2.addUri(uris, options) through the
+// /download endpoint and returns its ID as the aria2 GID. The URIs are
+// mirrors of one file, as in aria2.
+func aria2AddURI(ctx context.Context, api http.Handler, params []json.RawMessage) (any, *rpcError) {
+	var uris []string
+	if len(params) == 0 || json.Unmarshal(params[0], &uris) != nil || len(uris) == 0 {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: expected a list of URIs"}
+	}
+	var options map[string]json.RawMessage
+	if len(params) > 1 {
+		if err := json.Unmarshal(params[1], &options); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: options must be an object"}
+		}
+	}
+	dl, err := aria2DownloadRequest(uris, options)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+
+	body, _ := json.Marshal(dl)
+	result, rpcErr := callRPC(ctx, api, rpcRequest{JSONRPC: "2.0", Method: "add", Params: body})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var added struct {
+		ID string `json:"id"`
+	}
+	raw, _ := result.(json.RawMessage)
+	if json.Unmarshal(raw, &added) != nil || added.ID == "" {
+		return nil, &rpcError{Code: rpcServerError, Message: "Download was not added"}
+	}
+	return added.ID, nil
+}
+
+// aria2DownloadRequest turns aria2.addUri arguments into a DownloadRequest.
+// Options Surge has no use for, such as split, are ignored.
+func aria2DownloadRequest(uris []string, options map[string]json.RawMessage) (DownloadRequest, error) {
+	dl := DownloadRequest{URL: uris[0], Mirrors: uris[1:]}
+	option := func(name string) string {
+		var value string
+		json.Unmarshal(options[name], &value)
+		return value
+	}
+	dl.Path = option("dir")
+	dl.Filename = option("out")
+
+	// "header" is one "Name: value" string or a list of them
+	var lines []string
+	if raw, ok := options["header"]; ok {
+		if json.Unmarshal(raw, &lines) != nil {
+			var line string
+			if err := json.Unmarshal(raw, &line); err != nil {
+				return dl, errors.New(`"header" must be a string or a list of strings`)
+			}
+			lines = []string{line}
+		}
+	}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return dl, fmt.Errorf("malformed header %q", line)
+		}
+		addHeader(&dl, strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if referer := option("referer"); referer != "" {
+		addHeader(&dl, "Referer", referer)
+	}
+	if agent := option("user-agent"); agent != "" {
+		addHeader(&dl, "User-Agent", agent)
+	}
+	return dl, nil
+}
+
+func addHeader(dl *DownloadRequest, name, value string) {
+	if dl.Headers == nil {
+		dl.Headers = make(map[string]string)
+	}
+	dl.Headers[name] = value
+}
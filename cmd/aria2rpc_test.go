@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAria2RPCHandler(t *testing.T) {
+	var added DownloadRequest
+	api := http.NewServeMux()
+	api.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&added)
+		json.NewEncoder(w).Encode(map[string]string{"status": "queued", "id": "abc123"})
+	})
+	handler := aria2RPCHandler("s3cret", api)
+
+	call := func(msg string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(msg)))
+		return strings.TrimSpace(rec.Body.String())
+	}
+
+	got := call(`{"jsonrpc": "2.0", "id": "q", "method": "aria2.addUri", "params": ["token:s3cret",
+		["https://a.example.com/f.iso", "https://b.example.com/f.iso"],
+		{"dir": "/downloads", "out": "f.iso", "header": ["Cookie: k=v"], "referer": "https://example.com/", "split": "5"}]}`)
+	if want := `{"jsonrpc":"2.0","result":"abc123","id":"q"}`; got != want {
+		t.Errorf("addUri = %s, want %s", got, want)
+	}
+	if added.URL != "https://a.example.com/f.iso" || len(added.Mirrors) != 1 || added.Path != "/downloads" || added.Filename != "f.iso" {
+		t.Errorf("added %+v", added)
+	}
+	if added.Headers["Cookie"] != "k=v" || added.Headers["Referer"] != "https://example.com/" {
+		t.Errorf("headers = %v", added.Headers)
+	}
+
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{"wrong secret", `{"jsonrpc": "2.0", "id": 1, "method": "aria2.addUri", "params": ["token:guess", ["https://example.com/a"]]}`,
+			`{"jsonrpc":"2.0","error":{"code":1,"message":"Unauthorized"},"id":1}`},
+		{"no secret", `{"jsonrpc": "2.0", "id": 2, "method": "aria2.getVersion"}`,
+			`{"jsonrpc":"2.0","error":{"code":1,"message":"Unauthorized"},"id":2}`},
+		{"version", `{"jsonrpc": "2.0", "id": 3, "method": "aria2.getVersion", "params": ["token:s3cret"]}`,
+			`{"jsonrpc":"2.0","result":{"enabledFeatures":["HTTPS"],"version":"` + aria2Version + `"},"id":3}`},
+		{"no URIs", `{"jsonrpc": "2.0", "id": 4, "method": "aria2.addUri", "params": ["token:s3cret", []]}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: expected a list of URIs"},"id":4}`},
+		{"unknown method", `{"jsonrpc": "2.0", "id": 5, "method": "aria2.addTorrent", "params": ["token:s3cret"]}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found: aria2.addTorrent"},"id":5}`},
+		{"batch", `[{"jsonrpc": "2.0", "id": 6, "method": "aria2.getVersion", "params": ["token:s3cret"]}, {"jsonrpc": "2.0", "id": 7, "method": "aria2.getVersion"}]`,
+			`[{"jsonrpc":"2.0","result":{"enabledFeatures":["HTTPS"],"version":"` + aria2Version + `"},"id":6},{"jsonrpc":"2.0","error":{"code":1,"message":"Unauthorized"},"id":7}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := call(tt.msg); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
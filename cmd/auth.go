@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/keyring"
+	"github.com/surge-downloader/surge/internal/oauth"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Sign in to APIs such as Google Drive or OneDrive",
+	Long: `Sign downloads in to OAuth APIs listed under connections.oauth in
+settings.json. A provider needs a name and a client_id, plus the endpoints,
+scopes and hosts unless it is "google" or "microsoft":
+
+  "oauth": [{"name": "google", "client_id": "...", "client_secret": "..."}]
+
+Once logged in, every request to the provider's hosts carries an access
+token. The refresh token is kept in the OS keyring.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login <provider>",
+	Short: "Approve Surge for a provider from a browser",
+	Long: `Show a code to enter on the provider's website, from this or any other
+device, and wait until it is approved. Two-factor checks happen there.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		p, err := oauthProvider(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = oauth.Login(ctx, p, func(code oauth.DeviceCode) {
+			fmt.Printf("To sign in to %s, open %s\nand enter the code %s", p.Name, code.VerificationURL, code.UserCode)
+			if !code.Expires.IsZero() {
+				fmt.Printf(" within %s", time.Until(code.Expires).Round(time.Minute))
+			}
+			fmt.Println(".")
+			fmt.Println("Waiting for approval...")
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Logged in to %s.\n", p.Name)
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout <provider>",
+	Short: "Remove a provider's refresh token from the keyring",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		if err := oauth.Logout(args[0]); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Logged out of %s.\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authLogoutCmd)
+}
+
+// oauthProvider returns the provider called name in settings
+func oauthProvider(name string) (config.OAuthProvider, error) {
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return config.OAuthProvider{}, err
+	}
+	return oauth.Find(settings.Connections.OAuth, name)
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// batchPollInterval is how often a batch run asks the server for progress
+const batchPollInterval = time.Second
+
+// readInputFile reads the downloads listed in an input file, one per line:
+//
+//	URL[,mirror...] [output-name] [type:checksum]
+//
+// The name and checksum are optional and may come in either order. Blank
+// lines and lines starting with # are skipped. Torrent and metalink paths
+// expand to their files, but then take no name or checksum.
+func readInputFile(path string) ([]DownloadRequest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	var reqs []DownloadRequest
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var name, checksum string
+		for _, f := range fields[1:] {
+			switch {
+			case download.SupportedChecksum(f):
+				if checksum != "" {
+					return nil, fmt.Errorf("line %d: more than one checksum", n)
+				}
+				checksum = f
+			case name == "" && !strings.ContainsAny(f, `/\`):
+				name = f
+			default:
+				return nil, fmt.Errorf("line %d: unexpected %q", n, f)
+			}
+		}
+
+		expanded, err := expandArg(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if len(expanded) > 1 && (name != "" || checksum != "") {
+			return nil, fmt.Errorf("line %d: %s lists several files, so it takes no name or checksum", n, fields[0])
+		}
+		for i := range expanded {
+			if name != "" {
+				expanded[i].Filename = name
+			}
+			if checksum != "" {
+				expanded[i].Checksum = checksum
+			}
+		}
+		reqs = append(reqs, expanded...)
+	}
+	return reqs, scanner.Err()
+}
+
+// batchItem is a download queued by a batch run
+type batchItem struct {
+	ID  string
+	URL string
+}
+
+// waitForBatch polls statuses until every item has completed or failed,
+// showing their combined progress on line, and returns the last status of
+// each item by ID. Items the server stops reporting are given the status
+// "removed".
+func waitForBatch(items []batchItem, statuses func() ([]types.DownloadStatus, error), interval time.Duration, line *statusLine) map[string]types.DownloadStatus {
+	final := make(map[string]types.DownloadStatus, len(items))
+	for {
+		list, err := statuses()
+		if err != nil {
+			line.Printf("Error polling progress: %v\n", err)
+		} else {
+			byID := make(map[string]types.DownloadStatus, len(list))
+			for _, s := range list {
+				byID[s.ID] = s
+			}
+
+			var running []types.DownloadStatus
+			for _, item := range items {
+				if _, done := final[item.ID]; done {
+					continue
+				}
+				s, ok := byID[item.ID]
+				switch {
+				case !ok:
+					final[item.ID] = types.DownloadStatus{ID: item.ID, URL: item.URL, Status: "removed"}
+				case s.Status == "completed" || s.Status == "error":
+					final[item.ID] = s
+				default:
+					running = append(running, s)
+				}
+			}
+			if len(final) == len(items) {
+				line.Update("")
+				return final
+			}
+			progress := fmt.Sprintf("[%d/%d done]", len(final), len(items))
+			if l := formatProgressLine(running); l != "" {
+				progress += " " + l
+			}
+			line.Update(progress)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// printBatchSummary reports how a batch run went and returns the number of
+// downloads that did not complete
+func printBatchSummary(w io.Writer, items []batchItem, final map[string]types.DownloadStatus, elapsed time.Duration) int {
+	var completed int
+	var bytes int64
+	var failed []types.DownloadStatus
+	for _, item := range items {
+		s := final[item.ID]
+		if s.Status == "completed" {
+			completed++
+			bytes += s.TotalSize
+			continue
+		}
+		if s.URL == "" {
+			s.URL = item.URL
+		}
+		failed = append(failed, s)
+	}
+
+	fmt.Fprintf(w, "Downloaded %d of %d files (%s) in %s\n",
+		completed, len(items), utils.ConvertBytesToHumanReadable(bytes), elapsed.Round(time.Second))
+	if len(failed) > 0 {
+		fmt.Fprintf(w, "%d failed:\n", len(failed))
+		for _, s := range failed {
+			reason := s.Status
+			if s.Error != "" {
+				reason = s.Error
+			}
+			fmt.Fprintf(w, "  %s  %s (%s)\n", shortID(s.ID), s.URL, reason)
+		}
+	}
+	return len(failed)
+}
+
+// runBatch queues the downloads of an input file on the server at port,
+// waits for them to finish and prints a summary. It returns the number of
+// downloads that could not be queued or did not complete.
+func runBatch(reqs []DownloadRequest, outputDir string, resume bool, port int) int {
+	start := time.Now()
+	line := &statusLine{out: os.Stdout}
+
+	var items []batchItem
+	var rejected int
+	for _, req := range reqs {
+		req.Path = outputDir
+		req.Resume = resume
+		resp, err := postDownload(req, port)
+		switch {
+		case err != nil:
+			fmt.Printf("Error adding %s: %v\n", req.URL, err)
+			rejected++
+		case resp.Status == "pending_approval" || resp.ID == "":
+			// The TUI may change or refuse it, so it cannot be followed
+			fmt.Printf("Added %s, awaiting confirmation in the TUI\n", req.URL)
+		default:
+			items = append(items, batchItem{ID: resp.ID, URL: req.URL})
+		}
+	}
+	if len(items) == 0 {
+		return rejected
+	}
+	fmt.Printf("Queued %d downloads, waiting for them to finish...\n", len(items))
+
+	final := waitForBatch(items, func() ([]types.DownloadStatus, error) {
+		return GetRemoteDownloads(port)
+	}, batchPollInterval, line)
+	if rejected > 0 {
+		fmt.Printf("%d could not be queued\n", rejected)
+	}
+	return rejected + printBatchSummary(os.Stdout, items, final, time.Since(start))
+}
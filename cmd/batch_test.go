@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestReadInputFile(t *testing.T) {
+	sum := "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	content := strings.Join([]string{
+		"# nightly images",
+		"https://example.com/a.iso",
+		"",
+		"https://example.com/b.iso  renamed.iso",
+		"https://m1.example.com/c.iso,https://m2.example.com/c.iso\t" + sum + "  c.iso",
+		"  https://example.com/d.iso " + sum,
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs, err := readInputFile(path)
+	if err != nil {
+		t.Fatalf("readInputFile: %v", err)
+	}
+	want := []DownloadRequest{
+		{URL: "https://example.com/a.iso", Mirrors: []string{"https://example.com/a.iso"}},
+		{URL: "https://example.com/b.iso", Mirrors: []string{"https://example.com/b.iso"}, Filename: "renamed.iso"},
+		{URL: "https://m1.example.com/c.iso", Mirrors: []string{"https://m1.example.com/c.iso", "https://m2.example.com/c.iso"}, Filename: "c.iso", Checksum: sum},
+		{URL: "https://example.com/d.iso", Mirrors: []string{"https://example.com/d.iso"}, Checksum: sum},
+	}
+	if !reflect.DeepEqual(reqs, want) {
+		t.Errorf("readInputFile =\n%+v\nwant\n%+v", reqs, want)
+	}
+}
+
+func TestReadInputFile_Errors(t *testing.T) {
+	for name, line := range map[string]string{
+		"two names":     "https://example.com/a.iso one.iso two.iso",
+		"path as name":  "https://example.com/a.iso sub/a.iso",
+		"two checksums": "https://example.com/a.iso md5:abcd sha1:abcd",
+	} {
+		path := filepath.Join(t.TempDir(), "urls.txt")
+		if err := os.WriteFile(path, []byte("https://example.com/ok\n"+line+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := readInputFile(path)
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: error = %v, want one naming line 2", name, err)
+		}
+	}
+	if _, err := readInputFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestWaitForBatch(t *testing.T) {
+	items := []batchItem{
+		{ID: "a", URL: "https://example.com/a"},
+		{ID: "b", URL: "https://example.com/b"},
+		{ID: "c", URL: "https://example.com/c"},
+	}
+	polls := [][]types.DownloadStatus{
+		{
+			{ID: "a", Status: "downloading", Downloaded: 10, TotalSize: 100},
+			{ID: "b", Status: "queued"},
+			{ID: "c", Status: "downloading"},
+			{ID: "other", Status: "downloading"},
+		},
+		{
+			{ID: "a", Status: "completed", TotalSize: 100},
+			{ID: "b", Status: "downloading"},
+		},
+		{
+			{ID: "b", Status: "error", URL: "https://example.com/b"},
+		},
+	}
+	var n int
+	statuses := func() ([]types.DownloadStatus, error) {
+		p := polls[min(n, len(polls)-1)]
+		n++
+		return p, nil
+	}
+
+	final := waitForBatch(items, statuses, time.Millisecond, &statusLine{out: io.Discard})
+	if n != 3 {
+		t.Errorf("polled %d times, want 3", n)
+	}
+	for id, want := range map[string]string{"a": "completed", "b": "error", "c": "removed"} {
+		if got := final[id].Status; got != want {
+			t.Errorf("%s: status %q, want %q", id, got, want)
+		}
+	}
+	// Statuses are kept from when each item finished
+	if final["a"].TotalSize != 100 {
+		t.Errorf("a lost its size: %+v", final["a"])
+	}
+}
+
+func TestPrintBatchSummary(t *testing.T) {
+	items := []batchItem{
+		{ID: "aaaaaaaaaaaa", URL: "https://example.com/a"},
+		{ID: "bbbbbbbbbbbb", URL: "https://example.com/b"},
+	}
+	final := map[string]types.DownloadStatus{
+		"aaaaaaaaaaaa": {ID: "aaaaaaaaaaaa", Status: "completed", TotalSize: 2048},
+		"bbbbbbbbbbbb": {ID: "bbbbbbbbbbbb", Status: "error"},
+	}
+	var out strings.Builder
+	failed := printBatchSummary(&out, items, final, 3*time.Second)
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	got := out.String()
+	for _, want := range []string{"Downloaded 1 of 2 files", "in 3s", "1 failed:", "https://example.com/b (error)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary missing %q:\n%s", want, got)
+		}
+	}
+}
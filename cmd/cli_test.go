@@ -6,10 +6,18 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/spf13/cobra"
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 )
@@ -96,3 +104,495 @@ func TestGetRemoteDownloads(t *testing.T) {
 		t.Errorf("Mxpected ID 123, got %s", downloads[0].ID)
 	}
 }
+
+func TestParseTorrentArg_WebSeeds(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ubuntu.torrent")
+	info := "d6:lengthi1024e4:name10:ubuntu.iso12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	data := "d4:info" + info + "8:url-listl22:http://mirror.example/ee"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isTorrentArg(path) {
+		t.Fatal("expected path to be detected as torrent")
+	}
+	if isTorrentArg("https://example.com/file.torrent") {
+		t.Error("remote URL should not be treated as a local torrent")
+	}
+
+	req, err := parseTorrentArg(path)
+	if err != nil {
+		t.Fatalf("parseTorrentArg failed: %v", err)
+	}
+	if req.URL != "http://mirror.example/ubuntu.iso" {
+		t.Errorf("url = %s", req.URL)
+	}
+	if len(req.Mirrors) != 1 || req.Mirrors[0] != req.URL {
+		t.Errorf("mirrors = %v", req.Mirrors)
+	}
+	if req.Filename != "ubuntu.iso" || req.Size != 1024 {
+		t.Errorf("name = %s, size = %d", req.Filename, req.Size)
+	}
+	if req.Torrent != path {
+		t.Errorf("torrent = %s, want %s to verify pieces against", req.Torrent, path)
+	}
+}
+
+func TestParseMetalinkArg(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ubuntu.meta4")
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="ubuntu.iso">
+    <size>1024</size>
+    <hash type="sha-256">abcd</hash>
+    <url priority="2">http://b.example/ubuntu.iso</url>
+    <url priority="1">http://a.example/ubuntu.iso</url>
+  </file>
+</metalink>`
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isMetalinkArg(path) {
+		t.Fatal("expected path to be detected as metalink")
+	}
+	if isMetalinkArg("https://example.com/file.meta4") {
+		t.Error("remote URL should not be treated as a local metalink")
+	}
+
+	reqs, err := expandArg(path)
+	if err != nil {
+		t.Fatalf("expandArg failed: %v", err)
+	}
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if req.URL != "http://a.example/ubuntu.iso" {
+		t.Errorf("url = %s, want the highest priority URL", req.URL)
+	}
+	if len(req.Mirrors) != 2 || req.Mirrors[1] != "http://b.example/ubuntu.iso" {
+		t.Errorf("mirrors = %v", req.Mirrors)
+	}
+	if req.Filename != "ubuntu.iso" || req.Size != 1024 || req.Checksum != "sha256:abcd" {
+		t.Errorf("req = %+v", req)
+	}
+}
+
+func TestFindHistoryEntry(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	config.EnsureDirs()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	url := "https://example.com/nightly.iso"
+	entries := []types.DownloadEntry{
+		{ID: "11111111-aaaa-bbbb-cccc-000000000001", URL: url, DestPath: "/old/nightly.iso", Filename: "nightly.iso", Status: "completed", CompletedAt: 100},
+		{ID: "22222222-aaaa-bbbb-cccc-000000000002", URL: url, DestPath: "/new/nightly.iso", Filename: "nightly.iso", Status: "completed", CompletedAt: 200,
+			Mirrors:  []string{url, "https://mirror.example.com/nightly.iso"},
+			Headers:  http.Header{"X-Tenant": {"nightly"}},
+			Checksum: "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+	}
+	for _, e := range entries {
+		if err := state.AddToMasterList(e); err != nil {
+			t.Fatalf("AddToMasterList failed: %v", err)
+		}
+	}
+
+	byURL, err := findHistoryEntry(url)
+	if err != nil {
+		t.Fatalf("lookup by URL failed: %v", err)
+	}
+	if byURL.ID != entries[1].ID {
+		t.Errorf("lookup by URL = %s, want most recent %s", byURL.ID, entries[1].ID)
+	}
+
+	byID, err := findHistoryEntry("11111111")
+	if err != nil {
+		t.Fatalf("lookup by ID prefix failed: %v", err)
+	}
+	if byID.DestPath != "/old/nightly.iso" {
+		t.Errorf("lookup by ID returned %s", byID.DestPath)
+	}
+
+	req := againRequest(byURL)
+	if req.URL != url || req.Path != "/new" || req.Filename != "nightly.iso" || len(req.Mirrors) != 2 {
+		t.Errorf("againRequest = %+v", req)
+	}
+	if req.Headers["X-Tenant"] != "nightly" || req.Checksum != entries[1].Checksum {
+		t.Errorf("againRequest did not replay headers and checksum: %+v", req)
+	}
+	if req := againRequest(byID); len(req.Headers) != 0 || req.Checksum != "" {
+		t.Errorf("againRequest of a plain download = %+v", req)
+	}
+
+	if _, err := findHistoryEntry("https://example.com/missing"); err == nil {
+		t.Error("expected error for unknown URL")
+	}
+}
+
+func TestMirrorArgs(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("mirror", false, "")
+	args := []string{"https://a.example/f.iso", "https://b.example/f.iso"}
+
+	if got := mirrorArgs(cmd, args); !reflect.DeepEqual(got, args) {
+		t.Errorf("without --mirror: %v, want the URLs unchanged", got)
+	}
+	cmd.Flags().Set("mirror", "true")
+	got := mirrorArgs(cmd, args)
+	if len(got) != 1 {
+		t.Fatalf("with --mirror: %v, want one download", got)
+	}
+	if url, mirrors := ParseURLArg(got[0]); url != args[0] || !reflect.DeepEqual(mirrors, args) {
+		t.Errorf("ParseURLArg(%q) = %q, %v", got[0], url, mirrors)
+	}
+}
+
+func TestParseConcurrency(t *testing.T) {
+	for value, want := range map[string]struct {
+		conns    int
+		adaptive bool
+		ok       bool
+	}{
+		"auto": {0, true, true},
+		"AUTO": {0, true, true},
+		"8":    {8, false, true},
+		"0":    {ok: false},
+		"65":   {ok: false},
+		"fast": {ok: false},
+	} {
+		conns, adaptive, err := parseConcurrency(value)
+		if (err == nil) != want.ok || conns != want.conns || adaptive != want.adaptive {
+			t.Errorf("parseConcurrency(%q) = %d, %v, %v; want %d, %v, ok=%v", value, conns, adaptive, err, want.conns, want.adaptive, want.ok)
+		}
+	}
+}
+
+func TestApplyMaxActiveFlag(t *testing.T) {
+	oldPool := GlobalPool
+	GlobalPool = download.NewWorkerPool(nil, 3)
+	defer func() { GlobalPool = oldPool }()
+
+	for _, tt := range []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"0", 3, true}, // Unset keeps the settings
+		{"5", 5, true},
+		{"-1", 5, false},
+		{"33", 5, false},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().Int("max-active", 0, "")
+		cmd.Flags().Set("max-active", tt.value)
+		err := applyMaxActiveFlag(cmd)
+		if (err == nil) != tt.ok || GlobalPool.MaxDownloads() != tt.want {
+			t.Errorf("--max-active %s: MaxDownloads() = %d, %v; want %d, ok=%v", tt.value, GlobalPool.MaxDownloads(), err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPauseAllEndpoints(t *testing.T) {
+	oldPool := GlobalPool
+	GlobalPool = download.NewWorkerPool(nil, 3)
+	defer func() { GlobalPool = oldPool }()
+	mux := newAPIMux(0, t.TempDir())
+
+	post := func(target string, user *apiUser) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, withUser(httptest.NewRequest(http.MethodPost, target, nil), user))
+		return rec.Code
+	}
+
+	if code := post("/pause-all", &apiUser{Name: "alice", Token: "a"}); code != http.StatusForbidden {
+		t.Errorf("named user: got %d, want 403", code)
+	}
+	if code := post("/pause-all", nil); code != http.StatusOK || !GlobalPool.Held() {
+		t.Fatalf("pause-all: got %d, held=%v", code, GlobalPool.Held())
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if !strings.Contains(rec.Body.String(), `"all_paused":true`) {
+		t.Errorf("/health = %s, want all_paused", rec.Body.String())
+	}
+
+	if code := post("/resume-all", nil); code != http.StatusOK || GlobalPool.Held() {
+		t.Errorf("resume-all: got %d, held=%v", code, GlobalPool.Held())
+	}
+}
+
+func TestProxyFlag(t *testing.T) {
+	for _, tt := range []struct {
+		proxy, socks5 string
+		want          string
+		ok            bool
+	}{
+		{"", "", "", true},
+		{"http://proxy.lan:3128", "", "http://proxy.lan:3128", true},
+		{"none", "", "none", true},
+		{"", "user:pw@127.0.0.1:1080", "socks5://user:pw@127.0.0.1:1080", true},
+		{"", "socks5h://127.0.0.1:1080", "", false},
+		{"http://proxy.lan", "127.0.0.1:1080", "", false},
+		{"ftp://proxy.lan", "", "", false},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("proxy", "", "")
+		cmd.Flags().String("socks5", "", "")
+		cmd.Flags().Set("proxy", tt.proxy)
+		cmd.Flags().Set("socks5", tt.socks5)
+		got, err := proxyFlag(cmd)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("--proxy %q --socks5 %q = %q, %v; want %q, ok=%v", tt.proxy, tt.socks5, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	for _, tt := range []struct {
+		headers      []string
+		user, bearer string
+		want         map[string]string
+		ok           bool
+	}{
+		{ok: true},
+		{headers: []string{"x-api-key: k", "Cookie:a=1"}, want: map[string]string{"X-Api-Key": "k", "Cookie": "a=1"}, ok: true},
+		{user: "alice:pw", want: map[string]string{"Authorization": "Basic YWxpY2U6cHc="}, ok: true},
+		{headers: []string{"Authorization: Basic old"}, bearer: "tok", want: map[string]string{"Authorization": "Bearer tok"}, ok: true},
+		{user: "alice"},
+		{user: "alice:pw", bearer: "tok"},
+		{headers: []string{"no colon"}},
+		{headers: []string{"Range: bytes=0-"}},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().StringArray("header", nil, "")
+		cmd.Flags().String("user", "", "")
+		cmd.Flags().String("bearer", "", "")
+		for _, h := range tt.headers {
+			cmd.Flags().Set("header", h)
+		}
+		cmd.Flags().Set("user", tt.user)
+		cmd.Flags().Set("bearer", tt.bearer)
+		got, err := headerFlags(cmd)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("headers %q user %q bearer %q = %v, %v; want %v, ok=%v", tt.headers, tt.user, tt.bearer, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestChecksumFlag(t *testing.T) {
+	for _, tt := range []struct {
+		flags map[string]string
+		want  string
+		ok    bool
+	}{
+		{nil, "", true},
+		{map[string]string{"sha256": "9F86D081"}, "sha256:9f86d081", true},
+		{map[string]string{"md5": "abcd"}, "md5:abcd", true},
+		{map[string]string{"sha1": "not hex"}, "", false},
+		{map[string]string{"md5": "abcd", "sha256": "abcd"}, "", false},
+		{map[string]string{"checksum": "BLAKE3:AF1349B9"}, "blake3:af1349b9", true},
+		{map[string]string{"checksum": "xxh3:2d06800538d394c2"}, "xxh3:2d06800538d394c2", true},
+		{map[string]string{"checksum": "crc32:abcd"}, "", false},
+		{map[string]string{"checksum": "abcd"}, "", false},
+		{map[string]string{"checksum": "blake2b:abcd", "sha256": "abcd"}, "", false},
+	} {
+		cmd := &cobra.Command{}
+		for _, typ := range checksumFlags {
+			cmd.Flags().String(typ, "", "")
+		}
+		cmd.Flags().String("checksum", "", "")
+		for name, value := range tt.flags {
+			cmd.Flags().Set(name, value)
+		}
+		got, err := checksumFlag(cmd)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("flags %v = %q, %v; want %q, ok=%v", tt.flags, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExpectFlags(t *testing.T) {
+	for _, tt := range []struct {
+		headers []string
+		size    string
+		want    map[string]string
+		ok      bool
+	}{
+		{ok: true},
+		{headers: []string{"content-type: application/zip"}, size: "12345", want: map[string]string{"Content-Type": "application/zip"}, ok: true},
+		{headers: []string{"Content-Type"}},
+		{headers: []string{"Content-Type:"}},
+		{size: "-1"},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().StringArray("expect-header", nil, "")
+		cmd.Flags().Int64("expect-size", 0, "")
+		for _, h := range tt.headers {
+			cmd.Flags().Set("expect-header", h)
+		}
+		if tt.size != "" {
+			cmd.Flags().Set("expect-size", tt.size)
+		}
+		got, _, err := expectFlags(cmd)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("headers %q size %q = %v, %v; want %v, ok=%v", tt.headers, tt.size, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSignatureFlags(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.asc")
+	for _, tt := range []struct {
+		flags map[string]string
+		ok    bool
+	}{
+		{nil, true},
+		{map[string]string{"signature": "https://example.com/f.iso.asc"}, false},
+		{map[string]string{"keyring": missing}, false},
+		{map[string]string{"signature": "https://example.com/f.iso.asc", "keyring": missing}, false},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("signature", "", "")
+		cmd.Flags().String("keyring", "", "")
+		for name, value := range tt.flags {
+			cmd.Flags().Set(name, value)
+		}
+		if _, _, err := signatureFlags(cmd); (err == nil) != tt.ok {
+			t.Errorf("flags %v: err = %v, want ok=%v", tt.flags, err, tt.ok)
+		}
+	}
+}
+
+func TestDownloadOptions_Cookies(t *testing.T) {
+	expires := time.Unix(2000000000, 0)
+	opts := downloadOptions{Cookies: []*http.Cookie{
+		{Name: "session", Value: "s", Domain: ".example.com", Path: "/", Secure: true, Expires: expires},
+		{Name: "cdn", Value: "c", Domain: "cdn.mirror.net"},
+		{Name: "other", Value: "o", Domain: ".other.org"},
+	}}
+	req := DownloadRequest{URL: "https://dl.example.com/f.iso", Mirrors: []string{"https://cdn.mirror.net/f.iso"}}
+	opts.apply(&req)
+
+	want := []requestCookie{
+		{Name: "session", Value: "s", Domain: ".example.com", Path: "/", Secure: true, Expires: expires.Unix()},
+		{Name: "cdn", Value: "c", Domain: "cdn.mirror.net"},
+	}
+	if !reflect.DeepEqual(req.Cookies, want) {
+		t.Fatalf("request cookies = %+v, want %+v", req.Cookies, want)
+	}
+
+	parsed, err := parseRequestCookies(req.Cookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || !parsed[0].Expires.Equal(expires) || !parsed[0].Secure || !parsed[1].Expires.IsZero() {
+		t.Errorf("parsed cookies = %v", parsed)
+	}
+}
+
+func TestDeleteCompletedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	path := filepath.Join(tempDir, "done.iso")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(tempDir, "partial.iso")
+	if err := os.WriteFile(partial, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []types.DownloadEntry{
+		{ID: "done", URL: "http://example.com/done.iso", DestPath: path, Status: "completed"},
+		{ID: "partial", URL: "http://example.com/partial.iso", DestPath: partial, Status: "paused"},
+	} {
+		if err := state.AddToMasterList(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := deleteCompletedFile("done", true); err != nil {
+		t.Fatalf("deleteCompletedFile failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the completed file is still there")
+	}
+
+	// Only completed files are deleted
+	if err := deleteCompletedFile("partial", true); err != nil {
+		t.Fatalf("deleteCompletedFile failed: %v", err)
+	}
+	if _, err := os.Stat(partial); err != nil {
+		t.Errorf("an unfinished download's file was deleted: %v", err)
+	}
+}
+
+func TestHandleMoveFile(t *testing.T) {
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+	oldCh := GlobalProgressCh
+	GlobalProgressCh = make(chan any, 10)
+	defer func() { GlobalProgressCh = oldCh }()
+
+	path := filepath.Join(tempDir, "done.iso")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []types.DownloadEntry{
+		{ID: "done", URL: "http://example.com/done.iso", DestPath: path, Status: "completed"},
+		{ID: "partial", URL: "http://example.com/partial.iso", DestPath: filepath.Join(tempDir, "partial.iso"), Status: "paused"},
+	} {
+		if err := state.AddToMasterList(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := filepath.Join(tempDir, "archive")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	move := func(id string, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/move-file?"+url.Values{"id": {id}, "dir": {dir}}.Encode(), nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		handleMoveFile(rec, req)
+		return rec
+	}
+
+	if rec := move("done", "https://evil.example"); rec.Code != http.StatusForbidden {
+		t.Errorf("move from a web page = %d, want 403", rec.Code)
+	}
+	if rec := move("partial", ""); rec.Code != http.StatusConflict {
+		t.Errorf("move of an unfinished download = %d, want 409", rec.Code)
+	}
+	if rec := move("done", ""); rec.Code != http.StatusOK {
+		t.Fatalf("move = %d: %s", rec.Code, rec.Body)
+	}
+	dest := filepath.Join(dir, "done.iso")
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("file not moved: %v", err)
+	}
+	select {
+	case msg := <-GlobalProgressCh:
+		if moved, ok := msg.(events.DownloadMovedMsg); !ok || moved.DestPath != dest {
+			t.Errorf("event = %#v, want a DownloadMovedMsg to %s", msg, dest)
+		}
+	default:
+		t.Error("no DownloadMovedMsg sent")
+	}
+}
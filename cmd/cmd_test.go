@@ -15,6 +15,8 @@ import (
 
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
 func init() {
@@ -23,6 +25,23 @@ func init() {
 	GlobalPool = download.NewWorkerPool(GlobalProgressCh, 4)
 }
 
+// discardProgress reads and drops what is sent to ch until stop is called.
+// ch stays open, as a pool may still report on cancelled downloads after
+// Cancel returns.
+func discardProgress(ch <-chan any) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
 // =============================================================================
 // findAvailablePort Tests
 // =============================================================================
@@ -103,7 +122,7 @@ func TestSaveAndRemoveActivePort(t *testing.T) {
 	saveActivePort(testPort)
 
 	// Verify file exists and contains correct port
-	portFile := filepath.Join(config.GetSurgeDir(), "port")
+	portFile := filepath.Join(config.GetCacheDir(), "port")
 	data, err := os.ReadFile(portFile)
 	if err != nil {
 		t.Fatalf("Failed to read port file: %v", err)
@@ -224,6 +243,22 @@ func TestHandleDownload_MissingURL(t *testing.T) {
 	}
 }
 
+func TestHandleDownload_MultiFileTorrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "album.torrent")
+	info := "d5:filesld6:lengthi1e4:pathl1:aeee4:name5:album12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	if err := os.WriteFile(path, []byte("d4:info"+info+"e"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(DownloadRequest{URL: "http://example.com/a", Torrent: path})
+	rec := httptest.NewRecorder()
+
+	handleDownload(rec, httptest.NewRequest(http.MethodPost, "/download", bytes.NewReader(body)), t.TempDir())
+
+	if rec.Code != http.StatusBadRequest || !bytes.Contains(rec.Body.Bytes(), []byte("multi-file")) {
+		t.Errorf("got %d %q, want the torrent refused before downloading", rec.Code, rec.Body.String())
+	}
+}
+
 func TestHandleDownload_EmptyURL(t *testing.T) {
 	body := `{"url": ""}`
 	req := httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(body))
@@ -261,6 +296,186 @@ func TestHandleDownload_PathTraversal(t *testing.T) {
 	}
 }
 
+func TestHandleDownload_InvalidOptions(t *testing.T) {
+	for name, body := range map[string]string{
+		"proxy scheme":   `{"url": "http://x.com/f", "proxy": "ftp://proxy.lan"}`,
+		"header name":    `{"url": "http://x.com/f", "headers": {"Bad Name": "x"}}`,
+		"header newline": `{"url": "http://x.com/f", "headers": {"X-A": "a\r\nX-B: b"}}`,
+		"range header":   `{"url": "http://x.com/f", "headers": {"Range": "bytes=0-"}}`,
+		"cookie domain":  `{"url": "http://x.com/f", "cookies": [{"name": "a", "value": "1"}]}`,
+		"cookie name":    `{"url": "http://x.com/f", "cookies": [{"name": "a b", "value": "1", "domain": "x.com"}]}`,
+		"schedule":       `{"url": "http://x.com/f", "schedule": "tonight"}`,
+		"priority":       `{"url": "http://x.com/f", "priority": "urgent"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(body))
+			rec := httptest.NewRecorder()
+			handleDownload(rec, req, "")
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleDownload_BlockedHost(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	settings := config.DefaultSettings()
+	settings.Connections.BlockedHosts = []string{"blocked.test"}
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"url": "http://ok.test/f", "mirrors": ["http://ok.test/f", "http://cdn.blocked.test/f"]}`
+	req := httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	handleDownload(rec, req, "")
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", rec.Code)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("blocked_hosts")) {
+		t.Errorf("Expected the blocking rule in the response, got %q", rec.Body.String())
+	}
+}
+
+func TestHandleDownload_QueueFull(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	// The single worker stays busy while the origin holds its request open
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer origin.Close()
+
+	oldPool, oldCh := GlobalPool, GlobalProgressCh
+	progressCh := make(chan any, 100)
+	GlobalProgressCh = progressCh
+	GlobalPool = download.NewWorkerPool(progressCh, 1)
+	GlobalPool.SetMaxQueued(1)
+	stop := discardProgress(progressCh)
+	defer func() {
+		for _, cfg := range GlobalPool.GetAll() {
+			GlobalPool.Cancel(cfg.ID)
+		}
+		stop()
+		GlobalPool, GlobalProgressCh = oldPool, oldCh
+	}()
+
+	post := func(name string) *httptest.ResponseRecorder {
+		body := `{"url": "` + origin.URL + "/" + name + `"}`
+		rec := httptest.NewRecorder()
+		handleDownload(rec, httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(body)), tempDir)
+		return rec
+	}
+
+	if rec := post("running"); rec.Code != http.StatusOK {
+		t.Fatalf("first download: got %d", rec.Code)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for GlobalPool.QueueLength() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec := post("waiting")
+	if rec.Code != http.StatusOK || rec.Header().Get(headerQueueLength) != "0" || rec.Header().Get(headerQueueLimit) != "1" {
+		t.Fatalf("second download: got %d with queue headers %q/%q", rec.Code, rec.Header().Get(headerQueueLength), rec.Header().Get(headerQueueLimit))
+	}
+
+	rec = post("rejected")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 with a full queue, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header with a full queue")
+	}
+	if retryAfter(rec.Result()) != queueFullRetryAfter {
+		t.Errorf("retryAfter() = %v, want %v", retryAfter(rec.Result()), queueFullRetryAfter)
+	}
+}
+
+func TestHandleDownload_ResumeByURL(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer origin.Close()
+	defer close(release)
+
+	// Progress a crashed run left behind
+	interrupted := origin.URL + "/interrupted.iso"
+	dest := filepath.Join(tempDir, "interrupted.iso")
+	if err := state.SaveState(interrupted, dest, &types.DownloadState{
+		ID: "interrupted-id", URL: interrupted, DestPath: dest, Filename: "interrupted.iso",
+		TotalSize: 1000, Downloaded: 600, Tasks: []types.Task{{Offset: 600, Length: 400}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	oldPool, oldCh := GlobalPool, GlobalProgressCh
+	progressCh := make(chan any, 100)
+	GlobalProgressCh = progressCh
+	GlobalPool = download.NewWorkerPool(progressCh, 2)
+	stop := discardProgress(progressCh)
+	defer func() {
+		for _, cfg := range GlobalPool.GetAll() {
+			GlobalPool.Cancel(cfg.ID)
+		}
+		stop()
+		GlobalPool, GlobalProgressCh = oldPool, oldCh
+	}()
+
+	post := func(url string) map[string]string {
+		rec := httptest.NewRecorder()
+		body := `{"url": "` + url + `", "resume": true}`
+		handleDownload(rec, httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(body)), tempDir)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s: got %d: %s", url, rec.Code, rec.Body.String())
+		}
+		var resp map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	if resp := post(interrupted); resp["status"] != "resumed" || resp["id"] != "interrupted-id" {
+		t.Fatalf("resume of saved download = %v, want it resumed", resp)
+	}
+	var found bool
+	for _, cfg := range GlobalPool.GetAll() {
+		if cfg.ID == "interrupted-id" {
+			found = cfg.IsResume && cfg.DestPath == dest
+		}
+	}
+	if !found {
+		t.Error("saved download was not continued from its state")
+	}
+
+	// Asking again finds it in the pool instead of adding a second copy
+	if resp := post(interrupted); resp["id"] != "interrupted-id" {
+		t.Errorf("second resume = %v, want the same download", resp)
+	}
+
+	// Without saved progress the URL is downloaded as usual
+	if resp := post(origin.URL + "/fresh.iso"); resp["status"] == "resumed" {
+		t.Errorf("resume of an unknown URL = %v, want a new download", resp)
+	}
+}
+
 // func TestHandleDownload_StatusQuery(t *testing.T) {
 // 	// Setup mock download
 // 	id := "test-status-id"
@@ -553,7 +768,7 @@ func TestStartHTTPServer_HealthEndpoint(t *testing.T) {
 	port := ln.Addr().(*net.TCPAddr).Port
 
 	// Start server in background
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 
 	// Give server time to start
 	time.Sleep(50 * time.Millisecond)
@@ -589,7 +804,7 @@ func TestStartHTTPServer_NoCORSHeaders(t *testing.T) {
 	}
 	port := ln.Addr().(*net.TCPAddr).Port
 
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 	time.Sleep(50 * time.Millisecond)
 
 	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/health", port))
@@ -610,7 +825,7 @@ func TestStartHTTPServer_OptionsRequest(t *testing.T) {
 	}
 	port := ln.Addr().(*net.TCPAddr).Port
 
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 	time.Sleep(50 * time.Millisecond)
 
 	req, _ := http.NewRequest(http.MethodOptions, fmt.Sprintf("http://127.0.0.1:%d/download", port), nil)
@@ -632,7 +847,7 @@ func TestStartHTTPServer_DownloadEndpoint_MethodNotAllowed(t *testing.T) {
 	}
 	port := ln.Addr().(*net.TCPAddr).Port
 
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 	time.Sleep(50 * time.Millisecond)
 
 	// PUT should not be allowed
@@ -655,7 +870,7 @@ func TestStartHTTPServer_DownloadEndpoint_BadRequest(t *testing.T) {
 	}
 	port := ln.Addr().(*net.TCPAddr).Port
 
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 	time.Sleep(50 * time.Millisecond)
 
 	// POST with invalid JSON
@@ -681,7 +896,7 @@ func TestStartHTTPServer_DownloadEndpoint_MissingURL(t *testing.T) {
 	}
 	port := ln.Addr().(*net.TCPAddr).Port
 
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 	time.Sleep(50 * time.Millisecond)
 
 	// POST with missing URL
@@ -707,7 +922,7 @@ func TestStartHTTPServer_NotFoundEndpoint(t *testing.T) {
 	}
 	port := ln.Addr().(*net.TCPAddr).Port
 
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 	time.Sleep(50 * time.Millisecond)
 
 	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/nonexistent", port))
@@ -832,7 +1047,7 @@ func TestPortFileLifecycle(t *testing.T) {
 	// Clean up first
 	removeActivePort()
 
-	portFile := filepath.Join(config.GetSurgeDir(), "port")
+	portFile := filepath.Join(config.GetCacheDir(), "port")
 
 	// Verify no port file initially
 	if _, err := os.Stat(portFile); !os.IsNotExist(err) {
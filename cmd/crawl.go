@@ -0,0 +1,469 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults and limits for extract --recursive
+const (
+	defaultCrawlDepth    = 3
+	defaultCrawlDelay    = time.Second
+	defaultCrawlParallel = 4
+	defaultCrawlMaxFiles = 1000
+	maxCrawlDelay        = time.Minute // Cap on a robots.txt Crawl-delay
+	maxRobotsBytes       = 512 << 10
+	robotsAgent          = "surge" // Product token matched against robots.txt User-agent lines
+)
+
+// errRobotsDisallowed is returned for links robots.txt keeps Surge away from
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// pageExtensions are the path extensions of links a crawl follows as pages
+// rather than lists as files
+var pageExtensions = map[string]bool{
+	"": true, ".html": true, ".htm": true, ".xhtml": true, ".shtml": true,
+	".php": true, ".asp": true, ".aspx": true, ".jsp": true, ".cgi": true,
+}
+
+// crawlOptions controls a recursive extract
+type crawlOptions struct {
+	Patterns     []string
+	Depth        int           // Levels of pages to follow below the start page
+	Delay        time.Duration // Minimum gap between requests to one host
+	Parallel     int           // Requests in flight at once, across hosts
+	IgnoreRobots bool
+	MaxFiles     int   // Links listed at most; 0 is no limit
+	MaxSize      int64 // Total size of the listed files; 0 is no limit
+	Types        typeFilter
+}
+
+// crawler walks pages under a start URL. Requests to one host are spaced by
+// the crawl delay; requests to different hosts run in parallel.
+type crawler struct {
+	opts  crawlOptions
+	pc    *pageClient
+	scope *url.URL // Pages are followed on this host under this directory
+
+	mu    sync.Mutex
+	hosts map[string]*crawlHost
+
+	disallowed int // Links skipped for robots.txt, counted by the walk only
+}
+
+// crawlHost is the politeness state of one scheme and host
+type crawlHost struct {
+	mu   sync.Mutex
+	next time.Time // Earliest time of the next request
+
+	robotsOnce sync.Once
+	robots     *robotsRules
+}
+
+// crawledPage is the outcome of fetching one link the crawl followed
+type crawledPage struct {
+	final     *url.URL
+	links     []string
+	file      bool   // The link was not an HTML page
+	size      int64  // Content-Length of a file, or -1
+	mediaType string // Content-Type of a file
+	err       error
+}
+
+// crawl walks the pages under start, up to opts.Depth links deep, and returns
+// the file links on them in the order a breadth-first walk finds them.
+// Pages are followed on the start page's host under its directory. Only the
+// start page failing is an error; other pages that fail are reported and
+// skipped.
+func crawl(start string, opts crawlOptions) ([]string, error) {
+	scope, err := url.Parse(start)
+	if err != nil || (scope.Scheme != "http" && scope.Scheme != "https") {
+		return nil, fmt.Errorf("invalid page URL %q", start)
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	c := &crawler{opts: opts, pc: newPageClient(), scope: scope, hosts: make(map[string]*crawlHost)}
+
+	level := []string{start}
+	visited := map[string]bool{start: true}
+	seen := make(map[string]bool)
+	var files []string
+	var total int64
+	for depth := 0; len(level) > 0; depth++ {
+		pages := make([]crawledPage, len(level))
+		c.each(len(level), func(i int) { pages[i] = c.fetch(level[i]) })
+
+		var next, found []string
+		sizes := make(map[string]int64)
+		mediaTypes := make(map[string]string) // Of files the walk already fetched
+		for i, page := range pages {
+			if page.err != nil {
+				if depth == 0 {
+					return nil, page.err
+				}
+				if errors.Is(page.err, errRobotsDisallowed) {
+					c.disallowed++
+				} else {
+					fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", level[i], page.err)
+				}
+				continue
+			}
+			if depth == 0 {
+				c.scope = page.final // Follow pages under where redirects ended up
+			}
+			if page.file {
+				if u, _ := url.Parse(level[i]); !seen[level[i]] && (len(opts.Patterns) == 0 || matchesFilePattern(u, opts.Patterns)) {
+					seen[level[i]] = true
+					sizes[level[i]] = page.size
+					mediaTypes[level[i]] = page.mediaType
+					found = append(found, level[i])
+				}
+				continue
+			}
+			for _, link := range page.links {
+				u, _ := url.Parse(link)
+				switch c.classify(u) {
+				case crawlPage:
+					if depth < opts.Depth && !visited[link] {
+						visited[link] = true
+						next = append(next, link)
+					}
+				case crawlFile:
+					if !seen[link] {
+						seen[link] = true
+						sizes[link] = -1
+						found = append(found, link)
+					}
+				}
+			}
+		}
+
+		// Files are checked against robots.txt and, for --max-size and
+		// --accept-type or --reject-type, asked for their size and type with
+		// a HEAD request when the walk has not fetched them
+		allowed := make([]bool, len(found))
+		headSizes := make([]int64, len(found))
+		headTypes := make([]string, len(found))
+		c.each(len(found), func(i int) {
+			u, _ := url.Parse(found[i])
+			_, fetched := mediaTypes[found[i]]
+			headSizes[i] = -1
+			if allowed[i] = c.allowed(u); allowed[i] && !fetched && (opts.MaxSize > 0 || opts.Types.active()) {
+				headSizes[i], headTypes[i] = headLink(c.request, found[i])
+			}
+		})
+		for i, link := range found {
+			if !allowed[i] {
+				c.disallowed++
+				continue
+			}
+			if _, fetched := mediaTypes[link]; !fetched {
+				sizes[link], mediaTypes[link] = headSizes[i], headTypes[i]
+			}
+			if !opts.Types.allows(mediaTypes[link]) {
+				fmt.Fprintf(os.Stderr, "Warning: skipping %s: it is %s\n", link, mediaTypes[link])
+				continue
+			}
+			if opts.MaxFiles > 0 && len(files) == opts.MaxFiles {
+				fmt.Fprintf(os.Stderr, "Warning: stopped at --max-files %d\n", opts.MaxFiles)
+				c.reportDisallowed()
+				return files, nil
+			}
+			size := sizes[link]
+			if opts.MaxSize > 0 && size > 0 && total+size > opts.MaxSize {
+				fmt.Fprintf(os.Stderr, "Warning: skipping %s: it would take the total past --max-size\n", link)
+				continue
+			}
+			if size > 0 {
+				total += size
+			}
+			files = append(files, link)
+		}
+		level = next
+	}
+	c.reportDisallowed()
+	return files, nil
+}
+
+// reportDisallowed notes how many links robots.txt kept out of the result
+func (c *crawler) reportDisallowed() {
+	if c.disallowed > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d links disallowed by robots.txt (use --ignore-robots to include them)\n", c.disallowed)
+	}
+}
+
+// Kinds of link found on a crawled page
+const (
+	crawlSkip = iota
+	crawlPage
+	crawlFile
+)
+
+// classify decides what the crawl does with link. Links matching a pattern
+// are files. Otherwise links that look like pages are followed when they are
+// in scope, and with no patterns every other link is a file.
+func (c *crawler) classify(link *url.URL) int {
+	if len(c.opts.Patterns) > 0 && matchesFilePattern(link, c.opts.Patterns) {
+		return crawlFile
+	}
+	if pageExtensions[strings.ToLower(path.Ext(link.Path))] {
+		if c.inScope(link) {
+			return crawlPage
+		}
+		return crawlSkip
+	}
+	if len(c.opts.Patterns) == 0 {
+		return crawlFile
+	}
+	return crawlSkip
+}
+
+// inScope reports whether link is on the start page's host under its directory
+func (c *crawler) inScope(link *url.URL) bool {
+	if !strings.EqualFold(link.Host, c.scope.Host) {
+		return false
+	}
+	dir := c.scope.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+		if !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+	}
+	p := link.Path
+	if p == "" {
+		p = "/"
+	}
+	return strings.HasPrefix(p, dir)
+}
+
+// fetch requests link and, if it is an HTML page, returns its links
+func (c *crawler) fetch(link string) crawledPage {
+	resp, err := c.request(http.MethodGet, link)
+	if err != nil {
+		return crawledPage{err: err}
+	}
+	defer resp.Body.Close()
+	if !isHTMLResponse(resp) {
+		return crawledPage{final: resp.Request.URL, file: true, size: resp.ContentLength, mediaType: responseType(resp)}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxExtractBytes))
+	if err != nil {
+		return crawledPage{err: fmt.Errorf("failed to read %s: %w", link, err)}
+	}
+	return crawledPage{final: resp.Request.URL, links: extractLinks(resp.Request.URL, string(body), nil)}
+}
+
+// isHTMLResponse reports whether resp is an HTML page worth extracting links from
+func isHTMLResponse(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// request makes a request for link once robots.txt allows it and the host's
+// crawl delay has passed
+func (c *crawler) request(method, link string) (*http.Response, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if !c.allowed(u) {
+		return nil, errRobotsDisallowed
+	}
+	c.wait(c.host(u))
+	return c.pc.do(method, link)
+}
+
+// host returns the politeness state for link's scheme and host
+func (c *crawler) host(link *url.URL) *crawlHost {
+	key := link.Scheme + "://" + strings.ToLower(link.Host)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.hosts[key]
+	if h == nil {
+		h = &crawlHost{}
+		c.hosts[key] = h
+	}
+	return h
+}
+
+// wait blocks until h may be sent the next request and books the slot after it
+func (c *crawler) wait(h *crawlHost) {
+	delay := c.opts.Delay
+	if h.robots != nil && h.robots.delay > delay {
+		delay = h.robots.delay
+	}
+	h.mu.Lock()
+	at := h.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(delay)
+	h.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// allowed reports whether robots.txt on link's host lets Surge fetch it. The
+// file is fetched once per host; a host without one allows everything.
+func (c *crawler) allowed(link *url.URL) bool {
+	if c.opts.IgnoreRobots {
+		return true
+	}
+	h := c.host(link)
+	h.robotsOnce.Do(func() {
+		robotsURL := (&url.URL{Scheme: link.Scheme, Host: link.Host, Path: "/robots.txt"}).String()
+		c.wait(h)
+		resp, err := c.pc.do(http.MethodGet, robotsURL)
+		if err != nil {
+			h.robots = &robotsRules{}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRobotsBytes))
+		h.robots = parseRobots(string(body))
+	})
+	target := link.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if link.RawQuery != "" {
+		target += "?" + link.RawQuery
+	}
+	return h.robots.allows(target)
+}
+
+// each runs fn for 0 to n-1 with at most opts.Parallel calls at once
+func (c *crawler) each(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.opts.Parallel)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// robotsRules are the robots.txt rules that apply to Surge on one host
+type robotsRules struct {
+	rules []robotsRule
+	delay time.Duration // Crawl-delay, capped at maxCrawlDelay
+}
+
+type robotsRule struct {
+	pattern *regexp.Regexp
+	length  int // Length of the rule as written; the longest match wins
+	allow   bool
+}
+
+// parseRobots returns the rules of the robots.txt group for Surge, or of the
+// "*" group when none names it
+func parseRobots(body string) *robotsRules {
+	var named, general *robotsRules
+	var current []*robotsRules // Groups the rule lines being read belong to
+	inAgents := false
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = nil // A new group starts
+			}
+			inAgents = true
+			token, _, _ := strings.Cut(value, "/")
+			switch {
+			case token == "*":
+				if general == nil {
+					general = &robotsRules{}
+				}
+				current = append(current, general)
+			case strings.EqualFold(token, robotsAgent):
+				if named == nil {
+					named = &robotsRules{}
+				}
+				current = append(current, named)
+			}
+		case "allow", "disallow":
+			inAgents = false
+			if value == "" {
+				continue // An empty Disallow allows everything
+			}
+			rule := robotsRule{pattern: compileRobotsPattern(value), length: len(value), allow: key == "allow"}
+			for _, g := range current {
+				g.rules = append(g.rules, rule)
+			}
+		case "crawl-delay":
+			inAgents = false
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			delay := min(time.Duration(seconds*float64(time.Second)), maxCrawlDelay)
+			for _, g := range current {
+				g.delay = delay
+			}
+		}
+	}
+	switch {
+	case named != nil:
+		return named
+	case general != nil:
+		return general
+	}
+	return &robotsRules{}
+}
+
+// compileRobotsPattern turns a robots.txt path pattern, where * matches
+// anything and a trailing $ anchors the end, into a regexp
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allows reports whether target, a path with its query, may be fetched. The
+// longest matching rule decides and Allow wins ties.
+func (r *robotsRules) allows(target string) bool {
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best, allow = rule.length, rule.allow
+		}
+	}
+	return allow
+}
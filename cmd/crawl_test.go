@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	body := `# Example
+User-agent: *
+Disallow: /private/
+Crawl-delay: 2
+
+User-agent: Surge/1.0
+User-agent: otherbot
+Disallow: /files/
+Allow: /files/public/
+Disallow: /*.iso$
+Crawl-delay: 0.5
+
+User-agent: otherbot
+Disallow: /
+`
+	rules := parseRobots(body)
+	if rules.delay != 500*time.Millisecond {
+		t.Errorf("delay = %v, want 500ms from the group naming surge", rules.delay)
+	}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/", true},
+		{"/private/a.zip", true}, // Only the "*" group disallows it
+		{"/files/a.zip", false},
+		{"/files/public/a.zip", true},
+		{"/pub/debian.iso", false},
+		{"/pub/debian.iso.sig", true},
+	}
+	for _, tt := range tests {
+		if got := rules.allows(tt.target); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+
+	general := parseRobots("User-agent: *\nDisallow: /private/\nCrawl-delay: 9000\n")
+	if general.allows("/private/x") || !general.allows("/x") {
+		t.Error("the * group should apply when no group names surge")
+	}
+	if general.delay != maxCrawlDelay {
+		t.Errorf("delay = %v, want it capped at %v", general.delay, maxCrawlDelay)
+	}
+	if !parseRobots("User-agent: *\nDisallow:\n").allows("/anything") {
+		t.Error("an empty Disallow should allow everything")
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	var mu sync.Mutex
+	requested := make(map[string]int)
+	mux := http.NewServeMux()
+	page := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /docs/secret/\n"))
+	})
+	mux.HandleFunc("/docs/guide/", page(`<a href="b.pdf">b</a> <a href="../a.pdf">a</a> <a href="deep/">d</a>`))
+	mux.HandleFunc("/docs/guide/deep/", page(`<a href="c.pdf">c</a>`))
+	mux.HandleFunc("/docs/secret/", page(`<a href="hidden.pdf">h</a>`))
+	mux.HandleFunc("/other/", page(`<a href="x.pdf">x</a>`))
+	mux.HandleFunc("/docs/get", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Length", "100")
+	})
+	mux.HandleFunc("/docs/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path]++
+		mu.Unlock()
+		page(`<a href="a.pdf">a</a> <a href="guide/">g</a> <a href="secret/">s</a> <a href="/other/">o</a> <a href="get">dl</a>`)(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	start := server.URL + "/docs/"
+
+	opts := crawlOptions{Depth: 1, Parallel: 4, MaxFiles: 100}
+	links, err := crawl(start, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{start + "a.pdf", start + "guide/b.pdf", start + "get"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("crawl() =\n%v\nwant\n%v", links, want)
+	}
+
+	opts.Depth = 2
+	opts.Patterns = []string{"*.pdf"}
+	opts.IgnoreRobots = true
+	links, err = crawl(start, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{start + "a.pdf", start + "guide/b.pdf", start + "secret/hidden.pdf", start + "guide/deep/c.pdf"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("crawl() ignoring robots =\n%v\nwant\n%v", links, want)
+	}
+
+	opts.MaxFiles = 2
+	if links, _ = crawl(start, opts); len(links) != 2 {
+		t.Errorf("crawl() with --max-files 2 returned %d links", len(links))
+	}
+
+	if _, err := crawl(server.URL+"/missing/", opts); err == nil {
+		t.Error("crawl() of a missing start page should fail")
+	}
+	if requested["/docs/"] != 3 {
+		t.Errorf("start page fetched %d times over 3 crawls", requested["/docs/"])
+	}
+}
+
+func TestCrawlMaxSize(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	sizes := map[string]int{"/a.bin": 600, "/b.bin": 600, "/c.bin": 300}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if size, ok := sizes[r.URL.Path]; ok {
+			w.Header().Set("Content-Length", fmt.Sprint(size))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="a.bin">a</a> <a href="b.bin">b</a> <a href="c.bin">c</a>`))
+	}))
+	defer server.Close()
+
+	opts := crawlOptions{Parallel: 2, IgnoreRobots: true, MaxSize: 1000}
+	links, err := crawl(server.URL+"/", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b.bin would take the total past 1000 bytes; c.bin still fits
+	want := []string{server.URL + "/a.bin", server.URL + "/c.bin"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("crawl() = %v, want %v", links, want)
+	}
+}
+
+func TestCrawlTypes(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	types := map[string]string{"/a.mp4": "video/mp4", "/b.bin": "application/octet-stream", "/c.pdf": "application/pdf"}
+	var mu sync.Mutex
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mediaType, ok := types[r.URL.Path]; ok {
+			mu.Lock()
+			methods = append(methods, r.Method)
+			mu.Unlock()
+			w.Header().Set("Content-Type", mediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="a.mp4">a</a> <a href="b.bin">b</a> <a href="c.pdf">c</a>`))
+	}))
+	defer server.Close()
+
+	opts := crawlOptions{Parallel: 2, IgnoreRobots: true, Types: typeFilter{Accept: []string{"video/*", "application/pdf"}}}
+	links, err := crawl(server.URL+"/", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/a.mp4", server.URL + "/c.pdf"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("crawl() = %v, want %v", links, want)
+	}
+	for _, m := range methods {
+		if m != http.MethodHead {
+			t.Errorf("a file was requested with %s, want only HEAD", m)
+		}
+	}
+}
+
+func TestCrawlerWaitSpacesRequestsToAHost(t *testing.T) {
+	c := &crawler{opts: crawlOptions{Delay: 40 * time.Millisecond}, hosts: make(map[string]*crawlHost)}
+	h := &crawlHost{}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.wait(h)
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("3 requests to one host took %v, want at least 2 delays", elapsed)
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [url]...",
+	Short: "Run Surge in the background with a JSON-RPC control API",
+	Long: `Run the download engine headlessly, like 'surge server start', and accept
+JSON-RPC 2.0 calls on a unix socket that only the current user can open.
+The same calls are served over HTTP at POST /rpc on the server port.
+
+Messages are JSON objects (or batches of them); one response is written per
+line. Methods and their params:
+
+  add     {"url": "...", "filename": "...", "path": "...", "mirrors": [...]}
+  status  {"id": "..."}
+  pause   {"id": "..."}
+  resume  {"id": "..."}
+  cancel  {"id": "..."}
+  move    {"id": "...", "to": "up" | "down" | "top" | "bottom" | position}
+  list
+  pause_all
+  resume_all
+
+For example:
+
+  echo '{"jsonrpc": "2.0", "id": 1, "method": "list"}' | nc -U ~/.config/surge/surge.sock
+
+Stop the daemon with 'surge server stop'.`,
+	Run: runServer,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	addServerFlags(daemonCmd)
+	daemonCmd.Flags().String("socket", "", "Path of the JSON-RPC control socket (default surge.sock in the cache directory)")
+}
+
+// defaultSocketPath returns where the daemon listens for JSON-RPC calls,
+// next to the port and pid files
+func defaultSocketPath() string {
+	return filepath.Join(config.GetCacheDir(), "surge.sock")
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// processStart is when this Surge process started, for reporting uptime
+var processStart = time.Now()
+
+// serveProfiling mounts /debug/pprof/ and /debug/vars on the API, set by --pprof
+var serveProfiling bool
+
+var diagCmd = &cobra.Command{
+	Use:   "diag",
+	Short: "Print diagnostics of the running Surge instance",
+	Long: `Print a snapshot of the running Surge instance for bug reports: runtime and
+memory statistics, the download queue and a dump of every goroutine.
+
+For CPU or heap profiles, start Surge with --pprof and use 'go tool pprof'
+against /debug/pprof/ on the API port.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Fprintln(os.Stderr, "Error: Surge is not running.")
+			os.Exit(1)
+		}
+		report, err := fetchDiag(port)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		out := io.Writer(os.Stdout)
+		if path, _ := cmd.Flags().GetString("output"); path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			out = f
+			defer fmt.Printf("Diagnostics written to %s\n", path)
+		}
+
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			enc.Encode(report)
+			return
+		}
+		writeDiagReport(out, report)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diagCmd)
+	diagCmd.Flags().StringP("output", "o", "", "Write the report to this file instead of stdout")
+	diagCmd.Flags().Bool("json", false, "Output in JSON format")
+
+	expvar.Publish("surge", expvar.Func(func() any { return collectDiag(false) }))
+}
+
+// diagReport is a snapshot of the process for bug reports
+type diagReport struct {
+	Version    string                 `json:"version"`
+	GoVersion  string                 `json:"go_version"`
+	Platform   string                 `json:"platform"`
+	PID        int                    `json:"pid"`
+	Uptime     float64                `json:"uptime_seconds"`
+	CPUs       int                    `json:"cpus"`
+	Goroutines int                    `json:"goroutines"`
+	Memory     diagMemory             `json:"memory"`
+	Queue      diagQueue              `json:"queue"`
+	Downloads  []types.DownloadStatus `json:"downloads"`
+	Stacks     string                 `json:"stacks,omitempty"` // Every goroutine's stack
+}
+
+type diagMemory struct {
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
+	Sys         uint64 `json:"sys"`
+	TotalAlloc  uint64 `json:"total_alloc"`
+	NumGC       uint32 `json:"num_gc"`
+	PauseTotal  uint64 `json:"gc_pause_total_ns"`
+}
+
+type diagQueue struct {
+	Active   int  `json:"active"`
+	Queued   int  `json:"queued"`
+	Limit    int  `json:"limit"`
+	Draining bool `json:"draining"`
+}
+
+// collectDiag snapshots this process, with goroutine stacks if asked
+func collectDiag(stacks bool) diagReport {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := diagReport{
+		Version:    Version,
+		GoVersion:  runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		PID:        os.Getpid(),
+		Uptime:     time.Since(processStart).Seconds(),
+		CPUs:       runtime.NumCPU(),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: diagMemory{
+			HeapAlloc:   mem.HeapAlloc,
+			HeapInuse:   mem.HeapInuse,
+			HeapObjects: mem.HeapObjects,
+			Sys:         mem.Sys,
+			TotalAlloc:  mem.TotalAlloc,
+			NumGC:       mem.NumGC,
+			PauseTotal:  mem.PauseTotalNs,
+		},
+		Downloads: activeDownloadStatuses(),
+	}
+	if GlobalPool != nil {
+		report.Queue = diagQueue{
+			Active:   GlobalPool.ActiveCount(),
+			Queued:   GlobalPool.QueueLength(),
+			Limit:    GlobalPool.QueueLimit(),
+			Draining: GlobalPool.Draining(),
+		}
+	}
+	if stacks {
+		var b strings.Builder
+		if p := rpprof.Lookup("goroutine"); p != nil {
+			p.WriteTo(&b, 2)
+		}
+		report.Stacks = b.String()
+	}
+	return report
+}
+
+// registerDiagHandlers adds /diag, and the profiling endpoints when
+// --pprof is set. Both expose every user's downloads, so server users
+// other than the admin are refused.
+func registerDiagHandlers(mux *http.ServeMux) {
+	mux.Handle("/diag", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(collectDiag(r.URL.Query().Get("stacks") == "1"))
+	})))
+
+	if !serveProfiling {
+		return
+	}
+	mux.Handle("/debug/pprof/", adminOnly(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", adminOnly(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", adminOnly(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", adminOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", adminOnly(http.HandlerFunc(pprof.Trace)))
+	mux.Handle("/debug/vars", adminOnly(expvar.Handler()))
+}
+
+// adminOnly refuses requests from users of a --users-file
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u := requestUser(r); u != nil && u.Name != "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fetchDiag asks the server at port for a diagnostics snapshot
+func fetchDiag(port int) (diagReport, error) {
+	var report diagReport
+	resp, err := serverRequest(http.MethodGet, port, "/diag?stacks=1", nil)
+	if err != nil {
+		return report, fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return report, fmt.Errorf("server error: %s - %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	return report, err
+}
+
+// writeDiagReport prints report for humans
+func writeDiagReport(w io.Writer, report diagReport) {
+	size := utils.ConvertBytesToHumanReadable
+	fmt.Fprintf(w, "Surge %s (%s, %s), pid %d, up %s\n", report.Version, report.GoVersion, report.Platform,
+		report.PID, (time.Duration(report.Uptime) * time.Second).Round(time.Second))
+	fmt.Fprintf(w, "CPUs: %d  Goroutines: %d\n\n", report.CPUs, report.Goroutines)
+
+	m := report.Memory
+	fmt.Fprintln(w, "Memory")
+	fmt.Fprintf(w, "  heap %s in use (%s allocated, %d objects), %s from the OS\n",
+		size(int64(m.HeapInuse)), size(int64(m.HeapAlloc)), m.HeapObjects, size(int64(m.Sys)))
+	fmt.Fprintf(w, "  %s allocated in total, %d GCs pausing %s\n\n",
+		size(int64(m.TotalAlloc)), m.NumGC, time.Duration(m.PauseTotal))
+
+	q := report.Queue
+	fmt.Fprintln(w, "Queue")
+	fmt.Fprintf(w, "  %d active, %d waiting (limit %d)", q.Active, q.Queued, q.Limit)
+	if q.Draining {
+		fmt.Fprint(w, ", draining")
+	}
+	fmt.Fprintln(w)
+	if len(report.Downloads) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  ID\tSTATUS\tPROGRESS\tSPEED\tURL")
+		for _, d := range report.Downloads {
+			fmt.Fprintf(tw, "  %s\t%s\t%s / %s\t%.1f MB/s\t%s\n", shortID(d.ID), d.Status,
+				size(d.Downloaded), size(d.TotalSize), d.Speed, d.URL)
+		}
+		tw.Flush()
+	}
+
+	if report.Stacks != "" {
+		fmt.Fprintf(w, "\nGoroutines\n%s", report.Stacks)
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestDiagEndpoint(t *testing.T) {
+	mux := newAPIMux(0, "")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/diag?stacks=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/diag: status %d", rec.Code)
+	}
+	var report diagReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Goroutines == 0 || report.GoVersion == "" || report.Memory.Sys == 0 {
+		t.Errorf("incomplete report: %+v", report)
+	}
+	if !strings.Contains(report.Stacks, "goroutine ") {
+		t.Error("stacks=1 should include goroutine stacks")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/diag", nil))
+	if strings.Contains(rec.Body.String(), `"stacks"`) {
+		t.Error("stacks should only be sent when asked for")
+	}
+
+	// Server users could read each other's downloads from it
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, withUser(httptest.NewRequest(http.MethodGet, "/diag", nil), &apiUser{Name: "alice"}))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("/diag as a user: status %d, want 403", rec.Code)
+	}
+}
+
+func TestProfilingEndpoints(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newAPIMux(0, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("pprof without --pprof: status %d, want 404", rec.Code)
+	}
+
+	serveProfiling = true
+	defer func() { serveProfiling = false }()
+	mux := newAPIMux(0, "")
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/vars"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d", path, rec.Code)
+		}
+	}
+	if !strings.Contains(rec.Body.String(), `"surge"`) {
+		t.Error("/debug/vars should publish the surge snapshot")
+	}
+}
+
+func TestWriteDiagReport(t *testing.T) {
+	var b strings.Builder
+	writeDiagReport(&b, diagReport{
+		Version:    "1.2.3",
+		GoVersion:  "go1.24",
+		Platform:   "linux/amd64",
+		Goroutines: 42,
+		Queue:      diagQueue{Active: 1, Queued: 2, Limit: 100, Draining: true},
+		Downloads: []types.DownloadStatus{
+			{ID: "abcdef123456", Status: "downloading", URL: "https://example.com/f.iso", Downloaded: 1024, TotalSize: 4096},
+		},
+		Stacks: "goroutine 1 [running]:\n",
+	})
+	got := b.String()
+	for _, want := range []string{"Surge 1.2.3 (go1.24, linux/amd64)", "Goroutines: 42", "1 active, 2 waiting (limit 100), draining", "https://example.com/f.iso", "goroutine 1 [running]"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report missing %q:\n%s", want, got)
+		}
+	}
+}
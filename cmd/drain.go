@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// drainRequest asks a running server to stop taking downloads and exit
+type drainRequest struct {
+	Timeout time.Duration // Pause downloads still running after this long; 0 waits for them
+	Pause   bool          // Pause running downloads right away
+}
+
+// drainRequests receives /drain calls. It is only set in server mode, as
+// the TUI has a user to decide when to quit.
+var drainRequests chan drainRequest
+
+// handleDrain starts draining the server. Named users may only manage their
+// own downloads, so it is reserved for the --token user.
+func handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if u := requestUser(r); u != nil && u.Name != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if drainRequests == nil {
+		http.Error(w, "Draining is only supported by surge server", http.StatusConflict)
+		return
+	}
+
+	var req drainRequest
+	if raw := r.URL.Query().Get("timeout"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout < 0 {
+			http.Error(w, "Invalid timeout: "+raw, http.StatusBadRequest)
+			return
+		}
+		req.Timeout = timeout
+	}
+	req.Pause = r.URL.Query().Get("pause") == "true"
+
+	// A drain already under way keeps its original settings
+	select {
+	case drainRequests <- req:
+	default:
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "draining"})
+}
+
+// drainPool drains GlobalPool as req asks. stop ends the wait early, pausing
+// whatever is still running.
+func drainPool(req drainRequest, stop <-chan os.Signal) {
+	if GlobalPool == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if req.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, req.Timeout)
+		defer cancelTimeout()
+	}
+	if req.Pause {
+		cancel()
+	}
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	GlobalPool.Drain(ctx)
+}
+
+var serverDrainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Stop taking new downloads, finish or pause running ones and exit",
+	Long: `Drain the running server before a reboot or redeploy. The server stops
+accepting downloads and saves queued ones for its next start. It waits for
+running downloads to finish, pausing any left after --timeout, then exits.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		port := readActivePort()
+		if port == 0 {
+			fmt.Fprintln(os.Stderr, "Error: Surge server is not running.")
+			os.Exit(1)
+		}
+
+		query := url.Values{}
+		if timeout, _ := cmd.Flags().GetDuration("timeout"); timeout > 0 {
+			query.Set("timeout", timeout.String())
+		}
+		if pause, _ := cmd.Flags().GetBool("pause"); pause {
+			query.Set("pause", "true")
+		}
+		resp, err := serverRequest(http.MethodPost, port, "/drain?"+query.Encode(), nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to connect to server: %v\n", err)
+			os.Exit(1)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			fmt.Fprintf(os.Stderr, "Error: server error: %s - %s\n", resp.Status, body)
+			os.Exit(1)
+		}
+
+		fmt.Println("Draining server...")
+		if noWait, _ := cmd.Flags().GetBool("no-wait"); noWait {
+			return
+		}
+		for {
+			time.Sleep(500 * time.Millisecond)
+			resp, err := serverRequest(http.MethodGet, port, "/health", nil)
+			if err != nil {
+				break
+			}
+			resp.Body.Close()
+		}
+		fmt.Println("Server stopped.")
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(serverDrainCmd)
+	serverDrainCmd.Flags().Duration("timeout", 0, "Pause downloads still running after this long (default: wait for them)")
+	serverDrainCmd.Flags().Bool("pause", false, "Pause running downloads right away")
+	serverDrainCmd.Flags().Bool("no-wait", false, "Return without waiting for the server to exit")
+}
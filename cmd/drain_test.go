@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestHandleDrain(t *testing.T) {
+	oldRequests := drainRequests
+	defer func() { drainRequests = oldRequests }()
+
+	post := func(target string, user *apiUser) int {
+		req := withUser(httptest.NewRequest(http.MethodPost, target, nil), user)
+		rec := httptest.NewRecorder()
+		handleDrain(rec, req)
+		return rec.Code
+	}
+
+	drainRequests = nil
+	if code := post("/drain", nil); code != http.StatusConflict {
+		t.Errorf("without server mode: got %d, want 409", code)
+	}
+
+	drainRequests = make(chan drainRequest, 1)
+	if code := post("/drain", &apiUser{Name: "alice", Token: "a"}); code != http.StatusForbidden {
+		t.Errorf("named user: got %d, want 403", code)
+	}
+	if code := post("/drain?timeout=soon", nil); code != http.StatusBadRequest {
+		t.Errorf("bad timeout: got %d, want 400", code)
+	}
+	if code := post("/drain?timeout=90s&pause=true", &apiUser{Token: "admin"}); code != http.StatusAccepted {
+		t.Fatalf("admin drain: got %d, want 202", code)
+	}
+	select {
+	case req := <-drainRequests:
+		if req.Timeout != 90*time.Second || !req.Pause {
+			t.Errorf("drain request = %+v", req)
+		}
+	default:
+		t.Fatal("drain request was not delivered")
+	}
+}
+
+func TestDrain_QueuedDownloadsSurviveRestart(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Downloads stay running while the origin holds their data requests open.
+	// Probes are answered so running downloads can be paused.
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-0" {
+			w.Header().Set("Content-Range", "bytes 0-0/1048576")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte{0})
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer origin.Close()
+	defer close(release)
+	shelvedURL := origin.URL + "/shelved.bin"
+
+	oldPool, oldCh := GlobalPool, GlobalProgressCh
+	progressCh := make(chan any, 100)
+	GlobalProgressCh = progressCh
+	stop := discardProgress(progressCh)
+	defer func() {
+		stop()
+		GlobalPool, GlobalProgressCh = oldPool, oldCh
+	}()
+
+	// With its only worker busy, the second download waits in the queue
+	GlobalPool = download.NewWorkerPool(progressCh, 1)
+	busy := types.NewProgressState("busy", 0)
+	GlobalPool.Add(types.DownloadConfig{ID: "busy", URL: origin.URL + "/busy.bin", OutputPath: tempDir, State: busy})
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, total, _, _, _, _ := busy.GetProgress(); total > 0 {
+			break // Probed, so pausing takes effect right away
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	GlobalPool.Add(types.DownloadConfig{ID: "shelved", URL: shelvedURL, OutputPath: tempDir})
+
+	// A pool that is draining refuses new downloads and saves queued ones
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	GlobalPool.Drain(ctx)
+
+	rec := httptest.NewRecorder()
+	handleDownload(rec, httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(`{"url": "`+origin.URL+`/new.bin"}`)), tempDir)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("download while draining: got %d, want 503", rec.Code)
+	}
+
+	// The next server picks the saved download up as a new one
+	GlobalPool = download.NewWorkerPool(progressCh, 1)
+	resumePausedDownloads()
+	if !GlobalPool.HasDownload(shelvedURL) {
+		t.Fatal("queued download was not restored after the drain")
+	}
+	for _, cfg := range GlobalPool.GetAll() {
+		if cfg.ID == "shelved" && (cfg.IsResume || cfg.OutputPath != tempDir) {
+			t.Errorf("restored config = IsResume %v, OutputPath %q; want a fresh download into %s", cfg.IsResume, cfg.OutputPath, tempDir)
+		}
+	}
+	for _, cfg := range GlobalPool.GetAll() {
+		GlobalPool.Cancel(cfg.ID)
+	}
+}
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Limits for fetching the page links are extracted from
+const (
+	extractTimeout  = 30 * time.Second
+	maxExtractBytes = 10 << 20
+)
+
+var (
+	// tagPattern matches an opening HTML tag with its attributes
+	tagPattern = regexp.MustCompile(`(?is)<([a-z][a-z0-9]*)\b([^>]*)>`)
+	// linkAttrPattern matches href and src attributes, quoted or not
+	linkAttrPattern = regexp.MustCompile(`(?is)(?:^|\s)(href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	// commentPattern matches HTML comments, whose links are not on the page
+	commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract <page-url>",
+	Short: "List or download the links on a web page",
+	Long: `Fetch a web page and extract the links in its href and src attributes.
+
+Links are printed one per line, ready for 'surge add --batch'. With --add
+they are queued on the running Surge instance instead. --pattern filters
+links by file name, e.g. --pattern "*.pdf".
+
+With --recursive the pages linked from the page are walked too, up to
+--depth levels, staying on the page's host under its directory. Links that
+look like files are collected from every page. The walk is polite by
+default: it honours robots.txt (including Crawl-delay), waits --delay
+between requests to one host, and stops at --max-files links. --max-size
+caps the total size of the files, checked with HEAD requests.
+
+--accept-type and --reject-type keep or skip links by the media type their
+server reports, e.g. --accept-type video/*,application/pdf. The type is asked
+for with a HEAD request (or taken from the response the walk already got), so
+nothing unwanted is downloaded; links whose server does not say are kept.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		patterns, _ := cmd.Flags().GetStringSlice("pattern")
+		add, _ := cmd.Flags().GetBool("add")
+		output, _ := cmd.Flags().GetString("output")
+
+		var port int
+		if add {
+			if port = readActivePort(); port == 0 {
+				fmt.Println("Error: Surge is not running.")
+				fmt.Println("Start it with 'surge' or 'surge server start', or omit --add to print the links.")
+				os.Exit(1)
+			}
+		}
+
+		var links []string
+		mediaTypes, err := typeFilterFlags(cmd)
+		if err == nil {
+			if recursive, _ := cmd.Flags().GetBool("recursive"); recursive {
+				var opts crawlOptions
+				if opts, err = crawlOptionsFromFlags(cmd, patterns); err == nil {
+					opts.Types = mediaTypes
+					links, err = crawl(args[0], opts)
+				}
+			} else if links, err = fetchLinks(args[0], patterns); err == nil && mediaTypes.active() {
+				links = filterByType(links, func(link string) string { return link }, mediaTypes)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(links) == 0 {
+			fmt.Fprintln(os.Stderr, "No matching links found.")
+			os.Exit(1)
+		}
+
+		if !add {
+			for _, link := range links {
+				fmt.Println(link)
+			}
+			return
+		}
+
+		addLinks(links, output, port)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(extractCmd)
+	extractCmd.Flags().StringSliceP("pattern", "p", nil, `Only keep links whose file name matches this glob, e.g. "*.mp4" (repeatable)`)
+	extractCmd.Flags().BoolP("add", "a", false, "Add the links to the running Surge instance instead of printing them")
+	extractCmd.Flags().StringP("output", "o", "", "Output directory for added downloads")
+	extractCmd.Flags().BoolP("recursive", "r", false, "Follow links to other pages under the page's directory")
+	extractCmd.Flags().Int("depth", defaultCrawlDepth, "With --recursive, levels of pages to follow below the page")
+	extractCmd.Flags().Duration("delay", defaultCrawlDelay, "With --recursive, minimum time between requests to one host")
+	extractCmd.Flags().Int("parallel", defaultCrawlParallel, "With --recursive, requests in flight at once across hosts")
+	extractCmd.Flags().Bool("ignore-robots", false, "With --recursive, do not honour robots.txt")
+	extractCmd.Flags().Int("max-files", defaultCrawlMaxFiles, "With --recursive, stop after this many links (0 for no limit)")
+	extractCmd.Flags().String("max-size", "", `With --recursive, cap the total size of the links, e.g. "10GB"`)
+	addTypeFilterFlags(extractCmd, "links")
+}
+
+// crawlOptionsFromFlags reads the --recursive options of the extract command
+func crawlOptionsFromFlags(cmd *cobra.Command, patterns []string) (crawlOptions, error) {
+	opts := crawlOptions{Patterns: patterns}
+	opts.Depth, _ = cmd.Flags().GetInt("depth")
+	opts.Delay, _ = cmd.Flags().GetDuration("delay")
+	opts.Parallel, _ = cmd.Flags().GetInt("parallel")
+	opts.IgnoreRobots, _ = cmd.Flags().GetBool("ignore-robots")
+	opts.MaxFiles, _ = cmd.Flags().GetInt("max-files")
+	if opts.Depth < 0 || opts.Delay < 0 || opts.Parallel < 1 || opts.MaxFiles < 0 {
+		return opts, fmt.Errorf("--depth, --delay and --max-files must not be negative and --parallel must be at least 1")
+	}
+	if maxSize, _ := cmd.Flags().GetString("max-size"); maxSize != "" {
+		size, err := utils.ParseByteSize(maxSize)
+		if err != nil {
+			return opts, fmt.Errorf("--max-size: %w", err)
+		}
+		opts.MaxSize = size
+	}
+	return opts, nil
+}
+
+// fetchLinks downloads the page at pageURL under the configured URL and
+// network policy and returns its links matching patterns
+func fetchLinks(pageURL string, patterns []string) ([]string, error) {
+	final, body, err := fetchPage(pageURL, maxExtractBytes)
+	if err != nil {
+		return nil, err
+	}
+	// Relative links are relative to where redirects ended up
+	return extractLinks(final, string(body), patterns), nil
+}
+
+// fetchPage downloads up to limit bytes of pageURL under the configured URL
+// and network policy. It returns the URL redirects ended up at and the body.
+func fetchPage(pageURL string, limit int64) (*url.URL, []byte, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, nil, fmt.Errorf("invalid page URL %q", pageURL)
+	}
+	pc := newPageClient()
+	resp, err := pc.do(http.MethodGet, pageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", pageURL, err)
+	}
+	return resp.Request.URL, body, nil
+}
+
+// pageClient fetches pages under the configured URL and network policy
+type pageClient struct {
+	settings *config.Settings
+	runtime  *types.RuntimeConfig
+	client   *http.Client
+}
+
+func newPageClient() *pageClient {
+	settings, err := config.LoadSettings()
+	if err != nil {
+		settings = config.DefaultSettings()
+	}
+	runtime := convertRuntimeConfig(settings.ToRuntimeConfig())
+	return &pageClient{
+		settings: settings,
+		runtime:  runtime,
+		client: &http.Client{
+			Timeout: extractTimeout,
+			// Pages count toward the per-host cap of downloads running alongside
+			Transport: runtime.LimitHosts(&http.Transport{
+				Proxy: runtime.ProxyFunc(),
+				DialContext: (&net.Dialer{
+					Timeout: types.DialTimeout,
+					Control: runtime.DialControl,
+				}).DialContext,
+			}),
+			CheckRedirect: runtime.CheckRedirect,
+		},
+	}
+}
+
+// do makes a method request for pageURL. Only 200 OK answers are returned;
+// the caller closes their body.
+func (pc *pageClient) do(method, pageURL string) (*http.Response, error) {
+	if err := pc.settings.CheckURL(pageURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", pc.runtime.GetUserAgent())
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", pageURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", pageURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// addLinks queues links on the server at port and reports how many were added
+func addLinks(links []string, output string, port int) {
+	// Links are sent one by one: a comma in a link is not a mirror list
+	count := 0
+	for _, link := range links {
+		if err := sendToServer(link, nil, output, port); err != nil {
+			fmt.Printf("Error adding %s: %v\n", link, err)
+			continue
+		}
+		count++
+	}
+	fmt.Printf("Successfully added %d of %d downloads.\n", count, len(links))
+}
+
+// extractLinks returns the http and https links in the href and src
+// attributes of page, resolved against base (or the page's <base href>),
+// without duplicates and in page order. With patterns, only links whose
+// file name matches one of the globs are kept; matching ignores case.
+func extractLinks(base *url.URL, page string, patterns []string) []string {
+	page = commentPattern.ReplaceAllString(page, "")
+
+	seen := make(map[string]bool)
+	var links []string
+	for _, tag := range tagPattern.FindAllStringSubmatch(page, -1) {
+		name := strings.ToLower(tag[1])
+		for _, attr := range linkAttrPattern.FindAllStringSubmatch(tag[2], -1) {
+			value := strings.TrimSpace(html.UnescapeString(attr[2] + attr[3] + attr[4]))
+			ref, err := url.Parse(value)
+			if err != nil {
+				continue
+			}
+			link := base.ResolveReference(ref)
+			if name == "base" {
+				base = link // Links after <base href> are relative to it
+				continue
+			}
+			if link.Scheme != "http" && link.Scheme != "https" {
+				continue // mailto:, javascript:, data: and the like
+			}
+			link.Fragment = ""
+			s := link.String()
+			if seen[s] || !matchesFilePattern(link, patterns) {
+				continue
+			}
+			seen[s] = true
+			links = append(links, s)
+		}
+	}
+	return links
+}
+
+// matchesFilePattern reports whether the last path segment of link matches
+// any of patterns, or whether there are no patterns
+func matchesFilePattern(link *url.URL, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	name := strings.ToLower(path.Base(link.Path))
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/index.html")
+	page := `<html><head><link rel="stylesheet" href="/style.css"></head><body>
+<a href="guide.pdf">Guide</a>
+<A HREF='/files/Manual.PDF#page=2'>Manual</A>
+<a href=https://cdn.example.com/v/talk.mp4>Talk</a>
+<a href="guide.pdf">Guide again</a>
+<a href="mailto:docs@example.com">Mail</a>
+<img src="logo.png" alt="a > b">
+<!-- <a href="draft.pdf">Draft</a> -->
+<a href="report.pdf?v=1&amp;lang=en">Report</a>
+</body></html>`
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"all links", nil, []string{
+			"https://example.com/style.css",
+			"https://example.com/docs/guide.pdf",
+			"https://example.com/files/Manual.PDF",
+			"https://cdn.example.com/v/talk.mp4",
+			"https://example.com/docs/logo.png",
+			"https://example.com/docs/report.pdf?v=1&lang=en",
+		}},
+		{"pdfs", []string{"*.pdf"}, []string{
+			"https://example.com/docs/guide.pdf",
+			"https://example.com/files/Manual.PDF",
+			"https://example.com/docs/report.pdf?v=1&lang=en",
+		}},
+		{"several patterns", []string{"*.mp4", "*.png"}, []string{
+			"https://cdn.example.com/v/talk.mp4",
+			"https://example.com/docs/logo.png",
+		}},
+		{"no match", []string{"*.iso"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractLinks(base, page, tt.patterns); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractLinks() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+
+	// <base href> changes what later relative links resolve against
+	got := extractLinks(base, `<base href="https://mirror.example.org/pub/"><a href="a.zip">A</a>`, nil)
+	if want := []string{"https://mirror.example.org/pub/a.zip"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("extractLinks() with <base> = %v, want %v", got, want)
+	}
+}
+
+func TestFetchLinks(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/papers/", http.StatusFound)
+	})
+	mux.HandleFunc("/papers/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="one.pdf">1</a> <a href="../two.pdf">2</a> <a href="notes.txt">n</a>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Relative links follow the redirect
+	links, err := fetchLinks(server.URL+"/old", []string{"*.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/papers/one.pdf", server.URL + "/two.pdf"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("fetchLinks() = %v, want %v", links, want)
+	}
+
+	if _, err := fetchLinks(server.URL+"/missing", nil); err == nil {
+		t.Error("fetchLinks() of a missing page should fail")
+	}
+	if _, err := fetchLinks("ftp://example.com/", nil); err == nil {
+		t.Error("fetchLinks() should refuse non-HTTP pages")
+	}
+}
@@ -25,7 +25,7 @@ func TestCLI_NewEndpoints(t *testing.T) {
 	port := ln.Addr().(*net.TCPAddr).Port
 
 	// Start server in background
-	go startHTTPServer(ln, port, "")
+	go startHTTPServer(ln, port, "", nil)
 	time.Sleep(50 * time.Millisecond)
 
 	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
@@ -49,7 +49,7 @@ func TestAcquireLock(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify file exists
-	lockPath := filepath.Join(config.GetSurgeDir(), "surge.lock")
+	lockPath := filepath.Join(config.GetCacheDir(), "surge.lock")
 	_, err = os.Stat(lockPath)
 	assert.NoError(t, err, "Lock file should exist")
 }
@@ -54,6 +54,8 @@ type downloadInfo struct {
 	TotalSize  int64   `json:"total_size"`
 	Downloaded int64   `json:"downloaded"`
 	Speed      float64 `json:"speed,omitempty"`
+
+	Engine *types.EngineStats `json:"engine,omitempty"`
 }
 
 func printDownloads(jsonOutput bool) {
@@ -73,6 +75,7 @@ func printDownloads(jsonOutput bool) {
 					TotalSize:  s.TotalSize,
 					Downloaded: s.Downloaded,
 					Speed:      s.Speed,
+					Engine:     s.Engine,
 				})
 			}
 		}
@@ -135,10 +138,7 @@ func printDownloads(jsonOutput bool) {
 		}
 
 		// Truncate ID for display
-		id := d.ID
-		if len(id) > 8 {
-			id = id[:8]
-		}
+		id := shortID(d.ID)
 
 		// Truncate filename
 		filename := d.Filename
@@ -178,7 +178,7 @@ func showDownloadDetails(partialID string, jsonOutput bool) {
 	// Try to get from running server first
 	port := readActivePort()
 	if port > 0 {
-		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/download?id=%s", port, fullID))
+		resp, err := serverRequest(http.MethodGet, port, "/download?id="+fullID, nil)
 		if err == nil {
 			defer resp.Body.Close()
 			if resp.StatusCode == http.StatusOK {
@@ -247,6 +247,13 @@ func printDownloadDetail(d types.DownloadStatus, jsonOutput bool) {
 	if d.Error != "" {
 		fmt.Printf("Error:      %s\n", d.Error)
 	}
+	if e := d.Engine; e != nil {
+		fmt.Printf("Engine:     %d connections, %d steals, %d splits, %d reassigned, %d retries\n",
+			e.Connections, e.Steals, e.Splits, e.Reassignments, e.Retries)
+		for _, t := range e.Tasks {
+			fmt.Printf("  worker %-3d at %s, %s left, %s/s\n", t.Worker, formatSize(t.Offset), formatSize(t.Remaining), formatSize(int64(t.Speed)))
+		}
+	}
 }
 
 func init() {
@@ -54,7 +54,7 @@ func TestMirrors_CLI_Integration(t *testing.T) {
 	arg := fmt.Sprintf("%s,%s,%s", primaryURL, mirror1, mirror2)
 
 	// Simulate "surge add <arg>"
-	processDownloads([]string{arg}, ".", port)
+	processDownloads([]string{arg}, ".", downloadOptions{}, port)
 
 	// 3. Verify the server received the correct request
 	select {
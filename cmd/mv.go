@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+)
+
+// errNotCompleted is returned when moving the file of a download that has
+// not completed yet
+var errNotCompleted = errors.New("download has not completed")
+
+var mvCmd = &cobra.Command{
+	Use:     "mv <ID> <directory>",
+	Aliases: []string{"move"},
+	Short:   "Move the file of a completed download to another directory",
+	Long: `Move the file of a completed download to another directory and remember
+its new path. Within a filesystem the file is renamed. Across filesystems it
+is copied, checked against the original and only then deleted.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		id, err := resolveDownloadID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		dir, err := filepath.Abs(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		port := readActivePort()
+		if port == 0 {
+			dest, err := moveCompletedFile(id, dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Moved download %s to %s\n", shortID(id), dest)
+			return
+		}
+
+		query := url.Values{"id": {id}, "dir": {dir}}
+		resp, err := serverRequest(http.MethodPost, port, "/move-file?"+query.Encode(), nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+			os.Exit(1)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "Error: server returned %s - %s\n", resp.Status, body)
+			os.Exit(1)
+		}
+		var moved struct {
+			Path string `json:"path"`
+		}
+		json.Unmarshal(body, &moved)
+		fmt.Printf("Moved download %s to %s\n", shortID(id), moved.Path)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mvCmd)
+}
+
+// moveCompletedFile moves the file of completed download id into dir, see
+// download.MoveFile, and returns its new path
+func moveCompletedFile(id, dir string) (string, error) {
+	entry, err := state.GetDownload(id)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", fmt.Errorf("download not found: %s", id)
+	}
+	if entry.Status != "completed" || entry.DestPath == "" {
+		return "", fmt.Errorf("%w: %s", errNotCompleted, shortID(id))
+	}
+	return download.MoveFile(id, entry.DestPath, dir)
+}
+
+// handleMoveFile moves the file of a completed download into the directory
+// of the dir parameter
+func handleMoveFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, dir := r.URL.Query().Get("id"), r.URL.Query().Get("dir")
+	if id == "" || dir == "" {
+		http.Error(w, "Missing id or dir parameter", http.StatusBadRequest)
+		return
+	}
+	if !canAccess(r, id) {
+		http.Error(w, "Download not found", http.StatusNotFound)
+		return
+	}
+	if !mayControlMachine(r) {
+		http.Error(w, "Forbidden: moving files is reserved for the server's own clients", http.StatusForbidden)
+		return
+	}
+
+	dest, err := moveCompletedFile(id, dir)
+	if errors.Is(err, errNotCompleted) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if GlobalProgressCh != nil {
+		GlobalProgressCh <- events.DownloadMovedMsg{DownloadID: id, Filename: filepath.Base(dest), DestPath: dest}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "moved", "id": id, "path": dest})
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -12,8 +13,11 @@ import (
 var pauseCmd = &cobra.Command{
 	Use:   "pause <ID>",
 	Short: "Pause a download",
-	Long:  `Pause a download by its ID. Use --all to pause all downloads.`,
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Pause a download by its ID. Use --all to pause all downloads.
+
+With a running Surge, --all also keeps queued and new downloads from starting
+until 'surge resume --all' or until any download is resumed.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initializeGlobalState()
 
@@ -29,8 +33,18 @@ var pauseCmd = &cobra.Command{
 		if all {
 			// Pause all downloads
 			if port > 0 {
-				// TODO: Implement /pause-all endpoint or iterate
-				fmt.Println("Pausing all downloads is not yet implemented for running server.")
+				resp, err := serverRequest(http.MethodPost, port, "/pause-all", nil)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+					os.Exit(1)
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusOK {
+					fmt.Fprintf(os.Stderr, "Error: server returned %s\n", resp.Status)
+					os.Exit(1)
+				}
+				fmt.Println("All downloads paused. Run 'surge resume --all' to continue.")
 			} else {
 				// Offline mode: update DB directly
 				if err := state.PauseAllDownloads(); err != nil {
@@ -53,7 +67,7 @@ var pauseCmd = &cobra.Command{
 
 		if port > 0 {
 			// Send to running server
-			resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/pause?id=%s", port, id), "application/json", nil)
+			resp, err := serverRequest(http.MethodPost, port, "/pause?id="+id, nil)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 				os.Exit(1)
@@ -64,14 +78,14 @@ var pauseCmd = &cobra.Command{
 				fmt.Fprintf(os.Stderr, "Error: server returned %s\n", resp.Status)
 				os.Exit(1)
 			}
-			fmt.Printf("Paused download %s\n", id[:8])
+			fmt.Printf("Paused download %s\n", shortID(id))
 		} else {
 			// Offline mode: update DB directly
 			if err := state.UpdateStatus(id, "paused"); err != nil {
 				fmt.Fprintf(os.Stderr, "Error pausing download: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Paused download %s (offline mode)\n", id[:8])
+			fmt.Printf("Paused download %s (offline mode)\n", shortID(id))
 		}
 	},
 }
@@ -80,3 +94,24 @@ func init() {
 	rootCmd.AddCommand(pauseCmd)
 	pauseCmd.Flags().Bool("all", false, "Pause all downloads")
 }
+
+// handlePauseAll pauses every download of the running pool and holds the
+// queue until a resume. Named users may only manage their own downloads, so
+// it is reserved for the --token user.
+func handlePauseAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if u := requestUser(r); u != nil && u.Name != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if GlobalPool == nil {
+		http.Error(w, "Server internal error: pool not initialized", http.StatusInternalServerError)
+		return
+	}
+	GlobalPool.HoldAll()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "paused"})
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// defaultProgressInterval is how often the headless status line is redrawn
+const defaultProgressInterval = 250 * time.Millisecond
+
+// statusLine prints headless output with an optional progress line kept at
+// the bottom. The line is redrawn on a timer rather than on download activity,
+// so terminal output costs the same at any download speed.
+type statusLine struct {
+	mu    sync.Mutex
+	out   io.Writer
+	shown bool // A progress line is on screen and must be cleared first
+}
+
+// Printf prints a regular message above the progress line
+func (s *statusLine) Printf(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLocked()
+	fmt.Fprintf(s.out, format, args...)
+}
+
+// Update replaces the progress line; an empty line removes it
+func (s *statusLine) Update(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLocked()
+	if line != "" {
+		fmt.Fprint(s.out, line)
+		s.shown = true
+	}
+}
+
+func (s *statusLine) clearLocked() {
+	if s.shown {
+		fmt.Fprint(s.out, "\r\033[K")
+		s.shown = false
+	}
+}
+
+// Run redraws the progress line from statuses every interval until stop closes
+func (s *statusLine) Run(interval time.Duration, statuses func() []types.DownloadStatus, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			s.Update("")
+			return
+		case <-ticker.C:
+			s.Update(formatProgressLine(statuses()))
+		}
+	}
+}
+
+// formatProgressLine summarises the running downloads on one line, or returns
+// "" when nothing is downloading
+func formatProgressLine(statuses []types.DownloadStatus) string {
+	var active int
+	var downloaded, total int64
+	var speed float64 // MB/s
+	for _, s := range statuses {
+		if s.Status != "downloading" {
+			continue
+		}
+		active++
+		downloaded += s.Downloaded
+		total += s.TotalSize
+		speed += s.Speed
+	}
+	if active == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%d active] %s", active, utils.ConvertBytesToHumanReadable(downloaded))
+	if total > 0 {
+		fmt.Fprintf(&b, " / %s (%.1f%%)", utils.ConvertBytesToHumanReadable(total), float64(downloaded)*100/float64(total))
+	}
+	fmt.Fprintf(&b, " at %.1f MB/s", speed)
+	return b.String()
+}
+
+// showAccelerationReport prints a per-connection breakdown after each
+// completed download, set by --report
+var showAccelerationReport bool
+
+// formatAccelerationReport breaks a completed download down by connection
+// and compares it with an estimate for one connection, or returns "" when
+// the engine recorded no connections
+func formatAccelerationReport(m events.DownloadCompleteMsg) string {
+	if m.State == nil {
+		return ""
+	}
+	connections := m.State.ConnectionStats()
+	if len(connections) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "  %-6s %10s %14s %8s %8s\n", "Conn", "Bytes", "Avg speed", "Retries", "TTFB")
+	for _, c := range connections {
+		fmt.Fprintf(&b, "  #%-5d %10s %9.2f MB/s %8d %8s\n", c.Worker,
+			utils.ConvertBytesToHumanReadable(c.Bytes), c.Speed()/float64(types.MB), c.Retries, c.AverageTTFB().Round(time.Millisecond))
+	}
+
+	estimate := types.SingleConnectionEstimate(connections, m.Total)
+	if estimate <= 0 || m.Elapsed <= 0 {
+		return b.String()
+	}
+	speedup := estimate.Seconds() / m.Elapsed.Seconds()
+	fmt.Fprintf(&b, "  One connection: ~%s, actual %s with %d (%.1fx)", estimate.Round(100*time.Millisecond), m.Elapsed.Round(100*time.Millisecond), len(connections), speedup)
+	if speedup < 1.1 {
+		b.WriteString(": more connections did not help for this host")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// progressEvent is one line of the JSON-lines stream written to --progress-fd
+type progressEvent struct {
+	Event      string  `json:"event"` // started, progress, verified, renamed, completed, error, warning, queued, scheduled, paused, resumed, removed, moved
+	Time       int64   `json:"time"`  // Unix milliseconds
+	ID         string  `json:"id"`
+	Filename   string  `json:"filename,omitempty"`
+	URL        string  `json:"url,omitempty"`
+	Path       string  `json:"path,omitempty"`
+	Downloaded int64   `json:"downloaded,omitempty"`
+	Total      int64   `json:"total,omitempty"`
+	Speed      float64 `json:"speed,omitempty"` // Bytes per second
+	ElapsedMs  int64   `json:"elapsed_ms,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Message    string  `json:"message,omitempty"`  // Of a warning
+	StartAt    int64   `json:"start_at,omitempty"` // Unix milliseconds a scheduled download starts at
+	Checksum   string  `json:"checksum,omitempty"` // "type:hex" a verified download matched
+	Signer     string  `json:"signer,omitempty"`   // Key that signed a verified download
+}
+
+// eventFromMsg converts a download lifecycle message to its JSON event
+func eventFromMsg(msg any) (progressEvent, bool) {
+	switch m := msg.(type) {
+	case events.DownloadStartedMsg:
+		return progressEvent{Event: "started", ID: m.DownloadID, Filename: m.Filename, URL: m.URL, Path: m.DestPath, Total: m.Total}, true
+	case events.DownloadCompleteMsg:
+		return progressEvent{Event: "completed", ID: m.DownloadID, Filename: m.Filename, Downloaded: m.Total, Total: m.Total, ElapsedMs: m.Elapsed.Milliseconds()}, true
+	case events.ChecksumVerifiedMsg:
+		return progressEvent{Event: "verified", ID: m.DownloadID, Filename: m.Filename, Checksum: m.Checksum}, true
+	case events.SignatureVerifiedMsg:
+		return progressEvent{Event: "verified", ID: m.DownloadID, Filename: m.Filename, Signer: m.Signer}, true
+	case events.ExtensionFixedMsg:
+		return progressEvent{Event: "renamed", ID: m.DownloadID, Filename: m.Filename, Path: m.DestPath}, true
+	case events.DownloadErrorMsg:
+		ev := progressEvent{Event: "error", ID: m.DownloadID, Filename: m.Filename}
+		if m.Err != nil {
+			ev.Error = m.Err.Error()
+		}
+		return ev, true
+	case events.DownloadWarningMsg:
+		return progressEvent{Event: "warning", ID: m.DownloadID, Filename: m.Filename, Message: m.Message}, true
+	case events.DownloadQueuedMsg:
+		return progressEvent{Event: "queued", ID: m.DownloadID, Filename: m.Filename}, true
+	case events.DownloadScheduledMsg:
+		return progressEvent{Event: "scheduled", ID: m.DownloadID, Filename: m.Filename, StartAt: m.StartAt.UnixMilli()}, true
+	case events.DownloadPausedMsg:
+		return progressEvent{Event: "paused", ID: m.DownloadID, Filename: m.Filename, Downloaded: m.Downloaded}, true
+	case events.DownloadResumedMsg:
+		return progressEvent{Event: "resumed", ID: m.DownloadID, Filename: m.Filename}, true
+	case events.DownloadRemovedMsg:
+		return progressEvent{Event: "removed", ID: m.DownloadID, Filename: m.Filename}, true
+	case events.DownloadMovedMsg:
+		return progressEvent{Event: "moved", ID: m.DownloadID, Filename: m.Filename, Path: m.DestPath}, true
+	}
+	return progressEvent{}, false
+}
+
+// eventStream writes progress events as JSON lines, one object per line
+type eventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w)}
+}
+
+// Emit writes ev, stamping it with the current time if it has none
+func (s *eventStream) Emit(ev progressEvent) {
+	if ev.Time == 0 {
+		ev.Time = time.Now().UnixMilli()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(ev); err != nil {
+		utils.Debug("Failed to write progress event: %v", err)
+	}
+}
+
+// Run emits a "progress" event for every running download each interval
+// until stop closes
+func (s *eventStream) Run(interval time.Duration, statuses func() []types.DownloadStatus, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, st := range statuses() {
+				if st.Status != "downloading" {
+					continue
+				}
+				s.Emit(progressEvent{
+					Event:      "progress",
+					ID:         st.ID,
+					Filename:   st.Filename,
+					Downloaded: st.Downloaded,
+					Total:      st.TotalSize,
+					Speed:      st.Speed * 1024 * 1024, // Status speed is in MB/s
+				})
+			}
+		}
+	}
+}
+
+// openProgressFD wraps a file descriptor inherited from the caller
+func openProgressFD(fd int) (*os.File, error) {
+	f := os.NewFile(uintptr(fd), "progress-fd")
+	if f == nil {
+		return nil, fmt.Errorf("invalid --progress-fd %d", fd)
+	}
+	if _, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("invalid --progress-fd %d: %w", fd, err)
+	}
+	return f, nil
+}
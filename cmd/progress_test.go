@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestFormatProgressLine(t *testing.T) {
+	if got := formatProgressLine(nil); got != "" {
+		t.Errorf("expected empty line with no downloads, got %q", got)
+	}
+
+	statuses := []types.DownloadStatus{
+		{Status: "downloading", Downloaded: 25 * types.MB, TotalSize: 100 * types.MB, Speed: 2.5},
+		{Status: "downloading", Downloaded: 25 * types.MB, TotalSize: 100 * types.MB, Speed: 1.0},
+		{Status: "paused", Downloaded: 50 * types.MB, TotalSize: 100 * types.MB},
+	}
+	want := "[2 active] 50.0 MB / 200.0 MB (25.0%) at 3.5 MB/s"
+	if got := formatProgressLine(statuses); got != want {
+		t.Errorf("formatProgressLine = %q, want %q", got, want)
+	}
+}
+
+func TestStatusLine_ClearsBeforeMessages(t *testing.T) {
+	var buf bytes.Buffer
+	s := &statusLine{out: &buf}
+
+	s.Printf("Started: a\n")
+	s.Update("[1 active]")
+	s.Update("[1 active] more")
+	s.Printf("Completed: a\n")
+	s.Update("")
+
+	want := "Started: a\n" +
+		"[1 active]" +
+		"\r\033[K[1 active] more" +
+		"\r\033[KCompleted: a\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestFormatAccelerationReport(t *testing.T) {
+	empty := events.DownloadCompleteMsg{State: types.NewProgressState("empty", 0)}
+	if got := formatAccelerationReport(empty); got != "" {
+		t.Errorf("report without connections = %q, want empty", got)
+	}
+
+	state := types.NewProgressState("report", 200*types.MB)
+	state.RecordRequest(0, 100*types.MB, 10*time.Second, 50*time.Millisecond, false)
+	state.RecordRequest(1, 20*types.MB, 2*time.Second, 100*time.Millisecond, false)
+	state.RecordRequest(1, 0, 0, 0, true)
+	state.RecordRequest(1, 80*types.MB, 8*time.Second, 100*time.Millisecond, true)
+	msg := events.DownloadCompleteMsg{Total: 200 * types.MB, Elapsed: 10 * time.Second, State: state}
+	report := formatAccelerationReport(msg)
+	for _, want := range []string{"#0", "#1", "100.0 MB", "10.00 MB/s", "100ms", "~20.1s", "(2.0x)"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "did not help") {
+		t.Errorf("a 2x speedup should not be called unhelpful:\n%s", report)
+	}
+
+	// Two connections sharing a link no faster than one
+	msg.Elapsed = 20 * time.Second
+	if report := formatAccelerationReport(msg); !strings.Contains(report, "did not help") {
+		t.Errorf("no speedup should be called out:\n%s", report)
+	}
+}
+
+func TestEventFromMsg(t *testing.T) {
+	ev, ok := eventFromMsg(events.DownloadCompleteMsg{DownloadID: "abc", Filename: "f.bin", Total: 42, Elapsed: 1500 * time.Millisecond})
+	if !ok {
+		t.Fatal("expected an event for DownloadCompleteMsg")
+	}
+	if ev.Event != "completed" || ev.ID != "abc" || ev.Total != 42 || ev.ElapsedMs != 1500 {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	ev, _ = eventFromMsg(events.DownloadErrorMsg{DownloadID: "abc", Err: errors.New("boom")})
+	if ev.Event != "error" || ev.Error != "boom" {
+		t.Errorf("unexpected error event: %+v", ev)
+	}
+
+	ev, _ = eventFromMsg(events.DownloadWarningMsg{DownloadID: "abc", Message: "limited by the disk"})
+	if ev.Event != "warning" || ev.Message != "limited by the disk" {
+		t.Errorf("unexpected warning event: %+v", ev)
+	}
+
+	startAt := time.UnixMilli(1700000000000)
+	ev, _ = eventFromMsg(events.DownloadScheduledMsg{DownloadID: "abc", StartAt: startAt})
+	if ev.Event != "scheduled" || ev.StartAt != startAt.UnixMilli() {
+		t.Errorf("unexpected scheduled event: %+v", ev)
+	}
+
+	if _, ok := eventFromMsg(events.DownloadRequestMsg{}); ok {
+		t.Error("requests are not lifecycle events")
+	}
+}
+
+func TestEventStream_WritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEventStream(&buf)
+	s.Emit(progressEvent{Event: "started", ID: "a"})
+	s.Emit(progressEvent{Event: "progress", ID: "a", Downloaded: 10, Total: 20, Speed: 5})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	var ev progressEvent
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatalf("line is not JSON: %v", err)
+	}
+	if ev.Event != "progress" || ev.Downloaded != 10 || ev.Time == 0 {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// queueTarget turns where a queued download is asked to go, "up", "down",
+// "top", "bottom" or a 1-based position, into a 0-based position given its
+// current one and the queue length
+func queueTarget(to string, current, length int) (int, error) {
+	switch to {
+	case "up":
+		return current - 1, nil
+	case "down":
+		return current + 1, nil
+	case "top":
+		return 0, nil
+	case "bottom":
+		return length - 1, nil
+	}
+	n, err := strconv.Atoi(to)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid position %q: want up, down, top, bottom or a number from 1", to)
+	}
+	return n - 1, nil
+}
+
+// handleQueueMove moves a queued download to where the to parameter says
+func handleQueueMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+	if !canAccess(r, id) {
+		http.Error(w, "Download not found", http.StatusNotFound)
+		return
+	}
+	if GlobalPool == nil {
+		http.Error(w, "Server internal error: pool not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	current := GlobalPool.QueuePosition(id)
+	if current < 0 {
+		http.Error(w, "Download is not queued", http.StatusConflict)
+		return
+	}
+	target, err := queueTarget(r.URL.Query().Get("to"), current, GlobalPool.QueueLength())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !GlobalPool.MoveTo(id, target) {
+		http.Error(w, "Download is not queued", http.StatusConflict) // Started meanwhile
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":   "moved",
+		"id":       id,
+		"position": GlobalPool.QueuePosition(id) + 1,
+	})
+}
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Reorder downloads waiting to start",
+	Long: `Downloads wait in the queue by priority (see --priority of surge get), then
+in the order they were added. Moving one ahead of a download of higher
+priority raises its own to match.`,
+}
+
+var queueMoveCmd = &cobra.Command{
+	Use:   "move <ID> <up|down|top|bottom|N>",
+	Short: "Move a queued download, e.g. to the top or to position 2",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Fprintln(os.Stderr, "Error: Surge is not running; downloads only queue while it is.")
+			os.Exit(1)
+		}
+		id, err := resolveDownloadID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := queueTarget(args[1], 0, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		query := url.Values{"id": {id}, "to": {args[1]}}
+		resp, err := serverRequest(http.MethodPost, port, "/queue/move?"+query.Encode(), nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+			os.Exit(1)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "Error: server returned %s - %s\n", resp.Status, body)
+			os.Exit(1)
+		}
+		var moved struct {
+			Position int `json:"position"`
+		}
+		json.Unmarshal(body, &moved)
+		fmt.Printf("Moved download %s to position %d\n", shortID(id), moved.Position)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queueCmd)
+	queueCmd.AddCommand(queueMoveCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/download"
+)
+
+func TestQueueTarget(t *testing.T) {
+	tests := []struct {
+		to      string
+		want    int
+		wantErr bool
+	}{
+		{to: "up", want: 1},
+		{to: "down", want: 3},
+		{to: "top", want: 0},
+		{to: "bottom", want: 4},
+		{to: "1", want: 0},
+		{to: "9", want: 8}, // The pool clamps it
+		{to: "0", wantErr: true},
+		{to: "first", wantErr: true},
+		{to: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := queueTarget(tt.to, 2, 5)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("queueTarget(%q, 2, 5) = %d, %v; want %d, error %v", tt.to, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHandleQueueMove_NotQueued(t *testing.T) {
+	oldPool := GlobalPool
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	defer func() { GlobalPool = oldPool }()
+
+	for _, tt := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/queue/move?id=a1&to=up", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/queue/move?to=up", http.StatusBadRequest},
+		{http.MethodPost, "/queue/move?id=a1&to=up", http.StatusConflict},
+	} {
+		rec := httptest.NewRecorder()
+		handleQueueMove(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+}
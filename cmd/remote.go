@@ -0,0 +1,370 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Environment variables CLI commands use to reach a server, including one on
+// another machine
+const (
+	envHost       = "SURGE_HOST"        // Server base URL, e.g. https://nas.lan:8080
+	envToken      = "SURGE_TOKEN"       // API token (also read by `server start`)
+	envWatchToken = "SURGE_WATCH_TOKEN" // Read-only API token for `tui --watch` (also read by `server start`)
+	envCACert     = "SURGE_CA_CERT"     // PEM bundle used to verify the server certificate
+	envClientCert = "SURGE_CLIENT_CERT" // Client certificate for servers that require mTLS
+	envClientKey  = "SURGE_CLIENT_KEY"
+)
+
+// serverSecurity holds the `server start` options controlling who can reach the API
+type serverSecurity struct {
+	Bind       string // Address to listen on; loopback unless set
+	Token      string // Required as "Authorization: Bearer <token>" when set
+	WatchToken string // Only lets clients list downloads, for `tui --watch`; random if unset
+	CertFile   string // Serve HTTPS with this certificate and KeyFile
+	KeyFile    string
+	ClientCA   string    // Require client certificates signed by this CA (mTLS)
+	Users      []apiUser // Named users from --users-file, each seeing only its own downloads
+}
+
+// serverSecurityFromFlags reads and validates the server security flags.
+// Listening beyond loopback requires a token or client certificates.
+func serverSecurityFromFlags(cmd *cobra.Command) (serverSecurity, error) {
+	var s serverSecurity
+	s.Bind, _ = cmd.Flags().GetString("bind")
+	s.Token, _ = cmd.Flags().GetString("token")
+	s.CertFile, _ = cmd.Flags().GetString("tls-cert")
+	s.KeyFile, _ = cmd.Flags().GetString("tls-key")
+	s.ClientCA, _ = cmd.Flags().GetString("tls-client-ca")
+	s.WatchToken, _ = cmd.Flags().GetString("watch-token")
+	if s.Token == "" {
+		s.Token = os.Getenv(envToken)
+	}
+	if s.WatchToken == "" {
+		s.WatchToken = os.Getenv(envWatchToken)
+	}
+	if path, _ := cmd.Flags().GetString("users-file"); path != "" {
+		users, err := loadUsers(path)
+		if err != nil {
+			return s, err
+		}
+		s.Users = users
+	}
+	if s.WatchToken == "" && (s.Token != "" || len(s.Users) > 0) {
+		s.WatchToken = newToken()
+	}
+	return s, s.validate()
+}
+
+// newToken returns a random API token
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s serverSecurity) validate() error {
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+	if s.ClientCA != "" && s.CertFile == "" {
+		return errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+	}
+	if !isLoopbackHost(s.Bind) && len(s.apiUsers()) == 0 && s.ClientCA == "" {
+		return fmt.Errorf("refusing to listen on %s without --token, --users-file or --tls-client-ca", s.Bind)
+	}
+	for _, u := range s.Users {
+		if u.Token == s.Token {
+			return fmt.Errorf("user %q has the same token as --token", u.Name)
+		}
+		if u.Token == s.WatchToken {
+			return fmt.Errorf("user %q has the same token as --watch-token", u.Name)
+		}
+	}
+	if s.WatchToken != "" {
+		// Without other tokens the API is open anyway
+		if s.Token == "" && len(s.Users) == 0 {
+			return errors.New("--watch-token requires --token or --users-file")
+		}
+		if s.WatchToken == s.Token {
+			return errors.New("--watch-token must differ from --token")
+		}
+	}
+	return nil
+}
+
+// apiUsers returns everyone allowed to use the API: the --token user, who
+// sees all downloads, the named users and the read-only watcher
+func (s serverSecurity) apiUsers() []apiUser {
+	users := s.Users
+	if s.Token != "" {
+		users = append([]apiUser{{Token: s.Token}}, users...)
+	}
+	if s.WatchToken != "" {
+		users = append(users[:len(users):len(users)], apiUser{Token: s.WatchToken, ReadOnly: true})
+	}
+	return users
+}
+
+// isLoopbackHost reports whether host only accepts local connections
+func isLoopbackHost(host string) bool {
+	if host == "" || host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listen opens the API listener on port, or on the first free port from 8080
+// when port is 0, wrapped in TLS if a certificate is configured
+func (s serverSecurity) listen(port int) (int, net.Listener, error) {
+	host := s.Bind
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	var ln net.Listener
+	if port > 0 {
+		var err error
+		ln, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return 0, nil, fmt.Errorf("could not bind to port %d: %w", port, err)
+		}
+	} else {
+		port, ln = findAvailablePortOn(host, 8080)
+		if ln == nil {
+			return 0, nil, errors.New("could not find available port")
+		}
+	}
+
+	if s.CertFile == "" {
+		return port, ln, nil
+	}
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		ln.Close()
+		return 0, nil, err
+	}
+	return port, tls.NewListener(ln, tlsConfig), nil
+}
+
+func (s serverSecurity) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if s.ClientCA != "" {
+		pool, err := loadCertPool(s.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// readOnlyPaths are the endpoints a ReadOnly user may GET
+var readOnlyPaths = map[string]bool{"/list": true}
+
+// authMiddleware rejects requests without the bearer token of one of users
+// and passes the user on in the request context. /health stays open so
+// clients can tell a running server from a wrong token. ReadOnly users only
+// get readOnlyPaths.
+func authMiddleware(users []apiUser, next http.Handler) http.Handler {
+	if len(users) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		got := []byte(r.Header.Get("Authorization"))
+		var user *apiUser
+		// Compare against every token so timing does not reveal which matched
+		for i := range users {
+			if subtle.ConstantTimeCompare(got, []byte("Bearer "+users[i].Token)) == 1 {
+				user = &users[i]
+			}
+		}
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="surge"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if user.ReadOnly && (r.Method != http.MethodGet || !readOnlyPaths[r.URL.Path]) {
+			http.Error(w, "Forbidden: read-only token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, withUser(r, user))
+	})
+}
+
+// saveActiveToken stores the server token for local CLI commands, readable
+// only by the current user
+func saveActiveToken(token string) {
+	if token == "" {
+		return
+	}
+	tokenFile := filepath.Join(config.GetCacheDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+		utils.Debug("Failed to save API token: %v", err)
+	}
+}
+
+// saveWatchToken stores the read-only server token for `tui --watch`,
+// readable only by the current user
+func saveWatchToken(token string) {
+	if token == "" {
+		return
+	}
+	tokenFile := filepath.Join(config.GetCacheDir(), "watch-token")
+	if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+		utils.Debug("Failed to save watch token: %v", err)
+	}
+}
+
+// removeActiveToken cleans up the token files on exit
+func removeActiveToken() {
+	os.Remove(filepath.Join(config.GetCacheDir(), "token"))
+	os.Remove(filepath.Join(config.GetCacheDir(), "watch-token"))
+}
+
+// clientToken returns the token CLI commands send, from SURGE_TOKEN or the
+// file left by a local server
+func clientToken() string {
+	if token := os.Getenv(envToken); token != "" {
+		return token
+	}
+	data, err := os.ReadFile(filepath.Join(config.GetCacheDir(), "token"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// watchToken returns the read-only token `tui --watch` sends, from
+// SURGE_WATCH_TOKEN or the file left by a local server
+func watchToken() string {
+	if token := os.Getenv(envWatchToken); token != "" {
+		return token
+	}
+	data, err := os.ReadFile(filepath.Join(config.GetCacheDir(), "watch-token"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// remotePort returns the port of the server named by SURGE_HOST, or 0 if unset
+func remotePort() int {
+	raw := os.Getenv(envHost)
+	if raw == "" {
+		return 0
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return 0
+	}
+	if p, err := strconv.Atoi(u.Port()); err == nil {
+		return p
+	}
+	if u.Scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+// serverURL returns the URL of path on the running server
+func serverURL(port int, path string) string {
+	if host := os.Getenv(envHost); host != "" {
+		return strings.TrimRight(host, "/") + path
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+}
+
+// apiClient returns the HTTP client for talking to the server, set up with
+// any certificates from the environment
+func apiClient() (*http.Client, error) {
+	caFile, certFile, keyFile := os.Getenv(envCACert), os.Getenv(envClientCert), os.Getenv(envClientKey)
+	if caFile == "" && certFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return &http.Client{Transport: transport}, nil
+}
+
+// serverRequest sends an API request to the running server with the
+// configured token and certificates
+func serverRequest(method string, port int, path string, body io.Reader) (*http.Response, error) {
+	return serverRequestWithToken(method, port, path, body, clientToken())
+}
+
+// serverRequestWithToken is serverRequest sending token instead
+func serverRequestWithToken(method string, port int, path string, body io.Reader, token string) (*http.Response, error) {
+	req, err := http.NewRequest(method, serverURL(port, path), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client, err := apiClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+func TestServerSecurity_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       serverSecurity
+		wantErr bool
+	}{
+		{"loopback default", serverSecurity{Bind: "127.0.0.1"}, false},
+		{"localhost", serverSecurity{Bind: "localhost"}, false},
+		{"ipv6 loopback", serverSecurity{Bind: "::1"}, false},
+		{"all interfaces without auth", serverSecurity{Bind: "0.0.0.0"}, true},
+		{"all interfaces with token", serverSecurity{Bind: "0.0.0.0", Token: "secret"}, false},
+		{"all interfaces with mTLS", serverSecurity{Bind: "0.0.0.0", CertFile: "c", KeyFile: "k", ClientCA: "ca"}, false},
+		{"cert without key", serverSecurity{Bind: "127.0.0.1", CertFile: "c"}, true},
+		{"client CA without TLS", serverSecurity{Bind: "127.0.0.1", ClientCA: "ca"}, true},
+		{"watch token", serverSecurity{Bind: "0.0.0.0", Token: "secret", WatchToken: "look"}, false},
+		{"watch token alone", serverSecurity{Bind: "127.0.0.1", WatchToken: "look"}, true},
+		{"watch token is the token", serverSecurity{Bind: "0.0.0.0", Token: "secret", WatchToken: "secret"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.s.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	users := serverSecurity{Token: "secret", WatchToken: "look"}.apiUsers()
+	handler := authMiddleware(users, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		auth   string
+		status int
+	}{
+		{http.MethodGet, "/list", "", http.StatusUnauthorized},
+		{http.MethodGet, "/list", "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/list", "Bearer secret", http.StatusOK},
+		{http.MethodGet, "/health", "", http.StatusOK},
+		{http.MethodPost, "/pause", "Bearer secret", http.StatusOK},
+		// The watch token only lists
+		{http.MethodGet, "/list", "Bearer look", http.StatusOK},
+		{http.MethodPost, "/pause", "Bearer look", http.StatusForbidden},
+		{http.MethodPost, "/list", "Bearer look", http.StatusForbidden},
+		{http.MethodGet, "/diag", "Bearer look", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s with %q: got %d, want %d", tt.method, tt.path, tt.auth, rec.Code, tt.status)
+		}
+	}
+}
+
+// writeCert creates a certificate signed by parent (self-signed when parent
+// is nil) and writes it and its key as PEM files into dir
+func writeCert(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestServerRequest_TokenAndMutualTLS(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := writeCert(t, tempDir, "ca", &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test CA"},
+		NotBefore: time.Now().Add(-time.Minute), NotAfter: notAfter,
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	writeCert(t, tempDir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "surge"},
+		NotBefore: time.Now().Add(-time.Minute), NotAfter: notAfter,
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCert(t, tempDir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "cli"},
+		NotBefore: time.Now().Add(-time.Minute), NotAfter: notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	security := serverSecurity{
+		Bind:     "127.0.0.1",
+		Token:    "secret",
+		CertFile: filepath.Join(tempDir, "server.pem"),
+		KeyFile:  filepath.Join(tempDir, "server-key.pem"),
+		ClientCA: filepath.Join(tempDir, "ca.pem"),
+	}
+	port, ln, err := security.listen(0)
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go startHTTPServer(ln, port, "", security.apiUsers())
+	defer ln.Close()
+
+	host := "https://" + ln.Addr().String()
+	t.Setenv(envHost, host)
+	t.Setenv(envCACert, filepath.Join(tempDir, "ca.pem"))
+
+	// Without a client certificate the TLS handshake is refused
+	if resp, err := serverRequest(http.MethodGet, port, "/health", nil); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the server to require a client certificate")
+	}
+
+	t.Setenv(envClientCert, filepath.Join(tempDir, "client.pem"))
+	t.Setenv(envClientKey, filepath.Join(tempDir, "client-key.pem"))
+
+	// With the certificate but the wrong token the API refuses the request
+	t.Setenv(envToken, "wrong")
+	resp, err := serverRequest(http.MethodGet, port, "/list", nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 with the wrong token, got %d", resp.StatusCode)
+	}
+
+	t.Setenv(envToken, "secret")
+	if readActivePort() != port {
+		t.Errorf("readActivePort() = %d, want the port from %s", readActivePort(), envHost)
+	}
+	if _, err := GetRemoteDownloads(port); err != nil {
+		t.Errorf("GetRemoteDownloads with token and certificate failed: %v", err)
+	}
+}
+
+func TestClientToken_FromServerFile(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	t.Setenv(envToken, "")
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	saveActiveToken("from-file")
+	if got := clientToken(); got != "from-file" {
+		t.Errorf("clientToken() = %q, want the token saved by the server", got)
+	}
+	removeActiveToken()
+	if got := clientToken(); got != "" {
+		t.Errorf("clientToken() = %q after removal, want empty", got)
+	}
+}
+
+func TestWatchToken_FromServerFile(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	t.Setenv(envWatchToken, "")
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	saveActiveToken("full")
+	saveWatchToken("look")
+	if got := watchToken(); got != "look" {
+		t.Errorf("watchToken() = %q, want the read-only token saved by the server", got)
+	}
+	removeActiveToken()
+	if got := watchToken(); got != "" {
+		t.Errorf("watchToken() = %q after removal, want empty", got)
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -28,7 +29,18 @@ var resumeCmd = &cobra.Command{
 
 		if all {
 			if port > 0 {
-				fmt.Println("Resuming all downloads is not yet implemented for running server.")
+				resp, err := serverRequest(http.MethodPost, port, "/resume-all", nil)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+					os.Exit(1)
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusOK {
+					fmt.Fprintf(os.Stderr, "Error: server returned %s\n", resp.Status)
+					os.Exit(1)
+				}
+				fmt.Println("All downloads resumed.")
 			} else {
 				if err := state.ResumeAllDownloads(); err != nil {
 					fmt.Fprintf(os.Stderr, "Error resuming downloads: %v\n", err)
@@ -50,7 +62,7 @@ var resumeCmd = &cobra.Command{
 
 		if port > 0 {
 			// Send to running server
-			resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/resume?id=%s", port, id), "application/json", nil)
+			resp, err := serverRequest(http.MethodPost, port, "/resume?id="+id, nil)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 				os.Exit(1)
@@ -61,13 +73,13 @@ var resumeCmd = &cobra.Command{
 				fmt.Fprintf(os.Stderr, "Error: server returned %s\n", resp.Status)
 				os.Exit(1)
 			}
-			fmt.Printf("Resumed download %s\n", id[:8])
+			fmt.Printf("Resumed download %s\n", shortID(id))
 		} else {
 			if err := state.UpdateStatus(id, "queued"); err != nil {
 				fmt.Fprintf(os.Stderr, "Error resuming download: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Resumed download %s (offline mode). Start Surge to begin downloading.\n", id[:8])
+			fmt.Printf("Resumed download %s (offline mode). Start Surge to begin downloading.\n", shortID(id))
 		}
 	},
 }
@@ -76,3 +88,23 @@ func init() {
 	rootCmd.AddCommand(resumeCmd)
 	resumeCmd.Flags().Bool("all", false, "Resume all paused downloads")
 }
+
+// handleResumeAll ends a pause-all and resumes every paused download of the
+// running pool. Like handlePauseAll it is reserved for the --token user.
+func handleResumeAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if u := requestUser(r); u != nil && u.Name != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if GlobalPool == nil {
+		http.Error(w, "Server internal error: pool not initialized", http.StatusInternalServerError)
+		return
+	}
+	GlobalPool.ResumeAll()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "resumed"})
+}
@@ -2,10 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/download"
 	"github.com/surge-downloader/surge/internal/engine/state"
 )
 
@@ -13,12 +18,17 @@ var rmCmd = &cobra.Command{
 	Use:     "rm <ID>",
 	Aliases: []string{"kill"},
 	Short:   "Remove a download",
-	Long:    `Remove a download by its ID. Use --clean to remove all completed downloads.`,
-	Args:    cobra.MaximumNArgs(1),
+	Long: `Remove a download by its ID. Use --clean to remove all completed downloads.
+
+--delete-file also moves the downloaded file to the trash or Recycle Bin,
+where it can be restored; add --permanent to delete it for good.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initializeGlobalState()
 
 		clean, _ := cmd.Flags().GetBool("clean")
+		deleteFile, _ := cmd.Flags().GetBool("delete-file")
+		permanent, _ := cmd.Flags().GetBool("permanent")
 
 		if !clean && len(args) == 0 {
 			fmt.Fprintln(os.Stderr, "Error: provide a download ID or use --clean")
@@ -49,7 +59,12 @@ var rmCmd = &cobra.Command{
 
 		if port > 0 {
 			// Send to running server
-			resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/delete?id=%s", port, id), "application/json", nil)
+			query := url.Values{"id": {id}}
+			if deleteFile {
+				query.Set("delete_file", "true")
+				query.Set("permanent", strconv.FormatBool(permanent))
+			}
+			resp, err := serverRequest(http.MethodPost, port, "/delete?"+query.Encode(), nil)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 				os.Exit(1)
@@ -57,17 +72,24 @@ var rmCmd = &cobra.Command{
 			defer resp.Body.Close()
 
 			if resp.StatusCode != http.StatusOK {
-				fmt.Fprintf(os.Stderr, "Error: server returned %s\n", resp.Status)
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Fprintf(os.Stderr, "Error: server returned %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
 				os.Exit(1)
 			}
-			fmt.Printf("Removed download %s\n", id[:8])
+			fmt.Printf("Removed download %s\n", shortID(id))
 		} else {
 			// Offline mode: remove from DB
+			if deleteFile {
+				if err := deleteCompletedFile(id, permanent); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
 			if err := state.RemoveFromMasterList(id); err != nil {
 				fmt.Fprintf(os.Stderr, "Error removing download: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Removed download %s (offline mode)\n", id[:8])
+			fmt.Printf("Removed download %s (offline mode)\n", shortID(id))
 		}
 	},
 }
@@ -75,4 +97,23 @@ var rmCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(rmCmd)
 	rmCmd.Flags().Bool("clean", false, "Remove all completed downloads")
+	rmCmd.Flags().Bool("delete-file", false, "Also move the downloaded file to the trash")
+	rmCmd.Flags().Bool("permanent", false, "With --delete-file, delete the file for good instead of trashing it")
+}
+
+// deleteCompletedFile deletes the file of download id if it completed, see
+// download.DeleteFile. Unfinished downloads have only partial data, which
+// removing them already cleans up.
+func deleteCompletedFile(id string, permanent bool) error {
+	entry, err := state.GetDownload(id)
+	if err != nil || entry == nil || entry.Status != "completed" || entry.DestPath == "" {
+		return err
+	}
+	if err := download.DeleteFile(entry.DestPath, permanent); err != nil {
+		if !permanent {
+			return fmt.Errorf("moving %s to trash: %w (--permanent deletes it instead)", entry.DestPath, err)
+		}
+		return fmt.Errorf("deleting %s: %w", entry.DestPath, err)
+	}
+	return nil
 }
@@ -1,26 +1,35 @@
 package cmd
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/credentials"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/hooks"
+	"github.com/surge-downloader/surge/internal/keyring"
+	"github.com/surge-downloader/surge/internal/oauth"
+	"github.com/surge-downloader/surge/internal/plugins"
 	"github.com/surge-downloader/surge/internal/tui"
 	"github.com/surge-downloader/surge/internal/utils"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
 
@@ -48,16 +57,43 @@ var rootCmd = &cobra.Command{
 	Version: Version,
 	Args:    cobra.ArbitraryArgs,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Relocate writable files before anything touches them
+		applyDirFlags(cmd)
+
+		// On first launch of the TUI (the root command, not a subcommand),
+		// ask for the basics before anything reads settings
+		if !cmd.HasParent() {
+			maybeRunSetupWizard()
+		}
+
 		// Initialize Global Progress Channel
 		GlobalProgressCh = make(chan any, 100)
 
+		settings, err := config.LoadSettings()
+		if err != nil {
+			settings = config.DefaultSettings()
+		}
+
 		// Initialize Global Worker Pool
-		// TODO: Load max downloads from settings
-		GlobalPool = download.NewWorkerPool(GlobalProgressCh, 4)
+		GlobalPool = download.NewWorkerPool(GlobalProgressCh, settings.General.MaxConcurrentDownloads)
+		GlobalPool.SetKeepPartialOnCancel(settings.General.KeepPartialOnCancel)
+		GlobalPool.SetMarkExecutable(settings.General.MarkExecutable)
+		GlobalPool.SetFixExtensions(settings.General.FixExtensions)
+		GlobalPool.SetOwnership(convertOwnershipRules(settings.General.Ownership))
+		GlobalPool.SetHooks(convertHookSettings(settings.General.Hooks))
+		GlobalPool.SetSortFolder(settings.General.SortFolder)
+		GlobalPool.SetAutosave(settings.Performance.AutosaveInterval)
+		GlobalPool.SetSpeedLimit(settings.Connections.SpeedLimitRate())
+		GlobalPool.SetConnectionBudget(settings.Connections.MaxGlobalConnections, settings.Connections.SchedulingPolicy)
+		GlobalPool.SetActions(types.PostActions{
+			OnComplete: settings.General.AfterDownload.OnComplete,
+			Notify:     settings.General.AfterDownload.Notify,
+		})
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 
 		initializeGlobalState()
+		args = mirrorArgs(cmd, args)
 
 		// Attempt to acquire lock
 		isMaster, err := AcquireLock()
@@ -78,6 +114,25 @@ var rootCmd = &cobra.Command{
 		outputDir, _ := cmd.Flags().GetString("output")
 		noResume, _ := cmd.Flags().GetBool("no-resume")
 		exitWhenDone, _ := cmd.Flags().GetBool("exit-when-done")
+		serveProfiling, _ = cmd.Flags().GetBool("pprof")
+		if err := applyCompletedFileFlags(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyConcurrencyFlag(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyMaxActiveFlag(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyProxyFlag(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		applyPostActionFlags(cmd)
+		GlobalPool.SetPlugins(plugins.Discover(config.GetPluginsDir()))
 
 		var port int
 		var listener net.Listener
@@ -105,7 +160,11 @@ var rootCmd = &cobra.Command{
 		defer removeActivePort()
 
 		// Start HTTP server in background (reuse the listener)
-		go startHTTPServer(listener, port, outputDir)
+		go startHTTPServer(listener, port, outputDir, nil)
+		if err := startAria2RPC(cmd, port, outputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
 		// Queue initial downloads if any
 		go func() {
@@ -122,7 +181,7 @@ var rootCmd = &cobra.Command{
 			}
 
 			if len(urls) > 0 {
-				processDownloads(urls, outputDir, 0) // 0 port = internal direct add
+				processDownloads(urls, outputDir, downloadOptions{}, 0) // 0 port = internal direct add
 			}
 		}()
 
@@ -174,55 +233,89 @@ func startTUI(port int, exitWhenDone bool, noResume bool) {
 	}
 }
 
-// StartHeadlessConsumer starts a goroutine to consume progress messages and log to stdout
-func StartHeadlessConsumer() {
+// StartHeadlessConsumer starts a goroutine to consume progress messages and log to stdout.
+// When stdout is a terminal and progressInterval is positive, a summary line
+// of running downloads is also redrawn at that interval. If eventOut is set,
+// every lifecycle message and periodic progress is also written to it as JSON lines.
+func StartHeadlessConsumer(progressInterval time.Duration, eventOut io.Writer) {
+	out := &statusLine{out: os.Stdout}
+	if progressInterval > 0 && isTerminal(os.Stdout) {
+		go out.Run(progressInterval, activeDownloadStatuses, nil)
+	}
+
+	var stream *eventStream
+	if eventOut != nil {
+		stream = newEventStream(eventOut)
+		interval := progressInterval
+		if interval <= 0 {
+			interval = defaultProgressInterval
+		}
+		go stream.Run(interval, activeDownloadStatuses, nil)
+	}
+
 	go func() {
 		for msg := range GlobalProgressCh {
+			if stream != nil {
+				if ev, ok := eventFromMsg(msg); ok {
+					stream.Emit(ev)
+				}
+			}
+
 			switch m := msg.(type) {
 			case events.DownloadStartedMsg:
-				id := m.DownloadID
-				if len(id) > 8 {
-					id = id[:8]
-				}
-				fmt.Printf("Started: %s [%s]\n", m.Filename, id)
+				id := shortID(m.DownloadID)
+				out.Printf("Started: %s [%s]\n", m.Filename, id)
 			case events.DownloadCompleteMsg:
 				atomic.AddInt32(&activeDownloads, -1)
-				id := m.DownloadID
-				if len(id) > 8 {
-					id = id[:8]
+				id := shortID(m.DownloadID)
+				out.Printf("Completed: %s [%s] (in %s)\n", m.Filename, id, m.Elapsed)
+				if showAccelerationReport {
+					if report := formatAccelerationReport(m); report != "" {
+						out.Printf("%s", report)
+					}
 				}
-				fmt.Printf("Completed: %s [%s] (in %s)\n", m.Filename, id, m.Elapsed)
 			case events.DownloadErrorMsg:
 				atomic.AddInt32(&activeDownloads, -1)
-				id := m.DownloadID
-				if len(id) > 8 {
-					id = id[:8]
+				id := shortID(m.DownloadID)
+				out.Printf("Error: %s [%s]: %v\n", m.Filename, id, m.Err)
+				if hint := download.Diagnose(m.Err).Suggestion; hint != "" {
+					out.Printf("  Hint: %s\n", hint)
 				}
-				fmt.Printf("Error: %s [%s]: %v\n", m.Filename, id, m.Err)
+			case events.DownloadWarningMsg:
+				id := shortID(m.DownloadID)
+				out.Printf("Warning: %s [%s]: %s\n", m.Filename, id, m.Message)
 			case events.DownloadQueuedMsg:
-				id := m.DownloadID
-				if len(id) > 8 {
-					id = id[:8]
-				}
-				fmt.Printf("Queued: %s [%s]\n", m.Filename, id)
+				id := shortID(m.DownloadID)
+				out.Printf("Queued: %s [%s]\n", m.Filename, id)
+			case events.DownloadScheduledMsg:
+				id := shortID(m.DownloadID)
+				out.Printf("Scheduled: %s [%s] for %s\n", m.Filename, id, m.StartAt.Format("2006-01-02 15:04"))
 			case events.DownloadPausedMsg:
-				id := m.DownloadID
-				if len(id) > 8 {
-					id = id[:8]
-				}
-				fmt.Printf("Paused: %s [%s]\n", m.Filename, id)
+				id := shortID(m.DownloadID)
+				out.Printf("Paused: %s [%s]\n", m.Filename, id)
 			case events.DownloadResumedMsg:
-				id := m.DownloadID
-				if len(id) > 8 {
-					id = id[:8]
-				}
-				fmt.Printf("Resumed: %s [%s]\n", m.Filename, id)
+				id := shortID(m.DownloadID)
+				out.Printf("Resumed: %s [%s]\n", m.Filename, id)
 			case events.DownloadRemovedMsg:
-				id := m.DownloadID
-				if len(id) > 8 {
-					id = id[:8]
+				id := shortID(m.DownloadID)
+				if m.Reclaimed > 0 {
+					out.Printf("Removed: %s [%s] (freed %s)\n", m.Filename, id, utils.ConvertBytesToHumanReadable(m.Reclaimed))
+				} else {
+					out.Printf("Removed: %s [%s]\n", m.Filename, id)
 				}
-				fmt.Printf("Removed: %s [%s]\n", m.Filename, id)
+			case events.DownloadMovedMsg:
+				id := shortID(m.DownloadID)
+				out.Printf("Moved: %s [%s] to %s\n", m.Filename, id, m.DestPath)
+			case events.ChecksumVerifiedMsg:
+				id := shortID(m.DownloadID)
+				algo, _, _ := strings.Cut(m.Checksum, ":")
+				out.Printf("Verified: %s [%s] %s OK\n", m.Filename, id, algo)
+			case events.SignatureVerifiedMsg:
+				id := shortID(m.DownloadID)
+				out.Printf("Verified: %s [%s] signed by %s\n", m.Filename, id, m.Signer)
+			case events.ExtensionFixedMsg:
+				id := shortID(m.DownloadID)
+				out.Printf("Renamed: %s [%s] to %s\n", m.Filename, id, filepath.Base(m.DestPath))
 			}
 		}
 	}()
@@ -230,8 +323,13 @@ func StartHeadlessConsumer() {
 
 // findAvailablePort tries ports starting from 'start' until one is available
 func findAvailablePort(start int) (int, net.Listener) {
+	return findAvailablePortOn("127.0.0.1", start)
+}
+
+// findAvailablePortOn is findAvailablePort for a specific interface
+func findAvailablePortOn(host string, start int) (int, net.Listener) {
 	for port := start; port < start+100; port++ {
-		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 		if err == nil {
 			return port, ln
 		}
@@ -241,28 +339,48 @@ func findAvailablePort(start int) (int, net.Listener) {
 
 // saveActivePort writes the active port to ~/.surge/port for extension discovery
 func saveActivePort(port int) {
-	portFile := filepath.Join(config.GetSurgeDir(), "port")
+	portFile := filepath.Join(config.GetCacheDir(), "port")
 	os.WriteFile(portFile, []byte(fmt.Sprintf("%d", port)), 0644)
 	utils.Debug("HTTP server listening on port %d", port)
 }
 
 // removeActivePort cleans up the port file on exit
 func removeActivePort() {
-	portFile := filepath.Join(config.GetSurgeDir(), "port")
+	portFile := filepath.Join(config.GetCacheDir(), "port")
 	os.Remove(portFile)
 }
 
-// startHTTPServer starts the HTTP server using an existing listener
-func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
+// startHTTPServer starts the HTTP server using an existing listener.
+// When users are given, every endpoint but /health requires one of their tokens.
+func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, users []apiUser) {
+	mux := newAPIMux(port, defaultOutputDir)
+
+	// JSON-RPC endpoint, calling the endpoints above
+	mux.Handle("/rpc", rpcHTTPHandler(mux))
+
+	server := &http.Server{Handler: corsMiddleware(authMiddleware(users, mux))}
+	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		utils.Debug("HTTP server error: %v", err)
+	}
+}
+
+// newAPIMux returns the handlers of the HTTP API, without authentication
+func newAPIMux(port int, defaultOutputDir string) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		health := map[string]interface{}{
 			"status": "ok",
 			"port":   port,
-		})
+		}
+		if GlobalPool != nil {
+			health["queued"] = GlobalPool.QueueLength()
+			health["queue_limit"] = GlobalPool.QueueLimit()
+			health["all_paused"] = GlobalPool.Held()
+		}
+		json.NewEncoder(w).Encode(health)
 	})
 
 	// Download endpoint
@@ -281,6 +399,10 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 			http.Error(w, "Missing id parameter", http.StatusBadRequest)
 			return
 		}
+		if !canAccess(r, id) {
+			http.Error(w, "Download not found", http.StatusNotFound)
+			return
+		}
 		if GlobalPool != nil {
 			GlobalPool.Pause(id)
 			w.Header().Set("Content-Type", "application/json")
@@ -301,6 +423,10 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 			http.Error(w, "Missing id parameter", http.StatusBadRequest)
 			return
 		}
+		if !canAccess(r, id) {
+			http.Error(w, "Download not found", http.StatusNotFound)
+			return
+		}
 		if GlobalPool != nil {
 			GlobalPool.Resume(id)
 			w.Header().Set("Content-Type", "application/json")
@@ -310,6 +436,10 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 		}
 	})
 
+	// Pause and resume everything at once
+	mux.HandleFunc("/pause-all", handlePauseAll)
+	mux.HandleFunc("/resume-all", handleResumeAll)
+
 	// Delete endpoint
 	mux.HandleFunc("/delete", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete && r.Method != http.MethodPost {
@@ -321,8 +451,30 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 			http.Error(w, "Missing id parameter", http.StatusBadRequest)
 			return
 		}
+		if !canAccess(r, id) {
+			http.Error(w, "Download not found", http.StatusNotFound)
+			return
+		}
 		if GlobalPool != nil {
-			GlobalPool.Cancel(id)
+			// Delete the file first, so the download stays listed if that fails
+			if r.URL.Query().Get("delete_file") == "true" {
+				if err := deleteCompletedFile(id, r.URL.Query().Get("permanent") == "true"); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			if !GlobalPool.Cancel(id) {
+				// Not running (e.g. paused in an earlier session): clean up its partial data here
+				if entry, err := state.GetDownload(id); err == nil && entry != nil && entry.Status != "completed" {
+					keep := false
+					if settings, err := config.LoadSettings(); err == nil {
+						keep = settings.General.KeepPartialOnCancel
+					}
+					if _, err := download.CleanupPartial(id, entry.URL, entry.DestPath, keep); err != nil {
+						utils.Debug("Failed to clean up partial download: %v", err)
+					}
+				}
+			}
 			// Ensure removed from DB as well
 			if err := state.RemoveFromMasterList(id); err != nil {
 				utils.Debug("Failed to remove from DB: %v", err)
@@ -334,6 +486,18 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 		}
 	})
 
+	// Queue order endpoint
+	mux.HandleFunc("/queue/move", handleQueueMove)
+
+	// Move the file of a completed download
+	mux.HandleFunc("/move-file", handleMoveFile)
+
+	// Drain endpoint
+	mux.HandleFunc("/drain", handleDrain)
+
+	// Diagnostics, and profiling with --pprof
+	registerDiagHandlers(mux)
+
 	// List endpoint - returns all downloads with current status
 	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -341,43 +505,16 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 			return
 		}
 
-		var statuses []types.DownloadStatus
-
-		// Get active downloads from pool
-		if GlobalPool != nil {
-			activeConfigs := GlobalPool.GetAll()
-			for _, cfg := range activeConfigs {
-				status := types.DownloadStatus{
-					ID:       cfg.ID,
-					URL:      cfg.URL,
-					Filename: cfg.Filename,
-					Status:   "downloading",
-				}
-
-				if cfg.State != nil {
-					status.TotalSize = cfg.State.TotalSize
-					status.Downloaded = cfg.State.Downloaded.Load()
-					if status.TotalSize > 0 {
-						status.Progress = float64(status.Downloaded) * 100 / float64(status.TotalSize)
-					}
-
-					// Calculate speed from progress
-					downloaded, _, _, sessionElapsed, _, sessionStart := cfg.State.GetProgress()
-					sessionDownloaded := downloaded - sessionStart
-					if sessionElapsed.Seconds() > 0 && sessionDownloaded > 0 {
-						status.Speed = float64(sessionDownloaded) / sessionElapsed.Seconds() / (1024 * 1024)
-					}
-
-					// Update status based on state
-					if cfg.State.IsPaused() {
-						status.Status = "paused"
-					} else if cfg.State.Done.Load() {
-						status.Status = "completed"
-					}
+		statuses := activeDownloadStatuses()
+		owned := ownedBy(r)
+		if owned != nil {
+			mine := statuses[:0]
+			for _, s := range statuses {
+				if owned(s.ID) {
+					mine = append(mine, s)
 				}
-
-				statuses = append(statuses, status)
 			}
+			statuses = mine
 		}
 
 		// Always fetch from database to get history/paused/completed
@@ -388,10 +525,19 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 			for _, s := range statuses {
 				existingIDs[s.ID] = true
 			}
+			general := config.DefaultSettings().General
+			if settings, err := config.LoadSettings(); err == nil {
+				general = settings.General
+			}
+			now := time.Now()
 
 			for _, d := range dbDownloads {
-				// Skip if already present (active)
-				if existingIDs[d.ID] {
+				// Skip if already present (active) or another user's
+				if existingIDs[d.ID] || (owned != nil && !owned(d.ID)) {
+					continue
+				}
+				// Completed long enough ago to be history only
+				if d.Status == "completed" && d.CompletedAt > 0 && general.CompletedExpired(time.Unix(d.CompletedAt, 0), now) {
 					continue
 				}
 
@@ -415,10 +561,53 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string) {
 		json.NewEncoder(w).Encode(statuses)
 	})
 
-	server := &http.Server{Handler: corsMiddleware(mux)}
-	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
-		utils.Debug("HTTP server error: %v", err)
+	return mux
+}
+
+// activeDownloadStatuses reports the downloads currently held by the worker pool
+func activeDownloadStatuses() []types.DownloadStatus {
+	if GlobalPool == nil {
+		return nil
 	}
+
+	var statuses []types.DownloadStatus
+	activeConfigs := GlobalPool.GetAll()
+	for _, cfg := range activeConfigs {
+		status := types.DownloadStatus{
+			ID:       cfg.ID,
+			URL:      cfg.URL,
+			Filename: cfg.Filename,
+			Status:   "downloading",
+		}
+
+		if cfg.State != nil {
+			status.TotalSize = cfg.State.TotalSize
+			status.Downloaded = cfg.State.Downloaded.Load()
+			if status.TotalSize > 0 {
+				status.Progress = float64(status.Downloaded) * 100 / float64(status.TotalSize)
+			}
+
+			// Calculate speed from progress
+			downloaded, _, _, sessionElapsed, _, sessionStart := cfg.State.GetProgress()
+			sessionDownloaded := downloaded - sessionStart
+			if sessionElapsed.Seconds() > 0 && sessionDownloaded > 0 {
+				status.Speed = float64(sessionDownloaded) / sessionElapsed.Seconds() / (1024 * 1024)
+			}
+
+			// Update status based on state
+			if cfg.State.IsPaused() {
+				status.Status = "paused"
+			} else if cfg.State.Done.Load() {
+				status.Status = "completed"
+			} else {
+				engine := cfg.State.EngineStats()
+				status.Engine = &engine
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+	return statuses
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
@@ -427,12 +616,51 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// Response headers of POST /download reporting how many downloads wait for a
+// worker, so clients can slow down before the queue fills
+const (
+	headerQueueLength = "X-Surge-Queue-Length"
+	headerQueueLimit  = "X-Surge-Queue-Limit"
+)
+
+// queueFullRetryAfter is the Retry-After sent when the queue is full
+const queueFullRetryAfter = 5 * time.Second
+
 // DownloadRequest represents a download request from the browser extension
 type DownloadRequest struct {
-	URL      string   `json:"url"`
-	Filename string   `json:"filename,omitempty"`
-	Path     string   `json:"path,omitempty"`
-	Mirrors  []string `json:"mirrors,omitempty"`
+	URL      string            `json:"url"`
+	Filename string            `json:"filename,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	Mirrors  []string          `json:"mirrors,omitempty"`
+	Resume   bool              `json:"resume,omitempty"`   // Continue an unfinished download of URL if there is one
+	Size     int64             `json:"size,omitempty"`     // Size the server must report, if known
+	Checksum string            `json:"checksum,omitempty"` // "type:hex" hash the completed file is checked against
+	Proxy    string            `json:"proxy,omitempty"`    // Proxy URL or "none" for this download, overriding settings and --proxy
+	Headers  map[string]string `json:"headers,omitempty"`  // Extra request headers, e.g. Authorization, sent with every request of the download
+	Cookies  []requestCookie   `json:"cookies,omitempty"`  // Cookies sent to the hosts their domain covers
+	Schedule string            `json:"schedule,omitempty"` // "HH:MM", "YYYY-MM-DD HH:MM" or a daily window "HH:MM-HH:MM"; see types.ParseSchedule
+	Priority string            `json:"priority,omitempty"` // "high", "normal" or "low": where the download waits in the queue
+
+	Signature string `json:"signature,omitempty"` // URL or absolute path of a detached OpenPGP signature of the file
+	Keyring   string `json:"keyring,omitempty"`   // Absolute path of the public keys the signature must be made with
+	Torrent   string `json:"torrent,omitempty"`   // URL or absolute path of the single-file .torrent whose piece hashes the file must match
+
+	ExpectHeaders map[string]string `json:"expect_headers,omitempty"` // Response headers the server must send, or the download fails before writing anything
+
+	OnComplete       string `json:"on_complete,omitempty"`        // Shell command run once the file is complete, see hooks.Command
+	Notify           bool   `json:"notify,omitempty"`             // Show a desktop notification when the download ends
+	ShutdownWhenDone bool   `json:"shutdown_when_done,omitempty"` // Power the machine off once nothing is left to download
+}
+
+// requestCookie is a cookie of a DownloadRequest. A Domain with a leading
+// "." covers subdomains too; Expires is in Unix seconds, 0 for none.
+type requestCookie struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Domain  string `json:"domain"`
+	Path    string `json:"path,omitempty"`
+	Secure  bool   `json:"secure,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
 }
 
 func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir string) {
@@ -444,6 +672,11 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 			return
 		}
 
+		if !canAccess(r, id) {
+			http.Error(w, "Download not found", http.StatusNotFound)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 
 		// 1. Check GlobalPool first (Active/Queued/Paused)
@@ -523,6 +756,52 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 		http.Error(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
+	if err := types.CheckProxy(req.Proxy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	headers, err := types.ParseHeaders(req.Headers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expectHeaders, err := types.ParseHeaders(req.ExpectHeaders)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cookies, err := parseRequestCookies(req.Cookies)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedule, err := types.ParseSchedule(req.Schedule, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	priority, err := types.ParsePriority(req.Priority)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (req.OnComplete != "" || req.ShutdownWhenDone) && !mayControlMachine(r) {
+		http.Error(w, "Forbidden: on_complete and shutdown_when_done are reserved for the server's own clients", http.StatusForbidden)
+		return
+	}
+	// A proxy of the caller's choosing would reach networks the server's
+	// policy keeps downloads out of
+	if req.Proxy != "" && !mayControlMachine(r) {
+		http.Error(w, "Forbidden: proxy is reserved for the server's own clients", http.StatusForbidden)
+		return
+	}
+	// Named users only name files in their own folder
+	if user := requestUser(r); user != nil && user.Name != "" {
+		if err := confineRequest(&req, userDir(user, defaultOutputDir, settings)); err != nil {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
 	// Absolute paths are allowed for local tool usage
 	// if filepath.IsAbs(req.Path) { ... }
 
@@ -533,8 +812,6 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 
 	utils.Debug("Received download request: URL=%s, Path=%s", req.URL, req.Path)
 
-	downloadID := uuid.New().String()
-
 	// Use the GlobalPool for both Headless and TUI modes (Unified Backend)
 	if GlobalPool == nil {
 		// Should not happen if initialized correctly
@@ -542,6 +819,56 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 		return
 	}
 
+	if len(req.Mirrors) == 0 && strings.Contains(req.URL, ",") {
+		req.URL, req.Mirrors = ParseURLArg(req.URL)
+	}
+
+	if req.Resume && !GlobalPool.Draining() {
+		if id, ok := resumeByURL(req.URL, ownedBy(r), mayControlMachine(r), settings); ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "resumed", "id": id})
+			return
+		}
+	}
+
+	runtime := convertRuntimeConfig(settings.ToRuntimeConfig()).WithProxy(cmp.Or(req.Proxy, GlobalPool.Proxy())).WithHeaders(headers).WithCookies(cookies)
+	// Only the server's own clients may log in to SFTP servers as its user
+	runtime.SSHUserKeys = mayControlMachine(r)
+	// Refuse a torrent the file could not be checked against before downloading it
+	if req.Torrent != "" {
+		if err := download.CheckTorrent(r.Context(), req.Torrent, runtime); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// Plugins go first so that they can take over hosts Surge resolves itself
+	res, err := plugins.ResolveURL(GlobalPool.Plugins(), req.URL, req.Mirrors, req.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	req.URL, req.Mirrors, req.Filename = res.URL, res.Mirrors, res.Filename
+
+	src, err := engine.ResolveSource(r.Context(), req.URL, req.Mirrors, req.Filename, runtime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	req.URL, req.Mirrors, req.Filename = src.URL, src.Mirrors, src.Filename
+	if req.Size == 0 {
+		req.Size = src.Size
+	}
+	if req.Torrent == "" {
+		req.Torrent = src.Torrent
+	}
+	cookies = append(cookies, src.Cookies...)
+
+	checkURLs := append([]string{req.URL}, req.Mirrors...)
+	if err := settings.CheckURL(checkURLs...); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	// Prepare output path
 	outPath := req.Path
 	if outPath == "" {
@@ -561,6 +888,47 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 	// Enforce absolute path to ensure resume works even if CWD changes
 	outPath = utils.EnsureAbsPath(outPath)
 
+	// The on_enqueue hook may turn the download down or choose where it goes
+	ev, err := hooks.Enqueue(settings.General.Hooks.OnEnqueue, hooks.Event{
+		URL: checkURLs[0], Mirrors: checkURLs[1:], Filename: req.Filename, Path: outPath,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	req.Filename, outPath = ev.Filename, ev.Path
+
+	downloadID := types.NewDownloadID()
+
+	if GlobalPool.Draining() {
+		http.Error(w, "Server is draining and not accepting downloads", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Tell feeders to back off rather than pile up downloads behind the workers
+	queued, queueLimit := GlobalPool.QueueLength(), GlobalPool.QueueLimit()
+	w.Header().Set(headerQueueLength, strconv.Itoa(queued))
+	w.Header().Set(headerQueueLimit, strconv.Itoa(queueLimit))
+	if queued >= queueLimit {
+		w.Header().Set("Retry-After", strconv.Itoa(int(queueFullRetryAfter.Seconds())))
+		http.Error(w, fmt.Sprintf("Queue full: %d downloads waiting for a worker", queued), http.StatusTooManyRequests)
+		return
+	}
+
+	// Named users own what they add and may be limited in how much they queue
+	if user := requestUser(r); user != nil && user.Name != "" {
+		quotaMu.Lock()
+		defer quotaMu.Unlock()
+		if user.MaxActive > 0 && unfinishedCount(ownedBy(r)) >= user.MaxActive {
+			http.Error(w, fmt.Sprintf("Quota exceeded: %s may have %d unfinished downloads", user.Name, user.MaxActive), http.StatusTooManyRequests)
+			return
+		}
+		if err := state.SetOwner(downloadID, user.Name); err != nil {
+			http.Error(w, "Failed to record download owner: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Check settings for extension prompt and duplicates
 	// settings already loaded above
 	if true {
@@ -609,7 +977,20 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 		ProgressCh: GlobalProgressCh, // Shared channel (headless consumer or TUI)
 		State:      types.NewProgressState(downloadID, 0),
 		// Runtime config loaded from settings
-		Runtime: convertRuntimeConfig(settings.ToRuntimeConfig()),
+		Runtime: runtime,
+
+		ExpectedSize:  req.Size,
+		ExpectHeaders: expectHeaders,
+		Checksum:      req.Checksum,
+		Signature:     req.Signature,
+		Keyring:       req.Keyring,
+		Torrent:       req.Torrent,
+		Proxy:         req.Proxy,
+		Headers:       headers,
+		Cookies:       cookies,
+		Schedule:      schedule,
+		Priority:      priority,
+		Actions:       types.PostActions{OnComplete: req.OnComplete, Notify: req.Notify, Shutdown: req.ShutdownWhenDone},
 	}
 
 	// Handle implicit mirrors in URL if not explicitly provided
@@ -626,6 +1007,15 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 	atomic.AddInt32(&activeDownloads, 1)
 
 	w.Header().Set("Content-Type", "application/json")
+	if !schedule.IsZero() {
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":   "scheduled",
+			"message":  "Download scheduled",
+			"id":       downloadID,
+			"start_at": schedule.Next(time.Now()).Format(time.RFC3339),
+		})
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "queued",
 		"message": "Download queued successfully",
@@ -634,23 +1024,28 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 }
 
 // processDownloads handles the logic of adding downloads either to local pool or remote server
+// opts are applied to every download added
 // Returns the number of successfully added downloads
-func processDownloads(urls []string, outputDir string, port int) int {
+func processDownloads(urls []string, outputDir string, opts downloadOptions, port int) int {
 	successCount := 0
 
 	// If port > 0, we are sending to a remote server
 	// If port > 0, we are sending to a remote server
 	if port > 0 {
 		for _, arg := range urls {
-			url, mirrors := ParseURLArg(arg)
-			if url == "" {
+			reqs, err := expandArg(arg)
+			if err != nil {
+				fmt.Printf("Error adding %s: %v\n", arg, err)
 				continue
 			}
-			err := sendToServer(url, mirrors, outputDir, port)
-			if err != nil {
-				fmt.Printf("Error adding %s: %v\n", url, err)
-			} else {
-				successCount++
+			for _, req := range reqs {
+				req.Path = outputDir
+				opts.apply(&req)
+				if err := sendRequestToServer(req, port); err != nil {
+					fmt.Printf("Error adding %s: %v\n", req.URL, err)
+				} else {
+					successCount++
+				}
 			}
 		}
 		return successCount
@@ -667,16 +1062,58 @@ func processDownloads(urls []string, outputDir string, port int) int {
 		settings = config.DefaultSettings()
 	}
 
+	var reqs []DownloadRequest
 	for _, arg := range urls {
 		// Validation
 		if arg == "" {
 			continue
 		}
+		expanded, err := expandArg(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", arg, err)
+			continue
+		}
+		reqs = append(reqs, expanded...)
+	}
 
-		url, mirrors := ParseURLArg(arg)
-		if url == "" {
+	headers, err := types.ParseHeaders(opts.Headers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 0
+	}
+	schedule, err := types.ParseSchedule(opts.Schedule, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 0
+	}
+	priority, err := types.ParsePriority(opts.Priority)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 0
+	}
+	runtime := convertRuntimeConfig(settings.ToRuntimeConfig()).WithProxy(cmp.Or(opts.Proxy, GlobalPool.Proxy())).WithHeaders(headers)
+	runtime.SSHUserKeys = true // Asked for by the user running surge
+	for _, req := range reqs {
+		cookies := opts.cookiesFor(req.URL, req.Mirrors)
+		runtime := runtime.WithCookies(cookies)
+		res, err := plugins.ResolveURL(GlobalPool.Plugins(), req.URL, req.Mirrors, req.Filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", req.URL, err)
+			continue
+		}
+		src, err := engine.ResolveSource(context.Background(), res.URL, res.Mirrors, res.Filename, runtime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", req.URL, err)
 			continue
 		}
+		url, mirrors, filename := src.URL, src.Mirrors, src.Filename
+		if req.Size == 0 {
+			req.Size = src.Size
+		}
+		if req.Torrent == "" {
+			req.Torrent = src.Torrent
+		}
+		cookies = append(cookies, src.Cookies...)
 
 		// Prepare output path
 		outPath := outputDir
@@ -690,11 +1127,24 @@ func processDownloads(urls []string, outputDir string, port int) int {
 		}
 		outPath = utils.EnsureAbsPath(outPath)
 
+		if err := settings.CheckURL(append([]string{url}, mirrors...)...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", url, err)
+			continue
+		}
+		ev, err := hooks.Enqueue(settings.General.Hooks.OnEnqueue, hooks.Event{
+			URL: url, Mirrors: mirrors, Filename: filename, Path: outPath,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", url, err)
+			continue
+		}
+		filename, outPath = ev.Filename, ev.Path
+
 		// Check for duplicates/extensions if we are in TUI mode (serverProgram != nil)
 		// For headless/root direct add, we might skip prompt or auto-approve?
 		// For now, let's just add directly if headless, or prompt if TUI is up.
 
-		downloadID := uuid.New().String()
+		downloadID := types.NewDownloadID()
 
 		// If TUI is up (serverProgram != nil), we might want to send a request msg?
 		// But processDownloads is called from QUEUE init routine, primarily for CLI args.
@@ -705,10 +1155,23 @@ func processDownloads(urls []string, outputDir string, port int) int {
 			Mirrors:    mirrors,
 			OutputPath: outPath,
 			ID:         downloadID,
+			Filename:   filename,
 			Verbose:    false,
 			ProgressCh: GlobalProgressCh,
 			State:      types.NewProgressState(downloadID, 0),
-			Runtime:    convertRuntimeConfig(settings.ToRuntimeConfig()),
+			Runtime:    runtime,
+
+			ExpectedSize: req.Size,
+			Checksum:     req.Checksum,
+			Signature:    req.Signature,
+			Keyring:      req.Keyring,
+			Torrent:      req.Torrent,
+			Proxy:        opts.Proxy,
+			Headers:      headers,
+			Cookies:      cookies,
+			Schedule:     schedule,
+			Priority:     priority,
+			Actions:      opts.Actions,
 		}
 
 		GlobalPool.Add(cfg)
@@ -727,13 +1190,37 @@ func Execute() {
 
 func init() {
 	rootCmd.Flags().StringP("batch", "b", "", "File containing URLs to download (one per line)")
+	rootCmd.Flags().BoolP("mirror", "m", false, "Treat the URLs as mirrors of one file and download from all of them")
 	rootCmd.Flags().IntP("port", "p", 0, "Port to listen on (default: 8080 or first available)")
 	rootCmd.Flags().StringP("output", "o", "", "Default output directory")
 	rootCmd.Flags().Bool("no-resume", false, "Do not auto-resume paused downloads on startup")
 	rootCmd.Flags().Bool("exit-when-done", false, "Exit when all downloads complete")
+	rootCmd.Flags().Bool("write-manifest", false, "Write a JSON hash manifest (<file>"+download.ManifestSuffix+") next to each completed download")
+	rootCmd.Flags().Bool("fix-extensions", false, "Rename completed downloads whose content shows a missing or wrong (.php, .html) extension, e.g. get.php to get.zip")
+	rootCmd.Flags().String("chmod", "", "Set permissions of completed files, in octal (e.g. 0644)")
+	rootCmd.Flags().String("chown", "", "When running as root, give completed files to user[:group] (names or IDs)")
+	rootCmd.Flags().String("concurrent", "", "Connections per host for every download of this run (1-64), or \"auto\" to tune them while downloading")
+	rootCmd.Flags().Int("max-active", 0, "Downloads to run at once (1-"+strconv.Itoa(download.MaxWorkers)+"), overriding max_concurrent_downloads for this run")
+	rootCmd.Flags().String("proxy", "", "Proxy for every download of this run: http://, https://, socks5:// or socks5h:// URL, or \"none\" (default from settings, else $HTTPS_PROXY/$HTTP_PROXY)")
+	rootCmd.Flags().String("socks5", "", "SOCKS5 proxy [user:password@]host:port for every download of this run")
+	addPostActionFlags(rootCmd, "every download of this run")
+	addAria2RPCFlags(rootCmd)
+	rootCmd.Flags().Bool("pprof", false, "Serve Go profiles at /debug/pprof/ and expvar at /debug/vars on the API port")
+	rootCmd.PersistentFlags().String("state-dir", "", "Directory for the download database (default $"+config.EnvStateDir+")")
+	rootCmd.PersistentFlags().String("cache-dir", "", "Directory for logs and runtime files (default $"+config.EnvCacheDir+", else --state-dir)")
 	rootCmd.SetVersionTemplate("Surge version {{.Version}}\n")
 }
 
+// applyDirFlags exports --state-dir and --cache-dir through the environment
+// variables the config package reads
+func applyDirFlags(cmd *cobra.Command) {
+	for flag, env := range map[string]string{"state-dir": config.EnvStateDir, "cache-dir": config.EnvCacheDir} {
+		if dir, _ := cmd.Flags().GetString(flag); dir != "" {
+			os.Setenv(env, utils.EnsureAbsPath(dir))
+		}
+	}
+}
+
 // initializeGlobalState sets up the environment and configures the engine state and logging
 func initializeGlobalState() {
 	stateDir := config.GetStateDir()
@@ -745,6 +1232,7 @@ func initializeGlobalState() {
 
 	// Config engine state
 	state.Configure(filepath.Join(stateDir, "surge.db"))
+	keyring.ConfigureFile(filepath.Join(stateDir, "secrets.enc"))
 
 	// Config logging
 	utils.ConfigureDebug(logsDir)
@@ -764,17 +1252,35 @@ func initializeGlobalState() {
 func convertRuntimeConfig(rc *config.RuntimeConfig) *types.RuntimeConfig {
 	return &types.RuntimeConfig{
 		MaxConnectionsPerHost: rc.MaxConnectionsPerHost,
+		AdaptiveConnections:   rc.AdaptiveConnections,
 		MaxGlobalConnections:  rc.MaxGlobalConnections,
 		UserAgent:             rc.UserAgent,
 		MinChunkSize:          rc.MinChunkSize,
 		MaxChunkSize:          rc.MaxChunkSize,
 		TargetChunkSize:       rc.TargetChunkSize,
 		WorkerBufferSize:      rc.WorkerBufferSize,
+		MaxBufferMemory:       rc.MaxBufferMemory,
 		MaxTaskRetries:        rc.MaxTaskRetries,
 		SlowWorkerThreshold:   rc.SlowWorkerThreshold,
 		SlowWorkerGracePeriod: rc.SlowWorkerGracePeriod,
 		StallTimeout:          rc.StallTimeout,
 		SpeedEmaAlpha:         rc.SpeedEmaAlpha,
+		RetryBaseDelay:        rc.RetryBaseDelay,
+		RetryMaxDelay:         rc.RetryMaxDelay,
+		RetryJitter:           rc.RetryJitter,
+		CheckpointInterval:    rc.CheckpointInterval,
+		PartFilesInSubdir:     rc.PartFilesInSubdir,
+		WriteStrategy:         rc.WriteStrategy,
+		SparseFiles:           rc.SparseFiles,
+		MaxFilenameLength:     rc.MaxFilenameLength,
+		FilenameTruncation:    rc.FilenameTruncation,
+		BlockPrivateNetworks:  rc.BlockPrivateNetworks,
+		AllowedNetworks:       rc.AllowedNetworks,
+		MaxRedirects:          rc.MaxRedirects,
+		Proxy:                 rc.Proxy,
+		SSHIdentityFile:       rc.SSHIdentityFile,
+		SSHKnownHosts:         rc.SSHKnownHosts,
+		Authorizer:            types.JoinAuthorizers(credentials.NewAuthorizer(rc.Credentials), oauth.NewAuthorizer(rc.OAuth)),
 	}
 }
 
@@ -796,43 +1302,105 @@ func resumePausedDownloads() {
 		if entry.Status == "paused" && !settings.General.AutoResume {
 			continue
 		}
-		// Load state to define progress state
-		s, err := state.LoadState(entry.URL, entry.DestPath)
-		if err != nil {
-			continue
-		}
+		// Downloads named users added may not log in as the local user
+		owner, _ := state.GetOwner(entry.ID)
+		resumeEntry(entry, owner == "", settings)
+	}
+}
 
-		// Reconstruct config
-		runtimeConfig := convertRuntimeConfig(settings.ToRuntimeConfig())
-		outputPath := filepath.Dir(entry.DestPath)
-		// If outputPath is empty or dot, use default
-		if outputPath == "" || outputPath == "." {
-			outputPath = settings.General.DefaultDownloadDir
+// resumeByURL continues the unfinished download of url that owned may see
+// (all when owned is nil): one paused in the pool, or one left in the
+// database by an earlier run or a crash. It returns the download's ID, or
+// false if there is nothing to continue. userKeys is as for resumeEntry.
+func resumeByURL(url string, owned func(string) bool, userKeys bool, settings *config.Settings) (string, bool) {
+	for _, cfg := range GlobalPool.GetAll() {
+		if cfg.URL == url && (owned == nil || owned(cfg.ID)) {
+			GlobalPool.Resume(cfg.ID) // No-op unless paused
+			return cfg.ID, true
 		}
+	}
 
-		id := entry.ID
-		if id == "" {
-			id = uuid.New().String()
+	entries, err := state.ListAllDownloads()
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if entry.URL != url || entry.Status == "completed" || (owned != nil && !owned(entry.ID)) {
+			continue
+		}
+		if resumeEntry(entry, userKeys, settings) {
+			return entry.ID, true
 		}
+	}
+	return "", false
+}
+
+// resumeEntry adds a download saved in the database back to the pool,
+// continuing from its saved state. It reports false if there is no state.
+// userKeys lets an sftp:// download log in as the local user, see
+// types.RuntimeConfig.SSHUserKeys.
+func resumeEntry(entry types.DownloadEntry, userKeys bool, settings *config.Settings) bool {
+	// Load state to define progress state
+	s, err := state.LoadState(entry.URL, entry.DestPath)
+	if err != nil {
+		return false
+	}
 
-		// Create progress state
-		progState := types.NewProgressState(id, s.TotalSize)
-		progState.Downloaded.Store(s.Downloaded)
+	// Reconstruct config
+	runtimeConfig := convertRuntimeConfig(settings.ToRuntimeConfig())
+	runtimeConfig.SSHUserKeys = userKeys
 
+	// Downloads saved by a drain before they started hold their output
+	// directory instead of a file, and start over as new downloads
+	if info, err := os.Stat(entry.DestPath); err == nil && info.IsDir() && entry.Status == "queued" {
 		cfg := types.DownloadConfig{
 			URL:        entry.URL,
-			OutputPath: outputPath,
-			DestPath:   entry.DestPath,
-			ID:         id,
+			OutputPath: entry.DestPath,
+			ID:         entry.ID,
 			Filename:   entry.Filename,
-			Verbose:    false,
-			IsResume:   true,
+			Mirrors:    entry.Mirrors,
 			ProgressCh: GlobalProgressCh,
-			State:      progState,
+			State:      types.NewProgressState(entry.ID, 0),
 			Runtime:    runtimeConfig,
+			Schedule:   download.SavedSchedule(entry.ID),
 		}
-
+		download.RestoreSettings(&cfg, s)
 		GlobalPool.Add(cfg)
 		atomic.AddInt32(&activeDownloads, 1)
+		return true
+	}
+
+	outputPath := filepath.Dir(entry.DestPath)
+	// If outputPath is empty or dot, use default
+	if outputPath == "" || outputPath == "." {
+		outputPath = settings.General.DefaultDownloadDir
+	}
+
+	id := entry.ID
+	if id == "" {
+		id = types.NewDownloadID()
+	}
+
+	// Create progress state
+	progState := types.NewProgressState(id, s.TotalSize)
+	progState.Downloaded.Store(s.Downloaded)
+
+	cfg := types.DownloadConfig{
+		URL:        entry.URL,
+		OutputPath: outputPath,
+		DestPath:   entry.DestPath,
+		ID:         id,
+		Filename:   entry.Filename,
+		Verbose:    false,
+		IsResume:   true,
+		ProgressCh: GlobalProgressCh,
+		State:      progState,
+		Runtime:    runtimeConfig,
+		Schedule:   download.SavedSchedule(id),
 	}
+	download.RestoreSettings(&cfg, s)
+
+	GlobalPool.Add(cfg)
+	atomic.AddInt32(&activeDownloads, 1)
+	return true
 }
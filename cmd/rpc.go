@@ -0,0 +1,312 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000 // The API refused the call; data.status has its HTTP status
+)
+
+// maxRPCBytes limits a JSON-RPC request sent over HTTP
+const maxRPCBytes = 1 << 20
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"` // Absent for notifications
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int            `json:"code"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// originContextKey carries the Origin of a JSON-RPC call made over HTTP to
+// the API requests it makes
+type originContextKey struct{}
+
+// rpcCall is the HTTP API request a JSON-RPC method stands for
+type rpcCall struct {
+	Method string // HTTP method
+	Path   string
+	ByID   bool     // Params are {"id": ...}, sent as the id query parameter
+	Query  []string // Further params of a ByID call, sent as query parameters
+	Body   bool     // Params are sent as the JSON request body
+}
+
+// rpcMethods maps JSON-RPC methods onto the HTTP API, so both share one
+// implementation of validation, ownership and queue limits
+var rpcMethods = map[string]rpcCall{
+	"add":        {Method: http.MethodPost, Path: "/download", Body: true},
+	"status":     {Method: http.MethodGet, Path: "/download", ByID: true},
+	"pause":      {Method: http.MethodPost, Path: "/pause", ByID: true},
+	"resume":     {Method: http.MethodPost, Path: "/resume", ByID: true},
+	"cancel":     {Method: http.MethodPost, Path: "/delete", ByID: true},
+	"move":       {Method: http.MethodPost, Path: "/queue/move", ByID: true, Query: []string{"to"}},
+	"move_file":  {Method: http.MethodPost, Path: "/move-file", ByID: true, Query: []string{"dir"}},
+	"list":       {Method: http.MethodGet, Path: "/list"},
+	"pause_all":  {Method: http.MethodPost, Path: "/pause-all"},
+	"resume_all": {Method: http.MethodPost, Path: "/resume-all"},
+}
+
+// handleRPCMessage answers one JSON-RPC message, a request or a batch of
+// them, by calling api. It returns nil when nothing is to be sent back,
+// as for notifications.
+func handleRPCMessage(ctx context.Context, api http.Handler, msg json.RawMessage) any {
+	msg = bytes.TrimSpace(msg)
+	if len(msg) == 0 || msg[0] != '[' {
+		if resp := handleRPCRequest(ctx, api, msg); resp != nil {
+			return resp
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(msg, &batch); err != nil {
+		return rpcFailure(nil, rpcParseError, "Parse error: "+err.Error())
+	}
+	if len(batch) == 0 {
+		return rpcFailure(nil, rpcInvalidRequest, "Invalid request: empty batch")
+	}
+	var responses []*rpcResponse
+	for _, raw := range batch {
+		if resp := handleRPCRequest(ctx, api, raw); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// handleRPCRequest answers a single JSON-RPC request, or returns nil for a
+// notification
+func handleRPCRequest(ctx context.Context, api http.Handler, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return rpcFailure(nil, rpcParseError, "Parse error: "+err.Error())
+		}
+		return rpcFailure(nil, rpcInvalidRequest, "Invalid request: "+err.Error())
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, rpcInvalidRequest, `Invalid request: expected "jsonrpc": "2.0" and a method`)
+	}
+
+	result, rpcErr := callRPC(ctx, api, req)
+	if req.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		return &rpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: code, Message: message}, ID: id}
+}
+
+// callRPC runs req as the HTTP API request it maps to and returns the
+// decoded response body
+func callRPC(ctx context.Context, api http.Handler, req rpcRequest) (any, *rpcError) {
+	call, ok := rpcMethods[req.Method]
+	if !ok {
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "Method not found: " + req.Method}
+	}
+
+	target := call.Path
+	var body io.Reader
+	switch {
+	case call.ByID:
+		var params map[string]json.RawMessage
+		var id string
+		if err := json.Unmarshal(req.Params, &params); err != nil || json.Unmarshal(params["id"], &id) != nil || id == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: `Invalid params: expected {"id": "..."}`}
+		}
+		query := url.Values{"id": {id}}
+		for _, name := range call.Query {
+			if raw, ok := params[name]; ok {
+				var value string
+				if json.Unmarshal(raw, &value) != nil {
+					value = string(raw) // A number
+				}
+				query.Set(name, value)
+			}
+		}
+		target += "?" + query.Encode()
+	case call.Body:
+		if len(req.Params) == 0 || req.Params[0] != '{' {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: expected an object"}
+		}
+		body = bytes.NewReader(req.Params)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, call.Method, target, body)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if origin, ok := ctx.Value(originContextKey{}).(string); ok {
+		httpReq.Header.Set("Origin", origin) // See mayControlMachine
+	}
+	rec := &rpcRecorder{header: make(http.Header)}
+	api.ServeHTTP(rec, httpReq)
+
+	if rec.status >= http.StatusBadRequest {
+		rpcErr := &rpcError{
+			Code:    rpcServerError,
+			Message: strings.TrimSpace(rec.body.String()),
+			Data:    map[string]any{"status": rec.status},
+		}
+		if secs, err := strconv.Atoi(rec.header.Get("Retry-After")); err == nil {
+			rpcErr.Data["retry_after"] = secs
+		}
+		return nil, rpcErr
+	}
+	result := bytes.TrimSpace(rec.body.Bytes())
+	if !json.Valid(result) {
+		return string(result), nil
+	}
+	return json.RawMessage(result), nil
+}
+
+// rpcRecorder collects the response of an HTTP API handler called for a
+// JSON-RPC request
+type rpcRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *rpcRecorder) Header() http.Header { return r.header }
+
+func (r *rpcRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *rpcRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// rpcHTTPHandler serves JSON-RPC over HTTP POST by calling api. Requests
+// keep the context of the HTTP request, and with it the authenticated user.
+func rpcHTTPHandler(api http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		msg, err := io.ReadAll(io.LimitReader(r.Body, maxRPCBytes))
+		if err != nil {
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
+		}
+		ctx := r.Context()
+		if origin := r.Header.Get("Origin"); origin != "" {
+			ctx = context.WithValue(ctx, originContextKey{}, origin)
+		}
+		resp := handleRPCMessage(ctx, api, msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// listenRPCSocket opens a unix socket at path that only the current user can
+// connect to, replacing a stale socket left by a crash
+func listenRPCSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serveRPC answers JSON-RPC messages on every connection accepted from ln
+// until it is closed. Messages are JSON values, one response is written per
+// line. Whoever can connect controls every download, like the --token user.
+func serveRPC(ln net.Listener, api http.Handler) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				utils.Debug("RPC socket error: %v", err)
+			}
+			return
+		}
+		go serveRPCConn(conn, api)
+	}
+}
+
+func serveRPCConn(conn net.Conn, api http.Handler) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err != io.EOF {
+				// The stream cannot be resynchronised after bad JSON
+				enc.Encode(rpcFailure(nil, rpcParseError, "Parse error: "+err.Error()))
+			}
+			return
+		}
+		if resp := handleRPCMessage(ctx, api, msg); resp != nil {
+			if err := enc.Encode(resp); err != nil {
+				return
+			}
+		}
+	}
+}
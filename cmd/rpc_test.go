@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+)
+
+func TestHandleRPCMessage(t *testing.T) {
+	api := http.NewServeMux()
+	api.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id": "a1"}]`))
+	})
+	api.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "paused", "id": r.URL.Query().Get("id")})
+	})
+	api.HandleFunc("/queue/move", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"id": r.URL.Query().Get("id"), "to": r.URL.Query().Get("to")})
+	})
+	api.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Download queue is full", http.StatusTooManyRequests)
+	})
+
+	call := func(msg string) string {
+		t.Helper()
+		resp := handleRPCMessage(context.Background(), api, json.RawMessage(msg))
+		if resp == nil {
+			return ""
+		}
+		out, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{"list", `{"jsonrpc": "2.0", "id": 1, "method": "list"}`,
+			`{"jsonrpc":"2.0","result":[{"id":"a1"}],"id":1}`},
+		{"by id", `{"jsonrpc": "2.0", "id": "x", "method": "pause", "params": {"id": "a1"}}`,
+			`{"jsonrpc":"2.0","result":{"id":"a1","status":"paused"},"id":"x"}`},
+		{"query params", `{"jsonrpc": "2.0", "id": 7, "method": "move", "params": {"id": "a1", "to": 2}}`,
+			`{"jsonrpc":"2.0","result":{"id":"a1","to":"2"},"id":7}`},
+		{"API error", `{"jsonrpc": "2.0", "id": 2, "method": "add", "params": {"url": "https://example.com/a"}}`,
+			`{"jsonrpc":"2.0","error":{"code":-32000,"message":"Download queue is full","data":{"retry_after":5,"status":429}},"id":2}`},
+		{"notification", `{"jsonrpc": "2.0", "method": "pause", "params": {"id": "a1"}}`, ``},
+		{"unknown method", `{"jsonrpc": "2.0", "id": 3, "method": "reboot"}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found: reboot"},"id":3}`},
+		{"missing id param", `{"jsonrpc": "2.0", "id": 4, "method": "resume", "params": {}}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: expected {\"id\": \"...\"}"},"id":4}`},
+		{"add without params", `{"jsonrpc": "2.0", "id": 5, "method": "add"}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: expected an object"},"id":5}`},
+		{"wrong version", `{"jsonrpc": "1.0", "id": 6, "method": "list"}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request: expected \"jsonrpc\": \"2.0\" and a method"},"id":6}`},
+		{"not an object", `42`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request: json: cannot unmarshal number into Go value of type cmd.rpcRequest"},"id":null}`},
+		{"bad JSON", `{"jsonrpc": "2.0",`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error: unexpected end of JSON input"},"id":null}`},
+		{"batch", `[{"jsonrpc": "2.0", "id": 1, "method": "list"}, {"jsonrpc": "2.0", "method": "list"}, {"jsonrpc": "2.0", "id": 2, "method": "nope"}]`,
+			`[{"jsonrpc":"2.0","result":[{"id":"a1"}],"id":1},{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found: nope"},"id":2}]`},
+		{"batch of notifications", `[{"jsonrpc": "2.0", "method": "list"}]`, ``},
+		{"empty batch", `[]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request: empty batch"},"id":null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := call(tt.msg); got != tt.want {
+				t.Errorf("handleRPCMessage(%s) =\n%s\nwant\n%s", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRPCHTTPHandler(t *testing.T) {
+	api := http.NewServeMux()
+	api.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	handler := rpcHTTPHandler(api)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+		return rec
+	}
+	if rec := post(`{"jsonrpc": "2.0", "id": 1, "method": "list"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"result":[]`) {
+		t.Errorf("call: got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(`{"jsonrpc": "2.0", "method": "list"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("notification: got %d, want 204", rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d, want 405", rec.Code)
+	}
+}
+
+func TestServeRPC_Socket(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	oldPool, oldCh := GlobalPool, GlobalProgressCh
+	progressCh := make(chan any, 100)
+	GlobalProgressCh = progressCh
+	GlobalPool = download.NewWorkerPool(progressCh, 1)
+	stop := discardProgress(progressCh)
+	defer func() {
+		stop()
+		GlobalPool, GlobalProgressCh = oldPool, oldCh
+	}()
+
+	// A socket left behind by a crashed daemon is replaced
+	socketPath := filepath.Join(tempDir, "surge.sock")
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenRPCSocket(socketPath)
+	if err != nil {
+		t.Fatalf("listenRPCSocket() failed: %v", err)
+	}
+	defer ln.Close()
+	if info, err := os.Stat(socketPath); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want 0600", info.Mode().Perm())
+	}
+	go serveRPC(ln, newAPIMux(0, tempDir))
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewScanner(conn)
+
+	// Several messages on one connection, each answered on its own line
+	conn.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "list"}
+{"jsonrpc": "2.0", "method": "list"}
+{"jsonrpc": "2.0", "id": 2, "method": "status", "params": {"id": "nope"}}
+`))
+	for _, want := range []string{
+		`{"jsonrpc":"2.0","result":null,"id":1}`, // /list sends null when empty
+		`{"jsonrpc":"2.0","error":{"code":-32000,"message":"Download not found","data":{"status":404}},"id":2}`,
+	} {
+		if !lines.Scan() {
+			t.Fatalf("no response: %v", lines.Err())
+		}
+		if got := lines.Text(); got != want {
+			t.Errorf("response = %s, want %s", got, want)
+		}
+	}
+
+	// Broken JSON ends the connection with a parse error
+	conn.Write([]byte("{oops\n"))
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"code":-32700`) {
+		t.Errorf("bad JSON: got %q, want a parse error", lines.Text())
+	}
+	if lines.Scan() {
+		t.Errorf("connection stayed open after a parse error: %q", lines.Text())
+	}
+}
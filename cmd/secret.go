@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/keyring"
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Keep proxy passwords and tokens in the OS keyring",
+	Long: `Store secrets in the OS keyring so that settings.json can refer to them by
+name instead of holding them in plain text. A value of "keyring:<name>" is
+replaced by the secret when it is used, in:
+
+  connections.proxy                   the whole proxy URL, with its password
+  connections.credentials[].password  per-host basic authentication
+  connections.credentials[].token     per-host bearer tokens
+  connections.oauth[].client_secret
+
+--proxy accepts a reference too. Where there is no keyring, secrets go to an
+encrypted file in the state directory if SURGE_KEYRING_PASSPHRASE is set.`,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Store a secret, read from the terminal or stdin",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		secret, err := readSecret(args[0])
+		if err == nil && secret == "" {
+			err = fmt.Errorf("empty secret")
+		}
+		if err == nil {
+			err = keyring.Set(args[0], secret)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Stored %s; refer to it as %q.\n", args[0], keyring.RefPrefix+args[0])
+	},
+}
+
+var secretDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Remove a secret from the keyring",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		if err := keyring.Delete(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted %s.\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(secretCmd)
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretDeleteCmd)
+}
+
+// readSecret prompts for the secret without echoing it, or reads it from
+// stdin when that is not a terminal
+func readSecret(name string) (string, error) {
+	if !isInteractive() {
+		data, err := io.ReadAll(os.Stdin)
+		return strings.TrimRight(string(data), "\r\n"), err
+	}
+	fmt.Fprintf(os.Stderr, "Secret for %s: ", name)
+	data, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return string(data), err
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/signal"
@@ -13,6 +14,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/plugins"
 )
 
 var serverCmd = &cobra.Command{
@@ -24,38 +27,57 @@ var serverCmd = &cobra.Command{
 var serverStartCmd = &cobra.Command{
 	Use:   "start [url]...",
 	Short: "Start the Surge server in headless mode",
-	Run: func(cmd *cobra.Command, args []string) {
-		initializeGlobalState()
+	Run:   runServer,
+}
 
-		// Attempt to acquire lock
-		isMaster, err := AcquireLock()
-		if err != nil {
-			fmt.Printf("Error acquiring lock: %v\n", err)
-			os.Exit(1)
-		}
+// runServer runs the download engine headlessly behind the HTTP API until
+// it is stopped or drained
+func runServer(cmd *cobra.Command, args []string) {
+	initializeGlobalState()
+	args = mirrorArgs(cmd, args)
 
-		if !isMaster {
-			fmt.Fprintln(os.Stderr, "Error: Surge server is already running.")
-			os.Exit(1)
-		}
-		defer ReleaseLock()
-
-		portFlag, _ := cmd.Flags().GetInt("port")
-		batchFile, _ := cmd.Flags().GetString("batch")
-		outputDir, _ := cmd.Flags().GetString("output")
-		exitWhenDone, _ := cmd.Flags().GetBool("exit-when-done")
-		noResume, _ := cmd.Flags().GetBool("no-resume")
-
-		// Save current PID to file
-		savePID()
-		defer removePID()
-
-		// Determine Port
-		// Determine Port
-		// Logic moved to startServerLogic, or we need to pass flags.
-		// Use startServerLogic
-		startServerLogic(cmd, args, portFlag, batchFile, outputDir, exitWhenDone, noResume)
-	},
+	// Attempt to acquire lock
+	isMaster, err := AcquireLock()
+	if err != nil {
+		fmt.Printf("Error acquiring lock: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !isMaster {
+		fmt.Fprintln(os.Stderr, "Error: Surge server is already running.")
+		os.Exit(1)
+	}
+	defer ReleaseLock()
+
+	portFlag, _ := cmd.Flags().GetInt("port")
+	batchFile, _ := cmd.Flags().GetString("batch")
+	outputDir, _ := cmd.Flags().GetString("output")
+	exitWhenDone, _ := cmd.Flags().GetBool("exit-when-done")
+	noResume, _ := cmd.Flags().GetBool("no-resume")
+	if err := applyCompletedFileFlags(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := applyConcurrencyFlag(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := applyMaxActiveFlag(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := applyProxyFlag(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	applyPostActionFlags(cmd)
+	GlobalPool.SetPlugins(plugins.Discover(config.GetPluginsDir()))
+
+	// Save current PID to file
+	savePID()
+	defer removePID()
+
+	startServerLogic(cmd, args, portFlag, batchFile, outputDir, exitWhenDone, noResume)
 }
 
 var serverStopCmd = &cobra.Command{
@@ -121,26 +143,54 @@ func init() {
 	serverCmd.AddCommand(serverStopCmd)
 	serverCmd.AddCommand(serverStatusCmd)
 
-	serverStartCmd.Flags().StringP("batch", "b", "", "File containing URLs to download")
-	serverStartCmd.Flags().IntP("port", "p", 0, "Port to listen on")
-	serverStartCmd.Flags().StringP("output", "o", "", "Default output directory")
-	serverStartCmd.Flags().Bool("exit-when-done", false, "Exit when all downloads complete")
-	serverStartCmd.Flags().Bool("no-resume", false, "Do not auto-resume paused downloads on startup")
+	addServerFlags(serverStartCmd)
+}
+
+// addServerFlags registers the flags of a headless server on cmd
+func addServerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("batch", "b", "", "File containing URLs to download")
+	cmd.Flags().BoolP("mirror", "m", false, "Treat the URLs as mirrors of one file and download from all of them")
+	cmd.Flags().IntP("port", "p", 0, "Port to listen on")
+	cmd.Flags().StringP("output", "o", "", "Default output directory")
+	cmd.Flags().Bool("exit-when-done", false, "Exit when all downloads complete")
+	cmd.Flags().Bool("no-resume", false, "Do not auto-resume paused downloads on startup")
+	cmd.Flags().Bool("write-manifest", false, "Write a JSON hash manifest (<file>"+download.ManifestSuffix+") next to each completed download")
+	cmd.Flags().Bool("fix-extensions", false, "Rename completed downloads whose content shows a missing or wrong (.php, .html) extension, e.g. get.php to get.zip")
+	cmd.Flags().String("chmod", "", "Set permissions of completed files, in octal (e.g. 0644)")
+	cmd.Flags().Int("progress-fd", 0, "Write JSON-lines progress events to this inherited file descriptor (e.g. 3)")
+	cmd.Flags().Duration("progress-interval", defaultProgressInterval, "How often to redraw the progress line on a terminal (0 to disable)")
+	cmd.Flags().Bool("report", false, "After each download, print what every connection fetched and whether more connections helped")
+	cmd.Flags().String("chown", "", "When running as root, give completed files to user[:group] (names or IDs)")
+	cmd.Flags().Int("max-queued", 0, "Answer 429 to new downloads once this many are waiting for a worker (default and maximum "+strconv.Itoa(download.QueueCapacity)+")")
+	cmd.Flags().String("bind", "127.0.0.1", "Address to listen on; other than loopback requires --token or --tls-client-ca")
+	cmd.Flags().String("token", "", "Require this bearer token for API requests (default $"+envToken+")")
+	cmd.Flags().String("watch-token", "", "Read-only bearer token that can only list downloads, for 'surge tui --watch' (default $"+envWatchToken+", else random)")
+	cmd.Flags().String("users-file", "", "Accept the tokens in this file (\"name token [max-active]\" per line); each user only sees its own downloads")
+	cmd.Flags().String("tls-cert", "", "Serve the API over HTTPS with this certificate (PEM)")
+	cmd.Flags().String("tls-key", "", "Private key for --tls-cert (PEM)")
+	cmd.Flags().String("tls-client-ca", "", "Require client certificates signed by this CA bundle (mTLS)")
+	cmd.Flags().String("concurrent", "", "Connections per host for every download of this run (1-64), or \"auto\" to tune them while downloading")
+	cmd.Flags().Int("max-active", 0, "Downloads to run at once (1-"+strconv.Itoa(download.MaxWorkers)+"), overriding max_concurrent_downloads for this run")
+	cmd.Flags().String("proxy", "", "Proxy for every download of this run: http://, https://, socks5:// or socks5h:// URL, or \"none\" (default from settings, else $HTTPS_PROXY/$HTTP_PROXY)")
+	cmd.Flags().String("socks5", "", "SOCKS5 proxy [user:password@]host:port for every download of this run")
+	addPostActionFlags(cmd, "every download of this run")
+	addAria2RPCFlags(cmd)
+	cmd.Flags().Bool("pprof", false, "Serve Go profiles at /debug/pprof/ and expvar at /debug/vars on the API port")
 }
 
 func savePID() {
 	pid := os.Getpid()
-	pidFile := filepath.Join(config.GetSurgeDir(), "pid")
+	pidFile := filepath.Join(config.GetCacheDir(), "pid")
 	os.WriteFile(pidFile, []byte(fmt.Sprintf("%d", pid)), 0644)
 }
 
 func removePID() {
-	pidFile := filepath.Join(config.GetSurgeDir(), "pid")
+	pidFile := filepath.Join(config.GetCacheDir(), "pid")
 	os.Remove(pidFile)
 }
 
 func readPID() int {
-	pidFile := filepath.Join(config.GetSurgeDir(), "pid")
+	pidFile := filepath.Join(config.GetCacheDir(), "pid")
 	data, err := os.ReadFile(pidFile)
 	if err != nil {
 		return 0
@@ -150,29 +200,50 @@ func readPID() int {
 }
 
 func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile string, outputDir string, exitWhenDone bool, noResume bool) {
-	var port int
-	var listener net.Listener
-
-	if portFlag > 0 {
-		port = portFlag
-		var err error
-		listener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: could not bind to port %d: %v\n", port, err)
-			os.Exit(1)
-		}
-	} else {
-		port, listener = findAvailablePort(8080)
-		if listener == nil {
-			fmt.Fprintf(os.Stderr, "Error: could not find available port\n")
-			os.Exit(1)
-		}
+	security, err := serverSecurityFromFlags(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	serveProfiling, _ = cmd.Flags().GetBool("pprof")
+	showAccelerationReport, _ = cmd.Flags().GetBool("report")
+	if maxQueued, _ := cmd.Flags().GetInt("max-queued"); maxQueued > 0 {
+		GlobalPool.SetMaxQueued(maxQueued)
+	}
+	port, listener, err := security.listen(portFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
 	saveActivePort(port)
 	defer removeActivePort()
+	saveActiveToken(security.Token)
+	saveWatchToken(security.WatchToken)
+	defer removeActiveToken()
+
+	drainRequests = make(chan drainRequest, 1)
+	go startHTTPServer(listener, port, outputDir, security.apiUsers())
+	if err := startAria2RPC(cmd, port, outputDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	go startHTTPServer(listener, port, outputDir)
+	// Only `surge daemon` has a control socket
+	var socketListener net.Listener
+	if flag := cmd.Flags().Lookup("socket"); flag != nil {
+		socketPath := flag.Value.String()
+		if socketPath == "" {
+			socketPath = defaultSocketPath()
+		}
+		socketListener, err = listenRPCSocket(socketPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not open control socket: %v\n", err)
+			os.Exit(1)
+		}
+		defer socketListener.Close()
+		go serveRPC(socketListener, newAPIMux(port, outputDir))
+	}
 
 	// Queue initial downloads
 	go func() {
@@ -189,15 +260,28 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 		}
 
 		if len(urls) > 0 {
-			processDownloads(urls, outputDir, 0)
+			processDownloads(urls, outputDir, downloadOptions{}, 0)
 		}
 	}()
 
 	fmt.Printf("Surge %s running in server mode.\n", Version)
-	fmt.Printf("HTTP server listening on port %d\n", port)
+	fmt.Printf("HTTP server listening on %s\n", listener.Addr())
+	if socketListener != nil {
+		fmt.Printf("JSON-RPC control socket at %s\n", socketListener.Addr())
+	}
 	fmt.Println("Press Ctrl+C to exit.")
 
-	StartHeadlessConsumer()
+	progressInterval, _ := cmd.Flags().GetDuration("progress-interval")
+	var eventOut io.Writer
+	if fd, _ := cmd.Flags().GetInt("progress-fd"); fd > 0 {
+		f, err := openProgressFD(fd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		eventOut = f
+	}
+	StartHeadlessConsumer(progressInterval, eventOut)
 
 	// Auto-resume paused downloads (unless --no-resume)
 	if !noResume {
@@ -217,6 +301,7 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 						// Manual cleanup
 						removePID()
 						removeActivePort()
+						removeActiveToken()
 						os.Exit(0)
 					}
 				}
@@ -226,10 +311,16 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
 
-	fmt.Println("\nShutting down...")
-	if GlobalPool != nil {
-		GlobalPool.GracefulShutdown()
+	// Both ways out save queued downloads for the next start; a signal pauses
+	// running ones at once, a drain lets them finish first
+	select {
+	case <-sigChan:
+		fmt.Println("\nShutting down...")
+		drainPool(drainRequest{Pause: true}, nil)
+	case req := <-drainRequests:
+		fmt.Println("Draining: no longer accepting downloads. Press Ctrl+C to pause running ones and exit.")
+		drainPool(req, sigChan)
+		fmt.Println("Drained. Exiting...")
 	}
 }
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// needsSetup reports whether this is a first run: no settings file has been written yet
+func needsSetup() bool {
+	_, err := os.Stat(config.GetSettingsPath())
+	return os.IsNotExist(err)
+}
+
+// isInteractive reports whether stdin is a terminal, so prompting makes sense
+func isInteractive() bool {
+	return isTerminal(os.Stdin)
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// maybeRunSetupWizard runs the first-run wizard when there is no settings file
+// and a user at the terminal to answer it. Failures fall back to defaults.
+func maybeRunSetupWizard() {
+	if !needsSetup() || !isInteractive() {
+		return
+	}
+
+	settings, err := runSetupWizard(os.Stdin, os.Stdout, config.DefaultSettings())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Setup skipped: %v\n", err)
+		return
+	}
+	if err := config.SaveSettings(settings); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving settings: %v\n", err)
+		return
+	}
+	fmt.Printf("Settings saved to %s\n\n", config.GetSettingsPath())
+}
+
+// runSetupWizard asks for the settings new users most often need to change,
+// offering the current value of each as the default. An empty answer keeps it.
+func runSetupWizard(in io.Reader, out io.Writer, settings *config.Settings) (*config.Settings, error) {
+	reader := bufio.NewReader(in)
+
+	fmt.Fprintln(out, "Welcome to Surge! Let's set a few things up (press Enter to keep the default).")
+	fmt.Fprintln(out, "You can change these later in Settings (s) or in "+config.GetSettingsPath())
+	fmt.Fprintln(out)
+
+	// Download directory
+	dir, err := prompt(reader, out, "Download directory", settings.General.DefaultDownloadDir)
+	if err != nil {
+		return nil, err
+	}
+	dir = expandHome(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+	settings.General.DefaultDownloadDir = utils.EnsureAbsPath(dir)
+
+	// Concurrent downloads
+	for {
+		answer, err := prompt(reader, out, "Max concurrent downloads (1-"+strconv.Itoa(download.MaxWorkers)+")", strconv.Itoa(settings.General.MaxConcurrentDownloads))
+		if err != nil {
+			return nil, err
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= download.MaxWorkers {
+			settings.General.MaxConcurrentDownloads = n
+			break
+		}
+		fmt.Fprintf(out, "  Please enter a number from 1 to %d.\n", download.MaxWorkers)
+	}
+
+	// Bandwidth cap
+	limit := "none"
+	if rate := settings.Connections.SpeedLimitRate(); rate > 0 {
+		limit = utils.ConvertBytesToHumanReadable(rate) + "/s"
+	}
+	for {
+		answer, err := prompt(reader, out, "Bandwidth cap, e.g. 2MB/s (none for no cap)", limit)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(answer, "none") {
+			answer = "0"
+		}
+		if rate, parseErr := utils.ParseRate(answer); parseErr == nil {
+			settings.Connections.SpeedLimit = int((rate + 1023) / 1024) // Whole KB/s
+			break
+		}
+		fmt.Fprintln(out, "  Please enter a speed such as 500KB/s or 2MB/s, or none.")
+	}
+
+	// Theme
+	themes := []string{"adaptive", "light", "dark"}
+	for {
+		answer, err := prompt(reader, out, "Theme (adaptive/light/dark)", themes[settings.General.Theme])
+		if err != nil {
+			return nil, err
+		}
+		theme := -1
+		for i, name := range themes {
+			if strings.EqualFold(answer, name) {
+				theme = i
+			}
+		}
+		if theme >= 0 {
+			settings.General.Theme = theme
+			break
+		}
+		fmt.Fprintln(out, "  Please choose adaptive, light or dark.")
+	}
+
+	fmt.Fprintln(out)
+	return settings, nil
+}
+
+// prompt prints a question with its default and returns the trimmed answer,
+// or the default if the answer is empty
+func prompt(r *bufio.Reader, out io.Writer, question, def string) (string, error) {
+	fmt.Fprintf(out, "%s [%s]: ", question, def)
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
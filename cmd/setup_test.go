@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+func TestRunSetupWizard(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "downloads")
+	// Directory, a bad then a good download count, a bad then a good cap, theme
+	answers := strings.Join([]string{dir, "40", "3", "fast", "2MB/s", "dark"}, "\n") + "\n"
+
+	settings, err := runSetupWizard(strings.NewReader(answers), io.Discard, config.DefaultSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.General.DefaultDownloadDir != dir {
+		t.Errorf("DefaultDownloadDir = %q, want %q", settings.General.DefaultDownloadDir, dir)
+	}
+	if settings.General.MaxConcurrentDownloads != 3 {
+		t.Errorf("MaxConcurrentDownloads = %d, want 3", settings.General.MaxConcurrentDownloads)
+	}
+	if settings.Connections.SpeedLimit != 2048 {
+		t.Errorf("SpeedLimit = %d KB/s, want 2048", settings.Connections.SpeedLimit)
+	}
+	if settings.General.Theme != 2 {
+		t.Errorf("Theme = %d, want 2 (dark)", settings.General.Theme)
+	}
+
+	// Enter keeps every default, and none keeps no cap
+	settings, err = runSetupWizard(strings.NewReader(dir+"\n\nnone\n\n"), io.Discard, config.DefaultSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Connections.SpeedLimit != 0 {
+		t.Errorf("SpeedLimit = %d, want no cap", settings.Connections.SpeedLimit)
+	}
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Limits for walking a sitemap and the indexes it points to
+const (
+	maxSitemapBytes = 50 << 20 // The sitemap protocol's limit for one uncompressed file
+	maxSitemaps     = 1000     // Sitemap files fetched in one run, across nested indexes
+)
+
+// lastModLayouts are the W3C datetime forms sitemaps use for <lastmod>
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+var sitemapCmd = &cobra.Command{
+	Use:   "sitemap <sitemap-url>",
+	Short: "List or download the pages and files in a sitemap",
+	Long: `Fetch a sitemap.xml, following sitemap indexes and gzipped sitemaps, and
+extract the URLs it lists.
+
+URLs are printed one per line, ready for 'surge add --batch'. With --add
+they are queued on the running Surge instance instead. --pattern filters
+URLs by file name, e.g. --pattern "*.pdf". --since and --until keep URLs
+whose <lastmod> falls in that range; URLs without a <lastmod> are left out
+when either is given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		patterns, _ := cmd.Flags().GetStringSlice("pattern")
+		add, _ := cmd.Flags().GetBool("add")
+		output, _ := cmd.Flags().GetString("output")
+		filter := sitemapFilter{Patterns: patterns}
+		var err error
+		if filter.Since, err = parseDateFlag(cmd, "since"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if filter.Until, err = parseDateFlag(cmd, "until"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var port int
+		if add {
+			if port = readActivePort(); port == 0 {
+				fmt.Println("Error: Surge is not running.")
+				fmt.Println("Start it with 'surge' or 'surge server start', or omit --add to print the URLs.")
+				os.Exit(1)
+			}
+		}
+
+		links, err := collectSitemap(args[0], filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(links) == 0 {
+			fmt.Fprintln(os.Stderr, "No matching URLs found.")
+			os.Exit(1)
+		}
+
+		if !add {
+			for _, link := range links {
+				fmt.Println(link)
+			}
+			return
+		}
+		addLinks(links, output, port)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sitemapCmd)
+	sitemapCmd.Flags().StringSliceP("pattern", "p", nil, `Only keep URLs whose file name matches this glob, e.g. "*.pdf" (repeatable)`)
+	sitemapCmd.Flags().String("since", "", "Only keep URLs modified on or after this date (YYYY-MM-DD or RFC 3339)")
+	sitemapCmd.Flags().String("until", "", "Only keep URLs modified on or before this date (YYYY-MM-DD or RFC 3339)")
+	sitemapCmd.Flags().BoolP("add", "a", false, "Add the URLs to the running Surge instance instead of printing them")
+	sitemapCmd.Flags().StringP("output", "o", "", "Output directory for added downloads")
+}
+
+// sitemapDoc is a <urlset> or a <sitemapindex>
+type sitemapDoc struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapFilter selects the URLs of a sitemap. Zero Since and Until do not
+// filter by date.
+type sitemapFilter struct {
+	Patterns []string
+	Since    time.Time
+	Until    time.Time
+}
+
+// keepURL reports whether a <url> entry for link modified at lastMod passes
+// the filter. Undated entries are dropped once a date range is set.
+func (f sitemapFilter) keepURL(link *url.URL, lastMod string) bool {
+	if !matchesFilePattern(link, f.Patterns) {
+		return false
+	}
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	t, ok := parseLastMod(lastMod)
+	if !ok {
+		return false
+	}
+	return (f.Since.IsZero() || !t.Before(f.Since)) && (f.Until.IsZero() || !t.After(f.Until))
+}
+
+// keepSitemap reports whether a sitemap listed in an index modified at
+// lastMod can hold URLs passing the filter. Only Since rules one out: a
+// sitemap changed after Until may still list older URLs.
+func (f sitemapFilter) keepSitemap(lastMod string) bool {
+	if f.Since.IsZero() {
+		return true
+	}
+	t, ok := parseLastMod(lastMod)
+	return !ok || !t.Before(f.Since)
+}
+
+// parseLastMod parses a <lastmod> value
+func parseLastMod(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseDateFlag parses a --since or --until flag; an unset flag is the zero time
+func parseDateFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s date %q: use YYYY-MM-DD or RFC 3339", name, value)
+	}
+	if name == "until" {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond) // The whole day counts
+	}
+	return t, nil
+}
+
+// collectSitemap returns the URLs listed in the sitemap at sitemapURL and in
+// the sitemaps its indexes point to that pass filter, without duplicates and
+// in sitemap order. Only the first sitemap failing is an error; nested ones
+// that fail are reported and skipped.
+func collectSitemap(sitemapURL string, filter sitemapFilter) ([]string, error) {
+	queue := []string{sitemapURL}
+	visited := map[string]bool{sitemapURL: true}
+	seen := make(map[string]bool)
+	var links []string
+	for fetched := 0; len(queue) > 0; fetched++ {
+		if fetched == maxSitemaps {
+			fmt.Fprintf(os.Stderr, "Warning: stopped after %d sitemaps, %d not fetched\n", maxSitemaps, len(queue))
+			break
+		}
+		current := queue[0]
+		queue = queue[1:]
+
+		base, doc, err := fetchSitemap(current)
+		if err != nil {
+			if current == sitemapURL {
+				return nil, err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", current, err)
+			continue
+		}
+		for _, entry := range doc.Sitemaps {
+			link, ok := resolveSitemapLoc(base, entry.Loc)
+			if !ok || visited[link.String()] || !filter.keepSitemap(entry.LastMod) {
+				continue
+			}
+			visited[link.String()] = true
+			queue = append(queue, link.String())
+		}
+		for _, entry := range doc.URLs {
+			link, ok := resolveSitemapLoc(base, entry.Loc)
+			if !ok || seen[link.String()] || !filter.keepURL(link, entry.LastMod) {
+				continue
+			}
+			seen[link.String()] = true
+			links = append(links, link.String())
+		}
+	}
+	return links, nil
+}
+
+// fetchSitemap downloads and parses one sitemap, gzipped or not, and
+// returns the URL it was served from with it
+func fetchSitemap(sitemapURL string) (*url.URL, *sitemapDoc, error) {
+	final, body, err := fetchPage(sitemapURL, maxSitemapBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	// sitemap.xml.gz is usually served as a gzip file, not gzip-encoded
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzipped sitemap: %w", err)
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, maxSitemapBytes))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzipped sitemap: %w", err)
+		}
+	}
+
+	var doc sitemapDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid sitemap: %w", err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, nil, errors.New("not a sitemap: expected <urlset> or <sitemapindex>")
+	}
+	return final, &doc, nil
+}
+
+// resolveSitemapLoc resolves a <loc> against the sitemap's URL, keeping only
+// http and https links
+func resolveSitemapLoc(base *url.URL, loc string) (*url.URL, bool) {
+	ref, err := url.Parse(strings.TrimSpace(loc))
+	if err != nil {
+		return nil, false
+	}
+	link := base.ResolveReference(ref)
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return nil, false
+	}
+	link.Fragment = ""
+	return link, true
+}
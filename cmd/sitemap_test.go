@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSitemapFilter(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	link, _ := url.Parse("https://example.com/docs/guide.pdf")
+
+	tests := []struct {
+		name    string
+		filter  sitemapFilter
+		lastMod string
+		want    bool
+	}{
+		{"no filter", sitemapFilter{}, "", true},
+		{"pattern match", sitemapFilter{Patterns: []string{"*.pdf"}}, "", true},
+		{"pattern miss", sitemapFilter{Patterns: []string{"*.mp4"}}, "", false},
+		{"date in range", sitemapFilter{Since: since, Until: until}, "2024-04-15", true},
+		{"full timestamp", sitemapFilter{Since: since}, " 2024-03-01T09:30:00+02:00 ", true},
+		{"minutes only", sitemapFilter{Since: since}, "2024-03-02T10:00Z", true},
+		{"before since", sitemapFilter{Since: since}, "2024-02-29", false},
+		{"after until", sitemapFilter{Until: until}, "2024-07", false},
+		{"undated with range", sitemapFilter{Since: since}, "", false},
+		{"unparseable with range", sitemapFilter{Since: since}, "yesterday", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.keepURL(link, tt.lastMod); got != tt.want {
+				t.Errorf("keepURL(%q) = %v, want %v", tt.lastMod, got, tt.want)
+			}
+		})
+	}
+
+	// Child sitemaps are only skipped when known to be older than --since
+	f := sitemapFilter{Since: since, Until: until}
+	if f.keepSitemap("2024-01-01") || !f.keepSitemap("") || !f.keepSitemap("2025-01-01") {
+		t.Error("keepSitemap() should skip only sitemaps last modified before Since")
+	}
+}
+
+func TestCollectSitemap(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>/files/report.pdf</loc><lastmod>2024-05-01</lastmod></url>
+  <url><loc>https://cdn.example.com/talk.mp4</loc><lastmod>2024-05-02</lastmod></url>
+</urlset>`))
+	zw.Close()
+
+	var stale bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>/pages.xml</loc></sitemap>
+  <sitemap><loc>/files.xml.gz</loc><lastmod>2024-05-02</lastmod></sitemap>
+  <sitemap><loc>/archive.xml</loc><lastmod>2019-01-01</lastmod></sitemap>
+  <sitemap><loc>/missing.xml</loc></sitemap>
+  <sitemap><loc>/sitemap.xml</loc></sitemap>
+</sitemapindex>`))
+	})
+	mux.HandleFunc("/pages.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>
+    https://example.com/about/
+  </loc><lastmod>2024-04-01T08:00:00Z</lastmod></url>
+  <url><loc>https://example.com/old.pdf</loc><lastmod>2020-01-01</lastmod></url>
+  <url><loc>https://example.com/undated.pdf</loc></url>
+  <url><loc>https://example.com/about/</loc><lastmod>2024-04-01</lastmod></url>
+</urlset>`))
+	})
+	mux.HandleFunc("/files.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-gzip")
+		w.Write(gzipped.Bytes())
+	})
+	mux.HandleFunc("/archive.xml", func(w http.ResponseWriter, r *http.Request) {
+		stale = true
+		w.Write([]byte(`<urlset><url><loc>https://example.com/ancient.pdf</loc></url></urlset>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Nested sitemaps are followed; a broken one is skipped and the loop back
+	// to the index is not
+	links, err := collectSitemap(server.URL+"/sitemap.xml", sitemapFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://example.com/about/",
+		"https://example.com/old.pdf",
+		"https://example.com/undated.pdf",
+		server.URL + "/files/report.pdf",
+		"https://cdn.example.com/talk.mp4",
+		"https://example.com/ancient.pdf",
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("collectSitemap() =\n%v\nwant\n%v", links, want)
+	}
+
+	stale = false
+	links, err = collectSitemap(server.URL+"/sitemap.xml", sitemapFilter{
+		Patterns: []string{"*.pdf"},
+		Since:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{server.URL + "/files/report.pdf"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("filtered collectSitemap() = %v, want %v", links, want)
+	}
+	if stale {
+		t.Error("a sitemap last modified before --since should not be fetched")
+	}
+
+	if _, err := collectSitemap(server.URL+"/missing.xml", sitemapFilter{}); err == nil {
+		t.Error("collectSitemap() of a missing sitemap should fail")
+	}
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>not a sitemap</body></html>`))
+	})
+	if _, err := collectSitemap(server.URL+"/page.html", sitemapFilter{}); err == nil {
+		t.Error("collectSitemap() of an HTML page should fail")
+	}
+}
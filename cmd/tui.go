@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/tui"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Watch a running server in a read-only dashboard",
+	Long: `Attach a dashboard to a running Surge, local or named by SURGE_HOST.
+
+With --watch the dashboard only lists downloads, refreshing every second: it
+has no keys to pause, cancel, add or reorder anything and never asks the
+server to change anything, so it can stay up on a shared server or a status
+screen. It logs in with the server's read-only token, which can only list
+downloads: the one a local server saves, or SURGE_WATCH_TOKEN (the server's
+--watch-token) for a remote one. Run 'surge' for the interactive TUI.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		if watch, _ := cmd.Flags().GetBool("watch"); !watch {
+			fmt.Fprintln(os.Stderr, "Error: 'surge tui' attaches to a server with --watch; run 'surge' for the interactive TUI")
+			os.Exit(1)
+		}
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Fprintln(os.Stderr, "Error: Surge is not running. Start it with 'surge server start' or set SURGE_HOST.")
+			os.Exit(1)
+		}
+
+		// The read-only token, so the dashboard cannot change anything even by mistake
+		token := watchToken()
+		source := func() ([]types.DownloadStatus, error) { return listRemoteDownloads(port, token) }
+		p := tea.NewProgram(tui.NewWatchModel(source, serverURL(port, "")), tea.WithAltScreen())
+		if _, err := p.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+	tuiCmd.Flags().Bool("watch", false, "Read-only dashboard of the running server")
+}
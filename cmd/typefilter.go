@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// typeFilterParallel is how many links have their type looked up at once
+const typeFilterParallel = 8
+
+// typeFilter keeps or drops links by the media type their server reports
+type typeFilter struct {
+	Accept []string // Types such as application/pdf or video/*; empty accepts all
+	Reject []string
+}
+
+// active reports whether the filter drops anything
+func (f typeFilter) active() bool {
+	return len(f.Accept) > 0 || len(f.Reject) > 0
+}
+
+// allows reports whether a link of mediaType passes the filter. A link whose
+// type is not known passes: nothing shows it is unwanted.
+func (f typeFilter) allows(mediaType string) bool {
+	if mediaType == "" {
+		return true
+	}
+	if len(f.Accept) > 0 && !matchesMediaType(mediaType, f.Accept) {
+		return false
+	}
+	return !matchesMediaType(mediaType, f.Reject)
+}
+
+// matchesMediaType reports whether mediaType is one of patterns, where
+// "video/*" matches every video type and "*/*" everything
+func matchesMediaType(mediaType string, patterns []string) bool {
+	mediaType = strings.ToLower(mediaType)
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, p := range patterns {
+		switch p {
+		case "*/*", mediaType, major + "/*":
+			return true
+		}
+	}
+	return false
+}
+
+// addTypeFilterFlags registers --accept-type and --reject-type on cmd
+func addTypeFilterFlags(cmd *cobra.Command, what string) {
+	cmd.Flags().StringSlice("accept-type", nil, "Only keep "+what+" whose server reports one of these types, e.g. video/*,application/pdf")
+	cmd.Flags().StringSlice("reject-type", nil, "Skip "+what+" whose server reports one of these types, e.g. text/html")
+}
+
+// typeFilterFlags reads --accept-type and --reject-type
+func typeFilterFlags(cmd *cobra.Command) (typeFilter, error) {
+	var f typeFilter
+	for _, flag := range []struct {
+		name string
+		dst  *[]string
+	}{{"accept-type", &f.Accept}, {"reject-type", &f.Reject}} {
+		values, _ := cmd.Flags().GetStringSlice(flag.name)
+		for _, v := range values {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if major, minor, ok := strings.Cut(v, "/"); !ok || major == "" || minor == "" || (major == "*" && minor != "*") {
+				return f, fmt.Errorf("--%s: %q is not a media type such as video/* or application/pdf", flag.name, v)
+			}
+			*flag.dst = append(*flag.dst, v)
+		}
+	}
+	return f, nil
+}
+
+// responseType returns the media type in resp's Content-Type, or "" when it
+// has none
+func responseType(resp *http.Response) string {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mediaType)
+}
+
+// headLink returns the size and media type a HEAD request for link reports,
+// -1 and "" where it does not say. Servers that refuse HEAD are asked with a
+// GET whose body is never read.
+func headLink(do func(method, link string) (*http.Response, error), link string) (int64, string) {
+	resp, err := do(http.MethodHead, link)
+	if err != nil {
+		if resp, err = do(http.MethodGet, link); err != nil {
+			return -1, ""
+		}
+	}
+	resp.Body.Close()
+	return resp.ContentLength, responseType(resp)
+}
+
+// filterByType looks up the type of the URL link returns for each of items
+// and returns the items f allows, in order, warning about the others
+func filterByType[T any](items []T, link func(T) string, f typeFilter) []T {
+	keep := make([]bool, len(items))
+	pc := newPageClient()
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, typeFilterParallel)
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, link string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, mediaType := headLink(pc.do, link)
+			if keep[i] = f.allows(mediaType); !keep[i] {
+				fmt.Fprintf(os.Stderr, "Skipping %s: it is %s\n", link, mediaType)
+			}
+		}(i, link(item))
+	}
+	wg.Wait()
+
+	var kept []T
+	for i, item := range items {
+		if keep[i] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
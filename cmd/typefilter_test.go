@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestTypeFilter(t *testing.T) {
+	cmd := &cobra.Command{}
+	addTypeFilterFlags(cmd, "links")
+	cmd.Flags().Set("accept-type", "Video/*,application/pdf")
+	cmd.Flags().Set("reject-type", "video/webm")
+	f, err := typeFilterFlags(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		mediaType string
+		want      bool
+	}{
+		{"video/mp4", true},
+		{"application/pdf", true},
+		{"video/webm", false},
+		{"text/html", false},
+		{"application/pdf+zip", false},
+		{"", true}, // The server did not say
+	}
+	for _, tt := range tests {
+		if got := f.allows(tt.mediaType); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.mediaType, got, tt.want)
+		}
+	}
+	if (typeFilter{}).active() || !(typeFilter{Reject: []string{"*/*"}}).active() {
+		t.Error("active() is wrong")
+	}
+
+	for _, bad := range []string{"video", "/mp4", "video/", "*/mp4"} {
+		cmd := &cobra.Command{}
+		addTypeFilterFlags(cmd, "links")
+		cmd.Flags().Set("reject-type", bad)
+		if _, err := typeFilterFlags(cmd); err == nil {
+			t.Errorf("--reject-type %q was accepted", bad)
+		}
+	}
+}
+
+func TestFilterByType(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	var gets int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/movie":
+			w.Header().Set("Content-Type", "video/mp4")
+		case "/paper":
+			// Refuses HEAD, so the type comes from the start of a GET
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			gets++
+			w.Header().Set("Content-Type", "application/pdf")
+		case "/login":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		case "/unknown":
+			w.Header()["Content-Type"] = nil
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	reqs := []DownloadRequest{
+		{URL: server.URL + "/movie"},
+		{URL: server.URL + "/login"},
+		{URL: server.URL + "/paper", Filename: "paper.pdf"},
+		{URL: server.URL + "/unknown"},
+	}
+	f := typeFilter{Accept: []string{"video/*", "application/pdf"}}
+	got := filterByType(reqs, func(req DownloadRequest) string { return req.URL }, f)
+	want := []DownloadRequest{reqs[0], reqs[2], reqs[3]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterByType() = %v, want %v", got, want)
+	}
+	if gets != 1 {
+		t.Errorf("%d GET requests for the server refusing HEAD, want 1", gets)
+	}
+}
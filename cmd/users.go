@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// apiUser is an identity the server accepts. A user with a Name only sees
+// and controls the downloads it added; the --token user has no name and
+// sees everything.
+type apiUser struct {
+	Name      string
+	Token     string
+	MaxActive int  // Unfinished downloads it may have in the queue at once; 0 is unlimited
+	ReadOnly  bool // May only list downloads, see readOnlyPaths
+}
+
+// loadUsers reads a users file. Each line is "name token [max-active]";
+// blank lines and lines starting with # are ignored.
+func loadUsers(path string) ([]apiUser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open users file: %w", err)
+	}
+	defer f.Close()
+
+	var users []apiUser
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"name token [max-active]\"", path, lineNo)
+		}
+		u := apiUser{Name: fields[0], Token: fields[1]}
+		// The name is also the user's folder, see userDir
+		if u.Name == "." || u.Name == ".." || strings.ContainsAny(u.Name, `/\`) {
+			return nil, fmt.Errorf("%s:%d: invalid user name %q", path, lineNo, u.Name)
+		}
+		if len(fields) == 3 {
+			if u.MaxActive, err = strconv.Atoi(fields[2]); err != nil || u.MaxActive < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid max-active %q", path, lineNo, fields[2])
+			}
+		}
+		if names[u.Name] {
+			return nil, fmt.Errorf("%s:%d: duplicate user %q", path, lineNo, u.Name)
+		}
+		if tokens[u.Token] {
+			return nil, fmt.Errorf("%s:%d: token of %q is already in use", path, lineNo, u.Name)
+		}
+		names[u.Name], tokens[u.Token] = true, true
+		users = append(users, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no users in %s", path)
+	}
+	return users, nil
+}
+
+type userContextKey struct{}
+
+// requestUser returns the user authenticated for r, or nil when the server
+// runs without tokens
+func requestUser(r *http.Request) *apiUser {
+	u, _ := r.Context().Value(userContextKey{}).(*apiUser)
+	return u
+}
+
+func withUser(r *http.Request, u *apiUser) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey{}, u))
+}
+
+// mayControlMachine reports whether r may run commands on the server's
+// machine or power it off. Named users may not. Nor may web pages: browsers
+// send an Origin with every request a page makes, and the server has no
+// token to stop them when it only listens on loopback.
+func mayControlMachine(r *http.Request) bool {
+	if u := requestUser(r); u != nil && (u.Name != "" || u.ReadOnly) {
+		return false
+	}
+	return r.Header.Get("Origin") == ""
+}
+
+// canAccess reports whether the user behind r may see and control download id
+func canAccess(r *http.Request, id string) bool {
+	u := requestUser(r)
+	if u == nil || u.Name == "" {
+		return true
+	}
+	owner, err := state.GetOwner(id)
+	if err != nil {
+		utils.Debug("Failed to look up owner of %s: %v", id, err)
+		return false
+	}
+	return owner == u.Name
+}
+
+// ownedBy returns a filter matching the download IDs the user behind r can
+// access, or nil when it can access everything
+func ownedBy(r *http.Request) func(id string) bool {
+	u := requestUser(r)
+	if u == nil || u.Name == "" {
+		return nil
+	}
+	owners, err := state.LoadOwners()
+	if err != nil {
+		utils.Debug("Failed to load download owners: %v", err)
+	}
+	return func(id string) bool { return owners[id] == u.Name }
+}
+
+// quotaMu makes checking a user's quota and adding its download one step
+var quotaMu sync.Mutex
+
+// unfinishedCount returns how many downloads held by the worker pool the
+// filter matches and are not yet complete
+func unfinishedCount(owned func(id string) bool) int {
+	if GlobalPool == nil {
+		return 0
+	}
+	count := 0
+	for _, cfg := range GlobalPool.GetAll() {
+		if cfg.State != nil && cfg.State.Done.Load() {
+			continue
+		}
+		if owned(cfg.ID) {
+			count++
+		}
+	}
+	return count
+}
+
+// userDir returns the folder a named user's downloads are saved in, named
+// after the user in the download directory. Requests of the user may not
+// name files on the server outside it.
+func userDir(u *apiUser, defaultOutputDir string, settings *config.Settings) string {
+	base := cmp.Or(defaultOutputDir, settings.General.DefaultDownloadDir, ".")
+	return filepath.Join(utils.EnsureAbsPath(base), u.Name)
+}
+
+// confinePath resolves path against base, refusing it if it leads outside
+func confinePath(base, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+	if path != base && !strings.HasPrefix(path, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", path, base)
+	}
+	return path, nil
+}
+
+// confineRequest keeps every file req names on the server inside base: the
+// download's folder, and the signature, keyring and torrent it is checked
+// against unless those are fetched
+func confineRequest(req *DownloadRequest, base string) error {
+	var err error
+	if req.Path, err = confinePath(base, cmp.Or(req.Path, ".")); err != nil {
+		return fmt.Errorf("path: %w", err)
+	}
+	if req.Signature != "" && !download.IsSignatureURL(req.Signature) {
+		if req.Signature, err = confinePath(base, req.Signature); err != nil {
+			return fmt.Errorf("signature: %w", err)
+		}
+	}
+	if req.Keyring != "" {
+		if req.Keyring, err = confinePath(base, req.Keyring); err != nil {
+			return fmt.Errorf("keyring: %w", err)
+		}
+	}
+	if req.Torrent != "" && !download.IsSignatureURL(req.Torrent) {
+		if req.Torrent, err = confinePath(base, req.Torrent); err != nil {
+			return fmt.Errorf("torrent: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestLoadUsers(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "users")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	users, err := loadUsers(write("# name token max\nalice a-token 2\n\nbob b-token\n"))
+	if err != nil {
+		t.Fatalf("loadUsers failed: %v", err)
+	}
+	if len(users) != 2 || users[0] != (apiUser{Name: "alice", Token: "a-token", MaxActive: 2}) || users[1] != (apiUser{Name: "bob", Token: "b-token"}) {
+		t.Errorf("loadUsers = %+v", users)
+	}
+
+	for _, bad := range []string{
+		"",
+		"alice\n",
+		"alice a-token 2 extra\n",
+		"alice a-token many\n",
+		"alice a-token\nalice other\n",
+		"alice same\nbob same\n",
+		"../alice a-token\n",
+	} {
+		if _, err := loadUsers(write(bad)); err == nil {
+			t.Errorf("loadUsers(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestServerSecurity_UsersFile(t *testing.T) {
+	users := []apiUser{{Name: "alice", Token: "a-token"}}
+	if err := (serverSecurity{Bind: "0.0.0.0", Users: users}).validate(); err != nil {
+		t.Errorf("users should be enough to listen on all interfaces: %v", err)
+	}
+	if err := (serverSecurity{Bind: "127.0.0.1", Token: "a-token", Users: users}).validate(); err == nil {
+		t.Error("expected an error when a user shares the --token value")
+	}
+	if got := (serverSecurity{Token: "admin", Users: users}).apiUsers(); len(got) != 2 || got[0].Name != "" {
+		t.Errorf("apiUsers() = %+v, want the unnamed --token user first", got)
+	}
+}
+
+func TestUserNamespaces(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Downloads stay unfinished while the origin holds their requests open
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer origin.Close()
+
+	oldPool, oldCh := GlobalPool, GlobalProgressCh
+	progressCh := make(chan any, 100)
+	GlobalProgressCh = progressCh
+	GlobalPool = download.NewWorkerPool(progressCh, 4)
+	stop := discardProgress(progressCh)
+	defer func() {
+		for _, cfg := range GlobalPool.GetAll() {
+			GlobalPool.Cancel(cfg.ID)
+		}
+		stop()
+		GlobalPool, GlobalProgressCh = oldPool, oldCh
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	go startHTTPServer(ln, port, tempDir, serverSecurity{
+		Token: "admin",
+		Users: []apiUser{{Name: "alice", Token: "a-token", MaxActive: 1}, {Name: "bob", Token: "b-token"}},
+	}.apiUsers())
+
+	do := func(method, path, token, body string) *http.Response {
+		req, _ := http.NewRequest(method, serverURL(port, path), bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	add := func(token, name string) (int, string) {
+		resp := do(http.MethodPost, "/download", token, `{"url": "`+origin.URL+`/`+name+`"}`)
+		var body map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body["id"]
+	}
+	list := func(token string) map[string]bool {
+		var statuses []types.DownloadStatus
+		if err := json.NewDecoder(do(http.MethodGet, "/list", token, "").Body).Decode(&statuses); err != nil {
+			t.Fatalf("decoding /list: %v", err)
+		}
+		ids := make(map[string]bool)
+		for _, s := range statuses {
+			ids[s.ID] = true
+		}
+		return ids
+	}
+
+	code, aliceID := add("a-token", "a1")
+	if code != http.StatusOK {
+		t.Fatalf("alice's first download: got %d", code)
+	}
+	if code, _ := add("a-token", "a2"); code != http.StatusTooManyRequests {
+		t.Errorf("alice over quota: got %d, want 429", code)
+	}
+	code, bobID := add("b-token", "b1")
+	if code != http.StatusOK {
+		t.Fatalf("bob's download: got %d", code)
+	}
+
+	// Users only see and control their own downloads; the --token user sees all
+	if got := list("a-token"); len(got) != 1 || !got[aliceID] {
+		t.Errorf("alice lists %v, want only %s", got, aliceID)
+	}
+	if got := list("admin"); !got[aliceID] || !got[bobID] {
+		t.Errorf("admin lists %v, want both downloads", got)
+	}
+	if resp := do(http.MethodGet, "/download?id="+aliceID, "b-token", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("bob querying alice's download: got %d, want 404", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/pause?id="+aliceID, "b-token", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("bob pausing alice's download: got %d, want 404", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/download?id="+aliceID, "a-token", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("alice querying her download: got %d, want 200", resp.StatusCode)
+	}
+
+	// Users name no files outside their folder and choose no proxy
+	for _, body := range []string{
+		`{"url": "` + origin.URL + `/b2", "path": "` + filepath.ToSlash(tempDir) + `"}`,
+		`{"url": "` + origin.URL + `/b2", "keyring": "/etc/passwd"}`,
+		`{"url": "` + origin.URL + `/b2", "proxy": "http://127.0.0.1:1"}`,
+	} {
+		if resp := do(http.MethodPost, "/download", "b-token", body); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("bob adding %s: got %d, want 403", body, resp.StatusCode)
+		}
+	}
+	for _, cfg := range GlobalPool.GetAll() {
+		if cfg.ID == bobID && cfg.OutputPath != filepath.Join(tempDir, "bob") {
+			t.Errorf("bob's download saved in %s, want his folder", cfg.OutputPath)
+		}
+	}
+}
+
+func TestConfineRequest(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "alice")
+	req := DownloadRequest{Path: "isos", Signature: "https://example.com/a.sig", Keyring: "keys/release.asc", Torrent: filepath.Join(base, "a.torrent")}
+	if err := confineRequest(&req, base); err != nil {
+		t.Fatalf("confineRequest = %v", err)
+	}
+	if req.Path != filepath.Join(base, "isos") || req.Keyring != filepath.Join(base, "keys", "release.asc") || req.Signature != "https://example.com/a.sig" {
+		t.Errorf("confineRequest resolved %+v", req)
+	}
+	if req := (DownloadRequest{}); confineRequest(&req, base) != nil || req.Path != base {
+		t.Errorf("an empty path resolves to %q, want %q", req.Path, base)
+	}
+
+	for _, bad := range []DownloadRequest{
+		{Path: filepath.Dir(base)},
+		{Path: base + "-other"},
+		{Signature: "/etc/release.sig"},
+		{Keyring: "../bob/keys.asc"},
+		{Torrent: "sub/../../x.torrent"},
+	} {
+		if err := confineRequest(&bad, base); err == nil {
+			t.Errorf("confineRequest(%+v) succeeded, want it refused", bad)
+		}
+	}
+}
+
+func TestMayControlMachine(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   *apiUser
+		origin string
+		want   bool
+	}{
+		{"no token", nil, "", true},
+		{"admin token", &apiUser{Token: "admin"}, "", true},
+		{"named user", &apiUser{Name: "alice", Token: "a-token"}, "", false},
+		{"web page", nil, "https://example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/download", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.user != nil {
+				r = withUser(r, tt.user)
+			}
+			if got := mayControlMachine(r); got != tt.want {
+				t.Errorf("mayControlMachine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,22 +3,38 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
 
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/cookies"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/metalink"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/torrent"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/pgp"
+	"github.com/surge-downloader/surge/internal/utils"
 )
 
-// readActivePort reads the port from the port file
+// readActivePort reads the port from the port file, or from SURGE_HOST when
+// commands target a server elsewhere
 func readActivePort() int {
-	portFile := filepath.Join(config.GetSurgeDir(), "port")
+	if port := remotePort(); port > 0 {
+		return port
+	}
+	portFile := filepath.Join(config.GetCacheDir(), "port")
 	data, err := os.ReadFile(portFile)
 	if err != nil {
 		return 0
@@ -28,6 +44,406 @@ func readActivePort() int {
 	return port
 }
 
+// applyCompletedFileFlags applies the flags shared by `surge` and
+// `surge server start` that control what happens to completed files
+func applyCompletedFileFlags(cmd *cobra.Command) error {
+	if writeManifest, _ := cmd.Flags().GetBool("write-manifest"); writeManifest {
+		GlobalPool.SetWriteManifest(true)
+	}
+	if fixExtensions, _ := cmd.Flags().GetBool("fix-extensions"); fixExtensions {
+		GlobalPool.SetFixExtensions(true)
+	}
+
+	if chmod, _ := cmd.Flags().GetString("chmod"); chmod != "" {
+		mode, err := download.ParseFileMode(chmod)
+		if err != nil {
+			return err
+		}
+		GlobalPool.SetFileMode(mode)
+	}
+
+	if chown, _ := cmd.Flags().GetString("chown"); chown != "" {
+		uid, gid, err := download.ParseOwner(chown)
+		if err != nil {
+			return err
+		}
+		settings, err := config.LoadSettings()
+		if err != nil {
+			settings = config.DefaultSettings()
+		}
+		// Configured per-destination rules still win; the flag covers the rest
+		rules := convertOwnershipRules(settings.General.Ownership)
+		GlobalPool.SetOwnership(append(rules, types.OwnershipRule{UID: uid, GID: gid}))
+	}
+	return nil
+}
+
+// addPostActionFlags registers --on-complete, --notify and
+// --shutdown-when-done on cmd, for the downloads named by what
+func addPostActionFlags(cmd *cobra.Command, what string) {
+	cmd.Flags().String("on-complete", "", "Run this shell command after each of "+what+" completes; {path}, {dir}, {filename}, {url} and {id} are filled in")
+	cmd.Flags().Bool("notify", false, "Show a desktop notification when each of "+what+" completes or fails")
+	cmd.Flags().Bool("shutdown-when-done", false, "Power the computer off once "+what+" are over and nothing else is left to download")
+}
+
+// postActionFlags returns the actions chosen with addPostActionFlags' flags
+func postActionFlags(cmd *cobra.Command) types.PostActions {
+	var actions types.PostActions
+	actions.OnComplete, _ = cmd.Flags().GetString("on-complete")
+	actions.Notify, _ = cmd.Flags().GetBool("notify")
+	actions.Shutdown, _ = cmd.Flags().GetBool("shutdown-when-done")
+	return actions
+}
+
+// applyPostActionFlags adds the post-download actions chosen on the command
+// line to those of the settings, for every download of this run
+func applyPostActionFlags(cmd *cobra.Command) {
+	GlobalPool.SetActions(GlobalPool.Actions().Merge(postActionFlags(cmd)))
+}
+
+// parseConcurrency parses a --concurrent value: a connection count per host,
+// or "auto" to tune it while downloading
+func parseConcurrency(value string) (conns int, adaptive bool, err error) {
+	if strings.EqualFold(value, "auto") {
+		return 0, true, nil
+	}
+	conns, err = strconv.Atoi(value)
+	if err != nil || conns < 1 || conns > 64 {
+		return 0, false, fmt.Errorf("invalid --concurrent %q: want 1-64 or auto", value)
+	}
+	return conns, false, nil
+}
+
+// applyConcurrencyFlag applies --concurrent to every download of this run
+func applyConcurrencyFlag(cmd *cobra.Command) error {
+	value, _ := cmd.Flags().GetString("concurrent")
+	if value == "" {
+		return nil
+	}
+	conns, adaptive, err := parseConcurrency(value)
+	if err != nil {
+		return err
+	}
+	GlobalPool.SetConcurrency(conns, adaptive)
+	return nil
+}
+
+// applyMaxActiveFlag applies --max-active, which overrides the
+// max_concurrent_downloads setting for this run
+func applyMaxActiveFlag(cmd *cobra.Command) error {
+	n, _ := cmd.Flags().GetInt("max-active")
+	if n == 0 {
+		return nil
+	}
+	if n < 0 || n > download.MaxWorkers {
+		return fmt.Errorf("invalid --max-active %d: want 1-%d", n, download.MaxWorkers)
+	}
+	GlobalPool.SetMaxDownloads(n)
+	return nil
+}
+
+// proxyFlag returns the proxy chosen with --proxy or --socks5, or "" if
+// neither was given. --socks5 takes a [user:password@]host:port.
+func proxyFlag(cmd *cobra.Command) (string, error) {
+	proxy, _ := cmd.Flags().GetString("proxy")
+	socks5, _ := cmd.Flags().GetString("socks5")
+	switch {
+	case proxy != "" && socks5 != "":
+		return "", fmt.Errorf("--proxy and --socks5 cannot be used together")
+	case socks5 != "":
+		if strings.Contains(socks5, "://") {
+			return "", fmt.Errorf("invalid --socks5 %q: want [user:password@]host:port", socks5)
+		}
+		proxy = "socks5://" + socks5
+	}
+	if err := types.CheckProxy(proxy); err != nil {
+		return "", err
+	}
+	return proxy, nil
+}
+
+// applyProxyFlag applies --proxy or --socks5 to every download of this run
+// that does not ask for its own proxy
+func applyProxyFlag(cmd *cobra.Command) error {
+	proxy, err := proxyFlag(cmd)
+	if err != nil {
+		return err
+	}
+	GlobalPool.SetProxy(proxy)
+	return nil
+}
+
+// downloadOptions are the per-download settings `surge get` sends with
+// every URL it adds
+type downloadOptions struct {
+	Proxy    string
+	Headers  map[string]string
+	Cookies  []*http.Cookie // Browser cookies; each download gets those of its hosts
+	Schedule string         // When the downloads may run, see types.ParseSchedule
+	Priority string         // "high", "normal" or "low"
+	Checksum string         // "type:hex" the file must match, from --md5, --sha1, --sha256 or --checksum
+	Actions  types.PostActions
+
+	Signature string // Detached OpenPGP signature the file must match, from --signature
+	Keyring   string // Public keys the signature must be made with, from --keyring
+
+	ExpectHeaders map[string]string // Response headers the server must send, from --expect-header
+	ExpectSize    int64             // Size the server must report, from --expect-size
+}
+
+func (o downloadOptions) apply(req *DownloadRequest) {
+	req.Proxy = o.Proxy
+	req.Headers = o.Headers
+	req.Schedule = o.Schedule
+	req.Priority = o.Priority
+	if o.Checksum != "" {
+		req.Checksum = o.Checksum
+	}
+	if o.Signature != "" {
+		req.Signature, req.Keyring = o.Signature, o.Keyring
+	}
+	req.ExpectHeaders = o.ExpectHeaders
+	if o.ExpectSize > 0 {
+		req.Size = o.ExpectSize
+	}
+	req.OnComplete = o.Actions.OnComplete
+	req.Notify = o.Actions.Notify
+	req.ShutdownWhenDone = o.Actions.Shutdown
+	req.Cookies = toRequestCookies(o.cookiesFor(req.URL, req.Mirrors))
+}
+
+// cookiesFor returns the cookies the browser would send to rawURL or mirrors
+func (o downloadOptions) cookiesFor(rawURL string, mirrors []string) []*http.Cookie {
+	if len(o.Cookies) == 0 {
+		return nil
+	}
+	var hosts []string
+	for _, raw := range append([]string{rawURL}, mirrors...) {
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	return cookies.ForHosts(o.Cookies, hosts...)
+}
+
+// downloadOptionFlags returns the options chosen with --proxy, --socks5,
+// --header, --user, --bearer, --cookies-from-browser, --load-cookies,
+// --schedule, --priority, the checksum, signature and expectation flags and
+// the post-download action flags
+func downloadOptionFlags(cmd *cobra.Command) (downloadOptions, error) {
+	proxy, err := proxyFlag(cmd)
+	if err != nil {
+		return downloadOptions{}, err
+	}
+	headers, err := headerFlags(cmd)
+	if err != nil {
+		return downloadOptions{}, err
+	}
+	opts := downloadOptions{Proxy: proxy, Headers: headers, Actions: postActionFlags(cmd)}
+	if opts.Schedule, _ = cmd.Flags().GetString("schedule"); opts.Schedule != "" {
+		schedule, err := types.ParseSchedule(opts.Schedule, time.Now())
+		if err != nil {
+			return downloadOptions{}, err
+		}
+		// A time of day means the next one here, not on the server's clock
+		opts.Schedule = schedule.String()
+	}
+	if opts.Priority, _ = cmd.Flags().GetString("priority"); opts.Priority != "" {
+		if _, err := types.ParsePriority(opts.Priority); err != nil {
+			return downloadOptions{}, err
+		}
+	}
+	if opts.Checksum, err = checksumFlag(cmd); err != nil {
+		return downloadOptions{}, err
+	}
+	if opts.Signature, opts.Keyring, err = signatureFlags(cmd); err != nil {
+		return downloadOptions{}, err
+	}
+	if opts.ExpectHeaders, opts.ExpectSize, err = expectFlags(cmd); err != nil {
+		return downloadOptions{}, err
+	}
+	if browser, _ := cmd.Flags().GetString("cookies-from-browser"); browser != "" {
+		if opts.Cookies, err = cookies.Load(browser); err != nil {
+			return downloadOptions{}, fmt.Errorf("reading %s cookies: %w", browser, err)
+		}
+	}
+	if file, _ := cmd.Flags().GetString("load-cookies"); file != "" {
+		loaded, err := cookies.LoadFile(file)
+		if err != nil {
+			return downloadOptions{}, fmt.Errorf("reading cookies: %w", err)
+		}
+		opts.Cookies = append(opts.Cookies, loaded...)
+	}
+	return opts, nil
+}
+
+// checksumFlags are the flags giving the hash a download must match
+var checksumFlags = []string{"md5", "sha1", "sha256"}
+
+// checksumFlag returns the "type:hex" checksum given with --md5, --sha1,
+// --sha256 or --checksum, or "" if none was
+func checksumFlag(cmd *cobra.Command) (string, error) {
+	var checksum string
+	for _, typ := range checksumFlags {
+		sum, _ := cmd.Flags().GetString(typ)
+		if sum == "" {
+			continue
+		}
+		if checksum != "" {
+			return "", fmt.Errorf("only one of --md5, --sha1, --sha256 and --checksum can be given")
+		}
+		checksum = typ + ":" + strings.ToLower(sum)
+		if !download.SupportedChecksum(checksum) {
+			return "", fmt.Errorf("--%s needs a hex digest, got %q", typ, sum)
+		}
+	}
+	if sum, _ := cmd.Flags().GetString("checksum"); sum != "" {
+		if checksum != "" {
+			return "", fmt.Errorf("only one of --md5, --sha1, --sha256 and --checksum can be given")
+		}
+		typ, digest, _ := strings.Cut(sum, ":")
+		checksum = strings.ToLower(typ) + ":" + strings.ToLower(digest)
+		if !download.SupportedChecksum(checksum) {
+			return "", fmt.Errorf("--checksum needs type:hex with a type of %s, got %q", strings.Join(types.ChecksumTypes(), ", "), sum)
+		}
+	}
+	return checksum, nil
+}
+
+// signatureFlags returns the signature and keyring given with --signature and
+// --keyring. Paths are made absolute for the server, and the keyring is read
+// now so a bad one is reported before downloading.
+func signatureFlags(cmd *cobra.Command) (signature, keyring string, err error) {
+	signature, _ = cmd.Flags().GetString("signature")
+	keyring, _ = cmd.Flags().GetString("keyring")
+	if signature == "" && keyring == "" {
+		return "", "", nil
+	}
+	if signature == "" || keyring == "" {
+		return "", "", fmt.Errorf("--signature and --keyring go together")
+	}
+	keyring = utils.EnsureAbsPath(keyring)
+	if _, err := pgp.LoadKeyring(keyring); err != nil {
+		return "", "", err
+	}
+	if !download.IsSignatureURL(signature) {
+		signature = utils.EnsureAbsPath(signature)
+		if _, err := os.Stat(signature); err != nil {
+			return "", "", fmt.Errorf("--signature: %w", err)
+		}
+	}
+	return signature, keyring, nil
+}
+
+// toRequestCookies converts cookies for a DownloadRequest
+func toRequestCookies(cookies []*http.Cookie) []requestCookie {
+	var converted []requestCookie
+	for _, c := range cookies {
+		rc := requestCookie{Name: c.Name, Value: c.Value, Domain: c.Domain, Path: c.Path, Secure: c.Secure}
+		if !c.Expires.IsZero() {
+			rc.Expires = c.Expires.Unix()
+		}
+		converted = append(converted, rc)
+	}
+	return converted
+}
+
+// parseRequestCookies converts and checks the cookies of a DownloadRequest
+func parseRequestCookies(cookies []requestCookie) ([]*http.Cookie, error) {
+	var parsed []*http.Cookie
+	for _, rc := range cookies {
+		c := &http.Cookie{Name: rc.Name, Value: rc.Value, Domain: rc.Domain, Path: rc.Path, Secure: rc.Secure}
+		if rc.Expires != 0 {
+			c.Expires = time.Unix(rc.Expires, 0)
+		}
+		if c.Domain == "" {
+			return nil, fmt.Errorf("cookie %q has no domain", c.Name)
+		}
+		if err := c.Valid(); err != nil {
+			return nil, fmt.Errorf("invalid cookie %q: %w", c.Name, err)
+		}
+		parsed = append(parsed, c)
+	}
+	return parsed, nil
+}
+
+// headerFlags returns the request headers chosen with --header, --user and
+// --bearer. --user and --bearer replace an Authorization --header.
+func headerFlags(cmd *cobra.Command) (map[string]string, error) {
+	lines, _ := cmd.Flags().GetStringArray("header")
+	user, _ := cmd.Flags().GetString("user")
+	bearer, _ := cmd.Flags().GetString("bearer")
+
+	headers := make(map[string]string)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid --header %q: want \"Name: value\"", line)
+		}
+		headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	switch {
+	case user != "" && bearer != "":
+		return nil, fmt.Errorf("--user and --bearer cannot be used together")
+	case user != "":
+		if !strings.Contains(user, ":") {
+			return nil, fmt.Errorf("invalid --user: want user:password")
+		}
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(user))
+	case bearer != "":
+		headers["Authorization"] = "Bearer " + bearer
+	}
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if _, err := types.ParseHeaders(headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// expectFlags returns the response the server must send, chosen with
+// --expect-header and --expect-size
+func expectFlags(cmd *cobra.Command) (map[string]string, int64, error) {
+	lines, _ := cmd.Flags().GetStringArray("expect-header")
+	size, _ := cmd.Flags().GetInt64("expect-size")
+	if size < 0 {
+		return nil, 0, fmt.Errorf("--expect-size must be a number of bytes")
+	}
+	if len(lines) == 0 {
+		return nil, size, nil
+	}
+	headers := make(map[string]string)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, 0, fmt.Errorf("invalid --expect-header %q: want \"Name: value\"", line)
+		}
+		headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	if _, err := types.ParseHeaders(headers); err != nil {
+		return nil, 0, err
+	}
+	return headers, size, nil
+}
+
+// convertHookSettings converts configured hook programs to engine hooks
+func convertHookSettings(h config.HookSettings) types.HookPrograms {
+	return types.HookPrograms{OnEnqueue: h.OnEnqueue, OnComplete: h.OnComplete, OnError: h.OnError}
+}
+
+// convertOwnershipRules converts config ownership rules to engine rules
+func convertOwnershipRules(rules []config.OwnershipRule) []types.OwnershipRule {
+	converted := make([]types.OwnershipRule, len(rules))
+	for i, r := range rules {
+		converted[i] = types.OwnershipRule{Path: r.Path, UID: r.UID, GID: r.GID}
+		if r.Path != "" {
+			converted[i].Path = utils.EnsureAbsPath(r.Path)
+		}
+	}
+	return converted
+}
+
 // readURLsFromFile reads URLs from a file, one per line
 func readURLsFromFile(filepath string) ([]string, error) {
 	file, err := os.Open(filepath)
@@ -63,48 +479,179 @@ func ParseURLArg(arg string) (string, []string) {
 	return urls[0], urls
 }
 
+// mirrorArgs joins args into a single download of one file, the first URL
+// primary and the rest its mirrors, when cmd's --mirror flag is set
+func mirrorArgs(cmd *cobra.Command, args []string) []string {
+	if mirror, _ := cmd.Flags().GetBool("mirror"); !mirror || len(args) < 2 {
+		return args
+	}
+	return []string{strings.Join(args, ",")}
+}
+
+// isTorrentArg reports whether arg refers to a local .torrent file
+func isTorrentArg(arg string) bool {
+	if !strings.HasSuffix(strings.ToLower(arg), ".torrent") {
+		return false
+	}
+	info, err := os.Stat(arg)
+	return err == nil && !info.IsDir()
+}
+
+// parseTorrentArg loads a .torrent file and returns a request for its payload
+// from its web seeds, checked against its piece hashes once complete. Only
+// web seeds are used; the payload is fetched over HTTP by the regular engine.
+func parseTorrentArg(path string) (DownloadRequest, error) {
+	meta, err := torrent.LoadMetainfo(path)
+	if err != nil {
+		return DownloadRequest{}, err
+	}
+	urls, err := torrent.WebSeedURLs(meta)
+	if err != nil {
+		return DownloadRequest{}, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return DownloadRequest{}, err
+	}
+	return DownloadRequest{URL: urls[0], Mirrors: urls, Filename: meta.Name, Size: meta.Length, Torrent: abs}, nil
+}
+
+// isMetalinkArg reports whether arg refers to a local .metalink or .meta4 file
+func isMetalinkArg(arg string) bool {
+	lower := strings.ToLower(arg)
+	if !strings.HasSuffix(lower, ".metalink") && !strings.HasSuffix(lower, ".meta4") {
+		return false
+	}
+	info, err := os.Stat(arg)
+	return err == nil && !info.IsDir()
+}
+
+// parseMetalinkArg loads a metalink file and returns one request per file in
+// it, with the file's HTTP URLs as primary and mirrors, best first, and the
+// size and strongest hash the download must match
+func parseMetalinkArg(path string) ([]DownloadRequest, error) {
+	m, err := metalink.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []DownloadRequest
+	for _, f := range m.Files {
+		urls := f.HTTPURLs()
+		if len(urls) == 0 {
+			return nil, fmt.Errorf("metalink: %s has no HTTP URLs", f.Name)
+		}
+		reqs = append(reqs, DownloadRequest{
+			URL:      urls[0],
+			Mirrors:  urls,
+			Filename: f.Name,
+			Size:     f.Size,
+			Checksum: f.Checksum(),
+		})
+	}
+	return reqs, nil
+}
+
+// expandArg turns a command line argument (a URL with optional
+// comma-separated mirrors, a .torrent or a metalink) into the downloads it
+// stands for
+func expandArg(arg string) ([]DownloadRequest, error) {
+	switch {
+	case isMetalinkArg(arg):
+		return parseMetalinkArg(arg)
+	case isTorrentArg(arg):
+		req, err := parseTorrentArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		return []DownloadRequest{req}, nil
+	}
+	url, mirrors := ParseURLArg(arg)
+	if url == "" {
+		return nil, nil
+	}
+	return []DownloadRequest{{URL: url, Mirrors: mirrors}}, nil
+}
+
 // sendToServer sends a download request to a running surge server
 func sendToServer(url string, mirrors []string, outPath string, port int) error {
-	reqBody := DownloadRequest{
+	return sendRequestToServer(DownloadRequest{
 		URL:     url,
 		Mirrors: mirrors,
 		Path:    outPath,
-	}
+	}, port)
+}
+
+// sendRequestToServer posts a fully populated download request to a running surge server
+func sendRequestToServer(reqBody DownloadRequest, port int) error {
+	_, err := postDownload(reqBody, port)
+	return err
+}
+
+// downloadResponse is the server's answer to a download request
+type downloadResponse struct {
+	Status string `json:"status"` // queued, resumed or pending_approval
+	ID     string `json:"id"`
+}
+
+// postDownload posts a download request to a running surge server
+func postDownload(reqBody DownloadRequest, port int) (downloadResponse, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return downloadResponse{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	serverURL := fmt.Sprintf("http://127.0.0.1:%d/download", port)
-	resp, err := http.Post(serverURL, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to connect to server: %w", err)
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		resp, err = serverRequest(http.MethodPost, port, "/download", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return downloadResponse{}, fmt.Errorf("failed to connect to server: %w", err)
+		}
+		// A full queue asks us to come back later; quota errors do not
+		wait := retryAfter(resp)
+		if resp.StatusCode != http.StatusTooManyRequests || wait == 0 || attempt >= maxQueueFullRetries {
+			break
+		}
+		resp.Body.Close()
+		utils.Debug("Server queue full, retrying in %s", wait)
+		time.Sleep(wait)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server error: %s - %s", resp.Status, string(body))
+		return downloadResponse{}, fmt.Errorf("server error: %s - %s", resp.Status, string(body))
 	}
 
-	// Optional: Print response info (ID etc) if needed, but usually caller handles success msg
-	// Or we can parse ID here and return it?
-	// The caller (add.go/root.go) might want to know ID.
-	// For now, keep it simple as error/nil.
-
-	var respData map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&respData) // Ignore error? safely
-	if id, ok := respData["id"].(string); ok {
-		// Could log debug
-		_ = id
+	var respData downloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+		utils.Debug("Failed to decode download response: %v", err)
 	}
+	return respData, nil
+}
 
-	return nil
+// maxQueueFullRetries bounds how often sendRequestToServer waits for room in
+// a full server queue before giving up
+const maxQueueFullRetries = 60
+
+// retryAfter returns the delay requested by a Retry-After header in seconds,
+// or 0 if there is none
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
 }
 
 // GetRemoteDownloads fetches all downloads from the running server
 func GetRemoteDownloads(port int) ([]types.DownloadStatus, error) {
-	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/list", port))
+	return listRemoteDownloads(port, clientToken())
+}
+
+// listRemoteDownloads is GetRemoteDownloads sending token, such as the
+// read-only one of watchToken
+func listRemoteDownloads(port int, token string) ([]types.DownloadStatus, error) {
+	resp, err := serverRequestWithToken(http.MethodGet, port, "/list", nil, token)
 	if err != nil {
 		return nil, err
 	}
@@ -122,6 +669,14 @@ func GetRemoteDownloads(port int) ([]types.DownloadStatus, error) {
 	return statuses, nil
 }
 
+// shortID returns the display prefix of a download ID
+func shortID(id string) string {
+	if len(id) > types.ShortIDLength {
+		return id[:types.ShortIDLength]
+	}
+	return id
+}
+
 // resolveDownloadID resolves a partial ID (prefix) to a full download ID.
 // If the input is at least 8 characters and matches a single download, returns the full ID.
 // Returns the original ID if no match found or if it's already a full ID.
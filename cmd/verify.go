@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Outcomes of checking a file against its recorded hash
+const (
+	verifyOK      = "OK"
+	verifyChanged = "CHANGED"
+	verifyMissing = "MISSING"
+	verifyUnknown = "UNKNOWN" // No hash recorded for the file
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [file|dir]...",
+	Short: "Check completed downloads against the hashes recorded when they finished",
+	Long: `Surge records the SHA-256 of every completed download. verify checks files
+against those hashes and reports the ones that changed or went missing since.
+
+With --all, every recorded file inside the given directories (or anywhere,
+if none are given) is checked. Files whose size and modification time are
+unchanged are trusted without reading them; use --full to hash them anyway,
+e.g. to catch disk corruption.
+
+Exits with status 1 if any file changed or is missing.`,
+	Example: `  surge verify ~/Downloads/ubuntu.iso
+  surge verify --all ~/Downloads`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		all, _ := cmd.Flags().GetBool("all")
+		full, _ := cmd.Flags().GetBool("full")
+		prune, _ := cmd.Flags().GetBool("prune")
+
+		if !all && len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: provide files to verify or use --all")
+			os.Exit(1)
+		}
+
+		var entries []types.ChecksumEntry
+		var unknown []string
+		if all {
+			dirs := args
+			if len(dirs) == 0 {
+				dirs = []string{""}
+			}
+			for _, dir := range dirs {
+				if dir != "" {
+					dir = utils.EnsureAbsPath(dir)
+				}
+				list, err := state.LoadChecksums(dir)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				entries = append(entries, list...)
+			}
+		} else {
+			for _, arg := range args {
+				path := utils.EnsureAbsPath(arg)
+				entry, err := state.GetChecksum(path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if entry == nil {
+					unknown = append(unknown, path)
+					continue
+				}
+				entries = append(entries, *entry)
+			}
+		}
+
+		counts := make(map[string]int)
+		for _, path := range unknown {
+			fmt.Printf("%-8s %s\n", verifyUnknown, path)
+			counts[verifyUnknown]++
+		}
+		for _, entry := range entries {
+			result, err := verifyChecksum(entry, full)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error verifying %s: %v\n", entry.Path, err)
+				counts["failed"]++
+				continue
+			}
+			counts[result]++
+			if result == verifyOK {
+				continue
+			}
+			fmt.Printf("%-8s %s\n", result, entry.Path)
+			if result == verifyMissing && prune {
+				if err := state.RemoveChecksum(entry.Path); err != nil {
+					utils.Debug("Failed to forget checksum of %s: %v", entry.Path, err)
+				}
+			}
+		}
+
+		fmt.Printf("%d ok, %d changed, %d missing", counts[verifyOK], counts[verifyChanged], counts[verifyMissing])
+		if counts[verifyUnknown] > 0 {
+			fmt.Printf(", %d without a recorded hash", counts[verifyUnknown])
+		}
+		fmt.Println()
+		if counts[verifyChanged] > 0 || counts[verifyMissing] > 0 || counts["failed"] > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().Bool("all", false, "Verify every recorded file inside the given directories")
+	verifyCmd.Flags().Bool("full", false, "Hash every file, even when its size and modification time are unchanged")
+	verifyCmd.Flags().Bool("prune", false, "Forget the recorded hashes of missing files")
+}
+
+// verifyChecksum checks the file recorded in entry. A file with the recorded
+// size and modification time counts as unchanged unless full is set; one
+// that was only touched is hashed, and its new time recorded so the next
+// check is quick again.
+func verifyChecksum(entry types.ChecksumEntry, full bool) (string, error) {
+	info, err := os.Stat(entry.Path)
+	if os.IsNotExist(err) {
+		return verifyMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Size() != entry.Size {
+		return verifyChanged, nil
+	}
+	if !full && info.ModTime().UnixNano() == entry.ModTime {
+		return verifyOK, nil
+	}
+
+	hash, err := download.HashFile(entry.Path)
+	if err != nil {
+		return "", err
+	}
+	if hash != entry.SHA256 {
+		return verifyChanged, nil
+	}
+	entry.ModTime = info.ModTime().UnixNano()
+	entry.CheckedAt = time.Now().Unix()
+	if err := state.SaveChecksum(entry); err != nil {
+		utils.Debug("Failed to update checksum of %s: %v", entry.Path, err)
+	}
+	return verifyOK, nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	record := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := download.RecordChecksum("id-"+name, path); err != nil {
+			t.Fatalf("RecordChecksum() failed: %v", err)
+		}
+		return path
+	}
+	check := func(path string, full bool, want string) {
+		t.Helper()
+		entry, err := state.GetChecksum(path)
+		if err != nil || entry == nil {
+			t.Fatalf("no checksum recorded for %s: %v", path, err)
+		}
+		got, err := verifyChecksum(*entry, full)
+		if err != nil {
+			t.Fatalf("verifyChecksum(%s) failed: %v", path, err)
+		}
+		if got != want {
+			t.Errorf("verifyChecksum(%s, full=%v) = %s, want %s", filepath.Base(path), full, got, want)
+		}
+	}
+
+	untouched := record("untouched.bin", "hello")
+	check(untouched, false, verifyOK)
+	check(untouched, true, verifyOK)
+
+	// Touched but identical: still fine, and the new time is remembered
+	touched := record("touched.bin", "hello")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(touched, later, later); err != nil {
+		t.Fatal(err)
+	}
+	check(touched, false, verifyOK)
+	if entry, _ := state.GetChecksum(touched); entry.ModTime != later.UnixNano() {
+		t.Errorf("recorded mtime = %d, want the touched one %d", entry.ModTime, later.UnixNano())
+	}
+
+	// Same size, different content
+	edited := record("edited.bin", "hello")
+	if err := os.WriteFile(edited, []byte("HELLO"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(edited, later, later)
+	check(edited, false, verifyChanged)
+
+	// Content swapped with the time kept is only caught by a full check
+	sneaky := record("sneaky.bin", "hello")
+	info, _ := os.Stat(sneaky)
+	os.WriteFile(sneaky, []byte("jello"), 0644)
+	os.Chtimes(sneaky, info.ModTime(), info.ModTime())
+	check(sneaky, false, verifyOK)
+	check(sneaky, true, verifyChanged)
+
+	missing := record("missing.bin", "hello")
+	os.Remove(missing)
+	check(missing, false, verifyMissing)
+}
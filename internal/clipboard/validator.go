@@ -2,6 +2,7 @@ package clipboard
 
 import (
 	"net/url"
+	"path"
 	"strings"
 
 	"github.com/atotto/clipboard"
@@ -50,3 +51,28 @@ func ReadURL() string {
 	validator := NewValidator()
 	return validator.ExtractURL(text)
 }
+
+// downloadExtensions are file types worth offering to download when their
+// link is copied, like IDM's capture list. Links to web pages are not.
+var downloadExtensions = map[string]bool{
+	// Archives and disk images
+	".zip": true, ".rar": true, ".7z": true, ".tar": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true,
+	".iso": true, ".img": true, ".dmg": true,
+	// Installers and packages
+	".exe": true, ".msi": true, ".msix": true, ".pkg": true, ".deb": true, ".rpm": true, ".apk": true, ".appimage": true, ".flatpakref": true,
+	// Video and audio
+	".mp4": true, ".mkv": true, ".avi": true, ".mov": true, ".webm": true, ".m4v": true,
+	".mp3": true, ".flac": true, ".wav": true, ".ogg": true, ".m4a": true, ".aac": true, ".opus": true,
+	// Documents and data
+	".pdf": true, ".epub": true, ".torrent": true, ".bin": true, ".gguf": true, ".safetensors": true,
+}
+
+// Downloadable reports whether rawURL looks like a link to a file, going by
+// the extension of its path
+func Downloadable(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return downloadExtensions[strings.ToLower(path.Ext(u.Path))]
+}
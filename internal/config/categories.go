@@ -0,0 +1,113 @@
+package config
+
+import (
+	"mime"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Category is a kind of file, such as videos, that SortIntoFolders saves in
+// a folder of its own. A file belongs to the first category listing its
+// extension or, failing that, its MIME type.
+type Category struct {
+	Name       string   `json:"name"`
+	Folder     string   `json:"folder"`               // Relative to the download directory, or absolute
+	Extensions []string `json:"extensions,omitempty"` // With or without the dot, e.g. ".mp4" or "mp4"
+	MIMETypes  []string `json:"mime_types,omitempty"` // e.g. "video/mp4", or "video/*" for any video
+}
+
+// DefaultCategories returns the categories used when Categories is unset
+func DefaultCategories() []Category {
+	return []Category{
+		{
+			Name: "Videos", Folder: "Videos",
+			Extensions: []string{".mp4", ".mkv", ".avi", ".mov", ".webm", ".m4v", ".wmv", ".flv", ".mpg", ".mpeg", ".ts"},
+			MIMETypes:  []string{"video/*"},
+		},
+		{
+			Name: "Music", Folder: "Music",
+			Extensions: []string{".mp3", ".flac", ".wav", ".aac", ".ogg", ".oga", ".opus", ".m4a", ".wma"},
+			MIMETypes:  []string{"audio/*"},
+		},
+		{
+			Name: "Images", Folder: "Images",
+			Extensions: []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".bmp", ".tif", ".tiff", ".heic", ".avif"},
+			MIMETypes:  []string{"image/*"},
+		},
+		{
+			Name: "Archives", Folder: "Archives",
+			Extensions: []string{".zip", ".rar", ".7z", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".iso", ".img", ".dmg"},
+			MIMETypes:  []string{"application/zip", "application/x-7z-compressed", "application/vnd.rar", "application/x-rar-compressed", "application/x-tar", "application/gzip", "application/x-xz", "application/zstd", "application/x-iso9660-image"},
+		},
+		{
+			Name: "Documents", Folder: "Documents",
+			Extensions: []string{".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".odt", ".ods", ".odp", ".rtf", ".txt", ".csv", ".epub", ".md"},
+			MIMETypes:  []string{"application/pdf", "application/msword", "application/epub+zip", "text/plain", "text/csv", "application/vnd.openxmlformats-officedocument.*", "application/vnd.oasis.opendocument.*"},
+		},
+		{
+			Name: "Programs", Folder: "Programs",
+			Extensions: []string{".exe", ".msi", ".deb", ".rpm", ".apk", ".appimage", ".pkg", ".flatpak", ".snap"},
+			MIMETypes:  []string{"application/x-msdownload", "application/x-msi", "application/vnd.debian.binary-package", "application/x-rpm", "application/vnd.android.package-archive"},
+		},
+	}
+}
+
+// FileCategories returns the categories files are sorted and filtered by
+func (g GeneralSettings) FileCategories() []Category {
+	if len(g.Categories) > 0 {
+		return g.Categories
+	}
+	return DefaultCategories()
+}
+
+// SortFolder returns the folder SortIntoFolders saves a file of filename and
+// contentType (the Content-Type header, if known) in, or "" when sorting is
+// off or the file fits no category
+func (g GeneralSettings) SortFolder(filename, contentType string) string {
+	if !g.SortIntoFolders {
+		return ""
+	}
+	if c, ok := MatchCategory(g.FileCategories(), filename, contentType); ok {
+		return c.Folder
+	}
+	return ""
+}
+
+// MatchCategory returns the category of a file, see Category
+func MatchCategory(categories []Category, filename, contentType string) (Category, bool) {
+	if ext := strings.ToLower(filepath.Ext(filename)); ext != "" {
+		for _, c := range categories {
+			if slices.ContainsFunc(c.Extensions, func(e string) bool {
+				return "."+strings.TrimPrefix(strings.ToLower(e), ".") == ext
+			}) {
+				return c, true
+			}
+		}
+	}
+	// Servers label many files application/octet-stream, which says nothing
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		return Category{}, false
+	}
+	for _, c := range categories {
+		if slices.ContainsFunc(c.MIMETypes, func(pattern string) bool {
+			ok, _ := path.Match(strings.ToLower(pattern), mediaType)
+			return ok
+		}) {
+			return c, true
+		}
+	}
+	return Category{}, false
+}
+
+// CategoryNamed returns the category called name, ignoring case
+func CategoryNamed(categories []Category, name string) (Category, bool) {
+	for _, c := range categories {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Category{}, false
+}
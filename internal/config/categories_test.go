@@ -0,0 +1,54 @@
+package config
+
+import "testing"
+
+func TestMatchCategory(t *testing.T) {
+	categories := DefaultCategories()
+	tests := []struct {
+		filename, contentType string
+		want                  string
+	}{
+		{"movie.MKV", "", "Videos"},
+		{"song.mp3", "application/octet-stream", "Music"},
+		{"report.pdf", "text/html", "Documents"}, // The extension wins
+		{"download", "video/mp4; codecs=avc1", "Videos"},
+		{"sheet", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "Documents"},
+		{"blob", "application/octet-stream", ""},
+		{"readme", "", ""},
+		{"page.html", "text/html", ""},
+	}
+	for _, tt := range tests {
+		c, ok := MatchCategory(categories, tt.filename, tt.contentType)
+		if ok != (tt.want != "") || c.Name != tt.want {
+			t.Errorf("MatchCategory(%q, %q) = %q, %v; want %q", tt.filename, tt.contentType, c.Name, ok, tt.want)
+		}
+	}
+
+	custom := []Category{{Name: "Books", Folder: "/srv/books", Extensions: []string{"EPUB", "mobi"}}}
+	if c, ok := MatchCategory(custom, "novel.epub", ""); !ok || c.Name != "Books" {
+		t.Errorf("extension without a dot not matched: %q, %v", c.Name, ok)
+	}
+}
+
+func TestSortFolder(t *testing.T) {
+	g := DefaultSettings().General
+	if got := g.SortFolder("a.zip", ""); got != "" {
+		t.Errorf("SortFolder with sorting off = %q, want none", got)
+	}
+
+	g.SortIntoFolders = true
+	if got := g.SortFolder("a.zip", ""); got != "Archives" {
+		t.Errorf("SortFolder(a.zip) = %q, want Archives", got)
+	}
+	if got := g.SortFolder("a.unknown", ""); got != "" {
+		t.Errorf("SortFolder(a.unknown) = %q, want none", got)
+	}
+
+	g.Categories = []Category{{Name: "Disk images", Folder: "ISOs", Extensions: []string{".iso"}}}
+	if got := g.SortFolder("a.iso", ""); got != "ISOs" {
+		t.Errorf("SortFolder with custom categories = %q, want ISOs", got)
+	}
+	if got := g.SortFolder("a.zip", ""); got != "" {
+		t.Errorf("custom categories kept the defaults: %q", got)
+	}
+}
@@ -6,6 +6,15 @@ import (
 	"runtime"
 )
 
+// Environment variables that move surge's writable files elsewhere, e.g. onto
+// a volume when running in a container with a read-only root filesystem.
+// The --state-dir and --cache-dir flags set them.
+const (
+	EnvStateDir = "SURGE_STATE_DIR"
+	EnvCacheDir = "SURGE_CACHE_DIR"
+)
+
+// GetSurgeDir returns the config directory holding settings.json
 func GetSurgeDir() string {
 	switch runtime.GOOS {
 	case "windows":
@@ -29,17 +38,39 @@ func GetSurgeDir() string {
 
 // Returns directory for state files
 func GetStateDir() string {
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return filepath.Clean(dir)
+	}
 	return filepath.Join(GetSurgeDir(), "state")
 }
 
+// GetCacheDir returns the directory for logs and the files a running instance
+// leaves for other commands (lock, pid, port, token). Without SURGE_CACHE_DIR
+// it follows SURGE_STATE_DIR, so one volume can hold everything surge writes.
+func GetCacheDir() string {
+	if dir := os.Getenv(EnvCacheDir); dir != "" {
+		return filepath.Clean(dir)
+	}
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return filepath.Clean(dir)
+	}
+	return GetSurgeDir()
+}
+
+// GetPluginsDir returns the directory plugins are discovered in
+func GetPluginsDir() string {
+	return filepath.Join(GetSurgeDir(), "plugins")
+}
+
 // Returns directory for logs
 func GetLogsDir() string {
-	return filepath.Join(GetSurgeDir(), "logs")
+	return filepath.Join(GetCacheDir(), "logs")
 }
 
-// EnsureDirs creates all required directories
+// EnsureDirs creates all required directories. The config directory is only
+// created when it also holds the cache, as it may be read-only otherwise.
 func EnsureDirs() error {
-	dirs := []string{GetSurgeDir(), GetStateDir(), GetLogsDir()}
+	dirs := []string{GetStateDir(), GetCacheDir(), GetLogsDir()}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return err
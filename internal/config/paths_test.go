@@ -156,3 +156,40 @@ func TestPathsNoTrailingSlash(t *testing.T) {
 		}
 	}
 }
+
+func TestStateAndCacheDirOverrides(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempDir, "readonly"))
+	stateDir := filepath.Join(tempDir, "data")
+
+	// The state dir alone moves everything surge writes
+	t.Setenv(EnvStateDir, stateDir+string(filepath.Separator))
+	t.Setenv(EnvCacheDir, "")
+	if got := GetStateDir(); got != stateDir {
+		t.Errorf("GetStateDir() = %s, want %s", got, stateDir)
+	}
+	if got := GetCacheDir(); got != stateDir {
+		t.Errorf("GetCacheDir() = %s, want it to follow the state dir %s", got, stateDir)
+	}
+	if got := GetLogsDir(); got != filepath.Join(stateDir, "logs") {
+		t.Errorf("GetLogsDir() = %s, want it under %s", got, stateDir)
+	}
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	t.Setenv(EnvCacheDir, cacheDir)
+	if got := GetCacheDir(); got != cacheDir {
+		t.Errorf("GetCacheDir() = %s, want %s", got, cacheDir)
+	}
+
+	if err := EnsureDirs(); err != nil {
+		t.Fatalf("EnsureDirs failed: %v", err)
+	}
+	for _, dir := range []string{stateDir, cacheDir, filepath.Join(cacheDir, "logs")} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("directory not created: %s", dir)
+		}
+	}
+	if _, err := os.Stat(GetSurgeDir()); !os.IsNotExist(err) {
+		t.Errorf("config dir %s should be left alone when state and cache are elsewhere", GetSurgeDir())
+	}
+}
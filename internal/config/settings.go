@@ -26,6 +26,65 @@ type GeneralSettings struct {
 	ClipboardMonitor       bool   `json:"clipboard_monitor"`
 	Theme                  int    `json:"theme"`
 	LogRetentionCount      int    `json:"log_retention_count"`
+	KeepPartialOnCancel    bool   `json:"keep_partial_on_cancel"`
+	PartFilesInSubdir      bool   `json:"part_files_in_subdir"`
+	WriteStrategy          string `json:"write_strategy"`
+	SparseFiles            bool   `json:"sparse_files"` // Leave files sparse instead of reserving their full size up front
+	MarkExecutable         bool   `json:"mark_executable"`
+	FixExtensions          bool   `json:"fix_extensions"`        // Rename completed files whose content shows a missing or page (.php, .html) extension
+	ClearCompletedAfter    int    `json:"clear_completed_after"` // Hours a completed download stays in the list; 0 keeps it
+	SortIntoFolders        bool   `json:"sort_into_folders"`     // Save files in a folder per category, see FileCategories
+	MaxFilenameLength      int    `json:"max_filename_length"`   // Longest name in bytes a download is saved under
+	FilenameTruncation     string `json:"filename_truncation"`   // How longer names are cut: hash or end
+
+	// Categories are the kinds of file SortIntoFolders sorts by and the
+	// search's cat: filter knows; DefaultCategories when unset. Like
+	// Ownership, they are only set in settings.json.
+	Categories []Category `json:"categories,omitempty"`
+
+	// Ownership chowns completed files by destination when Surge runs as root.
+	// It has no settings screen entry; edit settings.json to change it.
+	Ownership []OwnershipRule `json:"ownership,omitempty"`
+
+	// Hooks are external programs run as downloads are added, complete or fail.
+	// Like Ownership, they are only set in settings.json.
+	Hooks HookSettings `json:"hooks,omitzero"`
+
+	// AfterDownload is what Surge does as each download ends. Only Notify
+	// has a settings screen entry; --on-complete and --notify add to it for a run.
+	AfterDownload AfterDownloadSettings `json:"after_download,omitzero"`
+}
+
+// AfterDownloadSettings are the post-download actions of every download
+type AfterDownloadSettings struct {
+	OnComplete string `json:"on_complete,omitempty"` // Shell command run after a completed download, with {path}, {dir}, {filename}, {url} and {id} filled in
+	Notify     bool   `json:"notify,omitempty"`      // Show a desktop notification when a download completes or fails
+}
+
+// CompletedExpired reports whether a download that completed at completedAt
+// has outstayed ClearCompletedAfter and belongs in history only. Downloads
+// of unknown completion time never expire.
+func (g GeneralSettings) CompletedExpired(completedAt, now time.Time) bool {
+	if g.ClearCompletedAfter <= 0 || completedAt.IsZero() {
+		return false
+	}
+	return now.Sub(completedAt) >= time.Duration(g.ClearCompletedAfter)*time.Hour
+}
+
+// HookSettings names the executable run for each download event. See the
+// hooks package for what the programs receive and may print.
+type HookSettings struct {
+	OnEnqueue  string `json:"on_enqueue,omitempty"`
+	OnComplete string `json:"on_complete,omitempty"`
+	OnError    string `json:"on_error,omitempty"`
+}
+
+// OwnershipRule gives files completed under Path to UID and GID.
+// A negative ID leaves that part of the ownership unchanged.
+type OwnershipRule struct {
+	Path string `json:"path"`
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
 }
 
 const (
@@ -37,8 +96,62 @@ const (
 // ConnectionSettings contains network connection parameters.
 type ConnectionSettings struct {
 	MaxConnectionsPerHost int    `json:"max_connections_per_host"`
+	AdaptiveConnections   bool   `json:"adaptive_connections"`
 	MaxGlobalConnections  int    `json:"max_global_connections"`
+	SchedulingPolicy      string `json:"scheduling_policy"`
+	SpeedLimit            int    `json:"speed_limit"` // KB/s shared by all downloads; 0 for no limit
 	UserAgent             string `json:"user_agent"`
+	MaxRedirects          int    `json:"max_redirects"`
+	BlockPrivateNetworks  bool   `json:"block_private_networks"`
+	Proxy                 string `json:"proxy"`
+	SSHIdentityFile       string `json:"ssh_identity_file"`
+	SSHKnownHosts         string `json:"ssh_known_hosts"`
+
+	// URL restrictions applied before a download is queued, for managed
+	// installs. They have no settings screen entry; see CheckURL.
+	AllowedSchemes []string `json:"allowed_schemes,omitempty"`
+	AllowedHosts   []string `json:"allowed_hosts,omitempty"`
+	BlockedHosts   []string `json:"blocked_hosts,omitempty"`
+
+	// AllowedNetworks lists CIDRs (e.g. "10.1.0.0/16") that stay reachable
+	// when BlockPrivateNetworks is on. Edit settings.json to change it.
+	AllowedNetworks []string `json:"allowed_networks,omitempty"`
+
+	// OAuth lists the APIs downloads sign in to with `surge auth login`.
+	// Edit settings.json to change it.
+	OAuth []OAuthProvider `json:"oauth,omitempty"`
+
+	// Credentials log downloads in to hosts that need a password or token.
+	// Edit settings.json to change it.
+	Credentials []HostCredential `json:"credentials,omitempty"`
+}
+
+// SpeedLimitRate returns SpeedLimit in bytes/sec, 0 for no limit
+func (c ConnectionSettings) SpeedLimitRate() int64 {
+	return int64(max(c.SpeedLimit, 0)) * 1024
+}
+
+// HostCredential is the login of some hosts: a user and password for basic
+// authentication, or a bearer token. Password and Token are best given as
+// "keyring:<name>", naming a secret stored with `surge secret set`.
+type HostCredential struct {
+	Hosts    []string `json:"hosts"` // Subdomains included
+	User     string   `json:"user,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Token    string   `json:"token,omitempty"`
+}
+
+// OAuthProvider is an OAuth 2.0 API whose hosts are sent access tokens.
+// For "google" and "microsoft" only ClientID is needed; the oauth package
+// knows their endpoints, Drive/OneDrive scopes and API hosts.
+type OAuthProvider struct {
+	Name          string   `json:"name"`
+	ClientID      string   `json:"client_id"`
+	ClientSecret  string   `json:"client_secret,omitempty"` // Google issues one even to device clients; may be "keyring:<name>"
+	DeviceAuthURL string   `json:"device_auth_url,omitempty"`
+	TokenURL      string   `json:"token_url,omitempty"`
+	Scopes        []string `json:"scopes,omitempty"`
+	Hosts         []string `json:"hosts,omitempty"` // Hosts sent the token; subdomains included
 }
 
 // ChunkSettings contains download chunk configuration.
@@ -47,6 +160,7 @@ type ChunkSettings struct {
 	MaxChunkSize     int64 `json:"max_chunk_size"`
 	TargetChunkSize  int64 `json:"target_chunk_size"`
 	WorkerBufferSize int   `json:"worker_buffer_size"`
+	MaxBufferMemory  int64 `json:"max_buffer_memory"`
 }
 
 // PerformanceSettings contains performance tuning parameters.
@@ -56,6 +170,10 @@ type PerformanceSettings struct {
 	SlowWorkerGracePeriod time.Duration `json:"slow_worker_grace_period"`
 	StallTimeout          time.Duration `json:"stall_timeout"`
 	SpeedEmaAlpha         float64       `json:"speed_ema_alpha"`
+	RetryBaseDelay        time.Duration `json:"retry_base_delay"`
+	RetryMaxDelay         time.Duration `json:"retry_max_delay"`
+	RetryJitter           float64       `json:"retry_jitter"`
+	AutosaveInterval      time.Duration `json:"autosave_interval"`
 }
 
 // SettingMeta provides metadata for a single setting (for UI rendering).
@@ -75,21 +193,41 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 			{Key: "extension_prompt", Label: "Extension Prompt", Description: "Prompt for confirmation when adding downloads via browser extension.", Type: "bool"},
 			{Key: "auto_resume", Label: "Auto Resume", Description: "Automatically resume paused downloads on startup.", Type: "bool"},
 			{Key: "skip_update_check", Label: "Skip Update Check", Description: "Disable automatic check for new versions on startup.", Type: "bool"},
-			{Key: "max_concurrent_downloads", Label: "Max Concurrent Downloads", Description: "Maximum number of downloads running at once (1-10). Requires restart.", Type: "int"},
+			{Key: "max_concurrent_downloads", Label: "Max Concurrent Downloads", Description: "Maximum number of downloads running at once (1-32). Lowering it lets running downloads finish first.", Type: "int"},
 			{Key: "clipboard_monitor", Label: "Clipboard Monitor", Description: "Watch clipboard for URLs and prompt to download them.", Type: "bool"},
 			{Key: "theme", Label: "App Theme", Description: "UI Theme (System, Light, Dark).", Type: "int"},
 			{Key: "log_retention_count", Label: "Log Retention Count", Description: "Number of recent log files to keep.", Type: "int"},
+			{Key: "keep_partial_on_cancel", Label: "Keep Partial Files", Description: "Keep the incomplete .surge file when a download is removed. When off, partial data is deleted.", Type: "bool"},
+			{Key: "part_files_in_subdir", Label: "Hidden Part Files", Description: "Keep incomplete .surge files in a hidden .surge/ folder inside the download directory instead of next to the download.", Type: "bool"},
+			{Key: "write_strategy", Label: "Write Strategy", Description: "How downloads are written while incomplete: single (one file), parts (one file per range, merged at the end, for SMB/NFS shares where scattered writes are slow), mmap (one file written through a memory mapping, which can save CPU on 10GbE links to fast local disks) or auto (parts where a quick benchmark finds scattered writes slow and the disk has room for the file twice, single otherwise).", Type: "string"},
+			{Key: "sparse_files", Label: "Sparse Files", Description: "Create downloads as sparse files instead of reserving their full size up front, so they only take the space received so far. Free space is still checked before a download starts, but a disk filled by something else fails it midway.", Type: "bool"},
+			{Key: "mark_executable", Label: "Mark Executables", Description: "Make completed programs and scripts (ELF, Mach-O, #! scripts) executable.", Type: "bool"},
+			{Key: "fix_extensions", Label: "Fix Extensions", Description: "Rename a completed download whose extension is missing or is that of the page that served it (.php, .aspx, .html...) to what its content is, e.g. get.php to get.zip.", Type: "bool"},
+			{Key: "notify", Label: "Desktop Notifications", Description: "Show a desktop notification when a download completes or fails, e.g. \"file.iso finished, 4m32s, sha256 OK\". On Linux this needs notify-send.", Type: "bool"},
+			{Key: "clear_completed_after", Label: "Clear Completed After", Description: "Hours a completed download stays in the list before moving to history (h). 0 keeps completed downloads in the list.", Type: "int"},
+			{Key: "sort_into_folders", Label: "Sort Into Folders", Description: "Save new downloads in a folder per kind of file inside the download directory: Videos, Music, Images, Archives, Documents or Programs. Edit categories in settings.json to change them.", Type: "bool"},
+			{Key: "max_filename_length", Label: "Max Filename Length", Description: "Longest name, in bytes, a download is saved under (32-255). Longer names, such as some servers send, are shortened keeping the extension.", Type: "int"},
+			{Key: "filename_truncation", Label: "Filename Truncation", Description: "How names over Max Filename Length are shortened: hash (cut and add a short hash of the full name before the extension, so similar names stay apart) or end (just cut).", Type: "string"},
 		},
 		"Connections": {
 			{Key: "max_connections_per_host", Label: "Max Connections/Host", Description: "Maximum concurrent connections per host (1-64).", Type: "int"},
-			{Key: "max_global_connections", Label: "Max Global Connections", Description: "Maximum total concurrent connections across all downloads.", Type: "int"},
+			{Key: "adaptive_connections", Label: "Adaptive Connections", Description: "Start with a few connections and add more while they speed the download up, backing off when the server answers 429 or 503. Max Connections/Host is the upper bound.", Type: "bool"},
+			{Key: "max_global_connections", Label: "Max Global Connections", Description: "Maximum total concurrent connections across all downloads, 0 for no limit. Every running download keeps at least one, so once each has one, further downloads wait in the queue.", Type: "int"},
+			{Key: "speed_limit", Label: "Speed Limit", Description: "Total download speed across all downloads in KB/s (e.g., 5120 for 5 MB/s), split between the running downloads. 0 for no limit.", Type: "int"},
+			{Key: "scheduling_policy", Label: "Scheduling Policy", Description: "How Max Global Connections is shared between running downloads, which follow their shares as downloads start and finish: fair (evenly), sequential (earlier downloads first) or priority-strict (higher priority first, then earlier).", Type: "string"},
 			{Key: "user_agent", Label: "User Agent", Description: "Custom User-Agent string for HTTP requests. Leave empty for default.", Type: "string"},
+			{Key: "max_redirects", Label: "Max Redirects", Description: "Maximum redirects followed for one request.", Type: "int"},
+			{Key: "block_private_networks", Label: "Block Private Networks", Description: "Refuse to connect to loopback, private, link-local and cloud metadata addresses, including via redirects. Use when exposing the server to others.", Type: "bool"},
+			{Key: "proxy", Label: "Proxy", Description: "Proxy for HTTP(S) downloads: http://, https://, socks5:// or socks5h:// URL, with user:password@ if it needs a login, or \"keyring:<name>\" for such a URL stored with `surge secret set`. Leave empty to use HTTP_PROXY/HTTPS_PROXY, or \"none\" to always connect directly.", Type: "string"},
+			{Key: "ssh_identity_file", Label: "SSH Identity File", Description: "Private key for sftp:// downloads, tried after ssh-agent and before the default keys in ~/.ssh. Keys with a passphrase must be loaded into ssh-agent instead. Downloads added through the API by named users or web pages log in with this key only.", Type: "string"},
+			{Key: "ssh_known_hosts", Label: "SSH Known Hosts", Description: "known_hosts file that sftp:// servers are verified against. Leave empty for ~/.ssh/known_hosts.", Type: "string"},
 		},
 		"Chunks": {
 			{Key: "min_chunk_size", Label: "Min Chunk Size", Description: "Minimum download chunk size in MB (e.g., 2).", Type: "int64"},
 			{Key: "max_chunk_size", Label: "Max Chunk Size", Description: "Maximum download chunk size in MB (e.g., 16).", Type: "int64"},
 			{Key: "target_chunk_size", Label: "Target Chunk Size", Description: "Preferred chunk size in MB when splitting downloads.", Type: "int64"},
 			{Key: "worker_buffer_size", Label: "Worker Buffer Size", Description: "I/O buffer size per worker in KB (e.g., 512).", Type: "int"},
+			{Key: "max_buffer_memory", Label: "Max Buffer Memory", Description: "Total MB of worker buffers across all downloads. Extra connections wait for memory instead of exceeding it; each download always gets one.", Type: "int64"},
 		},
 		"Performance": {
 			{Key: "max_task_retries", Label: "Max Task Retries", Description: "Number of times to retry a failed chunk before giving up.", Type: "int"},
@@ -97,6 +235,10 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 			{Key: "slow_worker_grace_period", Label: "Slow Worker Grace", Description: "Grace period before checking worker speed (e.g., 5s).", Type: "duration"},
 			{Key: "stall_timeout", Label: "Stall Timeout", Description: "Restart workers with no data for this duration (e.g., 5s).", Type: "duration"},
 			{Key: "speed_ema_alpha", Label: "Speed EMA Alpha", Description: "Exponential moving average smoothing factor (0.0-1.0).", Type: "float64"},
+			{Key: "retry_base_delay", Label: "Retry Delay", Description: "Wait before retrying a failed chunk (e.g., 0.4s). Doubles with each further retry.", Type: "duration"},
+			{Key: "retry_max_delay", Label: "Max Retry Delay", Description: "Longest wait between retries of a chunk (e.g., 30s).", Type: "duration"},
+			{Key: "retry_jitter", Label: "Retry Jitter", Description: "Randomly vary retry waits by up to this fraction so connections don't retry in lockstep (0.0-1.0).", Type: "float64"},
+			{Key: "autosave_interval", Label: "Autosave Interval", Description: "How often running downloads save their progress and queued downloads are saved (e.g., 10s). Longer intervals write less to SSDs and SD cards but lose more to a crash.", Type: "duration"},
 		},
 	}
 }
@@ -126,17 +268,23 @@ func DefaultSettings() *Settings {
 			ClipboardMonitor:       true,
 			Theme:                  ThemeAdaptive,
 			LogRetentionCount:      5,
+			WriteStrategy:          "auto",
+			MaxFilenameLength:      230,
+			FilenameTruncation:     "hash",
 		},
 		Connections: ConnectionSettings{
 			MaxConnectionsPerHost: 32,
 			MaxGlobalConnections:  100,
+			SchedulingPolicy:      "fair",
 			UserAgent:             "", // Empty means use default UA
+			MaxRedirects:          10,
 		},
 		Chunks: ChunkSettings{
 			MinChunkSize:     2 * MB,
 			MaxChunkSize:     16 * MB,
 			TargetChunkSize:  8 * MB,
 			WorkerBufferSize: 512 * KB,
+			MaxBufferMemory:  128 * MB,
 		},
 		Performance: PerformanceSettings{
 			MaxTaskRetries:        3,
@@ -144,6 +292,10 @@ func DefaultSettings() *Settings {
 			SlowWorkerGracePeriod: 5 * time.Second,
 			StallTimeout:          3 * time.Second,
 			SpeedEmaAlpha:         0.3,
+			RetryBaseDelay:        400 * time.Millisecond,
+			RetryMaxDelay:         30 * time.Second,
+			RetryJitter:           0.2,
+			AutosaveInterval:      10 * time.Second,
 		},
 	}
 }
@@ -201,33 +353,71 @@ func SaveSettings(s *Settings) error {
 // This is used to pass user settings to the download engine
 type RuntimeConfig struct {
 	MaxConnectionsPerHost int
+	AdaptiveConnections   bool
 	MaxGlobalConnections  int
 	UserAgent             string
 	MinChunkSize          int64
 	MaxChunkSize          int64
 	TargetChunkSize       int64
 	WorkerBufferSize      int
+	MaxBufferMemory       int64
 	MaxTaskRetries        int
 	SlowWorkerThreshold   float64
 	SlowWorkerGracePeriod time.Duration
 	StallTimeout          time.Duration
 	SpeedEmaAlpha         float64
+	RetryBaseDelay        time.Duration
+	RetryMaxDelay         time.Duration
+	RetryJitter           float64
+	CheckpointInterval    time.Duration
+	PartFilesInSubdir     bool
+	WriteStrategy         string
+	SparseFiles           bool
+	MaxFilenameLength     int
+	FilenameTruncation    string
+	BlockPrivateNetworks  bool
+	AllowedNetworks       []string
+	MaxRedirects          int
+	Proxy                 string
+	SSHIdentityFile       string
+	SSHKnownHosts         string
+	OAuth                 []OAuthProvider
+	Credentials           []HostCredential
 }
 
 // ToRuntimeConfig creates a RuntimeConfig from user Settings
 func (s *Settings) ToRuntimeConfig() *RuntimeConfig {
 	return &RuntimeConfig{
 		MaxConnectionsPerHost: s.Connections.MaxConnectionsPerHost,
+		AdaptiveConnections:   s.Connections.AdaptiveConnections,
 		MaxGlobalConnections:  s.Connections.MaxGlobalConnections,
 		UserAgent:             s.Connections.UserAgent,
 		MinChunkSize:          s.Chunks.MinChunkSize,
 		MaxChunkSize:          s.Chunks.MaxChunkSize,
 		TargetChunkSize:       s.Chunks.TargetChunkSize,
 		WorkerBufferSize:      s.Chunks.WorkerBufferSize,
+		MaxBufferMemory:       s.Chunks.MaxBufferMemory,
 		MaxTaskRetries:        s.Performance.MaxTaskRetries,
 		SlowWorkerThreshold:   s.Performance.SlowWorkerThreshold,
 		SlowWorkerGracePeriod: s.Performance.SlowWorkerGracePeriod,
 		StallTimeout:          s.Performance.StallTimeout,
 		SpeedEmaAlpha:         s.Performance.SpeedEmaAlpha,
+		RetryBaseDelay:        s.Performance.RetryBaseDelay,
+		RetryMaxDelay:         s.Performance.RetryMaxDelay,
+		RetryJitter:           s.Performance.RetryJitter,
+		CheckpointInterval:    s.Performance.AutosaveInterval,
+		PartFilesInSubdir:     s.General.PartFilesInSubdir,
+		WriteStrategy:         s.General.WriteStrategy,
+		SparseFiles:           s.General.SparseFiles,
+		MaxFilenameLength:     s.General.MaxFilenameLength,
+		FilenameTruncation:    s.General.FilenameTruncation,
+		BlockPrivateNetworks:  s.Connections.BlockPrivateNetworks,
+		AllowedNetworks:       s.Connections.AllowedNetworks,
+		MaxRedirects:          s.Connections.MaxRedirects,
+		Proxy:                 s.Connections.Proxy,
+		SSHIdentityFile:       s.Connections.SSHIdentityFile,
+		SSHKnownHosts:         s.Connections.SSHKnownHosts,
+		OAuth:                 s.Connections.OAuth,
+		Credentials:           s.Connections.Credentials,
 	}
 }
@@ -557,3 +557,20 @@ func TestSaveAndLoadSettings_RoundTrip(t *testing.T) {
 	// Cleanup
 	_ = SaveSettings(DefaultSettings())
 }
+
+func TestCompletedExpired(t *testing.T) {
+	now := time.Now()
+	g := GeneralSettings{ClearCompletedAfter: 24}
+	if !g.CompletedExpired(now.Add(-25*time.Hour), now) {
+		t.Error("a download completed 25h ago should expire after 24h")
+	}
+	if g.CompletedExpired(now.Add(-time.Hour), now) {
+		t.Error("a download completed 1h ago should stay")
+	}
+	if g.CompletedExpired(time.Time{}, now) {
+		t.Error("an unknown completion time should never expire")
+	}
+	if (GeneralSettings{}).CompletedExpired(now.Add(-1000*time.Hour), now) {
+		t.Error("0 should keep completed downloads")
+	}
+}
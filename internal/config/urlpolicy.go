@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ErrURLBlocked is returned by CheckURL for URLs the settings do not allow
+var ErrURLBlocked = errors.New("blocked by settings")
+
+// CheckURL reports whether the connection settings allow downloading from
+// each of urls (a URL and its mirrors).
+//
+// A scheme must be in AllowedSchemes when that list is set, e.g. ["https"]
+// to refuse plain HTTP. A host may not match any BlockedHosts pattern and,
+// when AllowedHosts is set, must match one of those. A pattern matches the
+// host itself and its subdomains ("example.com" covers "dl.example.com"),
+// or is a glob such as "*.example.*". Blocked patterns win over allowed ones.
+func (s *Settings) CheckURL(urls ...string) error {
+	if s == nil {
+		return nil
+	}
+	c := s.Connections
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return err
+		}
+		scheme := strings.ToLower(u.Scheme)
+		host := strings.ToLower(u.Hostname())
+
+		if len(c.AllowedSchemes) > 0 && !slices.ContainsFunc(c.AllowedSchemes, func(s string) bool {
+			return strings.EqualFold(s, scheme)
+		}) {
+			return fmt.Errorf("%w: scheme %q is not in allowed_schemes", ErrURLBlocked, scheme)
+		}
+		if MatchHost(c.BlockedHosts, host) {
+			return fmt.Errorf("%w: host %q is in blocked_hosts", ErrURLBlocked, host)
+		}
+		if len(c.AllowedHosts) > 0 && !MatchHost(c.AllowedHosts, host) {
+			return fmt.Errorf("%w: host %q is not in allowed_hosts", ErrURLBlocked, host)
+		}
+	}
+	return nil
+}
+
+// MatchHost reports whether host matches any of patterns, using the rules
+// described on CheckURL
+func MatchHost(patterns []string, host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if strings.ContainsAny(p, "*?[") {
+			if ok, _ := path.Match(p, host); ok {
+				return true
+			}
+			continue
+		}
+		if host == p || strings.HasSuffix(host, "."+p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		conns   ConnectionSettings
+		urls    []string
+		blocked bool
+	}{
+		{"no restrictions", ConnectionSettings{}, []string{"http://example.com/file"}, false},
+		{"scheme allowed", ConnectionSettings{AllowedSchemes: []string{"https"}}, []string{"https://example.com/file"}, false},
+		{"plain http refused", ConnectionSettings{AllowedSchemes: []string{"HTTPS"}}, []string{"http://example.com/file"}, true},
+		{"blocked domain", ConnectionSettings{BlockedHosts: []string{"bad.test"}}, []string{"https://bad.test/file"}, true},
+		{"blocked subdomain", ConnectionSettings{BlockedHosts: []string{"bad.test"}}, []string{"https://cdn.BAD.test:8443/file"}, true},
+		{"suffix is not a subdomain", ConnectionSettings{BlockedHosts: []string{"bad.test"}}, []string{"https://notbad.test/file"}, false},
+		{"glob pattern", ConnectionSettings{BlockedHosts: []string{"*.tracker.*"}}, []string{"https://a.tracker.example/file"}, true},
+		{"allowed host", ConnectionSettings{AllowedHosts: []string{"example.com"}}, []string{"https://dl.example.com/file"}, false},
+		{"host not allowed", ConnectionSettings{AllowedHosts: []string{"example.com"}}, []string{"https://other.org/file"}, true},
+		{"block wins over allow", ConnectionSettings{AllowedHosts: []string{"example.com"}, BlockedHosts: []string{"dl.example.com"}}, []string{"https://dl.example.com/file"}, true},
+		{"blocked mirror", ConnectionSettings{BlockedHosts: []string{"bad.test"}}, []string{"https://example.com/file", "https://bad.test/file"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := DefaultSettings()
+			s.Connections = tt.conns
+			err := s.CheckURL(tt.urls...)
+			if tt.blocked != errors.Is(err, ErrURLBlocked) {
+				t.Errorf("CheckURL(%v) = %v, blocked want %v", tt.urls, err, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestCheckURL_NilSettings(t *testing.T) {
+	var s *Settings
+	if err := s.CheckURL("http://example.com"); err != nil {
+		t.Errorf("nil settings should allow everything, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package cookies
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// decryptFunc decrypts a value from the encrypted_value column of Chrome's
+// cookie database
+type decryptFunc func(value []byte) ([]byte, error)
+
+// errWrongKey is returned for values a key does not decrypt
+var errWrongKey = errors.New("cookie does not decrypt with the browser's key")
+
+// chromeEpochOffset is the number of microseconds from 1601, where Chrome's
+// timestamps count from, to the Unix epoch
+const chromeEpochOffset = 11644473600 * 1e6
+
+// chromeHashedValueVersion is the first database version that prefixes each
+// decrypted value with the SHA-256 of its host
+const chromeHashedValueVersion = 24
+
+// chromeUserDataDir returns the folder Chrome keeps its profiles in
+func chromeUserDataDir() string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "Google", "Chrome")
+	case "windows":
+		return filepath.Join(os.Getenv("LOCALAPPDATA"), "Google", "Chrome", "User Data")
+	}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(home, ".config")
+	}
+	return filepath.Join(config, "google-chrome")
+}
+
+// chromeCookieDB returns the cookie database of the default profile
+func chromeCookieDB(userDataDir string) (string, error) {
+	for _, path := range []string{
+		filepath.Join(userDataDir, "Default", "Network", "Cookies"),
+		filepath.Join(userDataDir, "Default", "Cookies"), // Before Chrome 96
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("chrome: %w", ErrNoProfile)
+}
+
+func loadChrome() ([]*http.Cookie, error) {
+	dir := chromeUserDataDir()
+	path, err := chromeCookieDB(dir)
+	if err != nil {
+		return nil, err
+	}
+	decrypt, err := chromeDecrypter(dir)
+	if err != nil {
+		return nil, fmt.Errorf("chrome: %w", err)
+	}
+
+	now := time.Now()
+	var cookies []*http.Cookie
+	var failed int
+	var firstErr error
+	err = querySQLite(path, `SELECT host_key, name, value, encrypted_value, path, expires_utc, is_secure, is_httponly,
+		(SELECT value FROM meta WHERE key = 'version') FROM cookies`, func(rows *sql.Rows) error {
+		var c http.Cookie
+		var encrypted []byte
+		var expires, version int64
+		if err := rows.Scan(&c.Domain, &c.Name, &c.Value, &encrypted, &c.Path, &expires, &c.Secure, &c.HttpOnly, &version); err != nil {
+			return err
+		}
+		if expires > 0 {
+			c.Expires = time.UnixMicro(expires - chromeEpochOffset)
+			if c.Expires.Before(now) {
+				return nil
+			}
+		}
+		if c.Value == "" && len(encrypted) > 0 {
+			plain, err := decrypt(encrypted)
+			if err != nil {
+				failed++
+				if firstErr == nil {
+					firstErr = err
+				}
+				return nil
+			}
+			if version >= chromeHashedValueVersion && len(plain) >= 32 {
+				plain = plain[32:]
+			}
+			c.Value = string(plain)
+		}
+		cookies = append(cookies, &c)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("chrome: %w", err)
+	}
+	if failed > 0 {
+		if len(cookies) == 0 {
+			return nil, fmt.Errorf("chrome: decrypting cookies: %w", firstErr)
+		}
+		utils.Debug("chrome: skipped %d cookies that did not decrypt: %v", failed, firstErr)
+	}
+	return cookies, nil
+}
+
+// chromeKey derives the AES key Chrome on macOS and Linux encrypts cookies
+// with from the password it keeps in the keychain
+func chromeKey(password string, iterations int) []byte {
+	key, _ := pbkdf2.Key(sha1.New, password, []byte("saltysalt"), iterations, 16)
+	return key
+}
+
+// decryptCBC decrypts the AES-128-CBC ciphertext of a "v10" or "v11" value,
+// as Chrome on macOS and Linux writes them
+func decryptCBC(key, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errWrongKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, bytes.Repeat([]byte{' '}, aes.BlockSize)).CryptBlocks(plain, ciphertext)
+
+	// PKCS#7 padding; anything else means the key was wrong
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errWrongKey
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// unknownEncryption reports a value in a format the decrypter does not know
+func unknownEncryption(value []byte) error {
+	return fmt.Errorf("unsupported cookie encryption %q", value[:min(3, len(value))])
+}
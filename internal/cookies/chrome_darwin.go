@@ -0,0 +1,24 @@
+package cookies
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// chromeDecrypter decrypts cookies of Chrome on macOS with the password it
+// keeps in the login keychain. macOS asks the user before handing it out.
+func chromeDecrypter(string) (decryptFunc, error) {
+	out, err := exec.Command("security", "find-generic-password", "-w", "-s", "Chrome Safe Storage").Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading Chrome Safe Storage from the keychain: %w", err)
+	}
+	key := chromeKey(strings.TrimRight(string(out), "\n"), 1003)
+	return func(value []byte) ([]byte, error) {
+		if !bytes.HasPrefix(value, []byte("v10")) {
+			return nil, unknownEncryption(value)
+		}
+		return decryptCBC(key, value[3:])
+	}, nil
+}
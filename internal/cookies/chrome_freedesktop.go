@@ -0,0 +1,48 @@
+//go:build linux || freebsd || openbsd || netbsd || dragonfly
+
+package cookies
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// chromeDecrypter decrypts cookies of Chrome on Linux. "v10" values use a
+// fixed password; "v11" ones use the password Chrome keeps in the Secret
+// Service keyring (GNOME Keyring, KWallet's bridge), read with secret-tool.
+func chromeDecrypter(string) (decryptFunc, error) {
+	v10 := chromeKey("peanuts", 1)
+	var v11 []byte
+	var v11Err error
+	var once sync.Once
+	return func(value []byte) ([]byte, error) {
+		switch {
+		case bytes.HasPrefix(value, []byte("v10")):
+			return decryptCBC(v10, value[3:])
+		case bytes.HasPrefix(value, []byte("v11")):
+			once.Do(func() { v11, v11Err = keyringKey() })
+			if v11Err != nil {
+				return nil, v11Err
+			}
+			return decryptCBC(v11, value[3:])
+		}
+		return nil, unknownEncryption(value)
+	}, nil
+}
+
+// keyringKey derives the "v11" key from the password in the keyring
+func keyringKey() ([]byte, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, errors.New("reading chrome's password from the keyring needs secret-tool (libsecret)")
+	}
+	out, err := exec.Command(path, "lookup", "application", "chrome").Output()
+	password := strings.TrimRight(string(out), "\n")
+	if err != nil || password == "" {
+		return nil, errors.New("chrome's password is not in the keyring")
+	}
+	return chromeKey(password, 1), nil
+}
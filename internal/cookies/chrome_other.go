@@ -0,0 +1,14 @@
+//go:build !linux && !freebsd && !openbsd && !netbsd && !dragonfly && !darwin && !windows
+
+package cookies
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// chromeDecrypter is unsupported on this OS
+func chromeDecrypter(string) (decryptFunc, error) {
+	return nil, fmt.Errorf("chrome cookies on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+}
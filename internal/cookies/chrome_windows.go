@@ -0,0 +1,93 @@
+package cookies
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// chromeDecrypter decrypts cookies of Chrome on Windows. "v10" values use
+// AES-256-GCM with a key from the "Local State" file, itself protected with
+// DPAPI for the current user; older values are DPAPI blobs. The app-bound
+// "v20" values of Chrome 127 and later only Chrome itself can decrypt.
+func chromeDecrypter(userDataDir string) (decryptFunc, error) {
+	var key []byte
+	var keyErr error
+	var once sync.Once
+	return func(value []byte) ([]byte, error) {
+		switch {
+		case bytes.HasPrefix(value, []byte("v10")), bytes.HasPrefix(value, []byte("v11")):
+			once.Do(func() { key, keyErr = localStateKey(userDataDir) })
+			if keyErr != nil {
+				return nil, keyErr
+			}
+			return decryptGCM(key, value[3:])
+		case bytes.HasPrefix(value, []byte("v20")):
+			return nil, errors.New("app-bound encrypted cookies (Chrome 127 and later) cannot be read by other programs")
+		}
+		return dpapiDecrypt(value)
+	}, nil
+}
+
+// localStateKey reads the cookie key from Chrome's "Local State" file
+func localStateKey(userDataDir string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(userDataDir, "Local State"))
+	if err != nil {
+		return nil, err
+	}
+	var localState struct {
+		OSCrypt struct {
+			EncryptedKey string `json:"encrypted_key"`
+		} `json:"os_crypt"`
+	}
+	if err := json.Unmarshal(data, &localState); err != nil {
+		return nil, err
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(localState.OSCrypt.EncryptedKey)
+	if err != nil || !bytes.HasPrefix(encrypted, []byte("DPAPI")) {
+		return nil, errors.New("no cookie key in Local State")
+	}
+	return dpapiDecrypt(encrypted[len("DPAPI"):])
+}
+
+func decryptGCM(key, value []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) < gcm.NonceSize() {
+		return nil, errWrongKey
+	}
+	plain, err := gcm.Open(nil, value[:gcm.NonceSize()], value[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errWrongKey
+	}
+	return plain, nil
+}
+
+// dpapiDecrypt decrypts data protected for the current Windows user
+func dpapiDecrypt(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errWrongKey
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, 0, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return bytes.Clone(unsafe.Slice(out.Data, out.Size)), nil
+}
@@ -0,0 +1,106 @@
+// Package cookies reads the cookies a local web browser keeps, so downloads
+// behind a login work without exporting them by hand, and cookies.txt files
+// for when they were. The browser's database is copied before it is read, so
+// a running browser is no obstacle.
+package cookies
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Browsers lists the browsers Load reads
+var Browsers = []string{"chrome", "firefox"}
+
+// ErrNoProfile is returned when the browser has no cookie database for the user
+var ErrNoProfile = errors.New("no browser profile found")
+
+// Load returns the unexpired cookies of browser's default profile. Domain
+// keeps the browser's notation: a leading "." for cookies subdomains get
+// too, none for host-only cookies.
+func Load(browser string) ([]*http.Cookie, error) {
+	switch strings.ToLower(browser) {
+	case "chrome":
+		return loadChrome()
+	case "firefox":
+		return loadFirefox()
+	}
+	return nil, fmt.Errorf("unsupported browser %q: want %s", browser, strings.Join(Browsers, " or "))
+}
+
+// ForHosts returns the cookies a browser would send to any of hosts
+func ForHosts(cookies []*http.Cookie, hosts ...string) []*http.Cookie {
+	var matched []*http.Cookie
+	for _, c := range cookies {
+		domain := strings.ToLower(c.Domain)
+		for _, host := range hosts {
+			host = strings.ToLower(host)
+			if host == strings.TrimPrefix(domain, ".") || (strings.HasPrefix(domain, ".") && strings.HasSuffix(host, domain)) {
+				matched = append(matched, c)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// querySQLite runs query on a copy of the database at path, with its
+// write-ahead log so cookies the browser set moments ago are included, and
+// calls scan for every row
+func querySQLite(path, query string, scan func(*sql.Rows) error) error {
+	dir, err := os.MkdirTemp("", "surge-cookies-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	dbCopy := filepath.Join(dir, "cookies.db")
+	if err := copyFile(path, dbCopy); err != nil {
+		return err
+	}
+	if err := copyFile(path+"-wal", dbCopy+"-wal"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", dbCopy)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,204 @@
+package cookies
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createDB creates an SQLite database at path from statements
+func createDB(t *testing.T, path string, statements ...string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+}
+
+func byName(cookies []*http.Cookie) map[string]*http.Cookie {
+	m := make(map[string]*http.Cookie)
+	for _, c := range cookies {
+		m[c.Name] = c
+	}
+	return m
+}
+
+func TestLoad_Firefox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("profile layout under a fake HOME is the Linux one")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	future := time.Now().Add(time.Hour).Unix()
+	createDB(t, filepath.Join(home, ".mozilla", "firefox", "abc.default-release", "cookies.sqlite"),
+		"CREATE TABLE moz_cookies (host TEXT, name TEXT, value TEXT, path TEXT, expiry INTEGER, isSecure INTEGER, isHttpOnly INTEGER)",
+		"INSERT INTO moz_cookies VALUES ('.example.com', 'session', 's3cret', '/', "+itoa(future)+", 1, 1)",
+		"INSERT INTO moz_cookies VALUES ('files.example.com', 'ms', 'v', '/dl', "+itoa(future*1000)+", 0, 0)",
+		"INSERT INTO moz_cookies VALUES ('example.com', 'old', 'v', '/', 1000, 0, 0)",
+	)
+
+	cookies, err := Load("Firefox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := byName(cookies)
+	if len(got) != 2 || got["old"] != nil {
+		t.Fatalf("got %d cookies %v, want the 2 unexpired ones", len(cookies), cookies)
+	}
+	s := got["session"]
+	if s.Value != "s3cret" || s.Domain != ".example.com" || !s.Secure || !s.HttpOnly || s.Expires.Unix() != future {
+		t.Errorf("session cookie = %+v", s)
+	}
+	if ms := got["ms"]; ms.Path != "/dl" || ms.Expires.Unix() != future {
+		t.Errorf("cookie with expiry in milliseconds = %+v", ms)
+	}
+}
+
+func TestLoad_Chrome(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fixed v10 password is the Linux one")
+	}
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	// Values as Chrome 130 on Linux writes them: the SHA-256 of the host, then
+	// the value, encrypted with the "peanuts" key
+	encrypt := func(host, value string) string {
+		hash := sha256.Sum256([]byte(host))
+		plain := append(hash[:], value...)
+		pad := aes.BlockSize - len(plain)%aes.BlockSize
+		plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+		block, _ := aes.NewCipher(chromeKey("peanuts", 1))
+		ct := make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, bytes.Repeat([]byte{' '}, aes.BlockSize)).CryptBlocks(ct, plain)
+		return fmt.Sprintf("X'%X'", append([]byte("v10"), ct...))
+	}
+	future := time.Now().Add(time.Hour)
+	futureUTC := itoa(future.UnixMicro() + chromeEpochOffset)
+	createDB(t, filepath.Join(config, "google-chrome", "Default", "Network", "Cookies"),
+		"CREATE TABLE meta (key TEXT, value TEXT)",
+		"INSERT INTO meta VALUES ('version', '24')",
+		"CREATE TABLE cookies (host_key TEXT, name TEXT, value TEXT, encrypted_value BLOB, path TEXT, expires_utc INTEGER, is_secure INTEGER, is_httponly INTEGER)",
+		"INSERT INTO cookies VALUES ('.example.com', 'session', '', "+encrypt(".example.com", "s3cret")+", '/', "+futureUTC+", 1, 1)",
+		"INSERT INTO cookies VALUES ('example.com', 'plain', 'visible', X'', '/', 0, 0, 0)",
+		"INSERT INTO cookies VALUES ('example.com', 'expired', 'v', X'', '/', 1, 0, 0)",
+		"INSERT INTO cookies VALUES ('example.com', 'garbled', '', X'763130deadbeef', '/', 0, 0, 0)",
+	)
+
+	cookies, err := Load("chrome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := byName(cookies)
+	if len(got) != 2 {
+		t.Fatalf("got %d cookies %v, want session and plain", len(cookies), cookies)
+	}
+	s := got["session"]
+	if s.Value != "s3cret" || s.Domain != ".example.com" || !s.Secure || s.Expires.Unix() != future.Unix() {
+		t.Errorf("session cookie = %+v", s)
+	}
+	if p := got["plain"]; p.Value != "visible" || !p.Expires.IsZero() {
+		t.Errorf("plain session cookie = %+v", p)
+	}
+}
+
+func TestLoad_NoProfile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+	for _, browser := range Browsers {
+		if _, err := Load(browser); !errors.Is(err, ErrNoProfile) {
+			t.Errorf("Load(%q) = %v, want ErrNoProfile", browser, err)
+		}
+	}
+	if _, err := Load("netscape"); err == nil {
+		t.Error("Load accepted an unknown browser")
+	}
+}
+
+func TestForHosts(t *testing.T) {
+	all := []*http.Cookie{
+		{Name: "domain", Domain: ".example.com"},
+		{Name: "host", Domain: "example.com"},
+		{Name: "sub", Domain: "cdn.example.com"},
+		{Name: "other", Domain: ".other.org"},
+	}
+	tests := []struct {
+		hosts []string
+		want  []string
+	}{
+		{[]string{"example.com"}, []string{"domain", "host"}},
+		{[]string{"CDN.example.com"}, []string{"domain", "sub"}},
+		{[]string{"notexample.com"}, nil},
+		{[]string{"a.b.example.com", "other.org"}, []string{"domain", "other"}},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range ForHosts(all, tt.hosts...) {
+			got = append(got, c.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ForHosts(%v) = %v, want %v", tt.hosts, got, tt.want)
+		}
+	}
+}
+
+func itoa(n int64) string { return strconv.FormatInt(n, 10) }
+
+func TestParseNetscape(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	file := "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		".example.com\tTRUE\t/\tTRUE\t1800000000\tsession\ts3cret\n" +
+		"#HttpOnly_files.example.com\tFALSE\t/dl\tFALSE\t0\tauth\ttok\r\n" +
+		"example.com\tFALSE\t/\tFALSE\t1600000000\told\tv\n" +
+		"example.com\tFALSE\t/\tFALSE\t0\tempty\n"
+	cookies, err := parseNetscape(strings.NewReader(file), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := byName(cookies)
+	if len(got) != 3 || got["old"] != nil {
+		t.Fatalf("got %v, want the 3 unexpired cookies", cookies)
+	}
+	if s := got["session"]; s.Domain != ".example.com" || !s.Secure || s.Value != "s3cret" || s.Expires.Unix() != 1800000000 {
+		t.Errorf("session = %+v", s)
+	}
+	if a := got["auth"]; a.Domain != "files.example.com" || !a.HttpOnly || a.Path != "/dl" || a.Value != "tok" || !a.Expires.IsZero() {
+		t.Errorf("auth = %+v", a)
+	}
+	if e := got["empty"]; e.Value != "" {
+		t.Errorf("empty = %+v", e)
+	}
+
+	for _, bad := range []string{"example.com\tFALSE\t/\n", "example.com\tFALSE\t/\tFALSE\tsoon\tn\tv\n"} {
+		if _, err := parseNetscape(strings.NewReader(bad), now); err == nil {
+			t.Errorf("parseNetscape(%q) succeeded", bad)
+		}
+	}
+}
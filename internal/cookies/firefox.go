@@ -0,0 +1,76 @@
+package cookies
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// firefoxProfileRoots returns the folders Firefox keeps profiles in
+func firefoxProfileRoots() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{filepath.Join(home, "Library", "Application Support", "Firefox", "Profiles")}
+	case "windows":
+		return []string{filepath.Join(os.Getenv("APPDATA"), "Mozilla", "Firefox", "Profiles")}
+	}
+	return []string{
+		filepath.Join(home, ".mozilla", "firefox"),
+		filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox"),
+	}
+}
+
+// firefoxCookieDB returns the cookie database of the profile used last
+func firefoxCookieDB() (string, error) {
+	var newest string
+	var newestTime time.Time
+	for _, root := range firefoxProfileRoots() {
+		matches, _ := filepath.Glob(filepath.Join(root, "*", "cookies.sqlite"))
+		for _, path := range matches {
+			if info, err := os.Stat(path); err == nil && info.ModTime().After(newestTime) {
+				newest, newestTime = path, info.ModTime()
+			}
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("firefox: %w", ErrNoProfile)
+	}
+	return newest, nil
+}
+
+func loadFirefox() ([]*http.Cookie, error) {
+	path, err := firefoxCookieDB()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var cookies []*http.Cookie
+	err = querySQLite(path, "SELECT host, name, value, path, expiry, isSecure, isHttpOnly FROM moz_cookies", func(rows *sql.Rows) error {
+		var c http.Cookie
+		var expiry int64
+		if err := rows.Scan(&c.Domain, &c.Name, &c.Value, &c.Path, &expiry, &c.Secure, &c.HttpOnly); err != nil {
+			return err
+		}
+		// Newer versions store milliseconds
+		if expiry > 1e11 {
+			expiry /= 1000
+		}
+		if expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+			if c.Expires.Before(now) {
+				return nil
+			}
+		}
+		cookies = append(cookies, &c)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("firefox: %w", err)
+	}
+	return cookies, nil
+}
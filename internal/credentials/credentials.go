@@ -0,0 +1,69 @@
+// Package credentials logs downloads in to the hosts listed under
+// connections.credentials in settings, with basic authentication or a bearer
+// token. Passwords and tokens may be keyring references, looked up as
+// requests are sent.
+package credentials
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/keyring"
+)
+
+// Authorizer adds the credential of a request's host. Requests already
+// carrying an Authorization header, such as one given with --user, are left
+// alone.
+type Authorizer struct {
+	creds []config.HostCredential
+}
+
+// NewAuthorizer returns an Authorizer for creds, or nil if none of them has
+// hosts and a login
+func NewAuthorizer(creds []config.HostCredential) types.Authorizer {
+	var a Authorizer
+	for _, c := range creds {
+		if len(c.Hosts) > 0 && (c.User != "" || c.Token != "") {
+			a.creds = append(a.creds, c)
+		}
+	}
+	if len(a.creds) == 0 {
+		return nil
+	}
+	return &a
+}
+
+// Authorize logs req in with the first credential covering its host
+func (a *Authorizer) Authorize(req *http.Request) error {
+	if req.Header.Get("Authorization") != "" {
+		return nil
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	for _, c := range a.creds {
+		if !slices.ContainsFunc(c.Hosts, func(h string) bool {
+			h = strings.ToLower(h)
+			return host == h || strings.HasSuffix(host, "."+h)
+		}) {
+			continue
+		}
+		if c.Token != "" {
+			token, err := keyring.Resolve(c.Token)
+			if err != nil {
+				return fmt.Errorf("token for %s: %w", host, err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		}
+		password, err := keyring.Resolve(c.Password)
+		if err != nil {
+			return fmt.Errorf("password for %s: %w", host, err)
+		}
+		req.SetBasicAuth(c.User, password)
+		return nil
+	}
+	return nil
+}
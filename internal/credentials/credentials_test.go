@@ -0,0 +1,48 @@
+package credentials
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+func TestAuthorizer(t *testing.T) {
+	if NewAuthorizer([]config.HostCredential{{Hosts: []string{"x.com"}}}) != nil {
+		t.Error("a credential without a login should be skipped")
+	}
+
+	a := NewAuthorizer([]config.HostCredential{
+		{Hosts: []string{"files.example.com"}, User: "alice", Password: "secret"},
+		{Hosts: []string{"Example.org"}, Token: "abc"},
+	})
+	authorization := func(rawURL string, preset string) string {
+		req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+		if preset != "" {
+			req.Header.Set("Authorization", preset)
+		}
+		if err := a.Authorize(req); err != nil {
+			t.Fatal(err)
+		}
+		return req.Header.Get("Authorization")
+	}
+
+	if got := authorization("https://files.example.com/a", ""); got != "Basic YWxpY2U6c2VjcmV0" {
+		t.Errorf("basic = %q", got)
+	}
+	if got := authorization("https://api.example.org/a", ""); got != "Bearer abc" {
+		t.Errorf("bearer for a subdomain = %q", got)
+	}
+	if got := authorization("https://example.com/a", ""); got != "" {
+		t.Errorf("unlisted host got %q", got)
+	}
+	if got := authorization("https://example.org/a", "Bearer cli"); got != "Bearer cli" {
+		t.Errorf("Authorization given on the command line was replaced by %q", got)
+	}
+
+	missing := NewAuthorizer([]config.HostCredential{{Hosts: []string{"example.org"}, Token: "keyring:surge-test-missing"}})
+	req, _ := http.NewRequest(http.MethodGet, "https://example.org/a", nil)
+	if err := missing.Authorize(req); err == nil {
+		t.Error("a token missing from the keyring should fail the request")
+	}
+}
@@ -0,0 +1,158 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/hooks"
+	"github.com/surge-downloader/surge/internal/platform"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// shutdownDelay is how long the pool waits before powering off, so that
+// someone still at the machine can quit Surge to call it off
+var shutdownDelay = time.Minute
+
+// Swapped out by tests
+var (
+	powerOff = platform.PowerOff
+	notify   = platform.Notify
+)
+
+// SetActions sets what the pool does after every download. A download's
+// own actions are merged on top, see types.PostActions.Merge.
+func (p *WorkerPool) SetActions(actions types.PostActions) {
+	p.mu.Lock()
+	p.actions = actions
+	p.mu.Unlock()
+}
+
+// Actions returns what the pool does after every download
+func (p *WorkerPool) Actions() types.PostActions {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.actions
+}
+
+// afterDownload runs the post-download actions for cfg, which completed if
+// downloadErr is nil, in the background. A shutdown waits for the pool to
+// have nothing left to download.
+func (p *WorkerPool) afterDownload(cfg types.DownloadConfig, downloadErr error) {
+	actions := p.Actions().Merge(cfg.Actions)
+	if actions.Shutdown {
+		p.shutdownArmed.Store(true)
+	}
+	if actions.Notify || (actions.OnComplete != "" && downloadErr == nil) {
+		p.actionsWG.Add(1)
+		go func() {
+			defer p.actionsWG.Done()
+			runPostActions(cfg, actions, downloadErr)
+		}()
+	}
+	p.shutdownIfIdle(cfg)
+}
+
+// runPostActions runs the --on-complete command, then shows the notification
+func runPostActions(cfg types.DownloadConfig, actions types.PostActions, downloadErr error) {
+	name := finishedName(cfg)
+	if actions.OnComplete != "" && downloadErr == nil {
+		err := hooks.Command(context.Background(), actions.OnComplete, hooks.Event{
+			Event:    hooks.OnComplete,
+			ID:       cfg.ID,
+			URL:      cfg.URL,
+			Mirrors:  cfg.Mirrors,
+			Filename: name,
+			Path:     cfg.DestPath,
+		})
+		if err != nil {
+			utils.Debug("%v", err)
+		}
+	}
+	if actions.Notify {
+		title, message := notification(cfg, downloadErr)
+		ctx, cancel := context.WithTimeout(context.Background(), hooks.Timeout)
+		defer cancel()
+		if err := notify(ctx, title, message); err != nil {
+			utils.Debug("Notification for %s failed: %v", cfg.ID, err)
+		}
+	}
+}
+
+// notification returns the title and message of the desktop notification
+// for cfg, e.g. "file.iso finished, 4m32s, sha256 OK"
+func notification(cfg types.DownloadConfig, downloadErr error) (title, message string) {
+	name := finishedName(cfg)
+	if downloadErr != nil {
+		return "Download failed", name + ": " + downloadErr.Error()
+	}
+	parts := []string{name + " finished"}
+	if cfg.State != nil {
+		_, _, elapsed, _, _, _ := cfg.State.GetProgress()
+		parts = append(parts, elapsed.Round(time.Second).String())
+	}
+	if algo, _, ok := strings.Cut(cfg.Checksum, ":"); ok {
+		parts = append(parts, algo+" OK") // A mismatch fails the download
+	}
+	return "Download complete", strings.Join(parts, ", ")
+}
+
+// finishedName is the name the file of an ended download has on disk
+func finishedName(cfg types.DownloadConfig) string {
+	if cfg.DestPath != "" {
+		return filepath.Base(cfg.DestPath)
+	}
+	return cfg.Filename
+}
+
+// idle reports whether the pool has nothing running, queued or scheduled.
+// Paused downloads wait for the user, so they do not count.
+func (p *WorkerPool) idle() bool {
+	if p.runningCount() > 0 {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.queued) == 0 && len(p.scheduled) == 0
+}
+
+// shutdownIfIdle powers the machine off after shutdownDelay once a shutdown
+// was asked for and the pool is idle, cfg being the download that just
+// ended. Downloads added meanwhile call it off.
+func (p *WorkerPool) shutdownIfIdle(cfg types.DownloadConfig) {
+	if !p.shutdownArmed.Load() || !p.idle() || !p.shutdownPending.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer p.shutdownPending.Store(false)
+		p.actionsWG.Wait() // Let --on-complete commands finish first
+
+		message := fmt.Sprintf("All downloads done, shutting down in %s; quit Surge to call it off", shutdownDelay)
+		if p.progressCh != nil {
+			p.progressCh <- events.DownloadWarningMsg{
+				DownloadID: cfg.ID,
+				Filename:   finishedName(cfg),
+				Message:    message,
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), hooks.Timeout)
+		if err := notify(ctx, "Surge", message); err != nil {
+			utils.Debug("Shutdown notification failed: %v", err)
+		}
+		cancel()
+
+		time.Sleep(shutdownDelay)
+		if !p.idle() {
+			utils.Debug("Shutdown called off: more downloads were added")
+			return
+		}
+		utils.Debug("Powering off after the last download")
+		if err := powerOff(context.Background()); err != nil {
+			utils.Debug("Failed to power off: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,114 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// stubActions swaps out the notifications and the power off for the test
+func stubActions(t *testing.T) (titles func() []string, poweredOff chan struct{}) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []string
+	poweredOff = make(chan struct{}, 1)
+	oldNotify, oldPowerOff, oldDelay := notify, powerOff, shutdownDelay
+	notify = func(_ context.Context, title, _ string) error {
+		mu.Lock()
+		got = append(got, title)
+		mu.Unlock()
+		return nil
+	}
+	powerOff = func(context.Context) error {
+		poweredOff <- struct{}{}
+		return nil
+	}
+	shutdownDelay = 0
+	t.Cleanup(func() { notify, powerOff, shutdownDelay = oldNotify, oldPowerOff, oldDelay })
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}, poweredOff
+}
+
+func TestAfterDownload_CommandAndNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell command")
+	}
+	titles, _ := stubActions(t)
+	dir := t.TempDir()
+	destPath := filepath.Join(dir, "it's.zip")
+	marker := filepath.Join(dir, "done")
+
+	pool := NewWorkerPool(nil, 1)
+	pool.SetActions(types.PostActions{Notify: true})
+	cfg := types.DownloadConfig{ID: "id", URL: "https://example.com/f.zip", DestPath: destPath,
+		Actions: types.PostActions{OnComplete: "echo {filename} > " + marker}}
+	pool.afterDownload(cfg, nil)
+	pool.afterDownload(types.DownloadConfig{ID: "id2", Filename: "b.zip", Actions: cfg.Actions}, errors.New("boom"))
+	pool.actionsWG.Wait()
+
+	data, err := os.ReadFile(marker)
+	if err != nil {
+		t.Fatalf("command did not run: %v", err)
+	}
+	if string(data) != "it's.zip\n" {
+		t.Errorf("command wrote %q, want the quoted filename", data)
+	}
+	got := titles()
+	if len(got) != 2 {
+		t.Fatalf("notifications = %q, want one per download", got)
+	}
+	for _, want := range []string{"Download complete", "Download failed"} {
+		if got[0] != want && got[1] != want {
+			t.Errorf("notifications = %q, want %q among them", got, want)
+		}
+	}
+}
+
+func TestAfterDownload_ShutdownWhenIdle(t *testing.T) {
+	_, poweredOff := stubActions(t)
+	pool := NewWorkerPool(nil, 1)
+
+	// Something is still queued, so nothing happens yet
+	pool.queued["next"] = types.DownloadConfig{ID: "next"}
+	pool.afterDownload(types.DownloadConfig{ID: "a", Actions: types.PostActions{Shutdown: true}}, nil)
+	select {
+	case <-poweredOff:
+		t.Fatal("powered off with a download still queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The last download ending powers off, even without its own request
+	delete(pool.queued, "next")
+	pool.afterDownload(types.DownloadConfig{ID: "next"}, nil)
+	select {
+	case <-poweredOff:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not power off once idle")
+	}
+}
+
+func TestNotification(t *testing.T) {
+	st := types.NewProgressState("id", 100)
+	st.SetSavedElapsed(4*time.Minute + 32*time.Second)
+	st.StartTime = time.Now()
+	cfg := types.DownloadConfig{ID: "id", Filename: "file.iso", State: st, Checksum: "sha256:9f86d0"}
+
+	title, message := notification(cfg, nil)
+	if title != "Download complete" || message != "file.iso finished, 4m32s, sha256 OK" {
+		t.Errorf("notification() = %q, %q", title, message)
+	}
+	title, message = notification(cfg, errors.New("connection reset"))
+	if title != "Download failed" || message != "file.iso: connection reset" {
+		t.Errorf("notification() for a failure = %q, %q", title, message)
+	}
+}
@@ -0,0 +1,124 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// ErrChecksumMismatch is returned when a completed download does not match
+// the hash it was expected to have
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// HashFile returns the hex SHA-256 of the file at path
+func HashFile(path string) (string, error) {
+	return hashFile(path, sha256.New())
+}
+
+func hashFile(path string, h hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyChecksum checks the file at path against a "type:hex" checksum such
+// as "sha256:9f86d0...", returning ErrChecksumMismatch if it differs
+func VerifyChecksum(path, checksum string) error {
+	h, want, err := types.ParseChecksum(checksum)
+	if err != nil {
+		return err
+	}
+	got, err := hashFile(path, h)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, want) {
+		typ, _, _ := strings.Cut(checksum, ":")
+		return fmt.Errorf("%w: %s is %s, expected %s", ErrChecksumMismatch, typ, got, want)
+	}
+	return nil
+}
+
+// verifyChecksumDigest is VerifyChecksum for a file whose SHA-256 may already
+// be known, so a sha256 checksum needn't read the file again
+func verifyChecksumDigest(path, checksum, sha256Hex string) error {
+	typ, want, _ := strings.Cut(checksum, ":")
+	if sha256Hex == "" || !strings.EqualFold(typ, "sha256") {
+		return VerifyChecksum(path, checksum)
+	}
+	if !strings.EqualFold(sha256Hex, want) {
+		return fmt.Errorf("%w: %s is %s, expected %s", ErrChecksumMismatch, typ, sha256Hex, want)
+	}
+	return nil
+}
+
+// QuarantineSuffix is added to the name of a completed download that did
+// not match its checksum
+const QuarantineSuffix = ".corrupt"
+
+// quarantine renames the file at path, which failed its checksum, to a free
+// name ending in QuarantineSuffix and returns it
+func quarantine(path string) (string, error) {
+	dest := nextFreePath(path+QuarantineSuffix, pathOnDisk)
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// SupportedChecksum reports whether checksum is a "type:hex" checksum that
+// VerifyChecksum can check
+func SupportedChecksum(checksum string) bool {
+	_, want, err := types.ParseChecksum(checksum)
+	if err != nil || want == "" {
+		return false
+	}
+	_, err = hex.DecodeString(want)
+	return err == nil
+}
+
+// RecordChecksum hashes the completed download at path and stores the hash
+// in the checksum database, so surge verify can later tell if it changed
+func RecordChecksum(id, path string) error {
+	return recordDigest(id, path, "")
+}
+
+// recordDigest is RecordChecksum for a file whose SHA-256 is already known,
+// as sha256Hex; the file is only read when that is empty
+func recordDigest(id, path, sha256Hex string) error {
+	path = utils.EnsureAbsPath(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if sha256Hex == "" {
+		if sha256Hex, err = HashFile(path); err != nil {
+			return err
+		}
+	}
+	return state.SaveChecksum(types.ChecksumEntry{
+		Path:       path,
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		SHA256:     sha256Hex,
+		DownloadID: id,
+		CheckedAt:  time.Now().Unix(),
+	})
+}
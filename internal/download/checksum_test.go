@@ -0,0 +1,208 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("surge checksum test")
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	md5Sum := md5.Sum(data)
+
+	if err := VerifyChecksum(path, "sha256:"+sha256Hex(data)); err != nil {
+		t.Errorf("sha256: %v", err)
+	}
+	if err := VerifyChecksum(path, "SHA256:"+strings.ToUpper(sha256Hex(data))); err != nil {
+		t.Errorf("hex and type should be case-insensitive: %v", err)
+	}
+	if err := VerifyChecksum(path, "md5:"+hex.EncodeToString(md5Sum[:])); err != nil {
+		t.Errorf("md5: %v", err)
+	}
+
+	err := VerifyChecksum(path, "sha256:"+sha256Hex([]byte("other")))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	for _, bad := range []string{"crc32:abcd", "nohash"} {
+		if err := VerifyChecksum(path, bad); err == nil || errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("%q: expected an unsupported checksum error, got %v", bad, err)
+		}
+	}
+}
+
+func TestVerifyChecksumDigest(t *testing.T) {
+	data := []byte("surge checksum test")
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	md5Sum := md5.Sum(data)
+
+	// A known digest is trusted without reading the file
+	if err := verifyChecksumDigest(filepath.Join(t.TempDir(), "missing"), "sha256:"+sha256Hex(data), sha256Hex(data)); err != nil {
+		t.Errorf("known digest: %v", err)
+	}
+	err := verifyChecksumDigest(path, "sha256:"+sha256Hex(data), sha256Hex([]byte("other")))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	// Other types, or no digest, hash the file
+	if err := verifyChecksumDigest(path, "md5:"+hex.EncodeToString(md5Sum[:]), sha256Hex([]byte("other"))); err != nil {
+		t.Errorf("md5: %v", err)
+	}
+	if err := verifyChecksumDigest(path, "sha256:"+sha256Hex(data), ""); err != nil {
+		t.Errorf("no digest: %v", err)
+	}
+}
+
+func TestRecordDigest(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data := []byte("surge checksum test")
+	path := filepath.Join(tmpDir, "file.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A digest from the engine is stored as given, without reading the file
+	known := sha256Hex([]byte("what the engine saw"))
+	if err := recordDigest("id1", path, known); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := state.GetChecksum(path); err != nil || entry == nil || entry.SHA256 != known {
+		t.Errorf("with a digest, recorded %+v (%v), want %s", entry, err, known)
+	}
+	// Without one the file is hashed
+	if err := recordDigest("id1", path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := state.GetChecksum(path); err != nil || entry == nil || entry.SHA256 != sha256Hex(data) {
+		t.Errorf("without a digest, recorded %+v (%v), want %s", entry, err, sha256Hex(data))
+	}
+}
+
+func TestSupportedChecksum(t *testing.T) {
+	for checksum, want := range map[string]bool{
+		"sha256:9f86d081": true,
+		"MD5:ABCDEF":      true,
+		"sha256:":         false,
+		"sha256:xyz":      false,
+		"crc32:abcd":      false,
+		"file.iso":        false,
+	} {
+		if got := SupportedChecksum(checksum); got != want {
+			t.Errorf("SupportedChecksum(%q) = %v, want %v", checksum, got, want)
+		}
+	}
+}
+
+func TestTUIDownload_ServerDigest(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	content := bytes.Repeat([]byte("surge"), 50*types.KB)
+	digest := sha256.Sum256(content)
+	wrong := sha256.Sum256([]byte("other"))
+	for _, tt := range []struct {
+		name string
+		sum  []byte
+		ok   bool
+	}{
+		{"good.iso", digest[:], true},
+		{"bad.iso", wrong[:], false},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(tt.sum)+":")
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+		defer server.Close()
+
+		progressCh := make(chan any, 100)
+		id := types.NewDownloadID()
+		err := TUIDownload(context.Background(), &types.DownloadConfig{
+			URL:        server.URL + "/" + tt.name,
+			OutputPath: tmpDir,
+			ID:         id,
+			Filename:   tt.name,
+			ProgressCh: progressCh,
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 2},
+		})
+		close(progressCh)
+		verified := false
+		for msg := range progressCh {
+			if _, ok := msg.(events.ChecksumVerifiedMsg); ok {
+				verified = true
+			}
+		}
+
+		path := filepath.Join(tmpDir, tt.name)
+		if tt.ok {
+			if err != nil || !verified {
+				t.Errorf("%s: err = %v, verified = %v", tt.name, err, verified)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrChecksumMismatch) || verified {
+			t.Errorf("%s: err = %v, verified = %v; want a checksum mismatch", tt.name, err, verified)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left under its own name", tt.name)
+		}
+		if _, err := os.Stat(path + QuarantineSuffix); err != nil {
+			t.Errorf("%s not kept as %s: %v", tt.name, tt.name+QuarantineSuffix, err)
+		}
+	}
+}
+
+func TestTUIDownload_ChecksumAfterRestart(t *testing.T) {
+	server := newPausingServer(strings.Repeat("surge", 10*types.KB), nil)
+	defer server.Close()
+
+	wrong := sha256.Sum256([]byte("other"))
+	cfg := types.DownloadConfig{
+		URL:        server.URL + "/bad.iso",
+		OutputPath: t.TempDir(),
+		Filename:   "bad.iso",
+		Runtime:    &types.RuntimeConfig{},
+		Checksum:   "sha256:" + hex.EncodeToString(wrong[:]),
+	}
+	resumed := server.pauseAndRestart(t, cfg)
+	if resumed.Checksum != cfg.Checksum {
+		t.Errorf("restored checksum %q, want %q", resumed.Checksum, cfg.Checksum)
+	}
+
+	err := TUIDownload(context.Background(), &resumed)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("resumed TUIDownload() = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputPath, "bad.iso"+QuarantineSuffix)); err != nil {
+		t.Errorf("bad.iso not kept as bad.iso%s: %v", QuarantineSuffix, err)
+	}
+}
@@ -0,0 +1,47 @@
+package download
+
+import "sync"
+
+// pathClaims records the destination paths of downloads this process is
+// running. A file only appears at its destination when the download
+// completes, so without claims two downloads that resolve to the same name
+// at once would both pick it, and the one finishing last would replace the
+// other's file.
+type pathClaims struct {
+	mu    sync.Mutex
+	paths map[string]string // Destination path -> ID of the download using it
+}
+
+var destClaims = &pathClaims{paths: make(map[string]string)}
+
+// claim reserves a destination for download id: path itself if neither a
+// file nor another download has it, else the first free "name(N)" variant.
+// Claims are handed out one at a time, so downloads asking for the same name
+// get numbered in the order they ask.
+func (c *pathClaims) claim(path, id string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path = nextFreePath(path, func(p string) bool {
+		owner, claimed := c.paths[p]
+		return (claimed && owner != id) || pathOnDisk(p)
+	})
+	c.paths[path] = id
+	return path
+}
+
+// hold records that download id uses path, which it already owns on disk,
+// as a resumed download does
+func (c *pathClaims) hold(path, id string) {
+	c.mu.Lock()
+	c.paths[path] = id
+	c.mu.Unlock()
+}
+
+// release gives up id's claim on path. Claims of other downloads are kept.
+func (c *pathClaims) release(path, id string) {
+	c.mu.Lock()
+	if c.paths[path] == id {
+		delete(c.paths, path)
+	}
+	c.mu.Unlock()
+}
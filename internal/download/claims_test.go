@@ -0,0 +1,136 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestPathClaims_SameNameAtOnce(t *testing.T) {
+	dir := t.TempDir()
+	claims := &pathClaims{paths: make(map[string]string)}
+	path := filepath.Join(dir, "file.zip")
+
+	const n = 8
+	got := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = claims.claim(path, string(rune('a'+i)))
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, p := range got {
+		if seen[p] {
+			t.Fatalf("%s claimed twice: %v", p, got)
+		}
+		seen[p] = true
+	}
+	for _, want := range []string{"file.zip", "file(1).zip", "file(7).zip"} {
+		if !seen[filepath.Join(dir, want)] {
+			t.Errorf("%s not among %v", want, got)
+		}
+	}
+}
+
+func TestPathClaims_Release(t *testing.T) {
+	dir := t.TempDir()
+	claims := &pathClaims{paths: make(map[string]string)}
+	path := filepath.Join(dir, "file.zip")
+
+	if got := claims.claim(path, "a"); got != path {
+		t.Fatalf("first claim = %s, want %s", got, path)
+	}
+	if got := claims.claim(path, "a"); got != path {
+		t.Errorf("claiming its own path again = %s, want %s", got, path)
+	}
+	second := claims.claim(path, "b")
+	if second == path {
+		t.Fatal("second download got the claimed path")
+	}
+
+	claims.release(path, "b") // Not b's claim: kept
+	if got := claims.claim(path, "c"); got == path {
+		t.Error("release by another download dropped the claim")
+	}
+	claims.release(path, "a")
+	if got := claims.claim(path, "d"); got != path {
+		t.Errorf("claim after release = %s, want %s", got, path)
+	}
+
+	// A resumed download keeps its path out of reach of new ones
+	resumed := filepath.Join(dir, "resumed.iso")
+	claims.hold(resumed, "e")
+	if got := claims.claim(resumed, "f"); got == resumed {
+		t.Error("new download got a resumed download's path")
+	}
+}
+
+func TestTUIDownload_SameFilenameAtOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	contents := [][]byte{bytes.Repeat([]byte("a"), 256*types.KB), bytes.Repeat([]byte("b"), 256*types.KB)}
+	var servers []*httptest.Server
+	for _, content := range contents {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond) // Keep both downloads running together
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	outDir := filepath.Join(tmpDir, "out")
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := types.NewDownloadID()
+			errs[i] = TUIDownload(context.Background(), &types.DownloadConfig{
+				URL:        server.URL + "/report.pdf",
+				OutputPath: outDir,
+				ID:         id,
+				Filename:   "report.pdf",
+				State:      types.NewProgressState(id, 0),
+				Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 2},
+			})
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("download failed: %v", err)
+		}
+	}
+
+	var got [][]byte
+	for _, name := range []string{"report.pdf", "report(1).pdf"} {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got = append(got, data)
+	}
+	if !(bytes.Equal(got[0], contents[0]) && bytes.Equal(got[1], contents[1])) &&
+		!(bytes.Equal(got[0], contents[1]) && bytes.Equal(got[1], contents[0])) {
+		t.Error("one download overwrote the other")
+	}
+}
@@ -0,0 +1,86 @@
+package download
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/platform"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// CleanupPartial removes what an unfinished download leaves behind: its resume
+// state and, unless keepFile is set, the incomplete .surge working file or
+// folder of part files.
+// It returns the number of bytes freed on disk.
+func CleanupPartial(id, url, destPath string, keepFile bool) (int64, error) {
+	if err := state.DeleteState(id, url, destPath); err != nil {
+		utils.Debug("Cleanup: failed to delete state for %s: %v", id, err)
+	}
+
+	if keepFile || destPath == "" {
+		return 0, nil
+	}
+
+	var freed int64
+	for _, workingPath := range types.WorkingPathCandidates(destPath, id) {
+		n, err := removeWorkingFile(workingPath)
+		if err != nil {
+			return freed, err
+		}
+		freed += n
+	}
+	// Drop the hidden part folder if this was its last file
+	_ = os.Remove(utils.LongPath(filepath.Join(filepath.Dir(destPath), types.PartDirName)))
+	return freed, nil
+}
+
+// DeleteFile deletes the file of a completed download: into the OS trash,
+// where it can be restored, or for good if permanent is set. A file that is
+// already gone is not an error.
+func DeleteFile(path string, permanent bool) error {
+	if _, err := os.Lstat(utils.LongPath(path)); os.IsNotExist(err) {
+		return nil
+	}
+	if permanent {
+		return os.RemoveAll(utils.LongPath(path))
+	}
+	return platform.Trash(path)
+}
+
+// removeWorkingFile deletes one working file, or folder of part files, and
+// returns its size, or 0 if it does not exist
+func removeWorkingFile(workingPath string) (int64, error) {
+	workingPath = utils.LongPath(workingPath)
+	info, err := os.Stat(workingPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+		_ = filepath.WalkDir(workingPath, func(_ string, e fs.DirEntry, err error) error {
+			if err == nil && !e.IsDir() {
+				if fi, err := e.Info(); err == nil {
+					size += fi.Size()
+				}
+			}
+			return nil
+		})
+	}
+
+	// Retry briefly: the worker may still hold the file right after cancellation (Windows)
+	for i := 0; i < 5; i++ {
+		if err = os.RemoveAll(workingPath); err == nil {
+			return size, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return 0, err
+}
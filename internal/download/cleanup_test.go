@@ -0,0 +1,210 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestCleanupPartial_RemovesWorkingFile(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	if _, err := testutil.CreateTestFile(tmpDir, "file.bin"+types.IncompleteSuffix, 4096, false); err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, err := CleanupPartial("id", "http://example.com/file.bin", destPath, false)
+	if err != nil {
+		t.Fatalf("CleanupPartial failed: %v", err)
+	}
+	if reclaimed != 4096 {
+		t.Errorf("reclaimed = %d, want 4096", reclaimed)
+	}
+	if testutil.FileExists(destPath + types.IncompleteSuffix) {
+		t.Error(".surge file should be removed")
+	}
+}
+
+func TestCleanupPartial_RemovesPartFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	destPath := filepath.Join(tmpDir, "file.bin")
+	partsDir := types.WorkingPath(destPath, "id", false)
+	if err := os.MkdirAll(partsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"00000.part", "00001.part"} {
+		if err := os.WriteFile(filepath.Join(partsDir, name), make([]byte, 1000), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reclaimed, err := CleanupPartial("id", "http://example.com/file.bin", destPath, false)
+	if err != nil {
+		t.Fatalf("CleanupPartial failed: %v", err)
+	}
+	if reclaimed != 2000 {
+		t.Errorf("reclaimed = %d, want 2000", reclaimed)
+	}
+	if _, err := os.Stat(partsDir); !os.IsNotExist(err) {
+		t.Error("parts folder should be removed")
+	}
+}
+
+func TestCleanupPartial_RemovesHiddenWorkingFile(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-cleanup-hidden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	workingPath := types.WorkingPath(destPath, "0123456789", true)
+	if err := os.MkdirAll(filepath.Dir(workingPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(workingPath, make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, err := CleanupPartial("0123456789", "http://example.com/file.bin", destPath, false)
+	if err != nil {
+		t.Fatalf("CleanupPartial failed: %v", err)
+	}
+	if reclaimed != 2048 {
+		t.Errorf("reclaimed = %d, want 2048", reclaimed)
+	}
+	if testutil.FileExists(filepath.Join(tmpDir, types.PartDirName)) {
+		t.Error("empty part folder should be removed")
+	}
+}
+
+func TestCleanupPartial_KeepFile(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-cleanup-keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	if _, err := testutil.CreateTestFile(tmpDir, "file.bin"+types.IncompleteSuffix, 1024, false); err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, err := CleanupPartial("id", "http://example.com/file.bin", destPath, true)
+	if err != nil {
+		t.Fatalf("CleanupPartial failed: %v", err)
+	}
+	if reclaimed != 0 {
+		t.Errorf("reclaimed = %d, want 0 when keeping", reclaimed)
+	}
+	if !testutil.FileExists(destPath + types.IncompleteSuffix) {
+		t.Error(".surge file should be kept")
+	}
+}
+
+func TestCleanupPartial_MissingFile(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-cleanup-missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	reclaimed, err := CleanupPartial("id", "", filepath.Join(tmpDir, "nothing.bin"), false)
+	if err != nil || reclaimed != 0 {
+		t.Errorf("got (%d, %v), want (0, nil)", reclaimed, err)
+	}
+}
+
+func TestWorkerPool_Cancel_ReportsReclaimed(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-cancel-reclaim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	destPath := filepath.Join(tmpDir, "big.bin")
+	if _, err := testutil.CreateTestFile(tmpDir, "big.bin"+types.IncompleteSuffix, 8192, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 1)
+
+	finished := make(chan struct{})
+	pool.mu.Lock()
+	pool.downloads["cancel-id"] = &activeDownload{
+		config: types.DownloadConfig{
+			ID:       "cancel-id",
+			Filename: "big.bin",
+			DestPath: destPath,
+			State:    types.NewProgressState("cancel-id", 8192),
+		},
+		finished: finished,
+	}
+	pool.mu.Unlock()
+
+	if !pool.Cancel("cancel-id") {
+		t.Fatal("Cancel should report a tracked download")
+	}
+
+	// Cleanup must wait for the worker to let go of the file
+	time.Sleep(50 * time.Millisecond)
+	if !testutil.FileExists(destPath + types.IncompleteSuffix) {
+		t.Fatal("partial file removed before the worker finished")
+	}
+	close(finished)
+
+	select {
+	case msg := <-ch:
+		removed, ok := msg.(events.DownloadRemovedMsg)
+		if !ok {
+			t.Fatalf("Expected DownloadRemovedMsg, got %T", msg)
+		}
+		if removed.Reclaimed != 8192 {
+			t.Errorf("Reclaimed = %d, want 8192", removed.Reclaimed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected removal message")
+	}
+
+	if _, err := os.Stat(destPath + types.IncompleteSuffix); !os.IsNotExist(err) {
+		t.Error("partial file should be deleted after cancel")
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	path := filepath.Join(dir, "file.bin")
+
+	modes := []bool{true}
+	if runtime.GOOS == "linux" {
+		modes = append(modes, false) // Other trashes need a desktop session
+	}
+	for _, permanent := range modes {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteFile(path, permanent); err != nil {
+			t.Fatalf("DeleteFile(permanent=%v) failed: %v", permanent, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("DeleteFile(permanent=%v) left the file in place", permanent)
+		}
+	}
+
+	if err := DeleteFile(path, false); err != nil {
+		t.Errorf("DeleteFile of a missing file = %v, want nil", err)
+	}
+}
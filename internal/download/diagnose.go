@@ -0,0 +1,149 @@
+package download
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// ErrorKind is the broad class a download failure falls into
+type ErrorKind string
+
+const (
+	ErrorUnknown     ErrorKind = "Error"
+	ErrorNetwork     ErrorKind = "Network"
+	ErrorDNS         ErrorKind = "DNS"
+	ErrorTimeout     ErrorKind = "Timeout"
+	ErrorTLS         ErrorKind = "TLS"
+	ErrorAuth        ErrorKind = "Access Denied"
+	ErrorNotFound    ErrorKind = "Not Found"
+	ErrorRateLimited ErrorKind = "Rate Limited"
+	ErrorServer      ErrorKind = "Server Error"
+	ErrorHTTP        ErrorKind = "HTTP"
+	ErrorRange       ErrorKind = "Range Unsupported"
+	ErrorDisk        ErrorKind = "Disk"
+)
+
+// diagnosticHeaders are the response headers worth showing when a request fails
+var diagnosticHeaders = []string{"Server", "Content-Type", "Retry-After", "Location", "WWW-Authenticate"}
+
+// Diagnosis is a classified download failure with a suggested fix
+type Diagnosis struct {
+	Kind       ErrorKind
+	Message    string           // Underlying error text
+	Suggestion string           // What the user can try next; empty if nothing useful
+	HTTP       *types.HTTPError // Response snapshot, if the failure was an HTTP status
+	Attempts   []string         // Errors of each retry, oldest first
+}
+
+// Headers returns the diagnostic subset of the captured response headers as
+// "Name: value" lines, in a stable order.
+func (d Diagnosis) Headers() []string {
+	if d.HTTP == nil {
+		return nil
+	}
+	var lines []string
+	for _, name := range diagnosticHeaders {
+		if v := d.HTTP.Header.Get(name); v != "" {
+			lines = append(lines, name+": "+v)
+		}
+	}
+	return lines
+}
+
+// Diagnose classifies err and suggests a fix
+func Diagnose(err error) Diagnosis {
+	d := Diagnosis{Kind: ErrorUnknown}
+	if err == nil {
+		return d
+	}
+	d.Message = err.Error()
+
+	var retryErr *types.RetryError
+	if errors.As(err, &retryErr) {
+		d.Attempts = retryErr.Attempts
+	}
+
+	var httpErr *types.HTTPError
+	if errors.As(err, &httpErr) {
+		d.HTTP = httpErr
+		d.Kind, d.Suggestion = diagnoseStatus(httpErr)
+		return d
+	}
+
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrErrorPage):
+		d.Kind = ErrorHTTP
+		d.Suggestion = "The link led to a web page, usually a login, expired-link or error page; open it in a browser, sign in or get a fresh link, then retry."
+	case errors.Is(err, ErrUnexpectedResponse):
+		d.Kind = ErrorHTTP
+		d.Suggestion = "The server sent something other than the expected file, often a login or error page; check the URL and credentials."
+	case errors.Is(err, types.ErrRangeIgnored):
+		d.Kind = ErrorRange
+		d.Suggestion = "The server stopped honouring byte ranges; retry with 1 connection."
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, types.ErrInsufficientSpace):
+		d.Kind = ErrorDisk
+		d.Suggestion = "The disk is full; free up space or choose another download directory."
+	case errors.Is(err, os.ErrPermission):
+		d.Kind = ErrorDisk
+		d.Suggestion = "Surge cannot write here; choose a download directory you own."
+	case errors.As(err, &dnsErr):
+		d.Kind = ErrorDNS
+		d.Suggestion = "The host name could not be resolved; check the URL and your network or DNS settings."
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr):
+		d.Kind = ErrorTLS
+		d.Suggestion = "The server's certificate is not trusted; check the URL or your system clock and CA store."
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		d.Kind = ErrorTimeout
+		d.Suggestion = "The server stopped responding; retry later or add a mirror."
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		d.Kind = ErrorNetwork
+		d.Suggestion = "The connection was refused or dropped; check the server address or retry later."
+	case errors.As(err, &netErr):
+		d.Kind = ErrorNetwork
+		d.Suggestion = "Check your network connection and retry."
+	}
+	return d
+}
+
+// diagnoseStatus maps an HTTP status to a kind and suggestion
+func diagnoseStatus(e *types.HTTPError) (ErrorKind, string) {
+	switch code := e.StatusCode; {
+	case code == http.StatusUnauthorized:
+		return ErrorAuth, "The server requires authentication; use a link that includes access credentials."
+	case code == http.StatusForbidden:
+		return ErrorAuth, "The server refused access. The link may have expired or require browser cookies or a Referer; grab a fresh link from the browser."
+	case code == http.StatusNotFound, code == http.StatusGone:
+		return ErrorNotFound, "The file is no longer at this URL; check the link or use a mirror."
+	case code == http.StatusRequestedRangeNotSatisfiable:
+		return ErrorRange, "The file changed on the server since the download started; remove it and download again."
+	case code == http.StatusTooManyRequests:
+		wait := "retry later"
+		if after := e.Header.Get("Retry-After"); after != "" {
+			if secs, err := strconv.Atoi(after); err == nil {
+				wait = fmt.Sprintf("retry in %ds", secs)
+			} else {
+				wait = "retry after " + after
+			}
+		}
+		return ErrorRateLimited, "The server is throttling requests; lower Max Connections/Host in settings or " + wait + "."
+	case code >= 500:
+		return ErrorServer, "The server is having trouble; retry later or add a mirror."
+	}
+	return ErrorHTTP, ""
+}
@@ -0,0 +1,101 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestDiagnose_Kinds(t *testing.T) {
+	httpErr := func(code int, header http.Header) error {
+		return &types.HTTPError{StatusCode: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code)), Header: header}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"forbidden", httpErr(http.StatusForbidden, http.Header{}), ErrorAuth},
+		{"not found", httpErr(http.StatusNotFound, http.Header{}), ErrorNotFound},
+		{"rate limited", httpErr(http.StatusTooManyRequests, http.Header{}), ErrorRateLimited},
+		{"server", httpErr(http.StatusBadGateway, http.Header{}), ErrorServer},
+		{"teapot", httpErr(http.StatusTeapot, http.Header{}), ErrorHTTP},
+		{"wrapped http", fmt.Errorf("probe: %w", httpErr(http.StatusGone, http.Header{})), ErrorNotFound},
+		{"range", types.ErrRangeIgnored, ErrorRange},
+		{"unexpected", fmt.Errorf("%w: server sent Content-Type \"text/html\"", ErrUnexpectedResponse), ErrorHTTP},
+		{"error page", fmt.Errorf("%w: data.zip holds the page \"Sign in\"", ErrErrorPage), ErrorHTTP},
+		{"disk full", fmt.Errorf("write error: %w", syscall.ENOSPC), ErrorDisk},
+		{"no room", fmt.Errorf("%w: 4.0 GB needed", types.ErrInsufficientSpace), ErrorDisk},
+		{"dns", &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}, ErrorDNS},
+		{"timeout", context.DeadlineExceeded, ErrorTimeout},
+		{"refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrorNetwork},
+		{"unknown", errors.New("something odd"), ErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diagnose(tt.err).Kind; got != tt.want {
+				t.Errorf("Diagnose(%v).Kind = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiagnose_RetryHistoryAndHeaders(t *testing.T) {
+	last := &types.HTTPError{
+		StatusCode: http.StatusTooManyRequests,
+		Status:     "429 Too Many Requests",
+		Header:     http.Header{"Retry-After": {"30"}, "Server": {"nginx"}, "Set-Cookie": {"x=y"}},
+	}
+	err := &types.RetryError{Op: "download", Attempts: []string{"read error: EOF", last.Error()}, Err: last}
+
+	diag := Diagnose(err)
+	if diag.Kind != ErrorRateLimited {
+		t.Fatalf("Kind = %q, want %q", diag.Kind, ErrorRateLimited)
+	}
+	if len(diag.Attempts) != 2 {
+		t.Errorf("Attempts = %v, want 2 entries", diag.Attempts)
+	}
+	if !strings.Contains(diag.Suggestion, "30s") {
+		t.Errorf("Suggestion %q should mention Retry-After", diag.Suggestion)
+	}
+
+	headers := diag.Headers()
+	if len(headers) != 2 || headers[0] != "Server: nginx" || headers[1] != "Retry-After: 30" {
+		t.Errorf("Headers() = %v", headers)
+	}
+}
+
+func TestDiagnose_ProbeStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "test")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := engine.ProbeServer(context.Background(), server.URL+"/file.bin", "", nil)
+	if err == nil {
+		t.Fatal("expected probe error")
+	}
+
+	diag := Diagnose(err)
+	if diag.Kind != ErrorAuth || diag.HTTP == nil || diag.HTTP.StatusCode != http.StatusForbidden {
+		t.Fatalf("Diagnose = %+v", diag)
+	}
+	if diag.HTTP.Header.Get("Server") != "test" {
+		t.Errorf("header snapshot missing Server")
+	}
+	if diag.Suggestion == "" {
+		t.Error("expected a suggestion for 403")
+	}
+}
@@ -0,0 +1,128 @@
+package download
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// ErrErrorPage is returned when the server answers a download with a web
+// page, such as a login, expired-link or error page, instead of the file
+var ErrErrorPage = errors.New("server sent a web page instead of the file")
+
+// errorPageMaxSize is the largest response taken for an error page. Such
+// pages are small; a larger HTML response is assumed to be meant.
+const errorPageMaxSize = 2 << 20
+
+// pageSuffix is added to the name of a completed download that turned out
+// to be a web page, so it opens in a browser
+const pageSuffix = ".html"
+
+// maxTitleLength is the most of a page's title an error quotes
+const maxTitleLength = 80
+
+// titlePattern finds a page's title, which usually says what went wrong
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// checkErrorPage fails when the probe shows that a download saved as name,
+// a binary format such as dataset.tar.gz, is being served as a small HTML
+// page. Start bytes the probe received that are not HTML clear it, as do
+// downloads expecting a Content-Type of their own.
+func checkErrorPage(cfg *types.DownloadConfig, name string, probe *engine.ProbeResult) error {
+	if !pageCheckApplies(cfg, name) || !isHTMLType(probe.ContentType) {
+		return nil
+	}
+	if probe.FileSize > errorPageMaxSize {
+		return nil
+	}
+	if len(probe.Head) > 1 && !looksLikeHTML(probe.Head) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is served as %s", ErrErrorPage, name, probe.ContentType)
+}
+
+// checkCompletedPage fails when the completed file at path, saved as a
+// binary format, holds an HTML page instead. The page's title goes in the
+// error.
+func checkCompletedPage(cfg *types.DownloadConfig, path string) error {
+	name := filepath.Base(path)
+	if !pageCheckApplies(cfg, name) {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() > errorPageMaxSize {
+		return nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil || !looksLikeHTML(data) {
+		return nil
+	}
+	if title := pageTitle(data); title != "" {
+		return fmt.Errorf("%w: %s holds the page %q", ErrErrorPage, name, title)
+	}
+	return fmt.Errorf("%w: %s holds an HTML page", ErrErrorPage, name)
+}
+
+// pageCheckApplies reports whether a download saved as name is checked for
+// error pages: it must be named as a binary format, and not expect a
+// Content-Type of its own (--expect-header "Content-Type: text/html" lets
+// one through)
+func pageCheckApplies(cfg *types.DownloadConfig, name string) bool {
+	return utils.BinaryExtension(name) && len(cfg.ExpectHeaders.Values("Content-Type")) == 0
+}
+
+// isHTMLType reports whether a Content-Type header names an HTML page
+func isHTMLType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// looksLikeHTML reports whether data, the start of a response, is an HTML
+// page by its opening tags
+func looksLikeHTML(data []byte) bool {
+	if strings.HasPrefix(http.DetectContentType(data), "text/html") {
+		return true
+	}
+	// XHTML pages start with an XML declaration
+	head := bytes.ToLower(data[:min(len(data), 1024)])
+	return bytes.HasPrefix(bytes.TrimSpace(head), []byte("<?xml")) && bytes.Contains(head, []byte("<html"))
+}
+
+// pageTitle returns the title of the HTML page in data, on one line
+func pageTitle(data []byte) string {
+	m := titlePattern.FindSubmatch(data)
+	if m == nil {
+		return ""
+	}
+	title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	if len(title) > maxTitleLength {
+		title = strings.ToValidUTF8(title[:maxTitleLength], "") + "..."
+	}
+	return title
+}
+
+// setAsidePage renames the completed page at path to a free name ending in
+// pageSuffix and returns it
+func setAsidePage(path string) (string, error) {
+	dest := nextFreePath(path+pageSuffix, pathOnDisk)
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
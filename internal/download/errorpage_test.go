@@ -0,0 +1,125 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+const loginPage = "<!DOCTYPE html>\n<html><head><title>Sign in &ndash;\n Example</title></head><body>...</body></html>"
+
+func TestCheckErrorPage(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		size        int64
+		head        string
+		expect      http.Header
+		ok          bool
+	}{
+		{name: "dataset.tar.gz", contentType: "text/html; charset=utf-8", size: 1200, head: loginPage},
+		{name: "dataset.tar.gz", contentType: "text/html", head: "<"}, // Range honoured: one byte says nothing
+		{name: "dataset.tar.gz", contentType: "text/html", size: 1200, head: "\x1f\x8b\x08\x00", ok: true},
+		{name: "dataset.tar.gz", contentType: "text/html", size: 3 << 20, ok: true},
+		{name: "dataset.tar.gz", contentType: "application/gzip", size: 1200, ok: true},
+		{name: "index.html", contentType: "text/html", size: 1200, head: loginPage, ok: true},
+		{name: "download", contentType: "text/html", size: 1200, head: loginPage, ok: true},
+		{name: "page.zip", contentType: "text/html", size: 1200, head: loginPage, expect: http.Header{"Content-Type": {"text/html"}}, ok: true},
+	}
+	for _, tt := range tests {
+		cfg := &types.DownloadConfig{ExpectHeaders: tt.expect}
+		probe := &engine.ProbeResult{ContentType: tt.contentType, FileSize: tt.size, Head: []byte(tt.head)}
+		err := checkErrorPage(cfg, tt.name, probe)
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrErrorPage)) {
+			t.Errorf("%s as %s (%d bytes): %v, want ok=%v", tt.name, tt.contentType, tt.size, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckCompletedPage(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	cfg := &types.DownloadConfig{}
+
+	err := checkCompletedPage(cfg, write("dataset.tar.gz", loginPage))
+	if !errors.Is(err, ErrErrorPage) || !strings.Contains(err.Error(), `"Sign in – Example"`) {
+		t.Errorf("login page: %v, want ErrErrorPage quoting its title", err)
+	}
+	if err := checkCompletedPage(cfg, write("untitled.zip", "  <html><body>Not found</body></html>")); !errors.Is(err, ErrErrorPage) {
+		t.Errorf("untitled page: %v, want ErrErrorPage", err)
+	}
+	if err := checkCompletedPage(cfg, write("real.zip", "PK\x03\x04<html>")); err != nil {
+		t.Errorf("real ZIP: %v", err)
+	}
+	if err := checkCompletedPage(cfg, write("saved.html", loginPage)); err != nil {
+		t.Errorf("page saved as a page: %v", err)
+	}
+	cfg.ExpectHeaders = http.Header{"Content-Type": {"text/html"}}
+	if err := checkCompletedPage(cfg, write("wanted.zip", loginPage)); err != nil {
+		t.Errorf("page expected by Content-Type: %v", err)
+	}
+}
+
+func TestTUIDownload_ErrorPage(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		saved       bool // Whether the page gets past the probe
+	}{
+		{"served-as-html.tar.gz", "text/html; charset=utf-8", false},
+		{"served-as-binary.tar.gz", "application/octet-stream", true},
+	} {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Content-Type", tt.contentType)
+			w.Write([]byte(loginPage))
+		}))
+		defer server.Close()
+
+		id := types.NewDownloadID()
+		err := TUIDownload(context.Background(), &types.DownloadConfig{
+			URL:        server.URL + "/" + tt.name,
+			OutputPath: tmpDir,
+			ID:         id,
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 2},
+		})
+		if !errors.Is(err, ErrErrorPage) {
+			t.Fatalf("%s: TUIDownload() = %v, want ErrErrorPage", tt.name, err)
+		}
+		path := filepath.Join(tmpDir, tt.name)
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s saved under its own name", tt.name)
+		}
+		if !tt.saved {
+			if requests != 1 {
+				t.Errorf("%s: %d requests, want only the probe", tt.name, requests)
+			}
+			continue
+		}
+		if _, err := os.Stat(path + pageSuffix); err != nil {
+			t.Errorf("%s not kept as %s: %v", tt.name, tt.name+pageSuffix, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// ErrUnexpectedResponse is returned when the server's answer to the probe
+// does not match what the download expects of it
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+// checkExpected fails when the probe shows another file than the download
+// expects: a size other than cfg.ExpectedSize, or a header in
+// cfg.ExpectHeaders sent with another value or not at all. It runs before
+// anything is written, so an error page is never saved as the file.
+func checkExpected(cfg *types.DownloadConfig, probe *engine.ProbeResult) error {
+	if cfg.ExpectedSize > 0 && probe.FileSize > 0 && probe.FileSize != cfg.ExpectedSize {
+		return fmt.Errorf("%w: server reports %d bytes, expected %d", ErrUnexpectedResponse, probe.FileSize, cfg.ExpectedSize)
+	}
+	for name, values := range cfg.ExpectHeaders {
+		for _, want := range values {
+			if got := probe.Header.Values(name); !headerMatches(got, want) {
+				if len(got) == 0 {
+					return fmt.Errorf("%w: server sent no %s, expected %q", ErrUnexpectedResponse, name, want)
+				}
+				return fmt.Errorf("%w: server sent %s %q, expected %q", ErrUnexpectedResponse, name, strings.Join(got, ", "), want)
+			}
+		}
+	}
+	return nil
+}
+
+// headerMatches reports whether one of the values a server sent for a header
+// is want. Case is ignored, and a value with parameters, such as
+// "text/html; charset=utf-8", also matches want without them.
+func headerMatches(got []string, want string) bool {
+	want = strings.TrimSpace(want)
+	for _, v := range got {
+		v = strings.TrimSpace(v)
+		if strings.EqualFold(v, want) {
+			return true
+		}
+		if base, _, ok := strings.Cut(v, ";"); ok && !strings.Contains(want, ";") && strings.EqualFold(strings.TrimSpace(base), want) {
+			return true
+		}
+	}
+	return false
+}
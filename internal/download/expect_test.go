@@ -0,0 +1,73 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestCheckExpected(t *testing.T) {
+	probe := &engine.ProbeResult{
+		FileSize: 1000,
+		Header:   http.Header{"Content-Type": {"text/html; charset=utf-8"}, "X-Build": {"42"}},
+	}
+	tests := []struct {
+		size    int64
+		headers http.Header
+		ok      bool
+	}{
+		{ok: true},
+		{size: 1000, ok: true},
+		{size: 999},
+		{headers: http.Header{"Content-Type": {"TEXT/HTML"}}, ok: true},
+		{headers: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, ok: true},
+		{headers: http.Header{"Content-Type": {"text/html; charset=latin1"}}},
+		{headers: http.Header{"Content-Type": {"application/zip"}}},
+		{headers: http.Header{"X-Build": {"42"}, "Content-Type": {"text/html"}}, ok: true},
+		{headers: http.Header{"Etag": {`"v1"`}}},
+	}
+	for _, tt := range tests {
+		cfg := &types.DownloadConfig{ExpectedSize: tt.size, ExpectHeaders: tt.headers}
+		err := checkExpected(cfg, probe)
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrUnexpectedResponse)) {
+			t.Errorf("size %d headers %v: %v, want ok=%v", tt.size, tt.headers, err, tt.ok)
+		}
+	}
+}
+
+func TestTUIDownload_ExpectHeader(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>Session expired</html>"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	id := types.NewDownloadID()
+	cfg := &types.DownloadConfig{
+		URL:           server.URL + "/release.zip",
+		OutputPath:    dir,
+		ID:            id,
+		State:         types.NewProgressState(id, 0),
+		ExpectHeaders: http.Header{"Content-Type": {"application/zip"}},
+	}
+	err := TUIDownload(context.Background(), cfg)
+	if !errors.Is(err, ErrUnexpectedResponse) || !strings.Contains(err.Error(), "text/html") {
+		t.Fatalf("TUIDownload() = %v, want an unexpected Content-Type", err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want only the probe", requests)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files written for a rejected download", len(entries))
+	}
+}
@@ -0,0 +1,39 @@
+package download
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// magicHeaderSize is how much of a file is read to tell its type; some
+// formats, such as Office documents inside a ZIP, are only told apart a few
+// KB in
+const magicHeaderSize = 8192
+
+// fixExtension renames the completed file at path when its content shows
+// that its extension is missing or is that of the page that served it, see
+// utils.CorrectExtension. It returns where the file is now.
+func fixExtension(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return path
+	}
+	header := make([]byte, magicHeaderSize)
+	n, _ := io.ReadFull(f, header)
+	f.Close()
+
+	name, ok := utils.CorrectExtension(filepath.Base(path), header[:n])
+	if !ok {
+		return path
+	}
+	dest := nextFreePath(filepath.Join(filepath.Dir(path), name), pathOnDisk)
+	if err := os.Rename(path, dest); err != nil {
+		utils.Debug("Failed to rename %s to %s: %v", path, dest, err)
+		return path
+	}
+	utils.Debug("Renamed %s to %s after its content", path, dest)
+	return dest
+}
@@ -0,0 +1,75 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestTUIDownload_FixExtension(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("release/notes.txt")
+	w.Write(bytes.Repeat([]byte("surge "), 1000))
+	zw.Close()
+	content := buf.Bytes()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="get.php"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, fix := range []bool{false, true} {
+		dir := t.TempDir()
+		// A file already named get.zip is left alone
+		if err := os.WriteFile(filepath.Join(dir, "get.zip"), []byte("other"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		progressCh := make(chan any, 100)
+		id := types.NewDownloadID()
+		cfg := &types.DownloadConfig{
+			URL:          server.URL + "/get.php?id=1",
+			OutputPath:   dir,
+			ID:           id,
+			ProgressCh:   progressCh,
+			State:        types.NewProgressState(id, 0),
+			FixExtension: fix,
+		}
+		err := TUIDownload(context.Background(), cfg)
+		close(progressCh)
+		if err != nil {
+			t.Fatalf("fix=%v: %v", fix, err)
+		}
+		var renamed *events.ExtensionFixedMsg
+		for msg := range progressCh {
+			if m, ok := msg.(events.ExtensionFixedMsg); ok {
+				renamed = &m
+			}
+		}
+
+		want := filepath.Join(dir, "get.php")
+		if fix {
+			want = filepath.Join(dir, "get(1).zip")
+		}
+		if cfg.DestPath != want {
+			t.Errorf("fix=%v: saved as %s, want %s", fix, cfg.DestPath, want)
+		}
+		if data, err := os.ReadFile(want); err != nil || !bytes.Equal(data, content) {
+			t.Errorf("fix=%v: %s does not hold the download: %v", fix, want, err)
+		}
+		if fix != (renamed != nil) || (renamed != nil && (renamed.Filename != "get.php" || renamed.DestPath != want)) {
+			t.Errorf("fix=%v: rename event %+v", fix, renamed)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package download
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/hooks"
+	"github.com/surge-downloader/surge/internal/plugins"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// runCompleteHook runs the on_complete program for the file at destPath and
+// moves the file where the program asks. It returns the file's final path.
+func runCompleteHook(cfg *types.DownloadConfig, destPath string, size int64) string {
+	if cfg.Hooks.OnComplete == "" {
+		return destPath
+	}
+	res, err := hooks.Run(context.Background(), cfg.Hooks.OnComplete, hooks.Event{
+		Event:    hooks.OnComplete,
+		ID:       cfg.ID,
+		URL:      cfg.URL,
+		Mirrors:  cfg.Mirrors,
+		Filename: filepath.Base(destPath),
+		Path:     destPath,
+		Size:     size,
+	})
+	if err != nil {
+		utils.Debug("%v", err)
+		return destPath
+	}
+
+	target := hooks.Destination(destPath, res)
+	if target == destPath {
+		return destPath
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		utils.Debug("on_complete hook: %v", err)
+		return destPath
+	}
+	target = destClaims.claim(target, cfg.ID)
+	defer destClaims.release(target, cfg.ID)
+	// Only renames: moving across filesystems is left to the program itself
+	if err := os.Rename(utils.LongPath(destPath), utils.LongPath(target)); err != nil {
+		utils.Debug("on_complete hook: failed to move %s: %v", destPath, err)
+		return destPath
+	}
+	utils.Debug("on_complete hook moved %s to %s", destPath, target)
+	return target
+}
+
+// runPostProcessors hands the completed file at destPath to each
+// post-processor plugin in turn and returns where the file ends up
+func runPostProcessors(cfg *types.DownloadConfig, destPath string, size int64) string {
+	for _, plugin := range cfg.PostProcessors {
+		path, err := plugins.PostProcess(context.Background(), plugin, cfg.ID, cfg.URL, destPath, size)
+		if err != nil {
+			utils.Debug("%v", err)
+			continue
+		}
+		destPath = path
+	}
+	return destPath
+}
+
+// runErrorHook runs the on_error program in the background; its output is ignored
+func runErrorHook(cfg *types.DownloadConfig, destPath string, downloadErr error) {
+	if cfg.Hooks.OnError == "" {
+		return
+	}
+	ev := hooks.Event{
+		Event:    hooks.OnError,
+		ID:       cfg.ID,
+		URL:      cfg.URL,
+		Mirrors:  cfg.Mirrors,
+		Filename: filepath.Base(destPath),
+		Path:     destPath,
+		Error:    downloadErr.Error(),
+	}
+	program := cfg.Hooks.OnError
+	go func() {
+		if _, err := hooks.Run(context.Background(), program, ev); err != nil {
+			utils.Debug("%v", err)
+		}
+	}()
+}
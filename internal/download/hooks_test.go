@@ -0,0 +1,42 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestRunCompleteHook_MovesFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use shell scripts")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sort.sh")
+	body := "#!/bin/sh\ngrep -q '\"size\":4' && echo '{\"path\": \"Music\", \"filename\": \"song.mp3\"}'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	destPath := filepath.Join(dir, "track01.mp3")
+	if err := os.WriteFile(destPath, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &types.DownloadConfig{ID: "id", URL: "https://example.com/track01.mp3", Hooks: types.HookPrograms{OnComplete: script}}
+	got := runCompleteHook(cfg, destPath, 4)
+	want := filepath.Join(dir, "Music", "song.mp3")
+	if got != want {
+		t.Fatalf("runCompleteHook() = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("file was not moved: %v", err)
+	}
+
+	// A failing script leaves the file where it is
+	cfg.Hooks.OnComplete = filepath.Join(dir, "missing.sh")
+	if got := runCompleteHook(cfg, want, 4); got != want {
+		t.Errorf("runCompleteHook() with a broken script = %q, want %q", got, want)
+	}
+}
@@ -1,10 +1,10 @@
 package download
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -14,14 +14,12 @@ import (
 	"github.com/surge-downloader/surge/internal/engine"
 	"github.com/surge-downloader/surge/internal/engine/concurrent"
 	"github.com/surge-downloader/surge/internal/engine/events"
-	"github.com/surge-downloader/surge/internal/engine/single"
+	"github.com/surge-downloader/surge/internal/engine/sftp"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
-var probeClient = &http.Client{Timeout: types.ProbeTimeout}
-
 var ua = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) " +
 	"AppleWebKit/537.36 (KHTML, like Gecko) " +
 	"Chrome/120.0.0.0 Safari/537.36"
@@ -36,13 +34,26 @@ type ProbeResult struct {
 
 // probeServer has been moved to internal/engine/probe.go
 
-// uniqueFilePath returns a unique file path by appending (1), (2), etc. if the file exists
+// uniqueFilePath returns a unique file path by appending (1), (2), etc. if the file exists.
+// A symlink at the path, even a dangling one, counts as existing: Surge never
+// writes through or replaces a link it finds at a new download's destination.
 func uniqueFilePath(path string) string {
-	// Check if file exists (both final and incomplete)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if _, err := os.Stat(path + types.IncompleteSuffix); os.IsNotExist(err) {
-			return path // Neither exists, use original
-		}
+	return nextFreePath(path, pathOnDisk)
+}
+
+// pathOnDisk reports whether a file, link or working file exists for path
+func pathOnDisk(path string) bool {
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		return true
+	}
+	return types.HasWorkingFile(path)
+}
+
+// nextFreePath returns path, or if taken reports it in use, the first
+// "name(N)" variant that is not
+func nextFreePath(path string, taken func(string) bool) string {
+	if !taken(path) {
+		return path
 	}
 
 	// File exists, generate unique name
@@ -73,10 +84,8 @@ func uniqueFilePath(path string) string {
 
 	for i := 0; i < 100; i++ { // Try next 100 numbers
 		candidate := filepath.Join(dir, fmt.Sprintf("%s(%d)%s", base, counter+i, ext))
-		if _, err := os.Stat(candidate); os.IsNotExist(err) {
-			if _, err := os.Stat(candidate + types.IncompleteSuffix); os.IsNotExist(err) {
-				return candidate
-			}
+		if !taken(candidate) {
+			return candidate
 		}
 	}
 
@@ -88,14 +97,35 @@ func uniqueFilePath(path string) string {
 // TUIDownload is the main entry point for TUI downloads
 func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 
-	// Probe server once to get all metadata
+	// Probe server once to get all metadata. SFTP downloads keep the session
+	// opened for the probe to transfer the file.
 	utils.Debug("TUIDownload: Probing server... %s", cfg.URL)
-	probe, err := engine.ProbeServer(ctx, cfg.URL, cfg.Filename)
+	var probe *engine.ProbeResult
+	var remote *sftpSource
+	var err error
+	if sftp.IsURL(cfg.URL) {
+		remote, probe, err = openSFTP(ctx, cfg)
+	} else {
+		probe, err = engine.ProbeServer(ctx, cfg.URL, cfg.Filename, cfg.Runtime)
+	}
 	if err != nil {
 		utils.Debug("TUIDownload: Probe failed: %v\n", err)
 		return err
 	}
+	if remote != nil {
+		defer remote.Close()
+	}
 	utils.Debug("TUIDownload: Probe success %d", probe.FileSize)
+	if err := checkExpected(cfg, probe); err != nil {
+		return err
+	}
+	if err := checkErrorPage(cfg, cmp.Or(cfg.Filename, probe.Filename), probe); err != nil {
+		return err
+	}
+	// Only a checksum the download was given is saved for surge again and
+	// with resume state; the server's own one would stop matching once the
+	// file is updated
+	requestedChecksum := cfg.Checksum
 
 	// Start download timer (exclude probing time)
 	start := time.Now()
@@ -119,7 +149,13 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 		if cfg.Filename != "" {
 			filename = cfg.Filename
 		}
-		destPath = filepath.Join(cfg.OutputPath, filename)
+		// Servers may send names longer than the filesystem takes
+		filename = utils.TruncateFilename(filename, cfg.Runtime.GetMaxFilenameLength(), cfg.Runtime.GetFilenameTruncation() == types.TruncateHash)
+		dir := cfg.OutputPath
+		if cfg.SortFolder != nil && !cfg.IsResume {
+			dir = sortedDir(cfg.OutputPath, cfg.SortFolder(filename, probe.ContentType))
+		}
+		destPath = filepath.Join(dir, filename)
 	}
 
 	// Check if this is a resume (explicitly marked by TUI)
@@ -151,11 +187,13 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	if isResume {
 		// Resume: use saved destination path directly (don't generate new unique name)
 		destPath = savedState.DestPath
+		destClaims.hold(destPath, cfg.ID)
 		utils.Debug("Resuming download, using saved destPath: %s", destPath)
 	} else {
-		// Fresh download without TUI-provided filename: generate unique filename if file already exists
-		destPath = uniqueFilePath(destPath)
+		// Fresh download: take a name no file and no other running download has
+		destPath = destClaims.claim(destPath, cfg.ID)
 	}
+	defer destClaims.release(destPath, cfg.ID)
 	finalFilename := filepath.Base(destPath)
 	utils.Debug("Destination path: %s", destPath)
 
@@ -180,41 +218,69 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 		cfg.State.SetTotalSize(probe.FileSize)
 	}
 
-	// Choose downloader based on probe results
-	var downloadErr error
-	if probe.SupportsRange && probe.FileSize > 0 {
-		utils.Debug("Using concurrent downloader")
-
-		// We probe all candidate mirrors (cfg.Mirrors) to filter out invalid ones
-		var activeMirrors []string
-		if len(cfg.Mirrors) > 0 {
-			utils.Debug("Probing %d mirrors", len(cfg.Mirrors))
-			// Always check primary + mirrors to ensure we are using the best set
-			allToCheck := append([]string{cfg.URL}, cfg.Mirrors...)
-			valid, errs := engine.ProbeMirrors(ctx, allToCheck)
-
-			// Log errors
-			for u, e := range errs {
-				utils.Debug("Mirror probe failed for %s: %v", u, e)
-			}
+	// Servers without range support (or without a known size) use the same
+	// engine with a single stream instead of ranged chunks
+	singleStream := !probe.SupportsRange || probe.FileSize <= 0
+
+	// We probe all candidate mirrors (cfg.Mirrors) to filter out invalid ones
+	var activeMirrors []string
+	if remote == nil && !singleStream && len(cfg.Mirrors) > 0 {
+		utils.Debug("Probing %d mirrors", len(cfg.Mirrors))
+		// Always check primary + mirrors to ensure we are using the best set
+		allToCheck := append([]string{cfg.URL}, cfg.Mirrors...)
+		valid, errs := engine.ProbeMirrors(ctx, allToCheck, cfg.Runtime, probe)
+
+		// Log errors
+		for u, e := range errs {
+			utils.Debug("Mirror probe failed for %s: %v", u, e)
+		}
 
-			// Filter valid mirrors (excluding primary as it is handled separately)
-			for _, v := range valid {
-				if v != cfg.URL {
-					activeMirrors = append(activeMirrors, v)
-				}
+		// Filter valid mirrors (excluding primary as it is handled separately)
+		for _, v := range valid {
+			if v != cfg.URL {
+				activeMirrors = append(activeMirrors, v)
 			}
-			utils.Debug("Found %d active mirrors from %d candidates", len(activeMirrors), len(cfg.Mirrors))
 		}
+		utils.Debug("Found %d active mirrors from %d candidates", len(activeMirrors), len(cfg.Mirrors))
+	}
 
+	var downloadErr error
+	var digest string // SHA-256 the engine computed while finishing, if any
+	if remote != nil {
+		utils.Debug("Using SFTP downloader")
+		downloadErr = remote.download(ctx, cfg, destPath)
+	} else {
+		utils.Debug("Using concurrent downloader (single stream: %v)", singleStream)
 		d := concurrent.NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
-		utils.Debug("Calling Download with mirrors: %v", cfg.Mirrors)
+		d.SingleStream = singleStream
+		d.ETag, d.LastModified = probe.ETag, probe.LastModified
+		d.Settings = requestSettings(cfg)
 		downloadErr = d.Download(ctx, cfg.URL, cfg.Mirrors, activeMirrors, destPath, probe.FileSize, cfg.Verbose)
-	} else {
-		// Fallback to single-threaded downloader
-		utils.Debug("Using single-threaded downloader")
-		d := single.NewSingleDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
-		downloadErr = d.Download(ctx, cfg.URL, destPath, probe.FileSize, probe.Filename, cfg.Verbose)
+		// The file changed on the server under the download, so what is on
+		// disk is from the old one: start over once from a fresh probe
+		if errors.Is(downloadErr, types.ErrSourceChanged) {
+			var fresh *engine.ProbeResult
+			engine.ForgetProbe(cfg.URL)
+			if fresh, downloadErr = engine.ProbeServer(ctx, cfg.URL, cfg.Filename, cfg.Runtime); downloadErr == nil {
+				if err := checkExpected(cfg, fresh); err != nil {
+					return err
+				}
+				if err := checkErrorPage(cfg, finalFilename, fresh); err != nil {
+					return err
+				}
+				probe = fresh
+				if cfg.State != nil {
+					cfg.State.SetTotalSize(probe.FileSize)
+				}
+				d = concurrent.NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+				d.SingleStream = !probe.SupportsRange || probe.FileSize <= 0
+				d.ETag, d.LastModified = probe.ETag, probe.LastModified
+				d.Settings = requestSettings(cfg)
+				// Mirrors were checked against the old file
+				downloadErr = d.Download(ctx, cfg.URL, cfg.Mirrors, nil, destPath, probe.FileSize, cfg.Verbose)
+			}
+		}
+		digest = d.SHA256
 	}
 
 	// Only send completion if NO error AND not paused
@@ -225,6 +291,99 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	}
 
 	isPaused := cfg.State != nil && cfg.State.IsPaused()
+	if downloadErr == nil && !isPaused {
+		// A page sent in place of the file is failed, and renamed so it opens
+		// in a browser to show what the server said
+		if err := checkCompletedPage(cfg, destPath); err != nil {
+			if moved, mErr := setAsidePage(destPath); mErr != nil {
+				utils.Debug("Failed to set aside %s: %v", destPath, mErr)
+			} else {
+				err = fmt.Errorf("%w; kept as %s", err, filepath.Base(moved))
+				destPath = moved
+				cfg.DestPath = moved
+			}
+			downloadErr = err
+		}
+	}
+	if cfg.Checksum == "" && probe.Checksum != "" {
+		// The server's own digest header stands in for a checksum
+		cfg.Checksum = probe.Checksum
+		utils.Debug("Server declared checksum %s", probe.Checksum)
+	}
+	if downloadErr == nil && !isPaused && cfg.Checksum != "" {
+		// A file that does not match its declared hash is reported as failed
+		// and set aside under another name, so it is neither mistaken for
+		// the real file nor lost to inspection
+		if err := verifyChecksumDigest(destPath, cfg.Checksum, digest); err != nil {
+			if errors.Is(err, ErrChecksumMismatch) {
+				if moved, qErr := quarantine(destPath); qErr != nil {
+					utils.Debug("Failed to set aside %s: %v", destPath, qErr)
+				} else {
+					err = fmt.Errorf("%w; kept as %s", err, filepath.Base(moved))
+					destPath = moved
+					cfg.DestPath = moved
+				}
+			}
+			downloadErr = fmt.Errorf("verifying %s: %w", finalFilename, err)
+		} else {
+			utils.Debug("Verified %s against %s", destPath, cfg.Checksum)
+			if cfg.ProgressCh != nil {
+				cfg.ProgressCh <- events.ChecksumVerifiedMsg{DownloadID: cfg.ID, Filename: finalFilename, Checksum: cfg.Checksum}
+			}
+		}
+	}
+	if downloadErr == nil && !isPaused && cfg.Torrent != "" {
+		// Web seeds are checked piece by piece against the torrent, and a
+		// file that differs is set aside like one failing its checksum
+		meta, err := VerifyPieces(ctx, destPath, cfg.Torrent, cfg.Runtime)
+		if err != nil {
+			if errors.Is(err, ErrChecksumMismatch) {
+				if moved, qErr := quarantine(destPath); qErr != nil {
+					utils.Debug("Failed to set aside %s: %v", destPath, qErr)
+				} else {
+					err = fmt.Errorf("%w; kept as %s", err, filepath.Base(moved))
+					destPath = moved
+					cfg.DestPath = moved
+				}
+			}
+			downloadErr = fmt.Errorf("verifying %s: %w", finalFilename, err)
+		} else {
+			utils.Debug("Verified %s against the %d pieces of %s", destPath, meta.NumPieces(), cfg.Torrent)
+			if cfg.ProgressCh != nil {
+				cfg.ProgressCh <- events.ChecksumVerifiedMsg{DownloadID: cfg.ID, Filename: finalFilename, Checksum: "torrent:" + meta.InfoHash}
+			}
+		}
+	}
+	if downloadErr == nil && !isPaused && cfg.Signature != "" {
+		// A file without a good signature is set aside like one failing its
+		// checksum; one whose signature could not be fetched is only failed
+		signer, err := VerifySignature(ctx, destPath, cfg.Signature, cfg.Keyring, cfg.Runtime)
+		if err != nil {
+			if signatureRejected(err) {
+				if moved, qErr := quarantine(destPath); qErr != nil {
+					utils.Debug("Failed to set aside %s: %v", destPath, qErr)
+				} else {
+					err = fmt.Errorf("%w; kept as %s", err, filepath.Base(moved))
+					destPath = moved
+					cfg.DestPath = moved
+				}
+			}
+			downloadErr = fmt.Errorf("verifying signature of %s: %w", finalFilename, err)
+		} else {
+			utils.Debug("Verified %s, signed by %s", destPath, signer)
+			if cfg.ProgressCh != nil {
+				cfg.ProgressCh <- events.SignatureVerifiedMsg{DownloadID: cfg.ID, Filename: finalFilename, Signer: signer.String()}
+			}
+		}
+	}
+	if downloadErr == nil && !isPaused && cfg.FixExtension {
+		if fixed := fixExtension(destPath); fixed != destPath {
+			destPath = fixed
+			if cfg.ProgressCh != nil {
+				cfg.ProgressCh <- events.ExtensionFixedMsg{DownloadID: cfg.ID, Filename: finalFilename, DestPath: destPath}
+			}
+		}
+	}
 	if downloadErr == nil && !isPaused {
 		elapsed := time.Since(start)
 		// For resumed downloads, add previously saved elapsed time
@@ -232,6 +391,18 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			elapsed += cfg.State.SavedElapsed
 		}
 
+		if err := applyFileMode(destPath, cfg.FileMode, cfg.MarkExecutable); err != nil {
+			utils.Debug("Failed to set permissions on %s: %v", destPath, err)
+		}
+		verified := destPath
+		destPath = runCompleteHook(cfg, destPath, probe.FileSize)
+		destPath = runPostProcessors(cfg, destPath, probe.FileSize)
+		if destPath != verified {
+			digest = "" // The engine hashed what was downloaded, not what it became
+		}
+		finalFilename = filepath.Base(destPath)
+		cfg.DestPath = destPath // Where the file ended up, for the pool's post-download actions
+
 		// Persist to history before sending event
 		if err := state.AddToMasterList(types.DownloadEntry{
 			ID:          cfg.ID,
@@ -244,19 +415,49 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			Downloaded:  probe.FileSize,
 			CompletedAt: time.Now().Unix(),
 			TimeTaken:   elapsed.Milliseconds(),
+			Mirrors:     cfg.Mirrors,
+			Headers:     cfg.Headers,
+			Checksum:    requestedChecksum,
 		}); err != nil {
 			utils.Debug("Failed to persist completed download: %v", err)
 		}
 
+		owned := []string{destPath}
+		if cfg.WriteManifest {
+			now := time.Now()
+			if path, err := WriteManifest(destPath, cfg.URL, now.Add(-elapsed), now); err != nil {
+				utils.Debug("Failed to write manifest for %s: %v", destPath, err)
+			} else {
+				utils.Debug("Wrote manifest %s", path)
+				owned = append(owned, path)
+			}
+		}
+		if err := applyOwnership(cfg.Ownership, owned...); err != nil {
+			utils.Debug("Failed to change owner of %s: %v", destPath, err)
+		}
+
 		if cfg.ProgressCh != nil {
 			cfg.ProgressCh <- events.DownloadCompleteMsg{
 				DownloadID: cfg.ID,
 				Filename:   finalFilename,
 				Elapsed:    elapsed,
 				Total:      probe.FileSize,
+				State:      cfg.State,
 			}
 		}
+
+		// Hashing reads the whole file, so only after the download is reported
+		// done, and not at all if the engine hashed it while finishing
+		if err := recordDigest(cfg.ID, destPath, digest); err != nil {
+			utils.Debug("Failed to record checksum of %s: %v", destPath, err)
+		}
 	} else if downloadErr != nil && !isPaused {
+		// The server turned down a request the probe promised would work, so
+		// what the probe saw is stale
+		var httpErr *types.HTTPError
+		if errors.As(downloadErr, &httpErr) {
+			engine.ForgetProbe(cfg.URL)
+		}
 		// Persist error state
 		if err := state.AddToMasterList(types.DownloadEntry{
 			ID:         cfg.ID,
@@ -267,9 +468,13 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			Status:     "error",
 			TotalSize:  probe.FileSize,
 			Downloaded: cfg.State.Downloaded.Load(),
+			Mirrors:    cfg.Mirrors,
+			Headers:    cfg.Headers,
+			Checksum:   requestedChecksum,
 		}); err != nil {
 			utils.Debug("Failed to persist error state: %v", err)
 		}
+		runErrorHook(cfg, destPath, downloadErr)
 	}
 
 	return downloadErr
@@ -287,3 +492,21 @@ func Download(ctx context.Context, url, outPath string, verbose bool, progressCh
 	}
 	return TUIDownload(ctx, &cfg)
 }
+
+// sortedDir returns the directory under outputDir a file sorted into folder
+// is saved in, creating it. It falls back to outputDir when folder is empty
+// or cannot be created.
+func sortedDir(outputDir, folder string) string {
+	if folder == "" {
+		return outputDir
+	}
+	dir := folder
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(outputDir, folder)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		utils.Debug("Failed to create category folder %s: %v", dir, err)
+		return outputDir
+	}
+	return dir
+}
@@ -2,17 +2,20 @@ package download
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/testutil"
+	"github.com/surge-downloader/surge/internal/utils"
 )
 
 func TestUniqueFilePath(t *testing.T) {
@@ -96,6 +99,23 @@ func TestUniqueFilePath(t *testing.T) {
 	}
 }
 
+func TestUniqueFilePath_DanglingSymlink(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "surge-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	link := filepath.Join(tmpDir, "file.txt")
+	if err := os.Symlink(filepath.Join(tmpDir, "missing.txt"), link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if got, want := uniqueFilePath(link), filepath.Join(tmpDir, "file(1).txt"); got != want {
+		t.Errorf("uniqueFilePath() = %v, want %v", got, want)
+	}
+}
+
 func TestUniqueFilePath_NoExtension(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "surge-test-*")
 	if err != nil {
@@ -271,7 +291,7 @@ func TestProbeServer_RangeSupported(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := engine.ProbeServer(ctx, server.URL(), "")
+	result, err := engine.ProbeServer(ctx, server.URL(), "", nil)
 	if err != nil {
 		t.Fatalf("probeServer failed: %v", err)
 	}
@@ -294,7 +314,7 @@ func TestProbeServer_RangeNotSupported(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := engine.ProbeServer(ctx, server.URL(), "")
+	result, err := engine.ProbeServer(ctx, server.URL(), "", nil)
 	if err != nil {
 		t.Fatalf("probeServer failed: %v", err)
 	}
@@ -318,7 +338,7 @@ func TestProbeServer_CustomFilenameHint(t *testing.T) {
 	defer cancel()
 
 	// Provide a custom filename hint
-	result, err := engine.ProbeServer(ctx, server.URL(), "my-custom-file.zip")
+	result, err := engine.ProbeServer(ctx, server.URL(), "my-custom-file.zip", nil)
 	if err != nil {
 		t.Fatalf("probeServer failed: %v", err)
 	}
@@ -338,7 +358,7 @@ func TestProbeServer_ContentType(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := engine.ProbeServer(ctx, server.URL(), "")
+	result, err := engine.ProbeServer(ctx, server.URL(), "", nil)
 	if err != nil {
 		t.Fatalf("probeServer failed: %v", err)
 	}
@@ -352,7 +372,7 @@ func TestProbeServer_InvalidURL(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := engine.ProbeServer(ctx, "http://invalid-host-that-does-not-exist.test:9999/file", "")
+	_, err := engine.ProbeServer(ctx, "http://invalid-host-that-does-not-exist.test:9999/file", "", nil)
 	if err == nil {
 		t.Error("Expected error for invalid URL")
 	}
@@ -369,7 +389,7 @@ func TestProbeServer_ContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	_, err := engine.ProbeServer(ctx, server.URL(), "")
+	_, err := engine.ProbeServer(ctx, server.URL(), "", nil)
 	if err == nil {
 		t.Error("Expected error when context is cancelled")
 	}
@@ -385,7 +405,7 @@ func TestProbeServer_UnexpectedStatusCode(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := engine.ProbeServer(ctx, server.URL, "")
+	_, err := engine.ProbeServer(ctx, server.URL, "", nil)
 	if err == nil {
 		t.Error("Expected error for 404 status")
 	}
@@ -401,12 +421,56 @@ func TestProbeServer_ServerError(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := engine.ProbeServer(ctx, server.URL, "")
+	_, err := engine.ProbeServer(ctx, server.URL, "", nil)
 	if err == nil {
 		t.Error("Expected error for 500 status")
 	}
 }
 
+func TestProbeServer_BlockPrivateNetworks(t *testing.T) {
+	server := testutil.NewMockServer(testutil.WithFileSize(1024))
+	defer server.Close()
+
+	// Redirects to the loopback server are refused the same way
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL(), http.StatusFound))
+	defer redirect.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	blocking := &types.RuntimeConfig{BlockPrivateNetworks: true}
+	for _, target := range []string{server.URL(), redirect.URL} {
+		_, err := engine.ProbeServer(ctx, target, "", blocking)
+		if !errors.Is(err, types.ErrBlockedAddress) {
+			t.Errorf("probe of %s: expected ErrBlockedAddress, got %v", target, err)
+		}
+	}
+	if got := server.Stats().TotalRequests; got != 0 {
+		t.Errorf("blocked probes reached the server %d times", got)
+	}
+
+	allowed := &types.RuntimeConfig{BlockPrivateNetworks: true, AllowedNetworks: []string{"127.0.0.0/8", "::1/128"}}
+	if _, err := engine.ProbeServer(ctx, redirect.URL, "", allowed); err != nil {
+		t.Errorf("expected AllowedNetworks to exempt loopback, got %v", err)
+	}
+}
+
+func TestProbeServer_MaxRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := engine.ProbeServer(ctx, server.URL+"/", "", &types.RuntimeConfig{MaxRedirects: 2})
+	if err == nil || !strings.Contains(err.Error(), "stopped after 2 redirects") {
+		t.Errorf("expected the redirect limit to stop the probe, got %v", err)
+	}
+}
+
 func TestProbeServer_ZeroFileSize(t *testing.T) {
 	// Server returns 200 OK with no Content-Length header
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -417,7 +481,7 @@ func TestProbeServer_ZeroFileSize(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := engine.ProbeServer(ctx, server.URL, "")
+	result, err := engine.ProbeServer(ctx, server.URL, "", nil)
 	if err != nil {
 		t.Fatalf("probeServer failed: %v", err)
 	}
@@ -462,7 +526,7 @@ func TestProbeServer_ContentRangeFormats(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
-			result, err := engine.ProbeServer(ctx, server.URL, "")
+			result, err := engine.ProbeServer(ctx, server.URL, "", nil)
 			if err != nil {
 				t.Fatalf("probeServer failed: %v", err)
 			}
@@ -492,7 +556,7 @@ func TestProbeServer_LargeFile(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := engine.ProbeServer(ctx, server.URL, "")
+	result, err := engine.ProbeServer(ctx, server.URL, "", nil)
 	if err != nil {
 		t.Fatalf("probeServer failed: %v", err)
 	}
@@ -686,3 +750,67 @@ func BenchmarkUniqueFilePath_WithConflict(b *testing.B) {
 		uniqueFilePath(path)
 	}
 }
+
+func TestSortedDir(t *testing.T) {
+	out := t.TempDir()
+	if got := sortedDir(out, ""); got != out {
+		t.Errorf("sortedDir with no folder = %q, want %q", got, out)
+	}
+
+	got := sortedDir(out, "Videos")
+	if want := filepath.Join(out, "Videos"); got != want {
+		t.Errorf("sortedDir = %q, want %q", got, want)
+	}
+	if info, err := os.Stat(got); err != nil || !info.IsDir() {
+		t.Errorf("category folder not created: %v", err)
+	}
+
+	abs := filepath.Join(t.TempDir(), "books")
+	if got := sortedDir(out, abs); got != abs {
+		t.Errorf("sortedDir with an absolute folder = %q, want %q", got, abs)
+	}
+
+	// A file where the folder should be leaves the download in out
+	if err := os.WriteFile(filepath.Join(out, "Music"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedDir(out, "Music"); got != out {
+		t.Errorf("sortedDir over a file = %q, want %q", got, out)
+	}
+}
+
+func TestTUIDownload_LongFilename(t *testing.T) {
+	tmpDir := t.TempDir()
+	name := strings.Repeat("very-long-release-name-", 15) + "x86_64.tar.gz"
+	server := testutil.NewMockServer(
+		testutil.WithFileSize(4096),
+		testutil.WithFilename(name),
+	)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		truncation string
+		want       string
+	}{
+		{types.TruncateEnd, name[:types.MaxFilenameLength-len(".tar.gz")] + ".tar.gz"},
+		{types.TruncateHash, utils.TruncateFilename(name, types.MaxFilenameLength, true)},
+	} {
+		id := types.NewDownloadID()
+		cfg := &types.DownloadConfig{
+			URL:        server.URL(),
+			OutputPath: filepath.Join(tmpDir, tt.truncation),
+			ID:         id,
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{FilenameTruncation: tt.truncation},
+		}
+		if err := TUIDownload(context.Background(), cfg); err != nil {
+			t.Fatalf("%s: %v", tt.truncation, err)
+		}
+		if cfg.Filename != tt.want || len(cfg.Filename) > types.MaxFilenameLength {
+			t.Errorf("%s: saved as %q, want %q", tt.truncation, cfg.Filename, tt.want)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.OutputPath, tt.want)); err != nil {
+			t.Errorf("%s: %v", tt.truncation, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestSuffix is appended to a downloaded file's path to name its manifest
+const ManifestSuffix = ".manifest.json"
+
+// ManifestChunkSize is the span covered by each chunk hash in a manifest
+const ManifestChunkSize = 4 * 1024 * 1024
+
+// Manifest describes a completed download so it can be verified later,
+// either as a whole or chunk by chunk (e.g. to find what changed upstream).
+type Manifest struct {
+	Version     int       `json:"version"`
+	File        string    `json:"file"`
+	Size        int64     `json:"size"`
+	SourceURL   string    `json:"source_url"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	Algorithm   string    `json:"algorithm"`
+	Hash        string    `json:"hash"`
+	ChunkSize   int64     `json:"chunk_size"`
+	Chunks      []string  `json:"chunks"` // Hash of each ChunkSize span, in order; the last may be shorter
+}
+
+// BuildManifest hashes the file at path in one pass, producing the whole-file
+// hash and one hash per chunkSize bytes.
+func BuildManifest(path, sourceURL string, startedAt, completedAt time.Time, chunkSize int64) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &Manifest{
+		Version:     1,
+		File:        filepath.Base(path),
+		SourceURL:   sourceURL,
+		StartedAt:   startedAt.UTC(),
+		CompletedAt: completedAt.UTC(),
+		Algorithm:   "sha256",
+		ChunkSize:   chunkSize,
+		Chunks:      []string{},
+	}
+
+	whole := sha256.New()
+	for {
+		chunk := sha256.New()
+		n, err := io.CopyN(io.MultiWriter(whole, chunk), f, chunkSize)
+		if n > 0 {
+			m.Size += n
+			m.Chunks = append(m.Chunks, hex.EncodeToString(chunk.Sum(nil)))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.Hash = hex.EncodeToString(whole.Sum(nil))
+	return m, nil
+}
+
+// WriteManifest builds the manifest for a completed download and writes it
+// next to the file. It returns the manifest path.
+func WriteManifest(path, sourceURL string, startedAt, completedAt time.Time) (string, error) {
+	m, err := BuildManifest(path, sourceURL, startedAt, completedAt, ManifestChunkSize)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	manifestPath := path + ManifestSuffix
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return "", err
+	}
+	return manifestPath, nil
+}
@@ -0,0 +1,112 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBuildManifest_Chunks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "surge-manifest-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	data := []byte("0123456789")
+	path := filepath.Join(tmpDir, "file.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m, err := BuildManifest(path, "http://example.com/file.bin", start, start.Add(time.Minute), 4)
+	if err != nil {
+		t.Fatalf("BuildManifest failed: %v", err)
+	}
+
+	if m.Size != int64(len(data)) {
+		t.Errorf("Size = %d, want %d", m.Size, len(data))
+	}
+	if m.Hash != sha256Hex(data) {
+		t.Errorf("Hash = %s, want %s", m.Hash, sha256Hex(data))
+	}
+	want := []string{sha256Hex(data[0:4]), sha256Hex(data[4:8]), sha256Hex(data[8:])}
+	if len(m.Chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(m.Chunks), len(want))
+	}
+	for i := range want {
+		if m.Chunks[i] != want[i] {
+			t.Errorf("chunk %d = %s, want %s", i, m.Chunks[i], want[i])
+		}
+	}
+	if m.File != "file.bin" || m.SourceURL != "http://example.com/file.bin" {
+		t.Errorf("unexpected file/source: %q %q", m.File, m.SourceURL)
+	}
+}
+
+func TestBuildManifest_EmptyFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "surge-manifest-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "empty.bin")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := BuildManifest(path, "", time.Now(), time.Now(), ManifestChunkSize)
+	if err != nil {
+		t.Fatalf("BuildManifest failed: %v", err)
+	}
+	if m.Size != 0 || len(m.Chunks) != 0 {
+		t.Errorf("expected empty manifest, got size %d with %d chunks", m.Size, len(m.Chunks))
+	}
+	if m.Hash != sha256Hex(nil) {
+		t.Errorf("Hash = %s, want hash of empty input", m.Hash)
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "surge-manifest-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "file.bin")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestPath, err := WriteManifest(path, "http://example.com/file.bin", time.Now(), time.Now())
+	if err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+	if manifestPath != path+ManifestSuffix {
+		t.Errorf("manifest path = %s, want %s", manifestPath, path+ManifestSuffix)
+	}
+
+	raw, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatalf("manifest is not valid JSON: %v", err)
+	}
+	if m.Hash != sha256Hex([]byte("hello")) || len(m.Chunks) != 1 {
+		t.Errorf("unexpected manifest contents: %+v", m)
+	}
+}
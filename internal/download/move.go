@@ -0,0 +1,109 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// MoveFile moves the file of completed download id from path into dir and
+// records its new path in the history, along with its checksum. Its hash
+// manifest, if any, goes with it. Within a filesystem the file is renamed;
+// across filesystems it is copied, checked against the original and only
+// then deleted from where it was. It returns the new path.
+func MoveFile(id, path, dir string) (string, error) {
+	dir = utils.EnsureAbsPath(dir)
+	if info, err := os.Stat(utils.LongPath(dir)); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	dest := filepath.Join(dir, filepath.Base(path))
+	if dest == path {
+		return "", fmt.Errorf("%s is already in %s", filepath.Base(path), dir)
+	}
+	if _, err := os.Lstat(utils.LongPath(dest)); err == nil {
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+
+	if err := moveOne(path, dest); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(utils.LongPath(path + ManifestSuffix)); err == nil {
+		if err := moveOne(path+ManifestSuffix, dest+ManifestSuffix); err != nil {
+			utils.Debug("Move: failed to move manifest of %s: %v", id, err)
+		}
+	}
+	if err := state.MoveDestPath(id, path, dest); err != nil {
+		return dest, fmt.Errorf("moved to %s, but failed to update history: %w", dest, err)
+	}
+	return dest, nil
+}
+
+// moveOne renames src to dest, or copies it where a rename cannot, such as
+// onto another filesystem
+func moveOne(src, dest string) error {
+	err := os.Rename(utils.LongPath(src), utils.LongPath(dest))
+	var linkErr *os.LinkError
+	if err == nil || !errors.As(err, &linkErr) || os.IsNotExist(err) {
+		return err
+	}
+	utils.Debug("Move: rename of %s failed (%v), copying instead", src, err)
+	if err := copyVerified(src, dest); err != nil {
+		return err
+	}
+	return os.Remove(utils.LongPath(src))
+}
+
+// copyVerified copies src to dest through a temporary file in the
+// destination directory, and keeps it only if it reads back with the hash
+// of src. The permissions and modification time of src are kept.
+func copyVerified(src, dest string) error {
+	in, err := os.Open(utils.LongPath(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(utils.LongPath(filepath.Dir(dest)), "."+filepath.Base(dest)+".*.moving")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed into place
+
+	h := sha256.New()
+	if _, err := io.Copy(tmp, io.TeeReader(in, h)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("copying %s: %w", src, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	want := hex.EncodeToString(h.Sum(nil))
+	got, err := HashFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("copy of %s does not match the original", src)
+	}
+	_ = os.Chmod(tmp.Name(), info.Mode().Perm())
+	_ = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	return os.Rename(tmp.Name(), utils.LongPath(dest))
+}
@@ -0,0 +1,97 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestMoveFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	src := filepath.Join(tmpDir, "file.iso")
+	if err := os.WriteFile(src, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src+ManifestSuffix, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.AddToMasterList(types.DownloadEntry{ID: "id1", URL: "https://example.com/file.iso", DestPath: src, Filename: "file.iso", Status: "completed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordChecksum("id1", src); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmpDir, "archive")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dest, err := MoveFile("id1", src, dir)
+	if err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	if want := filepath.Join(dir, "file.iso"); dest != want {
+		t.Errorf("MoveFile = %q, want %q", dest, want)
+	}
+	for _, path := range []string{dest, dest + ManifestSuffix} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s not moved: %v", filepath.Base(path), err)
+		}
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("original file left in place")
+	}
+	if entry, _ := state.GetDownload("id1"); entry == nil || entry.DestPath != dest {
+		t.Errorf("history path = %+v, want %s", entry, dest)
+	}
+	if c, _ := state.GetChecksum(dest); c == nil {
+		t.Error("checksum not moved with the file")
+	}
+
+	if _, err := MoveFile("id1", dest, dir); err == nil {
+		t.Error("moving a file into its own directory succeeded")
+	}
+	if err := os.WriteFile(src, []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MoveFile("id1", src, dir); err == nil {
+		t.Error("moving over an existing file succeeded")
+	}
+}
+
+func TestCopyVerified(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(src, []byte("some data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(dir, "b.bin")
+	if err := copyVerified(src, dest); err != nil {
+		t.Fatalf("copyVerified failed: %v", err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil || string(data) != "some data" {
+		t.Fatalf("copy = %q, %v", data, err)
+	}
+	info, _ := os.Stat(dest)
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("copy modified at %v, want %v", info.ModTime(), modTime)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
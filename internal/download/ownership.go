@@ -0,0 +1,82 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// ParseOwner parses an owner spec of the form "user[:group]" or ":group",
+// where user and group are names or numeric IDs. A missing part is -1.
+func ParseOwner(spec string) (uid, gid int, err error) {
+	userPart, groupPart, _ := strings.Cut(spec, ":")
+	if userPart == "" && groupPart == "" {
+		return -1, -1, fmt.Errorf("invalid owner %q: use user[:group]", spec)
+	}
+
+	uid, gid = -1, -1
+	if userPart != "" {
+		if uid, err = strconv.Atoi(userPart); err != nil {
+			u, lookupErr := user.Lookup(userPart)
+			if lookupErr != nil {
+				return -1, -1, fmt.Errorf("unknown user %q", userPart)
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if groupPart != "" {
+		if gid, err = strconv.Atoi(groupPart); err != nil {
+			g, lookupErr := user.LookupGroup(groupPart)
+			if lookupErr != nil {
+				return -1, -1, fmt.Errorf("unknown group %q", groupPart)
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// matchOwnership picks the rule whose Path is the closest ancestor of
+// destPath. A rule with an empty Path matches every destination.
+func matchOwnership(rules []types.OwnershipRule, destPath string) (types.OwnershipRule, bool) {
+	var best types.OwnershipRule
+	bestLen := -1
+	for _, rule := range rules {
+		dir := filepath.Clean(rule.Path)
+		if rule.Path != "" {
+			rel, err := filepath.Rel(dir, destPath)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+		}
+		if n := len(rule.Path); n > bestLen {
+			best, bestLen = rule, n
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// applyOwnership chowns the completed files at paths according to the rule
+// for the first one. Only root can give files away, so it does nothing for
+// other users and on Windows.
+func applyOwnership(rules []types.OwnershipRule, paths ...string) error {
+	if len(rules) == 0 || len(paths) == 0 || runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		return nil
+	}
+	rule, ok := matchOwnership(rules, paths[0])
+	if !ok || (rule.UID < 0 && rule.GID < 0) {
+		return nil
+	}
+	for _, path := range paths {
+		if err := os.Chown(path, rule.UID, rule.GID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package download
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestParseOwner(t *testing.T) {
+	tests := []struct {
+		spec     string
+		uid, gid int
+		wantErr  bool
+	}{
+		{"1000:1000", 1000, 1000, false},
+		{"1000", 1000, -1, false},
+		{":100", -1, 100, false},
+		{"0:0", 0, 0, false},
+		{"", -1, -1, true},
+		{":", -1, -1, true},
+		{"no-such-user-surge-test", -1, -1, true},
+	}
+
+	for _, tt := range tests {
+		uid, gid, err := ParseOwner(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOwner(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (uid != tt.uid || gid != tt.gid) {
+			t.Errorf("ParseOwner(%q) = %d:%d, want %d:%d", tt.spec, uid, gid, tt.uid, tt.gid)
+		}
+	}
+}
+
+func TestMatchOwnership(t *testing.T) {
+	root := filepath.FromSlash("/srv")
+	rules := []types.OwnershipRule{
+		{Path: "", UID: 1, GID: 1},
+		{Path: filepath.Join(root, "media"), UID: 2, GID: 2},
+		{Path: filepath.Join(root, "media", "movies"), UID: 3, GID: 3},
+	}
+
+	tests := []struct {
+		dest    string
+		wantUID int
+	}{
+		{filepath.Join(root, "media", "movies", "a.mkv"), 3},
+		{filepath.Join(root, "media", "music", "b.flac"), 2},
+		{filepath.Join(root, "mediaextra", "c.bin"), 1}, // Not under /srv/media
+		{filepath.Join(root, "other", "d.bin"), 1},
+	}
+
+	for _, tt := range tests {
+		rule, ok := matchOwnership(rules, tt.dest)
+		if !ok || rule.UID != tt.wantUID {
+			t.Errorf("matchOwnership(%q) = %+v (ok=%v), want uid %d", tt.dest, rule, ok, tt.wantUID)
+		}
+	}
+
+	if _, ok := matchOwnership(rules[1:], filepath.Join(root, "other", "d.bin")); ok {
+		t.Error("expected no match without a catch-all rule")
+	}
+}
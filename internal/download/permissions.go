@@ -0,0 +1,73 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// executableMagic lists file headers of programs that can be run directly:
+// scripts with a shebang, ELF and Mach-O binaries
+var executableMagic = [][]byte{
+	[]byte("#!"),
+	{0x7f, 'E', 'L', 'F'},
+	{0xfe, 0xed, 0xfa, 0xce}, // Mach-O 32-bit
+	{0xfe, 0xed, 0xfa, 0xcf}, // Mach-O 64-bit
+	{0xce, 0xfa, 0xed, 0xfe}, // Mach-O 32-bit, little endian
+	{0xcf, 0xfa, 0xed, 0xfe}, // Mach-O 64-bit, little endian
+}
+
+// ParseFileMode parses an octal permission string such as "644" or "0644"
+func ParseFileMode(s string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0o777 {
+		return 0, fmt.Errorf("invalid file mode %q: use octal permissions like 0644", s)
+	}
+	return os.FileMode(v), nil
+}
+
+// isExecutableFile reports whether the file at path starts with a header of
+// a directly runnable program
+func isExecutableFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	n, _ := io.ReadFull(f, header)
+	for _, magic := range executableMagic {
+		if bytes.HasPrefix(header[:n], magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFileMode sets the permissions of a completed download. A zero mode
+// keeps the permissions the file was created with. With markExec, programs
+// and scripts also get an execute bit wherever they are readable.
+func applyFileMode(path string, mode os.FileMode, markExec bool) error {
+	if mode == 0 && !markExec {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	current := info.Mode().Perm()
+	if mode == 0 {
+		mode = current
+	}
+	if markExec && isExecutableFile(path) {
+		mode |= (mode & 0o444) >> 2
+	}
+	if mode == current {
+		return nil
+	}
+	return os.Chmod(path, mode)
+}
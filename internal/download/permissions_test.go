@@ -0,0 +1,88 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{"0644", 0o644, false},
+		{"644", 0o644, false},
+		{"0755", 0o755, false},
+		{"0600", 0o600, false},
+		{"rw-r--r--", 0, true},
+		{"0888", 0, true},
+		{"01777", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFileMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFileMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFileMode(%q) = %o, want %o", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permission bits are not supported on Windows")
+	}
+	tmpDir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	perm := func(path string) os.FileMode {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		mode     os.FileMode
+		markExec bool
+		want     os.FileMode
+	}{
+		{"unchanged by default", "data", 0, false, 0o600},
+		{"explicit mode", "data", 0o644, false, 0o644},
+		{"script marked executable", "#!/bin/sh\necho hi\n", 0o644, true, 0o755},
+		{"elf keeps own mode", "\x7fELF....", 0, true, 0o700},
+		{"data not marked", "PK\x03\x04", 0o644, true, 0o644},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := write(fmt.Sprintf("file%d", i), tt.content)
+			if err := applyFileMode(path, tt.mode, tt.markExec); err != nil {
+				t.Fatalf("applyFileMode failed: %v", err)
+			}
+			if got := perm(path); got != tt.want {
+				t.Errorf("mode = %o, want %o", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/torrent"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// VerifyPieces checks the file at path against the piece hashes of the
+// .torrent at ref, a URL or a local file, and returns the torrent. A piece
+// that differs gives ErrChecksumMismatch.
+func VerifyPieces(ctx context.Context, path, ref string, runtime *types.RuntimeConfig) (*torrent.Metainfo, error) {
+	meta, err := readTorrent(ctx, ref, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("reading torrent: %w", err)
+	}
+	if err := meta.VerifyPieces(path); err != nil {
+		if errors.Is(err, torrent.ErrPieceMismatch) {
+			return nil, fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+		}
+		return nil, err
+	}
+	return meta, nil
+}
+
+// CheckTorrent fails unless the .torrent at ref, a URL or a local file, can
+// be read and describes a payload VerifyPieces can check, so that a request
+// naming one Surge cannot use is refused before anything is downloaded
+func CheckTorrent(ctx context.Context, ref string, runtime *types.RuntimeConfig) error {
+	meta, err := readTorrent(ctx, ref, runtime)
+	if err != nil {
+		return fmt.Errorf("reading torrent: %w", err)
+	}
+	return meta.CheckVerifiable()
+}
+
+// readTorrent returns the .torrent at a URL or path
+func readTorrent(ctx context.Context, ref string, runtime *types.RuntimeConfig) (*torrent.Metainfo, error) {
+	if IsSignatureURL(ref) {
+		return engine.FetchMetainfo(ctx, ref, runtime)
+	}
+	return torrent.LoadMetainfo(ref)
+}
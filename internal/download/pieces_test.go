@@ -0,0 +1,91 @@
+package download
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestTUIDownload_TorrentPieces(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	content := strings.Repeat("web seeded payload ", 100)
+	const pieceLength = 256
+	var pieces []byte
+	for off := 0; off < len(content); off += pieceLength {
+		sum := sha1.Sum([]byte(content[off:min(off+pieceLength, len(content))]))
+		pieces = append(pieces, sum[:]...)
+	}
+	info := fmt.Sprintf("d6:lengthi%de4:name8:seed.bin12:piece lengthi%de6:pieces%d:%se",
+		len(content), pieceLength, len(pieces), pieces)
+	torrentPath := filepath.Join(tmpDir, "seed.torrent")
+	if err := os.WriteFile(torrentPath, []byte("d4:info"+info+"e"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/good") {
+			w.Write([]byte(content))
+			return
+		}
+		// Same size, one piece changed
+		w.Write([]byte(strings.Replace(content, "payload", "PAYLOAD", 1)))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"good.bin", true},
+		{"bad.bin", false},
+	} {
+		progressCh := make(chan any, 100)
+		id := types.NewDownloadID()
+		err := TUIDownload(context.Background(), &types.DownloadConfig{
+			URL:        server.URL + "/" + tt.name,
+			OutputPath: tmpDir,
+			ID:         id,
+			Filename:   tt.name,
+			ProgressCh: progressCh,
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{},
+			Torrent:    torrentPath,
+		})
+		close(progressCh)
+		var verified string
+		for msg := range progressCh {
+			if m, ok := msg.(events.ChecksumVerifiedMsg); ok {
+				verified = m.Checksum
+			}
+		}
+
+		path := filepath.Join(tmpDir, tt.name)
+		if tt.ok {
+			if err != nil || !strings.HasPrefix(verified, "torrent:") {
+				t.Errorf("%s: err = %v, verified = %q", tt.name, err, verified)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "piece 1 of") || verified != "" {
+			t.Errorf("%s: err = %v, verified = %q; want the first piece to mismatch", tt.name, err, verified)
+		}
+		if _, err := os.Stat(path + QuarantineSuffix); err != nil {
+			t.Errorf("%s not kept as %s: %v", tt.name, tt.name+QuarantineSuffix, err)
+		}
+	}
+}
@@ -1,53 +1,128 @@
 package download
 
 import (
+	"cmp"
 	"context"
+	"net/http"
+	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/plugins"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
 // activeDownload tracks a download that's currently running
 type activeDownload struct {
-	config types.DownloadConfig
-	cancel context.CancelFunc
+	config   types.DownloadConfig
+	cancel   context.CancelFunc
+	finished chan struct{} // Closed once the worker has stopped touching the files
+	conns    int           // Connections granted from the global budget, see rebalanceLocked
+	started  uint64        // Start order among the pool's downloads
 }
 
+// scheduledDownload is a download held back by its schedule
+type scheduledDownload struct {
+	config  types.DownloadConfig
+	startAt time.Time
+	timer   *time.Timer // Queues the download at startAt
+}
+
+// QueueCapacity is how many downloads can wait for a worker before Add blocks
+const QueueCapacity = 100
+
+// MaxWorkers is the most downloads a pool runs at once
+const MaxWorkers = 32
+
 type WorkerPool struct {
-	taskChan     chan types.DownloadConfig
+	ready        chan struct{} // One token per download added to the queue; workers take the next in order
+	retire       chan struct{} // One token per worker to stop, see SetMaxDownloads
 	progressCh   chan<- any
-	downloads    map[string]*activeDownload      // Track active downloads for pause/resume
-	queued       map[string]types.DownloadConfig // Track queued downloads
+	downloads    map[string]*activeDownload       // Track active downloads for pause/resume
+	queued       map[string]types.DownloadConfig  // Track queued downloads
+	order        []string                         // IDs of queued downloads, next to start first
+	scheduled    map[string]*scheduledDownload    // Downloads waiting for their scheduled start
+	phases       map[string]events.DownloadPhase  // Last phase reported per download
+	phaseMsgs    []events.DownloadStateChangedMsg // Phase changes not yet sent, oldest first (guarded by mu)
+	phaseWake    chan struct{}                    // Signals sendPhases that phaseMsgs has more
 	mu           sync.RWMutex
 	wg           sync.WaitGroup //We use this to wait for all active downloads to pause before exiting the program
-	maxDownloads int
+	maxDownloads int            // Workers that are not asked to stop (guarded by mu)
+	keepPartial  atomic.Bool    // Keep .surge files of cancelled downloads
+
+	writeManifest   atomic.Bool           // Write a hash manifest for every completed download
+	fileMode        atomic.Uint32         // Permissions for completed files; 0 keeps the default
+	markExecutable  atomic.Bool           // Add execute bits to completed programs and scripts
+	fixExtensions   atomic.Bool           // Rename completed files their content shows are misnamed
+	ownership       []types.OwnershipRule // Chown rules for completed files (guarded by mu)
+	sortFolder      types.SortFolderFunc  // Picks category folders for new files (guarded by mu)
+	hooks           types.HookPrograms    // Event hook programs for downloads (guarded by mu)
+	plugins         []plugins.Plugin      // Discovered plugins (guarded by mu)
+	proxy           string                // Proxy for downloads without their own; empty uses settings (guarded by mu)
+	maxQueued       atomic.Int32          // Limit reported by QueueLimit; 0 uses the queue capacity
+	draining        atomic.Bool           // Drain was called: save queued downloads instead of starting them
+	fixedConns      atomic.Int32          // Connections per host for every download; 0 uses its config
+	speedLimit      atomic.Int64          // Bytes/sec shared by the running downloads; 0 for no limit
+	connBudget      int                   // Connections shared by the running downloads; 0 for no limit (guarded by mu)
+	connPolicy      string                // How connBudget is shared, see types.SchedulingFair (guarded by mu)
+	connFreed       chan struct{}         // Set while a worker waits for connBudget, closed when it may try again (guarded by mu)
+	starts          uint64                // Downloads started so far, for their start order (guarded by mu)
+	adaptiveConns   atomic.Bool           // Tune the connections of every download
+	holdEnded       chan struct{}         // Set while HoldAll is in effect, closed when it ends (guarded by mu)
+	actions         types.PostActions     // Run after every download (guarded by mu)
+	actionsWG       sync.WaitGroup        // Post-download actions still running
+	shutdownArmed   atomic.Bool           // A finished download asked to power off once the pool is idle
+	shutdownPending atomic.Bool           // Waiting out shutdownDelay
+	autosaveEvery   atomic.Int64          // How often waiting downloads are saved, see SetAutosave
+	autosaveOnce    sync.Once             // Starts the autosave loop
+	autosaved       map[string]struct{}   // Waiting downloads the autosave has saved (guarded by mu)
 }
 
 func NewWorkerPool(progressCh chan<- any, maxDownloads int) *WorkerPool {
 	if maxDownloads < 1 {
 		maxDownloads = 3 // Default to 3 if invalid
 	}
+	maxDownloads = min(maxDownloads, MaxWorkers)
 	pool := &WorkerPool{
-		taskChan:     make(chan types.DownloadConfig, 100), //We make it buffered to avoid blocking add
+		ready:        make(chan struct{}, QueueCapacity), //We make it buffered to avoid blocking add
+		retire:       make(chan struct{}, MaxWorkers),
 		progressCh:   progressCh,
 		downloads:    make(map[string]*activeDownload),
 		queued:       make(map[string]types.DownloadConfig),
+		scheduled:    make(map[string]*scheduledDownload),
+		phases:       make(map[string]events.DownloadPhase),
+		phaseWake:    make(chan struct{}, 1),
+		autosaved:    make(map[string]struct{}),
 		maxDownloads: maxDownloads,
 	}
 	for i := 0; i < maxDownloads; i++ {
 		go pool.worker()
 	}
+	if progressCh != nil {
+		go pool.sendPhases()
+	}
 	return pool
 }
 
-// Add adds a new download task to the pool
+// Add adds a new download task to the pool. One whose schedule does not let
+// it start yet is held until it does.
 func (p *WorkerPool) Add(cfg types.DownloadConfig) {
+	if now := time.Now(); cfg.Schedule.Next(now).After(now) {
+		p.hold(cfg, cfg.Schedule.Next(now))
+		return
+	}
+
 	p.mu.Lock()
+	if _, ok := p.queued[cfg.ID]; ok {
+		p.removeQueuedLocked(cfg.ID)
+	}
 	p.queued[cfg.ID] = cfg
+	p.enqueueLocked(cfg.ID, cfg.Priority)
 	p.mu.Unlock()
 
 	if p.progressCh != nil && !cfg.IsResume {
@@ -56,8 +131,196 @@ func (p *WorkerPool) Add(cfg types.DownloadConfig) {
 			Filename:   cfg.Filename,
 		}
 	}
+	p.setPhase(cfg.ID, cfg.Filename, events.PhaseQueued)
 
-	p.taskChan <- cfg
+	p.ready <- struct{}{}
+}
+
+// enqueueLocked places a queued download behind every one of the same or
+// higher priority. Must hold p.mu.
+func (p *WorkerPool) enqueueLocked(id string, priority types.Priority) {
+	i := len(p.order)
+	for i > 0 && p.queued[p.order[i-1]].Priority < priority {
+		i--
+	}
+	p.order = slices.Insert(p.order, i, id)
+}
+
+// removeQueuedLocked takes a download out of the queue order, returning
+// where it was or -1. Must hold p.mu.
+func (p *WorkerPool) removeQueuedLocked(id string) int {
+	i := slices.Index(p.order, id)
+	if i >= 0 {
+		p.order = slices.Delete(p.order, i, i+1)
+	}
+	return i
+}
+
+// next takes the first download off the queue. It reports false when the
+// queue is empty, as it is once the download a token was for was cancelled
+// or moved out by Drain.
+func (p *WorkerPool) next() (types.DownloadConfig, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.order) == 0 {
+		return types.DownloadConfig{}, false
+	}
+	id := p.order[0]
+	p.order = p.order[1:]
+	return p.queued[id], true
+}
+
+// MoveTo moves a queued download to position pos, 0 being the next to
+// start; pos is clamped to the queue. The download takes the priority of
+// the one it lands next to when that is needed to keep higher priorities
+// ahead. Returns false if the download is not queued.
+func (p *WorkerPool) MoveTo(id string, pos int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.removeQueuedLocked(id) < 0 {
+		return false
+	}
+	pos = max(0, min(pos, len(p.order)))
+	p.order = slices.Insert(p.order, pos, id)
+
+	cfg := p.queued[id]
+	if pos > 0 {
+		cfg.Priority = min(cfg.Priority, p.queued[p.order[pos-1]].Priority)
+	}
+	if pos < len(p.order)-1 {
+		cfg.Priority = max(cfg.Priority, p.queued[p.order[pos+1]].Priority)
+	}
+	p.queued[id] = cfg
+	return true
+}
+
+// Move moves a queued download by delta places, negative toward the front.
+// Returns false if the download is not queued.
+func (p *WorkerPool) Move(id string, delta int) bool {
+	pos := p.QueuePosition(id)
+	if pos < 0 {
+		return false
+	}
+	return p.MoveTo(id, pos+delta)
+}
+
+// SetPriority changes the priority of a queued download, placing it behind
+// the others of its new priority. Returns false if the download is not
+// queued.
+func (p *WorkerPool) SetPriority(id string, priority types.Priority) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cfg, ok := p.queued[id]
+	if !ok || p.removeQueuedLocked(id) < 0 {
+		return false
+	}
+	cfg.Priority = priority
+	p.queued[id] = cfg
+	p.enqueueLocked(id, priority)
+	return true
+}
+
+// QueuePosition returns where a queued download waits, 0 being the next to
+// start, or -1 if it is not queued
+func (p *WorkerPool) QueuePosition(id string) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Index(p.order, id)
+}
+
+// QueueOrder returns the IDs of the queued downloads, next to start first
+func (p *WorkerPool) QueueOrder() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.order)
+}
+
+// hold keeps a download out of the queue until startAt
+func (p *WorkerPool) hold(cfg types.DownloadConfig, startAt time.Time) {
+	p.mu.Lock()
+	if old, ok := p.scheduled[cfg.ID]; ok {
+		old.timer.Stop()
+	}
+	p.scheduled[cfg.ID] = &scheduledDownload{
+		config:  cfg,
+		startAt: startAt,
+		timer:   time.AfterFunc(time.Until(startAt), func() { p.release(cfg.ID) }),
+	}
+	p.mu.Unlock()
+
+	if p.progressCh != nil {
+		p.progressCh <- events.DownloadScheduledMsg{
+			DownloadID: cfg.ID,
+			URL:        cfg.URL,
+			Filename:   cfg.Filename,
+			StartAt:    startAt,
+		}
+	}
+	p.setPhase(cfg.ID, cfg.Filename, events.PhaseScheduled)
+}
+
+// release queues a held download once its start time has come
+func (p *WorkerPool) release(id string) {
+	p.mu.Lock()
+	sd, ok := p.scheduled[id]
+	delete(p.scheduled, id)
+	p.mu.Unlock()
+	if ok {
+		p.Add(sd.config)
+	}
+}
+
+// setPhase records a lifecycle transition and emits DownloadStateChangedMsg.
+// The message is queued rather than sent, so callers such as Add, which the
+// TUI calls from the goroutine that drains progressCh, never block on it.
+func (p *WorkerPool) setPhase(id, filename string, to events.DownloadPhase) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	from, tracked := p.phases[id]
+	if from == to || (!tracked && to != events.PhaseQueued && to != events.PhaseScheduled) {
+		return
+	}
+	if to == events.PhaseDone || to == events.PhaseError {
+		delete(p.phases, id)
+	} else {
+		p.phases[id] = to
+	}
+
+	if p.progressCh == nil {
+		return
+	}
+	p.phaseMsgs = append(p.phaseMsgs, events.DownloadStateChangedMsg{
+		DownloadID: id,
+		Filename:   filename,
+		From:       from,
+		To:         to,
+	})
+	select {
+	case p.phaseWake <- struct{}{}:
+	default: // Already signalled
+	}
+}
+
+// sendPhases sends queued phase changes to progressCh in the order they
+// happened
+func (p *WorkerPool) sendPhases() {
+	for range p.phaseWake {
+		p.mu.Lock()
+		msgs := p.phaseMsgs
+		p.phaseMsgs = nil
+		p.mu.Unlock()
+		for _, msg := range msgs {
+			p.progressCh <- msg
+		}
+	}
+}
+
+// Phase returns the last lifecycle phase reported for a download,
+// or an empty phase if the pool isn't tracking it
+func (p *WorkerPool) Phase(id string) events.DownloadPhase {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.phases[id]
 }
 
 // HasDownload checks if a download with the given URL already exists
@@ -70,6 +333,12 @@ func (p *WorkerPool) HasDownload(url string) bool {
 			return true
 		}
 	}
+	for _, sd := range p.scheduled {
+		if sd.config.URL == url {
+			p.mu.RUnlock()
+			return true
+		}
+	}
 	p.mu.RUnlock()
 
 	// Check persistent store (completed/queued/paused)
@@ -94,11 +363,59 @@ func (p *WorkerPool) ActiveCount() int {
 			count++
 		}
 	}
-	// Also count queued
-	count += len(p.queued)
+	// Also count queued and scheduled
+	count += len(p.queued) + len(p.scheduled)
 	return count
 }
 
+// QueueLength returns how many downloads are waiting for a worker
+func (p *WorkerPool) QueueLength() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.queued)
+}
+
+// QueueLimit returns how many downloads may wait for a worker before callers
+// should hold back. It never exceeds the task buffer, beyond which Add blocks.
+func (p *WorkerPool) QueueLimit() int {
+	if n := int(p.maxQueued.Load()); n > 0 && n < cap(p.ready) {
+		return n
+	}
+	return cap(p.ready)
+}
+
+// SetMaxDownloads changes how many downloads run at once, from 1 to
+// MaxWorkers, by starting or stopping workers. Downloads already running
+// beyond a lower limit finish first; the next only starts once fewer than n
+// are running.
+func (p *WorkerPool) SetMaxDownloads(n int) {
+	n = max(1, min(n, MaxWorkers))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ; p.maxDownloads < n; p.maxDownloads++ {
+		select {
+		case <-p.retire: // A worker asked to stop keeps going instead
+		default:
+			go p.worker()
+		}
+	}
+	for ; p.maxDownloads > n; p.maxDownloads-- {
+		p.retire <- struct{}{} // Never blocks: at most one token per worker
+	}
+}
+
+// MaxDownloads returns how many downloads run at once
+func (p *WorkerPool) MaxDownloads() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.maxDownloads
+}
+
+// SetMaxQueued lowers QueueLimit; 0 restores the default
+func (p *WorkerPool) SetMaxQueued(n int) {
+	p.maxQueued.Store(int32(n))
+}
+
 // GetAll returns all active download configs (for listing)
 func (p *WorkerPool) GetAll() []types.DownloadConfig {
 	p.mu.RLock()
@@ -108,8 +425,11 @@ func (p *WorkerPool) GetAll() []types.DownloadConfig {
 	for _, ad := range p.downloads {
 		configs = append(configs, ad.config)
 	}
-	for _, cfg := range p.queued {
-		configs = append(configs, cfg)
+	for _, id := range p.order {
+		configs = append(configs, p.queued[id])
+	}
+	for _, sd := range p.scheduled {
+		configs = append(configs, sd.config)
 	}
 	return configs
 }
@@ -165,17 +485,303 @@ func (p *WorkerPool) PauseAll() {
 	}
 }
 
-// Cancel cancels and removes a download by ID
-func (p *WorkerPool) Cancel(downloadID string) {
+// HoldAll pauses every running download and keeps queued and newly added
+// ones from starting until ResumeAll or EndHold, for when the bandwidth is
+// needed elsewhere right now
+func (p *WorkerPool) HoldAll() {
+	p.mu.Lock()
+	if p.holdEnded == nil {
+		p.holdEnded = make(chan struct{})
+	}
+	p.mu.Unlock()
+	p.PauseAll()
+}
+
+// EndHold lets queued downloads start again after HoldAll, leaving paused
+// ones paused
+func (p *WorkerPool) EndHold() {
+	p.mu.Lock()
+	if p.holdEnded != nil {
+		close(p.holdEnded)
+		p.holdEnded = nil
+	}
+	p.mu.Unlock()
+}
+
+// Held reports whether HoldAll is in effect
+func (p *WorkerPool) Held() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.holdEnded != nil
+}
+
+// ResumeAll ends a hold and resumes every paused download in the pool
+func (p *WorkerPool) ResumeAll() {
+	p.EndHold()
+	p.mu.RLock()
+	var ids []string
+	for id, ad := range p.downloads {
+		if ad != nil && ad.config.State != nil && ad.config.State.IsPaused() && !ad.config.State.Done.Load() {
+			ids = append(ids, id)
+		}
+	}
+	p.mu.RUnlock()
+	slices.Sort(ids) // Map order would start them at random
+
+	for _, id := range ids {
+		p.Resume(id)
+	}
+}
+
+// waitForConnection blocks a worker until freed, from connWaitLocked, is
+// closed. It reports false if the worker was asked to stop meanwhile.
+func (p *WorkerPool) waitForConnection(freed chan struct{}) bool {
+	select {
+	case <-freed:
+		return true
+	case <-p.retire:
+		return false
+	}
+}
+
+// connWaitLocked returns a channel closed once a download may have a
+// connection to start with. Must hold p.mu.
+func (p *WorkerPool) connWaitLocked() chan struct{} {
+	if p.connFreed == nil {
+		p.connFreed = make(chan struct{})
+	}
+	return p.connFreed
+}
+
+// connFreedLocked wakes the workers waiting for a connection.
+// Must hold p.mu.
+func (p *WorkerPool) connFreedLocked() {
+	if p.connFreed != nil {
+		close(p.connFreed)
+		p.connFreed = nil
+	}
+}
+
+// waitWhileHeld blocks a worker until HoldAll ends. It reports false if the
+// worker was asked to stop meanwhile.
+func (p *WorkerPool) waitWhileHeld() bool {
+	p.mu.RLock()
+	ended := p.holdEnded
+	p.mu.RUnlock()
+	if ended == nil {
+		return true
+	}
+	select {
+	case <-ended:
+		return true
+	case <-p.retire:
+		return false
+	}
+}
+
+// SetKeepPartialOnCancel controls whether Cancel leaves partial files on disk
+func (p *WorkerPool) SetKeepPartialOnCancel(keep bool) {
+	p.keepPartial.Store(keep)
+}
+
+// SetWriteManifest makes every download in the pool write a hash manifest on completion
+func (p *WorkerPool) SetWriteManifest(write bool) {
+	p.writeManifest.Store(write)
+}
+
+// SetConcurrency overrides the connection settings of every download the
+// pool starts: conns > 0 fixes the connections per host, adaptive lets each
+// download tune its own up to the configured limit. Zero and false keep
+// each download's own settings.
+func (p *WorkerPool) SetConcurrency(conns int, adaptive bool) {
+	p.fixedConns.Store(int32(max(conns, 0)))
+	p.adaptiveConns.Store(adaptive)
+}
+
+// SetSpeedLimit caps the total speed of the running downloads at rate
+// bytes/sec, 0 for no limit. It applies to running downloads at once.
+func (p *WorkerPool) SetSpeedLimit(rate int64) {
+	p.speedLimit.Store(max(rate, 0))
+	p.mu.Lock()
+	p.rebalanceLocked()
+	p.mu.Unlock()
+}
+
+// SetConnectionBudget caps the connections of all running downloads
+// together at total, 0 for no limit, shared as policy says (see
+// types.SchedulingFair; unknown policies are fair). Running downloads follow
+// their new shares at once. While every connection is taken, queued
+// downloads wait for a running one to finish.
+func (p *WorkerPool) SetConnectionBudget(total int, policy string) {
+	if !slices.Contains(types.SchedulingPolicies, policy) {
+		policy = types.SchedulingFair
+	}
+	p.mu.Lock()
+	p.connBudget = max(total, 0)
+	p.connPolicy = policy
+	p.rebalanceLocked()
+	p.connFreedLocked()
+	p.mu.Unlock()
+}
+
+// SpeedLimit returns the total speed limit in bytes/sec, 0 for none
+func (p *WorkerPool) SpeedLimit() int64 {
+	return p.speedLimit.Load()
+}
+
+// SetProxy sets the proxy of every download the pool starts that was not
+// given its own, in place of the configured one. Empty keeps the settings.
+func (p *WorkerPool) SetProxy(proxy string) {
+	p.mu.Lock()
+	p.proxy = proxy
+	p.mu.Unlock()
+}
+
+// Proxy returns the proxy set by SetProxy
+func (p *WorkerPool) Proxy() string {
+	if p == nil {
+		return ""
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.proxy
+}
+
+// SetFileMode sets the permissions every completed download in the pool gets.
+// Zero keeps the permissions the file was created with.
+func (p *WorkerPool) SetFileMode(mode os.FileMode) {
+	p.fileMode.Store(uint32(mode.Perm()))
+}
+
+// SetFixExtensions controls whether completed files named after the page
+// that served them, or without an extension, get the one their content shows
+func (p *WorkerPool) SetFixExtensions(fix bool) {
+	p.fixExtensions.Store(fix)
+}
+
+// SetMarkExecutable controls whether completed programs and scripts are made executable
+func (p *WorkerPool) SetMarkExecutable(mark bool) {
+	p.markExecutable.Store(mark)
+}
+
+// SetOwnership sets the rules deciding who completed downloads are chowned to.
+// They only take effect when Surge runs as root.
+func (p *WorkerPool) SetOwnership(rules []types.OwnershipRule) {
+	p.mu.Lock()
+	p.ownership = rules
+	p.mu.Unlock()
+}
+
+// SetSortFolder sets the function picking the folder, inside the output
+// directory, that a new download of a kind of file is saved in. nil saves
+// every file in the output directory itself.
+func (p *WorkerPool) SetSortFolder(fn types.SortFolderFunc) {
+	p.mu.Lock()
+	p.sortFolder = fn
+	p.mu.Unlock()
+}
+
+// SetAutosave makes the pool save the downloads waiting in its queue or for
+// their schedule to the database every interval, as Drain does, so they are
+// not lost to a crash. Each is saved once. interval <= 0 uses
+// CheckpointInterval.
+func (p *WorkerPool) SetAutosave(interval time.Duration) {
+	if interval <= 0 {
+		interval = types.CheckpointInterval
+	}
+	p.autosaveEvery.Store(int64(interval))
+	p.autosaveOnce.Do(func() { go p.autosaveLoop() })
+}
+
+// autosaveLoop runs autosave at the interval set by SetAutosave, picking up
+// changes to it
+func (p *WorkerPool) autosaveLoop() {
+	for {
+		time.Sleep(time.Duration(p.autosaveEvery.Load()))
+		if p.draining.Load() {
+			return // Drain saves the rest
+		}
+		p.autosave()
+	}
+}
+
+// autosave saves the waiting downloads not saved yet. Resumed downloads
+// already have a database entry of their own.
+func (p *WorkerPool) autosave() {
+	p.mu.Lock()
+	var unsaved []types.DownloadConfig
+	pick := func(cfg types.DownloadConfig) {
+		if _, ok := p.autosaved[cfg.ID]; ok || cfg.IsResume {
+			return
+		}
+		p.autosaved[cfg.ID] = struct{}{}
+		unsaved = append(unsaved, cfg)
+	}
+	for _, id := range p.order {
+		pick(p.queued[id])
+	}
+	for _, sd := range p.scheduled {
+		pick(sd.config)
+	}
+	p.mu.Unlock()
+
+	for _, cfg := range unsaved {
+		saveQueued(cfg)
+	}
+}
+
+// SetPlugins sets the plugins used to resolve URLs and post-process downloads
+func (p *WorkerPool) SetPlugins(found []plugins.Plugin) {
+	p.mu.Lock()
+	p.plugins = found
+	p.mu.Unlock()
+}
+
+// Plugins returns the plugins set by SetPlugins
+func (p *WorkerPool) Plugins() []plugins.Plugin {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.plugins
+}
+
+// SetHooks sets the programs run when downloads complete or fail
+func (p *WorkerPool) SetHooks(programs types.HookPrograms) {
+	p.mu.Lock()
+	p.hooks = programs
+	p.mu.Unlock()
+}
+
+// Cancel cancels and removes a download by ID.
+// Once the worker has let go of the files, its resume state and (unless kept
+// by setting) partial data are cleaned up and DownloadRemovedMsg reports the
+// bytes reclaimed. Returns false if the pool isn't tracking the download.
+func (p *WorkerPool) Cancel(downloadID string) bool {
 	p.mu.Lock()
 	ad, exists := p.downloads[downloadID]
 	if exists {
 		delete(p.downloads, downloadID)
+		delete(p.phases, downloadID)
+	}
+	if sd, ok := p.scheduled[downloadID]; ok {
+		sd.timer.Stop()
+		delete(p.scheduled, downloadID)
+		delete(p.phases, downloadID)
+		if !exists {
+			ad, exists = &activeDownload{config: sd.config}, true
+		}
+	}
+	delete(p.autosaved, downloadID)
+	if cfg, ok := p.queued[downloadID]; ok && p.removeQueuedLocked(downloadID) >= 0 {
+		delete(p.queued, downloadID)
+		delete(p.phases, downloadID)
+		if !exists {
+			ad, exists = &activeDownload{config: cfg}, true
+		}
 	}
 	p.mu.Unlock()
 
 	if !exists || ad == nil {
-		return
+		return false
 	}
 
 	// Cancel the context to stop workers
@@ -188,20 +794,54 @@ func (p *WorkerPool) Cancel(downloadID string) {
 		ad.config.State.Done.Store(true)
 	}
 
-	// Send removal message
-	if p.progressCh != nil {
-		p.progressCh <- events.DownloadRemovedMsg{
-			DownloadID: downloadID,
-			Filename:   ad.config.Filename,
+	cleanup := func() events.DownloadRemovedMsg {
+		keep := p.keepPartial.Load()
+		reclaimed, err := CleanupPartial(downloadID, ad.config.URL, ad.config.DestPath, keep)
+		if err != nil {
+			utils.Debug("Cleanup of %s failed: %v", downloadID, err)
+		}
+		return events.DownloadRemovedMsg{
+			DownloadID:  downloadID,
+			Filename:    ad.config.Filename,
+			Reclaimed:   reclaimed,
+			KeptPartial: keep,
+		}
+	}
+	report := func(msg events.DownloadRemovedMsg) {
+		if p.progressCh != nil {
+			p.progressCh <- msg
 		}
 	}
+
+	if ad.finished == nil {
+		// Never started, so nothing holds the files: clean up before returning
+		msg := cleanup()
+		go report(msg)
+		return true
+	}
+	go func() {
+		<-ad.finished
+		report(cleanup())
+	}()
+	return true
 }
 
-// Resume resumes a paused download by ID
+// Resume resumes a paused download by ID. A download waiting for its
+// schedule starts now, dropping the schedule. Resuming any one download
+// ends a HoldAll.
 func (p *WorkerPool) Resume(downloadID string) {
-	p.mu.RLock()
+	p.EndHold()
+	p.mu.Lock()
+	if sd, ok := p.scheduled[downloadID]; ok {
+		sd.timer.Stop()
+		delete(p.scheduled, downloadID)
+		p.mu.Unlock()
+		sd.config.Schedule = types.Schedule{}
+		p.Add(sd.config)
+		return
+	}
 	ad, exists := p.downloads[downloadID]
-	p.mu.RUnlock()
+	p.mu.Unlock()
 
 	if !exists || ad == nil {
 		return
@@ -225,10 +865,6 @@ func (p *WorkerPool) Resume(downloadID string) {
 		ad.config.State.SyncSessionStart()
 	}
 
-	// Re-queue the download
-	ad.config.IsResume = true
-	p.Add(ad.config)
-
 	// Send resume message
 	if p.progressCh != nil {
 		p.progressCh <- events.DownloadResumedMsg{
@@ -236,25 +872,125 @@ func (p *WorkerPool) Resume(downloadID string) {
 			Filename:   ad.config.Filename,
 		}
 	}
+
+	// Re-queue the download (reports the Paused→Queued transition)
+	ad.config.IsResume = true
+	p.Add(ad.config)
 }
 
 func (p *WorkerPool) worker() {
-	for cfg := range p.taskChan {
+	for {
+		// Stopping goes before another download
+		select {
+		case <-p.retire:
+			return
+		default:
+		}
+		if !p.waitWhileHeld() {
+			return
+		}
+		select {
+		case <-p.retire:
+			return
+		case <-p.ready:
+		}
+
+		cfg, ok := p.next()
+		if !ok {
+			continue
+		}
+		if p.draining.Load() {
+			p.shelve(cfg)
+			continue
+		}
+		if p.Held() {
+			// HoldAll came in while this worker waited: put the download back
+			p.mu.Lock()
+			p.order = slices.Insert(p.order, 0, cfg.ID)
+			p.mu.Unlock()
+			p.ready <- struct{}{}
+			continue
+		}
 		p.wg.Add(1)
 		// Create cancellable context
 		ctx, cancel := context.WithCancel(context.Background())
 
+		if p.writeManifest.Load() {
+			cfg.WriteManifest = true
+		}
+		if mode := p.fileMode.Load(); mode != 0 {
+			cfg.FileMode = os.FileMode(mode)
+		}
+		cfg.MarkExecutable = p.markExecutable.Load()
+		cfg.FixExtension = cfg.FixExtension || p.fixExtensions.Load()
+		if conns, adaptive := int(p.fixedConns.Load()), p.adaptiveConns.Load(); conns > 0 || adaptive {
+			var rt types.RuntimeConfig
+			if cfg.Runtime != nil {
+				rt = *cfg.Runtime
+			}
+			if conns > 0 {
+				rt.MaxConnectionsPerHost = conns
+			}
+			rt.AdaptiveConnections = adaptive
+			cfg.Runtime = &rt
+		}
+		p.mu.RLock()
+		cfg.Ownership = p.ownership
+		cfg.Hooks = p.hooks
+		cfg.SortFolder = p.sortFolder
+		cfg.PostProcessors = plugins.PostProcessors(p.plugins)
+		cfg.Runtime = cfg.Runtime.WithProxy(cmp.Or(cfg.Proxy, p.proxy)).WithHeaders(cfg.Headers).WithCookies(cfg.Cookies)
+		p.mu.RUnlock()
+
 		// Register active download
 		ad := &activeDownload{
-			config: cfg,
-			cancel: cancel,
+			config:   cfg,
+			cancel:   cancel,
+			finished: make(chan struct{}),
 		}
 		p.mu.Lock()
+		if p.connBudget > 0 && len(p.runningLocked()) >= p.connBudget {
+			// Every connection is taken: put the download back until one finishes
+			freed := p.connWaitLocked()
+			p.order = slices.Insert(p.order, 0, cfg.ID)
+			p.mu.Unlock()
+			cancel()
+			p.wg.Done()
+			p.ready <- struct{}{}
+			if !p.waitForConnection(freed) {
+				return
+			}
+			continue
+		}
+		p.starts++
+		ad.started = p.starts
 		delete(p.queued, cfg.ID)
+		_, autosaved := p.autosaved[cfg.ID]
+		delete(p.autosaved, cfg.ID)
 		p.downloads[cfg.ID] = ad
+		p.rebalanceLocked()
 		p.mu.Unlock()
+		p.setPhase(cfg.ID, cfg.Filename, events.PhaseActive)
+
+		// A download kept to a daily window pauses when it closes
+		var windowClosed atomic.Bool
+		var windowTimer *time.Timer
+		if end := cfg.Schedule.End(time.Now()); !end.IsZero() {
+			windowTimer = time.AfterFunc(time.Until(end), func() {
+				windowClosed.Store(true)
+				p.Pause(cfg.ID)
+			})
+		}
 
 		err := TUIDownload(ctx, &ad.config)
+		close(ad.finished)
+		p.mu.Lock()
+		p.rebalanceLocked()
+		p.connFreedLocked()
+		p.mu.Unlock()
+		if windowTimer != nil {
+			windowTimer.Stop()
+		}
 
 		// Logic:
 		// 1. If Pause() was called: State.IsPaused() is true. We keep the task in p.downloads (so it can be resumed).
@@ -267,13 +1003,25 @@ func (p *WorkerPool) worker() {
 			ad.config.State.SetPausing(false)
 		}
 
-		if isPaused {
+		if isPaused && windowClosed.Load() {
+			// Wait for the window to open again instead of for the user
+			utils.Debug("WorkerPool: Download %s paused until its window opens", cfg.ID)
+			p.mu.Lock()
+			delete(p.downloads, cfg.ID)
+			p.mu.Unlock()
+			ad.config.State.Resume()
+			ad.config.State.SyncSessionStart()
+			ad.config.IsResume = true
+			p.hold(ad.config, ad.config.Schedule.Next(time.Now()))
+		} else if isPaused {
 			utils.Debug("WorkerPool: Download %s paused cleanly", cfg.ID)
+			p.setPhase(cfg.ID, ad.config.Filename, events.PhasePaused)
 			// If paused, we keep it in downloads map for potential resume
 		} else if err != nil {
 			if cfg.State != nil {
 				cfg.State.SetError(err)
 			}
+			p.setPhase(cfg.ID, ad.config.Filename, events.PhaseError)
 			if p.progressCh != nil {
 				p.progressCh <- events.DownloadErrorMsg{
 					DownloadID: cfg.ID,
@@ -281,10 +1029,17 @@ func (p *WorkerPool) worker() {
 					Err:        err,
 				}
 			}
+			if autosaved {
+				// Don't bring back a download that failed before it saved its error
+				if err := state.UpdateStatus(cfg.ID, "error"); err != nil {
+					utils.Debug("Failed to save error of %s: %v", cfg.ID, err)
+				}
+			}
 			// Clean up errored download from tracking (don't save to .surge)
 			p.mu.Lock()
 			delete(p.downloads, cfg.ID)
 			p.mu.Unlock()
+			p.afterDownload(ad.config, err)
 
 		} else if !isPaused {
 			// Only mark as done if not paused
@@ -292,24 +1047,307 @@ func (p *WorkerPool) worker() {
 				cfg.State.Done.Store(true)
 			}
 			// Note: DownloadCompleteMsg is sent by the progress reporter when it detects Done=true
+			p.setPhase(cfg.ID, ad.config.Filename, events.PhaseDone)
 
 			// Clean up from tracking
 			p.mu.Lock()
 			delete(p.downloads, cfg.ID)
 			p.mu.Unlock()
+			p.afterDownload(ad.config, nil)
 		}
 		// If paused, we keep it in downloads map for potential resume
 		p.wg.Done()
 	}
 }
 
+// Draining reports whether Drain has been called
+func (p *WorkerPool) Draining() bool {
+	return p.draining.Load()
+}
+
+// Drain stops the pool from starting downloads and saves those still waiting
+// for a worker as queued, so the next start picks them up. It then waits for
+// running downloads to finish; any still running when ctx ends are paused.
+func (p *WorkerPool) Drain(ctx context.Context) {
+	p.draining.Store(true)
+	p.shelveScheduled()
+	for cfg, ok := p.next(); ok; cfg, ok = p.next() {
+		p.shelve(cfg)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for p.runningCount() > 0 {
+		select {
+		case <-ctx.Done():
+			utils.Debug("Drain: pausing downloads that are still running")
+			p.GracefulShutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+	p.wg.Wait()
+}
+
+// runningCount returns how many downloads a worker is busy with
+func (p *WorkerPool) runningCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	count := 0
+	for _, ad := range p.downloads {
+		select {
+		case <-ad.finished:
+		default:
+			count++
+		}
+	}
+	return count
+}
+
+// shelveScheduled saves the downloads waiting for their schedule as queued,
+// with their schedule, so the next start holds them again
+func (p *WorkerPool) shelveScheduled() {
+	p.mu.Lock()
+	var held []types.DownloadConfig
+	for _, sd := range p.scheduled {
+		sd.timer.Stop()
+		held = append(held, sd.config)
+	}
+	clear(p.scheduled)
+	p.mu.Unlock()
+
+	for _, cfg := range held {
+		p.shelve(cfg)
+	}
+}
+
+// shelve takes a download that never reached a worker out of the pool and
+// records it as queued in the database
+func (p *WorkerPool) shelve(cfg types.DownloadConfig) {
+	p.mu.Lock()
+	delete(p.queued, cfg.ID)
+	delete(p.phases, cfg.ID)
+	delete(p.autosaved, cfg.ID)
+	p.mu.Unlock()
+	saveQueued(cfg)
+}
+
+// saveQueued records a download that has not started as queued in the
+// database. A fresh download has no file yet, so its output directory
+// stands in for the destination.
+func saveQueued(cfg types.DownloadConfig) {
+	var err error
+	if cfg.IsResume && cfg.DestPath != "" {
+		err = state.UpdateStatus(cfg.ID, "queued")
+	} else {
+		err = state.AddToMasterList(types.DownloadEntry{
+			ID:       cfg.ID,
+			URL:      cfg.URL,
+			DestPath: cfg.OutputPath,
+			Filename: cfg.Filename,
+			Status:   "queued",
+			Mirrors:  cfg.Mirrors,
+			Headers:  cfg.Headers,
+			Checksum: cfg.Checksum,
+		})
+		if err == nil {
+			err = state.SaveSettings(cfg.ID, requestSettings(&cfg))
+		}
+	}
+	if err == nil && !cfg.Schedule.IsZero() {
+		err = state.SetSchedule(cfg.ID, cfg.Schedule.String())
+	}
+	if err != nil {
+		utils.Debug("Failed to save queued download %s: %v", cfg.ID, err)
+	}
+}
+
+// SavedSchedule returns the schedule a download saved by a drain or shutdown
+// was waiting for, or the zero Schedule
+func SavedSchedule(id string) types.Schedule {
+	spec, err := state.GetSchedule(id)
+	if err != nil || spec == "" {
+		return types.Schedule{}
+	}
+	schedule, err := types.ParseSchedule(spec, time.Now())
+	if err != nil {
+		utils.Debug("Ignoring schedule of %s: %v", id, err)
+	}
+	return schedule
+}
+
+// RestoreSettings gives a resumed download the request settings saved with
+// its state s. Settings cfg already has are kept.
+func RestoreSettings(cfg *types.DownloadConfig, s *types.DownloadState) {
+	if s == nil {
+		return
+	}
+	for name, values := range s.Headers {
+		if cfg.Headers == nil {
+			cfg.Headers = make(http.Header)
+		}
+		if _, ok := cfg.Headers[name]; !ok {
+			cfg.Headers[name] = values
+		}
+	}
+	if cfg.ExpectHeaders == nil {
+		cfg.ExpectHeaders = s.ExpectHeaders
+	}
+	cfg.Checksum = cmp.Or(cfg.Checksum, s.Checksum)
+	cfg.Signature = cmp.Or(cfg.Signature, s.Signature)
+	cfg.Keyring = cmp.Or(cfg.Keyring, s.Keyring)
+	cfg.Torrent = cmp.Or(cfg.Torrent, s.Torrent)
+	cfg.Priority = cmp.Or(cfg.Priority, s.Priority)
+}
+
+// requestSettings returns what is saved of cfg with its resume state
+func requestSettings(cfg *types.DownloadConfig) types.RequestSettings {
+	return types.RequestSettings{
+		Headers:       cfg.Headers,
+		ExpectHeaders: cfg.ExpectHeaders,
+		Checksum:      cfg.Checksum,
+		Signature:     cfg.Signature,
+		Keyring:       cfg.Keyring,
+		Torrent:       cfg.Torrent,
+		Priority:      cfg.Priority,
+	}
+}
+
+// runningLocked returns the downloads a worker is busy with, in the order
+// they started. Paused downloads are not running. Must hold p.mu.
+func (p *WorkerPool) runningLocked() []*activeDownload {
+	var running []*activeDownload
+	for _, ad := range p.downloads {
+		select {
+		case <-ad.finished:
+			continue
+		default:
+		}
+		running = append(running, ad)
+	}
+	slices.SortFunc(running, func(a, b *activeDownload) int { return cmp.Compare(a.started, b.started) })
+	return running
+}
+
+// rebalanceLocked shares the connection budget and the speed limit between
+// the running downloads. It runs whenever one starts or stops and whenever
+// either limit changes, and running downloads follow their new shares.
+// Must hold p.mu.
+func (p *WorkerPool) rebalanceLocked() {
+	running := p.runningLocked()
+	shareConnections(running, p.connBudget, p.connPolicy)
+
+	var totalConns int64
+	for _, ad := range running {
+		totalConns += int64(ad.conns)
+	}
+	limit := p.speedLimit.Load()
+	for _, ad := range running {
+		if ad.config.State == nil {
+			continue
+		}
+		connLimit := 0
+		if p.connBudget > 0 {
+			connLimit = ad.conns
+		}
+		ad.config.State.ConnLimit.Store(int32(connLimit))
+
+		// The speed limit goes by connections, so the shares match
+		var share int64
+		if limit > 0 && totalConns > 0 {
+			share = max(limit*int64(ad.conns)/totalConns, 1)
+		}
+		ad.config.State.Limiter.SetRate(lowerRate(ad.config.RateLimit, share))
+	}
+}
+
+// shareConnections sets conns of the running downloads, in start order, from
+// budget. Every download gets one connection, and none more than its
+// per-host limit. The rest is split evenly by fair, goes to earlier
+// downloads first by sequential, and by priority-strict to higher priorities
+// first, then earlier downloads. Without a budget each gets its limit.
+func shareConnections(running []*activeDownload, budget int, policy string) {
+	want := func(ad *activeDownload) int {
+		return ad.config.Runtime.GetMaxConnectionsPerHost()
+	}
+	if budget <= 0 {
+		for _, ad := range running {
+			ad.conns = want(ad)
+		}
+		return
+	}
+
+	// Admission keeps the running downloads within the budget; if it was
+	// lowered below them since, each keeps one until some finish
+	extra := max(budget-len(running), 0)
+	for _, ad := range running {
+		ad.conns = 1
+	}
+
+	switch policy {
+	case types.SchedulingSequential, types.SchedulingPriorityStrict:
+		order := slices.Clone(running)
+		if policy == types.SchedulingPriorityStrict {
+			slices.SortStableFunc(order, func(a, b *activeDownload) int {
+				return cmp.Compare(b.config.Priority, a.config.Priority)
+			})
+		}
+		for _, ad := range order {
+			add := min(want(ad)-ad.conns, extra)
+			ad.conns += add
+			extra -= add
+		}
+	default:
+		// Deal the rest out evenly; what a download can't use goes to the others
+		for extra > 0 {
+			var hungry []*activeDownload
+			for _, ad := range running {
+				if ad.conns < want(ad) {
+					hungry = append(hungry, ad)
+				}
+			}
+			if len(hungry) == 0 {
+				break
+			}
+			each := max(extra/len(hungry), 1)
+			for _, ad := range hungry {
+				add := min(each, want(ad)-ad.conns, extra)
+				ad.conns += add
+				extra -= add
+			}
+		}
+	}
+}
+
+// lowerRate returns the lower of two speed limits, where 0 is no limit
+func lowerRate(a, b int64) int64 {
+	if a <= 0 || b <= 0 {
+		return max(a, b, 0)
+	}
+	return min(a, b)
+}
+
 // GetStatus returns the status of an active download
 func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 	p.mu.RLock()
 	ad, exists := p.downloads[id]
 	qCfg, qExists := p.queued[id]
+	sd, sExists := p.scheduled[id]
 	p.mu.RUnlock()
 
+	if sExists {
+		status := &types.DownloadStatus{
+			ID:       id,
+			URL:      sd.config.URL,
+			Filename: sd.config.Filename,
+			Status:   "scheduled",
+			StartAt:  sd.startAt.Unix(),
+		}
+		if s := sd.config.State; s != nil {
+			status.TotalSize, status.Downloaded = s.TotalSize, s.Downloaded.Load()
+		}
+		return status
+	}
 	if !exists && !qExists {
 		return nil
 	}
@@ -322,6 +1360,8 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 			Status:     "queued",
 			Downloaded: 0,
 			TotalSize:  0, // Metadata not yet fetched
+			Priority:   qCfg.Priority.String(),
+			Position:   p.QueuePosition(id) + 1,
 		}
 	}
 
@@ -351,6 +1391,10 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 		status.Status = "error"
 		status.Error = err.Error()
 	}
+	if status.Status == "downloading" {
+		engine := state.EngineStats()
+		status.Engine = &engine
+	}
 
 	// Calculate progress
 	if status.TotalSize > 0 {
@@ -370,7 +1414,7 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 
 // GracefulShutdown pauses all downloads and waits for them to save state
 func (p *WorkerPool) GracefulShutdown() {
-	// ... existing implementation
+	p.shelveScheduled()
 	p.PauseAll()
 
 	// Wait for any downloads in "Pausing" state to finish transitioning
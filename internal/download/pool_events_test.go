@@ -0,0 +1,326 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+// collectPhases reads state-change messages until want transitions are seen or the timeout hits
+func collectPhases(t *testing.T, ch <-chan any, id string, want int) []events.DownloadStateChangedMsg {
+	t.Helper()
+	var got []events.DownloadStateChangedMsg
+	timeout := time.After(10 * time.Second)
+	for len(got) < want {
+		select {
+		case msg := <-ch:
+			if sc, ok := msg.(events.DownloadStateChangedMsg); ok && sc.DownloadID == id {
+				got = append(got, sc)
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for phase changes, got %v", got)
+		}
+	}
+	return got
+}
+
+func TestWorkerPool_PhaseTransitions_Complete(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-pool-phase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	server := testutil.NewMockServer(testutil.WithFileSize(64*types.KB), testutil.WithRangeSupport(true))
+	defer server.Close()
+
+	ch := make(chan any, 100)
+	pool := NewWorkerPool(ch, 1)
+
+	id := "phase-complete"
+	pool.Add(types.DownloadConfig{
+		ID:         id,
+		URL:        server.URL(),
+		OutputPath: tmpDir,
+		Filename:   "phase.bin",
+		ProgressCh: ch,
+		State:      types.NewProgressState(id, 0),
+		Runtime:    &types.RuntimeConfig{},
+	})
+
+	got := collectPhases(t, ch, id, 3)
+	want := []struct{ from, to events.DownloadPhase }{
+		{"", events.PhaseQueued},
+		{events.PhaseQueued, events.PhaseActive},
+		{events.PhaseActive, events.PhaseDone},
+	}
+	for i, w := range want {
+		if got[i].From != w.from || got[i].To != w.to {
+			t.Errorf("transition %d = %s→%s, want %s→%s", i, got[i].From, got[i].To, w.from, w.to)
+		}
+	}
+
+	if phase := pool.Phase(id); phase != "" {
+		t.Errorf("finished download should no longer be tracked, got phase %q", phase)
+	}
+}
+
+func TestWorkerPool_SetPhase_IgnoresUntracked(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 1)
+
+	// A cancelled download is no longer tracked; its worker exiting must not report Done
+	pool.setPhase("gone", "gone.bin", events.PhaseDone)
+	pool.setPhase("gone", "gone.bin", events.PhaseActive)
+
+	select {
+	case msg := <-ch:
+		t.Errorf("unexpected message for untracked download: %#v", msg)
+	default:
+	}
+
+	pool.setPhase("new", "new.bin", events.PhaseQueued)
+	pool.setPhase("new", "new.bin", events.PhaseQueued) // No-op: unchanged
+	if got := collectPhases(t, ch, "new", 1); got[0].To != events.PhaseQueued {
+		t.Errorf("transition to %q, want queued", got[0].To)
+	}
+	select {
+	case msg := <-ch:
+		t.Errorf("expected exactly one transition, also got %#v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if pool.Phase("new") != events.PhaseQueued {
+		t.Errorf("Phase = %q, want queued", pool.Phase("new"))
+	}
+}
+
+func TestWorkerPool_SetPhase_DoesNotBlock(t *testing.T) {
+	// Nobody reads ch until every phase is set, as when the TUI adds a batch
+	// from the goroutine that drains it
+	ch := make(chan any, 2)
+	pool := NewWorkerPool(ch, 1)
+
+	done := make(chan struct{})
+	go func() {
+		for i := range 50 {
+			pool.setPhase(fmt.Sprint("batch-", i), "batch.bin", events.PhaseQueued)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("setPhase blocked on a full progress channel")
+	}
+
+	// The changes still all arrive, in order
+	for i := range 50 {
+		msg := (<-ch).(events.DownloadStateChangedMsg)
+		if want := fmt.Sprint("batch-", i); msg.DownloadID != want {
+			t.Fatalf("message %d is for %s, want %s", i, msg.DownloadID, want)
+		}
+	}
+}
+
+func TestWorkerPool_Drain(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-pool-drain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	server := testutil.NewMockServer(
+		testutil.WithFileSize(4*types.MB),
+		testutil.WithRangeSupport(true),
+		testutil.WithByteLatency(time.Microsecond),
+	)
+	defer server.Close()
+
+	ch := make(chan any, 1000)
+	pool := NewWorkerPool(ch, 1)
+	go func() {
+		for range ch {
+		}
+	}()
+
+	add := func(id string) {
+		pool.Add(types.DownloadConfig{
+			ID:         id,
+			URL:        server.URL(),
+			OutputPath: tmpDir,
+			Filename:   id + ".bin",
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{},
+		})
+	}
+	add("drain-running")
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.QueueLength() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	add("drain-waiting")
+
+	// Give the running download a moment, then pause it
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	pool.Drain(ctx)
+
+	if !pool.Draining() || pool.QueueLength() != 0 {
+		t.Errorf("after Drain: Draining() = %v, QueueLength() = %d", pool.Draining(), pool.QueueLength())
+	}
+	waiting, err := state.GetDownload("drain-waiting")
+	if err != nil || waiting == nil {
+		t.Fatalf("queued download was not saved: %v", err)
+	}
+	if waiting.Status != "queued" || waiting.DestPath != tmpDir {
+		t.Errorf("saved queued download = %+v, want status queued in %s", waiting, tmpDir)
+	}
+	running, err := state.GetDownload("drain-running")
+	if err != nil || running == nil || running.Status != "paused" {
+		t.Errorf("running download should have been paused, got %+v (%v)", running, err)
+	}
+}
+
+func TestWorkerPool_SetMaxDownloads(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-pool-max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Downloads hang until cancelled, keeping their worker busy
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	pool := NewWorkerPool(nil, 1)
+	defer func() {
+		for _, cfg := range pool.GetAll() {
+			pool.Cancel(cfg.ID)
+		}
+	}()
+	add := func(id string) {
+		pool.Add(types.DownloadConfig{
+			ID:         id,
+			URL:        server.URL + "/" + id,
+			OutputPath: tmpDir,
+			Filename:   id,
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{},
+		})
+	}
+	waitActive := func(ids ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for _, id := range ids {
+			for pool.Phase(id) != events.PhaseActive {
+				if time.Now().After(deadline) {
+					t.Fatalf("%s did not start (phase %q)", id, pool.Phase(id))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+
+	add("a")
+	add("b")
+	add("c")
+	waitActive("a")
+	pool.SetMaxDownloads(3)
+	waitActive("b", "c")
+
+	// Lowered, the pool lets running downloads finish but starts no more
+	pool.SetMaxDownloads(1)
+	if got := pool.MaxDownloads(); got != 1 {
+		t.Errorf("MaxDownloads() = %d, want 1", got)
+	}
+	add("d")
+	pool.Cancel("a")
+	pool.Cancel("b")
+	time.Sleep(200 * time.Millisecond)
+	if pool.Phase("d") != events.PhaseQueued {
+		t.Fatalf("d started with c still running and a limit of 1 (phase %q)", pool.Phase("d"))
+	}
+	pool.Cancel("c")
+	waitActive("d")
+}
+
+func TestWorkerPool_Autosave(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-pool-autosave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Downloads hang until cancelled, keeping their worker busy
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	pool := NewWorkerPool(nil, 1)
+	defer func() {
+		for _, cfg := range pool.GetAll() {
+			pool.Cancel(cfg.ID)
+		}
+	}()
+	add := func(id string) {
+		pool.Add(types.DownloadConfig{
+			ID:         id,
+			URL:        server.URL + "/" + id,
+			OutputPath: tmpDir,
+			Filename:   id,
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{},
+		})
+	}
+	add("running")
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Phase("running") != events.PhaseActive {
+		if time.Now().After(deadline) {
+			t.Fatal("first download did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	add("waiting")
+
+	pool.autosave()
+	saved, err := state.GetDownload("waiting")
+	if err != nil || saved == nil {
+		t.Fatalf("queued download was not saved: %v", err)
+	}
+	if saved.Status != "queued" || saved.DestPath != tmpDir {
+		t.Errorf("saved queued download = %+v, want status queued in %s", saved, tmpDir)
+	}
+	if pool.QueueLength() != 1 || pool.Phase("waiting") != events.PhaseQueued {
+		t.Errorf("autosave took the download out of the queue (length %d, phase %q)", pool.QueueLength(), pool.Phase("waiting"))
+	}
+
+	// Cancelling forgets the saved entry too
+	pool.Cancel("waiting")
+	if entry, _ := state.GetDownload("waiting"); entry != nil {
+		t.Errorf("cancelled download is still saved: %+v", entry)
+	}
+}
@@ -55,6 +55,9 @@ func TestWorkerPool_GetStatus_Active(t *testing.T) {
 	if status.Progress != 50.0 {
 		t.Errorf("Expected Progress 50.0, got %.1f", status.Progress)
 	}
+	if status.Engine == nil {
+		t.Error("Expected engine stats for a running download")
+	}
 }
 
 func TestWorkerPool_GetStatus_Paused(t *testing.T) {
@@ -79,6 +82,9 @@ func TestWorkerPool_GetStatus_Paused(t *testing.T) {
 	if status.Status != "paused" {
 		t.Errorf("Expected status 'paused', got '%s'", status.Status)
 	}
+	if status.Engine != nil {
+		t.Error("Expected no engine stats for a paused download")
+	}
 }
 
 func TestWorkerPool_GetStatus_Completed(t *testing.T) {
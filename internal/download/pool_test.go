@@ -2,11 +2,16 @@ package download
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
@@ -18,8 +23,8 @@ func TestNewWorkerPool(t *testing.T) {
 		t.Fatal("Expected non-nil WorkerPool")
 	}
 
-	if pool.taskChan == nil {
-		t.Error("Expected taskChan to be initialized")
+	if pool.ready == nil {
+		t.Error("Expected ready to be initialized")
 	}
 
 	if pool.progressCh != ch {
@@ -499,7 +504,7 @@ func TestWorkerPool_Resume_SendsResumedMessage(t *testing.T) {
 
 	pool.Resume("test-id")
 
-	// We can't reliably read from pool.taskChan because worker goroutines may consume the config before us. Just verify the resumed message was sent.
+	// We can't reliably read from the pool's queue because worker goroutines may consume the config before us. Just verify the resumed message was sent.
 	// Check for resumed message
 	select {
 	case msg := <-ch:
@@ -537,7 +542,7 @@ func TestWorkerPool_Resume_RequeuesDownload(t *testing.T) {
 
 	pool.Resume("test-id")
 
-	// Note: We can't reliably read from pool.taskChan because worker goroutines
+	// Note: We can't reliably read from the pool's queue because worker goroutines
 	// may consume the config before us. Instead, verify Resume cleared the paused
 	// flag and sent the resumed message.
 
@@ -737,10 +742,443 @@ func TestWorkerPool_PauseResume_Idempotency(t *testing.T) {
 	// 4. Second Resume (Idempotent)
 	pool.Resume("idempotent-test")
 
-	select {
-	case <-ch:
-		t.Error("Did not expect second resume message")
-	default:
-		// OK
+	// The first resume also reports a phase change; only resume messages matter here
+	for len(ch) > 0 {
+		if _, ok := (<-ch).(events.DownloadResumedMsg); ok {
+			t.Error("Did not expect second resume message")
+		}
+	}
+}
+
+func TestShareConnections(t *testing.T) {
+	download := func(perHost int, priority types.Priority) *activeDownload {
+		return &activeDownload{config: types.DownloadConfig{
+			Priority: priority,
+			Runtime:  &types.RuntimeConfig{MaxConnectionsPerHost: perHost},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		budget   int
+		policy   string
+		perHost  []int
+		priority []types.Priority
+		want     []int
+	}{
+		{"no budget", 0, types.SchedulingFair, []int{16, 8}, nil, []int{16, 8}},
+		{"fair alone", 40, types.SchedulingFair, []int{32}, nil, []int{32}},
+		{"fair split", 40, types.SchedulingFair, []int{32, 32}, nil, []int{20, 20}},
+		{"fair uneven", 40, types.SchedulingFair, []int{32, 32, 32}, nil, []int{14, 13, 13}},
+		{"fair passes on what one can't use", 40, types.SchedulingFair, []int{4, 32}, nil, []int{4, 32}},
+		{"unknown is fair", 40, "bogus", []int{32, 32}, nil, []int{20, 20}},
+		{"sequential", 40, types.SchedulingSequential, []int{32, 32, 32}, nil, []int{32, 7, 1}},
+		{"priority-strict", 40, types.SchedulingPriorityStrict, []int{32, 32, 32},
+			[]types.Priority{types.PriorityNormal, types.PriorityHigh, types.PriorityNormal}, []int{7, 32, 1}},
+		{"over budget keeps one each", 2, types.SchedulingFair, []int{8, 8, 8}, nil, []int{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running []*activeDownload
+			for i, perHost := range tt.perHost {
+				var priority types.Priority
+				if tt.priority != nil {
+					priority = tt.priority[i]
+				}
+				running = append(running, download(perHost, priority))
+			}
+			shareConnections(running, tt.budget, tt.policy)
+			var got []int
+			for _, ad := range running {
+				got = append(got, ad.conns)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("conns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkerPool_ConnectionBudget_Rebalances(t *testing.T) {
+	download := func(started uint64) *activeDownload {
+		return &activeDownload{
+			finished: make(chan struct{}),
+			started:  started,
+			config: types.DownloadConfig{
+				Runtime: &types.RuntimeConfig{MaxConnectionsPerHost: 32},
+				State:   types.NewProgressState("x", 0),
+			},
+		}
+	}
+	a, b := download(1), download(2)
+	pool := NewWorkerPool(nil, 1)
+	pool.downloads = map[string]*activeDownload{"a": a, "b": b}
+
+	pool.SetConnectionBudget(40, types.SchedulingSequential)
+	if a.config.State.ConnLimit.Load() != 32 || b.config.State.ConnLimit.Load() != 8 {
+		t.Fatalf("limits = %d, %d, want 32, 8", a.config.State.ConnLimit.Load(), b.config.State.ConnLimit.Load())
+	}
+
+	// The first finishing hands its connections to the second
+	close(a.finished)
+	pool.mu.Lock()
+	pool.rebalanceLocked()
+	pool.mu.Unlock()
+	if got := b.config.State.ConnLimit.Load(); got != 32 {
+		t.Errorf("limit after the first finished = %d, want 32", got)
+	}
+
+	pool.SetConnectionBudget(0, types.SchedulingFair)
+	if got := b.config.State.ConnLimit.Load(); got != 0 {
+		t.Errorf("limit without a budget = %d, want 0", got)
+	}
+}
+
+func TestWorkerPool_ConnectionBudget_QueuesWhenFull(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	ch := make(chan any, 100)
+	pool := NewWorkerPool(ch, 2)
+	pool.SetConnectionBudget(1, types.SchedulingFair)
+	for _, id := range []string{"a", "b"} {
+		pool.Add(types.DownloadConfig{
+			ID:         id,
+			URL:        server.URL + "/" + id,
+			OutputPath: tmpDir,
+			Filename:   id,
+			State:      types.NewProgressState(id, 4),
+			Runtime:    &types.RuntimeConfig{},
+		})
+	}
+	waiting := func() int {
+		pool.mu.RLock()
+		defer pool.mu.RUnlock()
+		return len(pool.queued)
+	}
+
+	// Two workers, but the budget only lets one download run
+	time.Sleep(300 * time.Millisecond)
+	if running := pool.runningCount(); running != 1 || waiting() != 1 {
+		t.Fatalf("%d running and %d queued, want one of each", running, waiting())
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for (waiting() > 0 || pool.runningCount() > 0) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if waiting() > 0 {
+		t.Error("queued download did not start once the first finished")
+	}
+	pool.GracefulShutdown()
+}
+
+func TestWorkerPool_SpeedLimit(t *testing.T) {
+	download := func(rateLimit int64) *activeDownload {
+		return &activeDownload{
+			finished: make(chan struct{}),
+			config:   types.DownloadConfig{RateLimit: rateLimit, State: types.NewProgressState("x", 0)},
+		}
+	}
+	a, b, capped := download(0), download(0), download(100)
+	paused := download(0)
+	close(paused.finished)
+
+	pool := NewWorkerPool(nil, 1)
+	pool.downloads = map[string]*activeDownload{"a": a, "b": b, "capped": capped, "paused": paused}
+
+	pool.SetSpeedLimit(3000)
+	for name, tt := range map[string]struct {
+		ad   *activeDownload
+		want int64
+	}{
+		"even share": {a, 1000},
+		"own limit":  {capped, 100},
+		"paused":     {paused, 0},
+	} {
+		if got := tt.ad.config.State.Limiter.Rate(); got != tt.want {
+			t.Errorf("%s: rate = %d, want %d", name, got, tt.want)
+		}
+	}
+
+	// A download stopping gives its share to the rest
+	close(b.finished)
+	pool.mu.Lock()
+	pool.rebalanceLocked()
+	pool.mu.Unlock()
+	if got := a.config.State.Limiter.Rate(); got != 1500 {
+		t.Errorf("rate after a download stopped = %d, want 1500", got)
+	}
+
+	pool.SetSpeedLimit(0)
+	if a.config.State.Limiter.Rate() != 0 || capped.config.State.Limiter.Rate() != 100 {
+		t.Errorf("removing the limit left rates %d and %d, want 0 and 100",
+			a.config.State.Limiter.Rate(), capped.config.State.Limiter.Rate())
+	}
+}
+
+func TestWorkerPool_QueueLimit(t *testing.T) {
+	// No workers, so added downloads stay queued
+	pool := &WorkerPool{
+		ready:     make(chan struct{}, 4),
+		downloads: make(map[string]*activeDownload),
+		queued:    make(map[string]types.DownloadConfig),
+		phases:    make(map[string]events.DownloadPhase),
+	}
+
+	if got := pool.QueueLimit(); got != 4 {
+		t.Errorf("QueueLimit() = %d, want the task buffer size 4", got)
+	}
+	pool.SetMaxQueued(2)
+	if got := pool.QueueLimit(); got != 2 {
+		t.Errorf("QueueLimit() = %d after SetMaxQueued(2)", got)
+	}
+	pool.SetMaxQueued(10)
+	if got := pool.QueueLimit(); got != 4 {
+		t.Errorf("QueueLimit() = %d, want it capped at the task buffer size", got)
+	}
+
+	pool.Add(types.DownloadConfig{ID: "q1", URL: "http://example.com/1"})
+	pool.Add(types.DownloadConfig{ID: "q2", URL: "http://example.com/2"})
+	if got := pool.QueueLength(); got != 2 {
+		t.Errorf("QueueLength() = %d, want 2", got)
+	}
+}
+
+// waitFor reads messages until one of type T for id arrives or the timeout hits
+func waitFor[T any](t *testing.T, ch <-chan any, match func(T) bool) T {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-ch:
+			if m, ok := msg.(T); ok && match(m) {
+				return m
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("timed out waiting for %T", zero)
+			return zero
+		}
+	}
+}
+
+func TestWorkerPool_Add_HoldsScheduled(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 3)
+
+	startAt := time.Now().Add(time.Hour)
+	pool.Add(types.DownloadConfig{
+		ID:       "later",
+		URL:      "http://example.com/file.zip",
+		Filename: "file.zip",
+		Schedule: types.Schedule{At: startAt},
+	})
+
+	msg := waitFor(t, ch, func(m events.DownloadScheduledMsg) bool { return m.DownloadID == "later" })
+	if !msg.StartAt.Equal(startAt) {
+		t.Errorf("StartAt = %v, want %v", msg.StartAt, startAt)
+	}
+	if status := pool.GetStatus("later"); status == nil || status.Status != "scheduled" || status.StartAt != startAt.Unix() {
+		t.Errorf("GetStatus = %+v, want scheduled at %d", status, startAt.Unix())
+	}
+	if pool.ActiveCount() != 1 || !pool.HasDownload("http://example.com/file.zip") {
+		t.Error("Expected the scheduled download to count as in the pool")
+	}
+	if pool.QueueLength() != 0 {
+		t.Errorf("QueueLength = %d, want 0", pool.QueueLength())
+	}
+
+	if !pool.Cancel("later") {
+		t.Fatal("Cancel of a scheduled download returned false")
+	}
+	if pool.GetStatus("later") != nil {
+		t.Error("Expected the cancelled download to be gone")
+	}
+}
+
+func TestWorkerPool_Scheduled_StartsOnTime(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 3)
+
+	pool.Add(types.DownloadConfig{
+		ID:       "soon",
+		URL:      "http://example.com/file.zip",
+		Schedule: types.Schedule{At: time.Now().Add(50 * time.Millisecond)},
+	})
+	waitFor(t, ch, func(m events.DownloadScheduledMsg) bool { return m.DownloadID == "soon" })
+	waitFor(t, ch, func(m events.DownloadStateChangedMsg) bool {
+		return m.DownloadID == "soon" && m.From == events.PhaseScheduled && m.To == events.PhaseQueued
+	})
+}
+
+func TestWorkerPool_Resume_StartsScheduledNow(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 3)
+
+	pool.Add(types.DownloadConfig{
+		ID:       "later",
+		URL:      "http://example.com/file.zip",
+		Schedule: types.Schedule{At: time.Now().Add(time.Hour)},
+	})
+	waitFor(t, ch, func(m events.DownloadScheduledMsg) bool { return m.DownloadID == "later" })
+
+	pool.Resume("later")
+	waitFor(t, ch, func(m events.DownloadStateChangedMsg) bool {
+		return m.DownloadID == "later" && m.To == events.PhaseQueued
+	})
+
+	pool.mu.RLock()
+	_, held := pool.scheduled["later"]
+	pool.mu.RUnlock()
+	if held {
+		t.Error("Expected Resume to take the download off its schedule")
+	}
+}
+
+// queueOnlyPool returns a pool without workers, so added downloads stay queued
+func queueOnlyPool() *WorkerPool {
+	return &WorkerPool{
+		ready:     make(chan struct{}, QueueCapacity),
+		downloads: make(map[string]*activeDownload),
+		queued:    make(map[string]types.DownloadConfig),
+		phases:    make(map[string]events.DownloadPhase),
+	}
+}
+
+func TestWorkerPool_Add_OrdersByPriority(t *testing.T) {
+	pool := queueOnlyPool()
+	for _, cfg := range []types.DownloadConfig{
+		{ID: "n1"},
+		{ID: "l1", Priority: types.PriorityLow},
+		{ID: "h1", Priority: types.PriorityHigh},
+		{ID: "n2"},
+		{ID: "h2", Priority: types.PriorityHigh},
+	} {
+		pool.Add(cfg)
+	}
+
+	want := []string{"h1", "h2", "n1", "n2", "l1"}
+	if got := pool.QueueOrder(); !slices.Equal(got, want) {
+		t.Errorf("QueueOrder() = %v, want %v", got, want)
+	}
+	if cfg, ok := pool.next(); !ok || cfg.ID != "h1" {
+		t.Errorf("next() = %q, %v, want h1", cfg.ID, ok)
+	}
+	if status := pool.GetStatus("l1"); status == nil || status.Position != 4 || status.Priority != "low" {
+		t.Errorf("GetStatus(l1) = %+v, want low at position 4", status)
+	}
+}
+
+func TestWorkerPool_Move(t *testing.T) {
+	pool := queueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "h", Priority: types.PriorityHigh})
+	pool.Add(types.DownloadConfig{ID: "a"})
+	pool.Add(types.DownloadConfig{ID: "b"})
+	pool.Add(types.DownloadConfig{ID: "c"})
+
+	steps := []struct {
+		move func() bool
+		want []string
+	}{
+		{func() bool { return pool.Move("c", -1) }, []string{"h", "a", "c", "b"}},
+		{func() bool { return pool.Move("a", 10) }, []string{"h", "c", "b", "a"}},
+		{func() bool { return pool.MoveTo("b", 0) }, []string{"b", "h", "c", "a"}},
+		{func() bool { return pool.SetPriority("a", types.PriorityHigh) }, []string{"b", "h", "a", "c"}},
+	}
+	for i, step := range steps {
+		if !step.move() {
+			t.Fatalf("step %d: move returned false", i)
+		}
+		if got := pool.QueueOrder(); !slices.Equal(got, step.want) {
+			t.Fatalf("step %d: QueueOrder() = %v, want %v", i, got, step.want)
+		}
+	}
+
+	// Moved ahead of a high priority download, b keeps its place when more arrive
+	pool.Add(types.DownloadConfig{ID: "h2", Priority: types.PriorityHigh})
+	if got, want := pool.QueueOrder(), []string{"b", "h", "a", "h2", "c"}; !slices.Equal(got, want) {
+		t.Errorf("QueueOrder() = %v, want %v", got, want)
+	}
+	if pool.Move("missing", 1) || pool.SetPriority("missing", types.PriorityLow) {
+		t.Error("Expected moving a download that is not queued to fail")
+	}
+}
+
+func TestWorkerPool_Cancel_Queued(t *testing.T) {
+	pool := queueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "a"})
+	pool.Add(types.DownloadConfig{ID: "b"})
+
+	if !pool.Cancel("a") {
+		t.Fatal("Cancel of a queued download returned false")
+	}
+	if got := pool.QueueOrder(); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("QueueOrder() = %v, want [b]", got)
+	}
+	if pool.QueueLength() != 1 {
+		t.Errorf("QueueLength() = %d, want 1", pool.QueueLength())
+	}
+}
+
+func TestWorkerPool_HoldAll(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+
+	ch := make(chan any, 50)
+	pool := NewWorkerPool(ch, 2)
+
+	running := types.NewProgressState("running", 1000)
+	pool.mu.Lock()
+	pool.downloads["running"] = &activeDownload{
+		config: types.DownloadConfig{ID: "running", URL: "http://127.0.0.1:1/a", State: running},
+	}
+	pool.mu.Unlock()
+
+	pool.HoldAll()
+	if !pool.Held() || !running.IsPaused() {
+		t.Fatal("HoldAll should pause running downloads and hold the pool")
+	}
+
+	pool.Add(types.DownloadConfig{ID: "new", URL: "http://127.0.0.1:1/b", State: types.NewProgressState("new", 0)})
+	waitFor(t, ch, func(m events.DownloadStateChangedMsg) bool {
+		return m.DownloadID == "new" && m.To == events.PhaseQueued
+	})
+	time.Sleep(100 * time.Millisecond)
+	if phase := pool.Phase("new"); phase != events.PhaseQueued {
+		t.Fatalf("download added while held is %s, want it to stay queued", phase)
+	}
+
+	running.SetPausing(false) // As the worker would once it stopped
+	pool.ResumeAll()
+	if pool.Held() {
+		t.Error("ResumeAll should end the hold")
+	}
+	if running.IsPaused() {
+		t.Error("ResumeAll should resume paused downloads")
+	}
+	waitFor(t, ch, func(m events.DownloadStateChangedMsg) bool {
+		return m.DownloadID == "new" && m.To == events.PhaseActive
+	})
+}
+
+func TestWorkerPool_Resume_EndsHold(t *testing.T) {
+	pool := queueOnlyPool()
+	pool.HoldAll()
+	pool.Resume("missing")
+	if pool.Held() {
+		t.Error("resuming a download should end a pause-all")
 	}
 }
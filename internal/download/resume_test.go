@@ -1,10 +1,14 @@
 package download_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -116,7 +120,7 @@ func TestIntegration_PauseResume(t *testing.T) {
 	}
 
 	// Verify .surge file exists
-	incompletePath := destPath + types.IncompleteSuffix
+	incompletePath := types.WorkingPath(destPath, cfg.ID, false)
 	info, err := os.Stat(incompletePath)
 	if err != nil {
 		t.Fatalf("Incomplete file not found: %v", err)
@@ -170,3 +174,58 @@ func TestIntegration_PauseResume(t *testing.T) {
 		t.Error("State should be deleted after completion")
 	}
 }
+
+func TestTUIDownload_RestartsWhenSourceChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	fileSize := 256 * 1024
+	oldData := bytes.Repeat([]byte("a"), fileSize)
+	newData := bytes.Repeat([]byte("b"), fileSize)
+	var conditional atomic.Int32
+	var replaced atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The file is replaced once the download has fetched its first range
+		if r.Header.Get("If-Range") != "" && conditional.Add(1) > 1 {
+			replaced.Store(true)
+		}
+		data, etag := oldData, `"v1"`
+		if replaced.Load() {
+			data, etag = newData, `"v2"`
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	progressCh := make(chan any, 100)
+	progState := types.NewProgressState(uuid.New().String(), int64(fileSize))
+	cfg := types.DownloadConfig{
+		URL:        server.URL + "/file.bin",
+		OutputPath: tmpDir,
+		Filename:   "file.bin",
+		ID:         progState.ID,
+		ProgressCh: progressCh,
+		State:      progState,
+		Runtime: &types.RuntimeConfig{
+			MaxConnectionsPerHost: 1,
+			MinChunkSize:          64 * 1024,
+			MaxChunkSize:          64 * 1024,
+			TargetChunkSize:       64 * 1024,
+		},
+	}
+	if err := download.TUIDownload(context.Background(), &cfg); err != nil {
+		t.Fatalf("TUIDownload() = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Error("the completed file mixes the old and new versions")
+	}
+}
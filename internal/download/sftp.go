@@ -0,0 +1,191 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/sftp"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// sftpSource is an sftp:// download with its session open
+type sftpSource struct {
+	url     string
+	loc     sftp.Location
+	client  *sftp.Client
+	size    int64
+	modTime string // Resume validator, in the same form as Last-Modified
+}
+
+// openSFTP connects to the server of an sftp:// URL and stats the file,
+// standing in for the HTTP probe
+func openSFTP(ctx context.Context, cfg *types.DownloadConfig) (*sftpSource, *engine.ProbeResult, error) {
+	loc, err := sftp.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The connection goes through the proxy and network policy HTTP
+	// downloads do
+	opts := sftp.Options{Timeout: types.ProbeTimeout, Dial: cfg.Runtime.DialTunnel}
+	if cfg.Runtime != nil {
+		opts.IdentityFile = cfg.Runtime.SSHIdentityFile
+		opts.KnownHosts = cfg.Runtime.SSHKnownHosts
+		opts.UserKeys = cfg.Runtime.SSHUserKeys
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+	client, err := sftp.Dial(dialCtx, loc, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	attrs, err := client.Stat(dialCtx, loc.Path)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("%s: %w", loc.Path, err)
+	}
+
+	src := &sftpSource{url: cfg.URL, loc: loc, client: client, size: max(attrs.Size, 0)}
+	if !attrs.ModTime.IsZero() {
+		src.modTime = attrs.ModTime.UTC().Format(http.TimeFormat)
+	}
+	probe := &engine.ProbeResult{
+		FileSize:      src.size,
+		SupportsRange: true,
+		Filename:      path.Base(loc.Path),
+		LastModified:  src.modTime,
+		FinalURL:      cfg.URL,
+	}
+	if cfg.Filename != "" {
+		probe.Filename = cfg.Filename
+	}
+	return src, probe, nil
+}
+
+// Close ends the SFTP session
+func (s *sftpSource) Close() {
+	s.client.Close()
+}
+
+// download streams the file into destPath over one SFTP session. Like the
+// HTTP engine it writes to a working file and saves state on pause, so a
+// resume continues from where the working file ends.
+func (s *sftpSource) download(ctx context.Context, cfg *types.DownloadConfig, destPath string) error {
+	workingPath := types.FindWorkingPath(destPath, cfg.ID, cfg.Runtime != nil && cfg.Runtime.PartFilesInSubdir)
+	if err := os.MkdirAll(utils.LongPath(filepath.Dir(workingPath)), 0755); err != nil {
+		return fmt.Errorf("failed to create part directory: %w", err)
+	}
+	outFile, err := os.OpenFile(utils.LongPath(workingPath), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer outFile.Close()
+
+	// Continue after the saved offset unless the remote file changed since
+	var offset int64
+	saved, err := state.LoadState(s.url, destPath)
+	if err == nil && saved != nil && len(saved.Tasks) == 1 && saved.TotalSize == s.size && saved.LastModified == s.modTime {
+		if info, statErr := outFile.Stat(); statErr == nil && info.Size() >= saved.Tasks[0].Offset {
+			offset = saved.Tasks[0].Offset
+		}
+	}
+	if err := outFile.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+	if _, err := outFile.Seek(offset, 0); err != nil {
+		return err
+	}
+	utils.Debug("SFTP download %s:%s from offset %d of %d", s.loc.Host, s.loc.Path, offset, s.size)
+
+	// Pause cancels this context
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	if cfg.State != nil {
+		cfg.State.CancelFunc = cancel
+		cfg.State.Downloaded.Store(offset)
+		if offset > 0 && saved != nil {
+			cfg.State.SetSavedElapsed(time.Duration(saved.Elapsed))
+		}
+		cfg.State.SyncSessionStart()
+		cfg.State.ActiveWorkers.Store(1)
+		defer cfg.State.ActiveWorkers.Store(0)
+	}
+
+	file, err := s.client.Open(ctx, s.loc.Path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.loc.Path, err)
+	}
+	defer file.Close()
+
+	n, copyErr := file.WriteTo(ctx, &progressWriter{ctx: ctx, w: outFile, state: cfg.State}, offset)
+	done := offset + n
+
+	if cfg.State != nil && cfg.State.IsPaused() {
+		elapsed := time.Since(start) + cfg.State.SavedElapsed
+		if err := state.SaveState(s.url, destPath, &types.DownloadState{
+			URL:             s.url,
+			ID:              cfg.ID,
+			DestPath:        destPath,
+			TotalSize:       s.size,
+			Downloaded:      done,
+			Tasks:           []types.Task{{Offset: done, Length: s.size - done}},
+			Filename:        filepath.Base(destPath),
+			Elapsed:         elapsed.Nanoseconds(),
+			LastModified:    s.modTime,
+			RequestSettings: requestSettings(cfg),
+		}); err != nil {
+			utils.Debug("Failed to save pause state: %v", err)
+		}
+		return types.ErrPaused
+	}
+	if errors.Is(copyErr, context.Canceled) {
+		return nil // Removed; the caller cleans up the working file
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+	if s.size > 0 && done != s.size {
+		return fmt.Errorf("%s changed during download: got %d of %d bytes", s.loc.Path, done, s.size)
+	}
+
+	if err := outFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	outFile.Close()
+	if err := os.Rename(utils.LongPath(workingPath), utils.LongPath(destPath)); err != nil {
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+	if dir := filepath.Dir(workingPath); filepath.Base(dir) == types.PartDirName {
+		_ = os.Remove(utils.LongPath(dir))
+	}
+	_ = state.DeleteState(cfg.ID, s.url, destPath)
+	return nil
+}
+
+// progressWriter counts written bytes as download progress, holding the
+// download to its speed limit
+type progressWriter struct {
+	ctx   context.Context
+	w     *os.File
+	state *types.ProgressState
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	if p.state != nil {
+		p.state.Downloaded.Add(int64(n))
+		if err == nil {
+			err = p.state.Limiter.WaitN(p.ctx, n)
+		}
+	}
+	return n, err
+}
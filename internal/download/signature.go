@@ -0,0 +1,59 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/pgp"
+)
+
+// VerifySignature checks the file at path against the detached OpenPGP
+// signature at signature, a URL or a local file, made with a key of the
+// keyring file at keyring. It returns the key that made the signature.
+func VerifySignature(ctx context.Context, path, signature, keyring string, runtime *types.RuntimeConfig) (*pgp.Key, error) {
+	keys, err := pgp.LoadKeyring(keyring)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readSignature(ctx, signature, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return keys.Verify(f, sig)
+}
+
+// readSignature returns the signature at a URL or path
+func readSignature(ctx context.Context, signature string, runtime *types.RuntimeConfig) ([]byte, error) {
+	if IsSignatureURL(signature) {
+		return engine.FetchSignature(ctx, signature, runtime)
+	}
+	f, err := os.Open(signature)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, pgp.MaxKeyringSize))
+}
+
+// IsSignatureURL reports whether a signature is fetched rather than read
+// from disk
+func IsSignatureURL(signature string) bool {
+	return strings.HasPrefix(signature, "http://") || strings.HasPrefix(signature, "https://")
+}
+
+// signatureRejected reports whether err says the file does not carry a good
+// signature of a trusted key, rather than that it could not be checked
+func signatureRejected(err error) bool {
+	return errors.Is(err, pgp.ErrBadSignature) || errors.Is(err, pgp.ErrUnknownKey) || errors.Is(err, pgp.ErrInvalidKey)
+}
@@ -0,0 +1,232 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/pgp"
+)
+
+// An Ed25519 key made with GnuPG, and its signature of signedContent
+const (
+	signingKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatHSFxYJKwYBBAHaRw8BAQdAnlRZBcHxrrRG83F5QPoze73hTpHTbJ44bn60
+jId0xv+0HVN1cmdlIFRlc3QgPHRlc3RAZXhhbXBsZS5jb20+iJAEExYIADgWIQQf
+WJlwSoYdDshPgwdo4kMH0JhfTAUCatHSFwIbAwULCQgHAgYVCgkICwIEFgIDAQIe
+AQIXgAAKCRBo4kMH0JhfTMzrAP9VSvNrzhWGhizOjxHC7Ym3TUIrX8Ms6lR2vJW0
+2d4MiQD+OnxPeR71JdpQOejXn5+1zTp319OhiyR6d5GSV4E8jgs=
+=D8m5
+-----END PGP PUBLIC KEY BLOCK-----
+`
+	signedContent    = "surge release 1.0\nline two\n"
+	contentSignature = `-----BEGIN PGP SIGNATURE-----
+
+iIcEABYIAC8WIQQfWJlwSoYdDshPgwdo4kMH0JhfTAUCatHSbBEcdGVzdEBleGFt
+cGxlLmNvbQAKCRBo4kMH0JhfTKZ6AP45f+m5AqZicy9JE352cyR6BKRoLDOW/W5J
+9iE1FW2e2QD/bSUyuVcFsYQpK/V1dZP9AXmXBAtUq9Yr+xtP3/mYUAE=
+=PN2E
+-----END PGP SIGNATURE-----
+`
+)
+
+func TestTUIDownload_Signature(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	keyring := filepath.Join(tmpDir, "key.asc")
+	if err := os.WriteFile(keyring, []byte(signingKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".asc"):
+			w.Write([]byte(contentSignature))
+		case strings.HasPrefix(r.URL.Path, "/good"):
+			w.Write([]byte(signedContent))
+		default:
+			w.Write([]byte(strings.ToUpper(signedContent)))
+		}
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"good.txt", true},
+		{"bad.txt", false},
+	} {
+		progressCh := make(chan any, 100)
+		id := types.NewDownloadID()
+		err := TUIDownload(context.Background(), &types.DownloadConfig{
+			URL:        server.URL + "/" + tt.name,
+			OutputPath: tmpDir,
+			ID:         id,
+			Filename:   tt.name,
+			ProgressCh: progressCh,
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{},
+			Signature:  server.URL + "/" + tt.name + ".asc",
+			Keyring:    keyring,
+		})
+		close(progressCh)
+		var signer string
+		for msg := range progressCh {
+			if m, ok := msg.(events.SignatureVerifiedMsg); ok {
+				signer = m.Signer
+			}
+		}
+
+		path := filepath.Join(tmpDir, tt.name)
+		if tt.ok {
+			if err != nil || !strings.Contains(signer, "Surge Test") {
+				t.Errorf("%s: err = %v, signer = %q", tt.name, err, signer)
+			}
+			continue
+		}
+		if !errors.Is(err, pgp.ErrBadSignature) || signer != "" {
+			t.Errorf("%s: err = %v, signer = %q; want a bad signature", tt.name, err, signer)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left under its own name", tt.name)
+		}
+		if _, err := os.Stat(path + QuarantineSuffix); err != nil {
+			t.Errorf("%s not kept as %s: %v", tt.name, tt.name+QuarantineSuffix, err)
+		}
+	}
+}
+
+func TestTUIDownload_SignatureAfterRestart(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyring := filepath.Join(tmpDir, "key.asc")
+	if err := os.WriteFile(keyring, []byte(signingKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := newPausingServer(strings.Repeat(strings.ToUpper(signedContent), 1000), func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, ".asc") {
+			return false
+		}
+		w.Write([]byte(contentSignature))
+		return true
+	})
+	defer server.Close()
+
+	cfg := types.DownloadConfig{
+		URL:           server.URL + "/bad.txt",
+		OutputPath:    tmpDir,
+		Filename:      "bad.txt",
+		Runtime:       &types.RuntimeConfig{},
+		Signature:     server.URL + "/bad.txt.asc",
+		Keyring:       keyring,
+		Headers:       http.Header{"X-Tenant": {"acme"}, "Authorization": {"Bearer secret"}},
+		ExpectHeaders: http.Header{"Accept-Ranges": {"bytes"}},
+		Priority:      types.PriorityHigh,
+	}
+	resumed := server.pauseAndRestart(t, cfg)
+	if resumed.Signature != cfg.Signature || resumed.Keyring != keyring || resumed.Priority != types.PriorityHigh {
+		t.Errorf("restored signature %q, keyring %q, priority %v", resumed.Signature, resumed.Keyring, resumed.Priority)
+	}
+	if resumed.Headers.Get("X-Tenant") != "acme" || resumed.Headers.Get("Authorization") != "" {
+		t.Errorf("restored headers %v, want X-Tenant without credentials", resumed.Headers)
+	}
+	if resumed.ExpectHeaders.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("restored expected headers %v", resumed.ExpectHeaders)
+	}
+
+	err := TUIDownload(context.Background(), &resumed)
+	if !errors.Is(err, pgp.ErrBadSignature) {
+		t.Fatalf("resumed TUIDownload() = %v, want a bad signature", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputPath, "bad.txt"+QuarantineSuffix)); err != nil {
+		t.Errorf("bad.txt not kept as bad.txt%s: %v", QuarantineSuffix, err)
+	}
+}
+
+// pausingServer serves a file whose ranges wait until released, so a
+// download of it can be paused before it has the whole file
+type pausingServer struct {
+	*httptest.Server
+	release chan struct{}
+	waiting atomic.Int32
+}
+
+// newPausingServer serves content, and whatever else serves answers
+func newPausingServer(content string, serve func(http.ResponseWriter, *http.Request) bool) *pausingServer {
+	s := &pausingServer{release: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serve != nil && serve(w, r) {
+			return
+		}
+		if rng := r.Header.Get("Range"); rng != "" && rng != "bytes=0-0" {
+			s.waiting.Add(1)
+			select {
+			case <-s.release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	return s
+}
+
+// pauseAndRestart starts cfg, pauses it once it waits for the file and
+// reopens the database as a restart would. It returns the config of the
+// resumed download, rebuilt from the saved state alone.
+func (s *pausingServer) pauseAndRestart(t *testing.T, cfg types.DownloadConfig) types.DownloadConfig {
+	t.Helper()
+	dbPath := filepath.Join(cfg.OutputPath, "surge.db")
+	state.CloseDB()
+	state.Configure(dbPath)
+	t.Cleanup(state.CloseDB)
+
+	cfg.ID = types.NewDownloadID()
+	cfg.ProgressCh = make(chan any, 100)
+	cfg.State = types.NewProgressState(cfg.ID, 0)
+	errCh := make(chan error, 1)
+	go func() { errCh <- TUIDownload(context.Background(), &cfg) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.waiting.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cfg.State.Pause()
+	if err := <-errCh; err != nil {
+		t.Fatalf("paused TUIDownload() = %v", err)
+	}
+	close(s.release)
+
+	state.CloseDB()
+	state.Configure(dbPath)
+	destPath := filepath.Join(cfg.OutputPath, cfg.Filename)
+	saved, err := state.LoadState(cfg.URL, destPath)
+	if err != nil {
+		t.Fatalf("LoadState() = %v", err)
+	}
+	resumed := types.DownloadConfig{
+		URL:        cfg.URL,
+		OutputPath: cfg.OutputPath,
+		DestPath:   destPath,
+		ID:         cfg.ID,
+		Filename:   cfg.Filename,
+		IsResume:   true,
+		ProgressCh: make(chan any, 100),
+		State:      types.NewProgressState(cfg.ID, saved.TotalSize),
+		Runtime:    cfg.Runtime,
+	}
+	RestoreSettings(&resumed, saved)
+	return resumed
+}
@@ -0,0 +1,275 @@
+// Package aria2 reads and writes aria2 control files (".aria2"), which record
+// the progress of an interrupted aria2 download next to its data file, so
+// partial downloads can move between aria2 and Surge.
+package aria2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// Suffix is appended to a data file's path to name its control file
+const Suffix = ".aria2"
+
+// BlockLength is the unit aria2 tracks inside a piece being downloaded
+const BlockLength = 16 * 1024
+
+// DefaultPieceLength is the piece length Export uses, aria2's default
+const DefaultPieceLength = 1 << 20
+
+// Bounds on what a control file may claim, so a corrupt one cannot make
+// Read allocate without limit
+const (
+	maxBitfieldLength = 64 << 20
+	maxInFlight       = 1 << 20
+)
+
+// ErrTorrent is returned for control files of BitTorrent downloads
+var ErrTorrent = errors.New("aria2 control files of BitTorrent downloads are not supported")
+
+// Control is the content of a control file for an HTTP, FTP or SFTP download
+type Control struct {
+	PieceLength int64
+	TotalLength int64
+	Bitfield    []byte // Bit i, most significant first, is set once piece i is complete
+	InFlight    []Piece
+}
+
+// Piece is a piece aria2 was downloading when it stopped
+type Piece struct {
+	Index    uint32
+	Length   uint32
+	Bitfield []byte // Bit i is set once block i (of BlockLength bytes) is complete
+}
+
+// Read parses a control file. Version 1 files are big-endian; version 0
+// files used the byte order of the host that wrote them, nearly always
+// little-endian.
+func Read(r io.Reader) (*Control, error) {
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, fmt.Errorf("failed to read aria2 control file: %w", err)
+	}
+	var order binary.ByteOrder
+	switch version {
+	case 0:
+		order = binary.LittleEndian
+	case 1:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("unsupported aria2 control file version %d", version)
+	}
+
+	rd := reader{r: r, order: order}
+	rd.u32() // Extension flags
+	if infoHashLen := rd.u32(); rd.err == nil && infoHashLen > 0 {
+		return nil, ErrTorrent
+	}
+	c := &Control{
+		PieceLength: int64(rd.u32()),
+		TotalLength: int64(rd.u64()),
+	}
+	rd.u64() // Uploaded bytes
+	c.Bitfield = rd.bytes(rd.u32(), maxBitfieldLength)
+	numInFlight := rd.u32()
+	if rd.err == nil && numInFlight > maxInFlight {
+		return nil, fmt.Errorf("invalid aria2 control file: %d pieces in flight", numInFlight)
+	}
+	for i := uint32(0); i < numInFlight && rd.err == nil; i++ {
+		p := Piece{Index: rd.u32(), Length: rd.u32()}
+		p.Bitfield = rd.bytes(rd.u32(), maxBitfieldLength)
+		c.InFlight = append(c.InFlight, p)
+	}
+	if rd.err != nil {
+		return nil, fmt.Errorf("failed to read aria2 control file: %w", rd.err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid aria2 control file: %w", err)
+	}
+	return c, nil
+}
+
+// validate checks that the fields agree with each other
+func (c *Control) validate() error {
+	if c.PieceLength <= 0 || c.TotalLength <= 0 {
+		return fmt.Errorf("piece length %d, total length %d", c.PieceLength, c.TotalLength)
+	}
+	if want := (c.numPieces() + 7) / 8; int64(len(c.Bitfield)) != want {
+		return fmt.Errorf("bitfield of %d bytes, want %d", len(c.Bitfield), want)
+	}
+	for _, p := range c.InFlight {
+		if int64(p.Index) >= c.numPieces() || int64(p.Length) > c.PieceLength {
+			return fmt.Errorf("piece %d of length %d out of range", p.Index, p.Length)
+		}
+	}
+	return nil
+}
+
+// Write stores c as a version 1 control file
+func Write(w io.Writer, c *Control) error {
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("invalid aria2 control data: %w", err)
+	}
+	var buf bytes.Buffer
+	be := binary.BigEndian
+	buf.Write(be.AppendUint16(nil, 1))
+	buf.Write(be.AppendUint32(nil, 0)) // Extension flags
+	buf.Write(be.AppendUint32(nil, 0)) // No info hash
+	buf.Write(be.AppendUint32(nil, uint32(c.PieceLength)))
+	buf.Write(be.AppendUint64(nil, uint64(c.TotalLength)))
+	buf.Write(be.AppendUint64(nil, 0)) // Uploaded bytes
+	buf.Write(be.AppendUint32(nil, uint32(len(c.Bitfield))))
+	buf.Write(c.Bitfield)
+	buf.Write(be.AppendUint32(nil, uint32(len(c.InFlight))))
+	for _, p := range c.InFlight {
+		buf.Write(be.AppendUint32(nil, p.Index))
+		buf.Write(be.AppendUint32(nil, p.Length))
+		buf.Write(be.AppendUint32(nil, uint32(len(p.Bitfield))))
+		buf.Write(p.Bitfield)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Remaining returns the byte ranges still to be downloaded, merged and in
+// order, and how many bytes are already done
+func (c *Control) Remaining() ([]types.Task, int64) {
+	inFlight := make(map[uint32]Piece, len(c.InFlight))
+	for _, p := range c.InFlight {
+		inFlight[p.Index] = p
+	}
+
+	var tasks []types.Task
+	add := func(offset, length int64) {
+		if n := len(tasks); n > 0 && tasks[n-1].Offset+tasks[n-1].Length == offset {
+			tasks[n-1].Length += length
+			return
+		}
+		tasks = append(tasks, types.Task{Offset: offset, Length: length})
+	}
+
+	for i := int64(0); i < c.numPieces(); i++ {
+		if bitSet(c.Bitfield, i) {
+			continue
+		}
+		start, end := c.pieceRange(i)
+		p, ok := inFlight[uint32(i)]
+		if !ok {
+			add(start, end-start)
+			continue
+		}
+		for off := start; off < end; off += BlockLength {
+			if !bitSet(p.Bitfield, (off-start)/BlockLength) {
+				add(off, min(BlockLength, end-off))
+			}
+		}
+	}
+
+	var remaining int64
+	for _, t := range tasks {
+		remaining += t.Length
+	}
+	return tasks, c.TotalLength - remaining
+}
+
+// FromRemaining describes a download of totalLength bytes with the given
+// ranges still to be downloaded. Pieces only partly done are recorded as in
+// flight, down to the block.
+func FromRemaining(totalLength, pieceLength int64, remaining []types.Task) *Control {
+	c := &Control{PieceLength: pieceLength, TotalLength: totalLength}
+	c.Bitfield = make([]byte, (c.numPieces()+7)/8)
+	for i := int64(0); i < c.numPieces(); i++ {
+		start, end := c.pieceRange(i)
+		if !overlaps(remaining, start, end) {
+			setBit(c.Bitfield, i)
+			continue
+		}
+		numBlocks := (end - start + BlockLength - 1) / BlockLength
+		p := Piece{Index: uint32(i), Length: uint32(end - start), Bitfield: make([]byte, (numBlocks+7)/8)}
+		done := false
+		for b := int64(0); b < numBlocks; b++ {
+			blockStart := start + b*BlockLength
+			if !overlaps(remaining, blockStart, min(blockStart+BlockLength, end)) {
+				setBit(p.Bitfield, b)
+				done = true
+			}
+		}
+		if done {
+			c.InFlight = append(c.InFlight, p)
+		}
+	}
+	return c
+}
+
+func (c *Control) numPieces() int64 {
+	return (c.TotalLength + c.PieceLength - 1) / c.PieceLength
+}
+
+// pieceRange returns the byte range [start, end) of piece i
+func (c *Control) pieceRange(i int64) (int64, int64) {
+	start := i * c.PieceLength
+	return start, min(start+c.PieceLength, c.TotalLength)
+}
+
+// overlaps reports whether any of tasks covers a byte of [start, end)
+func overlaps(tasks []types.Task, start, end int64) bool {
+	for _, t := range tasks {
+		if t.Offset < end && start < t.Offset+t.Length {
+			return true
+		}
+	}
+	return false
+}
+
+func bitSet(bitfield []byte, i int64) bool {
+	return i/8 < int64(len(bitfield)) && bitfield[i/8]&(0x80>>(i%8)) != 0
+}
+
+func setBit(bitfield []byte, i int64) {
+	bitfield[i/8] |= 0x80 >> (i % 8)
+}
+
+// reader reads fixed-size fields, keeping the first error
+type reader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	err   error
+}
+
+func (rd *reader) read(n int) []byte {
+	if rd.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rd.r, buf); err != nil {
+		rd.err = err
+		return nil
+	}
+	return buf
+}
+
+func (rd *reader) u32() uint32 {
+	if b := rd.read(4); b != nil {
+		return rd.order.Uint32(b)
+	}
+	return 0
+}
+
+func (rd *reader) u64() uint64 {
+	if b := rd.read(8); b != nil {
+		return rd.order.Uint64(b)
+	}
+	return 0
+}
+
+func (rd *reader) bytes(n uint32, limit int) []byte {
+	if rd.err == nil && int(n) > limit {
+		rd.err = fmt.Errorf("field of %d bytes is too large", n)
+	}
+	return rd.read(int(n))
+}
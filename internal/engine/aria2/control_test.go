@@ -0,0 +1,129 @@
+package aria2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// controlFile builds a control file the way aria2 lays it out
+func controlFile(order binary.AppendByteOrder, version uint16, infoHash []byte, pieceLength uint32, total uint64, bitfield []byte, inFlight []Piece) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint16(b, version)
+	b = order.AppendUint32(b, 0)
+	b = order.AppendUint32(b, uint32(len(infoHash)))
+	b = append(b, infoHash...)
+	b = order.AppendUint32(b, pieceLength)
+	b = order.AppendUint64(b, total)
+	b = order.AppendUint64(b, 0)
+	b = order.AppendUint32(b, uint32(len(bitfield)))
+	b = append(b, bitfield...)
+	b = order.AppendUint32(b, uint32(len(inFlight)))
+	for _, p := range inFlight {
+		b = order.AppendUint32(b, p.Index)
+		b = order.AppendUint32(b, p.Length)
+		b = order.AppendUint32(b, uint32(len(p.Bitfield)))
+		b = append(b, p.Bitfield...)
+	}
+	return b
+}
+
+func TestRead_Remaining(t *testing.T) {
+	// Five 64KiB pieces, the last one short: pieces 0 and 3 are done, piece 1
+	// has its first and third 16KiB blocks
+	const piece = 64 * 1024
+	total := uint64(4*piece + 1000)
+	bitfield := []byte{0b1001_0000}
+	inFlight := []Piece{{Index: 1, Length: piece, Bitfield: []byte{0b1010_0000}}}
+	want := []types.Task{
+		{Offset: piece + BlockLength, Length: BlockLength},
+		{Offset: piece + 3*BlockLength, Length: BlockLength + piece}, // Rest of piece 1 and all of piece 2
+		{Offset: 4 * piece, Length: 1000},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		order   binary.AppendByteOrder
+		version uint16
+	}{
+		{"version 1", binary.BigEndian, 1},
+		{"version 0", binary.LittleEndian, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Read(bytes.NewReader(controlFile(tt.order, tt.version, nil, piece, total, bitfield, inFlight)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tasks, done := c.Remaining()
+			if !reflect.DeepEqual(tasks, want) {
+				t.Errorf("Remaining() tasks = %v, want %v", tasks, want)
+			}
+			if wantDone := int64(2*piece + 2*BlockLength); done != wantDone {
+				t.Errorf("Remaining() done = %d, want %d", done, wantDone)
+			}
+		})
+	}
+}
+
+func TestRead_Rejects(t *testing.T) {
+	good := controlFile(binary.BigEndian, 1, nil, 1024, 4096, []byte{0}, nil)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", good[:len(good)-3]},
+		{"unknown version", controlFile(binary.BigEndian, 7, nil, 1024, 4096, []byte{0}, nil)},
+		{"wrong bitfield size", controlFile(binary.BigEndian, 1, nil, 1024, 4096, []byte{0, 0}, nil)},
+		{"zero piece length", controlFile(binary.BigEndian, 1, nil, 0, 4096, nil, nil)},
+		{"piece out of range", controlFile(binary.BigEndian, 1, nil, 1024, 4096, []byte{0}, []Piece{{Index: 9, Length: 1024, Bitfield: []byte{0}}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.data)); err == nil {
+				t.Error("Read() should fail")
+			}
+		})
+	}
+
+	torrent := controlFile(binary.BigEndian, 1, bytes.Repeat([]byte{1}, 20), 1024, 4096, []byte{0}, nil)
+	if _, err := Read(bytes.NewReader(torrent)); !errors.Is(err, ErrTorrent) {
+		t.Errorf("Read() of a torrent control file = %v, want ErrTorrent", err)
+	}
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	const total = 3*DefaultPieceLength + 5000
+	remaining := []types.Task{
+		{Offset: 2 * BlockLength, Length: 3 * BlockLength},                     // Inside piece 0
+		{Offset: 2 * DefaultPieceLength, Length: total - 2*DefaultPieceLength}, // Pieces 2 and 3
+	}
+
+	c := FromRemaining(total, DefaultPieceLength, remaining)
+	if len(c.InFlight) != 1 || c.InFlight[0].Index != 0 {
+		t.Fatalf("in-flight pieces = %+v, want only piece 0", c.InFlight)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, c); err != nil {
+		t.Fatal(err)
+	}
+	if v := binary.BigEndian.Uint16(buf.Bytes()); v != 1 {
+		t.Errorf("written version = %d, want 1", v)
+	}
+
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, done := read.Remaining()
+	if !reflect.DeepEqual(tasks, remaining) {
+		t.Errorf("round-tripped tasks = %v, want %v", tasks, remaining)
+	}
+	if want := int64(total) - 3*BlockLength - (total - 2*DefaultPieceLength); done != want {
+		t.Errorf("round-tripped done = %d, want %d", done, want)
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/surge-downloader/surge/internal/engine/torrent"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// maxTorrentSize bounds a .torrent fetched for a magnet URI
+const maxTorrentSize = 10 << 20
+
+// maxSignatureSize bounds a detached signature fetched by FetchSignature
+const maxSignatureSize = 64 << 10
+
+// Backend adapts a download protocol other than HTTP to the engine. Surge
+// transfers every payload with the concurrent HTTP engine, so a backend turns
+// its URLs into the HTTP(S) sources holding the file; the queue, TUI,
+// pause/resume and progress reporting then treat the download like any other.
+type Backend interface {
+	Name() string
+	Handles(rawurl string) bool
+	Resolve(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (Source, error)
+}
+
+// Source is the HTTP download behind a URL
+type Source struct {
+	URL      string
+	Mirrors  []string // All URLs of the file, including URL
+	Filename string
+	Size     int64          // 0 when unknown
+	Cookies  []*http.Cookie // The download needs these, e.g. a session the link set up
+	Torrent  string         // URL of the .torrent whose piece hashes the file must match, if any
+}
+
+// backends are consulted in order; the first handling a URL resolves it
+var backends = []Backend{
+	torrentBackend{},
+	oneDriveBackend{},
+	pixeldrainBackend{},
+	mediaFireBackend{},
+	oneFichierBackend{},
+}
+
+// ResolveSource returns the download behind rawurl. URLs no backend handles
+// come back unchanged with mirrors and filename; otherwise the backend
+// supplies the URLs, and the filename unless filename is set.
+// runtime may be nil; when set, its network policy applies to any fetch.
+func ResolveSource(ctx context.Context, rawurl string, mirrors []string, filename string, runtime *types.RuntimeConfig) (Source, error) {
+	for _, b := range backends {
+		if !b.Handles(rawurl) {
+			continue
+		}
+		src, err := b.Resolve(ctx, rawurl, runtime)
+		if err != nil {
+			return Source{}, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		if filename != "" {
+			src.Filename = filename
+		}
+		utils.Debug("Backend %s resolved %s to %s (%d sources)", b.Name(), rawurl, src.URL, len(src.Mirrors))
+		return src, nil
+	}
+	return Source{URL: rawurl, Mirrors: mirrors, Filename: filename}, nil
+}
+
+// torrentBackend downloads magnet URIs from the HTTP sources they list: direct
+// sources (as=), web seeds (ws=), or the web seeds of the .torrent at xs=.
+// Peer-wire transfers are not available, so magnets listing none of these
+// cannot be downloaded. Only a download with a .torrent can be checked
+// against its piece hashes; the info hash alone doesn't describe the file.
+type torrentBackend struct{}
+
+func (torrentBackend) Name() string { return "torrent" }
+
+func (torrentBackend) Handles(rawurl string) bool { return torrent.IsMagnet(rawurl) }
+
+func (torrentBackend) Resolve(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (Source, error) {
+	m, err := torrent.ParseMagnet(rawurl)
+	if err != nil {
+		return Source{}, err
+	}
+	src := Source{Filename: m.Name, Size: m.Length, Mirrors: m.HTTPURLs()}
+
+	// The .torrent's web seeds join the magnet's own
+	var errs []error
+	for _, xs := range m.TorrentURLs {
+		meta, err := FetchMetainfo(ctx, xs, runtime)
+		if err == nil && meta.InfoHash != m.InfoHash {
+			err = fmt.Errorf("info hash %s does not match the magnet", meta.InfoHash)
+		}
+		var urls []string
+		if err == nil {
+			urls, err = torrent.WebSeedURLs(meta)
+			// A .torrent without web seeds still checks what the magnet's
+			// own sources serve
+			if errors.Is(err, torrent.ErrNoWebSeeds) && src.Torrent == "" {
+				src.Torrent = xs
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", xs, err))
+			continue
+		}
+		if src.Filename == "" {
+			src.Filename = meta.Name
+		}
+		if src.Size == 0 {
+			src.Size = meta.Length
+		}
+		if src.Torrent == "" {
+			src.Torrent = xs
+		}
+		for _, u := range urls {
+			if !slices.Contains(src.Mirrors, u) {
+				src.Mirrors = append(src.Mirrors, u)
+			}
+		}
+	}
+
+	if len(src.Mirrors) == 0 {
+		errs = append(errs, fmt.Errorf("magnet lists no HTTP sources or web seeds, and peer-to-peer transfers are not supported"))
+		return Source{}, errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		utils.Debug("Ignoring unusable .torrent sources of %s: %v", rawurl, errors.Join(errs...))
+	}
+	src.URL = src.Mirrors[0]
+	return src, nil
+}
+
+// FetchMetainfo downloads and parses the .torrent at rawurl under runtime's
+// network policy, proxy and credentials
+func FetchMetainfo(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (*torrent.Metainfo, error) {
+	data, err := fetchSmall(ctx, rawurl, runtime, maxTorrentSize)
+	if err != nil {
+		return nil, err
+	}
+	return torrent.ParseMetainfo(data)
+}
+
+// FetchSignature downloads the detached signature at rawurl under runtime's
+// network policy, proxy and credentials
+func FetchSignature(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) ([]byte, error) {
+	return fetchSmall(ctx, rawurl, runtime, maxSignatureSize)
+}
+
+// fetchSmall downloads the file at rawurl, no larger than limit, in one go
+func fetchSmall(ctx context.Context, rawurl string, runtime *types.RuntimeConfig, limit int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", ua)
+	if err := runtime.AddHeaders(req); err != nil {
+		return nil, err
+	}
+	resp, err := probeClientFor(runtime).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.NewHTTPError(rawurl, resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", rawurl, limit)
+	}
+	return data, nil
+}
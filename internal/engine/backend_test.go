@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestResolveSource_PassesThroughHTTP(t *testing.T) {
+	src, err := ResolveSource(context.Background(), "http://a.example/f", []string{"http://a.example/f", "http://b.example/f"}, "f", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.URL != "http://a.example/f" || len(src.Mirrors) != 2 || src.Filename != "f" {
+		t.Errorf("src = %+v", src)
+	}
+}
+
+func TestResolveSource_Magnet(t *testing.T) {
+	info := "d6:lengthi1024e4:name8:file.iso12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	sum := sha1.Sum([]byte(info))
+	hash := hex.EncodeToString(sum[:])
+	seed := "http://seed.example/file.iso"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d4:info" + info + "8:url-listl" + "28:" + seed + "ee"))
+	}))
+	defer server.Close()
+
+	magnet := "magnet:?xt=urn:btih:" + hash +
+		"&ws=" + url.QueryEscape("http://ws.example/file.iso") +
+		"&xs=" + url.QueryEscape(server.URL+"/file.torrent")
+	src, err := ResolveSource(context.Background(), magnet, nil, "", nil)
+	if err != nil {
+		t.Fatalf("ResolveSource failed: %v", err)
+	}
+	want := []string{"http://ws.example/file.iso", seed}
+	if src.URL != want[0] || !reflect.DeepEqual(src.Mirrors, want) {
+		t.Errorf("src = %+v, want mirrors %v", src, want)
+	}
+	if src.Filename != "file.iso" || src.Size != 1024 {
+		t.Errorf("Filename = %q, Size = %d; want them from the .torrent", src.Filename, src.Size)
+	}
+	if src.Torrent != server.URL+"/file.torrent" {
+		t.Errorf("Torrent = %q, want the xs= URL to verify pieces against", src.Torrent)
+	}
+
+	// A given filename wins over the magnet's
+	src, err = ResolveSource(context.Background(), magnet, nil, "mine.iso", nil)
+	if err != nil || src.Filename != "mine.iso" {
+		t.Errorf("Filename = %q, err = %v", src.Filename, err)
+	}
+}
+
+func TestResolveSource_MagnetTorrentWithoutSeeds(t *testing.T) {
+	info := "d6:lengthi1024e4:name8:file.iso12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	sum := sha1.Sum([]byte(info))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d4:info" + info + "e"))
+	}))
+	defer server.Close()
+
+	// The .torrent adds no sources but still has the hashes to check against
+	magnet := "magnet:?xt=urn:btih:" + hex.EncodeToString(sum[:]) +
+		"&ws=" + url.QueryEscape("http://ws.example/file.iso") +
+		"&xs=" + url.QueryEscape(server.URL+"/file.torrent")
+	src, err := ResolveSource(context.Background(), magnet, nil, "", nil)
+	if err != nil {
+		t.Fatalf("ResolveSource failed: %v", err)
+	}
+	if len(src.Mirrors) != 1 || src.Torrent != server.URL+"/file.torrent" {
+		t.Errorf("src = %+v, want the ws= source checked against the xs= torrent", src)
+	}
+}
+
+func TestResolveSource_MagnetWithoutSources(t *testing.T) {
+	_, err := ResolveSource(context.Background(), "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a", nil, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "peer-to-peer") {
+		t.Errorf("expected an error about missing HTTP sources, got %v", err)
+	}
+}
+
+func TestOneDriveBackend_Handles(t *testing.T) {
+	for rawurl, want := range map[string]bool{
+		"https://1drv.ms/u/s!AkX3abc":                                        true,
+		"https://onedrive.live.com/redir?resid=ABC!123&authkey=!xyz":         true,
+		"https://onedrive.live.com/download?resid=ABC!123":                   false,
+		"https://contoso.sharepoint.com/:u:/g/personal/alice/EaBc?e=x1":      true,
+		"https://contoso-my.sharepoint.com/:x:/r/personal/alice/EaBc":        true,
+		"https://contoso.sharepoint.com/sites/team/Shared%20Documents/a.pdf": false,
+		"https://example.com/:u:/g/x":                                        false,
+		"ftp://1drv.ms/u/s!AkX3abc":                                          false,
+	} {
+		if got := (oneDriveBackend{}).Handles(rawurl); got != want {
+			t.Errorf("Handles(%s) = %v, want %v", rawurl, got, want)
+		}
+	}
+}
+
+// shareAPIs points the share APIs at local servers for the test
+func shareAPIs(t *testing.T, graph, oneDrive http.HandlerFunc) {
+	t.Helper()
+	savedGraph, savedOneDrive := graphAPI, oneDriveAPI
+	gs, ods := httptest.NewServer(graph), httptest.NewServer(oneDrive)
+	graphAPI, oneDriveAPI = gs.URL, ods.URL
+	t.Cleanup(func() {
+		gs.Close()
+		ods.Close()
+		graphAPI, oneDriveAPI = savedGraph, savedOneDrive
+	})
+}
+
+type authorizerFunc func(*http.Request) error
+
+func (f authorizerFunc) Authorize(req *http.Request) error { return f(req) }
+
+func TestResolveSource_OneDriveShare(t *testing.T) {
+	link := "https://1drv.ms/u/s!AkX3abc"
+	shareAPIs(t,
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer graph" {
+				t.Error("Graph was asked without signing in")
+			}
+			if r.URL.Path != "/shares/"+shareID(link)+"/driveItem" {
+				t.Errorf("Graph path = %s", r.URL.Path)
+			}
+			w.Write([]byte(`{"name": "signed.zip", "size": 7, "@microsoft.graph.downloadUrl": "https://dl.example/signed"}`))
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/shares/"+shareID(link)+"/root" {
+				t.Errorf("OneDrive path = %s", r.URL.Path)
+			}
+			w.Write([]byte(`{"name": "report.pdf", "size": 42, "@content.downloadUrl": "https://dl.example/anon"}`))
+		})
+
+	// Anonymous: Graph is skipped
+	src, err := ResolveSource(context.Background(), link, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.URL != "https://dl.example/anon" || src.Filename != "report.pdf" || src.Size != 42 {
+		t.Errorf("anonymous src = %+v", src)
+	}
+
+	// Signed in to Microsoft: Graph resolves it
+	runtime := &types.RuntimeConfig{Authorizer: authorizerFunc(func(req *http.Request) error {
+		if strings.HasPrefix(req.URL.String(), graphAPI) {
+			req.Header.Set("Authorization", "Bearer graph")
+		}
+		return nil
+	})}
+	src, err = ResolveSource(context.Background(), link, nil, "", runtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.URL != "https://dl.example/signed" || src.Filename != "signed.zip" {
+		t.Errorf("signed-in src = %+v", src)
+	}
+}
+
+func TestResolveSource_OneDriveShareErrors(t *testing.T) {
+	answer := `{"name": "photos", "folder": {"childCount": 3}}`
+	status := http.StatusOK
+	shareAPIs(t,
+		func(w http.ResponseWriter, r *http.Request) { t.Error("Graph was asked without signing in") },
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(answer))
+		})
+
+	if _, err := ResolveSource(context.Background(), "https://1drv.ms/f/s!folder", nil, "", nil); err == nil || !strings.Contains(err.Error(), "folder") {
+		t.Errorf("folder link: %v", err)
+	}
+	status, answer = http.StatusForbidden, `{}`
+	if _, err := ResolveSource(context.Background(), "https://1drv.ms/u/s!private", nil, "", nil); !errors.Is(err, errShareSignIn) {
+		t.Errorf("private link: %v, want errShareSignIn", err)
+	}
+}
+
+func TestResolveSharePointLink(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/:u:/g/personal/alice/EaBc", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("download") != "1" || r.URL.Query().Get("e") != "x1" {
+			t.Errorf("link query = %s", r.URL.RawQuery)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "FedAuth", Value: "session", Path: "/"})
+		http.Redirect(w, r, "/personal/alice/_layouts/15/download.aspx?share=EaBc", http.StatusFound)
+	})
+	mux.HandleFunc("/personal/alice/_layouts/15/download.aspx", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("FedAuth"); err != nil || c.Value != "session" {
+			http.Error(w, "no session", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="budget.xlsx"`)
+		w.Write([]byte("spreadsheet"))
+	})
+	mux.HandleFunc("/:u:/g/personal/bob/Org", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>Sign in</html>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	link, _ := url.Parse(server.URL + "/:u:/g/personal/alice/EaBc?e=x1")
+	src, err := resolveSharePointLink(context.Background(), link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(src.URL, "/download.aspx?share=EaBc") || src.Filename != "budget.xlsx" || src.Size != int64(len("spreadsheet")) {
+		t.Errorf("src = %+v", src)
+	}
+	if len(src.Cookies) != 1 || src.Cookies[0].Name != "FedAuth" || src.Cookies[0].Domain != "127.0.0.1" {
+		t.Fatalf("cookies = %v, want the FedAuth session for the server", src.Cookies)
+	}
+
+	// The cookies are what the download needs
+	jar := (&types.RuntimeConfig{Cookies: src.Cookies}).CookieJar()
+	resp, err := (&http.Client{Jar: jar}).Get(src.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("download with the cookies: %s", resp.Status)
+	}
+
+	link, _ = url.Parse(server.URL + "/:u:/g/personal/bob/Org")
+	if _, err := resolveSharePointLink(context.Background(), link, nil); !errors.Is(err, errShareSignIn) {
+		t.Errorf("organization-only link: %v, want errShareSignIn", err)
+	}
+}
@@ -0,0 +1,211 @@
+package concurrent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// connTuner decides how many workers a download runs. An adaptive tuner
+// grows the count while added connections raise throughput, gives back a
+// grow that didn't, and halves it when the server pushes back with 429 or
+// 503; a fixed one keeps the planned count. Either is held to the limit the
+// worker pool sets as it shares connections between downloads. Workers past
+// the target finish their task and exit; growing starts workers for the
+// free IDs below it.
+type connTuner struct {
+	min, max int
+	adaptive bool
+
+	throttled atomic.Bool // A worker saw 429 or 503 since the last step
+
+	mu      sync.Mutex
+	target  int
+	limit   int // Most workers the pool allows now, 0 for no limit
+	running map[int]bool
+
+	// State of the last step, to judge whether a grow paid off
+	grew       bool
+	prevTarget int
+	prevSpeed  float64
+	hold       int // Steps left before growing again
+}
+
+func newConnTuner(start, maxConns int) *connTuner {
+	start = max(1, min(start, maxConns))
+	return &connTuner{min: 1, max: max(start, maxConns), adaptive: true, target: start, running: make(map[int]bool)}
+}
+
+// newFixedTuner returns a tuner that runs conns workers, or fewer while the
+// pool's limit is lower
+func newFixedTuner(conns int) *connTuner {
+	conns = max(1, conns)
+	return &connTuner{min: 1, max: conns, target: conns, running: make(map[int]bool)}
+}
+
+// setLimit holds the tuner to n workers, 0 for no limit, and reports whether
+// that may let more run than before. An adaptive tuner above the limit drops
+// to it and grows again from there once the limit rises.
+func (t *connTuner) setLimit(n int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n = max(n, 0)
+	if n == t.limit {
+		return false
+	}
+	before := t.currentLocked()
+	t.limit = n
+	if t.adaptive && n > 0 && t.target > n {
+		t.target = n
+		t.grew = false
+	}
+	return t.currentLocked() > before
+}
+
+// current returns how many workers should be running
+func (t *connTuner) current() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.currentLocked()
+}
+
+// currentLocked is current. Must hold t.mu.
+func (t *connTuner) currentLocked() int {
+	if t.limit > 0 {
+		return min(t.target, t.limit)
+	}
+	return t.target
+}
+
+// throttle records that the server refused a request for being overloaded
+func (t *connTuner) throttle() {
+	t.throttled.Store(true)
+}
+
+// step returns the next target given the bytes downloaded over elapsed and
+// the bytes still to fetch. A fixed tuner keeps its target.
+func (t *connTuner) step(bytes int64, elapsed time.Duration, remaining int64) int {
+	speed := float64(bytes) / max(elapsed.Seconds(), 0.001)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.adaptive {
+		return t.target
+	}
+	ceiling := t.max
+	if t.limit > 0 {
+		ceiling = min(ceiling, t.limit)
+	}
+
+	grew := t.grew
+	t.grew = false
+	switch {
+	case t.throttled.Swap(false):
+		t.target = max(t.min, t.target/2)
+		t.hold = types.AdaptiveHoldIntervals
+		utils.Debug("Adaptive: server throttled, down to %d connections", t.target)
+	case grew && speed < t.prevSpeed*(1+types.AdaptiveMinGain):
+		utils.Debug("Adaptive: %d connections no faster than %d (%.0f vs %.0f KB/s), going back",
+			t.target, t.prevTarget, speed/1024, t.prevSpeed/1024)
+		t.target = t.prevTarget
+		t.hold = types.AdaptiveHoldIntervals
+	case t.hold > 0:
+		t.hold--
+	case t.target < ceiling && remaining > int64(t.target)*types.MinChunk:
+		// Grow by half again, so a fast link gets to the limit in a few steps
+		t.prevTarget, t.prevSpeed = t.target, speed
+		t.target = min(ceiling, t.target+max(1, t.target/2))
+		t.grew = true
+		utils.Debug("Adaptive: %.0f KB/s per connection over %d, trying %d",
+			speed/1024/float64(t.prevTarget), t.prevTarget, t.target)
+	}
+	return t.target
+}
+
+// keep reports whether worker id may take another task. A worker told no
+// must exit; its ID is free to be started again.
+func (t *connTuner) keep(id int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id < t.currentLocked() {
+		return true
+	}
+	delete(t.running, id)
+	return false
+}
+
+// fill calls start for every ID below the target without a running worker
+func (t *connTuner) fill(start func(id int)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := 0; id < t.currentLocked(); id++ {
+		if !t.running[id] {
+			t.running[id] = true
+			start(id)
+		}
+	}
+}
+
+// exited removes a worker that returned for any reason other than keep
+func (t *connTuner) exited(id int) {
+	t.mu.Lock()
+	delete(t.running, id)
+	t.mu.Unlock()
+}
+
+// workers returns how many workers are running
+func (t *connTuner) workers() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.running)
+}
+
+// isThrottle reports whether err is the server asking for fewer requests
+func isThrottle(err error) bool {
+	var httpErr *types.HTTPError
+	return errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode == http.StatusServiceUnavailable)
+}
+
+// tune follows the pool's connection limit every ConnLimitInterval and, for
+// an adaptive download, steps t every AdaptiveInterval until the download
+// ends, starting workers through start whenever either lets more run
+func (d *ConcurrentDownloader) tune(ctx context.Context, queue *TaskQueue, t *connTuner, fileSize int64, start func(id int)) {
+	limitTicker := time.NewTicker(types.ConnLimitInterval)
+	defer limitTicker.Stop()
+	var steps <-chan time.Time
+	if t.adaptive {
+		ticker := time.NewTicker(types.AdaptiveInterval)
+		defer ticker.Stop()
+		steps = ticker.C
+	}
+
+	last := d.State.Downloaded.Load()
+	lastTime := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-queue.closed:
+			return
+		case <-limitTicker.C:
+			if t.setLimit(int(d.State.ConnLimit.Load())) {
+				t.fill(start)
+			}
+			if t.workers() == 0 {
+				return // Every worker failed, so the download ends
+			}
+		case now := <-steps:
+			downloaded := d.State.Downloaded.Load()
+			t.step(downloaded-last, now.Sub(lastTime), fileSize-downloaded)
+			t.fill(start)
+			last, lastTime = downloaded, now
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestConnTuner_GrowsWhileItPays(t *testing.T) {
+	tuner := newConnTuner(2, 8)
+	remaining := int64(1 << 40)
+
+	var got []int
+	speed := int64(10 * types.MB)
+	for range 4 {
+		got = append(got, tuner.step(speed, time.Second, remaining))
+		speed *= 2
+	}
+	if want := []int{3, 4, 6, 8}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+	if n := tuner.step(speed, time.Second, remaining); n != 8 {
+		t.Errorf("grew past the limit to %d", n)
+	}
+}
+
+func TestConnTuner_UndoesGrowThatDidNotPay(t *testing.T) {
+	tuner := newConnTuner(4, 16)
+	remaining := int64(1 << 40)
+
+	if n := tuner.step(40*types.MB, time.Second, remaining); n != 6 {
+		t.Fatalf("first step: %d, want 6", n)
+	}
+	// Six connections are no faster than four
+	if n := tuner.step(41*types.MB, time.Second, remaining); n != 4 {
+		t.Fatalf("after a flat step: %d, want back to 4", n)
+	}
+	for i := range types.AdaptiveHoldIntervals {
+		if n := tuner.step(40*types.MB, time.Second, remaining); n != 4 {
+			t.Fatalf("hold step %d: %d, want 4", i, n)
+		}
+	}
+	if n := tuner.step(40*types.MB, time.Second, remaining); n != 6 {
+		t.Errorf("after the hold: %d, want another try at 6", n)
+	}
+}
+
+func TestConnTuner_BacksOffWhenThrottled(t *testing.T) {
+	tuner := newConnTuner(8, 16)
+	remaining := int64(1 << 40)
+
+	tuner.throttle()
+	if n := tuner.step(types.MB, time.Second, remaining); n != 4 {
+		t.Errorf("after a 429: %d, want 4", n)
+	}
+	for range 3 {
+		tuner.throttle()
+		tuner.step(types.MB, time.Second, remaining)
+	}
+	if n := tuner.step(types.MB, time.Second, remaining); n != 1 {
+		t.Errorf("after repeated 429s: %d, want 1", n)
+	}
+}
+
+func TestConnTuner_NoGrowthNearTheEnd(t *testing.T) {
+	tuner := newConnTuner(2, 16)
+	if n := tuner.step(10*types.MB, time.Second, types.MinChunk); n != 2 {
+		t.Errorf("grew to %d with one chunk left", n)
+	}
+}
+
+func TestConnTuner_RetiresWorkersAboveTarget(t *testing.T) {
+	tuner := newConnTuner(4, 8)
+	var started []int
+	tuner.fill(func(id int) { started = append(started, id) })
+	if fmt.Sprint(started) != "[0 1 2 3]" {
+		t.Fatalf("started %v", started)
+	}
+
+	tuner.throttle()
+	tuner.step(types.MB, time.Second, 1<<40) // down to 2
+	if !tuner.keep(1) || tuner.keep(2) || tuner.keep(3) {
+		t.Error("workers 2 and 3 should be retired, 0 and 1 kept")
+	}
+	if n := tuner.workers(); n != 2 {
+		t.Errorf("workers = %d after retiring two, want 2", n)
+	}
+
+	// Growing again restarts the free IDs only
+	started = nil
+	tuner.mu.Lock()
+	tuner.target = 3
+	tuner.mu.Unlock()
+	tuner.fill(func(id int) { started = append(started, id) })
+	if fmt.Sprint(started) != "[2]" {
+		t.Errorf("restarted %v, want [2]", started)
+	}
+}
+
+func TestConnTuner_FollowsPoolLimit(t *testing.T) {
+	tuner := newFixedTuner(8)
+	var started []int
+	start := func(id int) { started = append(started, id) }
+
+	tuner.setLimit(3)
+	tuner.fill(start)
+	if fmt.Sprint(started) != "[0 1 2]" {
+		t.Fatalf("started %v under a limit of 3", started)
+	}
+	if n := tuner.step(types.MB, time.Second, 1<<40); n != 8 {
+		t.Errorf("fixed tuner stepped to %d, want its 8", n)
+	}
+
+	// Lowering the limit retires workers; raising it starts them again
+	if tuner.setLimit(2) || tuner.keep(2) || !tuner.keep(1) {
+		t.Error("worker 2 should be retired under a limit of 2")
+	}
+	started = nil
+	if !tuner.setLimit(0) {
+		t.Error("removing the limit should let more workers run")
+	}
+	tuner.fill(start)
+	if fmt.Sprint(started) != "[2 3 4 5 6 7]" {
+		t.Errorf("started %v without a limit, want [2 3 4 5 6 7]", started)
+	}
+
+	// An adaptive tuner drops to the limit and grows no further
+	adaptive := newConnTuner(8, 16)
+	adaptive.setLimit(4)
+	if n := adaptive.step(types.MB, time.Second, 1<<40); n != 4 {
+		t.Errorf("adaptive tuner stepped to %d under a limit of 4", n)
+	}
+}
+
+func TestIsThrottle(t *testing.T) {
+	for code, want := range map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusForbidden:           false,
+		http.StatusInternalServerError: false,
+	} {
+		err := fmt.Errorf("task: %w", &types.HTTPError{StatusCode: code})
+		if got := isThrottle(err); got != want {
+			t.Errorf("isThrottle(%d) = %v, want %v", code, got, want)
+		}
+	}
+	if isThrottle(nil) {
+		t.Error("isThrottle(nil) = true")
+	}
+}
+
+func TestConcurrentDownloader_Adaptive(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := make([]byte, 4*types.MB)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	var active, peak atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "adaptive.bin")
+	state := types.NewProgressState("adaptive-test", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 16,
+		AdaptiveConnections:   true,
+		MinChunkSize:          64 * types.KB,
+	}
+	downloader := NewConcurrentDownloader("adaptive-id", nil, state, runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs")
+	}
+	// A download this short is over before the first step, so it never
+	// opens more than it started with
+	if p := peak.Load(); p > types.AdaptiveStartConnections {
+		t.Errorf("peak of %d connections, want at most %d", p, types.AdaptiveStartConnections)
+	}
+}
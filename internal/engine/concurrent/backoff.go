@@ -0,0 +1,44 @@
+package concurrent
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// backoffDelay returns the wait before retry round n (1 for the first):
+// base doubled for each further round, capped at maxDelay, then moved by up to
+// jitter times itself in either direction. rnd returns a value in [0, 1).
+func backoffDelay(n int, base, maxDelay time.Duration, jitter float64, rnd func() float64) time.Duration {
+	delay := maxDelay
+	if shift := n - 1; shift < 32 && base<<shift > 0 && base<<shift < maxDelay {
+		delay = base << shift
+	}
+	if jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + jitter*(2*rnd()-1)))
+	}
+	return delay
+}
+
+// sleepCtx waits for d, returning early with false if ctx is cancelled
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryBackoff waits before retry attempt of a task spread over numMirrors
+// mirrors. A failover to a mirror not yet tried this round goes ahead at
+// once; only coming back around to the same mirror waits, longer each round.
+func (d *ConcurrentDownloader) retryBackoff(ctx context.Context, attempt, numMirrors int) bool {
+	if attempt%numMirrors != 0 {
+		return true
+	}
+	r := d.Runtime
+	return sleepCtx(ctx, backoffDelay(attempt/numMirrors, r.GetRetryBaseDelay(), r.GetRetryMaxDelay(), r.GetRetryJitter(), rand.Float64))
+}
@@ -0,0 +1,48 @@
+package concurrent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	const base, maxDelay = 100 * time.Millisecond, time.Second
+	mid := func() float64 { return 0.5 } // No jitter either way
+
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second}, // Capped
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoffDelay(tt.n, base, maxDelay, 0.5, mid); got != tt.want {
+			t.Errorf("backoffDelay(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+
+	// Jitter moves the delay by up to the fraction in either direction
+	if got := backoffDelay(2, base, maxDelay, 0.5, func() float64 { return 0 }); got != 100*time.Millisecond {
+		t.Errorf("lowest jittered delay = %v, want 100ms", got)
+	}
+	if got := backoffDelay(2, base, maxDelay, 0.5, func() float64 { return 0.99 }); got < 290*time.Millisecond || got > 300*time.Millisecond {
+		t.Errorf("highest jittered delay = %v, want just under 300ms", got)
+	}
+}
+
+func TestSleepCtx_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if sleepCtx(ctx, time.Minute) {
+		t.Error("sleepCtx() should report cancellation")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("sleepCtx() did not return on cancellation")
+	}
+}
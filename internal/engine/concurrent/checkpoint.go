@@ -0,0 +1,132 @@
+package concurrent
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// remainingTasks returns the byte ranges not yet written: the queued tasks
+// plus what is left of each worker's claimed one. A range moving between
+// the queue and a worker may show up in both; merging counts it once.
+func (d *ConcurrentDownloader) remainingTasks(queue *TaskQueue) []types.Task {
+	d.activeMu.Lock()
+	defer d.activeMu.Unlock()
+
+	tasks, claims := queue.Snapshot()
+	for worker, claim := range claims {
+		start, end := claim.Offset, claim.Offset+claim.Length
+		// The claim's end, not the active task's StopAt: a stolen tail is
+		// only pushed to the queue after StopAt moves
+		if active, ok := d.activeTasks[worker]; ok {
+			start = max(start, atomic.LoadInt64(&active.CurrentOffset))
+		}
+		if start < end {
+			tasks = append(tasks, types.Task{Offset: start, Length: end - start})
+		}
+	}
+	return mergeTasks(tasks)
+}
+
+// mergeTasks sorts tasks and joins the ones that overlap or touch
+func mergeTasks(tasks []types.Task) []types.Task {
+	if len(tasks) == 0 {
+		return nil
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Offset < tasks[j].Offset })
+	merged := []types.Task{tasks[0]}
+	for _, t := range tasks[1:] {
+		last := &merged[len(merged)-1]
+		if t.Offset <= last.Offset+last.Length {
+			last.Length = max(last.Length, t.Offset+t.Length-last.Offset)
+			continue
+		}
+		merged = append(merged, t)
+	}
+	return merged
+}
+
+// tasksLength returns the number of bytes tasks cover
+func tasksLength(tasks []types.Task) int64 {
+	var n int64
+	for _, task := range tasks {
+		n += task.Length
+	}
+	return n
+}
+
+// saveResumeState records the ranges still to download so a later run can
+// continue from them
+func (d *ConcurrentDownloader) saveResumeState(destPath string, fileSize, downloaded int64, remaining []types.Task, elapsed time.Duration, mirrors []string) error {
+	var chunkBitmap []byte
+	var actualChunkSize int64
+	if d.State != nil {
+		elapsed += d.State.SavedElapsed
+		chunkBitmap, _, _, actualChunkSize, _ = d.State.GetBitmap()
+	}
+
+	return state.SaveState(d.URL, destPath, &types.DownloadState{
+		URL:             d.URL,
+		ID:              d.ID,
+		DestPath:        destPath,
+		TotalSize:       fileSize,
+		Downloaded:      downloaded,
+		Tasks:           remaining,
+		Filename:        filepath.Base(destPath),
+		Elapsed:         elapsed.Nanoseconds(),
+		Mirrors:         mirrors,
+		ChunkBitmap:     chunkBitmap,
+		ActualChunkSize: actualChunkSize,
+		ETag:            d.ETag,
+		LastModified:    d.LastModified,
+		RequestSettings: d.Settings,
+	})
+}
+
+// checkpoint saves resume state every checkpoint interval until ctx ends, so
+// a crash or power loss costs at most that much progress. Data is flushed to
+// disk before the state claiming it is written.
+func (d *ConcurrentDownloader) checkpoint(ctx context.Context, queue *TaskQueue, file output, destPath string, fileSize int64, startTime time.Time, mirrors []string) {
+	ticker := time.NewTicker(d.Runtime.GetCheckpointInterval())
+	defer ticker.Stop()
+
+	lastRemaining := int64(-1)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		remaining := d.remainingTasks(queue)
+		remainingBytes := tasksLength(remaining)
+		if remainingBytes == lastRemaining || remainingBytes == 0 {
+			continue // Nothing new, or about to complete
+		}
+		if err := file.Sync(); err != nil {
+			utils.Debug("Checkpoint skipped: failed to sync %s: %v", destPath, err)
+			continue
+		}
+		if err := d.saveResumeState(destPath, fileSize, fileSize-remainingBytes, remaining, time.Since(startTime), mirrors); err != nil {
+			utils.Debug("Checkpoint failed for %s: %v", destPath, err)
+			continue
+		}
+		lastRemaining = remainingBytes
+	}
+}
+
+// validatorsChanged reports whether saved resume state came from a different
+// version of the file than the server now has. Validators missing on either
+// side are not compared.
+func validatorsChanged(saved *types.DownloadState, etag, lastModified string) bool {
+	if saved.ETag != "" && etag != "" && saved.ETag != etag {
+		return true
+	}
+	return saved.LastModified != "" && lastModified != "" && saved.LastModified != lastModified
+}
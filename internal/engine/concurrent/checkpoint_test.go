@@ -0,0 +1,84 @@
+package concurrent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestMergeTasks(t *testing.T) {
+	got := mergeTasks([]types.Task{
+		{Offset: 300, Length: 100},
+		{Offset: 0, Length: 100},
+		{Offset: 50, Length: 100}, // Overlaps the first
+		{Offset: 150, Length: 50}, // Touches it
+		{Offset: 320, Length: 10}, // Inside another
+	})
+	want := []types.Task{{Offset: 0, Length: 200}, {Offset: 300, Length: 100}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeTasks() = %v, want %v", got, want)
+	}
+	if got := mergeTasks(nil); got != nil {
+		t.Errorf("mergeTasks(nil) = %v, want nil", got)
+	}
+}
+
+func TestRemainingTasks_CountsClaimedWork(t *testing.T) {
+	d := NewConcurrentDownloader("id", nil, nil, &types.RuntimeConfig{})
+	q := NewTaskQueue()
+	q.PushMultiple([]types.Task{
+		{Offset: 0, Length: 1000},
+		{Offset: 1000, Length: 1000},
+		{Offset: 2000, Length: 1000},
+	})
+
+	// Worker 0 has its task registered and is 400 bytes in
+	task, _ := q.Claim(0)
+	d.activeTasks[0] = &ActiveTask{Task: task, CurrentOffset: 400, StopAt: 1000}
+
+	// Worker 1 took a task but has not registered it yet. Without claims
+	// the range would be in neither the queue nor the active tasks.
+	q.Claim(1)
+
+	want := []types.Task{{Offset: 400, Length: 2600}}
+	if got := d.remainingTasks(q); !reflect.DeepEqual(got, want) {
+		t.Errorf("remainingTasks() = %v, want %v", got, want)
+	}
+
+	// A stolen tail is only pushed after StopAt moves; the claim still covers it
+	d.activeTasks[0].StopAt = 600
+	if got := d.remainingTasks(q); !reflect.DeepEqual(got, want) {
+		t.Errorf("remainingTasks() mid-steal = %v, want %v", got, want)
+	}
+
+	// Finished work disappears once released
+	delete(d.activeTasks, 0)
+	q.Release(0)
+	want = []types.Task{{Offset: 1000, Length: 2000}}
+	if got := d.remainingTasks(q); !reflect.DeepEqual(got, want) {
+		t.Errorf("remainingTasks() after release = %v, want %v", got, want)
+	}
+}
+
+func TestValidatorsChanged(t *testing.T) {
+	saved := &types.DownloadState{ETag: `"v1"`, LastModified: "Mon, 01 Jan 2024 00:00:00 GMT"}
+	tests := []struct {
+		name         string
+		etag, lastMo string
+		want         bool
+	}{
+		{"same", `"v1"`, "Mon, 01 Jan 2024 00:00:00 GMT", false},
+		{"new etag", `"v2"`, "Mon, 01 Jan 2024 00:00:00 GMT", true},
+		{"new date", `"v1"`, "Tue, 02 Jan 2024 00:00:00 GMT", true},
+		{"server stopped sending them", "", "", false},
+	}
+	for _, tt := range tests {
+		if got := validatorsChanged(saved, tt.etag, tt.lastMo); got != tt.want {
+			t.Errorf("%s: validatorsChanged() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if validatorsChanged(&types.DownloadState{}, `"v1"`, "") {
+		t.Error("state saved without validators should not count as changed")
+	}
+}
@@ -1,11 +1,23 @@
 package concurrent
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/testutil"
@@ -60,6 +72,243 @@ func TestConcurrentDownloader_Download(t *testing.T) {
 	}
 }
 
+func TestConcurrentDownloader_ThroughProxy(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	// The proxy answers for files.example itself, so the download can only
+	// succeed by going through it, with the credentials in the proxy URL
+	content := testContent(512*types.KB, 3)
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != wantAuth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		if r.URL.Host != "files.example" {
+			http.Error(w, "unexpected host "+r.URL.Host, http.StatusBadGateway)
+			return
+		}
+		proxied.Add(1)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer proxy.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "proxied.bin")
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 4,
+		MinChunkSize:          64 * types.KB,
+		Proxy:                 "http://user:secret@" + strings.TrimPrefix(proxy.URL, "http://"),
+	}
+	d := NewConcurrentDownloader("proxy-id", nil, types.NewProgressState("proxy-id", fileSize), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, "http://files.example/file.bin", nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs")
+	}
+	if proxied.Load() == 0 {
+		t.Error("no request went through the proxy")
+	}
+}
+
+func TestConcurrentDownloader_HeadersOnEveryRequest(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := testContent(512*types.KB, 4)
+	var ranged, refused atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Api-Key") != "k" {
+			refused.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			ranged.Add(1)
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "authed.bin")
+	runtime := (&types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 64 * types.KB}).WithHeaders(http.Header{
+		"Authorization": {"Bearer secret"},
+		"X-Api-Key":     {"k"},
+	})
+	d := NewConcurrentDownloader("auth-id", nil, types.NewProgressState("auth-id", fileSize), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs")
+	}
+	if refused.Load() != 0 {
+		t.Errorf("%d requests went without the headers", refused.Load())
+	}
+	if ranged.Load() < 2 {
+		t.Errorf("%d range requests, want the file split across several", ranged.Load())
+	}
+}
+
+func TestConcurrentDownloader_RangeDigest(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := testContent(512*types.KB, 4)
+	var requests, corrupted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+			return
+		}
+		requests.Add(1)
+		body := bytes.Clone(content[start : end+1])
+		sum := sha256.Sum256(body)
+		w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		if start > 0 && corrupted.CompareAndSwap(0, 1) {
+			body[0] ^= 0xff // Damaged on the way, once
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "digest.bin")
+	// One connection, so no range is cut short by a steal before its digest
+	// can be checked
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 1, MinChunkSize: 64 * types.KB}
+	st := types.NewProgressState("digest-id", fileSize)
+	d := NewConcurrentDownloader("digest-id", nil, st, runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("a range that failed its digest was kept")
+	}
+	if corrupted.Load() != 1 {
+		t.Fatal("no range was corrupted")
+	}
+	if st.Retries.Load() == 0 {
+		t.Error("the corrupted range was not fetched again")
+	}
+	if downloaded := st.Downloaded.Load(); downloaded != fileSize {
+		t.Errorf("Downloaded = %d, want %d", downloaded, fileSize)
+	}
+}
+
+func TestConcurrentDownloader_Cookies(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := testContent(512*types.KB, 5)
+	var refused atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "s3cret" {
+			refused.Add(1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "cookie.bin")
+	host := strings.TrimPrefix(server.URL, "http://")
+	host, _, _ = strings.Cut(host, ":")
+	runtime := (&types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 64 * types.KB}).WithCookies([]*http.Cookie{
+		{Name: "session", Value: "s3cret", Domain: host, Path: "/"},
+	})
+	d := NewConcurrentDownloader("cookie-id", nil, types.NewProgressState("cookie-id", fileSize), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs")
+	}
+	if refused.Load() != 0 {
+		t.Errorf("%d requests went without the cookie", refused.Load())
+	}
+}
+
+func TestConcurrentDownloader_CookieSetByRedirect(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := testContent(512*types.KB, 6)
+	var refused atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.SetCookie(w, &http.Cookie{Name: "gate", Value: "ok", Path: "/"})
+			http.Redirect(w, r, "/file.bin", http.StatusFound)
+			return
+		}
+		if c, err := r.Cookie("gate"); err != nil || c.Value != "ok" {
+			refused.Add(1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "gated.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 64 * types.KB}
+	d := NewConcurrentDownloader("gate-id", nil, types.NewProgressState("gate-id", fileSize), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL+"/start", nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs")
+	}
+	if refused.Load() != 0 {
+		t.Errorf("%d requests went without the cookie the redirect set", refused.Load())
+	}
+}
+
 // =============================================================================
 // Advanced Integration Tests - Latency & Timeouts
 // =============================================================================
@@ -409,6 +658,18 @@ func TestConcurrentDownloader_ProgressTracking(t *testing.T) {
 	if finalDownloaded != fileSize {
 		t.Errorf("Final downloaded %d != file size %d", finalDownloaded, fileSize)
 	}
+
+	// Every byte is accounted to the connection that fetched it
+	var fetched int64
+	for _, c := range state.ConnectionStats() {
+		fetched += c.Bytes
+		if c.Responses == 0 || c.AverageTTFB() <= 0 || c.Busy <= 0 {
+			t.Errorf("connection %d has no timings: %+v", c.Worker, c)
+		}
+	}
+	if fetched != fileSize {
+		t.Errorf("connections fetched %d bytes, want %d", fetched, fileSize)
+	}
 }
 
 func TestConcurrentDownloader_RetryOnFailure(t *testing.T) {
@@ -642,6 +903,60 @@ func TestCreateTasks_ExactDivision(t *testing.T) {
 	}
 }
 
+func TestCreateTasks_Past4GiB(t *testing.T) {
+	fileSize := int64(4<<30 + 1)
+	chunkSize := int64(16 * types.MB)
+
+	tasks := createTasks(fileSize, chunkSize)
+
+	if len(tasks) != 257 {
+		t.Fatalf("Expected 257 tasks, got %d", len(tasks))
+	}
+	last := tasks[len(tasks)-1]
+	if last.Offset != 4<<30 || last.Length != 1 {
+		t.Errorf("Last task = %+v, want the single byte past 4 GiB", last)
+	}
+}
+
+func TestCreateTasks_NearInt64Limit(t *testing.T) {
+	// offset+chunkSize overflows here; the tasks must still tile the file
+	fileSize := int64(math.MaxInt64)
+	chunkSize := int64(math.MaxInt64/3 + 1)
+
+	tasks := createTasks(fileSize, chunkSize)
+
+	if len(tasks) != 3 {
+		t.Fatalf("Expected 3 tasks, got %d", len(tasks))
+	}
+	var next int64
+	for i, task := range tasks {
+		if task.Offset != next || task.Length <= 0 {
+			t.Errorf("Task %d = %+v, want offset %d", i, task, next)
+		}
+		next = task.Offset + task.Length
+	}
+	if next != fileSize {
+		t.Errorf("Tasks end at %d, want %d", next, fileSize)
+	}
+}
+
+func TestCalculateChunkSize_CapsChunkCount(t *testing.T) {
+	d := NewConcurrentDownloader("id", nil, nil, &types.RuntimeConfig{})
+
+	for _, fileSize := range []int64{4 << 30, 1 << 50, math.MaxInt64} {
+		chunkSize := d.calculateChunkSize(fileSize, 32)
+		if chunkSize <= 0 || chunkSize%types.AlignSize != 0 {
+			t.Errorf("size %d: chunk size %d is not a positive multiple of %d", fileSize, chunkSize, types.AlignSize)
+		}
+		if n := types.ChunkCount(fileSize, chunkSize); n > types.MaxChunks {
+			t.Errorf("size %d: %d chunks, want at most %d", fileSize, n, types.MaxChunks)
+		}
+	}
+	if got := d.calculateChunkSize(4<<30, 32); got != types.MaxChunk {
+		t.Errorf("4 GiB file: chunk size %d, want the usual %d", got, types.MaxChunk)
+	}
+}
+
 func TestCreateTasks_ZeroChunkSize(t *testing.T) {
 	tasks := createTasks(1000, 0)
 	if tasks != nil {
@@ -653,3 +968,65 @@ func TestCreateTasks_ZeroChunkSize(t *testing.T) {
 		t.Error("createTasks should return nil for negative chunk size")
 	}
 }
+
+func TestConcurrentDownloader_SourceChangedMidDownload(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(256 * types.KB)
+	oldData := bytes.Repeat([]byte("a"), int(fileSize))
+	newData := bytes.Repeat([]byte("b"), int(fileSize))
+	var requests, conditional atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Range") == `"v1"` {
+			conditional.Add(1)
+		}
+		// The file is replaced after the first two ranges
+		data, etag := oldData, `"v1"`
+		if requests.Add(1) > 2 {
+			data, etag = newData, `"v2"`
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "changed.bin")
+	progState := types.NewProgressState("changed-id", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 1,
+		MinChunkSize:          64 * types.KB,
+		MaxChunkSize:          64 * types.KB,
+		TargetChunkSize:       64 * types.KB,
+	}
+	progressCh := make(chan any, 16)
+	downloader := NewConcurrentDownloader("changed-id", progressCh, progState, runtime)
+	downloader.ETag = `"v1"`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize, false)
+	if !errors.Is(err, types.ErrSourceChanged) {
+		t.Fatalf("Download() = %v, want ErrSourceChanged", err)
+	}
+	if conditional.Load() == 0 {
+		t.Error("ranged requests carried no If-Range")
+	}
+	if _, statErr := os.Stat(destPath); statErr == nil {
+		t.Error("a download stitched from two versions was completed")
+	}
+	if saved, _ := state.LoadState(server.URL, destPath); saved != nil {
+		t.Error("resume state of the old version was kept")
+	}
+
+	warned := false
+	for len(progressCh) > 0 {
+		if msg, ok := (<-progressCh).(events.DownloadWarningMsg); ok && strings.Contains(msg.Message, "source changed") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("no source changed warning was sent")
+	}
+}
@@ -0,0 +1,167 @@
+package concurrent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// destProfile is what a quick benchmark learned about a destination folder
+type destProfile struct {
+	WriteSpeed    float64 // Sequential bytes/sec, 0 if the benchmark failed
+	ScatteredSlow bool    // Scattered writes took WriteBenchRatio times as long as sequential ones
+}
+
+// destProfiles caches a destProfile per folder, so only the first download
+// there pays for the benchmark
+var destProfiles sync.Map
+
+// probeDestination benchmarks writes into dir, once per process. A failed
+// benchmark gives no speed.
+func probeDestination(dir string) destProfile {
+	if p, ok := destProfiles.Load(dir); ok {
+		return p.(destProfile)
+	}
+
+	var profile destProfile
+	scattered, sequential, err := benchmarkWrites(dir, types.WriteBenchSize)
+	if err != nil {
+		utils.Debug("Write benchmark of %s failed: %v", dir, err)
+	} else {
+		profile.WriteSpeed = float64(types.WriteBenchSize) / max(sequential.Seconds(), 1e-6)
+		profile.ScatteredSlow = scattered.Seconds() > sequential.Seconds()*types.WriteBenchRatio
+		utils.Debug("Write benchmark of %s: scattered %v, sequential %v (%.1f MB/s)",
+			dir, scattered, sequential, profile.WriteSpeed/types.Megabyte)
+	}
+	destProfiles.Store(dir, profile)
+	return profile
+}
+
+// writeStrategy returns the configured strategy or, if the configuration
+// says WriteAuto, the one profile calls for. Auto picks WriteParts where
+// scattered writes are slow, but only if dir has room for a file of
+// fileSize twice over, as the parts take until they are merged; otherwise
+// it writes in place with WriteSingle.
+func writeStrategy(profile destProfile, rt *types.RuntimeConfig, dir string, fileSize int64) string {
+	if s := rt.GetWriteStrategy(); s != types.WriteAuto {
+		return s
+	}
+	if profile.ScatteredSlow && checkFreeSpace(dir, 2*fileSize) == nil {
+		return types.WriteParts
+	}
+	return types.WriteSingle
+}
+
+// benchmarkWrites times writing size bytes into dir in blocks at scattered
+// offsets of one preallocated file, as concurrent workers do, and the same
+// blocks in order into another file. Both are synced, so the page cache
+// doesn't hide the disk.
+func benchmarkWrites(dir string, size int64) (scattered, sequential time.Duration, err error) {
+	bench, err := os.MkdirTemp(utils.LongPath(dir), ".surge-bench-")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.RemoveAll(bench)
+
+	const blocks = 8
+	block := make([]byte, size/blocks)
+
+	timeWrites := func(name string, offset func(i int64) int64) (time.Duration, error) {
+		start := time.Now()
+		f, err := os.Create(filepath.Join(bench, name))
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		if err := f.Truncate(size); err != nil {
+			return 0, err
+		}
+		for i := range int64(blocks) {
+			if _, err := f.WriteAt(block, offset(i)*int64(len(block))); err != nil {
+				return 0, err
+			}
+		}
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+		return time.Since(start), nil
+	}
+
+	// Interleaved like the chunks of concurrent workers
+	if scattered, err = timeWrites("scattered", func(i int64) int64 { return i%2*blocks/2 + i/2 }); err != nil {
+		return 0, 0, err
+	}
+	if sequential, err = timeWrites("sequential", func(i int64) int64 { return i }); err != nil {
+		return 0, 0, err
+	}
+	return scattered, sequential, nil
+}
+
+// diskWatch tells from the download speed whether the destination's write
+// speed has become the limit
+type diskWatch struct {
+	writeSpeed float64
+	streak     int  // Checks in a row at the disk's speed
+	warned     bool // Only warn once per download
+}
+
+// observe records the speed over one check and reports true the first time
+// the download has run at DiskBoundShare of the write speed for
+// DiskBoundChecks checks in a row
+func (w *diskWatch) observe(speed float64) bool {
+	if w.warned || w.writeSpeed <= 0 {
+		return false
+	}
+	if speed < w.writeSpeed*types.DiskBoundShare {
+		w.streak = 0
+		return false
+	}
+	w.streak++
+	w.warned = w.streak >= types.DiskBoundChecks
+	return w.warned
+}
+
+// watchDisk warns once if the download keeps pace with the write speed of
+// its destination folder dir, since the disk rather than the network is
+// then what holds it back
+func (d *ConcurrentDownloader) watchDisk(ctx context.Context, dir string, writeSpeed float64) {
+	ticker := time.NewTicker(types.HealthCheckInterval)
+	defer ticker.Stop()
+
+	w := diskWatch{writeSpeed: writeSpeed}
+	last, lastTime := d.State.Downloaded.Load(), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			downloaded := d.State.Downloaded.Load()
+			speed := float64(downloaded-last) / max(now.Sub(lastTime).Seconds(), 0.001)
+			last, lastTime = downloaded, now
+			if w.observe(speed) {
+				d.warn(ctx, fmt.Sprintf("limited by the disk: downloading at %.1f MB/s and %s takes writes at about %.1f MB/s",
+					speed/types.Megabyte, dir, writeSpeed/types.Megabyte))
+				return
+			}
+		}
+	}
+}
+
+// warn reports a problem that doesn't stop the download
+func (d *ConcurrentDownloader) warn(ctx context.Context, message string) {
+	utils.Debug("Download %s: %s", d.ID, message)
+	if d.ProgressChan == nil {
+		return
+	}
+	select {
+	case d.ProgressChan <- events.DownloadWarningMsg{DownloadID: d.ID, Filename: filepath.Base(d.DestPath), Message: message}:
+	case <-ctx.Done():
+	}
+}
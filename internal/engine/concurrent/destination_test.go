@@ -0,0 +1,100 @@
+package concurrent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestProbeDestination(t *testing.T) {
+	dir := t.TempDir()
+	profile := probeDestination(dir)
+	if profile.WriteSpeed <= 0 {
+		t.Errorf("no write speed measured for a writable folder: %+v", profile)
+	}
+	if cached, _ := destProfiles.Load(dir); cached != profile {
+		t.Errorf("profile not remembered: %v", cached)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("benchmark left %d entries behind", len(entries))
+	}
+
+	missing := probeDestination(dir + "/missing")
+	if missing.ScatteredSlow || missing.WriteSpeed != 0 {
+		t.Errorf("failed benchmark gave %+v, want no speed", missing)
+	}
+}
+
+func TestWriteStrategy(t *testing.T) {
+	dir := t.TempDir()
+	slow := destProfile{ScatteredSlow: true}
+	for configured, want := range map[string]string{
+		"":                types.WriteParts,
+		types.WriteAuto:   types.WriteParts,
+		"bogus":           types.WriteParts,
+		types.WriteSingle: types.WriteSingle,
+		types.WriteParts:  types.WriteParts,
+		types.WriteMmap:   types.WriteMmap,
+	} {
+		if got := writeStrategy(slow, &types.RuntimeConfig{WriteStrategy: configured}, dir, types.MB); got != want {
+			t.Errorf("configured %q: got %s, want %s", configured, got, want)
+		}
+	}
+
+	auto := &types.RuntimeConfig{WriteStrategy: types.WriteAuto}
+	if got := writeStrategy(destProfile{}, auto, dir, types.MB); got != types.WriteSingle {
+		t.Errorf("auto where scattered writes are fast: got %s", got)
+	}
+	// No disk holds the parts and their merged copy of a file this large
+	if got := writeStrategy(slow, auto, dir, 1<<61); got != types.WriteSingle {
+		t.Errorf("auto without room for two copies: got %s", got)
+	}
+	if got := writeStrategy(slow, &types.RuntimeConfig{WriteStrategy: types.WriteParts}, dir, 1<<61); got != types.WriteParts {
+		t.Errorf("configured parts without room: got %s", got)
+	}
+}
+
+func TestDiskWatch(t *testing.T) {
+	w := diskWatch{writeSpeed: 100 * types.MB}
+	fast := 90.0 * types.MB
+	for i := range types.DiskBoundChecks - 1 {
+		if w.observe(fast) {
+			t.Fatalf("warned after %d checks", i+1)
+		}
+	}
+	// A dip below the disk's speed starts the count over
+	if w.observe(10 * types.MB) {
+		t.Fatal("warned on a slow check")
+	}
+	for range types.DiskBoundChecks - 1 {
+		w.observe(fast)
+	}
+	if !w.observe(fast) {
+		t.Fatalf("no warning after %d checks at the disk's speed", types.DiskBoundChecks)
+	}
+	for range types.DiskBoundChecks {
+		if w.observe(fast) {
+			t.Fatal("warned twice")
+		}
+	}
+
+	unknown := diskWatch{}
+	for range types.DiskBoundChecks {
+		if unknown.observe(fast) {
+			t.Fatal("warned without a write speed")
+		}
+	}
+}
+
+func TestCalculateChunkSize_SlowDisk(t *testing.T) {
+	d := NewConcurrentDownloader("slow", nil, nil, &types.RuntimeConfig{})
+	fileSize := int64(256 * types.MB)
+	if got, want := d.calculateChunkSize(fileSize, 8), int64(8*types.MB); got != want {
+		t.Fatalf("chunk size %d, want %d", got, want)
+	}
+	d.slowDisk = true
+	if got, want := d.calculateChunkSize(fileSize, 8), int64(types.MaxChunk); got != want {
+		t.Errorf("slow disk: chunk size %d, want one chunk per connection capped at %d", got, want)
+	}
+}
@@ -3,19 +3,34 @@ package concurrent
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/platform"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
+// sourceChangedWarning is reported when the file on the server is no longer
+// the one the download started on
+const sourceChangedWarning = "source changed on the server, restarting from the start"
+
+// scatteredWritesWarning is reported when the auto write strategy writes in
+// place to a folder where the benchmark found scattered writes slow, because
+// there is no room for part files and their merged copy
+const scatteredWritesWarning = "scattered writes are slow in this folder, but it lacks the room for part files, which take twice the file's size while merging"
+
 // ConcurrentDownloader handles multi-connection downloads
 type ConcurrentDownloader struct {
 	ProgressChan chan<- any           // Channel for events (start/complete/error)
@@ -27,6 +42,31 @@ type ConcurrentDownloader struct {
 	DestPath     string // For pause/resume
 	Runtime      *types.RuntimeConfig
 	bufPool      sync.Pool
+
+	// SingleStream downloads the whole body over one connection without Range
+	// requests. It is used for servers that don't support ranges or don't report
+	// a size: work is never split or stolen, and a retry restarts from byte 0.
+	SingleStream bool
+
+	// ETag and LastModified are the validators from the probe. They are
+	// saved with resume state, and a resume whose saved validators differ
+	// starts over.
+	ETag         string
+	LastModified string
+
+	// Settings are saved with resume state, for a resumed download to be
+	// requested and checked as this one
+	Settings types.RequestSettings
+
+	// SHA256 is the hex SHA-256 of the completed file when it was hashed
+	// while merging part files, empty otherwise
+	SHA256 string
+
+	// slowDisk is set when the destination writes slower than SlowDiskSpeed
+	slowDisk bool
+
+	// tuner adjusts the worker count of an adaptive download, nil otherwise
+	tuner *connTuner
 }
 
 // NewConcurrentDownloader creates a new concurrent downloader with all required parameters
@@ -70,6 +110,30 @@ func (d *ConcurrentDownloader) getInitialConnections(fileSize int64) int {
 	return recConns
 }
 
+// planConnections returns how many workers a download starts with and the
+// most it may run. A download with progress state gets a tuner, so it
+// follows the pool's connection limit. An adaptive one is sized for the most
+// connections it may grow to, but starts with a few.
+func (d *ConcurrentDownloader) planConnections(fileSize int64) (numConns, maxConns int) {
+	d.tuner = nil
+	if d.SingleStream {
+		return 1, 1
+	}
+	numConns = d.getInitialConnections(fileSize)
+	if d.State == nil {
+		return numConns, numConns
+	}
+	if d.Runtime != nil && d.Runtime.AdaptiveConnections {
+		maxConns = d.Runtime.GetMaxConnectionsPerHost()
+		d.tuner = newConnTuner(types.AdaptiveStartConnections, maxConns)
+	} else {
+		maxConns = numConns
+		d.tuner = newFixedTuner(numConns)
+	}
+	d.tuner.setLimit(int(d.State.ConnLimit.Load()))
+	return d.tuner.current(), maxConns
+}
+
 // ReportMirrorError marks a mirror as having an error in the state
 func (d *ConcurrentDownloader) ReportMirrorError(url string) {
 	if d.State == nil {
@@ -91,9 +155,34 @@ func (d *ConcurrentDownloader) ReportMirrorError(url string) {
 	}
 }
 
+// failMirror records a failure of mirror i, marking it in the state and,
+// once it is dropped, as no longer active
+func (d *ConcurrentDownloader) failMirror(mirrors *mirrorPool, i int) {
+	url := mirrors.url(i)
+	d.ReportMirrorError(url)
+	if !mirrors.fail(i) {
+		return
+	}
+	utils.Debug("Dropping mirror %s after %d failures in a row", url, types.MirrorMaxFailures)
+	if d.State == nil {
+		return
+	}
+	statuses := d.State.GetMirrors()
+	for j := range statuses {
+		if statuses[j].URL == url {
+			statuses[j].Active = false
+		}
+	}
+	d.State.SetMirrors(statuses)
+}
+
 // calculateChunkSize determines optimal chunk size
 func (d *ConcurrentDownloader) calculateChunkSize(fileSize int64, numConns int) int64 {
-	targetChunks := int64(numConns * types.TasksPerWorker)
+	tasksPerWorker := types.TasksPerWorker
+	if d.slowDisk {
+		tasksPerWorker = 1
+	}
+	targetChunks := int64(numConns * tasksPerWorker)
 	chunkSize := fileSize / targetChunks
 
 	// Clamp to min/max from config
@@ -113,6 +202,11 @@ func (d *ConcurrentDownloader) calculateChunkSize(fileSize int64, numConns int)
 		chunkSize = maxChunk
 	}
 
+	// Files too large for MaxChunks chunks of that size get bigger chunks
+	if types.ChunkCount(fileSize, chunkSize) > types.MaxChunks {
+		chunkSize = types.ChunkCount(fileSize, types.MaxChunks) + types.AlignSize - 1
+	}
+
 	// Align to 4KB
 	chunkSize = (chunkSize / types.AlignSize) * types.AlignSize
 	if chunkSize == 0 {
@@ -128,25 +222,30 @@ func createTasks(fileSize, chunkSize int64) []types.Task {
 		return nil
 	}
 	var tasks []types.Task
+	// offset+chunkSize could overflow for files near the int64 limit, so
+	// the remaining length is compared instead
 	for offset := int64(0); offset < fileSize; offset += chunkSize {
-		length := chunkSize
-		if offset+length > fileSize {
-			length = fileSize - offset
-		}
+		length := min(chunkSize, fileSize-offset)
 		tasks = append(tasks, types.Task{Offset: offset, Length: length})
+		if fileSize-offset <= chunkSize {
+			break
+		}
 	}
 	return tasks
 }
 
 // newConcurrentClient creates an http.Client tuned for concurrent downloads
 func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
-	// Ensure we have enough connections per host
-	maxConns := d.Runtime.GetMaxConnectionsPerHost()
-	if numConns > maxConns {
-		maxConns = numConns
+	// The transport holds the download to its worker count, so a retry or a
+	// replaced connection can never push it past the per-host limit
+	maxConns := min(numConns, d.Runtime.GetMaxConnectionsPerHost())
+	if maxConns < 1 {
+		maxConns = 1
 	}
 
 	transport := &http.Transport{
+		Proxy: d.Runtime.ProxyFunc(),
+
 		// Connection pooling
 		MaxIdleConns:        types.DefaultMaxIdleConns,
 		MaxIdleConnsPerHost: maxConns + 2, // Slightly more than max to handle bursts
@@ -167,19 +266,42 @@ func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
 		DialContext: (&net.Dialer{
 			Timeout:   types.DialTimeout,
 			KeepAlive: types.KeepAliveDuration,
+			Control:   d.Runtime.DialControl,
 		}).DialContext,
 	}
 
+	// Probes and other downloads of the same host count toward its cap too
 	return &http.Client{
-		Transport: transport,
+		Transport:     d.Runtime.LimitHosts(transport),
+		CheckRedirect: d.Runtime.CheckRedirect,
+		Jar:           d.Runtime.CookieJar(),
+	}
+}
+
+// singleStreamTask returns the one task covering the whole body.
+// When the size is unknown the task is open-ended and the worker reads until EOF.
+func singleStreamTask(fileSize int64) types.Task {
+	if fileSize <= 0 {
+		return types.Task{Offset: 0, Length: math.MaxInt64}
 	}
+	return types.Task{Offset: 0, Length: fileSize}
 }
 
 // Download downloads a file using multiple concurrent connections
 // Uses pre-probed metadata (file size already known)
+// A non-positive fileSize forces single-stream mode.
 func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, candidateMirrors []string, activeMirrors []string, destPath string, fileSize int64, verbose bool) error {
 	utils.Debug("ConcurrentDownloader.Download: %s -> %s (size: %d, mirrors: %d)", rawurl, destPath, fileSize, len(activeMirrors))
 
+	// Without a known size there is nothing to split, so fall back to one stream
+	if fileSize <= 0 {
+		d.SingleStream = true
+	}
+	if d.SingleStream {
+		// Mirrors can only be used with ranged requests
+		activeMirrors = nil
+	}
+
 	// Store URL and path for pause/resume (final path without .surge)
 	d.URL = rawurl
 	d.DestPath = destPath
@@ -211,7 +333,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	}
 
 	// Working file has .surge suffix until download completes
-	workingPath := destPath + types.IncompleteSuffix
+	workingPath := types.FindWorkingPath(destPath, d.ID, d.Runtime != nil && d.Runtime.PartFilesInSubdir)
+	if err := os.MkdirAll(utils.LongPath(filepath.Dir(workingPath)), 0755); err != nil {
+		return fmt.Errorf("failed to create part directory: %w", err)
+	}
 
 	// Create cancellable context for pause support
 	downloadCtx, cancel := context.WithCancel(ctx)
@@ -220,17 +345,26 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		d.State.CancelFunc = cancel
 	}
 
+	// Benchmark the destination before planning around it
+	destDir := filepath.Dir(workingPath)
+	profile := probeDestination(destDir)
+	d.slowDisk = profile.WriteSpeed > 0 && profile.WriteSpeed < types.SlowDiskSpeed
+
 	// Determine connections and chunk size
-	numConns := d.getInitialConnections(fileSize)
-	chunkSize := d.calculateChunkSize(fileSize, numConns)
+	numConns, maxConns := d.planConnections(fileSize)
+	chunkSize := d.calculateChunkSize(fileSize, maxConns)
 
 	// Create tuned HTTP client for concurrent downloads
-	client := d.newConcurrentClient(numConns)
+	client := d.newConcurrentClient(maxConns)
 
 	if verbose {
-		fmt.Printf("File size: %s, connections: %d, chunk size: %s\n",
+		conns := fmt.Sprint(numConns)
+		if d.tuner != nil && d.tuner.adaptive {
+			conns = fmt.Sprintf("adaptive, up to %d", maxConns)
+		}
+		fmt.Printf("File size: %s, connections: %s, chunk size: %s\n",
 			utils.ConvertBytesToHumanReadable(fileSize),
-			numConns,
+			conns,
 			utils.ConvertBytesToHumanReadable(chunkSize))
 	}
 
@@ -239,8 +373,12 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		d.State.InitBitmap(fileSize, chunkSize)
 	}
 
-	// Create and preallocate output file with .surge suffix
-	outFile, err := os.OpenFile(workingPath, os.O_CREATE|os.O_RDWR, 0644)
+	// Open the working file (or parts folder) with .surge suffix
+	strategy := writeStrategy(profile, d.Runtime, destDir, fileSize)
+	if profile.ScatteredSlow && !d.SingleStream && d.Runtime.GetWriteStrategy() == types.WriteAuto && strategy == types.WriteSingle {
+		d.warn(downloadCtx, scatteredWritesWarning)
+	}
+	outFile, err := d.openOutput(workingPath, fileSize, strategy)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
@@ -249,7 +387,28 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	// Check for saved state BEFORE truncating (resume case)
 	var tasks []types.Task
 	savedState, err := state.LoadState(rawurl, destPath)
-	isResume := err == nil && savedState != nil && len(savedState.Tasks) > 0
+	// Single-stream downloads can't continue from an offset, so saved tasks are ignored
+	isResume := !d.SingleStream && err == nil && savedState != nil && len(savedState.Tasks) > 0
+
+	if isResume && validatorsChanged(savedState, d.ETag, d.LastModified) {
+		utils.Debug("Resume validators changed (ETag %q -> %q, Last-Modified %q -> %q), restarting %s from scratch",
+			savedState.ETag, d.ETag, savedState.LastModified, d.LastModified, destPath)
+		isResume = false
+		d.warn(downloadCtx, sourceChangedWarning)
+	}
+
+	// Servers can replace a file without changing its size or validators, so
+	// re-fetch a little of what we already have before trusting it
+	if isResume {
+		changed, checkErr := d.resumeDataChanged(downloadCtx, client, rawurl, outFile, savedState.Tasks, fileSize)
+		if checkErr != nil {
+			utils.Debug("Resume spot check skipped: %v", checkErr)
+		} else if changed {
+			utils.Debug("Resume spot check failed: server content changed, restarting %s from scratch", destPath)
+			isResume = false
+			d.warn(downloadCtx, sourceChangedWarning)
+		}
+	}
 
 	if isResume {
 		// Resume: use saved tasks and restore downloaded counter
@@ -273,11 +432,31 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		}
 		utils.Debug("Resuming from saved state: %d tasks, %d bytes downloaded", len(tasks), savedState.Downloaded)
 	} else {
-		// Fresh download: preallocate file and create new tasks
-		if err := outFile.Truncate(fileSize); err != nil {
+		// Fresh download: make sure it fits, preallocate the file (or drop
+		// stale parts) and create new tasks
+		if err := checkFreeSpace(destDir, spaceNeeded(outFile, fileSize)); err != nil {
+			return err
+		}
+		switch out := outFile.(type) {
+		case *os.File:
+			if d.Runtime != nil && d.Runtime.SparseFiles {
+				// Filesystems without sparse files just get a file of that size
+				_ = platform.MakeSparse(out)
+				err = out.Truncate(fileSize)
+			} else {
+				err = platform.Preallocate(out, fileSize)
+			}
+		case *partFiles:
+			err = out.reset()
+		}
+		if err != nil {
 			return fmt.Errorf("failed to preallocate file: %w", err)
 		}
-		tasks = createTasks(fileSize, chunkSize)
+		if d.SingleStream {
+			tasks = []types.Task{singleStreamTask(fileSize)}
+		} else {
+			tasks = createTasks(fileSize, chunkSize)
+		}
 		// Robustness: ensure state counter starts at 0 for fresh download
 		if d.State != nil {
 			d.State.Downloaded.Store(0)
@@ -286,6 +465,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	}
 	queue := NewTaskQueue()
 	queue.PushMultiple(tasks)
+	if d.State != nil {
+		d.State.SetTaskSource(d.taskStats)
+		defer d.State.SetTaskSource(nil)
+	}
 
 	// Start time for stats
 	startTime := time.Now()
@@ -294,37 +477,16 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	balancerCtx, cancelBalancer := context.WithCancel(downloadCtx)
 	defer cancelBalancer()
 
-	go func() {
-		ticker := time.NewTicker(200 * time.Millisecond)
-		defer ticker.Stop()
+	if !d.SingleStream {
+		go d.balance(balancerCtx, queue)
+	}
 
-		for {
-			select {
-			case <-balancerCtx.Done():
-				return
-			case <-ticker.C:
-				// Aggressively fill idle workers
-				// Continue splitting/stealing as long as we have idle workers and are making progress
-				for queue.IdleWorkers() > 0 {
-					didWork := false
-					if queue.SplitLargestIfNeeded() {
-						didWork = true
-						utils.Debug("Balancer: split largest task")
-					} else if queue.Len() == 0 {
-						// Try to steal from an active worker
-						if d.StealWork(queue) {
-							didWork = true
-						}
-					}
-
-					// If we couldn't split or steal anything, stop trying for this tick
-					if !didWork {
-						break
-					}
-				}
-			}
+	workerCount := func() int {
+		if d.tuner != nil {
+			return d.tuner.workers()
 		}
-	}()
+		return numConns
+	}
 
 	// Monitor for completion
 	go func() {
@@ -342,7 +504,8 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 			case <-ticker.C:
 				// Ensure queue is empty (no pending retries) before considering byte count.
 				// This protects against cutting off active retries even if byte count seems high (due to overlaps etc).
-				if queue.Len() == 0 && (int(queue.IdleWorkers()) == numConns || d.State.Downloaded.Load() >= fileSize) {
+				if queue.Len() == 0 && (int(queue.IdleWorkers()) == workerCount() ||
+					(fileSize > 0 && d.State != nil && d.State.Downloaded.Load() >= fileSize)) {
 					queue.Close()
 					return
 				}
@@ -350,24 +513,30 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		}
 	}()
 
-	// Health monitor: detect slow workers
-	go func() {
-		ticker := time.NewTicker(types.HealthCheckInterval) // Fixed: using types constant
-		defer ticker.Stop()
+	if profile.WriteSpeed > 0 && d.State != nil {
+		go d.watchDisk(balancerCtx, destDir, profile.WriteSpeed)
+	}
 
-		for {
-			select {
-			case <-balancerCtx.Done():
-				return
-			case <-ticker.C:
-				d.checkWorkerHealth()
+	// Health monitor: detect slow workers (a single stream has nothing to compare against)
+	if !d.SingleStream {
+		go func() {
+			ticker := time.NewTicker(types.HealthCheckInterval) // Fixed: using types constant
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-balancerCtx.Done():
+					return
+				case <-ticker.C:
+					d.checkWorkerHealth(time.Now())
+				}
 			}
-		}
-	}()
+		}()
+	}
 
 	// Start workers
 	var wg sync.WaitGroup
-	workerErrors := make(chan error, numConns)
+	workerErrors := make(chan error, maxConns)
 
 	// Combine primary + secondary for workers
 	// We want to ensure the primary is included if it was valid (it should be, otherwise TUIDownload would have failed)
@@ -389,16 +558,53 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		// Should have been caught by early check but safe fallback
 		workerMirrors = []string{rawurl}
 	}
+	mirrors := newMirrorPool(workerMirrors)
+
+	// Workers may write through a mapping or a batching ring; everything
+	// else uses outFile
+	workerOut := workerOutput(outFile, strategy, fileSize)
+	defer closeWorkerOutput(workerOut)
 
-	for i := 0; i < numConns; i++ {
+	startWorker := func(workerID int) {
 		wg.Add(1)
-		go func(workerID int) {
+		go func() {
 			defer wg.Done()
-			err := d.worker(downloadCtx, workerID, workerMirrors, outFile, queue, fileSize, startTime, verbose, client)
+			err := d.worker(downloadCtx, workerID, mirrors, workerOut, queue, fileSize, startTime, verbose, client)
+			if err == errWorkerRetired {
+				return
+			}
+			if d.tuner != nil {
+				d.tuner.exited(workerID)
+			}
 			if err != nil && err != context.Canceled {
 				workerErrors <- err
 			}
-		}(i)
+		}()
+	}
+
+	if d.tuner != nil {
+		// The tuner counts as a worker so none can be started after the
+		// wait below has seen them all finish
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.tune(downloadCtx, queue, d.tuner, fileSize, startWorker)
+		}()
+		d.tuner.fill(startWorker)
+	} else {
+		for i := 0; i < numConns; i++ {
+			startWorker(i)
+		}
+	}
+
+	// Save progress while running so a crash can resume from it
+	var checkpointWG sync.WaitGroup
+	if !d.SingleStream {
+		checkpointWG.Add(1)
+		go func() {
+			defer checkpointWG.Done()
+			d.checkpoint(balancerCtx, queue, outFile, destPath, fileSize, startTime, candidateMirrors)
+		}()
 	}
 
 	// Wait for all workers to complete
@@ -415,6 +621,13 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 			downloadErr = err
 		}
 	}
+	if err := closeWorkerOutput(workerOut); err != nil && downloadErr == nil {
+		downloadErr = fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// No checkpoint may land after the final state below
+	cancelBalancer()
+	checkpointWG.Wait()
 
 	// Handle pause: state saved
 	if d.State != nil && d.State.IsPaused() {
@@ -433,42 +646,18 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		remainingTasks = append(remainingTasks, activeRemaining...)
 
 		// Calculate Downloaded from remaining tasks (ensures consistency)
-		var remainingBytes int64
-		for _, task := range remainingTasks {
-			remainingBytes += task.Length
-		}
+		remainingBytes := tasksLength(remainingTasks)
 		computedDownloaded := fileSize - remainingBytes
 
-		// Calculate total elapsed time
-		var totalElapsed time.Duration
-		var chunkBitmap []byte
-		var actualChunkSize int64
-
-		if d.State != nil {
-			totalElapsed = d.State.SavedElapsed + time.Since(startTime)
-			// Get persisted bitmap data
-			bitmap, _, _, chunkSize, _ := d.State.GetBitmap()
-			chunkBitmap = bitmap
-			actualChunkSize = chunkSize
-		} else {
-			totalElapsed = time.Since(startTime)
+		// Partial single-stream data can't be resumed; the next run starts over
+		if d.SingleStream {
+			remainingTasks = nil
+			remainingBytes = fileSize
+			computedDownloaded = 0
 		}
 
 		// Save state for resume (use computed value for consistency)
-		s := &types.DownloadState{
-			URL:             d.URL,
-			ID:              d.ID,
-			DestPath:        destPath,
-			TotalSize:       fileSize,
-			Downloaded:      computedDownloaded,
-			Tasks:           remainingTasks,
-			Filename:        filepath.Base(destPath),
-			Elapsed:         totalElapsed.Nanoseconds(),
-			Mirrors:         candidateMirrors,
-			ChunkBitmap:     chunkBitmap,
-			ActualChunkSize: actualChunkSize,
-		}
-		if err := state.SaveState(d.URL, destPath, s); err != nil {
+		if err := d.saveResumeState(destPath, fileSize, computedDownloaded, remainingTasks, time.Since(startTime), candidateMirrors); err != nil {
 			utils.Debug("Failed to save pause state: %v", err)
 		}
 
@@ -484,6 +673,11 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	}
 
 	if downloadErr != nil {
+		if errors.Is(downloadErr, types.ErrSourceChanged) {
+			// The caller starts over; nothing saved is worth resuming from
+			_ = state.DeleteState(d.ID, d.URL, destPath)
+			d.warn(ctx, sourceChangedWarning)
+		}
 		return downloadErr
 	}
 
@@ -495,19 +689,43 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	// Close file before renaming
 	outFile.Close()
 
+	// Parts are streamed into one file next to them, hashed on the way
+	completedPath := workingPath
+	parts, isParts := outFile.(*partFiles)
+	if isParts {
+		completedPath = workingPath + mergeSuffix
+		digest, err := parts.merge(completedPath)
+		parts.Close()
+		if err != nil {
+			_ = os.Remove(utils.LongPath(completedPath))
+			return fmt.Errorf("failed to merge parts: %w", err)
+		}
+		d.SHA256 = digest
+	}
+
 	// Rename from .surge to final destination
-	if err := os.Rename(workingPath, destPath); err != nil {
+	// Long-path forms let this work in deep trees and on UNC shares on Windows
+	if err := os.Rename(utils.LongPath(completedPath), utils.LongPath(destPath)); err != nil {
 		// Check for race condition: did someone else already rename it?
 		if os.IsNotExist(err) {
-			if info, statErr := os.Stat(destPath); statErr == nil && info.Size() == fileSize {
+			if info, statErr := os.Stat(utils.LongPath(destPath)); statErr == nil && info.Size() == fileSize {
 				utils.Debug("Race condition detected: File already exists and has correct size. Treating as success.")
 				// Clean up state just in case, though usually done by caller
 				_ = state.DeleteState(d.ID, d.URL, destPath)
 				return nil
 			}
+			return fmt.Errorf("failed to rename completed file: %w", err)
 		}
-		return fmt.Errorf("failed to rename completed file: %w", err)
+		// Fallback: copy if rename fails (cross-device)
+		if copyErr := copyFile(utils.LongPath(completedPath), utils.LongPath(destPath)); copyErr != nil {
+			return fmt.Errorf("failed to finalize file: %w", copyErr)
+		}
+		_ = os.Remove(utils.LongPath(completedPath))
+	}
+	if isParts {
+		_ = os.RemoveAll(utils.LongPath(workingPath))
 	}
+	removeEmptyPartDir(workingPath)
 
 	// Delete state file on successful completion
 	_ = state.DeleteState(d.ID, d.URL, destPath)
@@ -516,3 +734,139 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 
 	return nil
 }
+
+// openOutput opens the working storage at workingPath: the parts folder or
+// single file already there, or for a new download whichever the write
+// strategy says. A single stream always writes one file.
+func (d *ConcurrentDownloader) openOutput(workingPath string, fileSize int64, strategy string) (output, error) {
+	// A merge cut short is redone from the parts
+	_ = os.Remove(utils.LongPath(workingPath + mergeSuffix))
+
+	useParts := false
+	if info, err := os.Stat(utils.LongPath(workingPath)); err == nil {
+		useParts = info.IsDir()
+		if useParts && d.SingleStream {
+			// A single stream starts over anyway
+			if err := os.RemoveAll(utils.LongPath(workingPath)); err != nil {
+				return nil, err
+			}
+			useParts = false
+		}
+	} else if !d.SingleStream {
+		useParts = strategy == types.WriteParts
+	}
+
+	if useParts {
+		utils.Debug("Writing %s as part files", workingPath)
+		return openPartFiles(workingPath, fileSize)
+	}
+	return os.OpenFile(utils.LongPath(workingPath), os.O_CREATE|os.O_RDWR, 0644)
+}
+
+// removeEmptyPartDir removes the hidden part folder once the last working
+// file in it is gone. Folders that still hold files are left alone.
+func removeEmptyPartDir(workingPath string) {
+	if dir := filepath.Dir(workingPath); filepath.Base(dir) == types.PartDirName {
+		_ = os.Remove(utils.LongPath(dir))
+	}
+}
+
+// balance keeps idle workers busy by splitting queued tasks or stealing
+// the tail of active ones
+func (d *ConcurrentDownloader) balance(ctx context.Context, queue *TaskQueue) {
+	ticker := time.NewTicker(balanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.fillIdle(queue)
+		}
+	}
+}
+
+// taskStats lists the tasks in flight by worker, and the adaptive target
+func (d *ConcurrentDownloader) taskStats() ([]types.TaskStats, int) {
+	d.activeMu.Lock()
+	stats := make([]types.TaskStats, 0, len(d.activeTasks))
+	for id, active := range d.activeTasks {
+		stats = append(stats, types.TaskStats{
+			Worker:    id,
+			Offset:    atomic.LoadInt64(&active.CurrentOffset),
+			Remaining: active.RemainingBytes(),
+			Speed:     active.GetSpeed(),
+		})
+	}
+	d.activeMu.Unlock()
+	slices.SortFunc(stats, func(a, b types.TaskStats) int { return a.Worker - b.Worker })
+
+	var target int
+	if d.tuner != nil && d.tuner.adaptive {
+		d.tuner.mu.Lock()
+		target = d.tuner.target
+		d.tuner.mu.Unlock()
+	}
+	return stats, target
+}
+
+// balanceInterval is how often the balancer looks for idle workers
+const balanceInterval = 200 * time.Millisecond
+
+// fillIdle splits queued tasks or steals from active ones for as long as
+// there are idle workers and something to split or steal. It returns how
+// many of each it did.
+func (d *ConcurrentDownloader) fillIdle(queue *TaskQueue) (splits, steals int) {
+	for queue.IdleWorkers() > 0 {
+		didWork := false
+		if queue.SplitLargestIfNeeded() {
+			didWork = true
+			splits++
+			if d.State != nil {
+				d.State.Splits.Add(1)
+			}
+			utils.Debug("Balancer: split largest task")
+		} else if queue.Len() == 0 {
+			// Try to steal from an active worker
+			if d.StealWork(queue) {
+				didWork = true
+				steals++
+			}
+		}
+
+		// If we couldn't split or steal anything, stop trying for this tick
+		if !didWork {
+			break
+		}
+	}
+	return splits, steals
+}
+
+// copyFile copies a file from src to dst (fallback when rename fails).
+// Like os.Rename, it replaces a symlink at dst instead of writing through it
+// to the link's target.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if info, err := os.Lstat(dst); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
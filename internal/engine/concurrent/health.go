@@ -6,8 +6,9 @@ import (
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
-// checkWorkerHealth detects slow workers and cancels them
-func (d *ConcurrentDownloader) checkWorkerHealth() {
+// checkWorkerHealth detects slow workers and cancels them. now is passed in
+// so the simulator can run it on its own clock.
+func (d *ConcurrentDownloader) checkWorkerHealth(now time.Time) {
 	d.activeMu.Lock()
 	defer d.activeMu.Unlock()
 
@@ -15,8 +16,6 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 		return
 	}
 
-	now := time.Now()
-
 	// First pass: calculate mean speed
 	var totalSpeed float64
 	var speedCount int
@@ -0,0 +1,98 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// newConnCountingServer serves data with range support and counts the TCP
+// connections clients open to it
+func newConnCountingServer(data []byte) (*httptest.Server, *atomic.Int64) {
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	server.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	return server, &conns
+}
+
+// runTask downloads task with StopAt moved in by cut bytes, as if a steal had
+// taken the tail
+func runTask(t *testing.T, d *ConcurrentDownloader, url string, file *os.File, client *http.Client, task types.Task, cut, totalSize int64) {
+	t.Helper()
+	now := time.Now()
+	active := &ActiveTask{
+		Task:          task,
+		CurrentOffset: task.Offset,
+		StopAt:        task.Offset + task.Length - cut,
+		StartTime:     now,
+		WindowStart:   now,
+	}
+	buf := make([]byte, 32*types.KB)
+	if err := d.downloadTask(context.Background(), url, file, active, buf, false, client, totalSize); err != nil {
+		t.Fatalf("downloadTask failed: %v", err)
+	}
+}
+
+func TestDownloadTask_ReusesConnectionAfterShortSteal(t *testing.T) {
+	tmpDir := t.TempDir()
+	fileSize := int64(2 * types.MB)
+	server, conns := newConnCountingServer(bytes.Repeat([]byte("a"), int(fileSize)))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(tmpDir, "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	d := NewConcurrentDownloader("keepalive-id", nil, nil, &types.RuntimeConfig{})
+	client := d.newConcurrentClient(1)
+
+	// The first task stops 16KB short of its range; the tail is drained
+	runTask(t, d, server.URL, file, client, types.Task{Offset: 0, Length: types.MB}, 16*types.KB, fileSize)
+	runTask(t, d, server.URL, file, client, types.Task{Offset: types.MB, Length: types.MB}, 0, fileSize)
+
+	if got := conns.Load(); got != 1 {
+		t.Errorf("expected adjacent range requests to share 1 connection, opened %d", got)
+	}
+}
+
+func TestDownloadTask_DropsConnectionAfterLongSteal(t *testing.T) {
+	tmpDir := t.TempDir()
+	fileSize := int64(4 * types.MB)
+	server, conns := newConnCountingServer(bytes.Repeat([]byte("a"), int(fileSize)))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(tmpDir, "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	d := NewConcurrentDownloader("keepalive-id", nil, nil, &types.RuntimeConfig{})
+	client := d.newConcurrentClient(1)
+
+	// Draining 2MB would cost more than a new connection, so it is dropped
+	runTask(t, d, server.URL, file, client, types.Task{Offset: 0, Length: 3 * types.MB}, 2*types.MB, fileSize)
+	runTask(t, d, server.URL, file, client, types.Task{Offset: 3 * types.MB, Length: types.MB}, 0, fileSize)
+
+	if got := conns.Load(); got != 2 {
+		t.Errorf("expected the cut-short connection to be dropped (2 connections), opened %d", got)
+	}
+}
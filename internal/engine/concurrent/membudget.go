@@ -0,0 +1,70 @@
+package concurrent
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryBudget caps the bytes of worker buffers held at once across every
+// download in the process. Workers past the cap wait for memory instead of
+// allocating it, so many segmented downloads slow down rather than exhaust
+// RAM on a small machine.
+type memoryBudget struct {
+	mu   sync.Mutex
+	used int64
+	wake chan struct{} // Closed and replaced whenever memory is released
+}
+
+// buffers is the budget shared by all downloads
+var buffers = newMemoryBudget()
+
+func newMemoryBudget() *memoryBudget {
+	return &memoryBudget{wake: make(chan struct{})}
+}
+
+// reserve takes n bytes without waiting, even past any limit. Each download's
+// first worker reserves its buffer so no download is starved completely.
+func (b *memoryBudget) reserve(n int64) {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+// acquire takes n bytes once they fit under limit, waiting for releases
+// until then. It gives up, returning false, when ctx is done or stop closes.
+func (b *memoryBudget) acquire(ctx context.Context, n, limit int64, stop <-chan struct{}) bool {
+	for {
+		b.mu.Lock()
+		if b.used+n <= limit {
+			b.used += n
+			b.mu.Unlock()
+			return true
+		}
+		wake := b.wake
+		b.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return false
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// release returns n bytes taken by reserve or acquire and wakes waiters
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	close(b.wake)
+	b.wake = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// inUse returns the bytes currently taken
+func (b *memoryBudget) inUse() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
@@ -0,0 +1,84 @@
+package concurrent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget_WaitsForRelease(t *testing.T) {
+	b := newMemoryBudget()
+	ctx := context.Background()
+
+	if !b.acquire(ctx, 60, 100, nil) {
+		t.Fatal("first acquire should fit")
+	}
+
+	got := make(chan bool, 1)
+	go func() { got <- b.acquire(ctx, 60, 100, nil) }()
+
+	select {
+	case <-got:
+		t.Fatal("acquire past the limit should wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.release(60)
+	select {
+	case ok := <-got:
+		if !ok {
+			t.Fatal("acquire failed after release")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("release did not wake the waiter")
+	}
+	if b.inUse() != 60 {
+		t.Errorf("inUse = %d, want 60", b.inUse())
+	}
+}
+
+func TestMemoryBudget_ReserveIgnoresLimit(t *testing.T) {
+	b := newMemoryBudget()
+	b.reserve(150)
+	if b.acquire(context.Background(), 1, 100, closedChan()) {
+		t.Error("acquire should not fit once reserve exceeded the limit")
+	}
+	b.release(150)
+	if b.inUse() != 0 {
+		t.Errorf("inUse = %d, want 0", b.inUse())
+	}
+}
+
+func TestMemoryBudget_GivesUp(t *testing.T) {
+	b := newMemoryBudget()
+	b.reserve(100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if b.acquire(ctx, 10, 100, nil) {
+		t.Error("acquire should fail on a cancelled context")
+	}
+	if b.acquire(context.Background(), 10, 100, closedChan()) {
+		t.Error("acquire should fail once stop is closed")
+	}
+	if b.inUse() != 100 {
+		t.Errorf("failed acquires changed inUse to %d", b.inUse())
+	}
+}
+
+func TestTaskQueue_CloseSignalsClosed(t *testing.T) {
+	q := NewTaskQueue()
+	q.Close()
+	q.Close() // Closing twice must not panic
+	select {
+	case <-q.closed:
+	default:
+		t.Error("closed channel not closed by Close")
+	}
+}
+
+func closedChan() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
@@ -0,0 +1,89 @@
+package concurrent
+
+import (
+	"sync"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// mirrorPool is the set of mirrors the workers of one download share. A
+// mirror that fails types.MirrorMaxFailures times in a row, counting
+// transfers the health monitor cut off for being slow, is dropped so its
+// work goes to the others. The last mirror is never dropped.
+type mirrorPool struct {
+	mu       sync.Mutex
+	urls     []string
+	failures []int
+	dropped  []bool
+}
+
+func newMirrorPool(urls []string) *mirrorPool {
+	return &mirrorPool{
+		urls:     urls,
+		failures: make([]int, len(urls)),
+		dropped:  make([]bool, len(urls)),
+	}
+}
+
+func (p *mirrorPool) url(i int) string {
+	return p.urls[i]
+}
+
+// pick returns the first mirror in use at or after index start, wrapping
+// around
+func (p *mirrorPool) pick(start int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n := 0; n < len(p.urls); n++ {
+		if i := (start + n) % len(p.urls); !p.dropped[i] {
+			return i
+		}
+	}
+	return start % len(p.urls)
+}
+
+// next returns the mirror in use after i, or i itself if it is the only one
+func (p *mirrorPool) next(i int) int {
+	return p.pick(i + 1)
+}
+
+// live returns how many mirrors are still in use
+func (p *mirrorPool) live() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, dropped := range p.dropped {
+		if !dropped {
+			n++
+		}
+	}
+	return n
+}
+
+// fail records a failure of mirror i and reports whether it got the mirror
+// dropped
+func (p *mirrorPool) fail(i int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.dropped[i] {
+		return false
+	}
+	p.failures[i]++
+	if p.failures[i] < types.MirrorMaxFailures {
+		return false
+	}
+	for j, dropped := range p.dropped {
+		if j != i && !dropped {
+			p.dropped[i] = true
+			return true
+		}
+	}
+	return false // Keep the last mirror, retries and backoff take over
+}
+
+// succeed clears the failures of mirror i
+func (p *mirrorPool) succeed(i int) {
+	p.mu.Lock()
+	p.failures[i] = 0
+	p.mu.Unlock()
+}
@@ -1,10 +1,12 @@
 package concurrent
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -118,3 +120,183 @@ func TestMirrors_Failover(t *testing.T) {
 		t.Error("Expected good server to handle requests after failover")
 	}
 }
+
+func TestMirrors_ConnectionCapHoldsAcrossRetries(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(20 * types.MB)
+	data := make([]byte, fileSize)
+
+	// Both mirrors share one in-flight counter; the flaky one fails every
+	// third request so workers retry and fail over while others are busy
+	var inFlight, peak, requests atomic.Int64
+	serve := func(flaky bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			if flaky && requests.Add(1)%3 == 0 {
+				http.Error(w, "flaky", http.StatusInternalServerError)
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+		}
+	}
+	good := httptest.NewServer(serve(false))
+	defer good.Close()
+	flaky := httptest.NewServer(serve(true))
+	defer flaky.Close()
+
+	const maxConns = 3
+	destPath := filepath.Join(tmpDir, "capped.bin")
+	state := types.NewProgressState("cap-test", fileSize)
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: maxConns, MinChunkSize: types.MB, MaxChunkSize: types.MB, TargetChunkSize: types.MB}
+	downloader := NewConcurrentDownloader("cap-test-id", nil, state, runtime)
+
+	var livePeak atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if n := state.ActiveWorkers.Load(); n > livePeak.Load() {
+				livePeak.Store(n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	mirrors := []string{flaky.URL, good.URL}
+	err := downloader.Download(ctx, flaky.URL, mirrors, mirrors, destPath, fileSize, false)
+	close(done)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if got := peak.Load(); got > maxConns {
+		t.Errorf("servers saw %d concurrent requests, want at most %d", got, maxConns)
+	}
+	if got := livePeak.Load(); got > maxConns {
+		t.Errorf("live connection count reached %d, want at most %d", got, maxConns)
+	}
+	if got := state.ActiveWorkers.Load(); got != 0 {
+		t.Errorf("live connection count = %d after completion, want 0", got)
+	}
+}
+
+func TestMirrorPool(t *testing.T) {
+	p := newMirrorPool([]string{"a", "b", "c"})
+	if i := p.pick(4); i != 1 {
+		t.Errorf("pick(4) = %d, want 1", i)
+	}
+
+	// Failures in a row drop a mirror; a success in between starts over
+	for n := 1; n < types.MirrorMaxFailures; n++ {
+		if p.fail(1) {
+			t.Fatalf("mirror dropped after %d failures", n)
+		}
+	}
+	p.succeed(1)
+	if p.fail(1) {
+		t.Fatal("success did not clear earlier failures")
+	}
+	for n := 1; n < types.MirrorMaxFailures-1; n++ {
+		p.fail(1)
+	}
+	if !p.fail(1) {
+		t.Fatalf("mirror not dropped after %d failures in a row", types.MirrorMaxFailures)
+	}
+	if p.live() != 2 || p.next(0) != 2 || p.pick(1) != 2 {
+		t.Errorf("dropped mirror still picked: live=%d next(0)=%d pick(1)=%d", p.live(), p.next(0), p.pick(1))
+	}
+
+	// The last mirror is kept however often it fails
+	for n := 0; n < types.MirrorMaxFailures; n++ {
+		p.fail(0)
+	}
+	for n := 0; n < 2*types.MirrorMaxFailures; n++ {
+		if p.fail(2) {
+			t.Fatal("last mirror dropped")
+		}
+	}
+	if p.live() != 1 || p.next(2) != 2 {
+		t.Errorf("live=%d next(2)=%d, want only mirror 2 left", p.live(), p.next(2))
+	}
+}
+
+func TestMirrors_DropsFailingMirror(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(20 * types.MB) // Four connections
+
+	var badRequests atomic.Int32
+	badHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badRequests.Add(1)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	})
+	bad1 := httptest.NewServer(badHandler)
+	defer bad1.Close()
+	bad2 := httptest.NewServer(badHandler)
+	defer bad2.Close()
+
+	goodServer := testutil.NewMockServer(
+		testutil.WithFileSize(fileSize),
+		testutil.WithRangeSupport(true),
+	)
+	defer goodServer.Close()
+
+	destPath := filepath.Join(tmpDir, "drop_test.bin")
+	state := types.NewProgressState("drop-test", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 4,
+		MaxTaskRetries:        5,
+		MinChunkSize:          256 * types.KB,
+		MaxChunkSize:          256 * types.KB,
+		TargetChunkSize:       256 * types.KB,
+	}
+
+	downloader := NewConcurrentDownloader("drop-test-id", nil, state, runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Workers start on mirrors 0, 1, 2, 0 and fail over in that order, so
+	// the second bad mirror fails three times before everyone is on the good one
+	mirrors := []string{bad1.URL, bad2.URL, goodServer.URL()}
+	if err := downloader.Download(ctx, bad1.URL, mirrors, mirrors, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if err := testutil.VerifyFileSize(destPath, fileSize); err != nil {
+		t.Error(err)
+	}
+
+	// However many chunks there are, each worker fails at most twice
+	if n := badRequests.Load(); n > 2*4 {
+		t.Errorf("bad mirrors got %d requests, want at most 8", n)
+	}
+	for _, m := range state.GetMirrors() {
+		switch m.URL {
+		case bad2.URL:
+			if m.Active || !m.Error {
+				t.Errorf("failing mirror status = %+v, want dropped", m)
+			}
+		case goodServer.URL():
+			if !m.Active || m.Error {
+				t.Errorf("good mirror status = %+v, want active", m)
+			}
+		}
+	}
+}
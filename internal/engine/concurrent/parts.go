@@ -0,0 +1,199 @@
+package concurrent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/platform"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// output is the working storage a download writes into until it completes:
+// an *os.File or a partFiles folder
+type output interface {
+	io.WriterAt
+	io.ReaderAt
+	Sync() error
+	Close() error
+}
+
+// mergeSuffix is appended to the working path for the file parts are merged
+// into, before it is renamed into place
+const mergeSuffix = ".merge"
+
+// partFiles keeps a download as a folder of part files, each holding a fixed
+// stretch of the file, for filesystems where scattered writes into one large
+// file are slow (SMB, NFS). Every range lands in one or two small files that
+// fill up close to sequentially, and the parts are streamed into the final
+// file once the download completes.
+type partFiles struct {
+	dir      string
+	size     int64
+	partSize int64
+
+	mu    sync.Mutex
+	files map[int64]*os.File // Opened on first use
+}
+
+// partSizeFor returns the length of each part of a file of size bytes. It
+// only depends on the size, so a resumed download finds its parts where it
+// left them.
+func partSizeFor(size int64) int64 {
+	partSize := types.ChunkCount(size, types.MaxPartFiles)
+	partSize = types.ChunkCount(partSize, types.AlignSize) * types.AlignSize
+	return max(partSize, types.MaxChunk)
+}
+
+// openPartFiles opens the parts folder at dir for a file of size bytes,
+// creating it if needed
+func openPartFiles(dir string, size int64) (*partFiles, error) {
+	if err := os.MkdirAll(utils.LongPath(dir), 0755); err != nil {
+		return nil, err
+	}
+	return &partFiles{dir: dir, size: size, partSize: partSizeFor(size), files: make(map[int64]*os.File)}, nil
+}
+
+// partPath returns where part i is kept in dir
+func partPath(dir string, i int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%05d.part", i))
+}
+
+// count returns how many parts make up the file
+func (p *partFiles) count() int64 {
+	return types.ChunkCount(p.size, p.partSize)
+}
+
+// length returns how many bytes part i holds once complete
+func (p *partFiles) length(i int64) int64 {
+	return min(p.partSize, p.size-i*p.partSize)
+}
+
+func (p *partFiles) part(i int64) (*os.File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f, ok := p.files[i]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(utils.LongPath(partPath(p.dir, i)), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	p.files[i] = f
+	return f, nil
+}
+
+// each calls fn for every part that b, starting at off, overlaps, with the
+// slice of b and the offset within that part
+func (p *partFiles) each(b []byte, off int64, fn func(f *os.File, b []byte, off int64) (int, error)) (int, error) {
+	done := 0
+	for done < len(b) {
+		pos := off + int64(done)
+		if pos >= p.size {
+			return done, io.EOF
+		}
+		i := pos / p.partSize
+		inPart := pos - i*p.partSize
+		n := int(min(int64(len(b)-done), p.length(i)-inPart))
+		f, err := p.part(i)
+		if err != nil {
+			return done, err
+		}
+		m, err := fn(f, b[done:done+n], inPart)
+		done += m
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+func (p *partFiles) WriteAt(b []byte, off int64) (int, error) {
+	return p.each(b, off, (*os.File).WriteAt)
+}
+
+func (p *partFiles) ReadAt(b []byte, off int64) (int, error) {
+	return p.each(b, off, (*os.File).ReadAt)
+}
+
+// Sync flushes every part written so far
+func (p *partFiles) Sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, f := range p.files {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *partFiles) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var firstErr error
+	for i, f := range p.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.files, i)
+	}
+	return firstErr
+}
+
+// reset drops every part, for a download starting over
+func (p *partFiles) reset() error {
+	if err := p.Close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(utils.LongPath(p.dir)); err != nil {
+		return err
+	}
+	return os.MkdirAll(utils.LongPath(p.dir), 0755)
+}
+
+// merge streams the parts in order into a new file at dst and returns the
+// hex SHA-256 of what it wrote. A part shorter than its stretch of the file
+// is an error: the download is not complete.
+func (p *partFiles) merge(dst string) (string, error) {
+	out, err := os.OpenFile(utils.LongPath(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	// The parts and the merged copy take twice the file's size until the
+	// parts are removed, so reserve the copy's space before writing any of
+	// it: a disk that cannot hold it fails the merge at once
+	if err := platform.Preallocate(out, p.size); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	w := io.MultiWriter(out, h)
+	for i := range p.count() {
+		f, err := p.part(i)
+		if err != nil {
+			return "", err
+		}
+		want := p.length(i)
+		n, err := io.Copy(w, io.NewSectionReader(f, 0, want))
+		if err != nil {
+			return "", fmt.Errorf("part %d: %w", i, err)
+		}
+		if n != want {
+			return "", fmt.Errorf("part %d holds %d bytes, want %d", i, n, want)
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,186 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// smallParts returns a partFiles in a temp folder with tiny parts, so tests
+// can cross part boundaries without writing megabytes
+func smallParts(t *testing.T, size, partSize int64) *partFiles {
+	t.Helper()
+	p, err := openPartFiles(filepath.Join(t.TempDir(), "file.surge"), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.partSize = partSize
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestPartFiles_WriteReadAcrossParts(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGH")
+	p := smallParts(t, int64(len(content)), 10)
+
+	// Out of order and straddling part boundaries, like concurrent workers
+	for _, r := range [][2]int{{25, 44}, {0, 7}, {7, 25}} {
+		if n, err := p.WriteAt(content[r[0]:r[1]], int64(r[0])); err != nil || n != r[1]-r[0] {
+			t.Fatalf("WriteAt(%d-%d) = %d, %v", r[0], r[1], n, err)
+		}
+	}
+	if _, err := p.WriteAt([]byte("x"), int64(len(content))); err == nil {
+		t.Error("write past the end succeeded")
+	}
+
+	got := make([]byte, 16)
+	if _, err := p.ReadAt(got, 5); err != nil || string(got) != string(content[5:21]) {
+		t.Errorf("ReadAt = %q, %v; want %q", got, err, content[5:21])
+	}
+
+	entries, _ := os.ReadDir(p.dir)
+	if len(entries) != 5 {
+		t.Errorf("%d part files, want 5", len(entries))
+	}
+
+	dst := filepath.Join(t.TempDir(), "merged")
+	digest, err := p.merge(dst)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	merged, _ := os.ReadFile(dst)
+	if !bytes.Equal(merged, content) {
+		t.Errorf("merged %q, want %q", merged, content)
+	}
+	if sum := sha256.Sum256(content); digest != hex.EncodeToString(sum[:]) {
+		t.Errorf("digest %s is not the SHA-256 of the content", digest)
+	}
+}
+
+func TestPartFiles_MergeIncomplete(t *testing.T) {
+	p := smallParts(t, 30, 10)
+	if _, err := p.WriteAt(make([]byte, 15), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.merge(filepath.Join(t.TempDir(), "merged")); err == nil {
+		t.Error("merged a download with bytes missing")
+	}
+}
+
+func TestPartSizeFor(t *testing.T) {
+	for _, size := range []int64{1, types.MB, 10 * types.GB, 1<<40 + 12345} {
+		partSize := partSizeFor(size)
+		if partSize < types.MaxChunk || partSize%types.AlignSize != 0 {
+			t.Errorf("size %d: part size %d is small or unaligned", size, partSize)
+		}
+		if n := types.ChunkCount(size, partSize); n > types.MaxPartFiles {
+			t.Errorf("size %d: %d parts, want at most %d", size, n, types.MaxPartFiles)
+		}
+	}
+}
+
+func TestConcurrentDownloader_PartFiles(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := testContent(3*types.MB, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "parts.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 64 * types.KB, WriteStrategy: types.WriteParts}
+	d := NewConcurrentDownloader("parts-id", nil, types.NewProgressState("parts-id", fileSize), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs")
+	}
+	if sum := sha256.Sum256(content); d.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %q, want the hash of the content", d.SHA256)
+	}
+	workingPath := types.WorkingPath(destPath, "parts-id", false)
+	for _, leftover := range []string{workingPath, workingPath + mergeSuffix} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", leftover)
+		}
+	}
+}
+
+func TestConcurrentDownloader_ResumePartFiles(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := testContent(256*types.KB, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "resume.bin")
+	id := "resume-parts"
+
+	// An interrupted parts download: the first 100 KB are in part 0. The
+	// single-file strategy is configured now, but the parts on disk win.
+	partial := int64(100 * types.KB)
+	partsDir := types.WorkingPath(destPath, id, false)
+	if err := os.MkdirAll(partsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partPath(partsDir, 0), content[:partial], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SaveState(server.URL, destPath, &types.DownloadState{
+		ID:         id,
+		URL:        server.URL,
+		DestPath:   destPath,
+		TotalSize:  fileSize,
+		Downloaded: partial,
+		Tasks:      []types.Task{{Offset: partial, Length: fileSize - partial}},
+		Filename:   "resume.bin",
+		URLHash:    state.URLHash(server.URL),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, WriteStrategy: types.WriteSingle}
+	d := NewConcurrentDownloader(id, nil, types.NewProgressState(id, fileSize), runtime)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("resumed content differs")
+	}
+	if _, err := os.Stat(partsDir); !os.IsNotExist(err) {
+		t.Error("parts folder left behind")
+	}
+}
@@ -0,0 +1,317 @@
+package concurrent
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// SimServer models the server a simulated download talks to
+type SimServer struct {
+	ConnBandwidth  float64       // Bytes/sec one connection carries
+	TotalBandwidth float64       // Bytes/sec shared by all connections, 0 for no cap
+	Spread         float64       // Each request's connection is up to this fraction slower or faster
+	Latency        time.Duration // Time to the first byte of each request
+	FailRate       float64       // Chance that a request fails after its latency
+	MaxConns       int           // Requests past this many at once get 429, 0 for no limit
+}
+
+// SimConfig describes a simulated download. The same config and seed always
+// give the same result.
+type SimConfig struct {
+	FileSize int64
+	Server   SimServer
+	Runtime  *types.RuntimeConfig
+	Seed     uint64
+	Tick     time.Duration // Step of the simulated clock, default 10ms
+	Limit    time.Duration // Simulated time after which it gives up, default 24h
+}
+
+// SimResult is what happened in a simulated download
+type SimResult struct {
+	Duration        time.Duration
+	Completed       bool  // Every byte was fetched before Limit
+	Overlap         int64 // Bytes fetched more than once
+	Requests        int
+	Failed          int // Requests that failed, not counting Throttled
+	Throttled       int // Requests answered 429
+	Splits          int // Queued tasks split by the balancer
+	Steals          int // Ranges stolen from active tasks
+	HealthCancels   int // Tasks cut off by the slow-worker check
+	PeakConnections int
+	Idle            time.Duration // Worker time spent without a request while bytes were left
+}
+
+type simPhase int
+
+const (
+	simIdle simPhase = iota
+	simWaiting
+	simTransferring
+	simBackoff
+)
+
+// simWorker is a worker of a simulated download and its current request
+type simWorker struct {
+	id        int
+	phase     simPhase
+	wait      time.Duration // Left of the latency or backoff
+	fail      bool          // The request fails once its latency is over
+	throttled bool          // The request is answered 429 once its latency is over
+	speed     float64       // Bandwidth of the connection before sharing
+	carry     float64       // Fraction of a byte owed from the last tick
+	active    *ActiveTask
+	cancelled bool  // Cut off by the health check
+	written   int64 // Start of the range written by the current request
+}
+
+// Simulate runs the chunk scheduler of the concurrent downloader against a
+// synthetic server on a simulated clock. Task splitting, work stealing, the
+// slow-worker check and adaptive connection tuning are the engine's own;
+// only the network and the passing of time are modelled. A failed request
+// puts its range back and its worker waits out one retry backoff.
+func Simulate(cfg SimConfig) SimResult {
+	tick := cfg.Tick
+	if tick <= 0 {
+		tick = 10 * time.Millisecond
+	}
+	limit := cfg.Limit
+	if limit <= 0 {
+		limit = 24 * time.Hour
+	}
+	rt := cfg.Runtime
+	if rt == nil {
+		rt = &types.RuntimeConfig{}
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed^0x9e3779b97f4a7c15))
+	srv := cfg.Server
+
+	var res SimResult
+	state := types.NewProgressState("sim", cfg.FileSize)
+	d := NewConcurrentDownloader("sim", nil, state, rt)
+	numConns, maxConns := d.planConnections(cfg.FileSize)
+	queue := NewTaskQueue()
+	queue.PushMultiple(createTasks(cfg.FileSize, d.calculateChunkSize(cfg.FileSize, maxConns)))
+
+	workers := make(map[int]*simWorker)
+	start := func(id int) { workers[id] = &simWorker{id: id} }
+	if d.tuner != nil {
+		d.tuner.fill(start)
+	} else {
+		for i := range numConns {
+			start(i)
+		}
+	}
+
+	var written [][2]int64 // Ranges fetched, to check coverage at the end
+	finish := func(w *simWorker) {
+		cur := atomic.LoadInt64(&w.active.CurrentOffset)
+		if cur > w.written {
+			written = append(written, [2]int64{w.written, cur})
+		}
+		d.activeMu.Lock()
+		delete(d.activeTasks, w.id)
+		d.activeMu.Unlock()
+		queue.Release(w.id)
+		w.active = nil
+		w.phase = simIdle
+	}
+	requeue := func(w *simWorker) {
+		if remaining := w.active.RemainingTask(); remaining != nil {
+			queue.Push(*remaining)
+		}
+		finish(w)
+	}
+
+	epoch := time.Unix(0, 0)
+	var elapsed time.Duration
+	lastBalance, lastHealth, lastTune := time.Duration(0), time.Duration(0), time.Duration(0)
+	lastDownloaded := int64(0)
+	for ; elapsed < limit; elapsed += tick {
+		now := epoch.Add(elapsed)
+		ids := make([]int, 0, len(workers))
+		for id := range workers {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+
+		// Requests: claim work, wait out latencies and backoffs
+		for _, id := range ids {
+			w := workers[id]
+			if w.cancelled {
+				w.cancelled = false
+				if w.active != nil {
+					requeue(w)
+				}
+			}
+			switch w.phase {
+			case simBackoff:
+				if w.wait -= tick; w.wait <= 0 {
+					w.phase = simIdle
+				}
+			case simWaiting:
+				if w.wait -= tick; w.wait > 0 {
+					break
+				}
+				switch {
+				case w.throttled:
+					res.Throttled++
+					if d.tuner != nil {
+						d.tuner.throttle()
+					}
+				case w.fail:
+					res.Failed++
+				default:
+					w.phase = simTransferring
+					w.speed = srv.ConnBandwidth * (1 + srv.Spread*(2*rng.Float64()-1))
+					continue
+				}
+				requeue(w)
+				w.phase = simBackoff
+				w.wait = backoffDelay(1, rt.GetRetryBaseDelay(), rt.GetRetryMaxDelay(), rt.GetRetryJitter(), rng.Float64)
+			}
+			if w.phase != simIdle {
+				continue
+			}
+			if d.tuner != nil && !d.tuner.keep(id) {
+				delete(workers, id)
+				continue
+			}
+			if queue.Len() == 0 && d.StealWork(queue) {
+				res.Steals++
+			}
+			task, ok := queue.tryClaim(id)
+			if !ok {
+				continue
+			}
+			res.Requests++
+			w.active = &ActiveTask{
+				Task:          task,
+				CurrentOffset: task.Offset,
+				StopAt:        task.Offset + task.Length,
+				LastActivity:  now.UnixNano(),
+				StartTime:     now,
+				WindowStart:   now,
+				Cancel:        func() { w.cancelled = true; res.HealthCancels++ },
+			}
+			d.activeMu.Lock()
+			d.activeTasks[id] = w.active
+			d.activeMu.Unlock()
+			w.written = task.Offset
+			w.phase = simWaiting
+			w.wait = srv.Latency
+			w.fail = rng.Float64() < srv.FailRate
+			w.throttled = srv.MaxConns > 0 && busyWorkers(workers) > srv.MaxConns
+			w.carry = 0
+		}
+
+		// Transfers share the server's bandwidth. Floats are summed in ID
+		// order, as map order would change the result in the last bits.
+		var demand float64
+		busy := busyWorkers(workers)
+		for _, id := range ids {
+			if w, ok := workers[id]; ok && w.phase == simTransferring {
+				demand += w.speed
+			}
+		}
+		res.PeakConnections = max(res.PeakConnections, busy)
+		share := 1.0
+		if srv.TotalBandwidth > 0 && demand > srv.TotalBandwidth {
+			share = srv.TotalBandwidth / demand
+		}
+		idle := 0
+		for _, id := range ids {
+			w, ok := workers[id]
+			if !ok {
+				continue
+			}
+			if w.phase == simIdle {
+				idle++
+			}
+			if w.phase != simTransferring {
+				continue
+			}
+			w.carry += w.speed * share * tick.Seconds()
+			n := int64(w.carry)
+			w.carry -= float64(n)
+			cur := atomic.LoadInt64(&w.active.CurrentOffset)
+			n = min(n, atomic.LoadInt64(&w.active.StopAt)-cur)
+			if n > 0 {
+				atomic.StoreInt64(&w.active.CurrentOffset, cur+n)
+				atomic.AddInt64(&w.active.WindowBytes, n)
+				atomic.StoreInt64(&w.active.LastActivity, now.UnixNano())
+				state.Downloaded.Add(n)
+			}
+			w.active.updateSpeed(now, rt.GetSpeedEmaAlpha())
+			if w.active.RemainingBytes() == 0 {
+				finish(w)
+			}
+		}
+		atomic.StoreInt64(&queue.idleWorkers, int64(idle))
+
+		if state.Downloaded.Load() >= cfg.FileSize {
+			if queue.Len() == 0 && idle == len(workers) {
+				break
+			}
+		} else {
+			res.Idle += time.Duration(idle) * tick
+		}
+
+		// The engine's own periodic work
+		if elapsed-lastBalance >= balanceInterval {
+			splits, steals := d.fillIdle(queue)
+			res.Splits += splits
+			res.Steals += steals
+			lastBalance = elapsed
+		}
+		if elapsed-lastHealth >= types.HealthCheckInterval {
+			d.checkWorkerHealth(now)
+			lastHealth = elapsed
+		}
+		if d.tuner != nil && elapsed-lastTune >= types.AdaptiveInterval {
+			downloaded := state.Downloaded.Load()
+			d.tuner.step(downloaded-lastDownloaded, elapsed-lastTune, cfg.FileSize-downloaded)
+			d.tuner.fill(start)
+			lastDownloaded, lastTune = downloaded, elapsed
+		}
+	}
+
+	res.Duration = elapsed
+	covered, total := coverage(written)
+	res.Overlap = total - covered
+	res.Completed = covered == cfg.FileSize
+	return res
+}
+
+// busyWorkers counts the workers with a request open
+func busyWorkers(workers map[int]*simWorker) int {
+	n := 0
+	for _, w := range workers {
+		if w.phase == simWaiting || w.phase == simTransferring {
+			n++
+		}
+	}
+	return n
+}
+
+// coverage returns how many distinct bytes the ranges cover and their
+// total length
+func coverage(ranges [][2]int64) (covered, total int64) {
+	slices.SortFunc(ranges, func(a, b [2]int64) int { return cmp.Compare(a[0], b[0]) })
+	var end int64
+	for _, r := range ranges {
+		total += r[1] - r[0]
+		if r[0] > end {
+			end = r[0]
+		}
+		if r[1] > end {
+			covered += r[1] - end
+			end = r[1]
+		}
+	}
+	return covered, total
+}
@@ -0,0 +1,127 @@
+package concurrent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestSimulate_Reproducible(t *testing.T) {
+	cfg := SimConfig{
+		FileSize: 256 * types.MB,
+		Server: SimServer{
+			ConnBandwidth: 4 * types.MB,
+			Spread:        0.8,
+			Latency:       50 * time.Millisecond,
+			FailRate:      0.05,
+		},
+		Runtime: &types.RuntimeConfig{MaxConnectionsPerHost: 8},
+		Seed:    42,
+	}
+	first := Simulate(cfg)
+	if !first.Completed || first.Overlap != 0 {
+		t.Fatalf("incomplete or overlapping download: %+v", first)
+	}
+	if first.Failed == 0 || first.Steals == 0 {
+		t.Errorf("expected failures and steals at this size: %+v", first)
+	}
+	if again := Simulate(cfg); again != first {
+		t.Errorf("same seed, different runs:\n%+v\n%+v", first, again)
+	}
+
+	cfg.Seed = 7
+	if other := Simulate(cfg); other == first {
+		t.Errorf("another seed gave the identical run %+v", other)
+	}
+}
+
+func TestSimulate_CutsOffSlowConnections(t *testing.T) {
+	res := Simulate(SimConfig{
+		FileSize: 512 * types.MB,
+		Server:   SimServer{ConnBandwidth: 8 * types.MB, Spread: 0.9},
+		Runtime:  &types.RuntimeConfig{MaxConnectionsPerHost: 8},
+		Seed:     1,
+	})
+	if !res.Completed || res.Overlap != 0 {
+		t.Fatalf("incomplete or overlapping download: %+v", res)
+	}
+	if res.HealthCancels == 0 {
+		t.Errorf("connections ran at a tenth of the others without being cut off: %+v", res)
+	}
+}
+
+func TestSimulate_AdaptiveGrowsToPerConnectionLimit(t *testing.T) {
+	// Each connection is capped well below the link, so more connections help
+	res := Simulate(SimConfig{
+		FileSize: 2 * types.GB,
+		Server:   SimServer{ConnBandwidth: 2 * types.MB, TotalBandwidth: 64 * types.MB},
+		Runtime:  &types.RuntimeConfig{MaxConnectionsPerHost: 32, AdaptiveConnections: true},
+		Seed:     1,
+	})
+	if !res.Completed {
+		t.Fatalf("download did not complete: %+v", res)
+	}
+	if res.PeakConnections < 24 {
+		t.Errorf("peaked at %d connections, want close to 32", res.PeakConnections)
+	}
+}
+
+func TestSimulate_AdaptiveStaysLowOnSharedLink(t *testing.T) {
+	// Two connections already fill the link, so more don't pay
+	res := Simulate(SimConfig{
+		FileSize: 2 * types.GB,
+		Server:   SimServer{ConnBandwidth: 32 * types.MB, TotalBandwidth: 64 * types.MB},
+		Runtime:  &types.RuntimeConfig{MaxConnectionsPerHost: 32, AdaptiveConnections: true},
+		Seed:     1,
+	})
+	if !res.Completed {
+		t.Fatalf("download did not complete: %+v", res)
+	}
+	if res.PeakConnections > 3 {
+		t.Errorf("peaked at %d connections on a link two fill", res.PeakConnections)
+	}
+}
+
+func TestSimulate_AdaptiveBacksOffWhenThrottled(t *testing.T) {
+	cfg := SimConfig{
+		FileSize: 2 * types.GB,
+		Server:   SimServer{ConnBandwidth: 2 * types.MB, MaxConns: 6},
+		Runtime:  &types.RuntimeConfig{MaxConnectionsPerHost: 32},
+		Seed:     1,
+	}
+	fixed := Simulate(cfg)
+	cfg.Runtime = &types.RuntimeConfig{MaxConnectionsPerHost: 32, AdaptiveConnections: true}
+	adaptive := Simulate(cfg)
+	if !fixed.Completed || !adaptive.Completed {
+		t.Fatalf("download did not complete: %+v / %+v", fixed, adaptive)
+	}
+	if adaptive.Throttled >= fixed.Throttled/4 {
+		t.Errorf("adaptive hit 429 %d times, fixed %d: want far fewer", adaptive.Throttled, fixed.Throttled)
+	}
+}
+
+func TestSimulate_StealingKeepsConnectionsBusy(t *testing.T) {
+	srv := SimServer{ConnBandwidth: 4 * types.MB, Spread: 0.45, Latency: 300 * time.Millisecond}
+	const conns = 8
+	// A range under MinChunk isn't worth stealing, so a connection may wait
+	// out the slowest fetch of one, plus a request's latency
+	perConn := time.Duration(float64(types.MinChunk)/(srv.ConnBandwidth*(1-srv.Spread))*float64(time.Second)) + srv.Latency
+	for seed := uint64(1); seed <= 4; seed++ {
+		res := Simulate(SimConfig{
+			FileSize: types.GB,
+			Server:   srv,
+			Runtime:  &types.RuntimeConfig{MaxConnectionsPerHost: conns},
+			Seed:     seed,
+		})
+		if !res.Completed || res.Overlap != 0 {
+			t.Fatalf("seed %d: incomplete or overlapping download: %+v", seed, res)
+		}
+		if res.Steals == 0 {
+			t.Errorf("seed %d: nothing stolen at the end of the file: %+v", seed, res)
+		}
+		if res.Idle > conns*perConn {
+			t.Errorf("seed %d: connections idle for %v in all, want at most %v", seed, res.Idle, conns*perConn)
+		}
+	}
+}
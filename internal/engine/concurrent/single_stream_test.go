@@ -1,7 +1,8 @@
-package single
+package concurrent
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
@@ -11,6 +12,13 @@ import (
 	"github.com/surge-downloader/surge/internal/testutil"
 )
 
+// newSingleStreamDownloader creates a downloader forced into single-stream mode
+func newSingleStreamDownloader(id string, progressCh chan<- any, progState *types.ProgressState, runtime *types.RuntimeConfig) *ConcurrentDownloader {
+	d := NewConcurrentDownloader(id, progressCh, progState, runtime)
+	d.SingleStream = true
+	return d
+}
+
 func TestCopyFile(t *testing.T) {
 	tmpDir, cleanup, err := testutil.TempDir("surge-copy-test")
 	if err != nil {
@@ -53,6 +61,43 @@ func TestCopyFile(t *testing.T) {
 	}
 }
 
+func TestCopyFile_ReplacesSymlink(t *testing.T) {
+	tmpDir, cleanup, err := testutil.TempDir("surge-copy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	srcPath, err := testutil.CreateTestFile(tmpDir, "src.bin", 1024, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetPath, err := testutil.CreateTestFile(tmpDir, "target.bin", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstPath := filepath.Join(tmpDir, "dst.bin")
+	if err := os.Symlink(targetPath, dstPath); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if err := copyFile(srcPath, dstPath); err != nil {
+		t.Fatalf("copyFile failed: %v", err)
+	}
+
+	// The link is replaced by a regular file and its old target is untouched
+	info, err := os.Lstat(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Error("destination is still a symlink")
+	}
+	if err := testutil.VerifyFileSize(targetPath, 10); err != nil {
+		t.Errorf("symlink target was modified: %v", err)
+	}
+}
+
 func TestCopyFile_SourceNotExists(t *testing.T) {
 	tmpDir, cleanup, _ := testutil.TempDir("surge-copy-test")
 	defer cleanup()
@@ -134,11 +179,11 @@ func TestCopyFile_ContentVerification(t *testing.T) {
 }
 
 // =============================================================================
-// SingleDownloader - Streaming Server
+// Single stream - Streaming Server
 // =============================================================================
 
-func TestSingleDownloader_StreamingServer(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-stream-single")
+func TestSingleStream_StreamingServer(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	fileSize := int64(1 * types.MB)
@@ -151,12 +196,12 @@ func TestSingleDownloader_StreamingServer(t *testing.T) {
 	state := types.NewProgressState("stream-single", fileSize)
 	runtime := &types.RuntimeConfig{}
 
-	downloader := NewSingleDownloader("stream-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("stream-id", nil, state, runtime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	err := downloader.Download(ctx, server.URL(), destPath, fileSize, "stream.bin", false)
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
 	if err != nil {
 		t.Fatalf("Streaming download failed: %v", err)
 	}
@@ -167,11 +212,11 @@ func TestSingleDownloader_StreamingServer(t *testing.T) {
 }
 
 // =============================================================================
-// SingleDownloader - FailAfterBytes
+// Single stream - FailAfterBytes
 // =============================================================================
 
-func TestSingleDownloader_FailAfterBytes(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-failafter-single")
+func TestSingleStream_FailAfterBytes(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	fileSize := int64(256 * types.KB)
@@ -187,13 +232,13 @@ func TestSingleDownloader_FailAfterBytes(t *testing.T) {
 	state := types.NewProgressState("failafter-single", fileSize)
 	runtime := &types.RuntimeConfig{}
 
-	downloader := NewSingleDownloader("failafter-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("failafter-id", nil, state, runtime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := downloader.Download(ctx, server.URL(), destPath, fileSize, "failafter.bin", false)
-	// Should fail since SingleDownloader doesn't retry
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
+	// Should fail since every retry is cut short as well
 	if err == nil {
 		t.Error("Expected error when server fails mid-transfer")
 	}
@@ -206,11 +251,11 @@ func TestSingleDownloader_FailAfterBytes(t *testing.T) {
 }
 
 // =============================================================================
-// SingleDownloader - NilState handling
+// Single stream - NilState handling
 // =============================================================================
 
-func TestSingleDownloader_NilState(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-nilstate-single")
+func TestSingleStream_NilState(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	fileSize := int64(32 * types.KB)
@@ -224,12 +269,12 @@ func TestSingleDownloader_NilState(t *testing.T) {
 	runtime := &types.RuntimeConfig{}
 
 	// Create downloader with nil state
-	downloader := NewSingleDownloader("nilstate-id", nil, nil, runtime)
+	downloader := newSingleStreamDownloader("nilstate-id", nil, nil, runtime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := downloader.Download(ctx, server.URL(), destPath, fileSize, "nilstate.bin", false)
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
 	if err != nil {
 		t.Fatalf("Download with nil state failed: %v", err)
 	}
@@ -243,14 +288,17 @@ func TestSingleDownloader_NilState(t *testing.T) {
 // Restored Standard Tests
 // =============================================================================
 
-func TestNewSingleDownloader(t *testing.T) {
+func TestNewSingleStreamDownloader(t *testing.T) {
 	state := types.NewProgressState("test", 1000)
 	runtime := &types.RuntimeConfig{}
 
-	downloader := NewSingleDownloader("test-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("test-id", nil, state, runtime)
 
 	if downloader == nil {
-		t.Fatal("NewSingleDownloader returned nil")
+		t.Fatal("newSingleStreamDownloader returned nil")
+	}
+	if !downloader.SingleStream {
+		t.Error("SingleStream not set")
 	}
 	if downloader.ID != "test-id" {
 		t.Errorf("ID mismatch: got %s, want test-id", downloader.ID)
@@ -260,17 +308,14 @@ func TestNewSingleDownloader(t *testing.T) {
 	}
 }
 
-func TestSingleDownloader_Download_Success(t *testing.T) {
-	tmpDir, cleanup, err := testutil.TempDir("surge-single-test")
-	if err != nil {
-		t.Fatal(err)
-	}
+func TestSingleStream_Download_Success(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	fileSize := int64(64 * 1024) // 64KB
 	server := testutil.NewMockServer(
 		testutil.WithFileSize(fileSize),
-		testutil.WithRangeSupport(false), // SingleDownloader doesn't use ranges
+		testutil.WithRangeSupport(false), // Single stream doesn't use ranges
 		testutil.WithFilename("single_test.bin"),
 	)
 	defer server.Close()
@@ -279,12 +324,12 @@ func TestSingleDownloader_Download_Success(t *testing.T) {
 	state := types.NewProgressState("single-test", fileSize)
 	runtime := &types.RuntimeConfig{WorkerBufferSize: 8 * types.KB}
 
-	downloader := NewSingleDownloader("single-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("single-id", nil, state, runtime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err = downloader.Download(ctx, server.URL(), destPath, fileSize, "single_test.bin", false)
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
 	if err != nil {
 		t.Fatalf("Download failed: %v", err)
 	}
@@ -306,8 +351,8 @@ func TestSingleDownloader_Download_Success(t *testing.T) {
 	}
 }
 
-func TestSingleDownloader_Download_Cancellation(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-cancel-single")
+func TestSingleStream_Download_Cancellation(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	// Large file with latency
@@ -323,13 +368,13 @@ func TestSingleDownloader_Download_Cancellation(t *testing.T) {
 	state := types.NewProgressState("cancel-single", fileSize)
 	runtime := &types.RuntimeConfig{}
 
-	downloader := NewSingleDownloader("cancel-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("cancel-id", nil, state, runtime)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	done := make(chan error)
 	go func() {
-		done <- downloader.Download(ctx, server.URL(), destPath, fileSize, "cancel.bin", false)
+		done <- downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
 	}()
 
 	// Cancel after a short delay
@@ -347,8 +392,8 @@ func TestSingleDownloader_Download_Cancellation(t *testing.T) {
 	}
 }
 
-func TestSingleDownloader_Download_ProgressTracking(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-progress-single")
+func TestSingleStream_Download_ProgressTracking(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	fileSize := int64(256 * types.KB)
@@ -363,12 +408,12 @@ func TestSingleDownloader_Download_ProgressTracking(t *testing.T) {
 	state := types.NewProgressState("progress-single", fileSize)
 	runtime := &types.RuntimeConfig{WorkerBufferSize: 16 * types.KB}
 
-	downloader := NewSingleDownloader("progress-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("progress-id", nil, state, runtime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	err := downloader.Download(ctx, server.URL(), destPath, fileSize, "progress.bin", false)
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
 
 	if err != nil {
 		t.Fatalf("Download failed: %v", err)
@@ -381,34 +426,103 @@ func TestSingleDownloader_Download_ProgressTracking(t *testing.T) {
 	}
 }
 
-func TestSingleDownloader_Download_ServerError(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-error-single")
+func TestSingleStream_Download_ServerError(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
-	// Server that fails on first request
+	// Server that always fails
 	server := testutil.NewMockServer(
 		testutil.WithFileSize(1024),
-		testutil.WithFailOnNthRequest(1),
+		testutil.WithHandler(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
 	)
 	defer server.Close()
 
 	destPath := filepath.Join(tmpDir, "error_single.bin")
 	state := types.NewProgressState("error-single", 1024)
-	runtime := &types.RuntimeConfig{}
+	runtime := &types.RuntimeConfig{MaxTaskRetries: 2}
 
-	downloader := NewSingleDownloader("error-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("error-id", nil, state, runtime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := downloader.Download(ctx, server.URL(), destPath, 1024, "error.bin", false)
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, 1024, false)
 	if err == nil {
 		t.Error("Expected error from failed server")
 	}
 }
 
-func TestSingleDownloader_Download_WithLatency(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-latency-single")
+func TestSingleStream_Download_RetriesTransientError(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(32 * types.KB)
+	// First request fails, the retry succeeds
+	server := testutil.NewMockServer(
+		testutil.WithFileSize(fileSize),
+		testutil.WithRangeSupport(false),
+		testutil.WithFailOnNthRequest(1),
+	)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "retry_single.bin")
+	state := types.NewProgressState("retry-single", fileSize)
+	runtime := &types.RuntimeConfig{}
+
+	downloader := newSingleStreamDownloader("retry-id", nil, state, runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download should succeed after retry: %v", err)
+	}
+
+	if err := testutil.VerifyFileSize(destPath, fileSize); err != nil {
+		t.Error(err)
+	}
+	if state.Downloaded.Load() != fileSize {
+		t.Errorf("Downloaded %d != fileSize %d", state.Downloaded.Load(), fileSize)
+	}
+}
+
+func TestSingleStream_UnknownSize(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	bodySize := int64(64 * types.KB)
+	server := testutil.NewMockServer(
+		testutil.WithFileSize(bodySize),
+		testutil.WithRangeSupport(false),
+	)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "unknown_size.bin")
+	state := types.NewProgressState("unknown-size", 0)
+	runtime := &types.RuntimeConfig{}
+
+	// A zero size forces single-stream mode even without the flag
+	downloader := NewConcurrentDownloader("unknown-id", nil, state, runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := downloader.Download(ctx, server.URL(), nil, nil, destPath, 0, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if !downloader.SingleStream {
+		t.Error("Expected single-stream mode for unknown size")
+	}
+	if err := testutil.VerifyFileSize(destPath, bodySize); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSingleStream_Download_WithLatency(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	fileSize := int64(32 * types.KB)
@@ -423,13 +537,13 @@ func TestSingleDownloader_Download_WithLatency(t *testing.T) {
 	state := types.NewProgressState("latency-single", fileSize)
 	runtime := &types.RuntimeConfig{}
 
-	downloader := NewSingleDownloader("latency-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("latency-id", nil, state, runtime)
 
 	start := time.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := downloader.Download(ctx, server.URL(), destPath, fileSize, "latency.bin", false)
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
 	elapsed := time.Since(start)
 
 	if err != nil {
@@ -445,8 +559,8 @@ func TestSingleDownloader_Download_WithLatency(t *testing.T) {
 	}
 }
 
-func TestSingleDownloader_Download_ContentIntegrity(t *testing.T) {
-	tmpDir, cleanup, _ := testutil.TempDir("surge-content-single")
+func TestSingleStream_Download_ContentIntegrity(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
 	defer cleanup()
 
 	fileSize := int64(64 * types.KB)
@@ -461,12 +575,12 @@ func TestSingleDownloader_Download_ContentIntegrity(t *testing.T) {
 	state := types.NewProgressState("content-single", fileSize)
 	runtime := &types.RuntimeConfig{}
 
-	downloader := NewSingleDownloader("content-id", nil, state, runtime)
+	downloader := newSingleStreamDownloader("content-id", nil, state, runtime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := downloader.Download(ctx, server.URL(), destPath, fileSize, "content.bin", false)
+	err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false)
 	if err != nil {
 		t.Fatalf("Download failed: %v", err)
 	}
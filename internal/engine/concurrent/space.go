@@ -0,0 +1,48 @@
+package concurrent
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/platform"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// freeSpaceMargin is kept free beyond the download itself, for its resume
+// state and whatever else writes to the disk meanwhile
+const freeSpaceMargin = 16 << 20
+
+// spaceNeeded returns how many more bytes a fresh download of fileSize into
+// out takes on disk. Part files are copied into the real file at the end, so
+// they need room for the file twice. A leftover working file is reused.
+func spaceNeeded(out output, fileSize int64) int64 {
+	switch out := out.(type) {
+	case *os.File:
+		if info, err := out.Stat(); err == nil {
+			return max(fileSize-info.Size(), 0)
+		}
+	case *partFiles:
+		return 2 * fileSize
+	}
+	return fileSize
+}
+
+// checkFreeSpace fails with types.ErrInsufficientSpace when the filesystem
+// holding dir has less than need bytes free, plus a margin. A filesystem
+// whose free space cannot be read passes.
+func checkFreeSpace(dir string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+	free, err := platform.FreeSpace(utils.LongPath(dir))
+	if err != nil {
+		utils.Debug("Free space check skipped: %v", err)
+		return nil
+	}
+	if free < need+freeSpaceMargin {
+		return fmt.Errorf("%w: %s needed in %s, %s free", types.ErrInsufficientSpace,
+			utils.ConvertBytesToHumanReadable(need), dir, utils.ConvertBytesToHumanReadable(free))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package concurrent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/platform"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	free, err := platform.FreeSpace(dir)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	if err := checkFreeSpace(dir, 1<<20); err != nil {
+		t.Errorf("1 MB did not fit: %v", err)
+	}
+	if err := checkFreeSpace(dir, free+1); !errors.Is(err, types.ErrInsufficientSpace) {
+		t.Errorf("more than is free: got %v, want ErrInsufficientSpace", err)
+	}
+	if err := checkFreeSpace(filepath.Join(dir, "missing"), free+1); err != nil {
+		t.Errorf("unreadable free space should pass, got %v", err)
+	}
+}
+
+func TestSpaceNeeded(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "file.surge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got := spaceNeeded(f, 1000); got != 1000 {
+		t.Errorf("new file needs %d, want 1000", got)
+	}
+	f.Truncate(600) // Left over from an earlier try
+	if got := spaceNeeded(f, 1000); got != 400 {
+		t.Errorf("leftover file needs %d, want 400", got)
+	}
+
+	parts, err := openPartFiles(filepath.Join(dir, "parts.surge"), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parts.Close()
+	if got := spaceNeeded(parts, 1000); got != 2000 {
+		t.Errorf("part files need %d, want room for the merge too", got)
+	}
+}
+
+func TestConcurrentDownloader_SparseFile(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(2 * types.MB)
+	server := testutil.NewMockServer(
+		testutil.WithFileSize(fileSize),
+		testutil.WithRangeSupport(true),
+	)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "sparse.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, SparseFiles: true}
+	downloader := NewConcurrentDownloader("test-id", nil, types.NewProgressState("test-id", fileSize), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := downloader.Download(ctx, server.URL(), nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if err := testutil.VerifyFileSize(destPath, fileSize); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentDownloader_NoRoom(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+	free, err := platform.FreeSpace(tmpDir)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "huge.iso")
+	fileSize := 2 * free
+	downloader := NewConcurrentDownloader("test-id", nil, types.NewProgressState("test-id", fileSize), &types.RuntimeConfig{})
+	err = downloader.Download(context.Background(), server.URL, nil, nil, destPath, fileSize, false)
+	if !errors.Is(err, types.ErrInsufficientSpace) {
+		t.Fatalf("Download() = %v, want ErrInsufficientSpace", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("%d requests made for a download that does not fit", n)
+	}
+}
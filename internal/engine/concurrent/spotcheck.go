@@ -0,0 +1,89 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// spotCheckWindow picks the byte range to re-verify on resume: the trailing
+// window (up to size bytes) of the last already-downloaded region, i.e. the
+// data written most recently before the pause. ok is false if nothing has been
+// downloaded yet.
+func spotCheckWindow(remaining []types.Task, fileSize, size int64) (offset, length int64, ok bool) {
+	tasks := append([]types.Task(nil), remaining...)
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Offset < tasks[j].Offset })
+
+	// Walk the gaps between remaining tasks; each gap is downloaded data
+	var regionStart, regionEnd int64
+	cursor := int64(0)
+	for _, t := range tasks {
+		if t.Offset > cursor {
+			regionStart, regionEnd = cursor, t.Offset
+		}
+		if end := t.Offset + t.Length; end > cursor {
+			cursor = end
+		}
+	}
+	if fileSize > cursor {
+		regionStart, regionEnd = cursor, fileSize
+	}
+
+	if regionEnd <= regionStart {
+		return 0, 0, false
+	}
+	length = min(size, regionEnd-regionStart)
+	return regionEnd - length, length, true
+}
+
+// resumeDataChanged re-downloads a small window of already-saved data and
+// compares it with the working file. It reports true if the server now serves
+// different bytes, meaning the file changed without its validators changing.
+// Errors mean the check could not be performed, not that the data differs.
+func (d *ConcurrentDownloader) resumeDataChanged(ctx context.Context, client *http.Client, rawurl string, file output, remaining []types.Task, fileSize int64) (bool, error) {
+	offset, length, ok := spotCheckWindow(remaining, fileSize, types.ResumeSpotCheckSize)
+	if !ok {
+		return false, nil
+	}
+
+	local := make([]byte, length)
+	if _, err := file.ReadAt(local, offset); err != nil {
+		return false, fmt.Errorf("read saved data: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	if err := d.Runtime.AddHeaders(req); err != nil {
+		return false, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return false, types.NewHTTPError(rawurl, resp)
+	}
+
+	remote := make([]byte, length)
+	if _, err := io.ReadFull(resp.Body, remote); err != nil {
+		// A short body for a range inside the known size means the file shrank
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return !bytes.Equal(local, remote), nil
+}
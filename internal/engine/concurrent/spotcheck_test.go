@@ -0,0 +1,133 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestSpotCheckWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		tasks      []types.Task
+		fileSize   int64
+		wantOffset int64
+		wantLength int64
+		wantOK     bool
+	}{
+		{"nothing downloaded", []types.Task{{Offset: 0, Length: 100}}, 100, 0, 0, false},
+		{"prefix downloaded", []types.Task{{Offset: 60, Length: 40}}, 100, 50, 10, true},
+		{"short region", []types.Task{{Offset: 5, Length: 95}}, 100, 0, 5, true},
+		{"last gap wins", []types.Task{{Offset: 70, Length: 10}, {Offset: 0, Length: 20}, {Offset: 40, Length: 10}}, 100, 90, 10, true},
+		{"tail downloaded", []types.Task{{Offset: 0, Length: 30}}, 100, 90, 10, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, length, ok := spotCheckWindow(tt.tasks, tt.fileSize, 10)
+			if ok != tt.wantOK || offset != tt.wantOffset || length != tt.wantLength {
+				t.Errorf("spotCheckWindow = (%d, %d, %v), want (%d, %d, %v)",
+					offset, length, ok, tt.wantOffset, tt.wantLength, tt.wantOK)
+			}
+		})
+	}
+}
+
+// rangeServer serves content with range support via http.ServeContent
+func rangeServer(content *[]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(*content))
+	}))
+}
+
+func testContent(size int, seed byte) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*7) + seed
+	}
+	return data
+}
+
+func TestResumeDataChanged(t *testing.T) {
+	tmpDir := t.TempDir()
+	size := 256 * types.KB
+	content := testContent(size, 0)
+	server := rangeServer(&content)
+	defer server.Close()
+
+	// First half is on disk, second half still to do
+	path := filepath.Join(tmpDir, "file.bin.surge")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	remaining := []types.Task{{Offset: int64(size / 2), Length: int64(size / 2)}}
+
+	d := NewConcurrentDownloader("spot", nil, nil, &types.RuntimeConfig{})
+	changed, err := d.resumeDataChanged(context.Background(), http.DefaultClient, server.URL, file, remaining, int64(size))
+	if err != nil || changed {
+		t.Fatalf("unchanged server: changed=%v err=%v", changed, err)
+	}
+
+	content = testContent(size, 1)
+	changed, err = d.resumeDataChanged(context.Background(), http.DefaultClient, server.URL, file, remaining, int64(size))
+	if err != nil || !changed {
+		t.Fatalf("changed server: changed=%v err=%v", changed, err)
+	}
+}
+
+func TestDownload_ResumeRestartsWhenServerContentChanged(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	size := 512 * types.KB
+	content := testContent(size, 3)
+	server := rangeServer(&content)
+	defer server.Close()
+
+	// Simulate a paused download whose first half came from an older version
+	destPath := filepath.Join(tmpDir, "changed.bin")
+	stale := testContent(size, 9)
+	if err := os.WriteFile(destPath+types.IncompleteSuffix, stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+	half := int64(size / 2)
+	if err := state.SaveState(server.URL, destPath, &types.DownloadState{
+		URL:        server.URL,
+		DestPath:   destPath,
+		TotalSize:  int64(size),
+		Downloaded: half,
+		Tasks:      []types.Task{{Offset: half, Length: half}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := types.NewProgressState("changed", int64(size))
+	d := NewConcurrentDownloader("changed", nil, progress, &types.RuntimeConfig{MaxConnectionsPerHost: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, int64(size), false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("resumed file does not match server content; stale data was kept")
+	}
+}
@@ -97,7 +97,7 @@ func TestConcurrentDownloader_BackoffOnSingleMirror(t *testing.T) {
 	state := types.NewProgressState("backoff-test", fileSize)
 
 	// Runtime with 1 connection and retries
-	// RetryBaseDelay is 200ms by default in types
+	// RetryBaseDelay is 400ms by default in types
 	runtime := &types.RuntimeConfig{
 		MaxConnectionsPerHost: 1,
 		MaxTaskRetries:        5,
@@ -123,7 +123,7 @@ func TestConcurrentDownloader_BackoffOnSingleMirror(t *testing.T) {
 
 	// Verification:
 	// We experienced 1 failure (429).
-	// Attempt 1 backoff = 2^1 * BaseDelay (200ms) = 400ms.
+	// Attempt 1 backoff = BaseDelay (400ms) +/- 20% jitter.
 	// So it should be > 200ms.
 	if elapsed < 200*time.Millisecond {
 		t.Errorf("Download took %v, but expected backoff wait (should be > 200ms)", elapsed)
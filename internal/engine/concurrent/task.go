@@ -17,6 +17,7 @@ type ActiveTask struct {
 
 	// Health monitoring fields
 	LastActivity int64              // Atomic: Unix nano timestamp of last data received
+	ResponseAt   int64              // Atomic: Unix nano timestamp the response headers arrived, 0 before
 	Speed        float64            // EMA-smoothed speed in bytes/sec (protected by mutex)
 	StartTime    time.Time          // When this task started
 	Cancel       context.CancelFunc // Cancel function to abort this task
@@ -47,6 +48,30 @@ func (at *ActiveTask) RemainingTask() *types.Task {
 	return &types.Task{Offset: current, Length: stopAt - current}
 }
 
+// speedWindow is how long bytes are counted before they move the EMA speed
+const speedWindow = 2 * time.Second
+
+// updateSpeed folds the bytes of the current window into the EMA speed once
+// the window is speedWindow long, then starts a new one. Only the task's own
+// worker calls it.
+func (at *ActiveTask) updateSpeed(now time.Time, alpha float64) {
+	elapsed := now.Sub(at.WindowStart)
+	if elapsed < speedWindow {
+		return
+	}
+	recentSpeed := float64(atomic.SwapInt64(&at.WindowBytes, 0)) / elapsed.Seconds()
+
+	at.SpeedMu.Lock()
+	if at.Speed == 0 {
+		at.Speed = recentSpeed
+	} else {
+		at.Speed = (1-alpha)*at.Speed + alpha*recentSpeed
+	}
+	at.SpeedMu.Unlock()
+
+	at.WindowStart = now // Reset window
+}
+
 // GetSpeed returns the current EMA-smoothed speed
 func (at *ActiveTask) GetSpeed() float64 {
 	at.SpeedMu.Lock()
@@ -63,3 +88,43 @@ func alignedSplitSize(remaining int64) int64 {
 	}
 	return half
 }
+
+// stealSplit returns how much of remaining a task fetching at speed keeps
+// when a connection expected to fetch at thiefSpeed takes the rest, so that
+// both finish together. Without both speeds it splits in half. Returns 0 if
+// the part taken would be smaller than MinChunk.
+func stealSplit(remaining int64, speed, thiefSpeed float64) int64 {
+	if speed <= 0 || thiefSpeed <= 0 {
+		return alignedSplitSize(remaining)
+	}
+	keep := int64(float64(remaining) * speed / (speed + thiefSpeed))
+	keep = max((keep/types.AlignSize)*types.AlignSize, types.AlignSize)
+	if remaining-keep < types.MinChunk {
+		return 0
+	}
+	return keep
+}
+
+// splitForRetry breaks a range that exhausted its retry budget into up to
+// parts pieces, aligned to AlignSize and no smaller than minChunk, so several
+// connections (and mirrors) can each take a share. A range too small to split
+// is returned whole.
+func splitForRetry(task types.Task, parts int, minChunk int64) []types.Task {
+	// Compared as int64: the quotient of a huge range overflows a 32-bit int
+	if maxParts := task.Length / minChunk; int64(parts) > maxParts {
+		parts = int(maxParts)
+	}
+	size := (task.Length / int64(max(parts, 1)) / types.AlignSize) * types.AlignSize
+	if parts < 2 || size == 0 {
+		return []types.Task{task}
+	}
+
+	pieces := make([]types.Task, 0, parts)
+	offset := task.Offset
+	end := task.Offset + task.Length
+	for i := 0; i < parts-1; i++ {
+		pieces = append(pieces, types.Task{Offset: offset, Length: size})
+		offset += size
+	}
+	return append(pieces, types.Task{Offset: offset, Length: end - offset})
+}
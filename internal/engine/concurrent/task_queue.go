@@ -14,11 +14,16 @@ type TaskQueue struct {
 	mu          sync.Mutex
 	cond        *sync.Cond
 	done        bool
-	idleWorkers int64 // Atomic counter for idle workers
+	closed      chan struct{} // Closed by Close, for waits outside the queue
+	idleWorkers int64         // Atomic counter for idle workers
+
+	// claims holds the range each worker is responsible for, from Claim
+	// until Release, so checkpoints never lose a task in transit
+	claims map[int]types.Task
 }
 
 func NewTaskQueue() *TaskQueue {
-	tq := &TaskQueue{}
+	tq := &TaskQueue{claims: make(map[int]types.Task), closed: make(chan struct{})}
 	tq.cond = sync.NewCond(&tq.mu)
 	return tq
 }
@@ -38,6 +43,17 @@ func (q *TaskQueue) PushMultiple(tasks []types.Task) {
 }
 
 func (q *TaskQueue) Pop() (types.Task, bool) {
+	return q.pop(-1)
+}
+
+// Claim pops the next task on behalf of worker and records it as the
+// worker's until Release
+func (q *TaskQueue) Claim(worker int) (types.Task, bool) {
+	return q.pop(worker)
+}
+
+// pop takes the next task, claiming it for worker unless worker is negative
+func (q *TaskQueue) pop(worker int) (types.Task, bool) {
 	// Mark as idle while waiting
 	atomic.AddInt64(&q.idleWorkers, 1)
 
@@ -51,6 +67,12 @@ func (q *TaskQueue) Pop() (types.Task, bool) {
 	// No longer idle once we have work (or are done)
 	atomic.AddInt64(&q.idleWorkers, -1)
 
+	return q.takeLocked(worker)
+}
+
+// takeLocked removes the next task, claiming it for worker unless worker is
+// negative. q.mu must be held.
+func (q *TaskQueue) takeLocked(worker int) (types.Task, bool) {
 	if len(q.tasks) == 0 {
 		return types.Task{}, false
 	}
@@ -61,12 +83,40 @@ func (q *TaskQueue) Pop() (types.Task, bool) {
 		q.tasks = append([]types.Task(nil), q.tasks[q.head:]...)
 		q.head = 0
 	}
+	if worker >= 0 {
+		q.claims[worker] = t
+	}
 	return t, true
 }
 
+// tryClaim is Claim without waiting: it reports false at once when the
+// queue is empty
+func (q *TaskQueue) tryClaim(worker int) (types.Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.takeLocked(worker)
+}
+
+// UpdateClaim narrows worker's claim to t when it retries part of its task
+func (q *TaskQueue) UpdateClaim(worker int, t types.Task) {
+	q.mu.Lock()
+	q.claims[worker] = t
+	q.mu.Unlock()
+}
+
+// Release drops worker's claim once its task is done or back in the queue
+func (q *TaskQueue) Release(worker int) {
+	q.mu.Lock()
+	delete(q.claims, worker)
+	q.mu.Unlock()
+}
+
 func (q *TaskQueue) Close() {
 	q.mu.Lock()
-	q.done = true
+	if !q.done {
+		q.done = true
+		close(q.closed)
+	}
 	q.cond.Broadcast()
 	q.mu.Unlock()
 }
@@ -97,6 +147,19 @@ func (q *TaskQueue) DrainRemaining() []types.Task {
 	return remaining
 }
 
+// Snapshot returns the queued and claimed tasks without removing them. The
+// caller adjusts claims by how far their workers have got.
+func (q *TaskQueue) Snapshot() (queued []types.Task, claims map[int]types.Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queued = append([]types.Task(nil), q.tasks[q.head:]...)
+	claims = make(map[int]types.Task, len(q.claims))
+	for w, t := range q.claims {
+		claims[w] = t
+	}
+	return queued, claims
+}
+
 // SplitLargestIfNeeded finds the largest queued task and splits it if > 2*MinChunk
 // Returns true if a split occurred
 func (q *TaskQueue) SplitLargestIfNeeded() bool {
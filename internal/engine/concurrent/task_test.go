@@ -2,6 +2,7 @@ package concurrent
 
 import (
 	"context"
+	"math"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -142,3 +143,140 @@ func TestActiveTask_WindowTracking(t *testing.T) {
 		t.Errorf("WindowBytes after swap = %d, want 0", at.WindowBytes)
 	}
 }
+
+func TestSplitForRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		task      types.Task
+		parts     int
+		minChunk  int64
+		wantCount int
+	}{
+		{"even split", types.Task{Offset: 0, Length: 4 * types.MB}, 4, 256 * types.KB, 4},
+		{"limited by min chunk", types.Task{Offset: 0, Length: 600 * types.KB}, 4, 256 * types.KB, 2},
+		{"too small to split", types.Task{Offset: 0, Length: 300 * types.KB}, 4, 256 * types.KB, 1},
+		{"unaligned offset", types.Task{Offset: 12345, Length: 3*types.MB + 7}, 4, 256 * types.KB, 4},
+		{"past 4 GiB", types.Task{Offset: 4 << 30, Length: 5 << 30}, 4, 256 * types.KB, 4},
+		{"huge range", types.Task{Offset: 0, Length: math.MaxInt64}, 4, 1, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pieces := splitForRetry(tt.task, tt.parts, tt.minChunk)
+			if len(pieces) != tt.wantCount {
+				t.Fatalf("got %d pieces, want %d", len(pieces), tt.wantCount)
+			}
+
+			// Pieces must tile the original range exactly
+			offset := tt.task.Offset
+			for i, p := range pieces {
+				if p.Offset != offset {
+					t.Errorf("piece %d starts at %d, want %d", i, p.Offset, offset)
+				}
+				if len(pieces) > 1 && p.Length < tt.minChunk {
+					t.Errorf("piece %d is %d bytes, below min %d", i, p.Length, tt.minChunk)
+				}
+				offset += p.Length
+			}
+			if offset != tt.task.Offset+tt.task.Length {
+				t.Errorf("pieces end at %d, want %d", offset, tt.task.Offset+tt.task.Length)
+			}
+		})
+	}
+}
+
+func TestStealWork_CountsAndTaskStats(t *testing.T) {
+	state := types.NewProgressState("steal", 64*types.MB)
+	d := NewConcurrentDownloader("steal", nil, state, &types.RuntimeConfig{})
+	for id, off := range map[int]int64{2: 0, 0: 32 * types.MB, 1: 48 * types.MB} {
+		d.activeTasks[id] = &ActiveTask{
+			Task:          types.Task{Offset: off, Length: 16 * types.MB},
+			CurrentOffset: off,
+			StopAt:        off + 16*types.MB,
+			Speed:         float64(id+1) * types.MB,
+		}
+	}
+
+	queue := NewTaskQueue()
+	// Equal remaining everywhere: the slowest worker, 0, is furthest from
+	// done and keeps a third, what it fetches while the mean speed of 2 MB/s
+	// fetches the rest
+	if !d.StealWork(queue) {
+		t.Fatal("nothing stolen")
+	}
+	if got := state.Steals.Load(); got != 1 {
+		t.Errorf("Steals = %d, want 1", got)
+	}
+	keep := stealSplit(16*types.MB, types.MB, 2*types.MB)
+	if stolen, _ := queue.Pop(); stolen.Offset != 32*types.MB+keep {
+		t.Errorf("stole from offset %d, want worker 0's tail at %d", stolen.Offset, 32*types.MB+keep)
+	}
+
+	tasks, target := d.taskStats()
+	if target != 0 {
+		t.Errorf("target = %d without adaptive tuning", target)
+	}
+	if len(tasks) != 3 || tasks[0].Worker != 0 || tasks[1].Worker != 1 || tasks[2].Worker != 2 {
+		t.Fatalf("tasks not in worker order: %+v", tasks)
+	}
+	if tasks[0].Remaining != keep || tasks[2].Speed != 3*types.MB {
+		t.Errorf("unexpected task stats: %+v", tasks)
+	}
+}
+
+func TestStealSplit(t *testing.T) {
+	tests := []struct {
+		name         string
+		remaining    int64
+		speed, thief float64
+		wantKeep     int64
+	}{
+		{"no speeds splits in half", 16 * types.MB, 0, 0, 8 * types.MB},
+		{"equal speeds split in half", 16 * types.MB, types.MB, types.MB, 8 * types.MB},
+		{"slow victim keeps a quarter", 16 * types.MB, types.MB, 3 * types.MB, 4 * types.MB},
+		{"fast victim keeps three quarters", 16 * types.MB, 3 * types.MB, types.MB, 12 * types.MB},
+		{"stolen part under MinChunk", 16 * types.MB, 15 * types.MB, types.MB, 0},
+		{"stalled victim keeps one block", 16 * types.MB, 1, 10 * types.MB, types.AlignSize},
+		{"too small", types.MinChunk, types.MB, types.MB, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stealSplit(tt.remaining, tt.speed, tt.thief); got != tt.wantKeep {
+				t.Errorf("stealSplit = %d, want %d", got, tt.wantKeep)
+			}
+		})
+	}
+}
+
+func TestStealWork_PrefersSlowestToFinish(t *testing.T) {
+	d := NewConcurrentDownloader("steal", nil, nil, &types.RuntimeConfig{})
+	// Worker 0 has more bytes left but finishes in 4s; worker 1 needs 16s
+	d.activeTasks[0] = &ActiveTask{
+		Task:          types.Task{Offset: 0, Length: 32 * types.MB},
+		CurrentOffset: 0,
+		StopAt:        32 * types.MB,
+		Speed:         8 * types.MB,
+	}
+	d.activeTasks[1] = &ActiveTask{
+		Task:          types.Task{Offset: 32 * types.MB, Length: 16 * types.MB},
+		CurrentOffset: 32 * types.MB,
+		StopAt:        48 * types.MB,
+		Speed:         types.MB,
+	}
+
+	queue := NewTaskQueue()
+	if !d.StealWork(queue) {
+		t.Fatal("nothing stolen")
+	}
+	stolen, _ := queue.Pop()
+	if stolen.Offset < 32*types.MB || stolen.Offset+stolen.Length != 48*types.MB {
+		t.Fatalf("stole %d-%d, want the tail of worker 1", stolen.Offset, stolen.Offset+stolen.Length)
+	}
+	// Against a mean of 4.5 MB/s the slow worker keeps under a fifth
+	if kept := stolen.Offset - 32*types.MB; kept > 16*types.MB/5 {
+		t.Errorf("slow worker kept %d bytes", kept)
+	}
+	if got := atomic.LoadInt64(&d.activeTasks[1].StopAt); got != stolen.Offset {
+		t.Errorf("worker 1 stops at %d, want %d", got, stolen.Offset)
+	}
+}
@@ -2,10 +2,13 @@ package concurrent
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
-	"os"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -13,8 +16,23 @@ import (
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
+// errWorkerRetired is returned by a worker that left because an adaptive
+// download no longer needs it
+var errWorkerRetired = errors.New("worker retired")
+
 // worker downloads tasks from the queue
-func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []string, file *os.File, queue *TaskQueue, totalSize int64, startTime time.Time, verbose bool, client *http.Client) error {
+func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors *mirrorPool, file output, queue *TaskQueue, totalSize int64, startTime time.Time, verbose bool, client *http.Client) error {
+	// Count the buffer against the process-wide budget. Workers beyond the
+	// first wait for memory, and give up if the download ends meanwhile.
+	bufSize := int64(d.Runtime.GetWorkerBufferSize())
+	if id == 0 {
+		buffers.reserve(bufSize)
+	} else if !buffers.acquire(ctx, bufSize, d.Runtime.GetMaxBufferMemory(), queue.closed) {
+		utils.Debug("Worker %d never got buffer memory", id)
+		return ctx.Err()
+	}
+	defer buffers.release(bufSize)
+
 	// Get pooled buffer
 	bufPtr := d.bufPool.Get().(*[]byte)
 	defer d.bufPool.Put(bufPtr)
@@ -24,40 +42,51 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 	defer utils.Debug("Worker %d finished", id)
 
 	// Initial mirror assignment: Round Robin based on ID
-	currentMirrorIdx := id % len(mirrors)
+	currentMirrorIdx := mirrors.pick(id)
 
 	for {
+		// The tuner or the pool's limit may have dropped below this worker
+		if d.tuner != nil && !d.tuner.keep(id) {
+			return errWorkerRetired
+		}
+
+		// Out of queued work: take the tail of the slowest task now rather
+		// than wait for the balancer's next tick
+		if !d.SingleStream && queue.Len() == 0 {
+			d.StealWork(queue)
+		}
+
 		// Get next task
-		task, ok := queue.Pop()
+		task, ok := queue.Claim(id)
 
 		if !ok {
 			return nil // Queue closed, no more work
 		}
 
-		// Update active workers
-		if d.State != nil {
-			d.State.ActiveWorkers.Add(1)
-		}
-
 		var lastErr error
+		var attempts []string
 		maxRetries := d.Runtime.GetMaxTaskRetries()
 		for attempt := 0; attempt < maxRetries; attempt++ {
 			if attempt > 0 {
-
-				if len(mirrors) == 1 {
-					time.Sleep(time.Duration(1<<attempt) * types.RetryBaseDelay) //Exponential backoff incase of failure
+				if d.State != nil {
+					d.State.Retries.Add(1)
+				}
+				if !d.retryBackoff(ctx, attempt, mirrors.live()) {
+					// Paused while waiting: hand the task back so it is saved
+					queue.Push(task)
+					queue.Release(id)
+					return ctx.Err()
 				}
 
 				// FAILOVER: Switch mirror on retry
-				// Report error for the previous mirror
-				d.ReportMirrorError(mirrors[currentMirrorIdx])
+				d.failMirror(mirrors, currentMirrorIdx)
 
-				currentMirrorIdx = (currentMirrorIdx + 1) % len(mirrors)
-				utils.Debug("Worker %d: switching to mirror %s (attempt %d)", id, mirrors[currentMirrorIdx], attempt+1)
+				currentMirrorIdx = mirrors.next(currentMirrorIdx)
+				utils.Debug("Worker %d: switching to mirror %s (attempt %d)", id, mirrors.url(currentMirrorIdx), attempt+1)
 			}
 
 			// Use current mirror
-			currentURL := mirrors[currentMirrorIdx]
+			currentURL := mirrors.url(currentMirrorIdx)
 
 			// Register active task with per-task cancellable context
 			taskCtx, taskCancel := context.WithCancel(ctx)
@@ -82,32 +111,53 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 
 			taskStart := time.Now()
 			lastErr = d.downloadTask(taskCtx, currentURL, file, activeTask, buf, verbose, client, totalSize)
+			if d.tuner != nil && isThrottle(lastErr) {
+				d.tuner.throttle()
+			}
 
 			// CRITICAL: Capture external cancellation state BEFORE calling taskCancel()
 			// If we call taskCancel() first, taskCtx.Err() will always be non-nil
 			wasExternallyCancelled := taskCtx.Err() != nil
 
 			taskCancel() // Clean up context resources
+			if d.State != nil {
+				var ttfb time.Duration
+				if at := atomic.LoadInt64(&activeTask.ResponseAt); at > 0 {
+					ttfb = time.Unix(0, at).Sub(taskStart)
+				}
+				fetched := atomic.LoadInt64(&activeTask.CurrentOffset) - task.Offset
+				d.State.RecordRequest(id, fetched, time.Since(taskStart), ttfb, attempt > 0)
+			}
 			utils.Debug("Worker %d: Task offset=%d length=%d took %v", id, task.Offset, task.Length, time.Since(taskStart))
 
 			// Check for PARENT context cancellation (pause/shutdown)
 			// This preserves active task info for pause handler to collect
 			if ctx.Err() != nil {
 				// DON'T delete from activeTasks - pause handler needs it
-				if d.State != nil {
-					d.State.ActiveWorkers.Add(-1)
-				}
 				return ctx.Err()
 			}
 
+			// Retrying can't help once the file changed: the bytes so far
+			// are from the old one
+			if errors.Is(lastErr, types.ErrSourceChanged) {
+				d.activeMu.Lock()
+				delete(d.activeTasks, id)
+				d.activeMu.Unlock()
+				return lastErr
+			}
+
 			// Check if TASK context was cancelled by Health Monitor (not by us calling taskCancel)
 			// but parent context is still fine
 			if wasExternallyCancelled && lastErr != nil {
 				// Health monitor cancelled this task - re-queue REMAINING work only
 
 				// Force rotation to next mirror to avoid getting stuck on the slow one
-				currentMirrorIdx = (currentMirrorIdx + 1) % len(mirrors)
-				utils.Debug("Worker %d: Health check cancelled task, rotating from mirror %s to %s", id, mirrors[(currentMirrorIdx+len(mirrors)-1)%len(mirrors)], mirrors[currentMirrorIdx])
+				slowMirrorIdx := currentMirrorIdx
+				if mirrors.live() > 1 {
+					d.failMirror(mirrors, slowMirrorIdx)
+				}
+				currentMirrorIdx = mirrors.next(slowMirrorIdx)
+				utils.Debug("Worker %d: Health check cancelled task, rotating from mirror %s to %s", id, mirrors.url(slowMirrorIdx), mirrors.url(currentMirrorIdx))
 
 				if remaining := activeTask.RemainingTask(); remaining != nil {
 					// Clamp to original task end (don't go past original boundary)
@@ -117,6 +167,9 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 					}
 					if remaining.Length > 0 {
 						queue.Push(*remaining)
+						if d.State != nil {
+							d.State.Reassignments.Add(1)
+						}
 						utils.Debug("Worker %d: health-cancelled task requeued (remaining: %d bytes from offset %d)",
 							id, remaining.Length, remaining.Offset)
 					}
@@ -136,6 +189,7 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 			d.activeMu.Unlock()
 
 			if lastErr == nil {
+				mirrors.succeed(currentMirrorIdx)
 				// Check if we stopped early due to stealing
 				stopAt := atomic.LoadInt64(&activeTask.StopAt)
 				current := atomic.LoadInt64(&activeTask.CurrentOffset)
@@ -145,32 +199,42 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 				}
 				break
 			}
+			attempts = append(attempts, lastErr.Error())
 
 			// Resume-on-retry: update task to reflect remaining work
 			// This prevents double-counting bytes on retry
 			current := atomic.LoadInt64(&activeTask.CurrentOffset)
-			if current > task.Offset {
+			if d.SingleStream {
+				// No ranges: the retry re-reads the body from the start, so drop the partial bytes
+				if d.State != nil && current > task.Offset {
+					d.State.Downloaded.Add(task.Offset - current)
+				}
+			} else if current > task.Offset {
 				task = types.Task{Offset: current, Length: task.Offset + task.Length - current}
+				queue.UpdateClaim(id, task)
 			}
 		}
 
-		// Update active workers
-		if d.State != nil {
-			d.State.ActiveWorkers.Add(-1)
-		}
-
 		if lastErr != nil {
-			// Log failed task but continue with next task
-			// If we modified StopAt we should probably reset it or push the remaining part?
-			// TODO: Could optimize by pushing only remaining part if we track that.
-			queue.Push(task)
-			utils.Debug("task at offset %d failed after %d retries: %v", task.Offset, maxRetries, lastErr)
+			// Nobody else can pick up a single stream, so fail the download
+			if d.SingleStream {
+				return &types.RetryError{Op: "download", Attempts: attempts, Err: lastErr}
+			}
+			// Spread what is left over several connections rather than
+			// handing the whole range back to whichever worker is free next
+			pieces := splitForRetry(task, types.RetrySplitParts, types.RetrySplitMinChunk)
+			queue.PushMultiple(pieces)
+			if d.State != nil {
+				d.State.Reassignments.Add(1)
+			}
+			utils.Debug("task at offset %d failed after %d retries, requeued as %d piece(s): %v", task.Offset, maxRetries, len(pieces), lastErr)
 		}
+		queue.Release(id)
 	}
 }
 
 // downloadTask downloads a single byte range and writes to file at offset
-func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string, file *os.File, activeTask *ActiveTask, buf []byte, verbose bool, client *http.Client, totalSize int64) error {
+func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string, file output, activeTask *ActiveTask, buf []byte, verbose bool, client *http.Client, totalSize int64) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
 	if err != nil {
 		return err
@@ -179,28 +243,57 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 	task := activeTask.Task
 
 	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", task.Offset, task.Offset+task.Length-1))
+	if err := d.Runtime.AddHeaders(req); err != nil {
+		return err
+	}
+	ifRange := ""
+	if !d.SingleStream {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", task.Offset, task.Offset+task.Length-1))
+		// Mirrors have validators of their own, so only the URL the probe
+		// saw is asked for the range on condition the file is unchanged
+		if rawurl == d.URL {
+			if ifRange = d.ifRangeValidator(); ifRange != "" {
+				req.Header.Set("If-Range", ifRange)
+			}
+		}
+	}
+
+	// Count the connection only while a request is open, so the live count
+	// drops during retry backoff and mirror switches
+	if d.State != nil {
+		d.State.ActiveWorkers.Add(1)
+		defer d.State.ActiveWorkers.Add(-1)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	atomic.StoreInt64(&activeTask.ResponseAt, time.Now().UnixNano())
 
-	// Handle rate limiting explicitly
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return fmt.Errorf("rate limited (429)")
-	}
+	offset := task.Offset
+	defer func() {
+		// Go only returns a connection to the idle pool once its body has been
+		// read to EOF. When a steal cut this task short, read out a small tail so
+		// the next range request reuses the connection instead of dialing again.
+		if !d.SingleStream && task.Offset+task.Length-offset <= types.KeepAliveDrainLimit {
+			_, _ = io.CopyN(io.Discard, resp.Body, types.KeepAliveDrainLimit+1)
+		}
+		resp.Body.Close()
+	}()
 
 	// Validate status code
+	if resp.StatusCode == http.StatusOK && ifRange != "" && d.sourceChanged(resp, totalSize) {
+		return types.ErrSourceChanged
+	}
 	if resp.StatusCode == http.StatusOK {
 		// Valid only if we requested the full file
 		// If we wanted a partial range but got the whole file (200), that's an error because we can't handle the full stream at a non-zero offset
-		if task.Offset != 0 || task.Length != totalSize {
-			return fmt.Errorf("server indicated success (200) but ignored range request (expected 206)")
+		if !d.SingleStream && (task.Offset != 0 || task.Length != totalSize) {
+			return types.ErrRangeIgnored
 		}
 	} else if resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		return types.NewHTTPError(rawurl, resp)
 	}
 
 	// Batching State
@@ -227,14 +320,33 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 	// Ensure we flush whatever we have on exit
 	defer flushUpdates()
 
+	// A body sent with its own digest is hashed on the way to disk, so a
+	// range corrupted in transit is fetched again instead of merged
+	var digest hash.Hash
+	var wantDigest string
+	if sum := types.ContentDigest(resp); sum != "" {
+		digest, wantDigest, _ = types.ParseChecksum(sum)
+	}
+	verifyDigest := func() error {
+		// Only a body read in full can be checked, not one a steal cut short
+		if digest == nil || offset != task.Offset+task.Length {
+			return nil
+		}
+		if got := hex.EncodeToString(digest.Sum(nil)); !strings.EqualFold(got, wantDigest) {
+			flushUpdates()
+			d.discardRange(activeTask, offset)
+			return fmt.Errorf("%w: bytes %d-%d from %s", types.ErrDigestMismatch, task.Offset, offset-1, rawurl)
+		}
+		return nil
+	}
+
 	// Read and write at offset
-	offset := task.Offset
 	for {
 		// Check if we should stop
 		stopAt := atomic.LoadInt64(&activeTask.StopAt)
 		if offset >= stopAt {
-			// Stealing happened, stop here
-			return nil
+			// Range done, or stealing happened: stop here
+			return verifyDigest()
 		}
 
 		// Calculate how much to read to fill buffer or hit stopAt/EOF
@@ -250,6 +362,11 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		if readSize > remaining {
 			readSize = remaining
 		}
+		if d.State != nil {
+			if rate := d.State.Limiter.Rate(); rate > 0 {
+				readSize = min(readSize, max(rate/types.RateLimitSlices, types.RateLimitMinRead))
+			}
+		}
 
 		readSoFar := 0
 		var readErr error
@@ -285,6 +402,9 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			if writeErr != nil {
 				return fmt.Errorf("write error: %w", writeErr)
 			}
+			if digest != nil {
+				digest.Write(buf[:readSoFar])
+			}
 
 			now := time.Now()
 			// oldOffset := offset // Unused since we use batch logic now, but logically here
@@ -311,23 +431,14 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 
 			// --- BATCHING LOGIC END ---
 
-			// Update EMA speed using sliding window (2 second window)
+			// Update EMA speed using sliding window
 			// This relies on WindowBytes which is updated atomically above, so independent of batching
-			windowElapsed := now.Sub(activeTask.WindowStart).Seconds()
-			if windowElapsed >= 2.0 {
-				windowBytes := atomic.SwapInt64(&activeTask.WindowBytes, 0)
-				recentSpeed := float64(windowBytes) / windowElapsed
-
-				activeTask.SpeedMu.Lock()
-				alpha := d.Runtime.GetSpeedEmaAlpha()
-				if activeTask.Speed == 0 {
-					activeTask.Speed = recentSpeed
-				} else {
-					activeTask.Speed = (1-alpha)*activeTask.Speed + alpha*recentSpeed
-				}
-				activeTask.SpeedMu.Unlock()
+			activeTask.updateSpeed(now, d.Runtime.GetSpeedEmaAlpha())
 
-				activeTask.WindowStart = now // Reset window
+			// Hold back to the download's speed limit; a pause ends the wait
+			// and the next read fails with the cancelled request
+			if d.State != nil {
+				_ = d.State.Limiter.WaitN(ctx, readSoFar)
 			}
 		}
 
@@ -339,24 +450,90 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		}
 	}
 
-	return nil
+	return verifyDigest()
 }
 
-// StealWork tries to split an active task from a busy worker
-// It greedily targets the worker with the MOST remaining work.
+// discardRange forgets the bytes of activeTask written up to offset, so a
+// retry fetches them again from the start of the task
+func (d *ConcurrentDownloader) discardRange(activeTask *ActiveTask, offset int64) {
+	start := activeTask.Task.Offset
+	atomic.StoreInt64(&activeTask.CurrentOffset, start)
+	if d.State != nil && offset > start {
+		d.State.Downloaded.Add(start - offset)
+		d.State.UpdateChunkStatus(start, offset-start, types.ChunkPending)
+	}
+}
+
+// ifRangeValidator returns the validator sent in If-Range: the probe's ETag
+// unless it is weak, which If-Range does not allow, else its Last-Modified
+func (d *ConcurrentDownloader) ifRangeValidator() string {
+	if d.ETag != "" && !strings.HasPrefix(d.ETag, "W/") {
+		return d.ETag
+	}
+	return d.LastModified
+}
+
+// sourceChanged reports whether a 200 answer to an If-Range request is a new
+// version of the file rather than a server ignoring ranges
+func (d *ConcurrentDownloader) sourceChanged(resp *http.Response, totalSize int64) bool {
+	if resp.ContentLength >= 0 && resp.ContentLength != totalSize {
+		return true
+	}
+	probed := &types.DownloadState{ETag: d.ETag, LastModified: d.LastModified}
+	return validatorsChanged(probed, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"))
+}
+
+// StealWork splits the tail off the active task that will take the longest
+// to finish and queues it for an idle worker. The victim keeps a share of its
+// range in proportion to its speed, so a slow connection keeps only what it
+// can fetch in the time a new one takes to fetch the rest.
 func (d *ConcurrentDownloader) StealWork(queue *TaskQueue) bool {
 	d.activeMu.Lock()
 	defer d.activeMu.Unlock()
 
+	// The mean speed stands in for the connection that takes the stolen
+	// range, and for tasks too new to have a speed of their own
+	speeds := make(map[int]float64, len(d.activeTasks))
+	var sum float64
+	var measured int
+	for id, active := range d.activeTasks {
+		if s := active.GetSpeed(); s > 0 {
+			speeds[id] = s
+			sum += s
+			measured++
+		}
+	}
+	var mean float64
+	if measured > 0 {
+		mean = sum / float64(measured)
+	}
+
 	var bestID int = -1
-	var maxRemaining int64 = 0
+	var maxETA float64
+	var maxRemaining, keep int64
 	var bestActive *ActiveTask
 
-	// Find the worker with the MOST remaining work
+	// Find the worker with the longest time left, the lowest ID on a tie so
+	// the choice doesn't depend on map order. Without any speeds that is the
+	// one with the most bytes left.
 	for id, active := range d.activeTasks {
 		remaining := active.RemainingBytes()
-		if remaining > types.MinChunk && remaining > maxRemaining {
+		speed := speeds[id]
+		if speed == 0 {
+			speed = mean
+		}
+		split := stealSplit(remaining, speed, mean)
+		if split == 0 {
+			continue
+		}
+		eta := float64(remaining)
+		if speed > 0 {
+			eta /= speed
+		}
+		if bestID == -1 || eta > maxETA || eta == maxETA && id < bestID {
+			maxETA = eta
 			maxRemaining = remaining
+			keep = split
 			bestID = id
 			bestActive = active
 		}
@@ -370,14 +547,8 @@ func (d *ConcurrentDownloader) StealWork(queue *TaskQueue) bool {
 	remaining := maxRemaining
 	active := bestActive
 
-	// Split in half, aligned to AlignSize
-	splitSize := alignedSplitSize(remaining)
-	if splitSize == 0 {
-		return false
-	}
-
 	current := atomic.LoadInt64(&active.CurrentOffset)
-	newStopAt := current + splitSize
+	newStopAt := current + keep
 
 	// Update the active task stop point
 	atomic.StoreInt64(&active.StopAt, newStopAt)
@@ -407,8 +578,11 @@ func (d *ConcurrentDownloader) StealWork(queue *TaskQueue) bool {
 	}
 
 	queue.Push(stolenTask)
-	utils.Debug("Balancer: stole %s from worker %d (new range: %d-%d)",
-		utils.ConvertBytesToHumanReadable(stolenTask.Length), bestID, stolenTask.Offset, stolenTask.Offset+stolenTask.Length)
+	if d.State != nil {
+		d.State.Steals.Add(1)
+	}
+	utils.Debug("Balancer: stole %s from worker %d, %.1fs from done (new range: %d-%d)",
+		utils.ConvertBytesToHumanReadable(stolenTask.Length), bestID, maxETA, stolenTask.Offset, stolenTask.Offset+stolenTask.Length)
 
 	return true
 }
@@ -0,0 +1,115 @@
+package concurrent
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/platform"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// ringEntries is how many chunk writes a ring keeps in flight at once
+const ringEntries = 64
+
+// ringFile is a working file whose chunk writes go through a platform.Ring:
+// io_uring on Linux, overlapped I/O on Windows.
+// Reads, syncs and everything else use the file as usual.
+type ringFile struct {
+	*os.File
+	ring *platform.Ring
+}
+
+func (f *ringFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.ring.WriteAt(p, off)
+}
+
+// mappedFile is a working file whose chunk writes are copied into a shared
+// memory mapping of it, leaving the kernel to write the pages back instead
+// of making a syscall per chunk
+type mappedFile struct {
+	*os.File
+	data []byte
+}
+
+func (f *mappedFile) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off+int64(len(p)) > int64(len(f.data)) {
+		// Past the mapping, which only covers the size known up front
+		return f.File.WriteAt(p, off)
+	}
+	// A page the disk cannot back, such as a hole in a sparse file on a full
+	// disk, faults instead of failing a write. Turn that into an error
+	// rather than a crash.
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = 0, fmt.Errorf("write to mapped %s at %d: %v", f.Name(), off, r)
+		}
+	}()
+	return copy(f.data[off:], p), nil
+}
+
+// workerOutput returns what workers write their chunks into. A single working
+// file is memory-mapped under WriteMmap, or else written through a ring
+// where the build and OS allow it (Linux builds with -tags iouring, Windows
+// builds with -tags overlapped).
+// Otherwise, and for part files, out is used as it is.
+func workerOutput(out output, strategy string, fileSize int64) output {
+	f, ok := out.(*os.File)
+	if !ok {
+		return out
+	}
+	if strategy == types.WriteMmap {
+		m, err := mapOutput(f, fileSize)
+		if err == nil {
+			return m
+		}
+		utils.Debug("Chunk writes are not mapped: %v", err)
+	}
+	ring, err := platform.NewRing(f, ringEntries)
+	if err != nil {
+		utils.Debug("Chunk writes use pwrite: %v", err)
+		return out
+	}
+	return &ringFile{File: f, ring: ring}
+}
+
+// mapOutput maps the first fileSize bytes of f. The file must be that long
+// already, as it is once preallocated; a shorter one is not grown here.
+func mapOutput(f *os.File, fileSize int64) (*mappedFile, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fileSize <= 0 || info.Size() < fileSize {
+		return nil, fmt.Errorf("%s is %d bytes, want %d", f.Name(), info.Size(), fileSize)
+	}
+	data, err := platform.MapFile(f, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	return &mappedFile{File: f, data: data}, nil
+}
+
+// closeWorkerOutput stops the ring or writes back and drops the mapping
+// workerOutput set up, if any, and returns what went wrong with either. The
+// file itself is left to its owner. It is safe to call more than once.
+func closeWorkerOutput(out output) error {
+	switch f := out.(type) {
+	case *ringFile:
+		return f.ring.Close()
+	case *mappedFile:
+		if f.data == nil {
+			return nil
+		}
+		data := f.data
+		f.data = nil
+		err := platform.FlushMap(data)
+		if uerr := platform.UnmapFile(data); err == nil {
+			err = uerr
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestWorkerOutput_Mmap(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "file.surge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A file shorter than the download is not mapped
+	short := workerOutput(f, types.WriteMmap, 1000)
+	if _, ok := short.(*mappedFile); ok {
+		t.Fatal("mapped a file shorter than the download")
+	}
+	closeWorkerOutput(short)
+
+	if err := f.Truncate(1000); err != nil {
+		t.Fatal(err)
+	}
+	out := workerOutput(f, types.WriteMmap, 1000)
+	m, ok := out.(*mappedFile)
+	if !ok {
+		t.Skip("memory-mapped files unavailable here")
+	}
+	if n, err := m.WriteAt([]byte("inside"), 10); n != 6 || err != nil {
+		t.Errorf("WriteAt inside = %d, %v", n, err)
+	}
+	// Past the mapping, the write goes to the file
+	if n, err := m.WriteAt([]byte("past the end"), 995); n != 12 || err != nil {
+		t.Errorf("WriteAt past the end = %d, %v", n, err)
+	}
+	if err := closeWorkerOutput(out); err != nil {
+		t.Fatalf("closeWorkerOutput: %v", err)
+	}
+	if err := closeWorkerOutput(out); err != nil {
+		t.Errorf("second closeWorkerOutput: %v", err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got[10:16]) != "inside" || string(got[995:]) != "past the end" {
+		t.Errorf("file holds %q and %q", got[10:16], got[995:])
+	}
+}
+
+func TestConcurrentDownloader_Mmap(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	content := testContent(3*types.MB, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileSize := int64(len(content))
+	destPath := filepath.Join(tmpDir, "mapped.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 64 * types.KB, WriteStrategy: types.WriteMmap}
+	d := NewConcurrentDownloader("mmap-id", nil, types.NewProgressState("mmap-id", fileSize), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize, false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs")
+	}
+}
+
+// BenchmarkChunkWrites compares the ways workers can write chunks: pwrite on
+// the file, and copies into a mapping of it. Build with -tags iouring on
+// Linux or -tags overlapped on Windows to add the ring.
+func BenchmarkChunkWrites(b *testing.B) {
+	const fileSize, chunk = 256 << 20, 1 << 20
+	buf := bytes.Repeat([]byte{0xAB}, chunk)
+	for _, strategy := range []string{types.WriteSingle, types.WriteMmap, "ring"} {
+		b.Run(strategy, func(b *testing.B) {
+			f, err := os.Create(filepath.Join(b.TempDir(), "bench.surge"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			if err := f.Truncate(fileSize); err != nil {
+				b.Fatal(err)
+			}
+			var out output = f
+			switch strategy {
+			case types.WriteMmap:
+				if out = workerOutput(f, types.WriteMmap, fileSize); out == output(f) {
+					b.Skip("memory-mapped files unavailable here")
+				}
+			case "ring":
+				if out = workerOutput(f, types.WriteSingle, fileSize); out == output(f) {
+					b.Skip("no ring in this build")
+				}
+			}
+			defer closeWorkerOutput(out)
+
+			b.SetBytes(chunk)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var off int64
+				for pb.Next() {
+					if _, err := out.WriteAt(buf, off%fileSize); err != nil {
+						b.Error(err)
+						return
+					}
+					off += chunk * 7 // Scattered, as several workers write
+				}
+			})
+		})
+	}
+}
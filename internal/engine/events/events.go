@@ -14,6 +14,7 @@ type ProgressMsg struct {
 	Speed             float64 // bytes per second
 	Elapsed           time.Duration
 	ActiveConnections int
+	Retries           int64 // Chunk retries after failed requests, this session
 }
 
 // DownloadCompleteMsg signals that the download finished successfully
@@ -22,6 +23,31 @@ type DownloadCompleteMsg struct {
 	Filename   string
 	Elapsed    time.Duration
 	Total      int64
+	State      *types.ProgressState // Of a download run by this process, for its connection stats; may be nil
+}
+
+// ChecksumVerifiedMsg is sent when a completed download matched the checksum
+// it was given or the server declared for it
+type ChecksumVerifiedMsg struct {
+	DownloadID string
+	Filename   string
+	Checksum   string // "type:hex", e.g. "sha256:9f86d0...", or "torrent:" and the info hash for piece hashes
+}
+
+// SignatureVerifiedMsg is sent when a completed download matched its
+// detached OpenPGP signature
+type SignatureVerifiedMsg struct {
+	DownloadID string
+	Filename   string
+	Signer     string // Key ID and user ID of the key that made the signature
+}
+
+// ExtensionFixedMsg is sent when a completed download was renamed to the
+// extension its content shows
+type ExtensionFixedMsg struct {
+	DownloadID string
+	Filename   string // Name the download had
+	DestPath   string // Where it is now
 }
 
 // DownloadErrorMsg signals that an error occurred
@@ -31,6 +57,14 @@ type DownloadErrorMsg struct {
 	Err        error
 }
 
+// DownloadWarningMsg reports a problem that slows a download down without
+// stopping it, such as a destination too slow to keep up
+type DownloadWarningMsg struct {
+	DownloadID string
+	Filename   string
+	Message    string
+}
+
 // DownloadStartedMsg is sent when a download actually starts (after metadata fetch)
 type DownloadStartedMsg struct {
 	DownloadID string
@@ -57,9 +91,49 @@ type DownloadQueuedMsg struct {
 	Filename   string
 }
 
+// DownloadScheduledMsg is sent when a download is held back by its schedule
+// until StartAt
+type DownloadScheduledMsg struct {
+	DownloadID string
+	URL        string
+	Filename   string
+	StartAt    time.Time
+}
+
 type DownloadRemovedMsg struct {
+	DownloadID  string
+	Filename    string
+	Reclaimed   int64 // Bytes of partial data deleted from disk
+	KeptPartial bool  // Partial file was left on disk by user setting
+}
+
+// DownloadMovedMsg is sent when the file of a completed download was moved
+// to another directory
+type DownloadMovedMsg struct {
+	DownloadID string
+	Filename   string
+	DestPath   string // New full path of the file
+}
+
+// DownloadPhase is the lifecycle stage of a download in the worker pool
+type DownloadPhase string
+
+const (
+	PhaseScheduled DownloadPhase = "scheduled" // Held until its scheduled start
+	PhaseQueued    DownloadPhase = "queued"    // Waiting for a free worker
+	PhaseActive    DownloadPhase = "active"    // Picked up by a worker (probing or transferring)
+	PhasePaused    DownloadPhase = "paused"    // Stopped with state saved for resume
+	PhaseDone      DownloadPhase = "done"      // Finished successfully
+	PhaseError     DownloadPhase = "error"     // Failed
+)
+
+// DownloadStateChangedMsg is sent whenever a download moves between phases,
+// so consumers can track the lifecycle without inferring it from progress
+type DownloadStateChangedMsg struct {
 	DownloadID string
 	Filename   string
+	From       DownloadPhase // Empty for a newly added download
+	To         DownloadPhase
 }
 
 // DownloadRequestMsg signals a request to start a download (e.g. from extension)
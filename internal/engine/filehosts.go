@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// File hosts hide the file behind a download page: a button, a form to
+// submit or a wait. Each host below is a Backend that walks its pages with a
+// pageSession and picks the file's link out of them.
+//
+// To support another host, add a Backend like these to backends, with a test
+// serving a saved copy of its pages. Hosts can also be handled without
+// rebuilding Surge by a resolver plugin (see the plugins package); plugins
+// are asked first, so one can take over a host whose pages changed.
+
+// maxPageSize bounds a download page read for its link
+const maxPageSize = 2 << 20
+
+// errNoFileLink is returned when a download page has no link to the file
+var errNoFileLink = errors.New("no download link on the page; the file may have been removed, or the host changed its pages")
+
+// onHost parses rawurl and reports whether it is on one of domains or a
+// subdomain of one
+func onHost(rawurl string, domains ...string) (*url.URL, bool) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// pageSession fetches a host's pages like a browser would, with one cookie
+// jar, so that the download can carry on the session they set up
+type pageSession struct {
+	client  *http.Client
+	runtime *types.RuntimeConfig
+}
+
+func newPageSession(runtime *types.RuntimeConfig) *pageSession {
+	return &pageSession{client: probeClientFor(runtime), runtime: runtime}
+}
+
+// page is a download page
+type page struct {
+	URL  *url.URL // Where the page ended up after redirects
+	Body string
+}
+
+// get fetches the page at rawurl
+func (s *pageSession) get(ctx context.Context, rawurl string) (*page, error) {
+	return s.do(ctx, http.MethodGet, rawurl, nil)
+}
+
+// post submits form to the page at rawurl
+func (s *pageSession) post(ctx context.Context, rawurl string, form url.Values) (*page, error) {
+	return s.do(ctx, http.MethodPost, rawurl, form)
+}
+
+func (s *pageSession) do(ctx context.Context, method, rawurl string, form url.Values) (*page, error) {
+	ctx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+	resp, err := s.send(ctx, method, rawurl, form, "text/html")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return &page{URL: resp.Request.URL, Body: string(data)}, nil
+}
+
+// getJSON decodes what a host's API answers at rawurl into v
+func (s *pageSession) getJSON(ctx context.Context, rawurl string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+	resp, err := s.send(ctx, http.MethodGet, rawurl, nil, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPageSize)).Decode(v); err != nil {
+		return fmt.Errorf("reading %s: %w", rawurl, err)
+	}
+	return nil
+}
+
+// send makes a request of the session; only 200 OK answers are returned
+func (s *pageSession) send(ctx context.Context, method, rawurl string, form url.Values, accept string) (*http.Response, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", ua)
+	req.Header.Set("Accept", accept)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if err := s.runtime.AddHeaders(req); err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, types.NewHTTPError(rawurl, resp)
+	}
+	return resp, nil
+}
+
+// cookiesFor returns the cookies the session would send to rawurl, for the
+// download to send too
+func (s *pageSession) cookiesFor(rawurl string) []*http.Cookie {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil
+	}
+	return hostCookies(s.client.Jar, u)
+}
+
+// hostCookies returns the cookies jar holds for u as host-only cookies of it
+func hostCookies(jar http.CookieJar, u *url.URL) []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, c := range jar.Cookies(u) {
+		cookies = append(cookies, &http.Cookie{
+			Name:   c.Name,
+			Value:  c.Value,
+			Domain: u.Hostname(),
+			Path:   "/",
+			Secure: u.Scheme == "https",
+		})
+	}
+	return cookies
+}
+
+var (
+	anchorTag = regexp.MustCompile(`(?is)<a\s[^>]*>`)
+	inputTag  = regexp.MustCompile(`(?is)<input\s[^>]*>`)
+	tagAttr   = regexp.MustCompile(`(?is)([a-z_:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// attrs returns the attributes of an HTML tag, unescaped, by lowercase name
+func attrs(tag string) map[string]string {
+	found := make(map[string]string)
+	for _, m := range tagAttr.FindAllStringSubmatch(tag, -1) {
+		found[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3])
+	}
+	return found
+}
+
+// anchor returns the attributes of the first link on the page whose attr
+// attribute is value; a class matches if it is one of the link's classes
+func (p *page) anchor(attr, value string) (map[string]string, bool) {
+	for _, tag := range anchorTag.FindAllString(p.Body, -1) {
+		a := attrs(tag)
+		got, ok := a[attr]
+		if ok && (got == value || (attr == "class" && slices.Contains(strings.Fields(got), value))) {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// link returns the absolute URL of the first link as anchor finds it, or ""
+func (p *page) link(attr, value string) string {
+	a, ok := p.anchor(attr, value)
+	if !ok {
+		return ""
+	}
+	return p.resolve(a["href"])
+}
+
+// resolve makes ref, a URL on the page, absolute; "" if it is not a web URL
+func (p *page) resolve(ref string) string {
+	u, err := p.URL.Parse(strings.TrimSpace(ref))
+	if ref == "" || err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return ""
+	}
+	return u.String()
+}
+
+// input returns the value of the page's form field called name
+func (p *page) input(name string) (string, bool) {
+	for _, tag := range inputTag.FindAllString(p.Body, -1) {
+		if a := attrs(tag); a["name"] == name {
+			return a["value"], true
+		}
+	}
+	return "", false
+}
+
+// fileName returns the unescaped last path segment of rawurl, or ""
+func fileName(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || strings.HasSuffix(u.Path, "/") {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+// pixeldrainBackend resolves pixeldrain file pages, /u/<id>, with the
+// host's file API
+type pixeldrainBackend struct{}
+
+func (pixeldrainBackend) Name() string { return "pixeldrain" }
+
+func (pixeldrainBackend) Handles(rawurl string) bool {
+	u, ok := onHost(rawurl, "pixeldrain.com", "pixeldrain.net")
+	return ok && strings.HasPrefix(u.Path, "/u/") && len(u.Path) > len("/u/")
+}
+
+func (pixeldrainBackend) Resolve(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (Source, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Source{}, err
+	}
+	api := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/api/file/" + path.Base(u.Path)}).String()
+	var info struct {
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	}
+	if err := newPageSession(runtime).getJSON(ctx, api+"/info", &info); err != nil {
+		return Source{}, err
+	}
+	return Source{URL: api + "?download", Filename: info.Name, Size: info.Size}, nil
+}
+
+// mediaFireBackend resolves MediaFire file pages, /file/<key>/<name>, to
+// the link of their download button
+type mediaFireBackend struct{}
+
+func (mediaFireBackend) Name() string { return "mediafire" }
+
+func (mediaFireBackend) Handles(rawurl string) bool {
+	u, ok := onHost(rawurl, "mediafire.com")
+	return ok && strings.HasPrefix(u.Path, "/file/")
+}
+
+func (mediaFireBackend) Resolve(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (Source, error) {
+	s := newPageSession(runtime)
+	pg, err := s.get(ctx, rawurl)
+	if err != nil {
+		return Source{}, err
+	}
+	button, ok := pg.anchor("id", "downloadButton")
+	if !ok {
+		return Source{}, errNoFileLink
+	}
+	ref := button["href"]
+	// Newer pages keep the link base64-encoded until the button is clicked
+	if scrambled := button["data-scrambled-url"]; scrambled != "" {
+		if decoded, err := base64.StdEncoding.DecodeString(scrambled); err == nil {
+			ref = string(decoded)
+		}
+	}
+	link := pg.resolve(ref)
+	if link == "" {
+		return Source{}, errNoFileLink
+	}
+	return Source{URL: link, Filename: fileName(link), Cookies: s.cookiesFor(link)}, nil
+}
+
+// oneFichierDomains are the names 1fichier serves its files under
+var oneFichierDomains = []string{
+	"1fichier.com", "alterupload.com", "cjoint.net", "desfichiers.com", "dfichiers.com",
+	"dl4free.com", "megadl.fr", "mesfichiers.org", "piecejointe.net", "pjointe.com", "tenvoi.com",
+}
+
+// oneFichierWait finds the wait 1fichier imposes between free downloads
+var oneFichierWait = regexp.MustCompile(`(?i)you must wait (?:at least )?(\d+) minutes?`)
+
+// oneFichierBackend resolves 1fichier links, /?<id>, by submitting the
+// download form of their page as a free user
+type oneFichierBackend struct{}
+
+func (oneFichierBackend) Name() string { return "1fichier" }
+
+func (oneFichierBackend) Handles(rawurl string) bool {
+	u, ok := onHost(rawurl, oneFichierDomains...)
+	return ok && u.RawQuery != "" && (u.Path == "" || u.Path == "/")
+}
+
+func (oneFichierBackend) Resolve(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (Source, error) {
+	s := newPageSession(runtime)
+	pg, err := s.get(ctx, rawurl)
+	if err != nil {
+		return Source{}, err
+	}
+	if err := oneFichierWaitError(pg); err != nil {
+		return Source{}, err
+	}
+	form := url.Values{"dl_no_ssl": {"on"}, "dlinline": {"on"}}
+	if adz, ok := pg.input("adz"); ok {
+		form.Set("adz", adz)
+	}
+	if pg, err = s.post(ctx, pg.URL.String(), form); err != nil {
+		return Source{}, err
+	}
+	if err := oneFichierWaitError(pg); err != nil {
+		return Source{}, err
+	}
+	link := pg.link("class", "btn-orange")
+	if link == "" {
+		return Source{}, errNoFileLink
+	}
+	// The link names no file; the download takes the name the server gives
+	return Source{URL: link, Cookies: s.cookiesFor(link)}, nil
+}
+
+// oneFichierWaitError reports the wait a 1fichier page asks for
+func oneFichierWaitError(pg *page) error {
+	if wait := oneFichierWait.FindStringSubmatch(pg.Body); wait != nil {
+		return fmt.Errorf("1fichier allows one free download every so often; add the link again in %s minutes", wait[1])
+	}
+	return nil
+}
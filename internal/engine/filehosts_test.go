@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFileHosts_Handles(t *testing.T) {
+	for _, tt := range []struct {
+		backend Backend
+		rawurl  string
+		want    bool
+	}{
+		{pixeldrainBackend{}, "https://pixeldrain.com/u/aBc123", true},
+		{pixeldrainBackend{}, "https://pixeldrain.net/u/aBc123", true},
+		{pixeldrainBackend{}, "https://pixeldrain.com/l/list123", false},
+		{pixeldrainBackend{}, "https://pixeldrain.com/u/", false},
+		{mediaFireBackend{}, "https://www.mediafire.com/file/k3y/report.pdf/file", true},
+		{mediaFireBackend{}, "https://www.mediafire.com/folder/k3y/stuff", false},
+		{mediaFireBackend{}, "https://notmediafire.com/file/k3y/report.pdf/file", false},
+		{oneFichierBackend{}, "https://1fichier.com/?abc123", true},
+		{oneFichierBackend{}, "https://megadl.fr/?abc123&af=42", true},
+		{oneFichierBackend{}, "https://1fichier.com/", false},
+		{oneFichierBackend{}, "https://1fichier.com/console/", false},
+	} {
+		if got := tt.backend.Handles(tt.rawurl); got != tt.want {
+			t.Errorf("%s Handles(%s) = %v, want %v", tt.backend.Name(), tt.rawurl, got, tt.want)
+		}
+	}
+}
+
+func TestPage_Links(t *testing.T) {
+	base, _ := url.Parse("https://host.example/files/page")
+	pg := &page{URL: base, Body: `
+		<a href="/about" class="nav">About</a>
+		<A CLASS='btn btn-orange ok' HREF='../get?id=1&amp;t=2'>Download</A>
+		<a id="js" href="javascript:void(0)">Open</a>
+		<form><input type="hidden" name="adz" value="1.5"><input name=plain value=x></form>`}
+
+	if got, want := pg.link("class", "btn-orange"), "https://host.example/get?id=1&t=2"; got != want {
+		t.Errorf(`link("class", "btn-orange") = %q, want %q`, got, want)
+	}
+	if got := pg.link("class", "btn"); got == "" {
+		t.Error("Expected a link with class btn")
+	}
+	if got := pg.link("id", "js"); got != "" {
+		t.Errorf("Expected no link for a javascript: href, got %q", got)
+	}
+	if got := pg.link("id", "missing"); got != "" {
+		t.Errorf("Expected no link, got %q", got)
+	}
+	if got, ok := pg.input("adz"); !ok || got != "1.5" {
+		t.Errorf(`input("adz") = %q, %v`, got, ok)
+	}
+}
+
+func TestPixeldrainBackend_Resolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/file/aBc123/info":
+			fmt.Fprint(w, `{"id": "aBc123", "name": "holiday.mp4", "size": 4096}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	src, err := pixeldrainBackend{}.Resolve(context.Background(), server.URL+"/u/aBc123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.URL != server.URL+"/api/file/aBc123?download" || src.Filename != "holiday.mp4" || src.Size != 4096 {
+		t.Errorf("src = %+v", src)
+	}
+
+	if _, err := (pixeldrainBackend{}).Resolve(context.Background(), server.URL+"/u/gone", nil); err == nil {
+		t.Error("Expected an error for a removed file")
+	}
+}
+
+func TestMediaFireBackend_Resolve(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "ukey", Value: "visitor", Path: "/"})
+		file := server.URL + "/d0wnl0ad/k3y/report%20v2.pdf"
+		switch r.URL.Path {
+		case "/file/k3y/report.pdf/file":
+			fmt.Fprintf(w, `<a class="input popsok" aria-label="Download file" href="%s" id="downloadButton">Download</a>`, file)
+		case "/file/scrambled/report.pdf/file":
+			fmt.Fprintf(w, `<a id="downloadButton" href="javascript:void(0)" data-scrambled-url="%s">Download</a>`,
+				base64.StdEncoding.EncodeToString([]byte(file)))
+		default:
+			fmt.Fprint(w, `<html>Invalid or Deleted File.</html>`)
+		}
+	}))
+	defer server.Close()
+
+	for _, page := range []string{"/file/k3y/report.pdf/file", "/file/scrambled/report.pdf/file"} {
+		src, err := mediaFireBackend{}.Resolve(context.Background(), server.URL+page, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", page, err)
+		}
+		if src.URL != server.URL+"/d0wnl0ad/k3y/report%20v2.pdf" || src.Filename != "report v2.pdf" {
+			t.Errorf("%s: src = %+v", page, src)
+		}
+		if len(src.Cookies) != 1 || src.Cookies[0].Name != "ukey" {
+			t.Errorf("%s: cookies = %v, want the page's session", page, src.Cookies)
+		}
+	}
+
+	if _, err := (mediaFireBackend{}).Resolve(context.Background(), server.URL+"/file/gone/x/file", nil); !errors.Is(err, errNoFileLink) {
+		t.Errorf("removed file: %v, want errNoFileLink", err)
+	}
+}
+
+func TestOneFichierBackend_Resolve(t *testing.T) {
+	var server *httptest.Server
+	wait := false
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait {
+			fmt.Fprint(w, `<div class="ct_warn">You must wait 12 minutes to download another file</div>`)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "free", Path: "/"})
+			fmt.Fprint(w, `<form method="post"><input type="hidden" name="adz" value="7.1"><input type="submit" id="dlb"></form>`)
+		case http.MethodPost:
+			r.ParseForm()
+			if r.PostForm.Get("adz") != "7.1" || r.PostForm.Get("dl_no_ssl") != "on" {
+				t.Errorf("form = %v", r.PostForm)
+			}
+			if c, err := r.Cookie("SID"); err != nil || c.Value != "free" {
+				t.Error("Expected the session cookie with the form")
+			}
+			fmt.Fprintf(w, `<a href="%s/c1234567" style="float:none" class="ok btn-general btn-orange">Click here to download the file</a>`, server.URL)
+		}
+	}))
+	defer server.Close()
+
+	src, err := oneFichierBackend{}.Resolve(context.Background(), server.URL+"/?abc123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.URL != server.URL+"/c1234567" || src.Filename != "" {
+		t.Errorf("src = %+v, want the link without a filename", src)
+	}
+
+	wait = true
+	_, err = oneFichierBackend{}.Resolve(context.Background(), server.URL+"/?abc123", nil)
+	if err == nil || !strings.Contains(err.Error(), "12 minutes") {
+		t.Errorf("err = %v, want the wait", err)
+	}
+}
@@ -0,0 +1,179 @@
+package metalink
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Namespace4 is the XML namespace of Metalink v4 (RFC 5854) documents
+const Namespace4 = "urn:ietf:params:xml:ns:metalink"
+
+// hashPreference lists the hash types Surge can check, strongest first
+var hashPreference = []string{"sha512", "sha384", "sha256", "sha224", "sha1", "md5"}
+
+// lowestPriority ranks URLs that carry no priority behind every ranked one
+const lowestPriority = 1 << 30
+
+// Metalink holds the files described by a .metalink (v3) or .meta4 (v4) document
+type Metalink struct {
+	Files []File
+}
+
+// File is one file of a metalink and the places it can be fetched from
+type File struct {
+	Name   string
+	Size   int64             // 0 when the document does not say
+	URLs   []URL             // Best first
+	Hashes map[string]string // Lower-case hex digests keyed by normalized type, e.g. "sha256"
+}
+
+// URL is a download location of a file. Priority follows v4: lower is
+// preferred. v3 preferences (higher is preferred) are converted on parse.
+type URL struct {
+	URL      string
+	Priority int
+}
+
+// The element layout of both versions: v3 nests files, hashes and URLs in
+// wrapper elements, v4 puts them directly under their parent. Tags carry no
+// namespace so either document decodes into the same structs.
+type xmlMetalink struct {
+	XMLName xml.Name  `xml:"metalink"`
+	Files4  []xmlFile `xml:"file"`
+	Files3  []xmlFile `xml:"files>file"`
+}
+
+type xmlFile struct {
+	Name    string    `xml:"name,attr"`
+	Size    int64     `xml:"size"`
+	Hashes4 []xmlHash `xml:"hash"`
+	Hashes3 []xmlHash `xml:"verification>hash"`
+	URLs4   []xmlURL  `xml:"url"`
+	URLs3   []xmlURL  `xml:"resources>url"`
+}
+
+type xmlHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlURL struct {
+	Priority   int    `xml:"priority,attr"`
+	Preference int    `xml:"preference,attr"`
+	Value      string `xml:",chardata"`
+}
+
+// Load reads and parses a metalink file from disk
+func Load(path string) (*Metalink, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metalink: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a Metalink v3 or v4 document. Files without a usable name are
+// an error, since the name is where the download is saved.
+func Parse(data []byte) (*Metalink, error) {
+	var doc xmlMetalink
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("metalink: %w", err)
+	}
+
+	m := &Metalink{}
+	for _, xf := range append(doc.Files4, doc.Files3...) {
+		name := path.Base(strings.ReplaceAll(strings.TrimSpace(xf.Name), "\\", "/"))
+		if name == "" || name == "." || name == ".." || name == "/" {
+			return nil, fmt.Errorf("metalink: file with invalid name %q", xf.Name)
+		}
+
+		f := File{Name: name, Size: xf.Size, Hashes: make(map[string]string)}
+		for _, h := range append(xf.Hashes4, xf.Hashes3...) {
+			typ := normalizeHashType(h.Type)
+			if value := strings.ToLower(strings.TrimSpace(h.Value)); typ != "" && value != "" {
+				f.Hashes[typ] = value
+			}
+		}
+		for _, u := range xf.URLs4 {
+			f.URLs = append(f.URLs, URL{URL: strings.TrimSpace(u.Value), Priority: v4Priority(u.Priority)})
+		}
+		for _, u := range xf.URLs3 {
+			f.URLs = append(f.URLs, URL{URL: strings.TrimSpace(u.Value), Priority: v3Priority(u.Preference)})
+		}
+		sort.SliceStable(f.URLs, func(i, j int) bool { return f.URLs[i].Priority < f.URLs[j].Priority })
+
+		m.Files = append(m.Files, f)
+	}
+
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("metalink: document lists no files")
+	}
+	return m, nil
+}
+
+// HTTPURLs returns the file's HTTP(S) URLs, best first and without
+// duplicates, ready to be handed to the engine as the primary and mirrors.
+// FTP and BitTorrent locations are skipped.
+func (f File) HTTPURLs() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, loc := range f.URLs {
+		u, err := url.Parse(loc.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		if !seen[loc.URL] {
+			seen[loc.URL] = true
+			urls = append(urls, loc.URL)
+		}
+	}
+	return urls
+}
+
+// Checksum returns the strongest hash of the file Surge can check, as
+// "type:hex" (e.g. "sha256:9f86d0..."), or "" if the metalink declares none
+func (f File) Checksum() string {
+	for _, typ := range hashPreference {
+		if value, ok := f.Hashes[typ]; ok {
+			return typ + ":" + value
+		}
+	}
+	return ""
+}
+
+// normalizeHashType maps the v4 (IANA "sha-256") and v3 ("sha256") names of a
+// hash type onto one spelling, returning "" for types Surge cannot check
+func normalizeHashType(typ string) string {
+	typ = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(typ), "-", ""))
+	for _, known := range hashPreference {
+		if typ == known {
+			return typ
+		}
+	}
+	return ""
+}
+
+// v4Priority ranks a v4 priority attribute; 1 is the most preferred and a
+// missing attribute ranks last
+func v4Priority(p int) int {
+	if p <= 0 {
+		return lowestPriority
+	}
+	return p
+}
+
+// v3Priority converts a v3 preference (1-100, higher is preferred) to a
+// v4-style priority
+func v3Priority(pref int) int {
+	if pref <= 0 {
+		return lowestPriority
+	}
+	return 101 - min(pref, 100)
+}
@@ -0,0 +1,113 @@
+package metalink
+
+import (
+	"reflect"
+	"testing"
+)
+
+const meta4 = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="example.iso">
+    <size>14471447</size>
+    <hash type="md5">d41d8cd98f00b204e9800998ecf8427e</hash>
+    <hash type="sha-256">F0AD929CD259957E160EA442EB80986B5F01</hash>
+    <pieces length="262144" type="sha-1">
+      <hash>aaaa</hash>
+    </pieces>
+    <url priority="2" location="de">https://de.example.com/example.iso</url>
+    <url>http://slow.example.com/example.iso</url>
+    <url priority="1">https://us.example.com/example.iso</url>
+    <url priority="3">ftp://ftp.example.com/example.iso</url>
+    <metaurl mediatype="torrent">http://example.com/example.iso.torrent</metaurl>
+  </file>
+</metalink>`
+
+const metalink3 = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+  <files>
+    <file name="sub/tool.tar.gz">
+      <size>2048</size>
+      <verification>
+        <hash type="sha1">0123456789abcdef0123456789abcdef01234567</hash>
+        <hash type="sha512">abcd</hash>
+      </verification>
+      <resources>
+        <url type="http" preference="10">http://b.example.com/tool.tar.gz</url>
+        <url type="http" preference="90">http://a.example.com/tool.tar.gz</url>
+        <url type="http" preference="90">http://a.example.com/tool.tar.gz</url>
+      </resources>
+    </file>
+  </files>
+</metalink>`
+
+func TestParse_V4(t *testing.T) {
+	m, err := Parse([]byte(meta4))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(m.Files) != 1 {
+		t.Fatalf("got %d files, want 1", len(m.Files))
+	}
+	f := m.Files[0]
+	if f.Name != "example.iso" || f.Size != 14471447 {
+		t.Errorf("file = %q (%d bytes)", f.Name, f.Size)
+	}
+
+	want := []string{
+		"https://us.example.com/example.iso",
+		"https://de.example.com/example.iso",
+		"http://slow.example.com/example.iso",
+	}
+	if got := f.HTTPURLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("HTTPURLs = %v, want %v", got, want)
+	}
+
+	// Piece hashes are not whole-file hashes
+	if len(f.Hashes) != 2 {
+		t.Errorf("Hashes = %v", f.Hashes)
+	}
+	if got := f.Checksum(); got != "sha256:f0ad929cd259957e160ea442eb80986b5f01" {
+		t.Errorf("Checksum = %q", got)
+	}
+}
+
+func TestParse_V3(t *testing.T) {
+	m, err := Parse([]byte(metalink3))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	f := m.Files[0]
+	if f.Name != "tool.tar.gz" {
+		t.Errorf("Name = %q, want the base name", f.Name)
+	}
+	if f.Size != 2048 {
+		t.Errorf("Size = %d", f.Size)
+	}
+	want := []string{"http://a.example.com/tool.tar.gz", "http://b.example.com/tool.tar.gz"}
+	if got := f.HTTPURLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("HTTPURLs = %v, want %v", got, want)
+	}
+	if got := f.Checksum(); got != "sha512:abcd" {
+		t.Errorf("Checksum = %q, want the strongest hash", got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"not xml":  "hello",
+		"no files": `<metalink xmlns="urn:ietf:params:xml:ns:metalink"></metalink>`,
+		"bad name": `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name=".."><url>http://a/b</url></file></metalink>`,
+	}
+	for name, doc := range cases {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestChecksum_None(t *testing.T) {
+	f := File{Hashes: map[string]string{}}
+	if got := f.Checksum(); got != "" {
+		t.Errorf("Checksum = %q, want empty", got)
+	}
+}
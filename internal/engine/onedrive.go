@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/vfaronov/httpheader"
+)
+
+// Share APIs of Microsoft Graph (work and school accounts, and personal ones
+// once signed in) and of OneDrive personal for anonymous links; tests point
+// them at local servers
+var (
+	graphAPI    = "https://graph.microsoft.com/v1.0"
+	oneDriveAPI = "https://api.onedrive.com/v1.0"
+)
+
+// errShareSignIn is returned for sharing links the user has to sign in to
+var errShareSignIn = errors.New("the link is not shared with anyone who has it; " +
+	"run 'surge auth login microsoft', or pass the browser's cookies with --cookies-from-browser")
+
+// oneDriveBackend turns OneDrive and SharePoint sharing links, the pages
+// "Copy link" gives, into the file they share. Signed in to Microsoft (see
+// the oauth package), Graph resolves any link the account can open.
+// Otherwise links open to anyone are resolved anonymously: OneDrive personal
+// through its share API, SharePoint by following the link's download
+// redirect and keeping the cookies it sets for the download.
+type oneDriveBackend struct{}
+
+func (oneDriveBackend) Name() string { return "onedrive" }
+
+func (oneDriveBackend) Handles(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "1drv.ms":
+		return true
+	case host == "onedrive.live.com":
+		return u.Path != "/download" // Already a direct link
+	case strings.HasSuffix(host, ".sharepoint.com"):
+		return isSharePointShare(u.Path)
+	}
+	return false
+}
+
+// isSharePointShare reports whether path is that of a SharePoint sharing
+// link, e.g. /:u:/g/personal/alice_contoso_com/EaBc...
+func isSharePointShare(path string) bool {
+	return len(path) >= 4 && path[0] == '/' && path[1] == ':' && path[3] == ':'
+}
+
+func (oneDriveBackend) Resolve(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (Source, error) {
+	src, err := fetchDriveItem(ctx, graphAPI+"/shares/"+shareID(rawurl)+"/driveItem", runtime, true)
+	if !errors.Is(err, errShareSignIn) {
+		return src, err
+	}
+	u, _ := url.Parse(rawurl)
+	if strings.HasSuffix(strings.ToLower(u.Hostname()), ".sharepoint.com") {
+		return resolveSharePointLink(ctx, u, runtime)
+	}
+	return fetchDriveItem(ctx, oneDriveAPI+"/shares/"+shareID(rawurl)+"/root", runtime, false)
+}
+
+// shareID encodes a sharing link for the shares APIs
+func shareID(rawurl string) string {
+	return "u!" + base64.RawURLEncoding.EncodeToString([]byte(rawurl))
+}
+
+// driveItem is the part of a shared item the resolvers use. The download URL
+// is pre-authenticated and short-lived.
+type driveItem struct {
+	Name             string `json:"name"`
+	Size             int64  `json:"size"`
+	GraphDownloadURL string `json:"@microsoft.graph.downloadUrl"`
+	DownloadURL      string `json:"@content.downloadUrl"`
+	Folder           *struct {
+		ChildCount int `json:"childCount"`
+	} `json:"folder"`
+}
+
+// fetchDriveItem asks a share API at endpoint for the shared file. With
+// signedIn, as Graph needs, a request the runtime did not sign in is not sent
+// and errShareSignIn is returned.
+func fetchDriveItem(ctx context.Context, endpoint string, runtime *types.RuntimeConfig, signedIn bool) (Source, error) {
+	ctx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Source{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Prefer", "redeemSharingLinkIfNecessary")
+	if err := runtime.AddHeaders(req); err != nil {
+		return Source{}, err
+	}
+	if signedIn && req.Header.Get("Authorization") == "" {
+		return Source{}, errShareSignIn
+	}
+
+	resp, err := probeClientFor(runtime).Do(req)
+	if err != nil {
+		return Source{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return Source{}, fmt.Errorf("%w (%s)", errShareSignIn, resp.Status)
+	default:
+		return Source{}, types.NewHTTPError(endpoint, resp)
+	}
+
+	var item driveItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return Source{}, fmt.Errorf("reading the shared item: %w", err)
+	}
+	if item.Folder != nil {
+		return Source{}, errors.New("the link shares a folder; share the files in it one by one")
+	}
+	download := item.GraphDownloadURL
+	if download == "" {
+		download = item.DownloadURL
+	}
+	if download == "" {
+		return Source{}, errors.New("the share API gave no download URL; the owner may have blocked downloads")
+	}
+	return Source{URL: download, Filename: item.Name, Size: item.Size}, nil
+}
+
+// resolveSharePointLink follows the download redirect of a SharePoint link
+// open to anyone. The file's URL only answers with the FedAuth cookie set on
+// the way, so the download gets the cookies too.
+func resolveSharePointLink(ctx context.Context, link *url.URL, runtime *types.RuntimeConfig) (Source, error) {
+	u := *link
+	q := u.Query()
+	q.Set("download", "1")
+	u.RawQuery = q.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Source{}, err
+	}
+	req.Header.Set("User-Agent", ua)
+	if err := runtime.AddHeaders(req); err != nil {
+		return Source{}, err
+	}
+	client := probeClientFor(runtime)
+	resp, err := client.Do(req)
+	if err != nil {
+		return Source{}, err
+	}
+	defer resp.Body.Close() // The file itself; the download fetches it again
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return Source{}, fmt.Errorf("%w (%s)", errShareSignIn, resp.Status)
+		}
+		return Source{}, types.NewHTTPError(u.String(), resp)
+	}
+	// Links limited to an organization end on a sign-in page
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/html" {
+		return Source{}, errShareSignIn
+	}
+
+	final := resp.Request.URL
+	src := Source{URL: final.String(), Size: max(resp.ContentLength, 0), Cookies: hostCookies(client.Jar, final)}
+	if _, name, err := httpheader.ContentDisposition(resp.Header); err == nil {
+		src.Filename = name
+	}
+	return src, nil
+}
@@ -2,8 +2,10 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,7 +16,32 @@ import (
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
-var probeClient = &http.Client{Timeout: types.ProbeTimeout}
+// probeClientFor returns the client probes use under runtime's network
+// policy, proxy and cookies. Every probe has its own cookie jar, so cookies a
+// redirect sets are sent on to where it leads. Restricted or proxied probes
+// also get their own transport, without keep-alives so nothing is left idle
+// once the probe is done. Probes share the per-host connection cap with
+// downloads.
+func probeClientFor(runtime *types.RuntimeConfig) *http.Client {
+	if runtime == nil || (!runtime.BlockPrivateNetworks && runtime.MaxRedirects <= 0 && runtime.Proxy == "") {
+		return &http.Client{Timeout: types.ProbeTimeout, Transport: runtime.LimitHosts(http.DefaultTransport), Jar: runtime.CookieJar()}
+	}
+	return &http.Client{
+		Timeout: types.ProbeTimeout,
+		Transport: runtime.LimitHosts(&http.Transport{
+			Proxy: runtime.ProxyFunc(),
+			DialContext: (&net.Dialer{
+				Timeout:   types.DialTimeout,
+				KeepAlive: types.KeepAliveDuration,
+				Control:   runtime.DialControl,
+			}).DialContext,
+			TLSHandshakeTimeout: types.DefaultTLSHandshakeTimeout,
+			DisableKeepAlives:   true,
+		}),
+		CheckRedirect: runtime.CheckRedirect,
+		Jar:           runtime.CookieJar(),
+	}
+}
 
 var ua = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) " +
 	"AppleWebKit/537.36 (KHTML, like Gecko) " +
@@ -26,14 +53,50 @@ type ProbeResult struct {
 	SupportsRange bool
 	Filename      string
 	ContentType   string
+	ETag          string // Validators for telling whether a resumed file changed
+	LastModified  string
+	FinalURL      string      // Where redirects led
+	Checksum      string      // "type:hex" digest of the file the server sent, if any
+	Header        http.Header // All response headers, for checking expectations
+	Head          []byte      // Start of the body, up to ProbeHeadSize; one byte if the server honoured the range
+}
+
+// ProbeHeadSize is how much of the body a probe keeps for telling what the
+// server sent
+const ProbeHeadSize = 512
+
+// ProbeServer sends GET with Range: bytes=0-0 to determine server capabilities.
+// runtime may be nil; when set, its network policy applies to the probe.
+// Successful probes are reused for ProbeCacheTTL.
+func ProbeServer(ctx context.Context, rawurl string, filenameHint string, runtime *types.RuntimeConfig) (*ProbeResult, error) {
+	key := probeCacheKey(rawurl, runtime)
+	if cached, ok := probes.get(key); ok {
+		utils.Debug("Using cached probe of %s", rawurl)
+		if filenameHint != "" {
+			cached.Filename = filenameHint
+		}
+		return &cached, nil
+	}
+
+	result, err := probeServer(ctx, rawurl, runtime)
+	if err != nil {
+		return nil, err
+	}
+	probes.put(key, *result)
+	if filenameHint != "" {
+		result.Filename = filenameHint
+	}
+	return result, nil
 }
 
-// ProbeServer sends GET with Range: bytes=0-0 to determine server capabilities
-func ProbeServer(ctx context.Context, rawurl string, filenameHint string) (*ProbeResult, error) {
+// probeServer sends the probe request itself
+func probeServer(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (*ProbeResult, error) {
 	utils.Debug("Probing server: %s", rawurl)
+	client := probeClientFor(runtime)
 
 	var resp *http.Response
 	var err error
+	var attempts []string
 
 	// Retry logic for probe request
 	for i := 0; i < 3; i++ {
@@ -51,17 +114,27 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 			break // Fatal error, don't retry
 		}
 
-		req.Header.Set("Range", "bytes=0-0")
 		req.Header.Set("User-Agent", ua)
+		if err = runtime.AddHeaders(req); err != nil {
+			break // Signing in will not go better on a retry
+		}
+		req.Header.Set("Range", "bytes=0-0")
 
-		resp, err = probeClient.Do(req)
+		resp, err = client.Do(req)
 		if err == nil {
 			break // Success
 		}
+		attempts = append(attempts, err.Error())
+		if errors.Is(err, types.ErrBlockedAddress) || errors.Is(err, types.ErrRedirectRefused) {
+			break // The policy will refuse every attempt
+		}
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("probe request failed after retries: %w", err)
+		if len(attempts) == 0 {
+			return nil, err
+		}
+		return nil, &types.RetryError{Op: "probe", Attempts: attempts, Err: err}
 	}
 
 	defer func() {
@@ -85,7 +158,7 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 			if idx := strings.LastIndex(contentRange, "/"); idx != -1 {
 				sizeStr := contentRange[idx+1:]
 				if sizeStr != "*" {
-					result.FileSize, _ = strconv.ParseInt(sizeStr, 10, 64)
+					result.FileSize = parseSize(sizeStr)
 				}
 			}
 		}
@@ -95,28 +168,33 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 		result.SupportsRange = false
 		contentLength := resp.Header.Get("Content-Length")
 		if contentLength != "" {
-			result.FileSize, _ = strconv.ParseInt(contentLength, 10, 64)
+			result.FileSize = parseSize(contentLength)
 		}
 		utils.Debug("Range NOT supported (got 200), file size: %d", result.FileSize)
 
 	default:
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, types.NewHTTPError(rawurl, resp)
 	}
 
 	// Determine filename using strengthened logic
-	name, _, err := utils.DetermineFilename(rawurl, resp, false)
+	name, body, err := utils.DetermineFilename(rawurl, resp, false)
 	if err != nil {
 		utils.Debug("Error determining filename: %v", err)
 		name = "download.bin"
-	}
-
-	if filenameHint != "" {
-		result.Filename = filenameHint
 	} else {
-		result.Filename = name
+		result.Head, _ = io.ReadAll(io.LimitReader(body, ProbeHeadSize))
 	}
+	result.Filename = name
 
+	result.FinalURL = rawurl
+	if resp.Request != nil && resp.Request.URL != nil {
+		result.FinalURL = resp.Request.URL.String()
+	}
 	result.ContentType = resp.Header.Get("Content-Type")
+	result.ETag = resp.Header.Get("ETag")
+	result.LastModified = resp.Header.Get("Last-Modified")
+	result.Checksum = types.ReprDigest(resp)
+	result.Header = resp.Header.Clone()
 
 	utils.Debug("Probe complete - filename: %s, size: %d, range: %v",
 		result.Filename, result.FileSize, result.SupportsRange)
@@ -124,8 +202,22 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 	return result, nil
 }
 
-// ProbeMirrors concurrently checks a list of mirrors and returns valid ones and errors
-func ProbeMirrors(ctx context.Context, mirrors []string) (valid []string, errors map[string]error) {
+// parseSize reads a Content-Length or Content-Range total. Negative sizes and
+// ones past the int64 limit (ParseInt would clamp them to 8 EiB) are treated
+// as unknown rather than trusted.
+func parseSize(s string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// ProbeMirrors concurrently checks a list of mirrors and returns valid ones and errors.
+// When ref, the probe of the primary URL, is set, mirrors that don't serve the
+// same file (see CheckMirrorConsistent) are rejected so their chunks are never
+// mixed with the primary's.
+func ProbeMirrors(ctx context.Context, mirrors []string, runtime *types.RuntimeConfig, ref *ProbeResult) (valid []string, errors map[string]error) {
 	// Deduplicate
 	unique := make(map[string]bool)
 	for _, m := range mirrors {
@@ -153,7 +245,7 @@ func ProbeMirrors(ctx context.Context, mirrors []string) (valid []string, errors
 			probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 			defer cancel()
 
-			result, err := ProbeServer(probeCtx, target, "")
+			result, err := ProbeServer(probeCtx, target, "", runtime)
 
 			mu.Lock()
 			defer mu.Unlock()
@@ -163,11 +255,17 @@ func ProbeMirrors(ctx context.Context, mirrors []string) (valid []string, errors
 				return
 			}
 
-			if result.SupportsRange {
-				valid = append(valid, target)
-			} else {
+			if !result.SupportsRange {
 				errors[target] = fmt.Errorf("does not support ranges")
+				return
+			}
+			if ref != nil {
+				if err := CheckMirrorConsistent(ref, result); err != nil {
+					errors[target] = err
+					return
+				}
 			}
+			valid = append(valid, target)
 		}(url)
 	}
 
@@ -175,3 +273,40 @@ func ProbeMirrors(ctx context.Context, mirrors []string) (valid []string, errors
 	utils.Debug("Mirror probing complete: %d valid, %d failed", len(valid), len(errors))
 	return valid, errors
 }
+
+// CheckMirrorConsistent reports whether mirror appears to serve the same
+// file as ref. The sizes must match. Equal ETags settle it; otherwise
+// Last-Modified decides when both sent one, since independent servers often
+// compute different ETags for the same file. Different ETags with nothing
+// else to go on count as different files. Without validators, a matching
+// size is all there is to check.
+func CheckMirrorConsistent(ref, mirror *ProbeResult) error {
+	if ref.FileSize > 0 && mirror.FileSize != ref.FileSize {
+		return fmt.Errorf("size %d differs from %d", mirror.FileSize, ref.FileSize)
+	}
+	refTag, mirrorTag := strings.TrimPrefix(ref.ETag, "W/"), strings.TrimPrefix(mirror.ETag, "W/")
+	if refTag != "" && refTag == mirrorTag {
+		return nil
+	}
+	if ref.LastModified != "" && mirror.LastModified != "" {
+		if !sameHTTPTime(ref.LastModified, mirror.LastModified) {
+			return fmt.Errorf("last modified %s, not %s", mirror.LastModified, ref.LastModified)
+		}
+		return nil
+	}
+	if refTag != "" && mirrorTag != "" {
+		return fmt.Errorf("ETag %s differs from %s", mirror.ETag, ref.ETag)
+	}
+	return nil
+}
+
+// sameHTTPTime compares two HTTP dates, falling back to the raw strings if
+// either does not parse
+func sameHTTPTime(a, b string) bool {
+	ta, errA := http.ParseTime(a)
+	tb, errB := http.ParseTime(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return ta.Equal(tb)
+}
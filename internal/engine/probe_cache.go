@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// maxProbeCacheEntries bounds the cache when many URLs are added at once
+const maxProbeCacheEntries = 512
+
+type probeCacheEntry struct {
+	result  ProbeResult // As probed, before any filename hint
+	expires time.Time
+}
+
+// probeCache holds recent successful probes by URL and network policy
+type probeCache struct {
+	mu      sync.Mutex
+	entries map[string]probeCacheEntry
+	now     func() time.Time
+}
+
+var probes = &probeCache{entries: make(map[string]probeCacheEntry), now: time.Now}
+
+// probeCacheKey identifies a probe of rawurl. The network policy is part of
+// it, so a probe made without restrictions, through another proxy or with
+// other credentials is never reused under them.
+func probeCacheKey(rawurl string, runtime *types.RuntimeConfig) string {
+	if runtime == nil {
+		return rawurl
+	}
+	key := fmt.Sprintf("%s\x00%t\x00%s\x00%d\x00%s\x00%v\x00%t", rawurl, runtime.BlockPrivateNetworks, strings.Join(runtime.AllowedNetworks, ","), runtime.MaxRedirects, runtime.Proxy, runtime.Headers, runtime.Authorizer != nil)
+	for _, c := range runtime.Cookies {
+		key += "\x00" + c.Domain + c.Path + "\x00" + c.Name + "=" + c.Value
+	}
+	return key
+}
+
+func (c *probeCache) get(key string) (ProbeResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		return ProbeResult{}, false
+	}
+	return e.result, true
+}
+
+func (c *probeCache) put(key string, result ProbeResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.entries) >= maxProbeCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxProbeCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = probeCacheEntry{result: result, expires: now.Add(types.ProbeCacheTTL)}
+}
+
+// ForgetProbe drops the cached probes of rawurl, e.g. once it is known to
+// have changed
+func ForgetProbe(rawurl string) {
+	probes.mu.Lock()
+	defer probes.mu.Unlock()
+	for k := range probes.entries {
+		if k == rawurl || strings.HasPrefix(k, rawurl+"\x00") {
+			delete(probes.entries, k)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestProbeServer_Cached(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/files/data.bin", http.StatusFound)
+			return
+		}
+		requests.Add(1)
+		w.Header().Set("Content-Range", "bytes 0-0/1000")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte{0})
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	oldProbes := probes
+	probes = &probeCache{entries: make(map[string]probeCacheEntry), now: func() time.Time { return now }}
+	defer func() { probes = oldProbes }()
+
+	ctx := context.Background()
+	first, err := ProbeServer(ctx, server.URL+"/start", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FinalURL != server.URL+"/files/data.bin" || first.FileSize != 1000 || !first.SupportsRange {
+		t.Errorf("probe = %+v", first)
+	}
+
+	// Reused, with the caller's filename hint applied to the copy only
+	second, err := ProbeServer(ctx, server.URL+"/start", "renamed.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("server probed %d times, want 1", requests.Load())
+	}
+	if second.Filename != "renamed.bin" || second.ETag != `"v1"` {
+		t.Errorf("cached probe = %+v", second)
+	}
+	if third, _ := ProbeServer(ctx, server.URL+"/start", "", nil); third.Filename != first.Filename {
+		t.Errorf("filename hint leaked into the cache: %q", third.Filename)
+	}
+
+	// A different network policy probes again
+	if _, err := ProbeServer(ctx, server.URL+"/start", "", &types.RuntimeConfig{MaxRedirects: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("server probed %d times under a new policy, want 2", requests.Load())
+	}
+
+	// Expired and forgotten entries are probed again
+	now = now.Add(types.ProbeCacheTTL)
+	ProbeServer(ctx, server.URL+"/start", "", nil)
+	if requests.Load() != 3 {
+		t.Errorf("server probed %d times after expiry, want 3", requests.Load())
+	}
+	ForgetProbe(server.URL + "/start")
+	ProbeServer(ctx, server.URL+"/start", "", nil)
+	if requests.Load() != 4 {
+		t.Errorf("server probed %d times after ForgetProbe, want 4", requests.Load())
+	}
+}
+
+func TestCheckMirrorConsistent(t *testing.T) {
+	const (
+		jan = "Mon, 01 Jan 2024 00:00:00 GMT"
+		feb = "Thu, 01 Feb 2024 00:00:00 GMT"
+	)
+	ref := &ProbeResult{FileSize: 100, ETag: `"abc"`, LastModified: jan}
+	tests := []struct {
+		name   string
+		mirror ProbeResult
+		ok     bool
+	}{
+		{"same validators", ProbeResult{FileSize: 100, ETag: `"abc"`, LastModified: jan}, true},
+		{"weak ETag", ProbeResult{FileSize: 100, ETag: `W/"abc"`}, true},
+		{"other size", ProbeResult{FileSize: 99, ETag: `"abc"`, LastModified: jan}, false},
+		{"own ETag, same time", ProbeResult{FileSize: 100, ETag: `"xyz"`, LastModified: "Monday, 01-Jan-24 00:00:00 GMT"}, true},
+		{"own ETag, other time", ProbeResult{FileSize: 100, ETag: `"xyz"`, LastModified: feb}, false},
+		{"other time, no ETag", ProbeResult{FileSize: 100, LastModified: feb}, false},
+		{"no validators", ProbeResult{FileSize: 100}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckMirrorConsistent(ref, &tt.mirror); (err == nil) != tt.ok {
+				t.Errorf("CheckMirrorConsistent() = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+
+	// Different ETags and no time to compare
+	if err := CheckMirrorConsistent(&ProbeResult{FileSize: 100, ETag: `"abc"`}, &ProbeResult{FileSize: 100, ETag: `"xyz"`}); err == nil {
+		t.Error("mirror with a different ETag accepted")
+	}
+}
+
+func TestProbeMirrors_RejectsStaleMirror(t *testing.T) {
+	serve := func(size, etag string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-0/"+size)
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte{0})
+		}))
+	}
+	primary := serve("1000", `"v2"`)
+	defer primary.Close()
+	current := serve("1000", `"v2"`)
+	defer current.Close()
+	stale := serve("1000", `"v1"`)
+	defer stale.Close()
+	shorter := serve("900", `"v2"`)
+	defer shorter.Close()
+
+	ctx := context.Background()
+	ref, err := ProbeServer(ctx, primary.URL, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, errs := ProbeMirrors(ctx, []string{primary.URL, current.URL, stale.URL, shorter.URL}, nil, ref)
+	if len(valid) != 2 || errs[stale.URL] == nil || errs[shorter.URL] == nil {
+		t.Errorf("ProbeMirrors() valid = %v, errors = %v; want the stale and shorter mirrors rejected", valid, errs)
+	}
+}
+
+func TestProbeServer_HugeSizes(t *testing.T) {
+	tests := []struct {
+		contentRange string
+		want         int64
+	}{
+		{"bytes 0-0/4294967297", 4<<30 + 1},
+		{"bytes 0-0/9223372036854775807", 9223372036854775807},
+		// Past int64, or negative: the size is unknown rather than clamped
+		{"bytes 0-0/9223372036854775808", 0},
+		{"bytes 0-0/-5", 0},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", tt.contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte{0})
+		}))
+		result, err := probeServer(context.Background(), server.URL, nil)
+		server.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.contentRange, err)
+		}
+		if result.FileSize != tt.want {
+			t.Errorf("%s: FileSize = %d, want %d", tt.contentRange, result.FileSize, tt.want)
+		}
+	}
+}
+
+func TestProbeServer_CookieSetByRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.SetCookie(w, &http.Cookie{Name: "gate", Value: "ok", Path: "/"})
+			http.Redirect(w, r, "/files/data.bin", http.StatusFound)
+			return
+		}
+		if c, err := r.Cookie("gate"); err != nil || c.Value != "ok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Range", "bytes 0-0/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte{0})
+	}))
+	defer server.Close()
+
+	for _, runtime := range []*types.RuntimeConfig{nil, {MaxRedirects: 5}} {
+		result, err := probeServer(context.Background(), server.URL+"/start", runtime)
+		if err != nil {
+			t.Fatalf("runtime %+v: %v", runtime, err)
+		}
+		if result.FileSize != 1000 {
+			t.Errorf("runtime %+v: FileSize = %d, want 1000", runtime, result.FileSize)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package ratelimit caps how fast downloads receive data
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// burst is how much of its rate a Limiter saves up while nothing is read,
+// so reads after a pause don't all wait
+const burst = 250 * time.Millisecond
+
+// maxSleep is the longest a waiter sleeps before looking at the rate again,
+// so a raised or removed limit takes effect quickly
+const maxSleep = 100 * time.Millisecond
+
+// Limiter is a token bucket capping the bytes per second passed through it.
+// A nil Limiter, or one with a rate of 0, lets everything through. It is safe
+// for concurrent use, and its rate may change while readers wait on it.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64   // Bytes per second, 0 for no limit
+	tokens float64   // Bytes that may pass now; negative while reads are owed
+	last   time.Time // When tokens was last brought up to date
+}
+
+// New returns a Limiter passing rate bytes per second, 0 for no limit
+func New(rate int64) *Limiter {
+	l := &Limiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the limit to rate bytes per second, 0 for none
+func (l *Limiter) SetRate(rate int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = float64(max(rate, 0))
+	if l.rate == 0 {
+		l.tokens = 0
+	}
+}
+
+// Rate returns the limit in bytes per second, 0 for none
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// WaitN takes n bytes from the bucket, waiting until the rate allows them or
+// ctx is done. Bytes already read are owed rather than refused, so n may be
+// larger than the bucket holds.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	l.refill(time.Now())
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.tokens -= float64(n)
+	l.mu.Unlock()
+
+	for {
+		l.mu.Lock()
+		l.refill(time.Now())
+		if l.rate == 0 || l.tokens >= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(min(wait, maxSleep))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// refill adds the tokens earned since the last refill, up to the burst.
+// Must hold l.mu.
+func (l *Limiter) refill(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate*burst.Seconds())
+	}
+	l.last = now
+}
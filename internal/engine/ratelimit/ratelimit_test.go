@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Unlimited(t *testing.T) {
+	var nilLimiter *Limiter
+	for _, l := range []*Limiter{nilLimiter, New(0)} {
+		start := time.Now()
+		for range 100 {
+			if err := l.WaitN(context.Background(), 1<<20); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Errorf("unlimited limiter waited %v", elapsed)
+		}
+	}
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	const rate = 100 << 10
+	l := New(rate)
+
+	// Four readers share the rate: 50 KB past the burst takes about 0.5s
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				l.WaitN(context.Background(), 2<<10)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("80 KB at 100 KB/s took %v, want about 0.55s", elapsed)
+	}
+}
+
+func TestLimiter_SetRate(t *testing.T) {
+	l := New(1 << 10)
+	done := make(chan error, 1)
+	go func() {
+		// Owes almost a minute at 1 KB/s
+		done <- l.WaitN(context.Background(), 60<<10)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	l.SetRate(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("removing the limit did not release the waiter")
+	}
+	if l.Rate() != 0 {
+		t.Errorf("Rate = %d, want 0", l.Rate())
+	}
+}
+
+func TestLimiter_Cancel(t *testing.T) {
+	l := New(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 1<<20); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want the context's", err)
+	}
+}
@@ -0,0 +1,451 @@
+// Package sftp downloads files over SFTP (version 3, as spoken by OpenSSH).
+// The SSH connection is made in-process with golang.org/x/crypto/ssh. It
+// logs in with ssh-agent and identity files, and checks hosts against
+// known_hosts.
+package sftp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Packet types (draft-ietf-secsh-filexfer-02)
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpStat     = 17
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpAttrs    = 105
+	fxfRead     = 0x1
+	protocolVer = 3
+)
+
+// Status codes
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+)
+
+// Attribute flags
+const (
+	attrSize        = 0x1
+	attrUIDGID      = 0x2
+	attrPermissions = 0x4
+	attrACModTime   = 0x8
+)
+
+const (
+	readSize     = 32 << 10  // Bytes asked for per read; every server accepts this
+	readWindow   = 32        // Reads kept in flight while streaming
+	maxPacketLen = 256 << 10 // Largest packet accepted from the server
+)
+
+var (
+	ErrNotExist   = errors.New("no such file")
+	ErrPermission = errors.New("permission denied")
+)
+
+// StatusError is a failure the server reported
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("sftp: %s (code %d)", e.Message, e.Code)
+	}
+	return fmt.Sprintf("sftp: status %d", e.Code)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotExist:
+		return e.Code == fxNoSuchFile
+	case ErrPermission:
+		return e.Code == fxPermissionDenied
+	}
+	return false
+}
+
+// Attrs are the file attributes Surge uses
+type Attrs struct {
+	Size    int64 // -1 when the server did not say
+	ModTime time.Time
+}
+
+type packet struct {
+	typ  byte
+	data []byte // After the request ID
+}
+
+// Client is an SFTP session over a connection to the server's sftp
+// subsystem. Requests may be issued from several goroutines.
+type Client struct {
+	conn io.ReadWriteCloser
+
+	wmu sync.Mutex // Serializes packet writes
+
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan packet
+	err     error         // Why the connection stopped
+	done    chan struct{} // Closed when the connection stops
+}
+
+// NewClient starts an SFTP session on conn, which carries the sftp
+// subsystem's stdin and stdout
+func NewClient(conn io.ReadWriteCloser) (*Client, error) {
+	init := binary.BigEndian.AppendUint32([]byte{fxpInit}, protocolVer)
+	if err := writePacket(conn, init); err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	p, err := readPacket(conn)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: no reply from server: %w", err)
+	}
+	if len(p) < 5 || p[0] != fxpVersion {
+		return nil, fmt.Errorf("sftp: unexpected reply %d to init", p[0])
+	}
+	if v := binary.BigEndian.Uint32(p[1:5]); v < protocolVer {
+		return nil, fmt.Errorf("sftp: server speaks version %d, need %d", v, protocolVer)
+	}
+
+	c := &Client{
+		conn:    conn,
+		pending: make(map[uint32]chan packet),
+		done:    make(chan struct{}),
+	}
+	go c.recvLoop()
+	return c, nil
+}
+
+// Close ends the session
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) recvLoop() {
+	var err error
+	for {
+		var p []byte
+		if p, err = readPacket(c.conn); err != nil {
+			break
+		}
+		if len(p) < 5 {
+			err = fmt.Errorf("short packet")
+			break
+		}
+		id := binary.BigEndian.Uint32(p[1:5])
+		c.mu.Lock()
+		ch := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- packet{typ: p[0], data: p[5:]}
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	c.mu.Lock()
+	c.err = fmt.Errorf("sftp: connection lost: %w", err)
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// send issues a request and returns where its reply will arrive
+func (c *Client) send(typ byte, payload []byte) (<-chan packet, error) {
+	ch := make(chan packet, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	msg := binary.BigEndian.AppendUint32([]byte{typ}, id)
+	if err := c.write(append(msg, payload...)); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	return ch, nil
+}
+
+func (c *Client) write(p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return writePacket(c.conn, p)
+}
+
+// wait returns the reply on ch
+func (c *Client) wait(ctx context.Context, ch <-chan packet) (packet, error) {
+	select {
+	case p := <-ch:
+		return p, nil
+	case <-c.done:
+		// The reply may have landed just before the connection stopped
+		select {
+		case p := <-ch:
+			return p, nil
+		default:
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return packet{}, c.err
+	case <-ctx.Done():
+		return packet{}, ctx.Err()
+	}
+}
+
+func (c *Client) call(ctx context.Context, typ byte, payload []byte) (packet, error) {
+	ch, err := c.send(typ, payload)
+	if err != nil {
+		return packet{}, err
+	}
+	return c.wait(ctx, ch)
+}
+
+// Stat returns the attributes of path, following symlinks
+func (c *Client) Stat(ctx context.Context, path string) (Attrs, error) {
+	p, err := c.call(ctx, fxpStat, appendString(nil, path))
+	if err != nil {
+		return Attrs{}, err
+	}
+	switch p.typ {
+	case fxpAttrs:
+		return parseAttrs(p.data)
+	case fxpStatus:
+		return Attrs{}, statusError(p.data)
+	}
+	return Attrs{}, fmt.Errorf("sftp: unexpected reply %d to stat", p.typ)
+}
+
+// File is a remote file open for reading
+type File struct {
+	c      *Client
+	handle []byte
+}
+
+// Open opens path for reading
+func (c *Client) Open(ctx context.Context, path string) (*File, error) {
+	payload := appendString(nil, path)
+	payload = binary.BigEndian.AppendUint32(payload, fxfRead)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // No attributes
+	p, err := c.call(ctx, fxpOpen, payload)
+	if err != nil {
+		return nil, err
+	}
+	switch p.typ {
+	case fxpHandle:
+		handle, _, ok := readString(p.data)
+		if !ok {
+			return nil, fmt.Errorf("sftp: malformed handle")
+		}
+		return &File{c: c, handle: handle}, nil
+	case fxpStatus:
+		return nil, statusError(p.data)
+	}
+	return nil, fmt.Errorf("sftp: unexpected reply %d to open", p.typ)
+}
+
+// Close releases the file's handle on the server
+func (f *File) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := f.c.call(ctx, fxpClose, appendString(nil, string(f.handle)))
+	if err != nil {
+		return err
+	}
+	if p.typ == fxpStatus {
+		return statusError(p.data)
+	}
+	return nil
+}
+
+func (f *File) readAsync(off int64, n int) (<-chan packet, error) {
+	payload := appendString(nil, string(f.handle))
+	payload = binary.BigEndian.AppendUint64(payload, uint64(off))
+	payload = binary.BigEndian.AppendUint32(payload, uint32(n))
+	return f.c.send(fxpRead, payload)
+}
+
+// readReply returns the data of a read reply, or io.EOF past the end
+func readReply(p packet) ([]byte, error) {
+	switch p.typ {
+	case fxpData:
+		data, _, ok := readString(p.data)
+		if !ok {
+			return nil, fmt.Errorf("sftp: malformed data")
+		}
+		return data, nil
+	case fxpStatus:
+		return nil, statusError(p.data)
+	}
+	return nil, fmt.Errorf("sftp: unexpected reply %d to read", p.typ)
+}
+
+// WriteTo streams the file from offset off to w until its end, keeping
+// several reads in flight so throughput does not hinge on latency. It
+// returns the bytes written.
+func (f *File) WriteTo(ctx context.Context, w io.Writer, off int64) (int64, error) {
+	type read struct {
+		off int64
+		ch  <-chan packet
+	}
+	var (
+		queue   []read
+		next    = off
+		written int64
+	)
+	for {
+		for len(queue) < readWindow {
+			ch, err := f.readAsync(next, readSize)
+			if err != nil {
+				return written, err
+			}
+			queue = append(queue, read{off: next, ch: ch})
+			next += readSize
+		}
+
+		r := queue[0]
+		queue = queue[1:]
+		p, err := f.c.wait(ctx, r.ch)
+		if err != nil {
+			return written, err
+		}
+		data, err := readReply(p)
+		if errors.Is(err, io.EOF) {
+			// Later reads are past the end too; their replies are dropped
+			return written, nil
+		}
+		if err == nil && len(data) == 0 {
+			err = fmt.Errorf("sftp: server returned no data at offset %d", r.off)
+		}
+		if err != nil {
+			return written, err
+		}
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if len(data) < readSize {
+			// A short read leaves a gap, so the reads queued after it
+			// are abandoned and streaming restarts where it stopped
+			queue = nil
+			next = r.off + int64(len(data))
+		}
+	}
+}
+
+func statusError(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("sftp: malformed status")
+	}
+	code := binary.BigEndian.Uint32(data)
+	msg, _, _ := readString(data[4:])
+	switch code {
+	case fxOK:
+		return nil
+	case fxEOF:
+		return io.EOF
+	}
+	return &StatusError{Code: code, Message: string(msg)}
+}
+
+func parseAttrs(b []byte) (Attrs, error) {
+	bad := fmt.Errorf("sftp: malformed attributes")
+	a := Attrs{Size: -1}
+	if len(b) < 4 {
+		return a, bad
+	}
+	flags := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if flags&attrSize != 0 {
+		if len(b) < 8 {
+			return a, bad
+		}
+		a.Size = int64(binary.BigEndian.Uint64(b))
+		if a.Size < 0 {
+			a.Size = -1
+		}
+		b = b[8:]
+	}
+	if flags&attrUIDGID != 0 {
+		if len(b) < 8 {
+			return a, bad
+		}
+		b = b[8:]
+	}
+	if flags&attrPermissions != 0 {
+		if len(b) < 4 {
+			return a, bad
+		}
+		b = b[4:]
+	}
+	if flags&attrACModTime != 0 {
+		if len(b) < 8 {
+			return a, bad
+		}
+		a.ModTime = time.Unix(int64(binary.BigEndian.Uint32(b[4:])), 0)
+	}
+	// Extended attributes follow; Surge has no use for them
+	return a, nil
+}
+
+func writePacket(w io.Writer, p []byte) error {
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(p)), uint32(len(p)))
+	_, err := w.Write(append(buf, p...))
+	return err
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n == 0 || n > maxPacketLen {
+		return nil, fmt.Errorf("packet of %d bytes", n)
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (s, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
@@ -0,0 +1,181 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer answers SFTP requests for the files in its map. Reads return at
+// most maxRead bytes, to exercise short reads.
+type fakeServer struct {
+	files   map[string][]byte
+	mtime   time.Time
+	maxRead int
+}
+
+func (s *fakeServer) serve(conn io.ReadWriter) error {
+	handles := map[string]string{}
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+		typ, body := p[0], p[1:]
+		if typ == fxpInit {
+			if err := writePacket(conn, binary.BigEndian.AppendUint32([]byte{fxpVersion}, protocolVer)); err != nil {
+				return err
+			}
+			continue
+		}
+		id := body[:4]
+		body = body[4:]
+		reply := func(typ byte, payload []byte) error {
+			return writePacket(conn, append(append([]byte{typ}, id...), payload...))
+		}
+		status := func(code uint32, msg string) error {
+			return reply(fxpStatus, appendString(appendString(binary.BigEndian.AppendUint32(nil, code), msg), ""))
+		}
+
+		name, rest, _ := readString(body)
+		switch typ {
+		case fxpStat:
+			data, ok := s.files[string(name)]
+			if !ok {
+				err = status(fxNoSuchFile, "No such file")
+				break
+			}
+			attrs := binary.BigEndian.AppendUint32(nil, attrSize|attrACModTime)
+			attrs = binary.BigEndian.AppendUint64(attrs, uint64(len(data)))
+			attrs = binary.BigEndian.AppendUint32(attrs, uint32(s.mtime.Unix()))
+			attrs = binary.BigEndian.AppendUint32(attrs, uint32(s.mtime.Unix()))
+			err = reply(fxpAttrs, attrs)
+		case fxpOpen:
+			if _, ok := s.files[string(name)]; !ok {
+				err = status(fxNoSuchFile, "No such file")
+				break
+			}
+			handle := "h" + string(name)
+			handles[handle] = string(name)
+			err = reply(fxpHandle, appendString(nil, handle))
+		case fxpRead:
+			data := s.files[handles[string(name)]]
+			off := binary.BigEndian.Uint64(rest)
+			n := uint64(binary.BigEndian.Uint32(rest[8:]))
+			if off >= uint64(len(data)) {
+				err = status(fxEOF, "")
+				break
+			}
+			n = min(n, uint64(s.maxRead), uint64(len(data))-off)
+			err = reply(fxpData, appendString(nil, string(data[off:off+n])))
+		case fxpClose:
+			delete(handles, string(name))
+			err = status(fxOK, "")
+		default:
+			err = status(8, "unsupported")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func newTestClient(t *testing.T, s *fakeServer) *Client {
+	t.Helper()
+	local, remote := net.Pipe()
+	go s.serve(remote)
+	c, err := NewClient(local)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestClient_StatAndStream(t *testing.T) {
+	data := testData(300_000)
+	mtime := time.Unix(1700000000, 0)
+	c := newTestClient(t, &fakeServer{
+		files:   map[string][]byte{"/srv/file.bin": data},
+		mtime:   mtime,
+		maxRead: 20_000, // Shorter than readSize, so every read is short
+	})
+	ctx := context.Background()
+
+	attrs, err := c.Stat(ctx, "/srv/file.bin")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if attrs.Size != int64(len(data)) || !attrs.ModTime.Equal(mtime) {
+		t.Errorf("Stat = %+v", attrs)
+	}
+
+	f, err := c.Open(ctx, "/srv/file.bin")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	for _, off := range []int64{0, 123_456} {
+		var buf bytes.Buffer
+		n, err := f.WriteTo(ctx, &buf, off)
+		if err != nil {
+			t.Fatalf("WriteTo(%d): %v", off, err)
+		}
+		if n != int64(len(data))-off || !bytes.Equal(buf.Bytes(), data[off:]) {
+			t.Errorf("WriteTo(%d) streamed %d bytes, content match %v", off, n, bytes.Equal(buf.Bytes(), data[off:]))
+		}
+	}
+}
+
+func TestClient_FullReads(t *testing.T) {
+	data := testData(5*readSize + 17)
+	c := newTestClient(t, &fakeServer{files: map[string][]byte{"f": data}, maxRead: readSize})
+	f, err := c.Open(context.Background(), "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(context.Background(), &buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("streamed %d bytes, want %d", buf.Len(), len(data))
+	}
+}
+
+func TestClient_NotExist(t *testing.T) {
+	c := newTestClient(t, &fakeServer{files: map[string][]byte{}})
+	if _, err := c.Stat(context.Background(), "missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat error = %v, want ErrNotExist", err)
+	}
+	if _, err := c.Open(context.Background(), "missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Open error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestClient_ConnectionLost(t *testing.T) {
+	local, remote := net.Pipe()
+	go (&fakeServer{}).serve(remote)
+	c, err := NewClient(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.Close()
+	if _, err := c.Stat(context.Background(), "f"); err == nil {
+		t.Error("expected an error after the server went away")
+	}
+}
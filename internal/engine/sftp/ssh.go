@@ -0,0 +1,368 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Location is the remote side of an sftp:// URL
+type Location struct {
+	User string // Empty for the local user name
+	Host string
+	Port int // 0 for 22
+	Path string
+}
+
+// IsURL reports whether raw is an sftp:// or scp:// URL. scp:// is accepted
+// as an alias since OpenSSH servers serve both from the same accounts.
+func IsURL(raw string) bool {
+	scheme, _, ok := strings.Cut(raw, "://")
+	return ok && (strings.EqualFold(scheme, "sftp") || strings.EqualFold(scheme, "scp"))
+}
+
+// ParseURL parses sftp://[user@]host[:port]/path. The path is absolute;
+// /~/path is relative to the user's home directory, as with curl.
+func ParseURL(raw string) (Location, error) {
+	if !IsURL(raw) {
+		return Location{}, fmt.Errorf("sftp: not an sftp:// URL")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Location{}, fmt.Errorf("sftp: %w", err)
+	}
+	loc := Location{Host: u.Hostname(), Path: u.Path}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return Location{}, fmt.Errorf("sftp: passwords in URLs are not supported; use ssh-agent or an identity file")
+		}
+		loc.User = u.User.Username()
+	}
+	if loc.Host == "" || strings.HasPrefix(loc.Host, "-") || strings.HasPrefix(loc.User, "-") {
+		return Location{}, fmt.Errorf("sftp: invalid host in %q", raw)
+	}
+	if p := u.Port(); p != "" {
+		if loc.Port, err = strconv.Atoi(p); err != nil || loc.Port <= 0 || loc.Port > 65535 {
+			return Location{}, fmt.Errorf("sftp: invalid port %q", p)
+		}
+	}
+	if rel, ok := strings.CutPrefix(loc.Path, "/~/"); ok {
+		loc.Path = rel
+	}
+	if loc.Path == "" || strings.HasSuffix(loc.Path, "/") {
+		return Location{}, fmt.Errorf("sftp: %q does not name a file", raw)
+	}
+	return loc, nil
+}
+
+// addr returns the host and port to connect to
+func (loc Location) addr() string {
+	port := loc.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(loc.Host, strconv.Itoa(port))
+}
+
+// Options configure the SSH connection
+type Options struct {
+	IdentityFile string // Tried in addition to ssh-agent and the default keys in ~/.ssh
+	KnownHosts   string // Replaces ~/.ssh/known_hosts when set
+	Timeout      time.Duration
+
+	// Dial opens the connection to the server, e.g. through a proxy; nil
+	// connects directly
+	Dial func(ctx context.Context, addr string) (net.Conn, error)
+
+	// UserKeys allows logging in with ssh-agent and the default keys in
+	// ~/.ssh, which belong to whoever runs Surge. Leave it unset for
+	// downloads other people ask for.
+	UserKeys bool
+}
+
+// defaultPort is the SSH port of URLs without one
+const defaultPort = 22
+
+// defaultIdentities are the keys in ~/.ssh tried after ssh-agent, as ssh does
+var defaultIdentities = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// Dial connects to loc over SSH and starts an SFTP session. Logins use
+// keys only, since no terminal is available to answer prompts, and hosts
+// must already be in known_hosts. ctx bounds the connection setup only;
+// Close ends the session.
+func Dial(ctx context.Context, loc Location, opts Options) (*Client, error) {
+	type result struct {
+		c   *Client
+		err error
+	}
+	ready := make(chan result, 1)
+	go func() {
+		c, err := connect(ctx, loc, opts)
+		ready <- result{c, err}
+	}()
+	select {
+	case r := <-ready:
+		if r.err != nil {
+			return nil, fmt.Errorf("ssh %s: %w", loc.Host, r.err)
+		}
+		return r.c, nil
+	case <-ctx.Done():
+		go func() {
+			// Close whatever the setup ends with
+			if r := <-ready; r.c != nil {
+				r.c.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// connect logs in to loc's server and opens the sftp subsystem
+func connect(ctx context.Context, loc Location, opts Options) (*Client, error) {
+	// ssh-agent signs the login, so it is only needed until then
+	var agentClient agent.Agent
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" && opts.UserKeys {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			defer conn.Close()
+			agentClient = agent.NewClient(conn)
+		}
+	}
+	config, err := clientConfig(loc, opts, agentClient)
+	if err != nil {
+		return nil, err
+	}
+	dial := opts.Dial
+	if dial == nil {
+		var d net.Dialer
+		dial = func(ctx context.Context, addr string) (net.Conn, error) { return d.DialContext(ctx, "tcp", addr) }
+	}
+	netConn, err := dial(ctx, loc.addr())
+	if err != nil {
+		return nil, err
+	}
+	// Timeout covers the SSH handshake and login, as with ssh.Dial
+	if opts.Timeout > 0 {
+		netConn.SetDeadline(time.Now().Add(opts.Timeout))
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(netConn, loc.addr(), config)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	client := ssh.NewClient(clientConn, chans, reqs)
+	conn, err := openSubsystem(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	c, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// openSubsystem starts the sftp subsystem in a new session of client. The
+// connection closes client with the session.
+func openSubsystem(client *ssh.Client) (*sshConn, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, fmt.Errorf("starting sftp: %w", err)
+	}
+	return &sshConn{client: client, session: session, stdin: stdin, stdout: stdout}, nil
+}
+
+// clientConfig returns the login and host key checks for loc. agentClient
+// may be nil.
+func clientConfig(loc Location, opts Options, agentClient agent.Agent) (*ssh.ClientConfig, error) {
+	name := loc.User
+	if name == "" {
+		name = localUser()
+		if name == "" {
+			return nil, errors.New("sftp: no user in the URL and no local user name")
+		}
+	}
+	hostKeys, algorithms, err := hostKeyCheck(loc, opts.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:              name,
+		Auth:              []ssh.AuthMethod{ssh.PublicKeysCallback(signers(opts.IdentityFile, opts.UserKeys, agentClient))},
+		HostKeyCallback:   hostKeys,
+		HostKeyAlgorithms: algorithms,
+		Timeout:           opts.Timeout,
+	}, nil
+}
+
+// signers returns the keys to log in with: ssh-agent's first, then the
+// identity file and, with userKeys, the default keys that exist. Keys with
+// a passphrase are skipped; load them into ssh-agent instead.
+func signers(identityFile string, userKeys bool, agentClient agent.Agent) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		var all []ssh.Signer
+		if agentClient != nil {
+			if keys, err := agentClient.Signers(); err == nil {
+				all = append(all, keys...)
+			}
+		}
+
+		for _, path := range identityFiles(identityFile, userKeys) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				if path == identityFile {
+					return nil, fmt.Errorf("identity file: %w", err)
+				}
+				continue
+			}
+			key, err := ssh.ParsePrivateKey(data)
+			if err != nil {
+				var missing *ssh.PassphraseMissingError
+				if path == identityFile && !errors.As(err, &missing) {
+					return nil, fmt.Errorf("identity file %s: %w", path, err)
+				}
+				continue
+			}
+			all = append(all, key)
+		}
+		if len(all) == 0 {
+			if !userKeys {
+				return nil, errors.New("no keys to log in with: set an identity file")
+			}
+			return nil, errors.New("no keys to log in with: start ssh-agent or set an identity file")
+		}
+		return all, nil
+	}
+}
+
+// identityFiles lists identityFile, if set, and with userKeys the default
+// keys in ~/.ssh
+func identityFiles(identityFile string, userKeys bool) []string {
+	var files []string
+	if identityFile != "" {
+		files = append(files, identityFile)
+	}
+	if !userKeys {
+		return files
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range defaultIdentities {
+			files = append(files, filepath.Join(home, ".ssh", name))
+		}
+	}
+	return files
+}
+
+// hostKeyCheck returns a callback refusing host keys that are not in
+// knownHosts, ~/.ssh/known_hosts by default, and the key algorithms to ask
+// loc's server for, so it offers a key type that is listed there
+func hostKeyCheck(loc Location, knownHosts string) (ssh.HostKeyCallback, []string, error) {
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("sftp: no known_hosts: %w", err)
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	check, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sftp: reading known hosts: %w", err)
+	}
+
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("host key not in %s; connect once with ssh to check and add it", knownHosts)
+			}
+			return fmt.Errorf("host key does not match %s:%d; it may have been changed or someone may be intercepting the connection",
+				keyErr.Want[0].Filename, keyErr.Want[0].Line)
+		}
+		return err
+	}
+	return callback, knownAlgorithms(check, loc), nil
+}
+
+// knownAlgorithms returns the host key algorithms matching the keys listed
+// for loc, nil to let the server choose when none are
+func knownAlgorithms(check ssh.HostKeyCallback, loc Location) []string {
+	// A key matching nothing makes the check list the keys it has
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(loc.addr(), &net.TCPAddr{IP: net.IPv4zero}, unknownKey{}), &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch t := known.Key.Type(); t {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, t)
+		}
+	}
+	return algorithms
+}
+
+// unknownKey is a host key no known_hosts line matches
+type unknownKey struct{}
+
+func (unknownKey) Type() string                        { return "none" }
+func (unknownKey) Marshal() []byte                     { return []byte("surge: no key") }
+func (unknownKey) Verify([]byte, *ssh.Signature) error { return errors.New("not a key") }
+
+// localUser returns the name of the user running Surge, without a domain
+func localUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		_, name, _ := strings.Cut(u.Username, `\`)
+		if name == "" {
+			name = u.Username
+		}
+		return name
+	}
+	return os.Getenv("USER")
+}
+
+// sshConn is the sftp subsystem's stdin and stdout
+type sshConn struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+}
+
+func (c *sshConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *sshConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// Close ends the session and the connection
+func (c *sshConn) Close() error {
+	c.stdin.Close()
+	c.session.Close()
+	return c.client.Close()
+}
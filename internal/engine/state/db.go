@@ -28,7 +28,11 @@ func Configure(path string) {
 func initDB() error {
 	dbMu.Lock()
 	defer dbMu.Unlock()
+	return openDB()
+}
 
+// openDB opens the database if it is not open yet. dbMu must be held.
+func openDB() error {
 	if db != nil {
 		return nil
 	}
@@ -39,13 +43,22 @@ func initDB() error {
 
 	// Ensure directory exists - caller should perhaps do this, but safe to do here if path is provided
 
-	// Open database
-	var err error
-	db, err = sql.Open("sqlite", dbPath)
+	// Open database. Downloads save progress while other goroutines read and
+	// write, so wait for a lock rather than fail with SQLITE_BUSY.
+	conn, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
+	if err := createTables(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	db = conn
+	return nil
+}
 
+// createTables creates the tables and runs the migrations
+func createTables(db *sql.DB) error {
 	// Create tables
 	query := `
 	CREATE TABLE IF NOT EXISTS downloads (
@@ -83,6 +96,44 @@ func initDB() error {
 	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN chunk_bitmap BLOB")
 	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN actual_chunk_size INTEGER")
 
+	// Migration: Validators checked before resuming
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN etag TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN last_modified TEXT")
+
+	// Migration: Request headers and checksum, for surge again
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN headers TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN checksum TEXT")
+
+	// Migration: Drop credentials that earlier versions saved with the headers
+	_, _ = db.Exec(`UPDATE downloads SET headers = NULLIF(json_remove(headers, '$.Authorization', '$."Proxy-Authorization"', '$.Cookie'), '{}')
+		WHERE headers IS NOT NULL AND json_valid(headers)`)
+
+	// Migration: Settings a resumed download is requested and checked with
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN expect_headers TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN signature TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN keyring TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN torrent TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN priority INTEGER")
+
+	// Migration: Owners of downloads added through a multi-user server. Kept
+	// apart from downloads because rows there are replaced on every save.
+	_, _ = db.Exec("CREATE TABLE IF NOT EXISTS owners (download_id TEXT PRIMARY KEY, owner TEXT NOT NULL)")
+
+	// Migration: Schedules of downloads saved before their start time, kept
+	// apart like owners
+	_, _ = db.Exec("CREATE TABLE IF NOT EXISTS schedules (download_id TEXT PRIMARY KEY, schedule TEXT NOT NULL)")
+
+	// Migration: Hashes of completed files for surge verify. Keyed by path so
+	// they outlive the download's history entry.
+	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS checksums (
+		path TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		mod_time INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		download_id TEXT,
+		checked_at INTEGER
+	)`)
+
 	return nil
 }
 
@@ -98,10 +149,10 @@ func CloseDB() {
 
 // GetDB returns the database instance, initializing it if necessary
 func GetDB() (*sql.DB, error) {
-	if db == nil {
-		if err := initDB(); err != nil {
-			return nil, err
-		}
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	if err := openDB(); err != nil {
+		return nil, err
 	}
 	return db, nil
 }
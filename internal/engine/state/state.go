@@ -4,12 +4,14 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
@@ -20,13 +22,14 @@ func URLHash(url string) string {
 	return hex.EncodeToString(h[:8]) // 16 chars
 }
 
-// SaveState saves download state to SQLite
+// SaveState saves download state to SQLite. Request settings left empty
+// keep the ones saved before, so a save that does not know them loses nothing.
 func SaveState(url string, destPath string, state *types.DownloadState) error {
 	// Ensure ID is set
 	if state.ID == "" {
 		// Try to find existing ID using StateHash equivalent or just generate new
 		// Ideally ID should be passed in, but for backward compat we handle it
-		state.ID = uuid.New().String()
+		state.ID = types.NewDownloadID()
 	}
 
 	// Set hashes and timestamps
@@ -40,8 +43,9 @@ func SaveState(url string, destPath string, state *types.DownloadState) error {
 		// 1. Upsert into downloads table
 		_, err := tx.Exec(`
 			INSERT INTO downloads (
-				id, url, dest_path, filename, status, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				id, url, dest_path, filename, status, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, etag, last_modified,
+				headers, expect_headers, checksum, signature, keyring, torrent, priority
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				url=excluded.url,
 				dest_path=excluded.dest_path,
@@ -54,8 +58,19 @@ func SaveState(url string, destPath string, state *types.DownloadState) error {
 				time_taken=excluded.time_taken,
 				mirrors=excluded.mirrors,
 				chunk_bitmap=excluded.chunk_bitmap,
-				actual_chunk_size=excluded.actual_chunk_size
-		`, state.ID, state.URL, state.DestPath, state.Filename, "paused", state.TotalSize, state.Downloaded, state.URLHash, state.CreatedAt, state.PausedAt, state.Elapsed/1e6, strings.Join(state.Mirrors, ","), state.ChunkBitmap, state.ActualChunkSize)
+				actual_chunk_size=excluded.actual_chunk_size,
+				etag=excluded.etag,
+				last_modified=excluded.last_modified,
+				headers=COALESCE(excluded.headers, downloads.headers),
+				expect_headers=COALESCE(excluded.expect_headers, downloads.expect_headers),
+				checksum=COALESCE(excluded.checksum, downloads.checksum),
+				signature=COALESCE(excluded.signature, downloads.signature),
+				keyring=COALESCE(excluded.keyring, downloads.keyring),
+				torrent=COALESCE(excluded.torrent, downloads.torrent),
+				priority=COALESCE(excluded.priority, downloads.priority)
+		`, state.ID, state.URL, state.DestPath, state.Filename, "paused", state.TotalSize, state.Downloaded, state.URLHash, state.CreatedAt, state.PausedAt, state.Elapsed/1e6, strings.Join(state.Mirrors, ","), state.ChunkBitmap, state.ActualChunkSize, state.ETag, state.LastModified,
+			encodeHeaders(state.Headers), encodeHeaders(state.ExpectHeaders), nullString(state.Checksum), nullString(state.Signature), nullString(state.Keyring), nullString(state.Torrent),
+			sql.NullInt64{Int64: int64(state.Priority), Valid: state.Priority != types.PriorityNormal})
 
 		if err != nil {
 			return fmt.Errorf("failed to upsert download: %w", err)
@@ -97,11 +112,14 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 
 	var state types.DownloadState
 	var timeTaken, createdAt, pausedAt, actualChunkSize sql.NullInt64 // handle null
-	var mirrors sql.NullString                                        // handle null mirrors
+	var mirrors, etag, lastModified sql.NullString                    // handle null text columns
+	var headers, expectHeaders, checksum, signature, keyring, torrent sql.NullString
+	var priority sql.NullInt64
 	var chunkBitmap []byte
 
 	row := db.QueryRow(`
-		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size
+		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, etag, last_modified,
+			headers, expect_headers, checksum, signature, keyring, torrent, priority
 		FROM downloads 
 		WHERE url = ? AND dest_path = ? AND status != 'completed'
 		ORDER BY paused_at DESC LIMIT 1
@@ -110,7 +128,8 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 	err := row.Scan(
 		&state.ID, &state.URL, &state.DestPath, &state.Filename,
 		&state.TotalSize, &state.Downloaded, &state.URLHash,
-		&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize,
+		&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize, &etag, &lastModified,
+		&headers, &expectHeaders, &checksum, &signature, &keyring, &torrent, &priority,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -136,6 +155,15 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 		state.ActualChunkSize = actualChunkSize.Int64
 	}
 	state.ChunkBitmap = chunkBitmap
+	state.ETag = etag.String
+	state.LastModified = lastModified.String
+	state.Headers = decodeHeaders(headers)
+	state.ExpectHeaders = decodeHeaders(expectHeaders)
+	state.Checksum = checksum.String
+	state.Signature = signature.String
+	state.Keyring = keyring.String
+	state.Torrent = torrent.String
+	state.Priority = types.Priority(priority.Int64)
 
 	// Load tasks
 	rows, err := db.Query("SELECT offset, length FROM tasks WHERE download_id = ?", state.ID)
@@ -204,7 +232,7 @@ func LoadMasterList() (*types.MasterList, error) {
 	}
 
 	rows, err := db.Query(`
-		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors 
+		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, headers, checksum
 		FROM downloads
 	`)
 	if err != nil {
@@ -215,12 +243,12 @@ func LoadMasterList() (*types.MasterList, error) {
 	var list types.MasterList
 	for rows.Next() {
 		var e types.DownloadEntry
-		var completedAt, timeTaken sql.NullInt64      // handle nulls
-		var filename, urlHash, mirrors sql.NullString // handle nulls
+		var completedAt, timeTaken sql.NullInt64                         // handle nulls
+		var filename, urlHash, mirrors, headers, checksum sql.NullString // handle nulls
 
 		if err := rows.Scan(
 			&e.ID, &e.URL, &e.DestPath, &filename, &e.Status, &e.TotalSize, &e.Downloaded,
-			&completedAt, &timeTaken, &urlHash, &mirrors,
+			&completedAt, &timeTaken, &urlHash, &mirrors, &headers, &checksum,
 		); err != nil {
 			return nil, err
 		}
@@ -240,6 +268,8 @@ func LoadMasterList() (*types.MasterList, error) {
 		if mirrors.Valid && mirrors.String != "" {
 			e.Mirrors = strings.Split(mirrors.String, ",")
 		}
+		e.Headers = decodeHeaders(headers)
+		e.Checksum = checksum.String
 
 		list.Downloads = append(list.Downloads, e)
 	}
@@ -247,7 +277,9 @@ func LoadMasterList() (*types.MasterList, error) {
 	return &list, nil
 }
 
-// AddToMasterList adds or updates a download entry
+// AddToMasterList adds or updates a download entry. An entry without
+// headers or a checksum keeps those saved before, so a status update does
+// not lose what surge again replays.
 func AddToMasterList(entry types.DownloadEntry) error {
 	// Ensure ID
 	if entry.ID == "" {
@@ -255,15 +287,15 @@ func AddToMasterList(entry types.DownloadEntry) error {
 			// Try to replicate existing ID logic or fail?
 			// Let's generate one if missing, but this might duplicate if not careful.
 			// Best effort:
-			entry.ID = uuid.New().String()
+			entry.ID = types.NewDownloadID()
 		}
 	}
 
 	return withTx(func(tx *sql.Tx) error {
 		_, err := tx.Exec(`
 			INSERT INTO downloads (
-				id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, headers, checksum
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				url=excluded.url,
 				dest_path=excluded.dest_path,
@@ -274,15 +306,70 @@ func AddToMasterList(entry types.DownloadEntry) error {
 				completed_at=excluded.completed_at,
 				time_taken=excluded.time_taken,
 				url_hash=excluded.url_hash,
-				mirrors=excluded.mirrors
+				mirrors=excluded.mirrors,
+				headers=COALESCE(excluded.headers, downloads.headers),
+				checksum=COALESCE(excluded.checksum, downloads.checksum)
 		`,
 			entry.ID, entry.URL, entry.DestPath, entry.Filename, entry.Status, entry.TotalSize, entry.Downloaded,
-			entry.CompletedAt, entry.TimeTaken, entry.URLHash, strings.Join(entry.Mirrors, ","))
+			entry.CompletedAt, entry.TimeTaken, entry.URLHash, strings.Join(entry.Mirrors, ","),
+			encodeHeaders(entry.Headers), sql.NullString{String: entry.Checksum, Valid: entry.Checksum != ""})
 
 		return err
 	})
 }
 
+// SaveSettings records the request settings of a download saved before it
+// started, for LoadState to return like those saved with resume state
+func SaveSettings(id string, settings types.RequestSettings) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec(`UPDATE downloads SET headers = COALESCE(?, headers), expect_headers = ?, signature = ?, keyring = ?, torrent = ?, priority = ? WHERE id = ?`,
+		encodeHeaders(settings.Headers), encodeHeaders(settings.ExpectHeaders), nullString(settings.Signature), nullString(settings.Keyring), nullString(settings.Torrent),
+		sql.NullInt64{Int64: int64(settings.Priority), Valid: settings.Priority != types.PriorityNormal}, id)
+	return err
+}
+
+// secretHeaders carry credentials, which are never written to the database;
+// they stay in memory or in the keyring
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// encodeHeaders stores request headers as JSON, without secretHeaders, NULL
+// if there are none
+func encodeHeaders(h http.Header) sql.NullString {
+	h = h.Clone()
+	for _, name := range secretHeaders {
+		h.Del(name)
+	}
+	if len(h) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// decodeHeaders reads headers stored by encodeHeaders
+func decodeHeaders(s sql.NullString) http.Header {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	var h http.Header
+	if err := json.Unmarshal([]byte(s.String), &h); err != nil {
+		return nil
+	}
+	return h
+}
+
 // RemoveFromMasterList removes a download entry
 func RemoveFromMasterList(id string) error {
 	db := getDBHelper()
@@ -291,9 +378,100 @@ func RemoveFromMasterList(id string) error {
 	}
 
 	_, err := db.Exec("DELETE FROM downloads WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM owners WHERE download_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM schedules WHERE download_id = ?", id)
+	return err
+}
+
+// SetOwner records which API user added a download
+func SetOwner(id, owner string) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec("INSERT OR REPLACE INTO owners (download_id, owner) VALUES (?, ?)", id, owner)
+	return err
+}
+
+// GetOwner returns the API user that added a download, or "" if none did
+func GetOwner(id string) (string, error) {
+	db := getDBHelper()
+	if db == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	var owner string
+	err := db.QueryRow("SELECT owner FROM owners WHERE download_id = ?", id).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query owner: %w", err)
+	}
+	return owner, nil
+}
+
+// LoadOwners returns the owner of every download that has one, by ID
+func LoadOwners() (map[string]string, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := db.Query("SELECT download_id, owner FROM owners")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query owners: %w", err)
+	}
+	defer rows.Close()
+
+	owners := make(map[string]string)
+	for rows.Next() {
+		var id, owner string
+		if err := rows.Scan(&id, &owner); err != nil {
+			return nil, err
+		}
+		owners[id] = owner
+	}
+	return owners, rows.Err()
+}
+
+// SetSchedule records when a saved download may start, as written by
+// types.Schedule.String
+func SetSchedule(id, schedule string) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec("INSERT OR REPLACE INTO schedules (download_id, schedule) VALUES (?, ?)", id, schedule)
 	return err
 }
 
+// GetSchedule returns the schedule recorded for a download, or "" if none was
+func GetSchedule(id string) (string, error) {
+	db := getDBHelper()
+	if db == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	var schedule string
+	err := db.QueryRow("SELECT schedule FROM schedules WHERE download_id = ?", id).Scan(&schedule)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query schedule: %w", err)
+	}
+	return schedule, nil
+}
+
 // GetDownload returns a single download by ID
 func GetDownload(id string) (*types.DownloadEntry, error) {
 
@@ -304,17 +482,17 @@ func GetDownload(id string) (*types.DownloadEntry, error) {
 
 	var e types.DownloadEntry
 	var completedAt, timeTaken sql.NullInt64
-	var urlHash, filename, mirrors sql.NullString
+	var urlHash, filename, mirrors, headers, checksum sql.NullString
 
 	row := db.QueryRow(`
-		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors 
+		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, headers, checksum
 		FROM downloads
 		WHERE id = ?
 	`, id)
 
 	if err := row.Scan(
 		&e.ID, &e.URL, &e.DestPath, &filename, &e.Status, &e.TotalSize, &e.Downloaded,
-		&completedAt, &timeTaken, &urlHash, &mirrors,
+		&completedAt, &timeTaken, &urlHash, &mirrors, &headers, &checksum,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Not found
@@ -337,6 +515,8 @@ func GetDownload(id string) (*types.DownloadEntry, error) {
 	if mirrors.Valid && mirrors.String != "" {
 		e.Mirrors = strings.Split(mirrors.String, ",")
 	}
+	e.Headers = decodeHeaders(headers)
+	e.Checksum = checksum.String
 
 	return &e, nil
 }
@@ -411,6 +591,22 @@ func UpdateStatus(id string, status string) error {
 	return nil
 }
 
+// MoveDestPath records that the file of download id now lives at newPath,
+// carrying its recorded checksum along
+func MoveDestPath(id, oldPath, newPath string) error {
+	return withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec("UPDATE downloads SET dest_path = ? WHERE id = ?", newPath, id)
+		if err != nil {
+			return fmt.Errorf("failed to update path: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return fmt.Errorf("download not found: %s", id)
+		}
+		_, err = tx.Exec("UPDATE OR REPLACE checksums SET path = ? WHERE path = ?", newPath, oldPath)
+		return err
+	})
+}
+
 // PauseAllDownloads pauses all non-completed downloads
 func PauseAllDownloads() error {
 	db := getDBHelper()
@@ -449,6 +645,7 @@ func RemoveCompletedDownloads() (int64, error) {
 		return 0, fmt.Errorf("database not initialized")
 	}
 
+	_, _ = db.Exec("DELETE FROM owners WHERE download_id IN (SELECT id FROM downloads WHERE status = 'completed')")
 	result, err := db.Exec("DELETE FROM downloads WHERE status = 'completed'")
 	if err != nil {
 		return 0, fmt.Errorf("failed to remove completed downloads: %w", err)
@@ -457,3 +654,85 @@ func RemoveCompletedDownloads() (int64, error) {
 	count, _ := result.RowsAffected()
 	return count, nil
 }
+
+// ================== Checksum Functions ==================
+
+// SaveChecksum records or replaces the hash of the file at c.Path
+func SaveChecksum(c types.ChecksumEntry) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO checksums (path, size, mod_time, sha256, download_id, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, c.Path, c.Size, c.ModTime, c.SHA256, c.DownloadID, c.CheckedAt)
+	return err
+}
+
+// GetChecksum returns the recorded hash of the file at path, or nil if none
+func GetChecksum(path string) (*types.ChecksumEntry, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var c types.ChecksumEntry
+	var downloadID sql.NullString
+	var checkedAt sql.NullInt64
+	err := db.QueryRow(`
+		SELECT path, size, mod_time, sha256, download_id, checked_at FROM checksums WHERE path = ?
+	`, path).Scan(&c.Path, &c.Size, &c.ModTime, &c.SHA256, &downloadID, &checkedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checksum: %w", err)
+	}
+	c.DownloadID, c.CheckedAt = downloadID.String, checkedAt.Int64
+	return &c, nil
+}
+
+// LoadChecksums returns the recorded hashes of files inside dir, or of all
+// files if dir is empty, ordered by path
+func LoadChecksums(dir string) ([]types.ChecksumEntry, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := db.Query("SELECT path, size, mod_time, sha256, download_id, checked_at FROM checksums ORDER BY path")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checksums: %w", err)
+	}
+	defer rows.Close()
+
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	var list []types.ChecksumEntry
+	for rows.Next() {
+		var c types.ChecksumEntry
+		var downloadID sql.NullString
+		var checkedAt sql.NullInt64
+		if err := rows.Scan(&c.Path, &c.Size, &c.ModTime, &c.SHA256, &downloadID, &checkedAt); err != nil {
+			return nil, err
+		}
+		if dir != "" && !strings.HasPrefix(c.Path, prefix) {
+			continue
+		}
+		c.DownloadID, c.CheckedAt = downloadID.String, checkedAt.Int64
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// RemoveChecksum forgets the hash of the file at path
+func RemoveChecksum(path string) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec("DELETE FROM checksums WHERE path = ?", path)
+	return err
+}
@@ -2,8 +2,10 @@ package state
 
 import (
 	"database/sql"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -92,7 +94,9 @@ func TestSaveLoadState(t *testing.T) {
 			{Offset: 500000, Length: 250000},
 			{Offset: 750000, Length: 250000},
 		},
-		Filename: "save-load-test.zip",
+		Filename:     "save-load-test.zip",
+		ETag:         `"abc123"`,
+		LastModified: "Wed, 21 Oct 2015 07:28:00 GMT",
 	}
 
 	// Save state
@@ -125,6 +129,9 @@ func TestSaveLoadState(t *testing.T) {
 	if loadedState.Filename != originalState.Filename {
 		t.Errorf("Filename = %s, want %s", loadedState.Filename, originalState.Filename)
 	}
+	if loadedState.ETag != originalState.ETag || loadedState.LastModified != originalState.LastModified {
+		t.Errorf("validators = %q, %q; want %q, %q", loadedState.ETag, loadedState.LastModified, originalState.ETag, originalState.LastModified)
+	}
 
 	// Verify hashes were set
 	if loadedState.URLHash == "" {
@@ -611,3 +618,158 @@ func TestMirrorsPersistence(t *testing.T) {
 		t.Error("Completed download not found in list")
 	}
 }
+
+func TestHeadersAndChecksumPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer os.RemoveAll(tmpDir)
+	defer CloseDB()
+
+	entry := types.DownloadEntry{
+		ID:       "headers-entry-id",
+		URL:      "https://example.com/private.iso",
+		DestPath: tmpDir,
+		Status:   "queued",
+		Headers:  http.Header{"Authorization": {"Bearer abc"}, "Cookie": {"session=1"}, "X-Tenant": {"a", "b"}},
+		Checksum: "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+	if err := AddToMasterList(entry); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+
+	// A later save without them, as when the download completes elsewhere,
+	// keeps what was recorded
+	if err := AddToMasterList(types.DownloadEntry{ID: entry.ID, URL: entry.URL, DestPath: tmpDir, Status: "completed"}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+
+	// Credentials are never saved
+	want := http.Header{"X-Tenant": {"a", "b"}}
+	got, err := GetDownload(entry.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetDownload = %v, %v", got, err)
+	}
+	if !reflect.DeepEqual(got.Headers, want) || got.Checksum != entry.Checksum {
+		t.Errorf("GetDownload headers %v checksum %q, want %v %q", got.Headers, got.Checksum, want, entry.Checksum)
+	}
+	all, err := ListAllDownloads()
+	if err != nil || len(all) != 1 {
+		t.Fatalf("ListAllDownloads = %v, %v", all, err)
+	}
+	if !reflect.DeepEqual(all[0].Headers, want) || all[0].Checksum != entry.Checksum {
+		t.Errorf("ListAllDownloads headers %v checksum %q", all[0].Headers, all[0].Checksum)
+	}
+}
+
+func TestOwners(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer os.RemoveAll(tmpDir)
+	defer CloseDB()
+
+	if owner, err := GetOwner("own-1"); err != nil || owner != "" {
+		t.Fatalf("GetOwner on unknown ID = %q, %v; want empty", owner, err)
+	}
+
+	// Owners can be recorded before the download has a row of its own
+	if err := SetOwner("own-1", "alice"); err != nil {
+		t.Fatalf("SetOwner failed: %v", err)
+	}
+	if err := SetOwner("own-2", "bob"); err != nil {
+		t.Fatalf("SetOwner failed: %v", err)
+	}
+	if err := AddToMasterList(types.DownloadEntry{ID: "own-1", URL: "https://e.com/1", DestPath: "/tmp/1", Status: "completed"}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+
+	if owner, _ := GetOwner("own-1"); owner != "alice" {
+		t.Errorf("GetOwner = %q, want alice", owner)
+	}
+	owners, err := LoadOwners()
+	if err != nil {
+		t.Fatalf("LoadOwners failed: %v", err)
+	}
+	if len(owners) != 2 || owners["own-2"] != "bob" {
+		t.Errorf("LoadOwners = %v", owners)
+	}
+
+	// Clearing completed downloads forgets their owners but not queued ones
+	if _, err := RemoveCompletedDownloads(); err != nil {
+		t.Fatalf("RemoveCompletedDownloads failed: %v", err)
+	}
+	if owner, _ := GetOwner("own-1"); owner != "" {
+		t.Errorf("owner of removed download still recorded: %q", owner)
+	}
+	if err := RemoveFromMasterList("own-2"); err != nil {
+		t.Fatalf("RemoveFromMasterList failed: %v", err)
+	}
+	if owners, _ := LoadOwners(); len(owners) != 0 {
+		t.Errorf("owners left after removal: %v", owners)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer os.RemoveAll(tmpDir)
+	defer CloseDB()
+
+	if c, err := GetChecksum("/data/a.iso"); err != nil || c != nil {
+		t.Fatalf("GetChecksum on unknown path = %v, %v; want nil", c, err)
+	}
+	for _, path := range []string{"/data/a.iso", "/data/sub/b.zip", "/database.db", "/other/c.bin"} {
+		if err := SaveChecksum(types.ChecksumEntry{Path: path, Size: 10, ModTime: 1, SHA256: "aa"}); err != nil {
+			t.Fatalf("SaveChecksum failed: %v", err)
+		}
+	}
+	// Saving the same path again replaces the record
+	if err := SaveChecksum(types.ChecksumEntry{Path: "/data/a.iso", Size: 20, ModTime: 2, SHA256: "bb", DownloadID: "dl-1"}); err != nil {
+		t.Fatalf("SaveChecksum failed: %v", err)
+	}
+	if c, _ := GetChecksum("/data/a.iso"); c == nil || c.SHA256 != "bb" || c.Size != 20 || c.DownloadID != "dl-1" {
+		t.Errorf("GetChecksum = %+v, want the replaced record", c)
+	}
+
+	// Only paths inside the directory, not ones sharing its name as a prefix
+	list, err := LoadChecksums("/data/")
+	if err != nil {
+		t.Fatalf("LoadChecksums failed: %v", err)
+	}
+	if len(list) != 2 || list[0].Path != "/data/a.iso" || list[1].Path != "/data/sub/b.zip" {
+		t.Errorf("LoadChecksums(/data/) = %+v", list)
+	}
+	if all, _ := LoadChecksums(""); len(all) != 4 {
+		t.Errorf("LoadChecksums(\"\") returned %d entries, want 4", len(all))
+	}
+
+	if err := RemoveChecksum("/data/a.iso"); err != nil {
+		t.Fatalf("RemoveChecksum failed: %v", err)
+	}
+	if c, _ := GetChecksum("/data/a.iso"); c != nil {
+		t.Errorf("checksum still recorded after removal: %+v", c)
+	}
+}
+
+func TestMigration_DropsSavedCredentials(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer os.RemoveAll(tmpDir)
+	defer CloseDB()
+
+	// A row as saved before credentials were kept out
+	db, err := GetDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO downloads (id, url, dest_path, status, total_size, downloaded, completed_at, time_taken, headers) VALUES
+		('old-1', 'https://e.com/1', '/tmp', 'completed', 0, 0, 0, 0, '{"Authorization":["Basic YTpi"],"X-Tenant":["a"]}'),
+		('old-2', 'https://e.com/2', '/tmp', 'completed', 0, 0, 0, 0, '{"Proxy-Authorization":["Basic YTpi"]}')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := GetDownload("old-1"); got == nil || !reflect.DeepEqual(got.Headers, http.Header{"X-Tenant": {"a"}}) {
+		t.Errorf("old-1 headers = %v, want only X-Tenant", got)
+	}
+	if got, _ := GetDownload("old-2"); got == nil || got.Headers != nil {
+		t.Errorf("old-2 headers = %v, want none", got)
+	}
+}
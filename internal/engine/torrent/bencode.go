@@ -0,0 +1,123 @@
+package torrent
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// decoder is a minimal bencode decoder (BEP 3).
+// Values decode to int64, string, []any and map[string]any.
+type decoder struct {
+	data []byte
+	pos  int
+
+	// infoStart/infoEnd record the raw byte span of the top-level "info"
+	// dictionary so the info hash can be computed over the original encoding.
+	infoStart int
+	infoEnd   int
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if d.pos >= len(d.data) {
+		return nil, fmt.Errorf("bencode: unexpected end of data")
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		return d.integer()
+	case c == 'l':
+		return d.list(depth)
+	case c == 'd':
+		return d.dict(depth)
+	case c >= '0' && c <= '9':
+		return d.str()
+	default:
+		return nil, fmt.Errorf("bencode: invalid token %q at offset %d", c, d.pos)
+	}
+}
+
+func (d *decoder) integer() (int64, error) {
+	d.pos++ // 'i'
+	end := d.indexFrom('e')
+	if end == -1 {
+		return 0, fmt.Errorf("bencode: unterminated integer at offset %d", d.pos)
+	}
+	n, err := strconv.ParseInt(string(d.data[d.pos:end]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bencode: invalid integer: %w", err)
+	}
+	d.pos = end + 1
+	return n, nil
+}
+
+func (d *decoder) str() (string, error) {
+	colon := d.indexFrom(':')
+	if colon == -1 {
+		return "", fmt.Errorf("bencode: invalid string length at offset %d", d.pos)
+	}
+	n, err := strconv.Atoi(string(d.data[d.pos:colon]))
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("bencode: invalid string length at offset %d", d.pos)
+	}
+	start := colon + 1
+	if start+n > len(d.data) {
+		return "", fmt.Errorf("bencode: string exceeds data at offset %d", d.pos)
+	}
+	d.pos = start + n
+	return string(d.data[start:d.pos]), nil
+}
+
+func (d *decoder) list(depth int) ([]any, error) {
+	d.pos++ // 'l'
+	var items []any
+	for {
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("bencode: unterminated list")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			return items, nil
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+}
+
+func (d *decoder) dict(depth int) (map[string]any, error) {
+	d.pos++ // 'd'
+	m := make(map[string]any)
+	for {
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("bencode: unterminated dictionary")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			return m, nil
+		}
+		k, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		start := d.pos
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if depth == 0 && k == "info" {
+			d.infoStart, d.infoEnd = start, d.pos
+		}
+		m[k] = v
+	}
+}
+
+func (d *decoder) indexFrom(b byte) int {
+	for i := d.pos; i < len(d.data); i++ {
+		if d.data[i] == b {
+			return i
+		}
+	}
+	return -1
+}
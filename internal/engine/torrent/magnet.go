@@ -0,0 +1,87 @@
+package torrent
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Magnet holds the parts of a magnet URI that Surge needs
+type Magnet struct {
+	InfoHash    string   // Hex-encoded, from xt=urn:btih:
+	Name        string   // dn: suggested file name
+	Length      int64    // xl: exact length, 0 if absent
+	WebSeeds    []string // ws: BEP 19 web seeds
+	Sources     []string // as: direct URLs of the file
+	TorrentURLs []string // xs: HTTP(S) URLs of the .torrent
+}
+
+// IsMagnet reports whether raw is a magnet URI
+func IsMagnet(raw string) bool {
+	return len(raw) > 7 && strings.EqualFold(raw[:7], "magnet:")
+}
+
+// ParseMagnet parses a BitTorrent magnet URI (BEP 9). Only the info hash is
+// required; without web seeds, sources or a .torrent URL the result is of no
+// use to Surge, which the caller reports.
+func ParseMagnet(raw string) (*Magnet, error) {
+	if !IsMagnet(raw) {
+		return nil, fmt.Errorf("torrent: not a magnet URI")
+	}
+	q, err := url.ParseQuery(strings.TrimPrefix(raw[7:], "?"))
+	if err != nil {
+		return nil, fmt.Errorf("torrent: invalid magnet URI: %w", err)
+	}
+
+	m := &Magnet{Name: q.Get("dn")}
+	for _, xt := range q["xt"] {
+		if hash, ok := strings.CutPrefix(strings.ToLower(xt), "urn:btih:"); ok {
+			if m.InfoHash, err = infoHashHex(hash); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if m.InfoHash == "" {
+		return nil, fmt.Errorf("torrent: magnet URI has no BitTorrent info hash")
+	}
+
+	if xl := q.Get("xl"); xl != "" {
+		if m.Length, err = strconv.ParseInt(xl, 10, 64); err != nil || m.Length < 0 {
+			return nil, fmt.Errorf("torrent: invalid magnet length %q", xl)
+		}
+	}
+	m.WebSeeds = q["ws"]
+	m.Sources = q["as"]
+	for _, xs := range q["xs"] {
+		if strings.HasPrefix(xs, "http://") || strings.HasPrefix(xs, "https://") {
+			m.TorrentURLs = append(m.TorrentURLs, xs)
+		}
+	}
+	return m, nil
+}
+
+// HTTPURLs returns the magnet's direct sources followed by its web seeds, as
+// file URLs for the concurrent engine. Web seeds naming a directory need the
+// file name (dn) and are skipped without one.
+func (m *Magnet) HTTPURLs() []string {
+	return seedURLs(append(append([]string(nil), m.Sources...), m.WebSeeds...), m.Name)
+}
+
+// infoHashHex normalizes a v1 info hash given as 40 hex or 32 base32 characters
+func infoHashHex(hash string) (string, error) {
+	switch len(hash) {
+	case 40:
+		if _, err := hex.DecodeString(hash); err == nil {
+			return hash, nil
+		}
+	case 32:
+		if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+			return hex.EncodeToString(b), nil
+		}
+	}
+	return "", fmt.Errorf("torrent: invalid info hash %q", hash)
+}
@@ -0,0 +1,58 @@
+package torrent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMagnet(t *testing.T) {
+	raw := "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&dn=file.iso&xl=1048576" +
+		"&ws=http%3A%2F%2Fa.example%2Fd%2F&ws=ftp%3A%2F%2Fb.example%2Ffile.iso" +
+		"&as=https%3A%2F%2Fc.example%2Ffile.iso&xs=http%3A%2F%2Ft.example%2Ffile.torrent&xs=urn%3Asha1%3Aabc"
+
+	m, err := ParseMagnet(raw)
+	if err != nil {
+		t.Fatalf("ParseMagnet failed: %v", err)
+	}
+	if m.InfoHash != "c12fe1c06bba254a9dc9f519b335aa7c1367a88a" {
+		t.Errorf("InfoHash = %s", m.InfoHash)
+	}
+	if m.Name != "file.iso" || m.Length != 1048576 {
+		t.Errorf("Name = %q, Length = %d", m.Name, m.Length)
+	}
+	want := []string{"https://c.example/file.iso", "http://a.example/d/file.iso"}
+	if got := m.HTTPURLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("HTTPURLs = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(m.TorrentURLs, []string{"http://t.example/file.torrent"}) {
+		t.Errorf("TorrentURLs = %v", m.TorrentURLs)
+	}
+}
+
+func TestParseMagnet_Base32Hash(t *testing.T) {
+	m, err := ParseMagnet("MAGNET:?xt=urn:btih:yex6dqdlxisuvhoj6um3gnnkpqjwpkek")
+	if err != nil {
+		t.Fatalf("ParseMagnet failed: %v", err)
+	}
+	if m.InfoHash != "c12fe1c06bba254a9dc9f519b335aa7c1367a88a" {
+		t.Errorf("InfoHash = %s", m.InfoHash)
+	}
+	// A directory seed is useless without a name
+	m.WebSeeds = []string{"http://a.example/d/"}
+	if urls := m.HTTPURLs(); len(urls) != 0 {
+		t.Errorf("HTTPURLs = %v, want none", urls)
+	}
+}
+
+func TestParseMagnet_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"http://example.com/file",
+		"magnet:?dn=file.iso",
+		"magnet:?xt=urn:btih:nothex",
+		"magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&xl=-5",
+	} {
+		if _, err := ParseMagnet(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Metainfo holds the parts of a .torrent file that Surge needs
+type Metainfo struct {
+	Name        string
+	Length      int64 // Total payload size (sum of files for multi-file torrents)
+	PieceLength int64
+	Pieces      []byte   // SHA-1 hash of each piece, PieceHashSize bytes apiece
+	Files       []File   // Empty for single-file torrents
+	WebSeeds    []string // BEP 19 "url-list" entries
+	InfoHash    string   // Hex-encoded SHA-1 of the bencoded info dictionary
+}
+
+// File is a single entry in a multi-file torrent
+type File struct {
+	Path   string
+	Length int64
+}
+
+// IsMultiFile reports whether the torrent describes a directory of files
+func (m *Metainfo) IsMultiFile() bool {
+	return len(m.Files) > 0
+}
+
+// LoadMetainfo reads and parses a .torrent file from disk
+func LoadMetainfo(path string) (*Metainfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read torrent: %w", err)
+	}
+	return ParseMetainfo(data)
+}
+
+// ParseMetainfo parses bencoded .torrent data
+func ParseMetainfo(data []byte) (*Metainfo, error) {
+	d := &decoder{data: data, infoStart: -1, infoEnd: -1}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("torrent: metainfo is not a dictionary")
+	}
+	info, ok := root["info"].(map[string]any)
+	if !ok || d.infoStart < 0 {
+		return nil, fmt.Errorf("torrent: missing info dictionary")
+	}
+
+	m := &Metainfo{}
+	m.Name, _ = info["name"].(string)
+	m.PieceLength, _ = info["piece length"].(int64)
+	if pieces, ok := info["pieces"].(string); ok {
+		m.Pieces = []byte(pieces)
+	}
+
+	sum := sha1.Sum(data[d.infoStart:d.infoEnd])
+	m.InfoHash = hex.EncodeToString(sum[:])
+
+	if length, ok := info["length"].(int64); ok {
+		m.Length = length
+	} else if files, ok := info["files"].([]any); ok {
+		for _, f := range files {
+			fd, ok := f.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("torrent: invalid file entry")
+			}
+			length, _ := fd["length"].(int64)
+			var parts []string
+			if segs, ok := fd["path"].([]any); ok {
+				for _, s := range segs {
+					if str, ok := s.(string); ok {
+						parts = append(parts, str)
+					}
+				}
+			}
+			m.Files = append(m.Files, File{Path: strings.Join(parts, "/"), Length: length})
+			m.Length += length
+		}
+	} else {
+		return nil, fmt.Errorf("torrent: info has neither length nor files")
+	}
+
+	if m.Name == "" {
+		return nil, fmt.Errorf("torrent: missing name")
+	}
+
+	// url-list may be a single string or a list of strings
+	switch seeds := root["url-list"].(type) {
+	case string:
+		if seeds != "" {
+			m.WebSeeds = append(m.WebSeeds, seeds)
+		}
+	case []any:
+		for _, s := range seeds {
+			if str, ok := s.(string); ok && str != "" {
+				m.WebSeeds = append(m.WebSeeds, str)
+			}
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,118 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// bstr bencodes a string
+func bstr(s string) string {
+	return fmt.Sprintf("%d:%s", len(s), s)
+}
+
+// singleFileInfo describes a 1 MiB file in 4 pieces, with made-up hashes
+const singleFileInfo = "d6:lengthi1048576e4:name8:file.iso12:piece lengthi262144e6:pieces80:" +
+	"aaaaaaaaaaaaaaaaaaaabbbbbbbbbbbbbbbbbbbbccccccccccccccccccccdddddddddddddddddddd" + "e"
+
+func TestParseMetainfo_SingleFile(t *testing.T) {
+	data := []byte("d8:announce" + bstr("http://t/ann") + "4:info" + singleFileInfo +
+		"8:url-listl" + bstr("http://a.example/d/") + bstr("https://b.example/f.iso") + "ee")
+
+	m, err := ParseMetainfo(data)
+	if err != nil {
+		t.Fatalf("ParseMetainfo failed: %v", err)
+	}
+
+	if m.Name != "file.iso" {
+		t.Errorf("Name = %q, want file.iso", m.Name)
+	}
+	if m.Length != 1048576 {
+		t.Errorf("Length = %d, want 1048576", m.Length)
+	}
+	if m.PieceLength != 262144 {
+		t.Errorf("PieceLength = %d, want 262144", m.PieceLength)
+	}
+	if m.IsMultiFile() {
+		t.Error("expected single-file torrent")
+	}
+
+	sum := sha1.Sum([]byte(singleFileInfo))
+	if want := hex.EncodeToString(sum[:]); m.InfoHash != want {
+		t.Errorf("InfoHash = %s, want %s", m.InfoHash, want)
+	}
+
+	urls, err := WebSeedURLs(m)
+	if err != nil {
+		t.Fatalf("WebSeedURLs failed: %v", err)
+	}
+	want := []string{"http://a.example/d/file.iso", "https://b.example/f.iso"}
+	if len(urls) != len(want) {
+		t.Fatalf("got %d urls, want %d: %v", len(urls), len(want), urls)
+	}
+	for i := range want {
+		if urls[i] != want[i] {
+			t.Errorf("urls[%d] = %s, want %s", i, urls[i], want[i])
+		}
+	}
+}
+
+func TestParseMetainfo_StringURLList(t *testing.T) {
+	data := []byte("d4:info" + singleFileInfo + "8:url-list" + bstr("http://a.example/d/") + "e")
+
+	m, err := ParseMetainfo(data)
+	if err != nil {
+		t.Fatalf("ParseMetainfo failed: %v", err)
+	}
+	if len(m.WebSeeds) != 1 || m.WebSeeds[0] != "http://a.example/d/" {
+		t.Errorf("WebSeeds = %v", m.WebSeeds)
+	}
+}
+
+func TestParseMetainfo_MultiFile(t *testing.T) {
+	data := []byte("d4:infod5:filesld6:lengthi10e4:pathl1:a5:b.txteed6:lengthi5e4:pathl5:c.txteee" +
+		"4:name3:dir12:piece lengthi16384eee")
+
+	m, err := ParseMetainfo(data)
+	if err != nil {
+		t.Fatalf("ParseMetainfo failed: %v", err)
+	}
+	if !m.IsMultiFile() || len(m.Files) != 2 {
+		t.Fatalf("expected 2 files, got %v", m.Files)
+	}
+	if m.Files[0].Path != "a/b.txt" {
+		t.Errorf("Files[0].Path = %q, want a/b.txt", m.Files[0].Path)
+	}
+	if m.Length != 15 {
+		t.Errorf("Length = %d, want 15", m.Length)
+	}
+	if _, err := WebSeedURLs(m); err != ErrMultiFile {
+		t.Errorf("err = %v, want ErrMultiFile", err)
+	}
+}
+
+func TestWebSeedURLs_NoSeeds(t *testing.T) {
+	m := &Metainfo{Name: "x", WebSeeds: []string{"ftp://nope/", "::bad"}, Length: 1, PieceLength: 1, Pieces: make([]byte, PieceHashSize)}
+	if _, err := WebSeedURLs(m); err != ErrNoWebSeeds {
+		t.Errorf("err = %v, want ErrNoWebSeeds", err)
+	}
+}
+
+func TestParseMetainfo_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"empty":        "",
+		"not dict":     "li1ee",
+		"no info":      "d3:foo3:bare",
+		"unterminated": "d4:infod4:name1:a",
+		"bad int":      "d4:infod6:lengthixe4:name1:aee",
+		"no length":    "d4:infod4:name1:aee",
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseMetainfo([]byte(input)); err == nil {
+				t.Errorf("expected error for %q", input)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// PieceHashSize is the size of one piece's SHA-1 hash in a torrent's pieces
+const PieceHashSize = sha1.Size
+
+// ErrPieceMismatch is returned when a downloaded piece differs from the one
+// the torrent describes
+var ErrPieceMismatch = errors.New("torrent piece hash mismatch")
+
+// NumPieces returns how many pieces the payload is split into
+func (m *Metainfo) NumPieces() int {
+	if m.PieceLength <= 0 {
+		return 0
+	}
+	return int((m.Length + m.PieceLength - 1) / m.PieceLength)
+}
+
+// checkPieces fails unless the torrent has a hash for every piece of its
+// payload, so a download from it can be verified
+func (m *Metainfo) checkPieces() error {
+	if m.PieceLength <= 0 {
+		return fmt.Errorf("torrent: invalid piece length %d", m.PieceLength)
+	}
+	if n := m.NumPieces(); len(m.Pieces) != n*PieceHashSize {
+		return fmt.Errorf("torrent: %d bytes of piece hashes for %d pieces", len(m.Pieces), n)
+	}
+	return nil
+}
+
+// CheckVerifiable fails unless a download can be checked against the
+// torrent: it must describe a single file and hash every piece of it
+func (m *Metainfo) CheckVerifiable() error {
+	if m.IsMultiFile() {
+		return ErrMultiFile
+	}
+	return m.checkPieces()
+}
+
+// VerifyPieces checks the single-file payload at path against the SHA-1
+// hash of every piece, returning ErrPieceMismatch for the first that differs
+func (m *Metainfo) VerifyPieces(path string) error {
+	if err := m.CheckVerifiable(); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != m.Length {
+		return fmt.Errorf("%w: file is %d bytes, torrent has %d", ErrPieceMismatch, info.Size(), m.Length)
+	}
+
+	buf := make([]byte, m.PieceLength)
+	n := m.NumPieces()
+	for i := range n {
+		size := min(m.PieceLength, m.Length-int64(i)*m.PieceLength)
+		if _, err := io.ReadFull(f, buf[:size]); err != nil {
+			return err
+		}
+		sum := sha1.Sum(buf[:size])
+		if !bytes.Equal(sum[:], m.Pieces[i*PieceHashSize:(i+1)*PieceHashSize]) {
+			return fmt.Errorf("%w: piece %d of %d", ErrPieceMismatch, i+1, n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pieceTorrent returns a single-file torrent of data in pieces of pieceLength
+func pieceTorrent(data []byte, pieceLength int64) *Metainfo {
+	m := &Metainfo{Name: "file.bin", Length: int64(len(data)), PieceLength: pieceLength}
+	for off := int64(0); off < m.Length; off += pieceLength {
+		sum := sha1.Sum(data[off:min(off+pieceLength, m.Length)])
+		m.Pieces = append(m.Pieces, sum[:]...)
+	}
+	return m
+}
+
+func TestVerifyPieces(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := pieceTorrent(data, 4096)
+	if m.NumPieces() != 3 {
+		t.Fatalf("NumPieces = %d, want 3", m.NumPieces())
+	}
+	if err := m.VerifyPieces(path); err != nil {
+		t.Fatalf("VerifyPieces of the right file: %v", err)
+	}
+
+	// A byte changed in the last, short piece
+	data[9000] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := m.VerifyPieces(path)
+	if !errors.Is(err, ErrPieceMismatch) {
+		t.Fatalf("VerifyPieces of a changed file: %v, want ErrPieceMismatch", err)
+	}
+	if want := "piece 3 of 3"; err.Error() != ErrPieceMismatch.Error()+": "+want {
+		t.Errorf("error %q does not name %s", err, want)
+	}
+
+	if err := os.WriteFile(path, data[:5000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifyPieces(path); !errors.Is(err, ErrPieceMismatch) {
+		t.Errorf("VerifyPieces of a short file: %v, want ErrPieceMismatch", err)
+	}
+
+	m.Pieces = m.Pieces[:2*PieceHashSize]
+	if err := m.VerifyPieces(path); err == nil || errors.Is(err, ErrPieceMismatch) {
+		t.Errorf("VerifyPieces with missing hashes: %v, want an invalid torrent error", err)
+	}
+}
+
+func TestWebSeedURLs_NeedsPieceHashes(t *testing.T) {
+	m := &Metainfo{Name: "x", Length: 100, PieceLength: 64, WebSeeds: []string{"http://a.example/x"}}
+	if _, err := WebSeedURLs(m); err == nil {
+		t.Error("expected error for a torrent without piece hashes")
+	}
+	m.Pieces = make([]byte, 2*PieceHashSize)
+	if _, err := WebSeedURLs(m); err != nil {
+		t.Errorf("WebSeedURLs failed: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package torrent
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNoWebSeeds is returned when a torrent carries no usable HTTP web seeds
+var ErrNoWebSeeds = fmt.Errorf("torrent has no HTTP web seeds, and peer-to-peer transfers are not supported")
+
+// ErrMultiFile is returned for torrents of several files, which Surge cannot
+// download from web seeds
+var ErrMultiFile = fmt.Errorf("multi-file torrents are not supported: only single-file torrents are downloaded, from their HTTP web seeds")
+
+// WebSeedURLs resolves the BEP 19 web seeds of a single-file torrent into
+// direct file URLs. Per BEP 19, a seed ending in "/" names a directory and the
+// torrent name is appended; otherwise the seed is the file itself.
+//
+// The returned URLs can be handed to the concurrent engine as mirrors so the
+// payload is fetched with ranged HTTP requests across every seed, and checked
+// with VerifyPieces once complete. Surge does not talk to peers, so multi-file
+// torrents (which would need per-file range mapping) and torrents whose piece
+// hashes don't cover the payload are rejected.
+func WebSeedURLs(m *Metainfo) ([]string, error) {
+	if err := m.CheckVerifiable(); err != nil {
+		return nil, err
+	}
+
+	urls := seedURLs(m.WebSeeds, m.Name)
+	if len(urls) == 0 {
+		return nil, ErrNoWebSeeds
+	}
+	return urls, nil
+}
+
+// seedURLs turns BEP 19 web seeds into file URLs, dropping duplicates and
+// anything but HTTP(S). Seeds ending in "/" name a directory holding name.
+func seedURLs(seeds []string, name string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, seed := range seeds {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		if strings.HasSuffix(u.Path, "/") {
+			if name == "" {
+				continue
+			}
+			u = u.JoinPath(name)
+		}
+		s := u.String()
+		if !seen[s] {
+			seen[s] = true
+			urls = append(urls, s)
+		}
+	}
+	return urls
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"net/http"
+	"os"
 	"time"
 )
 
@@ -25,7 +27,82 @@ const (
 	AlignSize    = 4 * KB  // Align chunks to 4KB for filesystem
 	WorkerBuffer = 512 * KB
 
+	// MaxBufferMemory caps the worker buffers held across all downloads
+	MaxBufferMemory = 128 * MB
+
 	TasksPerWorker = 4 // Target tasks per connection
+
+	// MaxChunks caps how many ranges one download is split into, so the task
+	// list and chunk bitmap of a huge file stay small; its chunks grow instead
+	MaxChunks = 1 << 20
+
+	// A range that exhausts its retries is re-split into up to RetrySplitParts
+	// pieces of at least RetrySplitMinChunk so other connections can share it
+	RetrySplitParts    = 4
+	RetrySplitMinChunk = 256 * KB
+
+	// ResumeSpotCheckSize is how much already-saved data is re-fetched and
+	// compared with the server before a resume continues
+	ResumeSpotCheckSize = 64 * KB
+
+	// A worker of a rate-limited download reads at most 1/RateLimitSlices of
+	// a second's worth at a time, and never less than RateLimitMinRead, so
+	// its waits stay short and its speed smooth
+	RateLimitSlices  = 20
+	RateLimitMinRead = 4 * KB
+)
+
+// ChunkCount returns how many chunks of chunkSize cover size bytes, without
+// the overflow (size+chunkSize-1)/chunkSize hits near the int64 limit
+func ChunkCount(size, chunkSize int64) int64 {
+	if size <= 0 || chunkSize <= 0 {
+		return 0
+	}
+	n := size / chunkSize
+	if size%chunkSize != 0 {
+		n++
+	}
+	return n
+}
+
+// Write strategies for the working file of a segmented download
+const (
+	WriteAuto   = "auto"   // WriteParts where the destination is slow at scattered writes and has room, else WriteSingle
+	WriteSingle = "single" // One preallocated file written in place
+	WriteParts  = "parts"  // A folder of part files, streamed into one at the end
+	WriteMmap   = "mmap"   // One preallocated file written through a memory mapping
+
+	// Filename truncation strategies for names over MaxFilenameLength
+	TruncateHash = "hash" // Cut the name and add a hash of the full one before the extension
+	TruncateEnd  = "end"  // Cut the name, keeping the extension
+
+	// MaxFilenameLength is the default longest name, in bytes, a download is
+	// saved under. It leaves room in the 255 bytes filesystems allow for the
+	// ".<short id>.surge" of the working file. Limits below MinFilenameLength
+	// are raised to it.
+	MaxFilenameLength = 230
+	MinFilenameLength = 32
+
+	// MaxPartFiles caps how many part files a download is split into; parts
+	// are never smaller than MaxChunk
+	MaxPartFiles = 64
+
+	// WriteBenchSize is how much the destination benchmark writes each way to
+	// compare scattered writes into one file with sequential ones, and
+	// WriteBenchRatio how much slower scattered must be for auto to pick parts
+	WriteBenchSize  = 4 * MB
+	WriteBenchRatio = 2.0
+
+	// SlowDiskSpeed is the sequential write speed, in bytes/sec, below which
+	// a destination is slow: its downloads get one chunk per connection, so
+	// each writes one long run instead of several scattered ones
+	SlowDiskSpeed = 50 * MB
+
+	// A download running at DiskBoundShare of its destination's write speed
+	// for DiskBoundChecks health checks in a row is warned that the disk,
+	// not the network, is its limit
+	DiskBoundShare  = 0.8
+	DiskBoundChecks = 5
 )
 
 // Connection limits
@@ -33,6 +110,17 @@ const (
 	PerHostMax = 64 // Max concurrent connections per host
 )
 
+// Scheduling policies for sharing the global connection budget between
+// running downloads
+const (
+	SchedulingFair           = "fair"            // Split the budget evenly
+	SchedulingSequential     = "sequential"      // Earlier downloads keep what they need, later ones get the rest
+	SchedulingPriorityStrict = "priority-strict" // Higher priority first, then earlier downloads
+)
+
+// SchedulingPolicies lists the valid scheduling policies
+var SchedulingPolicies = []string{SchedulingFair, SchedulingSequential, SchedulingPriorityStrict}
+
 // HTTP Client Tuning
 const (
 	DefaultMaxIdleConns          = 100
@@ -43,6 +131,15 @@ const (
 	DialTimeout                  = 10 * time.Second
 	KeepAliveDuration            = 30 * time.Second
 	ProbeTimeout                 = 30 * time.Second
+
+	// ProbeCacheTTL is how long a successful probe is reused for the same
+	// URL, so a retry or re-add right away skips the request and redirects
+	ProbeCacheTTL = 30 * time.Second
+
+	// KeepAliveDrainLimit is the most a worker will read and discard from a
+	// response it stopped early, so the connection can be reused for the next
+	// range request. Larger tails are cheaper to drop than to read.
+	KeepAliveDrainLimit = 256 * KB
 )
 
 // Channel buffer sizes
@@ -63,22 +160,108 @@ type DownloadConfig struct {
 	State      *ProgressState
 	Runtime    *RuntimeConfig // Dynamic settings from user config
 	Mirrors    []string       // List of mirror URLs (including primary)
+
+	WriteManifest bool // Write a hash manifest next to the file on completion
+
+	ExpectedSize  int64          // Size the file must have (e.g. from a metalink); 0 if unknown
+	ExpectHeaders http.Header    // Response headers the server must send, checked before anything is written
+	Checksum      string         // "type:hex" hash the completed file must match, e.g. "sha256:9f86d0..."
+	Signature     string         // URL or path of a detached OpenPGP signature the completed file must match
+	Keyring       string         // Path of the OpenPGP public keys Signature must be made with
+	RateLimit     int64          // Bytes/sec this download may receive; 0 leaves it to the global limit
+	Torrent       string         // URL or path of the .torrent whose piece hashes the completed file must match
+	Proxy         string         // Proxy for this download alone, overriding Runtime.Proxy and the pool's
+	Headers       http.Header    // Extra request headers for this download, e.g. credentials
+	Cookies       []*http.Cookie // Browser cookies for this download, see RuntimeConfig.CookieJar
+	Schedule      Schedule       // When the download may run; the zero Schedule starts it at once
+	Priority      Priority       // Where the download waits in the queue
+
+	FileMode       os.FileMode     // Permissions for the completed file; 0 keeps the default
+	MarkExecutable bool            // Add execute bits to completed programs and scripts
+	FixExtension   bool            // Rename a completed file its content shows is misnamed, see utils.CorrectExtension
+	Ownership      []OwnershipRule // Who completed files are chowned to; applied only as root
+	Hooks          HookPrograms    // External programs run when the download completes or fails
+	SortFolder     SortFolderFunc  // Category folder for a fresh download, see SortFolderFunc
+	PostProcessors []string        // Plugins handed the completed file, in order
+	Actions        PostActions     // Run by the pool once the download is over, on top of the pool's own
+}
+
+// PostActions are what the worker pool does once a download has completed
+// or failed
+type PostActions struct {
+	OnComplete string // Shell command run after a completed download, see hooks.Command
+	Notify     bool   // Show a desktop notification
+	Shutdown   bool   // Power the machine off once the pool has nothing left to download
+}
+
+// Merge returns a with o on top: o's command replaces a's, and notifying
+// or shutting down is asked for if either asks
+func (a PostActions) Merge(o PostActions) PostActions {
+	if o.OnComplete != "" {
+		a.OnComplete = o.OnComplete
+	}
+	a.Notify = a.Notify || o.Notify
+	a.Shutdown = a.Shutdown || o.Shutdown
+	return a
+}
+
+// HookPrograms are the executables run on download events; empty ones are skipped
+type HookPrograms struct {
+	OnEnqueue  string
+	OnComplete string
+	OnError    string
+}
+
+// SortFolderFunc returns the folder a file of filename and contentType (the
+// Content-Type header, if known) is saved in, relative to the output
+// directory or absolute, or "" to save it in the output directory itself
+type SortFolderFunc func(filename, contentType string) string
+
+// OwnershipRule gives files completed under Path (or anywhere, if Path is
+// empty) to UID and GID. A negative ID leaves that part unchanged.
+type OwnershipRule struct {
+	Path string
+	UID  int
+	GID  int
 }
 
 // RuntimeConfig holds dynamic settings that can override defaults
 type RuntimeConfig struct {
 	MaxConnectionsPerHost int
+	AdaptiveConnections   bool // Tune the connection count up to MaxConnectionsPerHost while downloading
 	MaxGlobalConnections  int
 	UserAgent             string
 	MinChunkSize          int64
 	MaxChunkSize          int64
 	TargetChunkSize       int64
 	WorkerBufferSize      int
+	MaxBufferMemory       int64
 	MaxTaskRetries        int
 	SlowWorkerThreshold   float64
 	SlowWorkerGracePeriod time.Duration
 	StallTimeout          time.Duration
 	SpeedEmaAlpha         float64
+	RetryBaseDelay        time.Duration // Wait before the first retry, doubled for each further one
+	RetryMaxDelay         time.Duration // Upper bound on the wait between retries
+	RetryJitter           float64       // Fraction by which a wait is randomly shortened or lengthened, 0 for none
+	CheckpointInterval    time.Duration // How often a running download saves resume state
+	PartFilesInSubdir     bool          // Keep working files in a hidden PartDirName folder
+	WriteStrategy         string        // How the working file is laid out, see WriteSingle
+	SparseFiles           bool          // Create working files sparse instead of reserving their size
+	MaxFilenameLength     int           // Longest name in bytes a download is saved under
+	FilenameTruncation    string        // How longer names are cut, see TruncateHash
+
+	BlockPrivateNetworks bool     // Refuse connections to internal addresses, see CheckAddr
+	AllowedNetworks      []string // CIDRs or addresses exempt from BlockPrivateNetworks
+	MaxRedirects         int
+	Proxy                string         // Proxy URL for HTTP(S) downloads, ProxyNone, or empty for the environment's; see ProxyFunc
+	Headers              http.Header    // Sent with every HTTP(S) request of the download, e.g. Authorization; see AddHeaders
+	Cookies              []*http.Cookie // Sent to the hosts each one's Domain covers; see CookieJar
+	Authorizer           Authorizer     // Signs requests in just before they are sent, see AddHeaders
+
+	SSHIdentityFile string // Key for sftp:// downloads, in addition to ssh's own
+	SSHKnownHosts   string // known_hosts file for sftp:// downloads, empty for ssh's default
+	SSHUserKeys     bool   // Log in to sftp:// servers with ssh-agent and ~/.ssh keys; only for the local user's own downloads
 }
 
 // GetUserAgent returns the configured user agent or the default
@@ -121,6 +304,14 @@ func (r *RuntimeConfig) GetTargetChunkSize() int64 {
 	return r.TargetChunkSize
 }
 
+// GetMaxBufferMemory returns configured value or default
+func (r *RuntimeConfig) GetMaxBufferMemory() int64 {
+	if r == nil || r.MaxBufferMemory <= 0 {
+		return MaxBufferMemory
+	}
+	return r.MaxBufferMemory
+}
+
 // GetWorkerBufferSize returns configured value or default
 func (r *RuntimeConfig) GetWorkerBufferSize() int {
 	if r == nil || r.WorkerBufferSize <= 0 {
@@ -131,7 +322,13 @@ func (r *RuntimeConfig) GetWorkerBufferSize() int {
 
 const (
 	MaxTaskRetries = 3
-	RetryBaseDelay = 200 * time.Millisecond
+	RetryBaseDelay = 400 * time.Millisecond
+	RetryMaxDelay  = 30 * time.Second
+	RetryJitter    = 0.2
+
+	// MirrorMaxFailures is how many times in a row a mirror may fail or be
+	// cut off for being slow before workers stop using it
+	MirrorMaxFailures = 3
 
 	// Health check constants
 	HealthCheckInterval = 1 * time.Second // How often to check worker health
@@ -140,8 +337,51 @@ const (
 	StallTimeout        = 5 * time.Second // Restart if no data for x seconds
 	SpeedEMAAlpha       = 0.3             // EMA smoothing factor
 	MinAbsoluteSpeed    = 100 * KB        // Don't cancel workers above this speed
+
+	// CheckpointInterval is how often a running download saves resume state,
+	// bounding the progress lost to a crash
+	CheckpointInterval = 10 * time.Second
+
+	// Adaptive connection tuning: a download starts with AdaptiveStartConnections
+	// and every AdaptiveInterval grows by half again, keeping the new connections
+	// only if throughput rose by AdaptiveMinGain. After a 429 or 503, or a grow
+	// that didn't pay, it holds for AdaptiveHoldIntervals before probing again.
+	AdaptiveStartConnections = 2
+	AdaptiveInterval         = 3 * time.Second
+	AdaptiveMinGain          = 0.10
+	AdaptiveHoldIntervals    = 5
+
+	// ConnLimitInterval is how often a running download checks the share of
+	// the global connection budget the pool gives it
+	ConnLimitInterval = 500 * time.Millisecond
 )
 
+// GetWriteStrategy returns the configured strategy, WriteAuto if unset or unknown
+func (r *RuntimeConfig) GetWriteStrategy() string {
+	if r != nil && (r.WriteStrategy == WriteSingle || r.WriteStrategy == WriteParts || r.WriteStrategy == WriteMmap) {
+		return r.WriteStrategy
+	}
+	return WriteAuto
+}
+
+// GetMaxFilenameLength returns the configured limit, MaxFilenameLength if
+// unset, and no less than MinFilenameLength
+func (r *RuntimeConfig) GetMaxFilenameLength() int {
+	if r == nil || r.MaxFilenameLength <= 0 {
+		return MaxFilenameLength
+	}
+	return max(r.MaxFilenameLength, MinFilenameLength)
+}
+
+// GetFilenameTruncation returns the configured strategy, TruncateHash if unset
+// or unknown
+func (r *RuntimeConfig) GetFilenameTruncation() string {
+	if r != nil && r.FilenameTruncation == TruncateEnd {
+		return TruncateEnd
+	}
+	return TruncateHash
+}
+
 // GetMaxTaskRetries returns configured value or default
 func (r *RuntimeConfig) GetMaxTaskRetries() int {
 	if r == nil || r.MaxTaskRetries <= 0 {
@@ -150,6 +390,31 @@ func (r *RuntimeConfig) GetMaxTaskRetries() int {
 	return r.MaxTaskRetries
 }
 
+// GetRetryBaseDelay returns configured value or default
+func (r *RuntimeConfig) GetRetryBaseDelay() time.Duration {
+	if r == nil || r.RetryBaseDelay <= 0 {
+		return RetryBaseDelay
+	}
+	return r.RetryBaseDelay
+}
+
+// GetRetryMaxDelay returns configured value or default
+func (r *RuntimeConfig) GetRetryMaxDelay() time.Duration {
+	if r == nil || r.RetryMaxDelay <= 0 {
+		return RetryMaxDelay
+	}
+	return r.RetryMaxDelay
+}
+
+// GetRetryJitter returns the configured jitter clamped to 0.0-1.0. Unlike
+// the other settings, 0 is kept: it turns jitter off.
+func (r *RuntimeConfig) GetRetryJitter() float64 {
+	if r == nil {
+		return RetryJitter
+	}
+	return min(max(r.RetryJitter, 0), 1)
+}
+
 // GetSlowWorkerThreshold returns configured value or default
 func (r *RuntimeConfig) GetSlowWorkerThreshold() float64 {
 	if r == nil || r.SlowWorkerThreshold <= 0 {
@@ -166,6 +431,14 @@ func (r *RuntimeConfig) GetSlowWorkerGracePeriod() time.Duration {
 	return r.SlowWorkerGracePeriod
 }
 
+// GetCheckpointInterval returns configured value or default
+func (r *RuntimeConfig) GetCheckpointInterval() time.Duration {
+	if r == nil || r.CheckpointInterval <= 0 {
+		return CheckpointInterval
+	}
+	return r.CheckpointInterval
+}
+
 // GetStallTimeout returns configured value or default
 func (r *RuntimeConfig) GetStallTimeout() time.Duration {
 	if r == nil || r.StallTimeout <= 0 {
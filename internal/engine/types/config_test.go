@@ -1,6 +1,7 @@
 package types
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -42,6 +43,15 @@ func TestRuntimeConfig_Getters(t *testing.T) {
 		if got := r.GetSpeedEmaAlpha(); got != SpeedEMAAlpha {
 			t.Errorf("GetSpeedEmaAlpha = %f, want %f", got, SpeedEMAAlpha)
 		}
+		if got := r.GetCheckpointInterval(); got != CheckpointInterval {
+			t.Errorf("GetCheckpointInterval = %v, want %v", got, CheckpointInterval)
+		}
+		if got := r.GetMaxFilenameLength(); got != MaxFilenameLength {
+			t.Errorf("GetMaxFilenameLength = %d, want %d", got, MaxFilenameLength)
+		}
+		if got := r.GetFilenameTruncation(); got != TruncateHash {
+			t.Errorf("GetFilenameTruncation = %q, want %q", got, TruncateHash)
+		}
 	})
 
 	t.Run("zero values return defaults", func(t *testing.T) {
@@ -74,6 +84,9 @@ func TestRuntimeConfig_Getters(t *testing.T) {
 			SlowWorkerGracePeriod: 10 * time.Second,
 			StallTimeout:          15 * time.Second,
 			SpeedEmaAlpha:         0.5,
+			CheckpointInterval:    time.Minute,
+			MaxFilenameLength:     10,
+			FilenameTruncation:    TruncateEnd,
 		}
 
 		if got := r.GetMaxConnectionsPerHost(); got != 128 {
@@ -109,6 +122,15 @@ func TestRuntimeConfig_Getters(t *testing.T) {
 		if got := r.GetSpeedEmaAlpha(); got != 0.5 {
 			t.Errorf("GetSpeedEmaAlpha = %f, want 0.5", got)
 		}
+		if got := r.GetCheckpointInterval(); got != time.Minute {
+			t.Errorf("GetCheckpointInterval = %v, want %v", got, time.Minute)
+		}
+		if got := r.GetMaxFilenameLength(); got != MinFilenameLength {
+			t.Errorf("GetMaxFilenameLength = %d, want the minimum %d", got, MinFilenameLength)
+		}
+		if got := r.GetFilenameTruncation(); got != TruncateEnd {
+			t.Errorf("GetFilenameTruncation = %q, want %q", got, TruncateEnd)
+		}
 	})
 }
 
@@ -220,3 +242,23 @@ func TestDownloadConfig_Fields(t *testing.T) {
 		t.Error("Runtime not set correctly")
 	}
 }
+
+func TestChunkCount(t *testing.T) {
+	tests := []struct {
+		size, chunk, want int64
+	}{
+		{0, 1024, 0},
+		{1000, 0, 0},
+		{4096, 1024, 4},
+		{4097, 1024, 5},
+		{4 << 30, 16 * MB, 256},
+		{4<<30 + 1, 16 * MB, 257},
+		{math.MaxInt64, 1 << 62, 2},
+		{math.MaxInt64, math.MaxInt64, 1},
+	}
+	for _, tt := range tests {
+		if got := ChunkCount(tt.size, tt.chunk); got != tt.want {
+			t.Errorf("ChunkCount(%d, %d) = %d, want %d", tt.size, tt.chunk, got, tt.want)
+		}
+	}
+}
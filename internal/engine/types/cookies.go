@@ -0,0 +1,48 @@
+package types
+
+import (
+	"cmp"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+// WithCookies returns a copy of r that sends cookies in place of any it had,
+// or r itself if there are none
+func (r *RuntimeConfig) WithCookies(cookies []*http.Cookie) *RuntimeConfig {
+	if len(cookies) == 0 {
+		return r
+	}
+	var rt RuntimeConfig
+	if r != nil {
+		rt = *r
+	}
+	rt.Cookies = cookies
+	return &rt
+}
+
+// CookieJar returns an in-memory jar for a download's client, holding
+// r.Cookies. The client adds the cookies servers set, so one set on the way
+// through a redirect goes with the requests that follow. The jar only sends
+// each cookie to the hosts its Domain covers, so mirrors and redirects
+// elsewhere never see it. r may be nil.
+func (r *RuntimeConfig) CookieJar() http.CookieJar {
+	jar, _ := cookiejar.New(nil) // Never fails without options
+	if r == nil {
+		return jar
+	}
+	for _, c := range r.Cookies {
+		cookie := *c
+		host := strings.TrimPrefix(c.Domain, ".")
+		if !strings.HasPrefix(c.Domain, ".") {
+			cookie.Domain = "" // Host-only, as the browser kept it
+		}
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: cmp.Or(c.Path, "/")}, []*http.Cookie{&cookie})
+	}
+	return jar
+}
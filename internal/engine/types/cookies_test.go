@@ -0,0 +1,50 @@
+package types
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRuntimeConfig_CookieJar(t *testing.T) {
+	var none *RuntimeConfig
+	if jar := none.CookieJar(); jar == nil || len(jar.Cookies(&url.URL{Scheme: "https", Host: "example.com"})) != 0 {
+		t.Error("CookieJar without cookies is not an empty jar")
+	}
+
+	r := (&RuntimeConfig{UserAgent: "ua"}).WithCookies([]*http.Cookie{
+		{Name: "domain", Value: "1", Domain: ".example.com"},
+		{Name: "host", Value: "2", Domain: "example.com", Path: "/dl"},
+		{Name: "secure", Value: "3", Domain: ".example.com", Secure: true},
+	})
+	if r.UserAgent != "ua" {
+		t.Error("WithCookies lost the other settings")
+	}
+	jar := r.CookieJar()
+
+	for _, tt := range []struct {
+		url  string
+		want []string
+	}{
+		{"https://example.com/dl/f.iso", []string{"domain", "host", "secure"}},
+		{"http://example.com/dl/f.iso", []string{"domain", "host"}},
+		{"https://cdn.example.com/f.iso", []string{"domain", "secure"}},
+		{"https://example.com/other", []string{"domain", "secure"}},
+		{"https://mirror.org/f.iso", nil},
+	} {
+		u, _ := url.Parse(tt.url)
+		got := make(map[string]bool)
+		for _, c := range jar.Cookies(u) {
+			got[c.Name] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s gets %v, want %v", tt.url, got, tt.want)
+			continue
+		}
+		for _, name := range tt.want {
+			if !got[name] {
+				t.Errorf("%s gets %v, want %v", tt.url, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package types
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+	"golang.org/x/crypto/blake2b"
+)
+
+var (
+	checksumMu sync.RWMutex
+
+	// checksumHashes are the hash types a download can be verified against,
+	// by the name a checksum is prefixed with
+	checksumHashes = map[string]func() hash.Hash{
+		"md5":     md5.New,
+		"sha1":    sha1.New,
+		"sha224":  sha256.New224,
+		"sha256":  sha256.New,
+		"sha384":  sha512.New384,
+		"sha512":  sha512.New,
+		"blake2b": newBLAKE2b,
+		"blake3":  func() hash.Hash { return blake3.New() },
+		"xxh3":    func() hash.Hash { return xxh3.New() },
+	}
+)
+
+// newBLAKE2b returns an unkeyed BLAKE2b-512 hash, the one b2sum prints
+func newBLAKE2b() hash.Hash {
+	h, _ := blake2b.New512(nil) // Only fails for a key over 64 bytes
+	return h
+}
+
+// RegisterChecksum makes checksums prefixed with typ, such as "typ:9f86d0...",
+// verifiable with hashes newHash returns. It replaces any hash typ had.
+func RegisterChecksum(typ string, newHash func() hash.Hash) {
+	checksumMu.Lock()
+	defer checksumMu.Unlock()
+	checksumHashes[strings.ToLower(typ)] = newHash
+}
+
+// ChecksumTypes returns the names of the hash types checksums can use, sorted
+func ChecksumTypes() []string {
+	checksumMu.RLock()
+	defer checksumMu.RUnlock()
+	names := make([]string, 0, len(checksumHashes))
+	for typ := range checksumHashes {
+		names = append(names, typ)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// checksumHash returns the constructor of the hash named typ
+func checksumHash(typ string) (func() hash.Hash, bool) {
+	checksumMu.RLock()
+	defer checksumMu.RUnlock()
+	newHash, ok := checksumHashes[strings.ToLower(typ)]
+	return newHash, ok
+}
+
+// digestPreference lists the hash types a server may send digests in,
+// strongest first
+var digestPreference = []string{"sha512", "sha384", "sha256", "sha1", "md5"}
+
+// ParseChecksum splits a "type:hex" checksum such as "sha256:9f86d0..." into
+// a new hash of its type and the hex sum the hash must come to
+func ParseChecksum(checksum string) (hash.Hash, string, error) {
+	typ, want, ok := strings.Cut(checksum, ":")
+	newHash, known := checksumHash(typ)
+	if !ok || !known {
+		return nil, "", fmt.Errorf("unsupported checksum %q", checksum)
+	}
+	return newHash(), want, nil
+}
+
+// ReprDigest returns the checksum of the whole file resp is (part of), as
+// "type:hex", from its Repr-Digest (RFC 9530) or Digest (RFC 3230) header,
+// or from the Content-Digest of a 200 response. It is "" when the server
+// sent none Surge can check.
+func ReprDigest(resp *http.Response) string {
+	if encoded(resp) {
+		return ""
+	}
+	for _, field := range []string{"Repr-Digest", "Digest"} {
+		if sum := digestChecksum(resp.Header.Values(field)); sum != "" {
+			return sum
+		}
+	}
+	if resp.StatusCode == http.StatusOK {
+		return ContentDigest(resp)
+	}
+	return ""
+}
+
+// ContentDigest returns the checksum of the body of resp, which for a 206
+// response is the range it holds, from its Content-Digest or Content-MD5
+// header, or "" when it has none
+func ContentDigest(resp *http.Response) string {
+	if encoded(resp) {
+		return ""
+	}
+	if sum := digestChecksum(resp.Header.Values("Content-Digest")); sum != "" {
+		return sum
+	}
+	if value := resp.Header.Get("Content-MD5"); value != "" {
+		return digestChecksum([]string{"md5=" + value})
+	}
+	return ""
+}
+
+// encoded reports whether resp was compressed on the way, so its digests
+// are of bytes other than the ones written to disk
+func encoded(resp *http.Response) bool {
+	return resp.Uncompressed || resp.Header.Get("Content-Encoding") != ""
+}
+
+// digestChecksum returns the strongest digest in the values of a digest
+// header field as a "type:hex" checksum. It reads both the RFC 9530 form
+// (sha-256=:<base64>:) and the RFC 3230 one (SHA-256=<base64>).
+func digestChecksum(values []string) string {
+	sums := make(map[string]string)
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			name, encodedSum, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok {
+				continue
+			}
+			typ := strings.ReplaceAll(strings.ToLower(name), "-", "")
+			if typ == "sha" {
+				typ = "sha1" // RFC 3230 name
+			}
+			newHash, known := checksumHash(typ)
+			if !known {
+				continue
+			}
+			// Structured field parameters, if any, follow a ";"
+			encodedSum, _, _ = strings.Cut(encodedSum, ";")
+			encodedSum = strings.Trim(strings.TrimSpace(encodedSum), ":")
+			sum, err := base64.StdEncoding.DecodeString(encodedSum)
+			if err != nil {
+				sum, err = base64.RawStdEncoding.DecodeString(encodedSum)
+			}
+			if err != nil || len(sum) != newHash().Size() {
+				continue
+			}
+			sums[typ] = hex.EncodeToString(sum)
+		}
+	}
+	for _, typ := range digestPreference {
+		if sum, ok := sums[typ]; ok {
+			return typ + ":" + sum
+		}
+	}
+	return ""
+}
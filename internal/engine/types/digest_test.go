@@ -0,0 +1,79 @@
+package types
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestDigestHeaders(t *testing.T) {
+	body := []byte("surge")
+	sha256Sum, sha512Sum, md5Sum := sha256.Sum256(body), sha512.Sum512(body), md5.Sum(body)
+	b64 := base64.StdEncoding.EncodeToString
+	want256 := "sha256:" + hex.EncodeToString(sha256Sum[:])
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		repr   string
+		body   string
+	}{
+		{"rfc 9530", 206, http.Header{"Repr-Digest": {"sha-256=:" + b64(sha256Sum[:]) + ":"}}, want256, ""},
+		{"strongest wins", 200, http.Header{"Repr-Digest": {"sha-256=:" + b64(sha256Sum[:]) + ":, sha-512=:" + b64(sha512Sum[:]) + ":"}}, "sha512:" + hex.EncodeToString(sha512Sum[:]), ""},
+		{"rfc 3230", 206, http.Header{"Digest": {"MD5=" + b64(md5Sum[:]) + ",SHA-256=" + b64(sha256Sum[:])}}, want256, ""},
+		{"content digest of a range", 206, http.Header{"Content-Digest": {"sha-256=:" + b64(sha256Sum[:]) + ":"}}, "", want256},
+		{"content digest of the file", 200, http.Header{"Content-Digest": {"sha-256=:" + b64(sha256Sum[:]) + ":"}}, want256, want256},
+		{"content-md5", 206, http.Header{"Content-Md5": {b64(md5Sum[:])}}, "", "md5:" + hex.EncodeToString(md5Sum[:])},
+		{"compressed", 200, http.Header{"Content-Encoding": {"gzip"}, "Content-Digest": {"sha-256=:" + b64(sha256Sum[:]) + ":"}}, "", ""},
+		{"unknown and malformed", 200, http.Header{"Repr-Digest": {"crc32c=:AAAA:, sha-256=:AAAA:, sha-256"}}, "", ""},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: tt.header}
+		if got := ReprDigest(resp); got != tt.repr {
+			t.Errorf("%s: ReprDigest = %q, want %q", tt.name, got, tt.repr)
+		}
+		if got := ContentDigest(resp); got != tt.body {
+			t.Errorf("%s: ContentDigest = %q, want %q", tt.name, got, tt.body)
+		}
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	// Digests of "abc" from b2sum, b3sum and xxhsum -H3
+	for checksum, input := range map[string]string{
+		"sha512:ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f":  "abc",
+		"blake2b:ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923": "abc",
+		"BLAKE3:6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85":                                                                  "abc",
+		"blake3:af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262":                                                                  "",
+		"xxh3:2d06800538d394c2": "",
+	} {
+		h, want, err := ParseChecksum(checksum)
+		if err != nil {
+			t.Errorf("ParseChecksum(%q): %v", checksum, err)
+			continue
+		}
+		h.Write([]byte(input))
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Errorf("%s of %q = %s, want %s", checksum[:len(checksum)-len(want)-1], input, got, want)
+		}
+	}
+
+	if _, _, err := ParseChecksum("crc32c:abcd"); err == nil {
+		t.Error("crc32c should not be supported until registered")
+	}
+	RegisterChecksum("CRC32C", func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) })
+	if _, _, err := ParseChecksum("crc32c:abcd"); err != nil {
+		t.Errorf("registered crc32c: %v", err)
+	}
+	if !slices.Contains(ChecksumTypes(), "crc32c") {
+		t.Errorf("ChecksumTypes() = %v, want crc32c among them", ChecksumTypes())
+	}
+}
@@ -1,8 +1,66 @@
 package types
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 // Common errors
 var (
-	ErrPaused = errors.New("download paused")
+	ErrPaused       = errors.New("download paused")
+	ErrRangeIgnored = errors.New("server indicated success (200) but ignored range request (expected 206)")
+	// ErrSourceChanged is returned when an If-Range request shows the file
+	// changed on the server since the download started
+	ErrSourceChanged = errors.New("file changed on the server")
+	// ErrDigestMismatch is returned when a range does not match the
+	// Content-Digest the server sent with it
+	ErrDigestMismatch = errors.New("data does not match the server's digest")
+	// ErrInsufficientSpace is returned before a download starts when its
+	// destination does not have room for it
+	ErrInsufficientSpace = errors.New("not enough free disk space")
 )
+
+// HTTPError is returned when a server answers with a status the engine cannot
+// use. It keeps a snapshot of the response so the failure can be diagnosed
+// after the connection is gone.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Status     string // e.g. "403 Forbidden"
+	Header     http.Header
+}
+
+// NewHTTPError captures the status line and headers of resp
+func NewHTTPError(url string, resp *http.Response) *HTTPError {
+	status := resp.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return &HTTPError{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Status:     status,
+		Header:     resp.Header.Clone(),
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return "unexpected status: " + e.Status
+}
+
+// RetryError is returned once an operation has exhausted its retries.
+// Attempts holds the error of every failed attempt, oldest first.
+type RetryError struct {
+	Op       string // what was retried, e.g. "probe" or "download"
+	Attempts []string
+	Err      error // last error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s failed after %d retries: %v", e.Op, len(e.Attempts), e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,104 @@
+package types
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ParseHeaders converts name/value pairs into request headers, refusing
+// names and values that cannot be sent. Range is refused too: the engine
+// decides which bytes each request asks for.
+func ParseHeaders(pairs map[string]string) (http.Header, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	h := make(http.Header, len(pairs))
+	for name, value := range pairs {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid value for header %s", name)
+		}
+		if http.CanonicalHeaderKey(name) == "Range" {
+			return nil, fmt.Errorf("header Range cannot be set")
+		}
+		h.Set(name, value)
+	}
+	return h, nil
+}
+
+// WithHeaders returns a copy of r that also sends headers, which replace any
+// it already had of the same name, or r itself if there are none
+func (r *RuntimeConfig) WithHeaders(headers http.Header) *RuntimeConfig {
+	if len(headers) == 0 {
+		return r
+	}
+	var rt RuntimeConfig
+	if r != nil {
+		rt = *r
+	}
+	rt.Headers = make(http.Header, len(rt.Headers)+len(headers))
+	if r != nil {
+		for name, values := range r.Headers {
+			rt.Headers[name] = values
+		}
+	}
+	for name, values := range headers {
+		rt.Headers[name] = values
+	}
+	return &rt
+}
+
+// Authorizer adds credentials that expire, such as OAuth access tokens, to
+// requests. Each request asks again, so a download outliving a token gets a
+// new one.
+type Authorizer interface {
+	Authorize(req *http.Request) error
+}
+
+// JoinAuthorizers returns an Authorizer asking each of authorizers in turn,
+// skipping nil ones, or nil if there are none
+func JoinAuthorizers(authorizers ...Authorizer) Authorizer {
+	var all authorizerList
+	for _, a := range authorizers {
+		if a != nil {
+			all = append(all, a)
+		}
+	}
+	switch len(all) {
+	case 0:
+		return nil
+	case 1:
+		return all[0]
+	}
+	return all
+}
+
+type authorizerList []Authorizer
+
+func (l authorizerList) Authorize(req *http.Request) error {
+	for _, a := range l {
+		if err := a.Authorize(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddHeaders sets r.Headers on req, replacing headers of the same name such
+// as User-Agent, then has r.Authorizer sign it in. Call it before setting
+// Range.
+func (r *RuntimeConfig) AddHeaders(req *http.Request) error {
+	if r == nil {
+		return nil
+	}
+	for name, values := range r.Headers {
+		req.Header[name] = values
+	}
+	if r.Authorizer != nil {
+		return r.Authorizer.Authorize(req)
+	}
+	return nil
+}
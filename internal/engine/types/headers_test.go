@@ -0,0 +1,111 @@
+package types
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseHeaders(t *testing.T) {
+	h, err := ParseHeaders(map[string]string{"authorization": "Bearer abc", "X-Api-Key": "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Get("Authorization") != "Bearer abc" || h.Get("X-Api-Key") != "k" {
+		t.Errorf("ParseHeaders = %v", h)
+	}
+
+	for _, bad := range []map[string]string{
+		{"": "x"},
+		{"Bad Name": "x"},
+		{"X-Split": "a\r\nInjected: yes"},
+		{"range": "bytes=0-"},
+	} {
+		if _, err := ParseHeaders(bad); err == nil {
+			t.Errorf("ParseHeaders(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRuntimeConfig_WithHeaders(t *testing.T) {
+	r := &RuntimeConfig{UserAgent: "ua", Headers: http.Header{"Cookie": {"a=1"}, "X-Old": {"old"}}}
+	if r.WithHeaders(nil) != r {
+		t.Error("WithHeaders(nil) should return the config itself")
+	}
+	got := r.WithHeaders(http.Header{"X-Old": {"new"}, "Authorization": {"Basic eDp5"}})
+	if got.UserAgent != "ua" || got.Headers.Get("Cookie") != "a=1" || got.Headers.Get("X-Old") != "new" || got.Headers.Get("Authorization") != "Basic eDp5" {
+		t.Errorf("WithHeaders = %+v", got)
+	}
+	if r.Headers.Get("X-Old") != "old" || r.Headers.Get("Authorization") != "" {
+		t.Errorf("WithHeaders changed the original: %v", r.Headers)
+	}
+}
+
+func TestRuntimeConfig_AddHeaders(t *testing.T) {
+	r := &RuntimeConfig{Headers: http.Header{"User-Agent": {"custom"}, "Authorization": {"Bearer t"}}}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req.Header.Set("User-Agent", r.GetUserAgent())
+	r.AddHeaders(req)
+	if req.Header.Get("User-Agent") != "custom" || req.Header.Get("Authorization") != "Bearer t" {
+		t.Errorf("headers = %v", req.Header)
+	}
+
+	var unset *RuntimeConfig
+	unset.AddHeaders(req) // Must not panic
+}
+
+type authorizerFunc func(*http.Request) error
+
+func (f authorizerFunc) Authorize(req *http.Request) error { return f(req) }
+
+func TestRuntimeConfig_AddHeaders_Authorizer(t *testing.T) {
+	r := &RuntimeConfig{
+		Headers: http.Header{"X-Api-Key": {"k"}},
+		Authorizer: authorizerFunc(func(req *http.Request) error {
+			if req.Header.Get("X-Api-Key") != "k" {
+				t.Error("Authorizer ran before the headers were set")
+			}
+			req.Header.Set("Authorization", "Bearer fresh")
+			return nil
+		}),
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/f", nil)
+	if err := r.AddHeaders(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Authorization") != "Bearer fresh" {
+		t.Errorf("Authorization = %q", req.Header.Get("Authorization"))
+	}
+
+	r.Authorizer = authorizerFunc(func(*http.Request) error { return errors.New("login expired") })
+	if err := r.AddHeaders(req); err == nil {
+		t.Error("AddHeaders hid the Authorizer's error")
+	}
+}
+
+func TestJoinAuthorizers(t *testing.T) {
+	if JoinAuthorizers(nil, nil) != nil {
+		t.Error("JoinAuthorizers of nothing should be nil")
+	}
+
+	var calls []string
+	named := func(name string) Authorizer {
+		return authorizerFunc(func(*http.Request) error {
+			calls = append(calls, name)
+			return nil
+		})
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/f", nil)
+	if err := JoinAuthorizers(named("hosts"), nil, named("oauth")).Authorize(req); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ",") != "hosts,oauth" {
+		t.Errorf("calls = %v, want hosts then oauth", calls)
+	}
+
+	failing := authorizerFunc(func(*http.Request) error { return errors.New("locked keyring") })
+	if err := JoinAuthorizers(failing, named("oauth")).Authorize(req); err == nil {
+		t.Error("JoinAuthorizers hid an error")
+	}
+}
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// hostConns counts the requests open to each host through every transport
+// LimitHosts wrapped, so downloads, probes and page fetches running at the
+// same time keep to one cap between them
+var hostConns = struct {
+	sync.Mutex
+	open  map[string]int
+	freed chan struct{} // Closed and replaced each time a request ends
+}{open: make(map[string]int), freed: make(chan struct{})}
+
+// acquireHost waits until fewer than limit requests are open to host and
+// counts one more. It gives up when ctx ends.
+func acquireHost(ctx context.Context, host string, limit int) error {
+	for {
+		hostConns.Lock()
+		if hostConns.open[host] < limit {
+			hostConns.open[host]++
+			hostConns.Unlock()
+			return nil
+		}
+		freed := hostConns.freed
+		hostConns.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// releaseHost ends a request acquireHost counted
+func releaseHost(host string) {
+	hostConns.Lock()
+	defer hostConns.Unlock()
+	if hostConns.open[host]--; hostConns.open[host] <= 0 {
+		delete(hostConns.open, host)
+	}
+	close(hostConns.freed)
+	hostConns.freed = make(chan struct{})
+}
+
+// hostLimiter is a RoundTripper holding its requests to a per-host cap
+type hostLimiter struct {
+	next  http.RoundTripper
+	limit int
+}
+
+// LimitHosts wraps next so that a request through it waits while
+// GetMaxConnectionsPerHost requests are already open to its host, counting
+// those made through every other transport LimitHosts wrapped. A request
+// holds its connection until its response body is closed.
+func (r *RuntimeConfig) LimitHosts(next http.RoundTripper) http.RoundTripper {
+	return &hostLimiter{next: next, limit: r.GetMaxConnectionsPerHost()}
+}
+
+func (l *hostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if err := acquireHost(req.Context(), host, l.limit); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := l.next.RoundTrip(req)
+	if err != nil {
+		releaseHost(host)
+		return nil, err
+	}
+	resp.Body = &hostBody{ReadCloser: resp.Body, release: sync.OnceFunc(func() { releaseHost(host) })}
+	return resp, nil
+}
+
+// hostBody is a response body giving its host's connection back on Close
+type hostBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *hostBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
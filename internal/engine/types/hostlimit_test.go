@@ -0,0 +1,74 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc answers requests without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestRuntimeConfig_LimitHosts(t *testing.T) {
+	ok := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+	})
+	r := &RuntimeConfig{MaxConnectionsPerHost: 1}
+	download, probe := r.LimitHosts(ok), r.LimitHosts(ok)
+
+	get := func(rt http.RoundTripper, ctx context.Context, rawurl string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rt.RoundTrip(req)
+	}
+
+	held, err := get(download, context.Background(), "https://example.com/file.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another transport's request to the same host waits for the open one
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := get(probe, ctx, "https://example.com:8443/file.iso"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second request to a full host = %v, want it to wait", err)
+	}
+	// Other hosts are not held up
+	other, err := get(probe, context.Background(), "https://mirror.example.org/file.iso")
+	if err != nil {
+		t.Fatalf("request to another host: %v", err)
+	}
+	other.Body.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := get(probe, context.Background(), "https://example.com/file.iso")
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	held.Body.Close()
+	held.Body.Close() // Closing twice gives the connection back once
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("request after the host freed up: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request still waiting after the open one was closed")
+	}
+	hostConns.Lock()
+	defer hostConns.Unlock()
+	if n := hostConns.open["example.com"]; n != 0 {
+		t.Errorf("%d requests still counted open", n)
+	}
+}
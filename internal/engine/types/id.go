@@ -0,0 +1,15 @@
+package types
+
+import "github.com/google/uuid"
+
+// ShortIDLength is how many leading characters of an ID are shown in the
+// CLI and TUI and accepted as a prefix by commands like pause and rm
+const ShortIDLength = 8
+
+// NewDownloadID generates the stable identifier used for a download in the
+// worker pool, events, persisted state and the HTTP API.
+// IDs are random (UUIDv4) rather than time-ordered so that short prefixes
+// stay unique even for downloads added in the same moment.
+func NewDownloadID() string {
+	return uuid.New().String()
+}
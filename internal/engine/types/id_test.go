@@ -0,0 +1,28 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewDownloadID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := NewDownloadID()
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			t.Fatalf("ID %q is not a UUID: %v", id, err)
+		}
+		if parsed.Version() != 4 || len(id) != 36 {
+			t.Fatalf("ID %q is not a canonical UUIDv4", id)
+		}
+		if len(id) < ShortIDLength {
+			t.Fatalf("ID %q shorter than short length", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate ID %q after %d IDs", id, i)
+		}
+		seen[id] = true
+	}
+}
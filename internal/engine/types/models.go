@@ -1,5 +1,7 @@
 package types
 
+import "net/http"
+
 // Task represents a byte range to download
 type Task struct {
 	Offset int64 `json:"offset"`
@@ -24,6 +26,26 @@ type DownloadState struct {
 	// Bitmap state
 	ChunkBitmap     []byte `json:"chunk_bitmap,omitempty"`
 	ActualChunkSize int64  `json:"actual_chunk_size,omitempty"`
+
+	// Validators the server sent, to tell whether the file changed since
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	RequestSettings
+}
+
+// RequestSettings are what a download was requested with besides its URL and
+// destination. They are saved with its resume state so a resumed download is
+// fetched, queued and checked as the first run was; credentials are left out
+// of Headers when saved.
+type RequestSettings struct {
+	Headers       http.Header `json:"-"`
+	ExpectHeaders http.Header `json:"-"`
+	Checksum      string      `json:"checksum,omitempty"`
+	Signature     string      `json:"signature,omitempty"`
+	Keyring       string      `json:"keyring,omitempty"`
+	Torrent       string      `json:"torrent,omitempty"`
+	Priority      Priority    `json:"priority,omitempty"`
 }
 
 // DownloadEntry represents a download in the master list
@@ -39,6 +61,22 @@ type DownloadEntry struct {
 	CompletedAt int64    `json:"completed_at"` // Unix timestamp when completed
 	TimeTaken   int64    `json:"time_taken"`   // Duration in milliseconds (for completed)
 	Mirrors     []string `json:"mirrors,omitempty"`
+
+	// Replayed by surge again. Headers often hold credentials, so they are
+	// kept out of JSON and only live in the database.
+	Headers  http.Header `json:"-"`
+	Checksum string      `json:"checksum,omitempty"` // "type:hex" hash the file was given to match
+}
+
+// ChecksumEntry is the recorded hash of a completed file. Size and ModTime
+// tell whether the file may have changed without reading it again.
+type ChecksumEntry struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mod_time"` // Unix nanoseconds
+	SHA256     string `json:"sha256"`
+	DownloadID string `json:"download_id,omitempty"`
+	CheckedAt  int64  `json:"checked_at"` // Unix timestamp of the last hash
 }
 
 // MasterList holds all tracked downloads
@@ -55,6 +93,11 @@ type DownloadStatus struct {
 	Downloaded int64   `json:"downloaded"`
 	Progress   float64 `json:"progress"` // Percentage 0-100
 	Speed      float64 `json:"speed"`    // MB/s
-	Status     string  `json:"status"`   // "queued", "paused", "downloading", "completed", "error"
+	Status     string  `json:"status"`   // "scheduled", "queued", "paused", "downloading", "completed", "error"
 	Error      string  `json:"error,omitempty"`
+	StartAt    int64   `json:"start_at,omitempty"` // Unix time a scheduled download starts
+	Priority   string  `json:"priority,omitempty"` // "high", "normal" or "low" while queued
+	Position   int     `json:"position,omitempty"` // 1-based place in the queue while queued
+
+	Engine *EngineStats `json:"engine,omitempty"` // While downloading
 }
@@ -0,0 +1,221 @@
+package types
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/surge-downloader/surge/internal/keyring"
+)
+
+// DefaultMaxRedirects is how many redirects a request may follow when
+// RuntimeConfig.MaxRedirects is not set, the same as net/http
+const DefaultMaxRedirects = 10
+
+// ErrBlockedAddress is returned for connections to addresses refused by
+// RuntimeConfig.BlockPrivateNetworks
+var ErrBlockedAddress = errors.New("address blocked by network policy")
+
+// ErrRedirectRefused is returned for redirects CheckRedirect does not follow
+var ErrRedirectRefused = errors.New("redirect refused")
+
+// ProxyNone as RuntimeConfig.Proxy connects directly, ignoring the
+// HTTP_PROXY and HTTPS_PROXY environment variables
+const ProxyNone = "none"
+
+// cgnatPrefix is the shared address space carriers and some clouds use
+// internally (RFC 6598); netip does not count it as private
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// GetMaxRedirects returns configured value or default
+func (r *RuntimeConfig) GetMaxRedirects() int {
+	if r == nil || r.MaxRedirects <= 0 {
+		return DefaultMaxRedirects
+	}
+	return r.MaxRedirects
+}
+
+// isInternalAddr reports whether addr is loopback, private, link-local (which
+// includes cloud metadata endpoints such as 169.254.169.254), shared, or
+// otherwise not a public unicast address
+func isInternalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsGlobalUnicast() || addr.IsPrivate() || cgnatPrefix.Contains(addr) ||
+		(addr.Is4() && addr.As4()[0] == 0)
+}
+
+// CheckAddr returns ErrBlockedAddress if BlockPrivateNetworks forbids
+// connecting to addr. AllowedNetworks lists CIDR ranges that are exempt.
+func (r *RuntimeConfig) CheckAddr(addr netip.Addr) error {
+	if r == nil || !r.BlockPrivateNetworks || !isInternalAddr(addr) {
+		return nil
+	}
+	addr = addr.Unmap()
+	for _, cidr := range r.AllowedNetworks {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+			return nil
+		}
+		if single, err := netip.ParseAddr(cidr); err == nil && single.Unmap() == addr {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+}
+
+// DialControl is a net.Dialer Control function enforcing CheckAddr. It sees
+// the address actually dialled after DNS resolution, so neither redirects nor
+// hostnames that resolve to internal addresses get past it.
+func (r *RuntimeConfig) DialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: unparseable address %q", ErrBlockedAddress, address)
+	}
+	return r.CheckAddr(addrPort.Addr())
+}
+
+// CheckRedirect is an http.Client CheckRedirect function that limits the
+// redirect chain to GetMaxRedirects and to http and https targets
+func (r *RuntimeConfig) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= r.GetMaxRedirects() {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrRedirectRefused, len(via))
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrRedirectRefused, req.URL.Scheme)
+	}
+	return nil
+}
+
+// ParseProxy parses a proxy address: an http, https, socks5 or socks5h URL,
+// with user:password in it for proxies that require authentication. A bare
+// host:port is an HTTP proxy.
+func ParseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	// url.Parse errors quote the input, which may hold a password
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.New("invalid proxy address")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %s: unsupported scheme %q", u.Redacted(), u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy %s: no host", u.Redacted())
+	}
+	return u, nil
+}
+
+// CheckProxy returns an error if proxy is neither empty, ProxyNone, a
+// keyring reference nor an address ParseProxy accepts. References are looked
+// up when the proxy is used.
+func CheckProxy(proxy string) error {
+	if proxy == "" || proxy == ProxyNone || keyring.IsRef(proxy) {
+		return nil
+	}
+	_, err := ParseProxy(proxy)
+	return err
+}
+
+// ProxyFunc returns the http.Transport Proxy function for r.Proxy. Unset, the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables decide; with
+// ProxyNone every request goes direct. A configured proxy, which may be a
+// keyring reference, is used for every request NO_PROXY does not exempt, and
+// one that does not parse or resolve fails the request rather than silently
+// connecting directly.
+func (r *RuntimeConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	if r == nil || r.Proxy == "" {
+		return http.ProxyFromEnvironment
+	}
+	if r.Proxy == ProxyNone {
+		return nil
+	}
+	spec, err := keyring.Resolve(r.Proxy)
+	if err != nil {
+		err = fmt.Errorf("proxy: %w", err)
+		return func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+	proxy, err := ParseProxy(spec)
+	if err != nil {
+		return func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+	noProxy := cmp.Or(os.Getenv("NO_PROXY"), os.Getenv("no_proxy"))
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL, noProxy) {
+			return nil, nil
+		}
+		return proxy, nil
+	}
+}
+
+// WithProxy returns a copy of r that uses proxy, or r itself if proxy is empty
+func (r *RuntimeConfig) WithProxy(proxy string) *RuntimeConfig {
+	if proxy == "" {
+		return r
+	}
+	var rt RuntimeConfig
+	if r != nil {
+		rt = *r
+	}
+	rt.Proxy = proxy
+	return &rt
+}
+
+// bypassProxy reports whether requests to u go direct under noProxy, a
+// NO_PROXY list of "*", domains (which include their subdomains; a leading
+// "." matches subdomains only), IP addresses and CIDRs, each optionally with
+// a port. Like net/http, localhost and loopback addresses always go direct.
+func bypassProxy(u *url.URL, noProxy string) bool {
+	host := strings.ToLower(u.Hostname())
+	addr, addrErr := netip.ParseAddr(host)
+	if host == "localhost" || (addrErr == nil && addr.IsLoopback()) {
+		return true
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if addrErr == nil && prefix.Contains(addr.Unmap()) {
+				return true
+			}
+			continue
+		}
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		entryHost = strings.TrimPrefix(entryHost, "*")
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(host, entryHost) {
+				return true
+			}
+			continue
+		}
+		if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package types
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeConfig_CheckAddr(t *testing.T) {
+	blocking := &RuntimeConfig{BlockPrivateNetworks: true, AllowedNetworks: []string{"10.1.0.0/16", "192.168.1.5"}}
+
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"93.184.216.34", false},
+		{"2606:2800:220:1::1", false},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"169.254.169.254", true}, // Cloud metadata
+		{"fe80::1", true},
+		{"10.0.0.1", true},
+		{"172.16.5.4", true},
+		{"192.168.1.1", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::ffff:127.0.0.1", true},
+		{"fd00:ec2::254", true},
+		{"10.1.2.3", false},    // In AllowedNetworks
+		{"192.168.1.5", false}, // Single allowed address
+	}
+
+	for _, tt := range tests {
+		err := blocking.CheckAddr(netip.MustParseAddr(tt.addr))
+		if got := errors.Is(err, ErrBlockedAddress); got != tt.blocked {
+			t.Errorf("CheckAddr(%s) = %v, blocked want %v", tt.addr, err, tt.blocked)
+		}
+	}
+
+	var unset *RuntimeConfig
+	if err := unset.CheckAddr(netip.MustParseAddr("127.0.0.1")); err != nil {
+		t.Errorf("nil config should not block, got %v", err)
+	}
+}
+
+func TestRuntimeConfig_DialControl(t *testing.T) {
+	r := &RuntimeConfig{BlockPrivateNetworks: true}
+	if err := r.DialControl("tcp4", "169.254.169.254:80", nil); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("expected metadata address to be blocked, got %v", err)
+	}
+	if err := r.DialControl("tcp6", "[2606:2800:220:1::1]:443", nil); err != nil {
+		t.Errorf("expected public address to pass, got %v", err)
+	}
+}
+
+func TestRuntimeConfig_CheckRedirect(t *testing.T) {
+	r := &RuntimeConfig{MaxRedirects: 2}
+	req := func(raw string) *http.Request {
+		u, _ := url.Parse(raw)
+		return &http.Request{URL: u}
+	}
+
+	if err := r.CheckRedirect(req("https://example.com/b"), []*http.Request{req("https://example.com/a")}); err != nil {
+		t.Errorf("first redirect should be followed, got %v", err)
+	}
+	if err := r.CheckRedirect(req("https://example.com/c"), []*http.Request{req("https://example.com/a"), req("https://example.com/b")}); err == nil {
+		t.Error("expected redirect limit to stop the third redirect")
+	}
+	if err := r.CheckRedirect(req("file:///etc/passwd"), []*http.Request{req("https://example.com/a")}); err == nil {
+		t.Error("expected redirect to a file URL to be refused")
+	}
+	if got := (*RuntimeConfig)(nil).GetMaxRedirects(); got != DefaultMaxRedirects {
+		t.Errorf("GetMaxRedirects() = %d, want %d", got, DefaultMaxRedirects)
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	for proxy, want := range map[string]string{
+		"proxy.lan:3128":                  "http://proxy.lan:3128",
+		"https://proxy.lan":               "https://proxy.lan",
+		"socks5://user:pw@127.0.0.1:1080": "socks5://user:pw@127.0.0.1:1080",
+		"socks5h://tor:9050":              "socks5h://tor:9050",
+		"ftp://proxy.lan:21":              "",
+		"http://":                         "",
+		"http://user:pw@[::1":             "",
+	} {
+		u, err := ParseProxy(proxy)
+		if want == "" {
+			if err == nil {
+				t.Errorf("ParseProxy(%q) = %v, want an error", proxy, u)
+			} else if strings.Contains(err.Error(), "pw") {
+				t.Errorf("ParseProxy(%q) error %q shows the password", proxy, err)
+			}
+			continue
+		}
+		if err != nil || u.String() != want {
+			t.Errorf("ParseProxy(%q) = %v, %v; want %s", proxy, u, err, want)
+		}
+	}
+}
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := "example.com, .internal, 10.0.0.0/8, 192.168.1.5, mirror.org:8080"
+	for rawurl, bypass := range map[string]bool{
+		"http://example.com/a":          true,
+		"https://cdn.example.com/a":     true,
+		"http://notexample.com/a":       false,
+		"http://internal/a":             false, // Leading dot: subdomains only
+		"http://files.internal/a":       true,
+		"http://10.2.3.4/a":             true,
+		"http://192.168.1.5/a":          true,
+		"http://192.168.1.6/a":          false,
+		"http://mirror.org:8080/a":      true,
+		"http://mirror.org/a":           false, // Other port
+		"http://localhost:9000/a":       true,
+		"http://127.0.0.1/a":            true,
+		"http://[::1]/a":                true,
+		"https://downloads.example.net": false,
+	} {
+		u, _ := url.Parse(rawurl)
+		if got := bypassProxy(u, noProxy); got != bypass {
+			t.Errorf("bypassProxy(%s) = %v, want %v", rawurl, got, bypass)
+		}
+	}
+	if u, _ := url.Parse("https://anything.net"); !bypassProxy(u, "*") {
+		t.Error(`NO_PROXY "*" should exempt every host`)
+	}
+}
+
+func TestRuntimeConfig_ProxyFunc(t *testing.T) {
+	t.Setenv("NO_PROXY", "direct.example")
+	req := func(raw string) *http.Request {
+		u, _ := url.Parse(raw)
+		return &http.Request{URL: u}
+	}
+
+	if (&RuntimeConfig{Proxy: ProxyNone}).ProxyFunc() != nil {
+		t.Error("ProxyNone should connect directly")
+	}
+
+	proxyFunc := (&RuntimeConfig{Proxy: "socks5://127.0.0.1:1080"}).ProxyFunc()
+	if u, err := proxyFunc(req("https://files.example/a")); err != nil || u.String() != "socks5://127.0.0.1:1080" {
+		t.Errorf("proxy = %v, %v; want the configured one", u, err)
+	}
+	if u, err := proxyFunc(req("https://direct.example/a")); err != nil || u != nil {
+		t.Errorf("proxy for a NO_PROXY host = %v, %v; want none", u, err)
+	}
+
+	bad := (&RuntimeConfig{Proxy: "gopher://proxy"}).ProxyFunc()
+	if _, err := bad(req("https://files.example/a")); err == nil {
+		t.Error("an invalid proxy should fail the request, not connect directly")
+	}
+
+	// A keyring reference is looked up when the proxy is used
+	if err := CheckProxy("keyring:surge-test-missing"); err != nil {
+		t.Errorf("CheckProxy of a keyring reference = %v", err)
+	}
+	missing := (&RuntimeConfig{Proxy: "keyring:surge-test-missing"}).ProxyFunc()
+	if _, err := missing(req("https://files.example/a")); err == nil {
+		t.Error("a proxy missing from the keyring should fail the request")
+	}
+}
+
+func TestRuntimeConfig_WithProxy(t *testing.T) {
+	r := &RuntimeConfig{MaxRedirects: 3}
+	if r.WithProxy("") != r {
+		t.Error("WithProxy(\"\") should return the config itself")
+	}
+	p := r.WithProxy("proxy.lan:3128")
+	if p == r || p.Proxy != "proxy.lan:3128" || p.MaxRedirects != 3 || r.Proxy != "" {
+		t.Errorf("WithProxy = %+v from %+v, want a copy with the proxy", p, r)
+	}
+}
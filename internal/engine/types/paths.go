@@ -0,0 +1,87 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PartDirName is the hidden folder, inside the download directory, that holds
+// working files when RuntimeConfig.PartFilesInSubdir is set
+const PartDirName = ".surge"
+
+// WorkingPath returns where download id keeps its incomplete file while it
+// downloads to destPath: "<name>.<short id>.surge", either next to destPath
+// or in its PartDirName folder. The ID keeps two downloads that target the
+// same name from writing to the same part file.
+func WorkingPath(destPath, id string, inSubdir bool) string {
+	dir, name := filepath.Split(destPath)
+	if inSubdir {
+		dir = filepath.Join(dir, PartDirName)
+	}
+	if short := shortID(id); short != "" {
+		name += "." + short
+	}
+	return filepath.Join(dir, name+IncompleteSuffix)
+}
+
+// WorkingPathCandidates lists every place a working file for id may have been
+// written, including the un-namespaced "<name>.surge" used by older versions
+func WorkingPathCandidates(destPath, id string) []string {
+	return []string{
+		WorkingPath(destPath, id, false),
+		WorkingPath(destPath, id, true),
+		destPath + IncompleteSuffix,
+	}
+}
+
+// FindWorkingPath returns the existing working file for id if there is one,
+// so a resume picks up its data wherever it was written, and otherwise the
+// path a new download should use
+func FindWorkingPath(destPath, id string, inSubdir bool) string {
+	for _, candidate := range WorkingPathCandidates(destPath, id) {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return WorkingPath(destPath, id, inSubdir)
+}
+
+// HasWorkingFile reports whether any download, whatever its ID, has an
+// incomplete file on disk for destPath
+func HasWorkingFile(destPath string) bool {
+	if _, err := os.Stat(destPath + IncompleteSuffix); err == nil {
+		return true
+	}
+
+	dir, name := filepath.Split(destPath)
+	prefix := name + "."
+	for _, d := range []string{dir, filepath.Join(dir, PartDirName)} {
+		if d == "" {
+			d = "."
+		}
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			n := e.Name()
+			if !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, IncompleteSuffix) {
+				continue
+			}
+			// Only "<name>.<id>.surge", not the part file of "<name>.<ext>"
+			if id := strings.TrimSuffix(n[len(prefix):], IncompleteSuffix); id != "" && !strings.Contains(id, ".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shortID truncates id to ShortIDLength characters
+func shortID(id string) string {
+	if len(id) > ShortIDLength {
+		return id[:ShortIDLength]
+	}
+	return id
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkingPath(t *testing.T) {
+	dest := filepath.Join("dl", "file.bin")
+	id := "0123456789abcdef"
+
+	if got, want := WorkingPath(dest, id, false), filepath.Join("dl", "file.bin.01234567.surge"); got != want {
+		t.Errorf("WorkingPath = %q, want %q", got, want)
+	}
+	if got, want := WorkingPath(dest, id, true), filepath.Join("dl", ".surge", "file.bin.01234567.surge"); got != want {
+		t.Errorf("WorkingPath in subdir = %q, want %q", got, want)
+	}
+	if got, want := WorkingPath(dest, "", false), dest+IncompleteSuffix; got != want {
+		t.Errorf("WorkingPath without ID = %q, want %q", got, want)
+	}
+	if WorkingPath(dest, "aaaaaaaa-1", false) == WorkingPath(dest, "bbbbbbbb-1", false) {
+		t.Error("downloads with different IDs share a working path")
+	}
+}
+
+func TestFindWorkingPath_PrefersExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "file.bin")
+	id := "0123456789abcdef"
+
+	// Nothing on disk: use the configured location
+	if got := FindWorkingPath(dest, id, true); got != WorkingPath(dest, id, true) {
+		t.Errorf("FindWorkingPath = %q, want subdir path", got)
+	}
+
+	// A part file from an older version is picked up wherever the setting points
+	legacy := dest + IncompleteSuffix
+	if err := os.WriteFile(legacy, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindWorkingPath(dest, id, true); got != legacy {
+		t.Errorf("FindWorkingPath = %q, want legacy %q", got, legacy)
+	}
+}
+
+func TestHasWorkingFile(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "file.bin")
+
+	if HasWorkingFile(dest) {
+		t.Fatal("HasWorkingFile true for empty directory")
+	}
+
+	// A longer name sharing the prefix does not count
+	other := WorkingPath(filepath.Join(dir, "file.bin.gz"), "0123456789", false)
+	if err := os.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if HasWorkingFile(dest) {
+		t.Error("HasWorkingFile matched the part file of file.bin.gz")
+	}
+
+	hidden := WorkingPath(dest, "0123456789", true)
+	if err := os.MkdirAll(filepath.Dir(hidden), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hidden, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !HasWorkingFile(dest) {
+		t.Error("HasWorkingFile missed a part file in the hidden folder")
+	}
+}
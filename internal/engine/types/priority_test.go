@@ -0,0 +1,29 @@
+package types
+
+import "testing"
+
+func TestParsePriority(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Priority
+	}{
+		{"high", PriorityHigh},
+		{" Low ", PriorityLow},
+		{"normal", PriorityNormal},
+		{"", PriorityNormal},
+	} {
+		got, err := ParsePriority(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePriority(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+		if back, _ := ParsePriority(got.String()); back != got {
+			t.Errorf("ParsePriority(%q) = %v, want %v", got.String(), back, got)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("Expected an error for an unknown priority")
+	}
+	if got := Priority(5).String(); got != "high" {
+		t.Errorf("Priority(5).String() = %q, want high", got)
+	}
+}
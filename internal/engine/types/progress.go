@@ -5,6 +5,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 )
 
 type ProgressState struct {
@@ -12,13 +14,26 @@ type ProgressState struct {
 	Downloaded    atomic.Int64
 	TotalSize     int64
 	StartTime     time.Time
-	ActiveWorkers atomic.Int32
+	ActiveWorkers atomic.Int32 // Requests currently open, shown as the live connection count
+	Retries       atomic.Int64 // Chunk retries this session
+	Steals        atomic.Int64 // Ranges stolen from busy workers for idle ones, this session
+	Splits        atomic.Int64 // Queued ranges split for idle workers, this session
+	Reassignments atomic.Int64 // Ranges taken from a slow or failing worker and requeued, this session
 	Done          atomic.Bool
 	Error         atomic.Pointer[error]
 	Paused        atomic.Bool
 	Pausing       atomic.Bool // Intermediate state: Pause requested but workers not yet exited
 	CancelFunc    context.CancelFunc
 
+	// Limiter caps the download's speed. The pool sets its rate from the
+	// download's own limit and its share of the global one.
+	Limiter *ratelimit.Limiter
+
+	// ConnLimit is the most connections the pool lets the download run now,
+	// its share of the global budget; 0 for no limit. The concurrent engine
+	// follows changes while running.
+	ConnLimit atomic.Int32
+
 	SessionStartBytes int64         // SessionStartBytes tracks how many bytes were already downloaded when the current session started
 	SavedElapsed      time.Duration // Time spent in previous sessions
 
@@ -31,7 +46,86 @@ type ProgressState struct {
 	ActualChunkSize int64   // Size of each actual chunk in bytes
 	BitmapWidth     int     // Number of chunks tracked
 
-	mu sync.Mutex // Protects TotalSize, StartTime, SessionStartBytes, SavedElapsed, Mirrors
+	taskSource func() ([]TaskStats, int) // Tasks in flight and adaptive target, see SetTaskSource
+
+	connections []ConnectionStats // By worker, see RecordRequest
+
+	// Speed history, see RecordSpeed
+	speedHistory [SpeedHistorySize]float64 // Ring buffer of bytes/sec, one sample per second
+	speedNext    int                       // Slot the next sample goes in
+	speedCount   int                       // Samples recorded, up to SpeedHistorySize
+	speedAt      time.Time                 // When the last sample was taken, zero to start over
+	speedBytes   int64                     // Downloaded at speedAt
+
+	mu sync.Mutex // Protects TotalSize, StartTime, SessionStartBytes, SavedElapsed, Mirrors, taskSource, connections, speed history
+}
+
+// SpeedHistorySize is how many seconds of throughput a ProgressState keeps
+const SpeedHistorySize = 120
+
+// EngineStats is a snapshot of what the concurrent engine is doing with a
+// download, for tuning the connection count
+type EngineStats struct {
+	Connections       int         `json:"connections"`                  // Requests open now
+	TargetConnections int         `json:"target_connections,omitempty"` // Where adaptive tuning is heading, 0 when off
+	Steals            int64       `json:"steals"`
+	Splits            int64       `json:"splits"`
+	Reassignments     int64       `json:"reassignments"`
+	Retries           int64       `json:"retries"`
+	Tasks             []TaskStats `json:"tasks,omitempty"` // By worker
+}
+
+// TaskStats describes the range one worker is fetching
+type TaskStats struct {
+	Worker    int     `json:"worker"`
+	Offset    int64   `json:"offset"`    // Next byte to fetch
+	Remaining int64   `json:"remaining"` // Bytes left before the worker stops
+	Speed     float64 `json:"speed"`     // Smoothed bytes/sec, 0 until measured
+}
+
+// ConnectionStats totals the requests one worker made for a download
+type ConnectionStats struct {
+	Worker    int
+	Bytes     int64
+	Busy      time.Duration // Time with a request open
+	Requests  int
+	Responses int           // Requests that got response headers
+	Retries   int           // Requests that retried a failed one
+	TTFB      time.Duration // Summed wait for response headers, over Responses
+}
+
+// Speed returns the bytes/sec the worker fetched while it had a request open
+func (c ConnectionStats) Speed() float64 {
+	if c.Busy <= 0 {
+		return 0
+	}
+	return float64(c.Bytes) / c.Busy.Seconds()
+}
+
+// AverageTTFB returns the mean time the worker waited for response headers
+func (c ConnectionStats) AverageTTFB() time.Duration {
+	if c.Responses == 0 {
+		return 0
+	}
+	return c.TTFB / time.Duration(c.Responses)
+}
+
+// SingleConnectionEstimate estimates how long one connection would take to
+// fetch total bytes: a request's wait for headers, then the bytes at the
+// speed of the fastest connection. That is generous to a single connection,
+// since connections sharing a link each get less of it. It returns 0 when
+// no connection fetched anything.
+func SingleConnectionEstimate(connections []ConnectionStats, total int64) time.Duration {
+	var fastest ConnectionStats
+	for _, c := range connections {
+		if c.Speed() > fastest.Speed() {
+			fastest = c
+		}
+	}
+	if fastest.Speed() == 0 {
+		return 0
+	}
+	return fastest.AverageTTFB() + time.Duration(float64(total)/fastest.Speed()*float64(time.Second))
 }
 
 type MirrorStatus struct {
@@ -45,6 +139,7 @@ func NewProgressState(id string, totalSize int64) *ProgressState {
 		ID:        id,
 		TotalSize: totalSize,
 		StartTime: time.Now(),
+		Limiter:   ratelimit.New(0),
 	}
 }
 
@@ -54,6 +149,7 @@ func (ps *ProgressState) SetTotalSize(size int64) {
 	ps.TotalSize = size
 	ps.SessionStartBytes = ps.Downloaded.Load()
 	ps.StartTime = time.Now()
+	ps.speedAt = time.Time{}
 }
 
 func (ps *ProgressState) SyncSessionStart() {
@@ -61,6 +157,45 @@ func (ps *ProgressState) SyncSessionStart() {
 	defer ps.mu.Unlock()
 	ps.SessionStartBytes = ps.Downloaded.Load()
 	ps.StartTime = time.Now()
+	ps.speedAt = time.Time{} // Time spent paused is not a stretch of zero speed
+}
+
+// RecordSpeed adds a sample to the speed history for every whole second
+// since the last call. The seconds share the bytes downloaded over them
+// evenly, so calling it less than once a second smooths the history.
+func (ps *ProgressState) RecordSpeed(now time.Time) {
+	downloaded := ps.Downloaded.Load()
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.speedAt.IsZero() || downloaded < ps.speedBytes {
+		ps.speedAt, ps.speedBytes = now, downloaded
+		return
+	}
+	elapsed := now.Sub(ps.speedAt)
+	seconds := int(elapsed / time.Second)
+	if seconds < 1 {
+		return
+	}
+	rate := float64(downloaded-ps.speedBytes) / elapsed.Seconds()
+	for i := 0; i < min(seconds, SpeedHistorySize); i++ {
+		ps.speedHistory[ps.speedNext] = rate
+		ps.speedNext = (ps.speedNext + 1) % SpeedHistorySize
+		ps.speedCount = min(ps.speedCount+1, SpeedHistorySize)
+	}
+	ps.speedAt, ps.speedBytes = now, downloaded
+}
+
+// SpeedHistory returns the per-second speeds RecordSpeed kept, in bytes/sec
+// and oldest first
+func (ps *ProgressState) SpeedHistory() []float64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	history := make([]float64, 0, ps.speedCount)
+	start := (ps.speedNext - ps.speedCount + SpeedHistorySize) % SpeedHistorySize
+	for i := 0; i < ps.speedCount; i++ {
+		history = append(history, ps.speedHistory[(start+i)%SpeedHistorySize])
+	}
+	return history
 }
 
 func (ps *ProgressState) SetError(err error) {
@@ -87,6 +222,71 @@ func (ps *ProgressState) GetProgress() (downloaded int64, total int64, totalElap
 	return
 }
 
+// SetTaskSource registers fn to report the tasks in flight and the adaptive
+// connection target while a segmented download runs; nil removes it
+func (ps *ProgressState) SetTaskSource(fn func() ([]TaskStats, int)) {
+	ps.mu.Lock()
+	ps.taskSource = fn
+	ps.mu.Unlock()
+}
+
+// EngineStats snapshots the engine counters and, while a segmented download
+// runs, its tasks
+func (ps *ProgressState) EngineStats() EngineStats {
+	stats := EngineStats{
+		Connections:   int(ps.ActiveWorkers.Load()),
+		Steals:        ps.Steals.Load(),
+		Splits:        ps.Splits.Load(),
+		Reassignments: ps.Reassignments.Load(),
+		Retries:       ps.Retries.Load(),
+	}
+	ps.mu.Lock()
+	source := ps.taskSource
+	ps.mu.Unlock()
+	if source != nil {
+		stats.Tasks, stats.TargetConnections = source()
+	}
+	return stats
+}
+
+// RecordRequest adds a range request of worker to its connection stats: the
+// bytes it fetched, how long it was open and how long its headers took, 0
+// if they never came
+func (ps *ProgressState) RecordRequest(worker int, bytes int64, busy, ttfb time.Duration, retry bool) {
+	if worker < 0 {
+		return
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for len(ps.connections) <= worker {
+		ps.connections = append(ps.connections, ConnectionStats{Worker: len(ps.connections)})
+	}
+	c := &ps.connections[worker]
+	c.Bytes += bytes
+	c.Busy += busy
+	c.Requests++
+	if ttfb > 0 {
+		c.Responses++
+		c.TTFB += ttfb
+	}
+	if retry {
+		c.Retries++
+	}
+}
+
+// ConnectionStats returns the stats of the workers that made requests
+func (ps *ProgressState) ConnectionStats() []ConnectionStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var stats []ConnectionStats
+	for _, c := range ps.connections {
+		if c.Requests > 0 {
+			stats = append(stats, c)
+		}
+	}
+	return stats
+}
+
 func (ps *ProgressState) Pause() {
 	ps.Paused.Store(true)
 	if ps.CancelFunc != nil {
@@ -159,7 +359,7 @@ func (ps *ProgressState) InitBitmap(totalSize int64, chunkSize int64) {
 		return
 	}
 
-	numChunks := int((totalSize + chunkSize - 1) / chunkSize)
+	numChunks := int(ChunkCount(totalSize, chunkSize))
 
 	// 2 bits per chunk. 4 chunks per byte.
 	// Bytes needed = ceil(numChunks / 4)
@@ -180,11 +380,16 @@ func (ps *ProgressState) RestoreBitmap(bitmap []byte, actualChunkSize int64) {
 		return
 	}
 
+	// Recalculate width. A saved bitmap too short for it, or claiming more
+	// chunks than a download is ever split into, is not trusted.
+	count := ChunkCount(ps.TotalSize, actualChunkSize)
+	if count > MaxChunks || int64(len(bitmap)) < (count+3)/4 {
+		return
+	}
+	numChunks := int(count)
+
 	ps.ChunkBitmap = bitmap
 	ps.ActualChunkSize = actualChunkSize
-
-	// Recalculate width
-	numChunks := int((ps.TotalSize + ps.ActualChunkSize - 1) / ps.ActualChunkSize)
 	ps.BitmapWidth = numChunks
 
 	// Re-initialize progress tracking (will be filled by RecalculateProgress)
@@ -252,10 +457,7 @@ func (ps *ProgressState) UpdateChunkStatus(offset, length int64, status ChunkSta
 	for i := startIdx; i <= endIdx; i++ {
 		// Calculate precise overlap with this chunk
 		chunkStart := int64(i) * ps.ActualChunkSize
-		chunkEnd := chunkStart + ps.ActualChunkSize
-		if chunkEnd > ps.TotalSize {
-			chunkEnd = ps.TotalSize
-		}
+		chunkEnd := chunkStart + min(ps.ActualChunkSize, ps.TotalSize-chunkStart) // Clamped to TotalSize without overflowing
 
 		updateStart := offset
 		if updateStart < chunkStart {
@@ -289,6 +491,14 @@ func (ps *ProgressState) UpdateChunkStatus(offset, length int64, status ChunkSta
 			if current != ChunkCompleted {
 				ps.SetChunkState(i, ChunkDownloading)
 			}
+		} else if status == ChunkPending {
+			// Bytes thrown away, e.g. a range that failed its digest
+			ps.ChunkProgress[i] = max(ps.ChunkProgress[i]-overlap, 0)
+			if ps.ChunkProgress[i] == 0 {
+				ps.SetChunkState(i, ChunkPending)
+			} else {
+				ps.SetChunkState(i, ChunkDownloading)
+			}
 		}
 	}
 }
@@ -306,10 +516,7 @@ func (ps *ProgressState) RecalculateProgress(remainingTasks []Task) {
 	ps.ChunkProgress = make([]int64, ps.BitmapWidth)
 	for i := 0; i < ps.BitmapWidth; i++ {
 		chunkStart := int64(i) * ps.ActualChunkSize
-		chunkEnd := chunkStart + ps.ActualChunkSize
-		if chunkEnd > ps.TotalSize {
-			chunkEnd = ps.TotalSize
-		}
+		chunkEnd := chunkStart + min(ps.ActualChunkSize, ps.TotalSize-chunkStart)
 		ps.ChunkProgress[i] = chunkEnd - chunkStart
 	}
 
@@ -330,10 +537,7 @@ func (ps *ProgressState) RecalculateProgress(remainingTasks []Task) {
 
 		for i := startIdx; i <= endIdx; i++ {
 			chunkStart := int64(i) * ps.ActualChunkSize
-			chunkEnd := chunkStart + ps.ActualChunkSize
-			if chunkEnd > ps.TotalSize {
-				chunkEnd = ps.TotalSize
-			}
+			chunkEnd := chunkStart + min(ps.ActualChunkSize, ps.TotalSize-chunkStart)
 
 			taskStart := offset
 			if taskStart < chunkStart {
@@ -355,10 +559,7 @@ func (ps *ProgressState) RecalculateProgress(remainingTasks []Task) {
 	// 3. Update Bitmap based on calculated progress
 	for i := 0; i < ps.BitmapWidth; i++ {
 		chunkStart := int64(i) * ps.ActualChunkSize
-		chunkEnd := chunkStart + ps.ActualChunkSize
-		if chunkEnd > ps.TotalSize {
-			chunkEnd = ps.TotalSize
-		}
+		chunkEnd := chunkStart + min(ps.ActualChunkSize, ps.TotalSize-chunkStart)
 		chunkSize := chunkEnd - chunkStart
 
 		if ps.ChunkProgress[i] >= chunkSize {
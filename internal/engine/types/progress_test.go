@@ -2,6 +2,8 @@ package types
 
 import (
 	"context"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -191,3 +193,130 @@ func TestProgressState_ElapsedCalculation(t *testing.T) {
 		t.Errorf("TotalElapsed = %v, want ~7s", totalElapsed)
 	}
 }
+
+func TestProgressState_SpeedHistory(t *testing.T) {
+	ps := NewProgressState("test-speed", 1<<30)
+	start := time.Now()
+	ps.RecordSpeed(start) // Sets the baseline only
+	if h := ps.SpeedHistory(); len(h) != 0 {
+		t.Fatalf("history after the first call = %v, want empty", h)
+	}
+
+	ps.Downloaded.Store(1000)
+	ps.RecordSpeed(start.Add(500 * time.Millisecond)) // Not a whole second yet
+	ps.RecordSpeed(start.Add(time.Second))
+	ps.Downloaded.Store(5000)
+	ps.RecordSpeed(start.Add(3 * time.Second)) // Two seconds share 4000 bytes
+	if h, want := ps.SpeedHistory(), []float64{1000, 2000, 2000}; !reflect.DeepEqual(h, want) {
+		t.Errorf("SpeedHistory() = %v, want %v", h, want)
+	}
+
+	// A paused stretch is not recorded as zero speed
+	ps.SyncSessionStart()
+	ps.RecordSpeed(start.Add(time.Hour))
+	if h := ps.SpeedHistory(); len(h) != 3 {
+		t.Errorf("history after a new session = %v, want 3 samples", h)
+	}
+
+	// The ring keeps the newest SpeedHistorySize seconds, oldest first
+	for i := 1; i <= SpeedHistorySize+10; i++ {
+		ps.Downloaded.Add(int64(i))
+		ps.RecordSpeed(start.Add(time.Hour + time.Duration(i)*time.Second))
+	}
+	h := ps.SpeedHistory()
+	if len(h) != SpeedHistorySize || h[0] != 11 || h[len(h)-1] != SpeedHistorySize+10 {
+		t.Errorf("SpeedHistory() has %d samples from %v to %v, want %d from 11 to %d",
+			len(h), h[0], h[len(h)-1], SpeedHistorySize, SpeedHistorySize+10)
+	}
+}
+
+func TestProgressState_ConnectionStats(t *testing.T) {
+	ps := NewProgressState("test-conns", 300*MB)
+	ps.RecordRequest(1, 100*MB, 10*time.Second, 200*time.Millisecond, false)
+	ps.RecordRequest(1, 0, time.Second, 0, true) // Failed before headers
+	ps.RecordRequest(0, 50*MB, 10*time.Second, 100*time.Millisecond, false)
+
+	stats := ps.ConnectionStats()
+	if len(stats) != 2 || stats[0].Worker != 0 || stats[1].Worker != 1 {
+		t.Fatalf("ConnectionStats() = %+v, want workers 0 and 1", stats)
+	}
+	w1 := stats[1]
+	if w1.Bytes != 100*MB || w1.Requests != 2 || w1.Responses != 1 || w1.Retries != 1 {
+		t.Errorf("worker 1 = %+v", w1)
+	}
+	if w1.AverageTTFB() != 200*time.Millisecond {
+		t.Errorf("AverageTTFB() = %v, want 200ms", w1.AverageTTFB())
+	}
+
+	// Worker 1 ran at 100 MB in 11s; 300 MB at that speed takes 33s after its TTFB
+	want := 33*time.Second + 200*time.Millisecond
+	if got := SingleConnectionEstimate(stats, 300*MB); got < want-time.Millisecond || got > want+time.Millisecond {
+		t.Errorf("SingleConnectionEstimate() = %v, want %v", got, want)
+	}
+	if got := SingleConnectionEstimate(nil, 300*MB); got != 0 {
+		t.Errorf("SingleConnectionEstimate() without connections = %v, want 0", got)
+	}
+}
+
+func TestInitBitmap_NearInt64Limit(t *testing.T) {
+	// (total+chunk-1)/chunk overflows here and used to make a negative bitmap
+	total := int64(math.MaxInt64)
+	chunk := int64(math.MaxInt64/4 + 1)
+	ps := NewProgressState("huge", total)
+	ps.InitBitmap(total, chunk)
+
+	if ps.BitmapWidth != 4 {
+		t.Fatalf("BitmapWidth = %d, want 4", ps.BitmapWidth)
+	}
+	ps.UpdateChunkStatus(3*chunk, total-3*chunk, ChunkCompleted)
+	if ps.GetChunkState(3) != ChunkCompleted {
+		t.Error("last chunk should be completed")
+	}
+	if ps.ChunkProgress[3] != total-3*chunk {
+		t.Errorf("ChunkProgress[3] = %d, want %d", ps.ChunkProgress[3], total-3*chunk)
+	}
+}
+
+func TestRestoreBitmap_RejectsMismatchedState(t *testing.T) {
+	ps := NewProgressState("restore", 100*MB)
+	ps.InitBitmap(100*MB, MB)
+
+	// Too short for 100 chunks
+	ps.RestoreBitmap(make([]byte, 3), MB)
+	if ps.BitmapWidth != 100 || len(ps.ChunkBitmap) != 25 {
+		t.Errorf("short bitmap was restored: width %d, %d bytes", ps.BitmapWidth, len(ps.ChunkBitmap))
+	}
+
+	// More chunks than a download is ever split into
+	ps.RestoreBitmap(make([]byte, 25), 1)
+	if ps.ActualChunkSize != MB {
+		t.Errorf("ActualChunkSize = %d, want the bitmap left alone", ps.ActualChunkSize)
+	}
+}
+
+func TestProgressState_EngineStats(t *testing.T) {
+	ps := NewProgressState("engine", 1000)
+	ps.ActiveWorkers.Store(3)
+	ps.Steals.Add(2)
+	ps.Splits.Add(5)
+	ps.Reassignments.Add(1)
+	ps.Retries.Add(4)
+
+	stats := ps.EngineStats()
+	want := EngineStats{Connections: 3, Steals: 2, Splits: 5, Reassignments: 1, Retries: 4}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("EngineStats = %+v, want %+v", stats, want)
+	}
+
+	tasks := []TaskStats{{Worker: 0, Offset: 100, Remaining: 50, Speed: 10}}
+	ps.SetTaskSource(func() ([]TaskStats, int) { return tasks, 6 })
+	stats = ps.EngineStats()
+	if !reflect.DeepEqual(stats.Tasks, tasks) || stats.TargetConnections != 6 {
+		t.Errorf("with a task source: %+v", stats)
+	}
+
+	ps.SetTaskSource(nil)
+	if stats = ps.EngineStats(); stats.Tasks != nil || stats.TargetConnections != 0 {
+		t.Errorf("task source still used after removal: %+v", stats)
+	}
+}
@@ -0,0 +1,133 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// scheduleDateLayout is how a Schedule with a date is written
+const scheduleDateLayout = "2006-01-02 15:04"
+
+// Schedule holds a download back until a set time, or keeps it to a daily
+// window such as off-peak hours. The zero Schedule starts at once. Times are
+// local.
+type Schedule struct {
+	At time.Time // Start no earlier than this; zero with a window
+
+	// From and Until bound the daily window, as time since midnight. Until
+	// before From spans midnight.
+	From, Until time.Duration
+	window      bool
+}
+
+// ParseSchedule reads "HH:MM" (the next time the clock shows it),
+// "YYYY-MM-DD HH:MM", or a window "HH:MM-HH:MM". now is the time "HH:MM"
+// counts from.
+func ParseSchedule(spec string, now time.Time) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Schedule{}, nil
+	}
+	if at, err := time.ParseInLocation(scheduleDateLayout, spec, now.Location()); err == nil {
+		return Schedule{At: at}, nil
+	}
+	if at, err := time.Parse(time.RFC3339, spec); err == nil {
+		return Schedule{At: at}, nil
+	}
+	if from, until, ok := strings.Cut(spec, "-"); ok {
+		f, err1 := parseClock(from)
+		u, err2 := parseClock(until)
+		if err1 != nil || err2 != nil || f == u {
+			return Schedule{}, fmt.Errorf("invalid schedule window %q: want HH:MM-HH:MM", spec)
+		}
+		return Schedule{From: f, Until: u, window: true}, nil
+	}
+	clock, err := parseClock(spec)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: want HH:MM, \"YYYY-MM-DD HH:MM\" or HH:MM-HH:MM", spec)
+	}
+	at := midnight(now).Add(clock)
+	if !at.After(now) {
+		at = midnight(now.AddDate(0, 0, 1)).Add(clock)
+	}
+	return Schedule{At: at}, nil
+}
+
+// parseClock reads "HH:MM" as time since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// IsZero reports whether s starts downloads at once
+func (s Schedule) IsZero() bool {
+	return s.At.IsZero() && !s.window
+}
+
+// IsWindow reports whether s is a daily window
+func (s Schedule) IsWindow() bool {
+	return s.window
+}
+
+// Next returns when a download may start: now if s allows it already
+func (s Schedule) Next(now time.Time) time.Time {
+	if !s.window {
+		if s.At.After(now) {
+			return s.At
+		}
+		return now
+	}
+	if s.inWindow(now) {
+		return now
+	}
+	start := midnight(now).Add(s.From)
+	if !start.After(now) {
+		start = midnight(now.AddDate(0, 0, 1)).Add(s.From)
+	}
+	return start
+}
+
+// End returns when the window open at now closes, or the zero time if s is
+// not a window or it is closed at now
+func (s Schedule) End(now time.Time) time.Time {
+	if !s.window || !s.inWindow(now) {
+		return time.Time{}
+	}
+	end := midnight(now).Add(s.Until)
+	if !end.After(now) {
+		end = midnight(now.AddDate(0, 0, 1)).Add(s.Until)
+	}
+	return end
+}
+
+func (s Schedule) inWindow(now time.Time) bool {
+	clock := now.Sub(midnight(now))
+	if s.From < s.Until {
+		return clock >= s.From && clock < s.Until
+	}
+	return clock >= s.From || clock < s.Until // Spans midnight
+}
+
+// String writes s so that ParseSchedule reads it back, with the date of a
+// start time so it keeps its meaning on another day
+func (s Schedule) String() string {
+	switch {
+	case s.window:
+		return formatClock(s.From) + "-" + formatClock(s.Until)
+	case !s.At.IsZero():
+		return s.At.Local().Format(scheduleDateLayout)
+	}
+	return ""
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
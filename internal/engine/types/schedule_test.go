@@ -0,0 +1,93 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2025, 3, 10, 14, 30, 0, 0, time.Local)
+
+	s, err := ParseSchedule("", now)
+	if err != nil || !s.IsZero() {
+		t.Errorf("ParseSchedule(\"\") = %v, %v", s, err)
+	}
+
+	for spec, want := range map[string]time.Time{
+		"16:00":            time.Date(2025, 3, 10, 16, 0, 0, 0, time.Local),
+		"02:00":            time.Date(2025, 3, 11, 2, 0, 0, 0, time.Local), // Already past today
+		"14:30":            time.Date(2025, 3, 11, 14, 30, 0, 0, time.Local),
+		"2025-04-01 08:15": time.Date(2025, 4, 1, 8, 15, 0, 0, time.Local),
+	} {
+		s, err := ParseSchedule(spec, now)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", spec, err)
+			continue
+		}
+		if s.IsWindow() || !s.At.Equal(want) {
+			t.Errorf("ParseSchedule(%q) = %v, want %v", spec, s.At, want)
+		}
+		if !s.Next(now).Equal(want) {
+			t.Errorf("ParseSchedule(%q).Next = %v, want %v", spec, s.Next(now), want)
+		}
+		// String reads back as the same start, even on another day
+		again, err := ParseSchedule(s.String(), now.AddDate(0, 0, 3))
+		if err != nil || !again.At.Equal(want) {
+			t.Errorf("ParseSchedule(%q) = %v, %v, want %v", s.String(), again.At, err, want)
+		}
+	}
+
+	for _, bad := range []string{"25:00", "soon", "02:00-02:00", "01:00-", "2025-13-01 00:00"} {
+		if _, err := ParseSchedule(bad, now); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSchedule_Window(t *testing.T) {
+	day := func(h, m int) time.Time { return time.Date(2025, 3, 10, h, m, 0, 0, time.Local) }
+
+	s, err := ParseSchedule("01:00-06:30", day(12, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsWindow() || s.String() != "01:00-06:30" {
+		t.Fatalf("ParseSchedule = %+v (%q)", s, s.String())
+	}
+	if got := s.Next(day(12, 0)); !got.Equal(day(25, 0)) {
+		t.Errorf("Next after the window = %v, want tomorrow 01:00", got)
+	}
+	if got := s.Next(day(0, 30)); !got.Equal(day(1, 0)) {
+		t.Errorf("Next before the window = %v, want 01:00", got)
+	}
+	if got := s.Next(day(3, 0)); !got.Equal(day(3, 0)) {
+		t.Errorf("Next inside the window = %v, want now", got)
+	}
+	if got := s.End(day(3, 0)); !got.Equal(day(6, 30)) {
+		t.Errorf("End = %v, want 06:30", got)
+	}
+	if got := s.End(day(12, 0)); !got.IsZero() {
+		t.Errorf("End outside the window = %v, want zero", got)
+	}
+
+	// A window across midnight
+	s, err = ParseSchedule("22:00-02:00", day(12, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(day(23, 0)); !got.Equal(day(23, 0)) {
+		t.Errorf("Next before midnight = %v, want now", got)
+	}
+	if got := s.Next(day(1, 0)); !got.Equal(day(1, 0)) {
+		t.Errorf("Next after midnight = %v, want now", got)
+	}
+	if got := s.End(day(23, 0)); !got.Equal(day(26, 0)) {
+		t.Errorf("End before midnight = %v, want tomorrow 02:00", got)
+	}
+	if got := s.End(day(1, 0)); !got.Equal(day(2, 0)) {
+		t.Errorf("End after midnight = %v, want 02:00", got)
+	}
+	if got := s.Next(day(12, 0)); !got.Equal(day(22, 0)) {
+		t.Errorf("Next outside = %v, want 22:00", got)
+	}
+}
@@ -0,0 +1,278 @@
+package types
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DialTunnel opens a TCP connection to addr for protocols other than HTTP,
+// such as SSH. It goes through the proxy an HTTPS request to addr would use:
+// with CONNECT through an HTTP(S) proxy, or through a SOCKS5 one. Every
+// connection made, to addr or to the proxy, is checked with DialControl.
+// ctx bounds setting the connection up.
+func (r *RuntimeConfig) DialTunnel(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Control: r.DialControl}
+	var proxy *url.URL
+	if proxyFunc := r.ProxyFunc(); proxyFunc != nil {
+		var err error
+		if proxy, err = proxyFunc(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}}); err != nil {
+			return nil, err
+		}
+	}
+	if proxy == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr(proxy))
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", proxy.Redacted(), err)
+	}
+	// The handshakes below block on conn, so ctx ending cuts them short. Only
+	// once it has ended, so that a failure then is reported as ctx's.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+		if err = tlsConn.HandshakeContext(ctx); err == nil {
+			conn = tlsConn
+		}
+	}
+	if err == nil {
+		switch proxy.Scheme {
+		case "socks5", "socks5h":
+			err = r.socksConnect(ctx, conn, proxy, addr)
+		default:
+			var tunnel net.Conn
+			if tunnel, err = httpConnect(conn, proxy, addr); err == nil {
+				conn = tunnel
+			}
+		}
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("proxy %s: %w", proxy.Redacted(), err)
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// proxyAddr returns the host and port of proxy, with the scheme's default
+// port if it names none
+func proxyAddr(proxy *url.URL) string {
+	if proxy.Port() != "" {
+		return proxy.Host
+	}
+	port := "80"
+	switch proxy.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// httpConnect asks the HTTP proxy on conn to tunnel to addr. The returned
+// connection holds anything the proxy sent after its reply.
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		login := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+login)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection part of whose input was already read into r
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// SOCKS5 protocol values (RFC 1928, RFC 1929)
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksPasswordAuth = 2
+	socksNoMethod     = 0xff
+	socksConnect      = 1
+	socksIPv4         = 1
+	socksDomain       = 3
+	socksIPv6         = 4
+)
+
+// socksReplies are the meanings of SOCKS5 reply codes other than success
+var socksReplies = []string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socksConnect asks the SOCKS5 proxy on conn to connect to addr. socks5h
+// proxies are given the host name; with socks5 it is resolved here, and the
+// address is checked with CheckAddr.
+func (r *RuntimeConfig) socksConnect(ctx context.Context, conn net.Conn, proxy *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port in %q", addr)
+	}
+
+	methods := []byte{socksNoAuth}
+	if proxy.User != nil {
+		methods = []byte{socksNoAuth, socksPasswordAuth}
+	}
+	if _, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return errors.New("not a SOCKS5 proxy")
+	}
+	switch reply[1] {
+	case socksNoAuth:
+	case socksPasswordAuth:
+		if proxy.User == nil {
+			return errors.New("SOCKS5 proxy requires a login")
+		}
+		name := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(name) > 255 || len(password) > 255 {
+			return errors.New("SOCKS5 login too long")
+		}
+		login := append([]byte{1, byte(len(name))}, name...)
+		login = append(append(login, byte(len(password))), password...)
+		if _, err := conn.Write(login); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("SOCKS5 proxy rejected the login")
+		}
+	case socksNoMethod:
+		return errors.New("SOCKS5 proxy accepts none of the offered logins")
+	default:
+		return fmt.Errorf("SOCKS5 proxy chose unknown login method %d", reply[1])
+	}
+
+	req := []byte{socksVersion, socksConnect, 0}
+	ip, ipErr := netip.ParseAddr(host)
+	if ipErr != nil && proxy.Scheme == "socks5" {
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return err
+		}
+		if len(ips) == 0 {
+			return fmt.Errorf("no addresses for %s", host)
+		}
+		ip, ipErr = ips[0], nil
+	}
+	switch {
+	case ipErr != nil:
+		if len(host) > 255 {
+			return fmt.Errorf("host name too long: %s", host)
+		}
+		req = append(append(req, socksDomain, byte(len(host))), host...)
+	case ip.Unmap().Is4():
+		if err := r.CheckAddr(ip); err != nil {
+			return err
+		}
+		ip4 := ip.Unmap().As4()
+		req = append(append(req, socksIPv4), ip4[:]...)
+	default:
+		if err := r.CheckAddr(ip); err != nil {
+			return err
+		}
+		ip16 := ip.As16()
+		req = append(append(req, socksIPv6), ip16[:]...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		if int(head[1]) < len(socksReplies) && socksReplies[head[1]] != "" {
+			return fmt.Errorf("connecting to %s: %s", addr, socksReplies[head[1]])
+		}
+		return fmt.Errorf("connecting to %s: SOCKS5 error %d", addr, head[1])
+	}
+	// The address the proxy bound is of no use here
+	var skip int
+	switch head[3] {
+	case socksIPv4:
+		skip = 4
+	case socksIPv6:
+		skip = 16
+	case socksDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("SOCKS5 proxy sent unknown address type %d", head[3])
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(skip)+2)
+	return err
+}
@@ -0,0 +1,152 @@
+package types
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// serveOnce runs serve on the first connection to a local listener and
+// returns the listener's address
+func serveOnce(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+// readGreeting reads what a tunnel's far end sent first
+func readGreeting(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading through the tunnel: %v", err)
+	}
+	return line
+}
+
+func TestRuntimeConfig_DialTunnel_HTTPProxy(t *testing.T) {
+	var target, login string
+	proxy := serveOnce(t, func(conn net.Conn) {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		target, login = req.Host, req.Header.Get("Proxy-Authorization")
+		// The far end speaks first, in the same packet as the reply
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-test\r\n")
+	})
+
+	r := &RuntimeConfig{Proxy: "http://bob:secret@" + proxy}
+	conn, err := r.DialTunnel(context.Background(), "sftp.example.com:22")
+	if err != nil {
+		t.Fatalf("DialTunnel: %v", err)
+	}
+	defer conn.Close()
+	if got := readGreeting(t, conn); got != "SSH-2.0-test\r\n" {
+		t.Errorf("read %q through the tunnel", got)
+	}
+	if target != "sftp.example.com:22" || login != "Basic Ym9iOnNlY3JldA==" {
+		t.Errorf("proxy asked for %q with login %q", target, login)
+	}
+}
+
+func TestRuntimeConfig_DialTunnel_HTTPProxyRefuses(t *testing.T) {
+	proxy := serveOnce(t, func(conn net.Conn) {
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err == nil {
+			io.WriteString(conn, "HTTP/1.1 403 Forbidden\r\n\r\n")
+		}
+	})
+
+	r := &RuntimeConfig{Proxy: proxy}
+	if _, err := r.DialTunnel(context.Background(), "sftp.example.com:22"); err == nil {
+		t.Error("DialTunnel succeeded through a proxy refusing CONNECT")
+	}
+}
+
+func TestRuntimeConfig_DialTunnel_SOCKS5(t *testing.T) {
+	var target string
+	proxy := serveOnce(t, func(conn net.Conn) {
+		buf := make([]byte, 512)
+		// Greeting: the client offers the password login
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil || buf[3] != socksPasswordAuth {
+			return
+		}
+		conn.Write([]byte{socksVersion, socksPasswordAuth})
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		name := make([]byte, buf[1]+1)
+		io.ReadFull(conn, name)
+		password := make([]byte, name[len(name)-1])
+		io.ReadFull(conn, password)
+		if string(name[:len(name)-1]) != "bob" || string(password) != "secret" {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+		// Request for a host name, which socks5h leaves to the proxy
+		if _, err := io.ReadFull(conn, buf[:5]); err != nil || buf[3] != socksDomain {
+			return
+		}
+		host := make([]byte, int(buf[4])+2)
+		io.ReadFull(conn, host)
+		target = string(host[:len(host)-2])
+		conn.Write([]byte{socksVersion, 0, 0, socksIPv4, 10, 0, 0, 1, 0, 22})
+		io.WriteString(conn, "SSH-2.0-test\r\n")
+	})
+
+	r := &RuntimeConfig{Proxy: "socks5h://bob:secret@" + proxy}
+	conn, err := r.DialTunnel(context.Background(), "sftp.example.com:22")
+	if err != nil {
+		t.Fatalf("DialTunnel: %v", err)
+	}
+	defer conn.Close()
+	if got := readGreeting(t, conn); got != "SSH-2.0-test\r\n" {
+		t.Errorf("read %q through the tunnel", got)
+	}
+	if target != "sftp.example.com" {
+		t.Errorf("proxy asked for %q", target)
+	}
+}
+
+func TestRuntimeConfig_DialTunnel_Blocked(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	r := &RuntimeConfig{Proxy: ProxyNone, BlockPrivateNetworks: true}
+	if _, err := r.DialTunnel(context.Background(), ln.Addr().String()); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("DialTunnel to loopback = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestRuntimeConfig_DialTunnel_Canceled(t *testing.T) {
+	// A proxy that never answers holds the setup until ctx ends
+	proxy := serveOnce(t, func(conn net.Conn) { io.Copy(io.Discard, conn) })
+
+	r := &RuntimeConfig{Proxy: proxy}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := r.DialTunnel(ctx, "sftp.example.com:22"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DialTunnel = %v, want the deadline", err)
+	}
+}
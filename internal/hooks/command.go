@@ -0,0 +1,69 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// CommandTimeout bounds how long an --on-complete command may run. It is
+// longer than Timeout, as such commands often unpack or move large files.
+const CommandTimeout = time.Hour
+
+// Command runs a shell command line after a download, such as
+// `unzip {path} -d {dir}`. {path}, {dir}, {filename}, {url} and {id} are
+// replaced by those of ev, quoted for the shell, so names chosen by a remote
+// server cannot inject commands.
+func Command(ctx context.Context, command string, ev Event) error {
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	line := ExpandCommand(command, ev)
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", line)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", line)
+	}
+	cmd.Env = append(os.Environ(), "SURGE_EVENT="+ev.Event)
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+
+	err := cmd.Run()
+	if msg := strings.TrimSpace(output.String()); msg != "" {
+		utils.Debug("Command %q: %s", command, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("command %q failed: %w", command, err)
+	}
+	return nil
+}
+
+// ExpandCommand fills in the placeholders of command for ev
+func ExpandCommand(command string, ev Event) string {
+	return strings.NewReplacer(
+		"{path}", shellQuote(ev.Path),
+		"{dir}", shellQuote(filepath.Dir(ev.Path)),
+		"{filename}", shellQuote(ev.Filename),
+		"{url}", shellQuote(ev.URL),
+		"{id}", shellQuote(ev.ID),
+	).Replace(command)
+}
+
+// shellQuote quotes s as a single word for sh, or for cmd.exe on Windows
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		// cmd.exe has no escape for a double quote inside quotes; none can
+		// appear in a Windows path, so dropping them only affects URLs
+		return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,135 @@
+// Package hooks runs external programs at points of a download's life. No
+// scripting language is embedded: a hook is any executable, such as a shell
+// or Python script with a #! line. It receives the event as JSON on stdin
+// and may print a JSON Result on stdout to change what happens next.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Event names, also passed to hook programs in SURGE_EVENT
+const (
+	OnEnqueue  = "on_enqueue"  // Before a download is queued; may reject or route it
+	OnComplete = "on_complete" // After a download finished; may rename or move the file
+	OnError    = "on_error"    // After a download failed; the result is ignored
+)
+
+// Timeout bounds how long a hook program may run
+const Timeout = 10 * time.Second
+
+// ErrRejected is returned when an on_enqueue program turns a download down
+var ErrRejected = errors.New("rejected by on_enqueue hook")
+
+// Event describes what happened. Path is the output directory for
+// on_enqueue and the downloaded file otherwise.
+type Event struct {
+	Event    string   `json:"event"`
+	ID       string   `json:"id,omitempty"`
+	URL      string   `json:"url"`
+	Mirrors  []string `json:"mirrors,omitempty"`
+	Filename string   `json:"filename,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Size     int64    `json:"size,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Result is what a hook program may print. Empty fields change nothing.
+type Result struct {
+	Reject   string `json:"reject,omitempty"`   // on_enqueue: refuse the download with this reason
+	Filename string `json:"filename,omitempty"` // Save under this name instead
+	Path     string `json:"path,omitempty"`     // Save into this directory; relative paths are below the current one
+}
+
+// Run runs program with ev and returns its result. A program that prints
+// nothing returns an empty Result.
+func Run(ctx context.Context, program string, ev Event) (Result, error) {
+	input, err := json.Marshal(ev)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, program)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), "SURGE_EVENT="+ev.Event)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err = cmd.Run()
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		utils.Debug("Hook %s (%s): %s", program, ev.Event, msg)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("%s hook failed: %w", ev.Event, err)
+	}
+
+	var res Result
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		if err := json.Unmarshal(out, &res); err != nil {
+			return Result{}, fmt.Errorf("%s hook printed invalid JSON: %w", ev.Event, err)
+		}
+	}
+	if strings.ContainsAny(res.Filename, `/\`) || res.Filename == "." || res.Filename == ".." {
+		return Result{}, fmt.Errorf("%s hook returned invalid filename %q", ev.Event, res.Filename)
+	}
+	return res, nil
+}
+
+// Enqueue runs the on_enqueue program, if any, and returns ev with the
+// program's filename and directory applied. A rejection wraps ErrRejected.
+// Programs that fail also reject the download, so a broken policy program
+// does not silently let everything through.
+func Enqueue(program string, ev Event) (Event, error) {
+	if program == "" {
+		return ev, nil
+	}
+	ev.Event = OnEnqueue
+	res, err := Run(context.Background(), program, ev)
+	if err != nil {
+		return ev, err
+	}
+	if res.Reject != "" {
+		return ev, fmt.Errorf("%w: %s", ErrRejected, res.Reject)
+	}
+	if res.Filename != "" {
+		ev.Filename = res.Filename
+	}
+	if res.Path != "" {
+		ev.Path = resolveDir(ev.Path, res.Path)
+	}
+	return ev, nil
+}
+
+// resolveDir returns dir, or dir below base if it is relative
+func resolveDir(base, dir string) string {
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(base, dir)
+}
+
+// Destination returns where a completed file at path should end up
+// according to res, which is path itself if res changes nothing
+func Destination(path string, res Result) string {
+	dir, name := filepath.Split(path)
+	if res.Path != "" {
+		dir = resolveDir(dir, res.Path)
+	}
+	if res.Filename != "" {
+		name = res.Filename
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,117 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeScript writes an executable shell script with body and returns its path
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnqueue(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "downloads")
+	ev := Event{URL: "https://example.com/movie.mkv", Filename: "movie.mkv", Path: base}
+
+	tests := []struct {
+		name         string
+		script       string
+		wantRejected bool
+		wantErr      bool
+		wantFilename string
+		wantPath     string
+	}{
+		{"no output", `cat > /dev/null`, false, false, "movie.mkv", base},
+		{"reject", `grep -q example.com && echo '{"reject": "no example.com"}'`, true, true, "", ""},
+		{"rename", `echo '{"filename": "renamed.mkv"}'`, false, false, "renamed.mkv", base},
+		{"route relative", `echo '{"path": "Videos"}'`, false, false, "movie.mkv", filepath.Join(base, "Videos")},
+		{"route absolute", `echo '{"path": "/srv/media"}'`, false, false, "movie.mkv", "/srv/media"},
+		{"event name", `[ "$SURGE_EVENT" = on_enqueue ] || echo '{"reject": "wrong event"}'`, false, false, "movie.mkv", base},
+		{"failing script", `exit 1`, false, true, "", ""},
+		{"invalid JSON", `echo nope`, false, true, "", ""},
+		{"filename with separator", `echo '{"filename": "../escape"}'`, false, true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Enqueue(writeScript(t, tt.script), ev)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Enqueue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrRejected) != tt.wantRejected {
+				t.Errorf("Enqueue() error = %v, want rejected %v", err, tt.wantRejected)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Filename != tt.wantFilename || got.Path != tt.wantPath {
+				t.Errorf("Enqueue() = %q in %q, want %q in %q", got.Filename, got.Path, tt.wantFilename, tt.wantPath)
+			}
+		})
+	}
+
+	// Without a script the event passes through untouched
+	if got, err := Enqueue("", ev); err != nil || got.Path != base {
+		t.Errorf("Enqueue without script = %+v, %v", got, err)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	path := filepath.Join("/data", "movie.mkv")
+	tests := []struct {
+		res  Result
+		want string
+	}{
+		{Result{}, path},
+		{Result{Filename: "film.mkv"}, filepath.Join("/data", "film.mkv")},
+		{Result{Path: "Videos"}, filepath.Join("/data", "Videos", "movie.mkv")},
+		{Result{Path: "/srv", Filename: "film.mkv"}, filepath.Join("/srv", "film.mkv")},
+	}
+	for _, tt := range tests {
+		if got := Destination(path, tt.res); got != tt.want {
+			t.Errorf("Destination(%+v) = %q, want %q", tt.res, got, tt.want)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command tests use sh")
+	}
+	dir := t.TempDir()
+	ev := Event{
+		Event:    OnComplete,
+		ID:       "abc",
+		URL:      "https://example.com/a.zip",
+		Filename: "it's $(touch pwned).zip",
+		Path:     filepath.Join(dir, "it's $(touch pwned).zip"),
+	}
+	out := filepath.Join(dir, "out.txt")
+	if err := Command(context.Background(), `printf '%s|%s|%s' {filename} {id} "$SURGE_EVENT" > `+out, ev); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	if want := ev.Filename + "|abc|on_complete"; string(got) != want {
+		t.Errorf("command wrote %q, want %q", got, want)
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		os.Remove("pwned")
+		t.Error("a file name was run as a command")
+	}
+
+	if err := Command(context.Background(), "exit 3", ev); err == nil {
+		t.Error("a failing command should return an error")
+	}
+}
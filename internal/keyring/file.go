@@ -0,0 +1,187 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// EnvPassphrase holds the passphrase of the secrets file, which is used when
+// the OS credential store is not available (e.g. on a headless server)
+const EnvPassphrase = "SURGE_KEYRING_PASSPHRASE"
+
+// fileIterations is the PBKDF2-SHA256 work factor; tests lower it
+var fileIterations = 600_000
+
+var (
+	fileMu   sync.Mutex
+	filePath string
+
+	// The derived key, kept so that every lookup does not pay for PBKDF2
+	keyPassphrase string
+	keySalt       []byte
+	key           []byte
+)
+
+// ConfigureFile sets where secrets are kept when the OS store is not
+// available. Without it, or without a passphrase in SURGE_KEYRING_PASSPHRASE,
+// there is no fallback.
+func ConfigureFile(path string) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	filePath = path
+}
+
+// secretsFile is the JSON on disk: the secrets, sealed with AES-256-GCM under
+// a key derived from the passphrase and Salt
+type secretsFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// fileEnabled reports whether the secrets file can be used
+func fileEnabled() bool {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	return filePath != "" && os.Getenv(EnvPassphrase) != ""
+}
+
+func fileSet(name, secret string) error {
+	return updateFile(func(secrets map[string]string) bool {
+		secrets[name] = secret
+		return true
+	})
+}
+
+func fileGet(name string) (string, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	secrets, _, err := readFile()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+func fileRemove(name string) error {
+	return updateFile(func(secrets map[string]string) bool {
+		_, ok := secrets[name]
+		delete(secrets, name)
+		return ok
+	})
+}
+
+// updateFile applies change to the stored secrets and writes them back if it
+// reports a change
+func updateFile(change func(map[string]string) bool) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	secrets, salt, err := readFile()
+	if err != nil {
+		return err
+	}
+	if !change(secrets) {
+		return nil
+	}
+	return writeFile(secrets, salt)
+}
+
+// readFile opens the secrets file. A missing file holds no secrets and gets
+// a fresh salt.
+func readFile() (map[string]string, []byte, error) {
+	secrets := make(map[string]string)
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		return secrets, salt, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var f secretsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("secrets file %s: %w", filePath, err)
+	}
+	gcm, err := fileCipher(f.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("secrets file %s: wrong passphrase in %s, or the file is damaged", filePath, EnvPassphrase)
+	}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, nil, fmt.Errorf("secrets file %s: %w", filePath, err)
+	}
+	return secrets, f.Salt, nil
+}
+
+// writeFile seals secrets and replaces the file with them, readable only by
+// the user
+func writeFile(secrets map[string]string, salt []byte) error {
+	gcm, err := fileCipher(salt)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	f := secretsFile{Salt: salt, Nonce: make([]byte, gcm.NonceSize())}
+	rand.Read(f.Nonce)
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".secrets-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// fileCipher returns the AES-GCM cipher for the passphrase and salt
+func fileCipher(salt []byte) (cipher.AEAD, error) {
+	passphrase := os.Getenv(EnvPassphrase)
+	if key == nil || passphrase != keyPassphrase || string(salt) != string(keySalt) {
+		k, err := pbkdf2.Key(sha256.New, passphrase, salt, fileIterations, 32)
+		if err != nil {
+			return nil, err
+		}
+		key, keyPassphrase, keySalt = k, passphrase, salt
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,112 @@
+// Package keyring keeps secrets in the operating system's credential store:
+// the Secret Service (GNOME Keyring, KWallet) on Linux and the BSDs, the
+// login keychain on macOS and Credential Manager on Windows. Secrets are
+// stored for the current user under the "surge" service and a name.
+//
+// Where there is no credential store, such as on a headless server, secrets
+// go to a file encrypted with the passphrase in SURGE_KEYRING_PASSPHRASE; see
+// ConfigureFile.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// service groups Surge's secrets in the credential store
+const service = "surge"
+
+// ErrNotFound is returned by Get when no secret has the name
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// osStore is the platform credential store; tests replace it
+var osStore = struct {
+	set    func(name, secret string) error
+	get    func(name string) (string, error)
+	remove func(name string) error
+}{set, get, remove}
+
+// Set stores secret under name, replacing any secret it had. It goes to the
+// secrets file if the credential store fails and the file is set up.
+func Set(name, secret string) error {
+	forget(name)
+	err := osStore.set(name, secret)
+	if err == nil {
+		return nil
+	}
+	if !fileEnabled() {
+		return fmt.Errorf("%w (set %s to keep secrets in an encrypted file instead)", err, EnvPassphrase)
+	}
+	return fileSet(name, secret)
+}
+
+// Get returns the secret stored under name, looking in the secrets file if
+// the credential store does not have it
+func Get(name string) (string, error) {
+	secret, err := osStore.get(name)
+	if err == nil || !fileEnabled() {
+		return secret, err
+	}
+	return fileGet(name)
+}
+
+// Delete removes the secret stored under name. Deleting a secret that does
+// not exist is not an error.
+func Delete(name string) error {
+	forget(name)
+	err := osStore.remove(name)
+	if !fileEnabled() {
+		return err
+	}
+	if ferr := fileRemove(name); ferr != nil {
+		return ferr
+	}
+	return nil // The file may be where the secret was all along
+}
+
+// RefPrefix marks a settings value as a reference to a secret: "keyring:proxy"
+// stands for the secret stored under "proxy"
+const RefPrefix = "keyring:"
+
+// IsRef reports whether value refers to a secret
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// resolveTTL is how long Resolve trusts a secret it looked up, so that
+// settings read for every request do not hit the credential store each time
+const resolveTTL = time.Minute
+
+var resolved sync.Map // name -> resolvedSecret
+
+type resolvedSecret struct {
+	secret  string
+	fetched time.Time
+}
+
+func forget(name string) {
+	resolved.Delete(name)
+}
+
+// Resolve returns value, or the secret it names if it is a reference
+func Resolve(value string) (string, error) {
+	name, ok := strings.CutPrefix(value, RefPrefix)
+	if !ok {
+		return value, nil
+	}
+	if name == "" {
+		return "", errors.New("keyring reference without a name")
+	}
+	if r, ok := resolved.Load(name); ok && time.Since(r.(resolvedSecret).fetched) < resolveTTL {
+		return r.(resolvedSecret).secret, nil
+	}
+	secret, err := Get(name)
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %w", name, err)
+	}
+	resolved.Store(name, resolvedSecret{secret: secret, fetched: time.Now()})
+	return secret, nil
+}
@@ -0,0 +1,48 @@
+//go:build linux || freebsd || openbsd || netbsd || dragonfly
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretTool runs secret-tool, from libsecret, against the Secret Service
+func secretTool(stdin string, args ...string) (string, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return "", errors.New("the keyring needs secret-tool (libsecret) installed")
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return "", fmt.Errorf("secret-tool: %s", strings.TrimSpace(stderr.String()))
+	}
+	return string(out), err
+}
+
+func set(name, secret string) error {
+	_, err := secretTool(secret, "store", "--label", "Surge: "+name, "service", service, "account", name)
+	return err
+}
+
+func get(name string) (string, error) {
+	out, err := secretTool("", "lookup", "service", service, "account", name)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) || (err == nil && out == "") {
+		// secret-tool exits with 1 and prints nothing for a missing secret
+		return "", ErrNotFound
+	}
+	return out, err
+}
+
+func remove(name string) error {
+	_, err := secretTool("", "clear", "service", service, "account", name)
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !freebsd && !openbsd && !netbsd && !dragonfly && !darwin && !windows
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+var errNoKeyring = fmt.Errorf("keyring on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+
+func set(string, string) error { return errNoKeyring }
+
+func get(string) (string, error) { return "", errNoKeyring }
+
+func remove(string) error { return errNoKeyring }
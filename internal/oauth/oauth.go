@@ -0,0 +1,395 @@
+// Package oauth signs downloads from APIs such as Google Drive and OneDrive
+// in with OAuth 2.0. Login runs the device authorization flow (RFC 8628):
+// the user approves Surge in a browser on any device, passing whatever
+// two-factor check their account has, and the refresh token is kept in the
+// OS keyring. Requests to the provider's hosts then carry an access token,
+// refreshed as it expires.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/keyring"
+)
+
+// ErrNotLoggedIn is returned for providers without a stored refresh token
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// presets fill in what settings leave out for well-known providers
+var presets = map[string]config.OAuthProvider{
+	"google": {
+		DeviceAuthURL: "https://oauth2.googleapis.com/device/code",
+		TokenURL:      "https://oauth2.googleapis.com/token",
+		Scopes:        []string{"https://www.googleapis.com/auth/drive.readonly"},
+		Hosts:         []string{"www.googleapis.com"},
+	},
+	"microsoft": {
+		DeviceAuthURL: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+		TokenURL:      "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		Scopes:        []string{"Files.Read.All", "offline_access"},
+		Hosts:         []string{"graph.microsoft.com"},
+	},
+}
+
+// secrets holds refresh tokens; tests replace the keyring
+var secrets = struct {
+	get func(name string) (string, error)
+	set func(name, secret string) error
+	del func(name string) error
+}{keyring.Get, keyring.Set, keyring.Delete}
+
+// pollUnit is the unit of the polling interval servers give; tests shorten it
+var pollUnit = time.Second
+
+// client makes the token requests
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Find returns the provider called name in providers, completed from its
+// preset
+func Find(providers []config.OAuthProvider, name string) (config.OAuthProvider, error) {
+	for _, p := range providers {
+		if strings.EqualFold(p.Name, name) {
+			return complete(p)
+		}
+	}
+	return config.OAuthProvider{}, fmt.Errorf("no OAuth provider %q in settings (connections.oauth)", name)
+}
+
+// complete fills in p's blanks from the preset of its name and checks that
+// a flow can run
+func complete(p config.OAuthProvider) (config.OAuthProvider, error) {
+	preset := presets[strings.ToLower(p.Name)]
+	if p.DeviceAuthURL == "" {
+		p.DeviceAuthURL = preset.DeviceAuthURL
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = preset.TokenURL
+	}
+	if len(p.Scopes) == 0 {
+		p.Scopes = preset.Scopes
+	}
+	if len(p.Hosts) == 0 {
+		p.Hosts = preset.Hosts
+	}
+	switch {
+	case p.Name == "":
+		return p, errors.New("OAuth provider without a name")
+	case p.ClientID == "":
+		return p, fmt.Errorf("OAuth provider %q has no client_id", p.Name)
+	case p.DeviceAuthURL == "" || p.TokenURL == "":
+		return p, fmt.Errorf("OAuth provider %q needs device_auth_url and token_url", p.Name)
+	}
+	return p, nil
+}
+
+// secretName is the keyring entry of a provider's refresh token
+func secretName(provider string) string {
+	return "oauth/" + strings.ToLower(provider)
+}
+
+// DeviceCode is what the user enters to approve Surge
+type DeviceCode struct {
+	UserCode        string
+	VerificationURL string
+	Expires         time.Time
+}
+
+// tokenResponse is a token endpoint's answer, successful or not
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (t *tokenResponse) err() error {
+	if t.ErrorDescription != "" {
+		return fmt.Errorf("%s: %s", t.Error, t.ErrorDescription)
+	}
+	return errors.New(t.Error)
+}
+
+// Login runs the device flow for p: prompt shows the user the code, then
+// Login waits until they approve Surge, deny it, or the code expires, and
+// keeps the refresh token in the keyring
+func Login(ctx context.Context, p config.OAuthProvider, prompt func(DeviceCode)) error {
+	p, err := complete(p)
+	if err != nil {
+		return err
+	}
+	if p.ClientSecret, err = keyring.Resolve(p.ClientSecret); err != nil {
+		return fmt.Errorf("client secret: %w", err)
+	}
+	var device struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURL         string `json:"verification_url"` // Google's name for it
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+	if err := post(ctx, p.DeviceAuthURL, form(p, url.Values{"scope": {strings.Join(p.Scopes, " ")}}), &device); err != nil {
+		return fmt.Errorf("requesting a device code: %w", err)
+	}
+	if device.DeviceCode == "" || device.UserCode == "" {
+		return errors.New("requesting a device code: no code in the answer")
+	}
+	prompt(DeviceCode{
+		UserCode:        device.UserCode,
+		VerificationURL: firstNonEmpty(device.VerificationURIComplete, device.VerificationURI, device.VerificationURL),
+		Expires:         time.Now().Add(time.Duration(device.ExpiresIn) * time.Second),
+	})
+
+	interval := time.Duration(max(device.Interval, 5)) * pollUnit
+	if device.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(device.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for approval: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+		var tok tokenResponse
+		err := post(ctx, p.TokenURL, form(p, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {device.DeviceCode},
+		}), &tok)
+		switch {
+		case tok.Error == "authorization_pending":
+			continue
+		case tok.Error == "slow_down":
+			interval += 5 * pollUnit
+			continue
+		case tok.Error != "":
+			return tok.err()
+		case err != nil:
+			return err
+		case tok.RefreshToken == "":
+			return errors.New("the provider gave no refresh token; does the scope ask for offline access?")
+		}
+		if err := secrets.set(secretName(p.Name), tok.RefreshToken); err != nil {
+			return fmt.Errorf("storing the refresh token: %w", err)
+		}
+		tokens.put(p.Name, tok)
+		return nil
+	}
+}
+
+// Logout forgets the refresh token of provider
+func Logout(provider string) error {
+	tokens.drop(provider)
+	return secrets.del(secretName(provider))
+}
+
+// AccessToken returns an access token for p, using the refresh token in the
+// keyring once the last one is about to expire
+func AccessToken(ctx context.Context, p config.OAuthProvider) (string, error) {
+	if access, ok := tokens.get(p.Name); ok {
+		return tokenOrNotLoggedIn(access)
+	}
+	tokens.refreshMu.Lock()
+	defer tokens.refreshMu.Unlock()
+	if access, ok := tokens.get(p.Name); ok {
+		return tokenOrNotLoggedIn(access) // Refreshed while we waited
+	}
+
+	refresh, err := secrets.get(secretName(p.Name))
+	if errors.Is(err, keyring.ErrNotFound) {
+		tokens.notLoggedIn(p.Name)
+		return "", ErrNotLoggedIn
+	}
+	if err != nil {
+		return "", err
+	}
+	if p.ClientSecret, err = keyring.Resolve(p.ClientSecret); err != nil {
+		return "", fmt.Errorf("client secret: %w", err)
+	}
+	var tok tokenResponse
+	err = post(ctx, p.TokenURL, form(p, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refresh},
+	}), &tok)
+	if tok.Error != "" {
+		if tok.Error == "invalid_grant" {
+			return "", fmt.Errorf("%s login expired or was revoked; run 'surge auth login %s' again", p.Name, p.Name)
+		}
+		return "", tok.err()
+	}
+	if err != nil {
+		return "", err
+	}
+	if tok.RefreshToken != "" && tok.RefreshToken != refresh {
+		// Microsoft rotates refresh tokens
+		if err := secrets.set(secretName(p.Name), tok.RefreshToken); err != nil {
+			return "", fmt.Errorf("storing the refresh token: %w", err)
+		}
+	}
+	tokens.put(p.Name, tok)
+	return tok.AccessToken, nil
+}
+
+func tokenOrNotLoggedIn(access string) (string, error) {
+	if access == "" {
+		return "", ErrNotLoggedIn
+	}
+	return access, nil
+}
+
+// form adds p's client credentials to the body of a call to its endpoints
+func form(p config.OAuthProvider, v url.Values) url.Values {
+	v.Set("client_id", p.ClientID)
+	if p.ClientSecret != "" {
+		v.Set("client_secret", p.ClientSecret)
+	}
+	return v
+}
+
+// post sends form to endpoint and decodes the JSON answer into out. Error
+// answers of the token endpoint are decoded too, as the flow depends on them.
+func post(ctx context.Context, endpoint string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decodeErr := json.NewDecoder(resp.Body).Decode(out)
+	if resp.StatusCode != http.StatusOK {
+		return types.NewHTTPError(endpoint, resp)
+	}
+	return decodeErr
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// notLoggedInTTL is how long a provider without a refresh token is not
+// looked up again, so the keyring is not asked on every request
+const notLoggedInTTL = time.Minute
+
+// expiryMargin renews access tokens this long before they expire, so none
+// runs out in flight
+const expiryMargin = time.Minute
+
+// tokenCache holds access tokens by provider for the life of the process
+type tokenCache struct {
+	mu        sync.Mutex
+	refreshMu sync.Mutex // One refresh at a time
+	access    map[string]cachedToken
+}
+
+type cachedToken struct {
+	access  string // Empty when not logged in
+	expires time.Time
+}
+
+var tokens = &tokenCache{access: make(map[string]cachedToken)}
+
+// get returns a cached token of provider that is still good. ok is also
+// true, with an empty token, while provider is known not to be logged in.
+func (c *tokenCache) get(provider string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.access[strings.ToLower(provider)]
+	return t.access, ok && time.Now().Before(t.expires)
+}
+
+func (c *tokenCache) put(provider string, tok tokenResponse) {
+	expiresIn := time.Duration(tok.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	c.mu.Lock()
+	c.access[strings.ToLower(provider)] = cachedToken{access: tok.AccessToken, expires: time.Now().Add(max(expiresIn-expiryMargin, expiresIn/2))}
+	c.mu.Unlock()
+}
+
+func (c *tokenCache) notLoggedIn(provider string) {
+	c.mu.Lock()
+	c.access[strings.ToLower(provider)] = cachedToken{expires: time.Now().Add(notLoggedInTTL)}
+	c.mu.Unlock()
+}
+
+func (c *tokenCache) drop(provider string) {
+	c.mu.Lock()
+	delete(c.access, strings.ToLower(provider))
+	c.mu.Unlock()
+}
+
+// Authorizer sends access tokens to the hosts of the providers the user
+// logged in to. Requests already carrying an Authorization header, such as
+// one given with --bearer, are left alone.
+type Authorizer struct {
+	providers []config.OAuthProvider
+}
+
+// NewAuthorizer returns an Authorizer for providers, or nil if there are
+// none. Providers missing a client ID or endpoints are skipped.
+func NewAuthorizer(providers []config.OAuthProvider) types.Authorizer {
+	var a Authorizer
+	for _, p := range providers {
+		if p, err := complete(p); err == nil && len(p.Hosts) > 0 {
+			a.providers = append(a.providers, p)
+		}
+	}
+	if len(a.providers) == 0 {
+		return nil
+	}
+	return &a
+}
+
+// Authorize adds a bearer token to req if its host belongs to a provider
+// the user logged in to
+func (a *Authorizer) Authorize(req *http.Request) error {
+	if req.Header.Get("Authorization") != "" {
+		return nil
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	for _, p := range a.providers {
+		if !slices.ContainsFunc(p.Hosts, func(h string) bool {
+			h = strings.ToLower(h)
+			return host == h || strings.HasSuffix(host, "."+h)
+		}) {
+			continue
+		}
+		access, err := AccessToken(req.Context(), p)
+		if errors.Is(err, ErrNotLoggedIn) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("signing in to %s: %w", p.Name, err)
+		}
+		if access != "" {
+			req.Header.Set("Authorization", "Bearer "+access)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/keyring"
+)
+
+// fakeKeyring replaces the OS keyring for a test
+func fakeKeyring(t *testing.T) map[string]string {
+	t.Helper()
+	var mu sync.Mutex
+	stored := make(map[string]string)
+	old, oldUnit, oldTokens := secrets, pollUnit, tokens
+	secrets.get = func(name string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if s, ok := stored[name]; ok {
+			return s, nil
+		}
+		return "", keyring.ErrNotFound
+	}
+	secrets.set = func(name, secret string) error {
+		mu.Lock()
+		stored[name] = secret
+		mu.Unlock()
+		return nil
+	}
+	secrets.del = func(name string) error {
+		mu.Lock()
+		delete(stored, name)
+		mu.Unlock()
+		return nil
+	}
+	pollUnit = time.Millisecond
+	tokens = &tokenCache{access: make(map[string]cachedToken)}
+	t.Cleanup(func() { secrets, pollUnit, tokens = old, oldUnit, oldTokens })
+	return stored
+}
+
+// fakeProvider is an OAuth server that approves the device code after a few
+// polls and hands out numbered access tokens
+func fakeProvider(t *testing.T) (config.OAuthProvider, *int) {
+	t.Helper()
+	polls, refreshes := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_id") != "cid" || r.Form.Get("client_secret") != "csecret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		answer := func(status int, v map[string]any) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(v)
+		}
+		switch {
+		case r.URL.Path == "/device":
+			if r.Form.Get("scope") != "files offline" {
+				t.Errorf("scope = %q", r.Form.Get("scope"))
+			}
+			answer(http.StatusOK, map[string]any{"device_code": "dev", "user_code": "ABCD-EFGH", "verification_uri": "https://example.com/device", "expires_in": 600, "interval": 1})
+		case r.Form.Get("grant_type") == "urn:ietf:params:oauth:grant-type:device_code":
+			polls++
+			switch polls {
+			case 1, 2:
+				answer(http.StatusBadRequest, map[string]any{"error": "authorization_pending"})
+			case 3:
+				answer(http.StatusBadRequest, map[string]any{"error": "slow_down"})
+			default:
+				answer(http.StatusOK, map[string]any{"access_token": "access-0", "refresh_token": "refresh-0", "expires_in": 3600})
+			}
+		case r.Form.Get("grant_type") == "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh-"+strconv.Itoa(refreshes) {
+				answer(http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+				return
+			}
+			refreshes++
+			answer(http.StatusOK, map[string]any{"access_token": "access-" + strconv.Itoa(refreshes), "refresh_token": "refresh-" + strconv.Itoa(refreshes), "expires_in": 3600})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return config.OAuthProvider{
+		Name:          "drive",
+		ClientID:      "cid",
+		ClientSecret:  "csecret",
+		DeviceAuthURL: server.URL + "/device",
+		TokenURL:      server.URL + "/token",
+		Scopes:        []string{"files", "offline"},
+		Hosts:         []string{"api.example.com"},
+	}, &polls
+}
+
+func TestLogin_DeviceFlow(t *testing.T) {
+	stored := fakeKeyring(t)
+	p, polls := fakeProvider(t)
+
+	var shown DeviceCode
+	if err := Login(context.Background(), p, func(c DeviceCode) { shown = c }); err != nil {
+		t.Fatal(err)
+	}
+	if shown.UserCode != "ABCD-EFGH" || shown.VerificationURL != "https://example.com/device" || time.Until(shown.Expires) < 9*time.Minute {
+		t.Errorf("prompt got %+v", shown)
+	}
+	if *polls != 4 {
+		t.Errorf("polled %d times, want 4", *polls)
+	}
+	if stored["oauth/drive"] != "refresh-0" {
+		t.Errorf("keyring holds %v, want the refresh token", stored)
+	}
+	if access, err := AccessToken(context.Background(), p); err != nil || access != "access-0" {
+		t.Errorf("AccessToken after login = %q, %v", access, err)
+	}
+}
+
+func TestLogin_Denied(t *testing.T) {
+	fakeKeyring(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/device" {
+			json.NewEncoder(w).Encode(map[string]any{"device_code": "dev", "user_code": "X", "verification_uri": "https://example.com"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": "access_denied", "error_description": "user said no"})
+	}))
+	defer server.Close()
+
+	p := config.OAuthProvider{Name: "x", ClientID: "cid", DeviceAuthURL: server.URL + "/device", TokenURL: server.URL + "/token"}
+	if err := Login(context.Background(), p, func(DeviceCode) {}); err == nil || err.Error() != "access_denied: user said no" {
+		t.Errorf("Login = %v, want the denial", err)
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	stored := fakeKeyring(t)
+	p, _ := fakeProvider(t)
+	a := NewAuthorizer([]config.OAuthProvider{p, {Name: "incomplete"}})
+
+	authorization := func(rawurl string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, rawurl, nil)
+		if err := a.Authorize(req); err != nil {
+			t.Fatalf("Authorize(%s): %v", rawurl, err)
+		}
+		return req.Header.Get("Authorization")
+	}
+
+	// Not logged in: requests go out as they are
+	if got := authorization("https://api.example.com/f"); got != "" {
+		t.Errorf("before login: Authorization = %q", got)
+	}
+
+	// Logged in: the stored refresh token gets an access token, and the
+	// rotated refresh token replaces it
+	stored["oauth/drive"] = "refresh-0"
+	tokens.drop("drive")
+	if got := authorization("https://files.api.example.com/f"); got != "Bearer access-1" {
+		t.Errorf("Authorization = %q, want Bearer access-1", got)
+	}
+	if stored["oauth/drive"] != "refresh-1" {
+		t.Errorf("rotated refresh token not stored: %v", stored)
+	}
+	if got := authorization("https://other.example.com/f"); got != "" {
+		t.Errorf("other host got Authorization %q", got)
+	}
+
+	// An expired access token is refreshed
+	tokens.access["drive"] = cachedToken{access: "access-1", expires: time.Now().Add(-time.Second)}
+	if got := authorization("https://api.example.com/f"); got != "Bearer access-2" {
+		t.Errorf("after expiry: Authorization = %q, want Bearer access-2", got)
+	}
+
+	// An explicit Authorization header wins
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/f", nil)
+	req.Header.Set("Authorization", "Bearer mine")
+	a.Authorize(req)
+	if got := req.Header.Get("Authorization"); got != "Bearer mine" {
+		t.Errorf("explicit header replaced with %q", got)
+	}
+
+	if NewAuthorizer(nil) != nil || NewAuthorizer([]config.OAuthProvider{{Name: "google"}}) != nil {
+		t.Error("NewAuthorizer without usable providers is not nil")
+	}
+}
+
+func TestFind_Presets(t *testing.T) {
+	providers := []config.OAuthProvider{{Name: "Google", ClientID: "cid"}, {Name: "custom", ClientID: "cid"}}
+	p, err := Find(providers, "google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TokenURL != presets["google"].TokenURL || len(p.Hosts) == 0 || len(p.Scopes) == 0 {
+		t.Errorf("google preset not applied: %+v", p)
+	}
+	if _, err := Find(providers, "custom"); err == nil {
+		t.Error("provider without endpoints accepted")
+	}
+	if _, err := Find(providers, "dropbox"); err == nil {
+		t.Error("unknown provider found")
+	}
+}
@@ -0,0 +1,492 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// Packet tags (RFC 9580 section 5)
+const (
+	tagSignature     = 2
+	tagPublicKey     = 6
+	tagUserID        = 13
+	tagSubkey        = 14
+	tagUserAttribute = 17
+)
+
+// Signature types (RFC 9580 section 5.2.1)
+const (
+	sigBinary           = 0x00
+	sigText             = 0x01
+	sigCertGeneric      = 0x10 // Certifications of a user ID, 0x10 to 0x13
+	sigCertPositive     = 0x13
+	sigSubkeyBinding    = 0x18
+	sigPrimaryBinding   = 0x19
+	sigDirectKey        = 0x1f
+	sigKeyRevocation    = 0x20
+	sigSubkeyRevocation = 0x28
+)
+
+// keyFlagSign is the key flag of keys that may sign data
+const keyFlagSign = 0x02
+
+// Reasons for revocation after which a key's earlier signatures still hold
+const (
+	reasonSuperseded = 1
+	reasonRetired    = 3
+)
+
+// Public key algorithms
+const (
+	algoRSA     = 1
+	algoRSASign = 3
+	algoECDSA   = 19
+	algoEdDSA   = 22 // Legacy EdDSA, with a curve OID
+	algoEd25519 = 27
+)
+
+// Curve OIDs, without their length byte
+var (
+	oidP256    = []byte{0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+	oidP384    = []byte{0x2b, 0x81, 0x04, 0x00, 0x22}
+	oidP521    = []byte{0x2b, 0x81, 0x04, 0x00, 0x23}
+	oidEd25519 = []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}
+)
+
+// errTruncated is returned for packets that end before their fields do
+var errTruncated = errors.New("truncated OpenPGP data")
+
+// packet is one OpenPGP packet
+type packet struct {
+	tag  byte
+	body []byte
+}
+
+// dearmor returns the binary form of data, decoding it if it is ASCII armored
+// ("-----BEGIN PGP ..."). Only the first armored block is read.
+func dearmor(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if !bytes.HasPrefix(trimmed, []byte("-----BEGIN PGP ")) {
+		return data, nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(trimmed), "\n")[1:] {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "-----END PGP ") {
+			break
+		}
+		lines = append(lines, line)
+	}
+	// Armor headers ("Comment: ...") end at a blank line
+	if i := slices.Index(lines, ""); i >= 0 && !slices.ContainsFunc(lines[:i], func(l string) bool { return !strings.Contains(l, ":") }) {
+		lines = lines[i+1:]
+	}
+	var body strings.Builder
+	var crc string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "=") && len(line) == 5 {
+			crc = line[1:]
+			continue
+		}
+		body.WriteString(line)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return nil, fmt.Errorf("bad armor: %w", err)
+	}
+	if crc != "" {
+		want, err := base64.StdEncoding.DecodeString(crc)
+		if err != nil || len(want) != 3 {
+			return nil, errors.New("bad armor checksum")
+		}
+		sum := crc24(decoded)
+		if want[0] != byte(sum>>16) || want[1] != byte(sum>>8) || want[2] != byte(sum) {
+			return nil, errors.New("armor checksum mismatch")
+		}
+	}
+	return decoded, nil
+}
+
+// crc24 is the armor checksum (RFC 9580 section 6.1)
+func crc24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for range 8 {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+// readPackets splits binary OpenPGP data into packets. Partial body lengths
+// are only used by data packets, which keys and detached signatures lack.
+func readPackets(data []byte) ([]packet, error) {
+	var packets []packet
+	for len(data) > 0 {
+		header := data[0]
+		if header&0x80 == 0 {
+			return nil, errors.New("not OpenPGP data")
+		}
+		var tag byte
+		var length, skip int
+		if header&0x40 != 0 {
+			// New format
+			tag = header & 0x3f
+			if len(data) < 2 {
+				return nil, errTruncated
+			}
+			switch l0 := int(data[1]); {
+			case l0 < 192:
+				length, skip = l0, 2
+			case l0 < 224:
+				if len(data) < 3 {
+					return nil, errTruncated
+				}
+				length, skip = (l0-192)<<8+int(data[2])+192, 3
+			case l0 == 255:
+				if len(data) < 6 {
+					return nil, errTruncated
+				}
+				length, skip = int(binary.BigEndian.Uint32(data[2:6])), 6
+			default:
+				return nil, fmt.Errorf("unexpected partial length in packet %d", tag)
+			}
+		} else {
+			// Old format
+			tag = (header >> 2) & 0x0f
+			switch header & 0x03 {
+			case 0:
+				if len(data) < 2 {
+					return nil, errTruncated
+				}
+				length, skip = int(data[1]), 2
+			case 1:
+				if len(data) < 3 {
+					return nil, errTruncated
+				}
+				length, skip = int(binary.BigEndian.Uint16(data[1:3])), 3
+			case 2:
+				if len(data) < 5 {
+					return nil, errTruncated
+				}
+				length, skip = int(binary.BigEndian.Uint32(data[1:5])), 5
+			default:
+				length, skip = len(data)-1, 1 // Runs to the end
+			}
+		}
+		if length < 0 || len(data)-skip < length {
+			return nil, errTruncated
+		}
+		packets = append(packets, packet{tag: tag, body: data[skip : skip+length]})
+		data = data[skip+length:]
+	}
+	return packets, nil
+}
+
+// reader reads the fields of a packet body
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data) < n {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() int {
+	if b := r.bytes(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+// mpi reads a multiprecision integer: a bit count, then the bytes
+func (r *reader) mpi() []byte {
+	bits := r.uint16()
+	return r.bytes((bits + 7) / 8)
+}
+
+// parseKey reads a v4 public key or subkey packet. Keys of other versions
+// or of algorithms that cannot sign come back as nil with no error, so a
+// keyring holding them is still usable.
+func parseKey(body []byte) (*Key, error) {
+	r := &reader{data: body}
+	if version := r.byte(); version != 4 {
+		return nil, r.err
+	}
+	created := r.bytes(4)
+	algo := r.byte()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	key := &Key{body: body, created: binary.BigEndian.Uint32(created)}
+	switch algo {
+	case algoRSA, algoRSASign:
+		n, e := r.mpi(), r.mpi()
+		if r.err != nil {
+			return nil, r.err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		key.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	case algoECDSA:
+		oid := r.bytes(int(r.byte()))
+		point := r.mpi()
+		if r.err != nil {
+			return nil, r.err
+		}
+		var curve elliptic.Curve
+		switch {
+		case bytes.Equal(oid, oidP256):
+			curve = elliptic.P256()
+		case bytes.Equal(oid, oidP384):
+			curve = elliptic.P384()
+		case bytes.Equal(oid, oidP521):
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(point) != 1+2*size || point[0] != 4 {
+			return nil, errors.New("bad ECDSA point")
+		}
+		key.public = &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(point[1 : 1+size]),
+			Y:     new(big.Int).SetBytes(point[1+size:]),
+		}
+	case algoEdDSA:
+		oid := r.bytes(int(r.byte()))
+		point := r.mpi()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if !bytes.Equal(oid, oidEd25519) {
+			return nil, nil
+		}
+		if len(point) != 1+ed25519.PublicKeySize || point[0] != 0x40 {
+			return nil, errors.New("bad Ed25519 point")
+		}
+		key.public = ed25519.PublicKey(point[1:])
+	case algoEd25519:
+		point := r.bytes(ed25519.PublicKeySize)
+		if r.err != nil {
+			return nil, r.err
+		}
+		key.public = ed25519.PublicKey(point)
+	default:
+		return nil, nil
+	}
+
+	// A v4 fingerprint is the SHA-1 of the packet as an old format public key
+	sum := sha1.Sum(keyPrefix(body))
+	key.Fingerprint = sum[:]
+	key.ID = binary.BigEndian.Uint64(key.Fingerprint[12:])
+	return key, nil
+}
+
+// keyPrefix returns what a signature over a key packet hashes for it
+func keyPrefix(body []byte) []byte {
+	return append([]byte{0x99, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// userIDPrefix returns what a certification of a user ID hashes for it
+func userIDPrefix(id []byte) []byte {
+	n := len(id)
+	return append([]byte{0xb4, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, id...)
+}
+
+// Signature subpacket types
+const (
+	subCreationTime      = 2
+	subExpirationTime    = 3
+	subKeyExpirationTime = 9
+	subIssuerKeyID       = 16
+	subKeyFlags          = 27
+	subRevocationReason  = 29
+	subEmbeddedSignature = 32
+	subIssuerFingerprint = 33
+)
+
+// signature is a v4 signature packet
+type signature struct {
+	sigType   byte
+	algo      byte
+	hash      byte
+	hashed    []byte // The hashed part of the packet, version byte onwards
+	left16    []byte // The first two bytes of the digest
+	issuer    uint64 // Key ID of the signer, 0 if not given
+	created   uint32
+	expires   uint32 // Seconds after created; 0 for never
+	rsaSig    []byte
+	r, s      []byte // ECDSA and EdDSA
+	ed25519   []byte // Native Ed25519
+	issuerFpr []byte
+
+	// Self-signatures of keys
+	keyExpires  uint32 // Seconds after the key's creation; 0 for never
+	keyFlags    byte
+	hasKeyFlags bool
+	reason      byte // Reason for a revocation
+	hasReason   bool
+	embedded    []byte // Signature packet body, for a subkey's binding back to its primary key
+}
+
+// digest finishes h, which holds what s signs, with the hashed part of s and
+// the trailer giving its length
+func (s *signature) digest(h hash.Hash) []byte {
+	h.Write(s.hashed)
+	n := len(s.hashed)
+	h.Write([]byte{0x04, 0xff, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	return h.Sum(nil)
+}
+
+// parseSignature reads a v4 signature packet
+func parseSignature(body []byte) (*signature, error) {
+	r := &reader{data: body}
+	if version := r.byte(); version != 4 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, fmt.Errorf("version %d signatures are not supported", version)
+	}
+	sig := &signature{sigType: r.byte(), algo: r.byte(), hash: r.byte()}
+	hashedSubpackets := r.bytes(r.uint16())
+	if r.err != nil {
+		return nil, r.err
+	}
+	sig.hashed = body[:len(body)-len(r.data)]
+	unhashedSubpackets := r.bytes(r.uint16())
+	sig.left16 = r.bytes(2)
+	switch sig.algo {
+	case algoRSA, algoRSASign:
+		sig.rsaSig = r.mpi()
+	case algoECDSA, algoEdDSA:
+		sig.r, sig.s = r.mpi(), r.mpi()
+	case algoEd25519:
+		sig.ed25519 = r.bytes(ed25519.SignatureSize)
+	default:
+		if r.err == nil {
+			return nil, fmt.Errorf("public key algorithm %d is not supported", sig.algo)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err := sig.readSubpackets(hashedSubpackets, true); err != nil {
+		return nil, err
+	}
+	// Only issuer hints are taken from the unhashed area, which anyone can
+	// change: a wrong one just fails to verify
+	if err := sig.readSubpackets(unhashedSubpackets, false); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// readSubpackets reads the subpackets of one area of a signature
+func (sig *signature) readSubpackets(data []byte, hashed bool) error {
+	for len(data) > 0 {
+		var length, skip int
+		switch l0 := int(data[0]); {
+		case l0 < 192:
+			length, skip = l0, 1
+		case l0 < 255:
+			if len(data) < 2 {
+				return errTruncated
+			}
+			length, skip = (l0-192)<<8+int(data[1])+192, 2
+		default:
+			if len(data) < 5 {
+				return errTruncated
+			}
+			length, skip = int(binary.BigEndian.Uint32(data[1:5])), 5
+		}
+		if length < 1 || len(data)-skip < length {
+			return errTruncated
+		}
+		typ, content := data[skip], data[skip+1:skip+length]
+		data = data[skip+length:]
+
+		critical := typ&0x80 != 0
+		switch typ & 0x7f {
+		case subCreationTime:
+			if hashed && len(content) == 4 {
+				sig.created = binary.BigEndian.Uint32(content)
+			}
+		case subExpirationTime:
+			if hashed && len(content) == 4 {
+				sig.expires = binary.BigEndian.Uint32(content)
+			}
+		case subKeyExpirationTime:
+			if hashed && len(content) == 4 {
+				sig.keyExpires = binary.BigEndian.Uint32(content)
+			}
+		case subKeyFlags:
+			if hashed && len(content) > 0 {
+				sig.keyFlags, sig.hasKeyFlags = content[0], true
+			}
+		case subRevocationReason:
+			if hashed && len(content) > 0 {
+				sig.reason, sig.hasReason = content[0], true
+			}
+		case subEmbeddedSignature:
+			// Checked on its own, so it may come from either area
+			if sig.embedded == nil {
+				sig.embedded = content
+			}
+		case subIssuerKeyID:
+			if len(content) == 8 && sig.issuer == 0 {
+				sig.issuer = binary.BigEndian.Uint64(content)
+			}
+		case subIssuerFingerprint:
+			if len(content) == 21 && content[0] == 4 && sig.issuerFpr == nil {
+				sig.issuerFpr = content[1:]
+				if sig.issuer == 0 {
+					sig.issuer = binary.BigEndian.Uint64(content[13:])
+				}
+			}
+		default:
+			if critical && hashed {
+				return fmt.Errorf("signature has unsupported critical subpacket %d", typ&0x7f)
+			}
+		}
+	}
+	return nil
+}
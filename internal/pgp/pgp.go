@@ -0,0 +1,493 @@
+// Package pgp verifies detached OpenPGP signatures, such as the .asc and
+// .sig files published next to release downloads, against a keyring of
+// trusted public keys.
+//
+// It reads version 4 keys and signatures made with RSA, ECDSA (NIST curves)
+// or Ed25519 and SHA-2 hashes, which covers what GnuPG has produced for
+// years. Keys in the keyring are only used if they certify themselves, and
+// subkeys if their primary key binds them (and, for signing subkeys, they
+// bind back). A signature only counts if its key was meant for signing and
+// was neither expired nor revoked when the signature was made.
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // Registers SHA-224 and SHA-256 for crypto.Hash
+	_ "crypto/sha512" // Registers SHA-384 and SHA-512 for crypto.Hash
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxKeyringSize bounds the keyring and signature files read
+const MaxKeyringSize = 16 << 20
+
+var (
+	// ErrBadSignature is returned when a signature was made by a key in the
+	// keyring but not over the data given
+	ErrBadSignature = errors.New("bad signature")
+
+	// ErrUnknownKey is returned when a signature was made by a key that is
+	// not in the keyring
+	ErrUnknownKey = errors.New("signed by a key not in the keyring")
+
+	// ErrInvalidKey is returned when a signature was made by a key in the
+	// keyring that could not sign it: one expired or revoked by then, or not
+	// meant for signing data
+	ErrInvalidKey = errors.New("signing key not valid")
+)
+
+// hashes are the hash algorithms signatures may use, by OpenPGP ID. MD5 and
+// SHA-1 are left out as no longer safe for signatures.
+var hashes = map[byte]crypto.Hash{
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// hashSHA1 is the OpenPGP ID of SHA-1, which the self-signatures of older
+// keys still use. Only the key's owner makes those, so a collision does not
+// help anyone else.
+const hashSHA1 = 2
+
+// Key is a public key that signatures can be checked against
+type Key struct {
+	ID          uint64 // Low 64 bits of Fingerprint
+	Fingerprint []byte
+	UserID      string // First certified user ID of the key, or of its primary key for a subkey
+
+	public  crypto.PublicKey
+	body    []byte // The key packet, which self-signatures are made over
+	primary *Key   // For a subkey, the key that binds it
+	created uint32
+	// From the latest self-signature
+	expires  uint32 // Seconds after created; 0 for never
+	flags    byte
+	hasFlags bool // Without key flags, a key may be used for anything
+	// A revocation saying the key was superseded or retired leaves the
+	// signatures made before revokedAt; with revokedAt 0 none are left
+	revoked   bool
+	revokedAt uint32
+}
+
+// String returns the key ID in hex and the user ID, like GnuPG shows them
+func (k *Key) String() string {
+	if k.UserID == "" {
+		return fmt.Sprintf("%016X", k.ID)
+	}
+	return fmt.Sprintf("%016X %s", k.ID, k.UserID)
+}
+
+// Keyring is a set of trusted public keys
+type Keyring []*Key
+
+// ReadKeyring reads the public keys and subkeys of a binary or ASCII
+// armored OpenPGP key file, such as `gpg --export` writes. Keys without a
+// valid self-signature, and subkeys their primary key does not bind, are
+// left out.
+func ReadKeyring(r io.Reader) (Keyring, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = dearmor(data); err != nil {
+		return nil, err
+	}
+	packets, err := readPackets(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each primary key starts a transferable key, running to the next
+	var keys Keyring
+	for len(packets) > 0 {
+		n := 1 + slices.IndexFunc(packets[1:], func(p packet) bool { return p.tag == tagPublicKey })
+		if n == 0 {
+			n = len(packets)
+		}
+		found, err := transferableKeys(packets[:n])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, found...)
+		packets = packets[n:]
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable public keys found")
+	}
+	return keys, nil
+}
+
+// certified is a user ID or subkey and the signatures that follow it
+type certified struct {
+	tag  byte
+	body []byte
+	sigs []*signature
+}
+
+// transferableKeys returns the primary key that starts packets, and the
+// subkeys after it, that their signatures make valid
+func transferableKeys(packets []packet) ([]*Key, error) {
+	if packets[0].tag != tagPublicKey {
+		return nil, nil
+	}
+	primary, err := parseKey(packets[0].body)
+	if err != nil || primary == nil {
+		return nil, err // Not a key Surge can check signatures with
+	}
+
+	var direct []*signature // Signatures over the primary key alone
+	var parts []*certified
+	for _, p := range packets[1:] {
+		switch p.tag {
+		case tagUserID, tagUserAttribute, tagSubkey:
+			parts = append(parts, &certified{tag: p.tag, body: p.body})
+		case tagSignature:
+			s, err := parseSignature(p.body)
+			if err != nil {
+				continue // A signature Surge cannot read counts neither for nor against the key
+			}
+			// Revocations and direct signatures are of the primary key wherever they are
+			if len(parts) == 0 || s.sigType == sigKeyRevocation || s.sigType == sigDirectKey {
+				direct = append(direct, s)
+			} else {
+				parts[len(parts)-1].sigs = append(parts[len(parts)-1].sigs, s)
+			}
+		}
+	}
+
+	prefix := keyPrefix(primary.body)
+	var self *signature
+	latest := func(s *signature) {
+		if self == nil || s.created > self.created {
+			self = s
+		}
+	}
+	for _, s := range direct {
+		switch {
+		case s.sigType == sigDirectKey && primary.verifies(s, prefix):
+			latest(s)
+		case s.sigType == sigKeyRevocation && primary.verifies(s, prefix):
+			primary.revoke(s)
+		}
+	}
+	for _, part := range parts {
+		if part.tag != tagUserID {
+			continue
+		}
+		for _, s := range part.sigs {
+			if s.sigType >= sigCertGeneric && s.sigType <= sigCertPositive && primary.verifies(s, prefix, userIDPrefix(part.body)) {
+				latest(s)
+				if primary.UserID == "" {
+					primary.UserID = string(part.body)
+				}
+			}
+		}
+	}
+	if self == nil {
+		return nil, nil // Anyone could have made a key nothing binds to its owner
+	}
+	primary.certify(self)
+
+	keys := []*Key{primary}
+	for _, part := range parts {
+		if part.tag != tagSubkey {
+			continue
+		}
+		sub, err := parseKey(part.body)
+		if err != nil {
+			return nil, err
+		}
+		if sub == nil {
+			continue
+		}
+		sub.primary, sub.UserID = primary, primary.UserID
+		subPrefix := keyPrefix(sub.body)
+		var binding *signature
+		for _, s := range part.sigs {
+			switch {
+			case s.sigType == sigSubkeyBinding && primary.verifies(s, prefix, subPrefix):
+				if binding == nil || s.created > binding.created {
+					binding = s
+				}
+			case s.sigType == sigSubkeyRevocation && primary.verifies(s, prefix, subPrefix):
+				sub.revoke(s)
+			}
+		}
+		if binding == nil {
+			continue
+		}
+		sub.certify(binding)
+		// A signing subkey must also bind itself to the primary key, or
+		// anyone could claim someone else's subkey as theirs
+		if !sub.hasFlags || sub.flags&keyFlagSign != 0 {
+			back, err := parseSignature(binding.embedded)
+			if binding.embedded == nil || err != nil || back.sigType != sigPrimaryBinding || !sub.verifies(back, prefix, subPrefix) {
+				continue
+			}
+		}
+		keys = append(keys, sub)
+	}
+	return keys, nil
+}
+
+// verifies reports whether k made s over the packets whose hashed forms
+// are in prefix
+func (k *Key) verifies(s *signature, prefix ...[]byte) bool {
+	if (s.issuer != 0 && s.issuer != k.ID) || (s.issuerFpr != nil && !bytes.Equal(s.issuerFpr, k.Fingerprint)) {
+		return false
+	}
+	hashFunc, ok := hashes[s.hash]
+	if s.hash == hashSHA1 && s.sigType >= sigCertGeneric {
+		hashFunc, ok = crypto.SHA1, true
+	}
+	if !ok {
+		return false
+	}
+	h := hashFunc.New()
+	for _, p := range prefix {
+		h.Write(p)
+	}
+	digest := s.digest(h)
+	return bytes.Equal(digest[:2], s.left16) && verifyDigest(k, s, digest)
+}
+
+// certify takes the key's expiry and flags from its self-signature s
+func (k *Key) certify(s *signature) {
+	k.expires = s.keyExpires
+	k.flags, k.hasFlags = s.keyFlags, s.hasKeyFlags
+}
+
+// revoke marks k revoked by s. A key superseded or retired keeps the
+// signatures it made before; for any other reason, or none, it keeps none.
+func (k *Key) revoke(s *signature) {
+	if !s.hasReason || (s.reason != reasonSuperseded && s.reason != reasonRetired) {
+		k.revoked, k.revokedAt = true, 0
+		return
+	}
+	if !k.revoked || (k.revokedAt != 0 && s.created < k.revokedAt) {
+		k.revoked, k.revokedAt = true, s.created
+	}
+}
+
+// validAt fails unless k, and for a subkey its primary key, existed and was
+// neither expired nor revoked at t
+func (k *Key) validAt(t uint32) error {
+	switch {
+	case t < k.created:
+		return fmt.Errorf("%w: %s was made after the signature", ErrInvalidKey, k)
+	case k.expires != 0 && int64(t) >= int64(k.created)+int64(k.expires):
+		return fmt.Errorf("%w: %s had expired when the signature was made", ErrInvalidKey, k)
+	case k.revoked && (k.revokedAt == 0 || t >= k.revokedAt):
+		return fmt.Errorf("%w: %s has been revoked", ErrInvalidKey, k)
+	}
+	if k.primary != nil {
+		return k.primary.validAt(t)
+	}
+	return nil
+}
+
+// canSign fails unless k could make s: a key for signing data, valid when s
+// was made. A signature made while the key was valid still holds once the
+// key has expired, as in GnuPG.
+func (k *Key) canSign(s *signature) error {
+	if k.hasFlags && k.flags&keyFlagSign == 0 {
+		return fmt.Errorf("%w: %s is not for signing data", ErrInvalidKey, k)
+	}
+	return k.validAt(s.created)
+}
+
+// LoadKeyring reads the key file at path, see ReadKeyring
+func LoadKeyring(path string) (Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := ReadKeyring(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// Verify checks the detached signature sig, binary or ASCII armored, over
+// signed, returning the key that made it. When sig holds several signatures
+// one good one is enough.
+func (kr Keyring) Verify(signed io.Reader, sig []byte) (*Key, error) {
+	data, err := dearmor(sig)
+	if err != nil {
+		return nil, err
+	}
+	packets, err := readPackets(data)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []*signature
+	for _, p := range packets {
+		if p.tag != tagSignature {
+			continue
+		}
+		s, err := parseSignature(p.body)
+		if err != nil {
+			return nil, err
+		}
+		if s.sigType != sigBinary && s.sigType != sigText {
+			return nil, fmt.Errorf("signature of type %#x is not a document signature", s.sigType)
+		}
+		if _, ok := hashes[s.hash]; !ok {
+			return nil, fmt.Errorf("signature hash algorithm %d is not supported", s.hash)
+		}
+		sigs = append(sigs, s)
+	}
+	if len(sigs) == 0 {
+		return nil, errors.New("no signature found")
+	}
+
+	// Every signature hashes the data its own way, so read it once for all
+	digests := make([]hash.Hash, len(sigs))
+	writers := make([]io.Writer, len(sigs))
+	for i, s := range sigs {
+		digests[i] = hashes[s.hash].New()
+		writers[i] = digests[i]
+		if s.sigType == sigText {
+			writers[i] = &crlfWriter{w: digests[i]}
+		}
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), signed); err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for i, s := range sigs {
+		key, err := kr.check(s, digests[i])
+		if err == nil {
+			return key, nil
+		}
+		if firstErr == nil || errors.Is(firstErr, ErrUnknownKey) {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// check verifies one signature, given the hash of the data it signs
+func (kr Keyring) check(s *signature, h hash.Hash) (*Key, error) {
+	var candidates []*Key
+	for _, key := range kr {
+		if s.issuerFpr != nil && !bytes.Equal(key.Fingerprint, s.issuerFpr) {
+			continue
+		}
+		if s.issuer != 0 && key.ID != s.issuer {
+			continue
+		}
+		candidates = append(candidates, key)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: %016X", ErrUnknownKey, s.issuer)
+	}
+	if s.expires != 0 && time.Now().Unix() > int64(s.created)+int64(s.expires) {
+		return nil, errors.New("signature has expired")
+	}
+
+	digest := s.digest(h)
+	if !bytes.Equal(digest[:2], s.left16) {
+		return nil, ErrBadSignature
+	}
+
+	for _, key := range candidates {
+		if verifyDigest(key, s, digest) {
+			if err := key.canSign(s); err != nil {
+				return nil, err
+			}
+			return key, nil
+		}
+	}
+	return nil, ErrBadSignature
+}
+
+// verifyDigest checks the signature values of s against digest
+func verifyDigest(key *Key, s *signature, digest []byte) bool {
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if s.algo != algoRSA && s.algo != algoRSASign {
+			return false
+		}
+		// Leading zeros of the signature are dropped in its MPI
+		sig := leftPad(s.rsaSig, pub.Size())
+		return sig != nil && rsa.VerifyPKCS1v15(pub, hashes[s.hash], digest, sig) == nil
+	case *ecdsa.PublicKey:
+		return s.algo == algoECDSA && ecdsa.Verify(pub, digest, new(big.Int).SetBytes(s.r), new(big.Int).SetBytes(s.s))
+	case ed25519.PublicKey:
+		sig := s.ed25519
+		if s.algo == algoEdDSA {
+			r, sv := leftPad(s.r, 32), leftPad(s.s, 32)
+			if r == nil || sv == nil {
+				return false
+			}
+			sig = append(r, sv...)
+		} else if s.algo != algoEd25519 {
+			return false
+		}
+		return ed25519.Verify(pub, digest, sig)
+	}
+	return false
+}
+
+// leftPad returns b padded with leading zeros to size bytes, or nil if it is
+// longer
+func leftPad(b []byte, size int) []byte {
+	if len(b) > size {
+		return nil
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// crlfWriter converts line endings to CRLF, as text signatures are made over
+type crlfWriter struct {
+	w      io.Writer
+	lastCR bool
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	var out []byte
+	for _, b := range p {
+		if b == '\n' && !c.lastCR {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		c.lastCR = b == '\r'
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// readAll reads r up to MaxKeyringSize
+func readAll(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxKeyringSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxKeyringSize {
+		return nil, fmt.Errorf("larger than %d bytes", MaxKeyringSize)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, errors.New("empty")
+	}
+	return data, nil
+}
@@ -0,0 +1,359 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Made with GnuPG: one Ed25519, one RSA and one NIST P-256 key, and a key
+// that only certifies, with an Ed25519 subkey for signing
+const testKeyring = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatHSFxYJKwYBBAHaRw8BAQdAnlRZBcHxrrRG83F5QPoze73hTpHTbJ44bn60
+jId0xv+0HVN1cmdlIFRlc3QgPHRlc3RAZXhhbXBsZS5jb20+iJAEExYIADgWIQQf
+WJlwSoYdDshPgwdo4kMH0JhfTAUCatHSFwIbAwULCQgHAgYVCgkICwIEFgIDAQIe
+AQIXgAAKCRBo4kMH0JhfTMzrAP9VSvNrzhWGhizOjxHC7Ym3TUIrX8Ms6lR2vJW0
+2d4MiQD+OnxPeR71JdpQOejXn5+1zTp319OhiyR6d5GSV4E8jguZAQ0EatHSFwEI
+AJ1HWo/9UpRuZQizCT++1988m//uSP6tRktGFNJjSmXOhX4VHetTOFB5Pagm7HSs
+HME3EzsnHejt+JjrnKr9bU9odK+zsv73HkKW9EWcM3c3Cqd7cW08RcnIfbzF5jVI
+gnyNxS3o04odEIS5hIHq2KcMjKaJ7CGdGweoMXCVcZavKWUA3SjNuquYrQnJ201I
+1byLTICwY1h3COgfLiOZOF6zVfREskK8nDrzVpRrNvCpSjjgB8pXEcCiI4Hp0Nhx
+2b/QpuyPF5jju/2FOUAn62zkpnlUqkvZPL4MFONJxYUpsWMFmRBQThIC684IB7g/
+47OH5BrO3vD6DQdRHGhMYW0AEQEAAbQbU3VyZ2UgUlNBIDxyc2FAZXhhbXBsZS5j
+b20+iQFOBBMBCgA4FiEE8ZXu8jFASfeqUX+wVbDtkRyxWQ0FAmrR0hcCGwMFCwkI
+BwIGFQoJCAsCBBYCAwECHgECF4AACgkQVbDtkRyxWQ2mEgf/QSpyLQBoZ2whBqit
+PmtTn5e0LlDsOfSV4i+58VF5YOCRNeQ2rVhl9J1CXtIXXUCBRqPbmcA3qkpHcgru
+iVbJJBWD3lrP14Tt1jY21YYXGHqbwtnjTKBoqYD4J6P1XiYj9OVGHcpVdHrtTq5k
+4qZclYvgVKEgHiAkPZQuY4DNtSDyPzlHQdx8Xkk3TSPAZ53HlEroSWp8hJjyhs3I
+Pq2FCHosJ5WOuvtzRg6s3db0rSNVOmIoVsNY3ipFmQUsrxkwBLcHuf8UijOlkmsc
+A+kyZseclR6jKypaPOwtKd03NoAJE1sfqPFex6fat7kq55DKYgHt3nnNoHDaroQF
+ryJVbZhSBGrR0hcTCCqGSM49AwEHAgME4iy+u0G1b+EiUweUdvIu7kMgcmoAaWFo
+qpgHcB2Y9QE0WIBZQ/q2PwABcdDK7hEPdzzfMUAygDvy/7BKgyXQurQdU3VyZ2Ug
+UDI1NiA8cDI1NkBleGFtcGxlLmNvbT6IkAQTEwgAOBYhBE2HDuCSKYwsfvOu/gGR
+zHQ6pbaZBQJq0dIXAhsDBQsJCAcCBhUKCQgLAgQWAgMBAh4BAheAAAoJEAGRzHQ6
+pbaZX8YA/RXBY5S4fJfGkuFsVVkiKmkmwNnUFhB/GB8+UgqeOCGNAQCDubLqoheV
+8ZPyzU4e+VpVOyRmG1xsrYsKzccOUhfEKpgzBGrR0mwWCSsGAQQB2kcPAQEHQKUp
+718KPLbeIMwzC7R8+nTVZHPkCPpWRy72Qr5Qg7ORtBtTdXJnZSBTdWIgPHN1YkBl
+eGFtcGxlLmNvbT6IkAQTFggAOBYhBJ/OzgzPB9y5ixRMAa6zLXqXia1UBQJq0dJs
+AhsBBQsJCAcCBhUKCQgLAgQWAgMBAh4BAheAAAoJEK6zLXqXia1UcFgBAMUP2s1W
+c7X0iv13cKEh16OSJE8l5Qxjp8es+oM+Z2bEAP4+Lp2keCmF5RnfRmLTcjFHuaQ3
+eWFUdNbvkVbs8cDuBbgzBGrR0mwWCSsGAQQB2kcPAQEHQMcT2YxM0UkqbwKrA8aL
+wjs4ce0XhRvitOHMv527jgn2iO8EGBYIACAWIQSfzs4MzwfcuYsUTAGusy16l4mt
+VAUCatHSbAIbAgCBCRCusy16l4mtVHYgBBkWCAAdFiEEuvKMAdMKQvA84XMiY/D1
+FqDoIIQFAmrR0mwACgkQY/D1FqDoIISUHQEA+4Q77uzvB34axSkOKPJBReS7zHJR
+f/IRkIDM07NrnGwA/1Ttwg4tRIomq6IWfH2rkFDzh6LUdMawKgHswwKm4YgEyQUB
+AP2PDEmaBQ/IhD98opqg+cPzKDovs4uS2WDnFwzH7wy3AQDAWmFUHubjLcTHOjeG
+WKEHhE9t0c8yaD6Ynw3UnZU6Ag==
+=YW3t
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+const testEd25519Key = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatHSFxYJKwYBBAHaRw8BAQdAnlRZBcHxrrRG83F5QPoze73hTpHTbJ44bn60
+jId0xv+0HVN1cmdlIFRlc3QgPHRlc3RAZXhhbXBsZS5jb20+iJAEExYIADgWIQQf
+WJlwSoYdDshPgwdo4kMH0JhfTAUCatHSFwIbAwULCQgHAgYVCgkICwIEFgIDAQIe
+AQIXgAAKCRBo4kMH0JhfTMzrAP9VSvNrzhWGhizOjxHC7Ym3TUIrX8Ms6lR2vJW0
+2d4MiQD+OnxPeR71JdpQOejXn5+1zTp319OhiyR6d5GSV4E8jgs=
+=D8m5
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+const testData = "surge release 1.0\nline two\n"
+
+var testSignatures = map[string]string{
+	"ed25519": `-----BEGIN PGP SIGNATURE-----
+
+iIcEABYIAC8WIQQfWJlwSoYdDshPgwdo4kMH0JhfTAUCatHSbBEcdGVzdEBleGFt
+cGxlLmNvbQAKCRBo4kMH0JhfTKZ6AP45f+m5AqZicy9JE352cyR6BKRoLDOW/W5J
+9iE1FW2e2QD/bSUyuVcFsYQpK/V1dZP9AXmXBAtUq9Yr+xtP3/mYUAE=
+=PN2E
+-----END PGP SIGNATURE-----
+`,
+	"rsa sha512": `-----BEGIN PGP SIGNATURE-----
+
+iQFEBAABCgAuFiEE8ZXu8jFASfeqUX+wVbDtkRyxWQ0FAmrR0mwQHHJzYUBleGFt
+cGxlLmNvbQAKCRBVsO2RHLFZDdJkB/9EdO+0BzN6UPy4xSpDarNl0qpDtVCDqNUs
+hsIBTRaEEmPuxqQyi7k8wWUgMCf6dlUf9KLqQA7kVuZcKPyLdtLRzJDP3sprRAOk
+qO4HjMq88/ECiZCzI0Z6HprWx62fBsLuY+yo5tYc4PKE4qZQhB0ym1ATBS40kQZ5
++4O0ovU6yWO612WxNMExxU+lZgLKbeIMTMqQX6ZrKqe+Gj0Yl/cJ46tYjAy47Eux
+mcXaoeBu1BpqAM7nzROE6b2AeHEHdKS94heRJhrkLuLFtGPUWOqLqZ7JEDKtcsHK
+jfSU9x4NBLttXtCnR/RJu/D/lAgJjGTp1CvT4HdS2hMi8daGesCx
+=7aR1
+-----END PGP SIGNATURE-----
+`,
+	"subkey": `-----BEGIN PGP SIGNATURE-----
+
+iIYEABYIAC4WIQS68owB0wpC8DzhcyJj8PUWoOgghAUCatHSbBAcc3ViQGV4YW1w
+bGUuY29tAAoJEGPw9Rag6CCED6wBAIf2xbFr+dg4XSi4gqCMt8faOyLWe4iFdlI/
+15ZnseZMAP9gD8J2f+sweLFzboR+tqWOV+HCGzw4g3KOcGHp0L9aCg==
+=zqtZ
+-----END PGP SIGNATURE-----
+`,
+	"text mode": `-----BEGIN PGP SIGNATURE-----
+
+iIcEARYIAC8WIQQfWJlwSoYdDshPgwdo4kMH0JhfTAUCatHSbBEcdGVzdEBleGFt
+cGxlLmNvbQAKCRBo4kMH0JhfTF/GAP4v+VsoCcP9OFMF4jXf6bXZkDlNSKnNjYO5
+4CvxFpJ2YQD/ZuZwy1XAwo63/uBTNSwA25Z7yxgApP2tXeB6rK/iUAQ=
+=D+pq
+-----END PGP SIGNATURE-----
+`,
+	"p256 binary": "iIcEABMIAC8WIQRNhw7gkimMLH7zrv4Bkcx0OqW2mQUCatHSbBEccDI1NkBleGFtcGxlLmNvbQAKCRABkcx0OqW2mauuAQCf3zFPATWXRnM6PMOiRVax5HLj2onorUceGf6tSRx+EQD+NmCSj06etL9vUwgT8AZ5K93RQO0tFsmSnUUH1IqCqjk=",
+}
+
+func testSignature(t *testing.T, name string) []byte {
+	t.Helper()
+	sig := testSignatures[name]
+	if name == "p256 binary" {
+		decoded, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decoded
+	}
+	return []byte(sig)
+}
+
+func TestVerify(t *testing.T) {
+	keys, err := ReadKeyring(strings.NewReader(testKeyring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 5 {
+		t.Errorf("read %d keys, want 5", len(keys))
+	}
+
+	signers := map[string]string{
+		"ed25519":     "Surge Test <test@example.com>",
+		"rsa sha512":  "Surge RSA <rsa@example.com>",
+		"subkey":      "Surge Sub <sub@example.com>",
+		"text mode":   "Surge Test <test@example.com>",
+		"p256 binary": "Surge P256 <p256@example.com>",
+	}
+	for name, signer := range signers {
+		t.Run(name, func(t *testing.T) {
+			key, err := keys.Verify(strings.NewReader(testData), testSignature(t, name))
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if key.UserID != signer {
+				t.Errorf("signed by %s, want %s", key, signer)
+			}
+
+			_, err = keys.Verify(strings.NewReader(testData+"tampered"), testSignature(t, name))
+			if !errors.Is(err, ErrBadSignature) {
+				t.Errorf("Verify() of changed data error = %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerify_TextModeLineEndings(t *testing.T) {
+	keys, err := ReadKeyring(strings.NewReader(testEd25519Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf := strings.ReplaceAll(testData, "\n", "\r\n")
+	if _, err := keys.Verify(strings.NewReader(crlf), testSignature(t, "text mode")); err != nil {
+		t.Errorf("text signature should hold for CRLF line endings: %v", err)
+	}
+	if _, err := keys.Verify(strings.NewReader(crlf), testSignature(t, "ed25519")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("binary signature should not hold for CRLF line endings: %v", err)
+	}
+}
+
+func TestVerify_UnknownKey(t *testing.T) {
+	keys, err := ReadKeyring(strings.NewReader(testEd25519Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Verify(strings.NewReader(testData), testSignature(t, "rsa sha512")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify() error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestReadKeyring_Binary(t *testing.T) {
+	binary, err := dearmor([]byte(testKeyring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ReadKeyring(strings.NewReader(string(binary)))
+	if err != nil || len(keys) != 5 {
+		t.Fatalf("ReadKeyring() = %d keys, %v", len(keys), err)
+	}
+
+	if _, err := ReadKeyring(strings.NewReader("not a key")); err == nil {
+		t.Error("ReadKeyring() of garbage should fail")
+	}
+	corrupt := strings.Replace(testEd25519Key, "mDME", "mDMF", 1)
+	if _, err := ReadKeyring(strings.NewReader(corrupt)); err == nil {
+		t.Error("ReadKeyring() of corrupted armor should fail")
+	}
+}
+
+// testKey builds Ed25519 keys and signatures, to check what makes a key
+// valid without a GnuPG key for every case
+type testKey struct {
+	priv ed25519.PrivateKey
+	body []byte // Key packet body
+	fpr  []byte
+}
+
+func newTestKey(seed byte, created uint32) *testKey {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	body := binary.BigEndian.AppendUint32([]byte{4}, created)
+	body = append(append(body, algoEdDSA, byte(len(oidEd25519))), oidEd25519...)
+	body = append(body, testMPI(append([]byte{0x40}, priv.Public().(ed25519.PublicKey)...))...)
+	fpr := sha1.Sum(keyPrefix(body))
+	return &testKey{priv: priv, body: body, fpr: fpr[:]}
+}
+
+// testMPI encodes b as an OpenPGP multiprecision integer
+func testMPI(b []byte) []byte {
+	b = bytes.TrimLeft(b, "\x00")
+	bits := new(big.Int).SetBytes(b).BitLen()
+	return append([]byte{byte(bits >> 8), byte(bits)}, b...)
+}
+
+// testSubpacket encodes one signature subpacket
+func testSubpacket(typ byte, content []byte) []byte {
+	return append([]byte{byte(len(content) + 1), typ}, content...)
+}
+
+// sign returns a signature packet body by k over prefix, made at created
+// with the extra hashed subpackets given
+func (k *testKey) sign(sigType byte, created uint32, subpackets []byte, prefix ...[]byte) []byte {
+	sub := testSubpacket(subCreationTime, binary.BigEndian.AppendUint32(nil, created))
+	sub = append(sub, testSubpacket(subIssuerFingerprint, append([]byte{4}, k.fpr...))...)
+	sub = append(sub, subpackets...)
+	hashed := append([]byte{4, sigType, algoEdDSA, 8, byte(len(sub) >> 8), byte(len(sub))}, sub...)
+
+	h := sha256.New()
+	for _, p := range prefix {
+		h.Write(p)
+	}
+	s := &signature{hashed: hashed}
+	digest := s.digest(h)
+	sig := ed25519.Sign(k.priv, digest)
+
+	body := append(append(hashed, 0, 0), digest[:2]...)
+	return append(append(body, testMPI(sig[:32])...), testMPI(sig[32:])...)
+}
+
+// testPacket encodes a new format packet
+func testPacket(tag byte, body []byte) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{0xc0 | tag, 0xff}, uint32(len(body))), body...)
+}
+
+func TestVerify_KeyValidity(t *testing.T) {
+	const t0 = 1700000000
+	primary := newTestKey(1, t0)
+	sub := newTestKey(2, t0)
+	other := newTestKey(3, t0)
+	uid := []byte("Surge Test <test@example.com>")
+	pp, sp := keyPrefix(primary.body), keyPrefix(sub.body)
+
+	flags := func(f byte) []byte { return testSubpacket(subKeyFlags, []byte{f}) }
+	expires := func(secs uint32) []byte {
+		return testSubpacket(subKeyExpirationTime, binary.BigEndian.AppendUint32(nil, secs))
+	}
+	reason := func(r byte) []byte { return testSubpacket(subRevocationReason, []byte{r}) }
+	backSig := func() []byte {
+		return testSubpacket(subEmbeddedSignature, sub.sign(sigPrimaryBinding, t0, nil, pp, sp))
+	}
+	// keyring is the primary key with uid, certified by cert, then extra packets
+	keyring := func(cert []byte, extra ...[]byte) []byte {
+		data := append(testPacket(tagPublicKey, primary.body), testPacket(tagUserID, uid)...)
+		if cert != nil {
+			data = append(data, testPacket(tagSignature, cert)...)
+		}
+		for _, p := range extra {
+			data = append(data, p...)
+		}
+		return data
+	}
+	withSubkey := func(binding []byte, extra ...[]byte) []byte {
+		return keyring(primary.sign(sigCertPositive, t0, flags(0x01), pp, userIDPrefix(uid)),
+			append([][]byte{testPacket(tagSubkey, sub.body), testPacket(tagSignature, binding)}, extra...)...)
+	}
+	selfSig := primary.sign(sigCertPositive, t0, flags(0x03), pp, userIDPrefix(uid))
+	dataSig := func(k *testKey, at uint32) []byte {
+		return testPacket(tagSignature, k.sign(sigBinary, at, nil, []byte(testData)))
+	}
+
+	tests := []struct {
+		name    string
+		keyring []byte
+		sig     []byte
+		wantErr error // nil for a good signature; ErrUnknownKey when the keyring has no key for it
+	}{
+		{"self-signed", keyring(selfSig), dataSig(primary, t0+50), nil},
+		{"no self-signature", keyring(nil, testPacket(tagPublicKey, other.body), testPacket(tagUserID, uid),
+			testPacket(tagSignature, other.sign(sigCertPositive, t0, nil, keyPrefix(other.body), userIDPrefix(uid)))),
+			dataSig(primary, t0+50), ErrUnknownKey},
+		{"certified by another key", keyring(other.sign(sigCertPositive, t0, nil, pp, userIDPrefix(uid)),
+			testPacket(tagPublicKey, other.body), testPacket(tagUserID, uid),
+			testPacket(tagSignature, other.sign(sigCertPositive, t0, nil, keyPrefix(other.body), userIDPrefix(uid)))),
+			dataSig(primary, t0+50), ErrUnknownKey},
+		{"not for signing", keyring(primary.sign(sigCertPositive, t0, flags(0x01), pp, userIDPrefix(uid))),
+			dataSig(primary, t0+50), ErrInvalidKey},
+		{"signed before expiry", keyring(primary.sign(sigCertPositive, t0, append(flags(0x03), expires(100)...), pp, userIDPrefix(uid))),
+			dataSig(primary, t0+50), nil},
+		{"signed after expiry", keyring(primary.sign(sigCertPositive, t0, append(flags(0x03), expires(100)...), pp, userIDPrefix(uid))),
+			dataSig(primary, t0+150), ErrInvalidKey},
+		{"expiry from the latest self-signature", keyring(selfSig,
+			testPacket(tagSignature, primary.sign(sigCertPositive, t0+10, append(flags(0x03), expires(100)...), pp, userIDPrefix(uid)))),
+			dataSig(primary, t0+150), ErrInvalidKey},
+		{"signed before the key", keyring(selfSig), dataSig(primary, t0-50), ErrInvalidKey},
+		{"revoked", keyring(selfSig, testPacket(tagSignature, primary.sign(sigKeyRevocation, t0+100, nil, pp))),
+			dataSig(primary, t0+50), ErrInvalidKey},
+		{"compromised", keyring(selfSig, testPacket(tagSignature, primary.sign(sigKeyRevocation, t0+100, reason(2), pp))),
+			dataSig(primary, t0+50), ErrInvalidKey},
+		{"superseded after signing", keyring(selfSig, testPacket(tagSignature, primary.sign(sigKeyRevocation, t0+100, reason(reasonSuperseded), pp))),
+			dataSig(primary, t0+50), nil},
+		{"superseded before signing", keyring(selfSig, testPacket(tagSignature, primary.sign(sigKeyRevocation, t0+100, reason(reasonSuperseded), pp))),
+			dataSig(primary, t0+150), ErrInvalidKey},
+		{"revoked by another key", keyring(selfSig, testPacket(tagSignature, other.sign(sigKeyRevocation, t0+100, nil, pp))),
+			dataSig(primary, t0+50), nil},
+		{"subkey", withSubkey(primary.sign(sigSubkeyBinding, t0, append(flags(0x02), backSig()...), pp, sp)),
+			dataSig(sub, t0+50), nil},
+		{"subkey without back-signature", withSubkey(primary.sign(sigSubkeyBinding, t0, flags(0x02), pp, sp)),
+			dataSig(sub, t0+50), ErrUnknownKey},
+		{"subkey bound by another key", withSubkey(other.sign(sigSubkeyBinding, t0, append(flags(0x02), backSig()...), pp, sp)),
+			dataSig(sub, t0+50), ErrUnknownKey},
+		{"subkey for encryption", withSubkey(primary.sign(sigSubkeyBinding, t0, flags(0x0c), pp, sp)),
+			dataSig(sub, t0+50), ErrInvalidKey},
+		{"subkey revoked", withSubkey(primary.sign(sigSubkeyBinding, t0, append(flags(0x02), backSig()...), pp, sp),
+			testPacket(tagSignature, primary.sign(sigSubkeyRevocation, t0+100, nil, pp, sp))),
+			dataSig(sub, t0+50), ErrInvalidKey},
+		{"subkey of an expired key", keyring(primary.sign(sigCertPositive, t0, append(flags(0x01), expires(100)...), pp, userIDPrefix(uid)),
+			testPacket(tagSubkey, sub.body), testPacket(tagSignature, primary.sign(sigSubkeyBinding, t0, append(flags(0x02), backSig()...), pp, sp))),
+			dataSig(sub, t0+150), ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ReadKeyring(bytes.NewReader(tt.keyring))
+			if err != nil {
+				if tt.wantErr == ErrUnknownKey {
+					return // No key left at all
+				}
+				t.Fatalf("ReadKeyring() error = %v", err)
+			}
+			_, err = keys.Verify(strings.NewReader(testData), tt.sig)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Verify() error = %v, want a good signature", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package platform
+
+import "os"
+
+// MapFile maps the first size bytes of f into memory. It is unsupported on
+// this OS.
+func MapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, unsupported("memory-mapped files")
+}
+
+// FlushMap is never reached, as MapFile always fails
+func FlushMap(b []byte) error {
+	return unsupported("memory-mapped files")
+}
+
+// UnmapFile is never reached, as MapFile always fails
+func UnmapFile(b []byte) error {
+	return unsupported("memory-mapped files")
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package platform
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// MapFile maps the first size bytes of f into memory, shared, so writes to
+// the slice land in the file as writes to f would. f must already be size
+// bytes long: touching a page past its end faults.
+func MapFile(f *os.File, size int64) ([]byte, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: unix.EINVAL}
+	}
+	b, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return b, nil
+}
+
+// FlushMap writes the changed pages of a mapping from MapFile to its file
+func FlushMap(b []byte) error {
+	if err := unix.Msync(b, unix.MS_SYNC); err != nil {
+		return &os.SyscallError{Syscall: "msync", Err: err}
+	}
+	return nil
+}
+
+// UnmapFile releases a mapping from MapFile. The slice must not be used after.
+func UnmapFile(b []byte) error {
+	if err := unix.Munmap(b); err != nil {
+		return &os.SyscallError{Syscall: "munmap", Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package platform
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// MapFile maps the first size bytes of f into memory, so writes to the slice
+// land in the file as writes to f would. f must already be size bytes long.
+func MapFile(f *os.File, size int64) ([]byte, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, &os.PathError{Op: "CreateFileMapping", Path: f.Name(), Err: windows.ERROR_INVALID_PARAMETER}
+	}
+	h, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READWRITE, uint32(size>>32), uint32(size), nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "CreateFileMapping", Path: f.Name(), Err: err}
+	}
+	// The view keeps the mapping alive on its own
+	defer windows.CloseHandle(h)
+	addr, err := windows.MapViewOfFile(h, windows.FILE_MAP_WRITE, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, &os.PathError{Op: "MapViewOfFile", Path: f.Name(), Err: err}
+	}
+	return unsafe.Slice(*(**byte)(unsafe.Pointer(&addr)), int(size)), nil
+}
+
+// FlushMap writes the changed pages of a mapping from MapFile to its file
+func FlushMap(b []byte) error {
+	if err := windows.FlushViewOfFile(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b))); err != nil {
+		return &os.SyscallError{Syscall: "FlushViewOfFile", Err: err}
+	}
+	return nil
+}
+
+// UnmapFile releases a mapping from MapFile. The slice must not be used after.
+func UnmapFile(b []byte) error {
+	if err := windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&b[0]))); err != nil {
+		return &os.SyscallError{Syscall: "UnmapViewOfFile", Err: err}
+	}
+	return nil
+}
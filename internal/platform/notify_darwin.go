@@ -0,0 +1,17 @@
+package platform
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// appleScriptQuoter escapes text for an AppleScript string literal
+var appleScriptQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Notify shows a notification in the macOS Notification Center
+func Notify(ctx context.Context, title, message string) error {
+	script := `display notification "` + appleScriptQuoter.Replace(message) +
+		`" with title "` + appleScriptQuoter.Replace(title) + `"`
+	return exec.CommandContext(ctx, "osascript", "-e", script).Run()
+}
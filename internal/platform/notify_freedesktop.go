@@ -0,0 +1,18 @@
+//go:build linux || freebsd || openbsd || netbsd || dragonfly
+
+package platform
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Notify shows a desktop notification through notify-send. Without it (e.g.
+// on a headless server) notifications are unsupported.
+func Notify(ctx context.Context, title, message string) error {
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		return unsupported("notifications without notify-send")
+	}
+	return exec.CommandContext(ctx, path, "--app-name=Surge", "--", title, message).Run()
+}
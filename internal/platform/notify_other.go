@@ -0,0 +1,10 @@
+//go:build !linux && !freebsd && !openbsd && !netbsd && !dragonfly && !darwin && !windows
+
+package platform
+
+import "context"
+
+// Notify shows a desktop notification. It is unsupported on this OS.
+func Notify(ctx context.Context, title, message string) error {
+	return unsupported("notifications")
+}
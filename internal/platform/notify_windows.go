@@ -0,0 +1,27 @@
+package platform
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// toastScript shows a toast as PowerShell, the one app Windows lets show
+// them without registering a shortcut. Title and message come from the
+// environment so they need no quoting.
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:SURGE_TOAST_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:SURGE_TOAST_MESSAGE)) > $null
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($xml))
+`
+
+// Notify shows a Windows toast notification
+func Notify(ctx context.Context, title, message string) error {
+	cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "SURGE_TOAST_TITLE="+title, "SURGE_TOAST_MESSAGE="+message)
+	return cmd.Run()
+}
@@ -0,0 +1,20 @@
+// Package platform isolates the operating system features Surge uses beyond
+// the standard library: preallocated and sparse files, batched writes,
+// extended attributes, desktop notifications, the trash, free disk space and
+// powering off.
+//
+// Every function exists on every OS, so callers need no build tags. Where a
+// feature is missing it falls back to a plain equivalent or returns an error
+// wrapping errors.ErrUnsupported, which callers treat as best-effort.
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// unsupported reports that feature is not available on this OS
+func unsupported(feature string) error {
+	return fmt.Errorf("%s on %s: %w", feature, runtime.GOOS, errors.ErrUnsupported)
+}
@@ -0,0 +1,146 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPreallocate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := Preallocate(f, 5<<20); err != nil {
+		t.Fatalf("Preallocate failed: %v", err)
+	}
+	if info, _ := f.Stat(); info.Size() != 5<<20 {
+		t.Errorf("size = %d, want %d", info.Size(), 5<<20)
+	}
+
+	// A leftover longer than the download is cut to size
+	if err := Preallocate(f, 1000); err != nil {
+		t.Fatalf("Preallocate failed: %v", err)
+	}
+	if info, _ := f.Stat(); info.Size() != 1000 {
+		t.Errorf("size = %d, want 1000", info.Size())
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	free, err := FreeSpace(t.TempDir())
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("FreeSpace failed: %v", err)
+	}
+	if free <= 0 {
+		t.Errorf("FreeSpace = %d, want a positive number of bytes", free)
+	}
+
+	if _, err := FreeSpace(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestMapFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := MapFile(f, 1<<20)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("MapFile failed: %v", err)
+	}
+	copy(b[1000:], "mapped")
+	if err := FlushMap(b); err != nil {
+		t.Errorf("FlushMap failed: %v", err)
+	}
+	if err := UnmapFile(b); err != nil {
+		t.Errorf("UnmapFile failed: %v", err)
+	}
+
+	got := make([]byte, 6)
+	if _, err := f.ReadAt(got, 1000); err != nil || string(got) != "mapped" {
+		t.Errorf("file holds %q (%v), want the mapped write", got, err)
+	}
+	if _, err := MapFile(f, 0); err == nil {
+		t.Error("expected an error mapping nothing")
+	}
+}
+
+func TestXattr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := SetXattr(path, "user.surge.test", []byte("value"))
+	if err != nil {
+		// Unsupported here, or by the filesystem holding the temp dir
+		t.Skip(err)
+	}
+	got, err := GetXattr(path, "user.surge.test")
+	if err != nil {
+		t.Fatalf("GetXattr failed: %v", err)
+	}
+	if string(got) != "value" {
+		t.Errorf("GetXattr = %q, want value", got)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only the freedesktop.org trash can be checked without a desktop")
+	}
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	dir := t.TempDir()
+
+	for range 2 {
+		path := filepath.Join(dir, "my file.iso")
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Trash(path); err != nil {
+			t.Fatalf("Trash failed: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("file is still in place: %v", err)
+		}
+	}
+
+	// The second file of the same name gets a name of its own
+	for _, name := range []string{"my file.iso", "my file.2.iso"} {
+		if _, err := os.Stat(filepath.Join(dataHome, "Trash", "files", name)); err != nil {
+			t.Errorf("trashed file missing: %v", err)
+		}
+	}
+	info, err := os.ReadFile(filepath.Join(dataHome, "Trash", "info", "my file.iso.trashinfo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Path=" + filepath.ToSlash(dir) + "/my%20file.iso\n"; !strings.Contains(string(info), want) {
+		t.Errorf(".trashinfo = %q, want it to contain %q", info, want)
+	}
+
+	if err := Trash(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Trash of a missing file = %v, want a not-exist error", err)
+	}
+}
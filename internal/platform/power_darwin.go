@@ -0,0 +1,11 @@
+package platform
+
+import (
+	"context"
+	"os/exec"
+)
+
+// PowerOff asks macOS to shut down, as the Apple menu does
+func PowerOff(ctx context.Context) error {
+	return exec.CommandContext(ctx, "osascript", "-e", `tell application "System Events" to shut down`).Run()
+}
@@ -0,0 +1,17 @@
+package platform
+
+import (
+	"context"
+	"os/exec"
+)
+
+// PowerOff shuts the machine down through systemd, which lets the user of an
+// active session do so, or with shutdown(8) as root elsewhere
+func PowerOff(ctx context.Context) error {
+	if path, err := exec.LookPath("systemctl"); err == nil {
+		if err := exec.CommandContext(ctx, path, "poweroff").Run(); err == nil {
+			return nil
+		}
+	}
+	return exec.CommandContext(ctx, "shutdown", "-h", "now").Run()
+}
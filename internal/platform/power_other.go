@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package platform
+
+import (
+	"context"
+	"os/exec"
+)
+
+// PowerOff shuts the machine down with shutdown(8), which needs root
+func PowerOff(ctx context.Context) error {
+	return exec.CommandContext(ctx, "shutdown", "-p", "now").Run()
+}
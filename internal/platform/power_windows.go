@@ -0,0 +1,11 @@
+package platform
+
+import (
+	"context"
+	"os/exec"
+)
+
+// PowerOff shuts Windows down
+func PowerOff(ctx context.Context) error {
+	return exec.CommandContext(ctx, "shutdown", "/s", "/t", "0").Run()
+}
@@ -0,0 +1,28 @@
+package platform
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Preallocate sizes f to size bytes and reserves the disk space for them, so
+// a full disk fails the download up front instead of midway. Filesystems
+// without fallocate get a sparse file of that size instead.
+func Preallocate(f *os.File, size int64) error {
+	if size > 0 {
+		err := unix.Fallocate(int(f.Fd()), 0, 0, size)
+		if err != nil && !errors.Is(err, unix.EOPNOTSUPP) && !errors.Is(err, unix.ENOSYS) && !errors.Is(err, unix.EINVAL) {
+			return &os.PathError{Op: "fallocate", Path: f.Name(), Err: err}
+		}
+	}
+	// fallocate only grows a file; a longer leftover is cut to size
+	return f.Truncate(size)
+}
+
+// MakeSparse marks f as sparse. Linux filesystems keep unwritten ranges
+// sparse on their own, so there is nothing to do.
+func MakeSparse(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+
+package platform
+
+import "os"
+
+// Preallocate sizes f to size bytes. Without a portable fallocate the space
+// is not reserved; the file is sparse where the filesystem supports it.
+func Preallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
+
+// MakeSparse marks f as sparse. Unix filesystems keep unwritten ranges
+// sparse on their own, so there is nothing to do.
+func MakeSparse(f *os.File) error {
+	return nil
+}
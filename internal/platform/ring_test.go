@@ -0,0 +1,59 @@
+//go:build (linux && iouring) || (windows && overlapped)
+
+package platform
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ring, err := NewRing(f, 8)
+	if err != nil {
+		t.Skipf("no batched writes here: %v", err)
+	}
+
+	// More writers than slots, so the loop has to run several batches
+	const writers, size = 32, 64 << 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := bytes.Repeat([]byte{byte('a' + i%26)}, size)
+			if n, err := ring.WriteAt(buf, int64(i*size)); n != size || err != nil {
+				t.Errorf("writer %d: WriteAt = %d, %v", i, n, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != writers*size {
+		t.Fatalf("file is %d bytes, want %d", len(data), writers*size)
+	}
+	for i := 0; i < writers; i++ {
+		if want := bytes.Repeat([]byte{byte('a' + i%26)}, size); !bytes.Equal(data[i*size:(i+1)*size], want) {
+			t.Errorf("range %d holds the wrong data", i)
+		}
+	}
+
+	if err := ring.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := ring.WriteAt([]byte("x"), 0); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("WriteAt after Close = %v, want os.ErrClosed", err)
+	}
+}
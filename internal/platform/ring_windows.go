@@ -0,0 +1,169 @@
+//go:build windows && overlapped
+
+package platform
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ringCloseKey is the completion key Close posts to stop the loop
+const ringCloseKey = 1
+
+// maxRingWrite is the most one WriteFile call is given; its length is 32-bit
+const maxRingWrite = 1 << 30
+
+// ringWrite is one overlapped write waiting for its completion packet. The
+// OVERLAPPED comes first, so the pointer the port hands back leads here.
+type ringWrite struct {
+	ov   windows.Overlapped
+	n    uint32
+	err  error
+	done chan struct{}
+}
+
+// Ring writes to one file with overlapped I/O through a completion port.
+// Writes from several goroutines are all in flight at once on a handle of
+// their own, where writes through the file's synchronous handle queue up
+// behind each other, which matters once chunk writers run at multi-gigabit
+// speeds.
+type Ring struct {
+	file  windows.Handle // Overlapped handle to the same file
+	port  windows.Handle
+	slots chan struct{} // Bounds the writes in flight
+
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+	once     sync.Once
+	exited   chan struct{}
+	err      error // Set by the loop when the port broke; read after exited
+}
+
+// NewRing opens an overlapped handle to f allowing entries writes in flight.
+// It fails where the file cannot be opened again, such as when f was opened
+// without sharing; callers then write with f.WriteAt.
+func NewRing(f *os.File, entries uint32) (*Ring, error) {
+	name, err := windows.UTF16PtrFromString(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL|windows.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "CreateFile", Path: f.Name(), Err: err}
+	}
+	port, err := windows.CreateIoCompletionPort(h, 0, 0, 0)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, &os.SyscallError{Syscall: "CreateIoCompletionPort", Err: err}
+	}
+	r := &Ring{
+		file:   h,
+		port:   port,
+		slots:  make(chan struct{}, max(entries, 1)),
+		exited: make(chan struct{}),
+	}
+	go r.loop()
+	return r, nil
+}
+
+// WriteAt writes p at off, waiting for the write like pwrite. Short writes
+// are continued until p is written or the write fails.
+func (r *Ring) WriteAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, os.ErrClosed
+	}
+	r.inflight.Add(1)
+	r.mu.Unlock()
+	defer r.inflight.Done()
+
+	r.slots <- struct{}{}
+	defer func() { <-r.slots }()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		w := &ringWrite{done: make(chan struct{})}
+		w.ov.Offset = uint32(pos)
+		w.ov.OffsetHigh = uint32(pos >> 32)
+		var written uint32
+		// Without FILE_SKIP_COMPLETION_PORT_ON_SUCCESS a write done at once
+		// also posts a packet, so every accepted write is waited for alike
+		err := windows.WriteFile(r.file, p[n:n+min(len(p)-n, maxRingWrite)], &written, &w.ov)
+		if err != nil && err != windows.ERROR_IO_PENDING {
+			return n, &os.SyscallError{Syscall: "WriteFile", Err: err}
+		}
+		select {
+		case <-w.done:
+		case <-r.exited:
+			return n, r.closedErr()
+		}
+		switch {
+		case w.err != nil:
+			return n, &os.SyscallError{Syscall: "WriteFile", Err: w.err}
+		case w.n == 0:
+			return n, io.ErrShortWrite
+		}
+		n += int(w.n)
+	}
+	return n, nil
+}
+
+// closedErr is what writes get once the loop has stopped
+func (r *Ring) closedErr() error {
+	if r.err != nil {
+		return r.err
+	}
+	return os.ErrClosed
+}
+
+// loop hands each completion packet to the write it belongs to
+func (r *Ring) loop() {
+	defer close(r.exited)
+	for {
+		var n uint32
+		var key uintptr
+		var ov *windows.Overlapped
+		err := windows.GetQueuedCompletionStatus(r.port, &n, &key, &ov, windows.INFINITE)
+		if ov == nil {
+			if key != ringCloseKey && err != nil {
+				r.err = &os.SyscallError{Syscall: "GetQueuedCompletionStatus", Err: err}
+			}
+			return
+		}
+		w := (*ringWrite)(unsafe.Pointer(ov))
+		w.n, w.err = n, err
+		close(w.done)
+	}
+}
+
+// Close waits for the writes in flight, then closes the overlapped handle.
+// Writes after it fail with os.ErrClosed; the file itself stays open. It
+// returns the error that broke the port, if one did.
+func (r *Ring) Close() error {
+	var err error
+	r.once.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+		r.inflight.Wait()
+
+		if perr := windows.PostQueuedCompletionStatus(r.port, 0, ringCloseKey, nil); perr != nil {
+			err = &os.SyscallError{Syscall: "PostQueuedCompletionStatus", Err: perr}
+		} else {
+			<-r.exited
+			err = r.err
+		}
+		err = errors.Join(err, windows.CloseHandle(r.file), windows.CloseHandle(r.port))
+	})
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package platform
+
+// FreeSpace returns the bytes available on the filesystem holding dir. It
+// is unsupported on this OS.
+func FreeSpace(dir string) (int64, error) {
+	return 0, unsupported("free space queries")
+}
@@ -0,0 +1,21 @@
+package platform
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Trash moves path into the macOS Trash through the Finder, so Put Back
+// can restore it
+func Trash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return err
+	}
+	script := `tell application "Finder" to delete POSIX file "` + appleScriptQuoter.Replace(abs) + `"`
+	return exec.Command("osascript", "-e", script).Run()
+}
@@ -0,0 +1,90 @@
+//go:build linux || freebsd || openbsd || netbsd || dragonfly
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Trash moves path into the user's trash as the freedesktop.org trash spec
+// lays out, so file managers can restore it. Files on another filesystem
+// than the home trash are handed to gio, where it is installed.
+func Trash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return err
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	filesDir := filepath.Join(dataHome, "Trash", "files")
+	infoDir := filepath.Join(dataHome, "Trash", "info")
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(infoDir, 0700); err != nil {
+		return err
+	}
+
+	// Creating the .trashinfo exclusively claims a name no other trashed
+	// file has
+	base := filepath.Base(abs)
+	name := base
+	var info *os.File
+	for i := 2; ; i++ {
+		info, err = os.OpenFile(filepath.Join(infoDir, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		ext := filepath.Ext(base)
+		name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), i, ext)
+	}
+	escaped := (&url.URL{Path: abs}).EscapedPath()
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, time.Now().Format("2006-01-02T15:04:05"))
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(abs, filepath.Join(filesDir, name))
+	}
+	if err != nil {
+		os.Remove(info.Name())
+		if errors.Is(err, syscall.EXDEV) {
+			return trashWithGio(abs)
+		}
+		return err
+	}
+	return nil
+}
+
+// trashWithGio trashes a file outside the home filesystem, into the trash
+// folder of its own filesystem
+func trashWithGio(path string) error {
+	gio, err := exec.LookPath("gio")
+	if err != nil {
+		return unsupported("trash on another filesystem than home without gio")
+	}
+	if out, err := exec.Command(gio, "trash", "--", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("gio trash: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !freebsd && !openbsd && !netbsd && !dragonfly && !darwin && !windows
+
+package platform
+
+// Trash moves path into the user's trash. It is unsupported on this OS.
+func Trash(path string) error {
+	return unsupported("trash")
+}
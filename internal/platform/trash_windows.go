@@ -0,0 +1,33 @@
+package platform
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// recycleScript sends the file or folder named by the environment to the
+// Recycle Bin, so no quoting is needed
+const recycleScript = `
+Add-Type -AssemblyName Microsoft.VisualBasic
+$path = $env:SURGE_TRASH_PATH
+if (Test-Path -LiteralPath $path -PathType Container) {
+	[Microsoft.VisualBasic.FileIO.FileSystem]::DeleteDirectory($path, 'OnlyErrorDialogs', 'SendToRecycleBin')
+} else {
+	[Microsoft.VisualBasic.FileIO.FileSystem]::DeleteFile($path, 'OnlyErrorDialogs', 'SendToRecycleBin')
+}
+`
+
+// Trash moves path into the Recycle Bin
+func Trash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return err
+	}
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", recycleScript)
+	cmd.Env = append(os.Environ(), "SURGE_TRASH_PATH="+abs)
+	return cmd.Run()
+}
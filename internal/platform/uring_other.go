@@ -0,0 +1,30 @@
+//go:build !(linux && iouring) && !(windows && overlapped)
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Ring batches positioned writes to one file: through io_uring on Linux
+// builds tagged iouring, and overlapped I/O on Windows builds tagged
+// overlapped. Other builds have none: NewRing fails and callers write with
+// the file's WriteAt.
+type Ring struct{}
+
+// NewRing always fails in this build
+func NewRing(f *os.File, entries uint32) (*Ring, error) {
+	return nil, fmt.Errorf("batched writes need a Linux build with -tags iouring or a Windows build with -tags overlapped: %w", errors.ErrUnsupported)
+}
+
+// WriteAt is never reached, as no Ring is ever made
+func (r *Ring) WriteAt(p []byte, off int64) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// Close does nothing
+func (r *Ring) Close() error {
+	return nil
+}
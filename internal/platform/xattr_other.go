@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package platform
+
+// SetXattr sets the extended attribute name of the file at path. It is
+// unsupported on this OS.
+func SetXattr(path, name string, value []byte) error {
+	return unsupported("extended attributes")
+}
+
+// GetXattr returns the extended attribute name of the file at path. It is
+// unsupported on this OS.
+func GetXattr(path, name string) ([]byte, error) {
+	return nil, unsupported("extended attributes")
+}
@@ -0,0 +1,211 @@
+// Package plugins discovers and calls external plugins. A plugin is an
+// executable in the plugins directory that speaks JSON over stdio: Surge
+// writes one Request to its stdin and reads one JSON reply from its stdout.
+//
+// Every plugin is first asked to "describe" itself, replying with an Info.
+// Resolvers turn page URLs on the hosts they claim into direct file URLs,
+// ahead of the file hosts Surge resolves itself.
+// Post-processors are handed each completed file and may move it.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Request methods
+const (
+	MethodDescribe    = "describe"
+	MethodResolve     = "resolve"
+	MethodPostProcess = "post_process"
+)
+
+// Timeouts for plugin calls. Resolving may fetch and parse a web page.
+const (
+	DescribeTimeout = 5 * time.Second
+	CallTimeout     = time.Minute
+)
+
+// Request is written to a plugin's stdin
+type Request struct {
+	Method string `json:"method"`
+	ID     string `json:"id,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Path   string `json:"path,omitempty"` // post_process: the completed file
+	Size   int64  `json:"size,omitempty"`
+}
+
+// Info is a plugin's reply to describe
+type Info struct {
+	Name        string   `json:"name"`
+	Hosts       []string `json:"hosts,omitempty"`        // Resolve URLs on these hosts, as in allowed_hosts
+	PostProcess bool     `json:"post_process,omitempty"` // Handle completed downloads
+}
+
+// Plugin is a discovered plugin
+type Plugin struct {
+	Info
+	Path string // Executable
+}
+
+// Resolution is a resolver's reply: the file to download instead of the page
+type Resolution struct {
+	URL      string   `json:"url"`
+	Mirrors  []string `json:"mirrors,omitempty"`
+	Filename string   `json:"filename,omitempty"`
+}
+
+// postProcessResult is a post-processor's reply; an empty Path leaves the file where it is
+type postProcessResult struct {
+	Path string `json:"path,omitempty"`
+}
+
+// Discover describes every executable in dir, in name order. Plugins that
+// fail to describe themselves are skipped. A missing dir has no plugins.
+func Discover(dir string) []Plugin {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			utils.Debug("Failed to read plugins directory: %v", err)
+		}
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var found []Plugin
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if !isExecutable(path) {
+			continue
+		}
+		p := Plugin{Path: path}
+		ctx, cancel := context.WithTimeout(context.Background(), DescribeTimeout)
+		err := Call(ctx, path, Request{Method: MethodDescribe}, &p.Info)
+		cancel()
+		if err != nil {
+			utils.Debug("Skipping plugin %s: %v", path, err)
+			continue
+		}
+		if p.Name == "" {
+			p.Name = e.Name()
+		}
+		utils.Debug("Loaded plugin %s (hosts %v, post-process %v)", p.Name, p.Hosts, p.PostProcess)
+		found = append(found, p)
+	}
+	return found
+}
+
+// isExecutable reports whether path is a regular file the plugin runner can
+// start. Windows has no execute bit, so any file counts there.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0111 != 0
+}
+
+// Call sends req to the plugin at path and decodes its reply into resp
+func Call(ctx context.Context, path string, req Request, resp any) error {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err = cmd.Run()
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		utils.Debug("Plugin %s (%s): %s", path, req.Method, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("plugin %s failed on %s: %w", filepath.Base(path), req.Method, err)
+	}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return fmt.Errorf("plugin %s replied to %s with invalid JSON: %w", filepath.Base(path), req.Method, err)
+	}
+	return nil
+}
+
+// Resolves reports whether p resolves rawURL
+func (p Plugin) Resolves(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && config.MatchHost(p.Hosts, strings.ToLower(u.Hostname()))
+}
+
+// ResolveURL returns the download behind rawURL. The first plugin resolving
+// rawURL supplies the URL and mirrors to fetch, and the filename unless
+// filename is set. Without such a plugin the arguments come back unchanged.
+func ResolveURL(plugins []Plugin, rawURL string, mirrors []string, filename string) (Resolution, error) {
+	for _, p := range plugins {
+		if !p.Resolves(rawURL) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), CallTimeout)
+		defer cancel()
+		var res Resolution
+		if err := Call(ctx, p.Path, Request{Method: MethodResolve, URL: rawURL}, &res); err != nil {
+			return Resolution{}, err
+		}
+		if res.URL == "" {
+			return Resolution{}, fmt.Errorf("plugin %s resolved %s to nothing", p.Name, rawURL)
+		}
+		if strings.ContainsAny(res.Filename, `/\`) || res.Filename == "." || res.Filename == ".." {
+			return Resolution{}, fmt.Errorf("plugin %s returned invalid filename %q", p.Name, res.Filename)
+		}
+		if filename != "" {
+			res.Filename = filename
+		}
+		utils.Debug("Plugin %s resolved %s to %s", p.Name, rawURL, res.URL)
+		return res, nil
+	}
+	return Resolution{URL: rawURL, Mirrors: mirrors, Filename: filename}, nil
+}
+
+// PostProcessors returns the executables of plugins handling completed downloads
+func PostProcessors(plugins []Plugin) []string {
+	var paths []string
+	for _, p := range plugins {
+		if p.PostProcess {
+			paths = append(paths, p.Path)
+		}
+	}
+	return paths
+}
+
+// PostProcess hands the completed file at path to the post-processor at
+// plugin and returns where the file is afterwards
+func PostProcess(ctx context.Context, plugin, id, rawURL, path string, size int64) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, CallTimeout)
+	defer cancel()
+	var res postProcessResult
+	if err := Call(ctx, plugin, Request{Method: MethodPostProcess, ID: id, URL: rawURL, Path: path, Size: size}, &res); err != nil {
+		return path, err
+	}
+	if res.Path == "" {
+		return path, nil
+	}
+	if !filepath.IsAbs(res.Path) {
+		res.Path = filepath.Join(filepath.Dir(path), res.Path)
+	}
+	if _, err := os.Stat(res.Path); err != nil {
+		return path, fmt.Errorf("plugin %s reported a missing file: %w", filepath.Base(plugin), err)
+	}
+	return res.Path, nil
+}
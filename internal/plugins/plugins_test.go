@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writePlugin writes an executable shell script named name into dir
+func writePlugin(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// videoSite resolves pages on video.example into their file URL
+const videoSite = `req=$(cat)
+case "$req" in
+  *'"describe"'*) echo '{"name": "video", "hosts": ["video.example"]}' ;;
+  *'"resolve"'*) echo '{"url": "https://cdn.example/v/123.mp4", "mirrors": ["https://cdn2.example/v/123.mp4"], "filename": "talk.mp4"}' ;;
+esac`
+
+func TestDiscover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin tests use shell scripts")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "b-video", videoSite)
+	writePlugin(t, dir, "a-unpack", `echo '{"post_process": true}'`)
+	writePlugin(t, dir, "broken", `exit 1`)
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found := Discover(dir)
+	if len(found) != 2 {
+		t.Fatalf("Discover() found %d plugins, want 2: %+v", len(found), found)
+	}
+	if found[0].Name != "a-unpack" || !found[0].PostProcess {
+		t.Errorf("first plugin = %+v, want the unnamed post-processor", found[0])
+	}
+	if found[1].Name != "video" || !found[1].Resolves("https://www.video.example/watch?v=123") {
+		t.Errorf("second plugin = %+v, want the video resolver", found[1])
+	}
+	if got := PostProcessors(found); len(got) != 1 || got[0] != found[0].Path {
+		t.Errorf("PostProcessors() = %v", got)
+	}
+
+	if got := Discover(filepath.Join(dir, "missing")); got != nil {
+		t.Errorf("Discover() of a missing directory = %v, want none", got)
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin tests use shell scripts")
+	}
+	found := Discover(func() string {
+		dir := t.TempDir()
+		writePlugin(t, dir, "video", videoSite)
+		return dir
+	}())
+
+	res, err := ResolveURL(found, "https://video.example/watch?v=123", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.URL != "https://cdn.example/v/123.mp4" || len(res.Mirrors) != 1 || res.Filename != "talk.mp4" {
+		t.Errorf("ResolveURL() = %+v", res)
+	}
+
+	// A filename chosen by the user wins over the plugin's
+	if res, _ := ResolveURL(found, "https://video.example/watch?v=123", nil, "mine.mp4"); res.Filename != "mine.mp4" {
+		t.Errorf("ResolveURL() filename = %q, want mine.mp4", res.Filename)
+	}
+
+	// URLs no plugin claims pass through unchanged
+	mirrors := []string{"https://b.example/f.zip"}
+	res, err = ResolveURL(found, "https://a.example/f.zip", mirrors, "f.zip")
+	if err != nil || res.URL != "https://a.example/f.zip" || len(res.Mirrors) != 1 || res.Filename != "f.zip" {
+		t.Errorf("ResolveURL() of an unclaimed URL = %+v, %v", res, err)
+	}
+}
+
+func TestPostProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin tests use shell scripts")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "archive.zip")
+	if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Moves the file into done/ and reports its new path relative to the old one
+	mover := writePlugin(t, dir, "mover", `path=$(sed 's/.*"path":"\([^"]*\)".*/\1/')
+mkdir -p "$(dirname "$path")/done" && mv "$path" "$(dirname "$path")/done/" && echo '{"path": "done/archive.zip"}'`)
+
+	got, err := PostProcess(t.Context(), mover, "id", "https://example.com/archive.zip", file, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "done", "archive.zip"); got != want {
+		t.Errorf("PostProcess() = %q, want %q", got, want)
+	}
+
+	// A plugin claiming a file that is not there leaves the path alone
+	liar := writePlugin(t, dir, "liar", `echo '{"path": "/nonexistent/file"}'`)
+	if got, err := PostProcess(t.Context(), liar, "id", "", got, 4); err == nil || got == "/nonexistent/file" {
+		t.Errorf("PostProcess() with a missing file = %q, %v; want an error", got, err)
+	}
+}
@@ -15,6 +15,7 @@ const (
 	StatusPaused
 	StatusComplete
 	StatusError
+	StatusScheduled
 )
 
 // statusInfo holds the display properties for each status
@@ -30,6 +31,7 @@ var statusMap = map[DownloadStatus]statusInfo{
 	StatusPaused:      {"⏸", "Paused", colors.StatePaused},
 	StatusComplete:    {"✔", "Completed", colors.StateDone},
 	StatusError:       {"✖", "Error", colors.StateError},
+	StatusScheduled:   {"◷", "Scheduled", colors.StatePaused},
 }
 
 // Icon returns the status icon
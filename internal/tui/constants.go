@@ -9,6 +9,8 @@ import (
 const (
 	// Timeouts and Intervals
 	TickInterval = 200 * time.Millisecond
+	// How long a footer status message stays up
+	StatusDuration = 5 * time.Second
 	// Input Dimensions
 	InputWidth = 40
 
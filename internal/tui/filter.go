@@ -0,0 +1,117 @@
+package tui
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/tui/components"
+)
+
+// statusAliases maps the values accepted by an "is:" filter term to statuses
+var statusAliases = map[string]components.DownloadStatus{
+	"queued":      components.StatusQueued,
+	"scheduled":   components.StatusScheduled,
+	"downloading": components.StatusDownloading,
+	"active":      components.StatusDownloading,
+	"paused":      components.StatusPaused,
+	"completed":   components.StatusComplete,
+	"done":        components.StatusComplete,
+	"failed":      components.StatusError,
+	"error":       components.StatusError,
+}
+
+// downloadFilter is a parsed search query. Terms are whitespace separated and
+// must all match:
+//
+//	is:<status>  status filter (queued, scheduled, downloading, paused, completed, failed)
+//	cat:<name>   file category filter (videos, music, archives, ... as in settings)
+//	/pattern/    case-insensitive regular expression on filename or URL
+//	anything     case-insensitive substring of the filename
+type downloadFilter struct {
+	statuses []components.DownloadStatus
+	cats     []string          // Names of the wanted categories
+	catalog  []config.Category // Every category, for telling a file's own
+	patterns []*regexp.Regexp
+	words    []string
+}
+
+// parseFilter parses a search query against the file categories of the
+// settings. Unknown statuses and categories and invalid regular expressions
+// fall back to plain substring terms so typing never errors.
+func parseFilter(query string, categories []config.Category) downloadFilter {
+	f := downloadFilter{catalog: categories}
+	for _, term := range strings.Fields(query) {
+		lower := strings.ToLower(term)
+
+		if name, ok := strings.CutPrefix(lower, "is:"); ok {
+			if s, known := statusAliases[name]; known {
+				f.statuses = append(f.statuses, s)
+				continue
+			}
+		}
+
+		if name, ok := strings.CutPrefix(lower, "cat:"); ok {
+			if c, known := config.CategoryNamed(categories, name); known {
+				f.cats = append(f.cats, c.Name)
+				continue
+			}
+		}
+
+		if len(term) > 2 && strings.HasPrefix(term, "/") && strings.HasSuffix(term, "/") {
+			if re, err := regexp.Compile("(?i)" + term[1:len(term)-1]); err == nil {
+				f.patterns = append(f.patterns, re)
+				continue
+			}
+		}
+
+		f.words = append(f.words, lower)
+	}
+	return f
+}
+
+// empty reports whether the filter matches everything
+func (f downloadFilter) empty() bool {
+	return len(f.statuses) == 0 && len(f.cats) == 0 && len(f.patterns) == 0 && len(f.words) == 0
+}
+
+// matches reports whether a download satisfies every term of the filter.
+// Multiple status or category terms are alternatives (is:paused is:failed
+// matches either).
+func (f downloadFilter) matches(d *DownloadModel) bool {
+	if len(f.statuses) > 0 {
+		status := d.status()
+		found := false
+		for _, s := range f.statuses {
+			if s == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.cats) > 0 {
+		c, ok := config.MatchCategory(f.catalog, d.Filename, "")
+		if !ok || !slices.Contains(f.cats, c.Name) {
+			return false
+		}
+	}
+
+	for _, re := range f.patterns {
+		if !re.MatchString(d.Filename) && !re.MatchString(d.URL) {
+			return false
+		}
+	}
+
+	filename := strings.ToLower(d.Filename)
+	for _, w := range f.words {
+		if !strings.Contains(filename, w) {
+			return false
+		}
+	}
+	return true
+}
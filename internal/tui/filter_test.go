@@ -0,0 +1,59 @@
+package tui
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+func TestDownloadFilter(t *testing.T) {
+	downloads := map[string]*DownloadModel{
+		"paused":   {Filename: "ubuntu-24.04.iso", URL: "https://releases.ubuntu.com/ubuntu-24.04.iso", paused: true},
+		"failed":   {Filename: "archive.tar.gz", URL: "https://example.com/archive.tar.gz", err: errors.New("boom")},
+		"done":     {Filename: "notes.pdf", URL: "https://docs.example.com/notes.pdf", done: true},
+		"queued":   {Filename: "video.mkv", URL: "https://cdn.example.org/video.mkv"},
+		"progress": {Filename: "debian.iso", URL: "https://deb.example.net/debian.iso", Speed: 1024, Downloaded: 10},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"paused", "failed", "done", "queued", "progress"}},
+		{"iso", []string{"paused", "progress"}},
+		{"UBUNTU", []string{"paused"}},
+		{"is:failed", []string{"failed"}},
+		{"is:error", []string{"failed"}},
+		{"is:paused is:failed", []string{"paused", "failed"}},
+		{"is:done", []string{"done"}},
+		{"is:downloading", []string{"progress"}},
+		{"is:paused iso", []string{"paused"}},
+		{"is:paused pdf", nil},
+		{`/\.(iso|mkv)$/`, []string{"paused", "queued", "progress"}},
+		{"/example\\.org/", []string{"queued"}},
+		{"/[unterminated/", nil},
+		{"is:bogus", nil},
+		{"cat:videos", []string{"queued"}},
+		{"cat:documents", []string{"done"}},
+		{"cat:Archives cat:videos", []string{"paused", "failed", "queued", "progress"}},
+		{"cat:videos is:paused", nil},
+		{"cat:bogus", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			f := parseFilter(tt.query, config.DefaultCategories())
+			want := make(map[string]bool)
+			for _, name := range tt.want {
+				want[name] = true
+			}
+			for name, d := range downloads {
+				got := f.empty() || f.matches(d)
+				if got != want[name] {
+					t.Errorf("query %q on %s: got %v, want %v", tt.query, name, got, want[name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/surge-downloader/surge/internal/engine/events"
+)
+
+// queueFinish estimates how long until every running and queued download is
+// complete. Each download is assumed to keep the average speed the running
+// ones have now, with no more than slots running at once and together no
+// faster than their current aggregate throughput. Downloads of unknown size
+// cannot be estimated and are left out and counted in unsized. ok is false
+// when nothing is transferring, so there is no throughput to go by.
+func queueFinish(downloads []*DownloadModel, order []string, slots int) (left time.Duration, unsized int, ok bool) {
+	var running, waiting []float64
+	var throughput float64
+	busy := 0 // Running downloads of unknown size
+	var queued []*DownloadModel
+	for _, d := range downloads {
+		if d.done || d.paused || d.err != nil || d.phase == events.PhaseScheduled {
+			continue
+		}
+		if d.tab() == TabActive {
+			throughput += d.Speed
+			if d.Total <= 0 {
+				unsized++
+				busy++
+				continue
+			}
+			running = append(running, float64(max(d.Total-d.Downloaded, 0)))
+			continue
+		}
+		queued = append(queued, d)
+	}
+	if throughput <= 0 {
+		return 0, 0, false
+	}
+	sortByQueueOrder(queued, order)
+	for _, d := range queued {
+		if d.Total <= 0 {
+			unsized++
+			continue
+		}
+		waiting = append(waiting, float64(d.Total-d.Downloaded))
+	}
+
+	perDownload := throughput / float64(len(running)+busy)
+	slots = max(slots-busy, 1)
+	var elapsed float64
+	for len(running) > 0 || len(waiting) > 0 {
+		for len(running) < slots && len(waiting) > 0 {
+			running = append(running, waiting[0])
+			waiting = waiting[1:]
+		}
+		// Everything runs at the same speed until the smallest one is done
+		speed := min(perDownload, throughput/float64(len(running)))
+		done := slices.Min(running)
+		elapsed += done / speed
+		for i := range running {
+			running[i] -= done
+		}
+		running = slices.DeleteFunc(running, func(r float64) bool { return r <= 0 })
+	}
+	return time.Duration(elapsed * float64(time.Second)).Round(time.Second), unsized, true
+}
+
+// renderQueueFinish renders when the downloads in progress and in the queue
+// are expected to be complete, e.g. "all done at 14:32 (in 12m05s)", or ""
+// when that is unknown
+func (m RootModel) renderQueueFinish(now time.Time) string {
+	var order []string
+	slots := 0
+	if m.Pool != nil {
+		order = m.Pool.QueueOrder()
+		slots = m.Pool.MaxDownloads()
+	} else if m.Settings != nil {
+		slots = m.Settings.General.MaxConcurrentDownloads
+	}
+	left, unsized, ok := queueFinish(m.downloads, order, slots)
+	if !ok {
+		return ""
+	}
+
+	at := now.Add(left)
+	layout := "15:04"
+	if at.YearDay() != now.YearDay() || at.Year() != now.Year() {
+		layout = "Mon 15:04"
+	}
+	text := fmt.Sprintf("all done at %s (in %s)", at.Format(layout), compactDuration(left))
+	if unsized > 0 {
+		text += fmt.Sprintf(" + %d of unknown size", unsized)
+	}
+	return lipgloss.NewStyle().Foreground(ColorGray).Render("⏱ " + text)
+}
@@ -0,0 +1,68 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+)
+
+func TestQueueFinish(t *testing.T) {
+	downloads := []*DownloadModel{
+		{ID: "a", Total: 20 * Megabyte, Downloaded: 10 * Megabyte, Speed: Megabyte, phase: events.PhaseActive},
+		{ID: "b", Total: 20 * Megabyte, Speed: Megabyte, phase: events.PhaseActive},
+		{ID: "queued", Total: 30 * Megabyte, phase: events.PhaseQueued},
+		{ID: "paused", Total: 100 * Megabyte, paused: true},
+		{ID: "failed", Total: 100 * Megabyte, err: errors.New("boom")},
+		{ID: "done", Total: 100 * Megabyte, done: true},
+	}
+
+	// a finishes at 10s and frees its slot for the queued download, which
+	// runs at the speed a and b had
+	left, unsized, ok := queueFinish(downloads, []string{"queued"}, 2)
+	if !ok || left != 40*time.Second || unsized != 0 {
+		t.Errorf("two slots: %v, %d, %v; want 40s", left, unsized, ok)
+	}
+	// One slot: the queued download waits for both
+	if left, _, _ := queueFinish(downloads, []string{"queued"}, 1); left != 50*time.Second {
+		t.Errorf("one slot: %v, want 50s", left)
+	}
+	// A free slot does not raise the throughput already reached
+	if left, _, _ := queueFinish(downloads, []string{"queued"}, 3); left != 35*time.Second {
+		t.Errorf("three slots: %v, want 35s", left)
+	}
+
+	downloads = append(downloads, &DownloadModel{ID: "unsized", phase: events.PhaseQueued})
+	if _, unsized, _ := queueFinish(downloads, nil, 2); unsized != 1 {
+		t.Errorf("unsized = %d, want 1", unsized)
+	}
+
+	idle := []*DownloadModel{{ID: "queued", Total: 30 * Megabyte, phase: events.PhaseQueued}}
+	if _, _, ok := queueFinish(idle, nil, 2); ok {
+		t.Error("estimate with nothing transferring")
+	}
+}
+
+func TestRenderQueueFinish(t *testing.T) {
+	settings := config.DefaultSettings()
+	settings.General.MaxConcurrentDownloads = 2
+	m := RootModel{
+		Settings: settings,
+		downloads: []*DownloadModel{
+			{ID: "a", Total: 20 * Megabyte, Downloaded: 10 * Megabyte, Speed: Megabyte, phase: events.PhaseActive},
+			{ID: "b", Total: 20 * Megabyte, Speed: Megabyte, phase: events.PhaseActive},
+		},
+	}
+	now := time.Date(2026, 10, 16, 23, 59, 50, 0, time.Local)
+	if got := m.renderQueueFinish(now); !strings.Contains(got, "all done at Sat 00:00 (in 20s)") {
+		t.Errorf("renderQueueFinish = %q", got)
+	}
+
+	m.downloads[0].paused, m.downloads[1].paused = true, true
+	if got := m.renderQueueFinish(now); got != "" {
+		t.Errorf("renderQueueFinish with everything paused = %q, want nothing", got)
+	}
+}
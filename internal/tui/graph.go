@@ -198,3 +198,32 @@ func overlayStatsBox(graph string, stats *GraphStats, width, height int) string
 
 	return strings.Join(graphLines, "\n")
 }
+
+// sparkBlocks are the bar heights of a sparkline, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// renderSparkline draws the newest width values of data as a one-line bar
+// chart scaled to their peak, padded on the left while history is short
+func renderSparkline(data []float64, width int) string {
+	if width < 1 {
+		return ""
+	}
+	if len(data) > width {
+		data = data[len(data)-width:]
+	}
+	peak := 0.0
+	for _, v := range data {
+		peak = max(peak, v)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(data)))
+	for _, v := range data {
+		level := 0
+		if peak > 0 && v > 0 {
+			level = min(int(v/peak*float64(len(sparkBlocks)-1)+0.5), len(sparkBlocks)-1)
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
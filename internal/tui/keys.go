@@ -14,6 +14,8 @@ type KeyMap struct {
 	SettingsEditor SettingsEditorKeyMap
 	BatchConfirm   BatchConfirmKeyMap
 	Update         UpdateKeyMap
+	Palette        PaletteKeyMap
+	Watch          WatchKeyMap
 }
 
 // DashboardKeyMap defines keybindings for the main dashboard
@@ -26,10 +28,19 @@ type DashboardKeyMap struct {
 	BatchImport key.Binding
 	Search      key.Binding
 	Pause       key.Binding
+	PauseAll    key.Binding
+	ResumeAll   key.Binding
+	Clipboard   key.Binding
 	Delete      key.Binding
+	DeleteFile  key.Binding
+	MoveFile    key.Binding
+	MoveUp      key.Binding
+	MoveDown    key.Binding
 	Settings    key.Binding
 	Log         key.Binding
+	Engine      key.Binding
 	History     key.Binding
+	Palette     key.Binding
 	Quit        key.Binding
 	ForceQuit   key.Binding
 	// Navigation
@@ -120,6 +131,21 @@ type UpdateKeyMap struct {
 	NeverRemind key.Binding
 }
 
+// WatchKeyMap defines keybindings for the read-only watch dashboard
+type WatchKeyMap struct {
+	Up   key.Binding
+	Down key.Binding
+	Quit key.Binding
+}
+
+// PaletteKeyMap defines keybindings for the command palette
+type PaletteKeyMap struct {
+	Up    key.Binding
+	Down  key.Binding
+	Run   key.Binding
+	Close key.Binding
+}
+
 // Keys contains all the keybindings for the application
 var Keys = KeyMap{
 	Dashboard: DashboardKeyMap{
@@ -155,10 +181,38 @@ var Keys = KeyMap{
 			key.WithKeys("p"),
 			key.WithHelp("p", "pause/resume"),
 		),
+		PauseAll: key.NewBinding(
+			key.WithKeys("P"),
+			key.WithHelp("P", "pause all"),
+		),
+		ResumeAll: key.NewBinding(
+			key.WithKeys("R"),
+			key.WithHelp("R", "resume all"),
+		),
+		Clipboard: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "watch clipboard"),
+		),
 		Delete: key.NewBinding(
 			key.WithKeys("x"),
 			key.WithHelp("x", "delete"),
 		),
+		DeleteFile: key.NewBinding(
+			key.WithKeys("X"),
+			key.WithHelp("X", "delete file"),
+		),
+		MoveFile: key.NewBinding(
+			key.WithKeys("m"),
+			key.WithHelp("m", "move file to…"),
+		),
+		MoveUp: key.NewBinding(
+			key.WithKeys("shift+up", "K"),
+			key.WithHelp("⇧↑/K", "move up in queue"),
+		),
+		MoveDown: key.NewBinding(
+			key.WithKeys("shift+down", "J"),
+			key.WithHelp("⇧↓/J", "move down in queue"),
+		),
 		Settings: key.NewBinding(
 			key.WithKeys("s"),
 			key.WithHelp("s", "settings"),
@@ -167,10 +221,18 @@ var Keys = KeyMap{
 			key.WithKeys("l"),
 			key.WithHelp("l", "toggle log"),
 		),
+		Engine: key.NewBinding(
+			key.WithKeys("d"),
+			key.WithHelp("d", "engine stats"),
+		),
 		History: key.NewBinding(
 			key.WithKeys("h"),
 			key.WithHelp("h", "history"),
 		),
+		Palette: key.NewBinding(
+			key.WithKeys(":"),
+			key.WithHelp(":", "commands"),
+		),
 		Quit: key.NewBinding(
 			key.WithKeys("ctrl+c", "ctrl+q"),
 			key.WithHelp("ctrl+q", "quit"),
@@ -390,19 +452,51 @@ var Keys = KeyMap{
 			key.WithHelp("n", "never remind"),
 		),
 	},
+	Palette: PaletteKeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "ctrl+p"),
+			key.WithHelp("↑", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "ctrl+n"),
+			key.WithHelp("↓", "down"),
+		),
+		Run: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "run"),
+		),
+		Close: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "close"),
+		),
+	},
+	Watch: WatchKeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/k", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓/j", "down"),
+		),
+		Quit: key.NewBinding(
+			key.WithKeys("q", "esc", "ctrl+c", "ctrl+q"),
+			key.WithHelp("q", "quit"),
+		),
+	},
 }
 
 // ShortHelp returns keybindings to show in the mini help view
 func (k DashboardKeyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.TabQueued, k.TabActive, k.TabDone, k.Add, k.BatchImport, k.Search, k.Pause, k.Delete, k.Settings, k.Quit}
+	return []key.Binding{k.TabQueued, k.TabActive, k.TabDone, k.Add, k.BatchImport, k.Search, k.Pause, k.Delete, k.Settings, k.Palette, k.Quit}
 }
 
 // FullHelp returns keybindings for the expanded help view
 func (k DashboardKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.TabQueued, k.TabActive, k.TabDone, k.NextTab},
-		{k.Add, k.Search, k.Pause, k.Delete, k.Settings},
-		{k.Log, k.History, k.Quit},
+		{k.Add, k.Search, k.Pause, k.PauseAll, k.ResumeAll, k.Delete, k.DeleteFile, k.MoveFile, k.MoveUp, k.MoveDown, k.Settings},
+		{k.Log, k.Engine, k.History, k.Clipboard, k.Palette, k.Quit},
 	}
 }
 
@@ -480,3 +574,19 @@ func (k UpdateKeyMap) ShortHelp() []key.Binding {
 func (k UpdateKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{{k.OpenGitHub, k.IgnoreNow, k.NeverRemind}}
 }
+
+func (k PaletteKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Run, k.Close}
+}
+
+func (k PaletteKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Up, k.Down, k.Run, k.Close}}
+}
+
+func (k WatchKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Quit}
+}
+
+func (k WatchKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Up, k.Down, k.Quit}}
+}
@@ -3,6 +3,7 @@ package tui
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/surge-downloader/surge/internal/tui/colors"
 	"github.com/surge-downloader/surge/internal/tui/components"
@@ -32,7 +33,12 @@ func (i DownloadItem) Description() string {
 		// Custom "Pausing..." style using existing colors
 		styledStatus = lipgloss.NewStyle().Foreground(colors.StatePaused).Render("⏸ Pausing...")
 	} else {
-		styledStatus = components.DetermineStatus(d.done, d.paused, d.err != nil, d.Speed, d.Downloaded).Render()
+		styledStatus = d.status().Render()
+	}
+
+	// Scheduled: "◷ Scheduled • starts in 1h02m at 02:00"
+	if d.status() == components.StatusScheduled {
+		return fmt.Sprintf("%s • starts in %s at %s", styledStatus, d.countdown(time.Now()), d.startAt.Format("15:04"))
 	}
 
 	// Build progress info
@@ -41,7 +47,19 @@ func (i DownloadItem) Description() string {
 		pct = float64(d.Downloaded) / float64(d.Total) * 100
 	}
 
-	// Format: "⬇ Downloading • 45% • 2.5 MB/s • 50 MB / 100 MB"
+	// Completed: "✔ Completed • 12.50 MB/s avg • 1m20s • sha256 ✔ • 1.0 GB"
+	if d.done && d.err == nil {
+		return fmt.Sprintf("%s • %.2f MB/s avg • %s%s • %s", styledStatus, d.avgSpeed()/Megabyte,
+			d.Elapsed.Round(time.Second), d.checksumInfo(), utils.ConvertBytesToHumanReadable(d.Total))
+	}
+
+	// Failed its checksum: "✖ Error • 1.2 MB/s avg • 1m20s • checksum ✖ • 1.0 GB"
+	if d.done && d.checksum == checksumFailed {
+		return fmt.Sprintf("%s • %.2f MB/s avg • %s%s • %s", styledStatus, d.avgSpeed()/Megabyte,
+			d.Elapsed.Round(time.Second), d.checksumInfo(), utils.ConvertBytesToHumanReadable(d.Total))
+	}
+
+	// Format: "⬇ Downloading • 45% • 2.5 MB/s • ETA 20s • 50 MB / 100 MB"
 	sizeInfo := fmt.Sprintf("%s / %s",
 		utils.ConvertBytesToHumanReadable(d.Downloaded),
 		utils.ConvertBytesToHumanReadable(d.Total))
@@ -49,11 +67,30 @@ func (i DownloadItem) Description() string {
 	speedInfo := ""
 	if d.Speed > 0 {
 		speedInfo = fmt.Sprintf(" • %.2f MB/s", d.Speed/Megabyte)
+		if eta, ok := d.eta(); ok {
+			speedInfo += " • ETA " + compactDuration(eta)
+		}
 	}
 
 	return fmt.Sprintf("%s • %.0f%%%s • %s", styledStatus, pct, speedInfo, sizeInfo)
 }
 
+// checksumInfo returns " • sha256 ✔" or " • checksum ✖" for a download
+// checked against its checksum, and "" for one that wasn't
+func (d *DownloadModel) checksumInfo() string {
+	switch d.checksum {
+	case checksumVerified:
+		name := d.checksumType
+		if name == "" {
+			name = "checksum"
+		}
+		return " • " + lipgloss.NewStyle().Foreground(colors.StateDone).Render(name+" ✔")
+	case checksumFailed:
+		return " • " + lipgloss.NewStyle().Foreground(colors.StateError).Render("checksum ✖")
+	}
+	return ""
+}
+
 func (i DownloadItem) FilterValue() string {
 	return i.download.Filename
 }
@@ -239,14 +276,7 @@ func (m *RootModel) UpdateListItems() {
 			// Find the download globally
 			for _, d := range m.downloads {
 				if d.ID == targetID {
-					newTab := -1
-					if d.done {
-						newTab = TabDone
-					} else if d.Speed > 0 {
-						newTab = TabActive
-					} else {
-						newTab = TabQueued
-					}
+					newTab := d.tab()
 
 					// If it belongs to a different tab, switch to it
 					if newTab != -1 && newTab != m.activeTab {
@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadItem_CompletedDescription(t *testing.T) {
+	d := &DownloadModel{Filename: "a.bin", Total: 20 * 1024 * 1024, Downloaded: 20 * 1024 * 1024, Elapsed: 4 * time.Second, done: true}
+
+	desc := DownloadItem{download: d}.Description()
+	if !strings.Contains(desc, "5.00 MB/s avg") || !strings.Contains(desc, "4s") {
+		t.Errorf("completed description = %q, want average speed and total time", desc)
+	}
+}
+
+func TestDownloadItem_CompletedDescriptionShowsChecksum(t *testing.T) {
+	d := &DownloadModel{Filename: "a.bin", Total: 1024, Elapsed: time.Second, done: true}
+	if desc := (DownloadItem{download: d}).Description(); strings.Contains(desc, "✔ •") || strings.Contains(desc, "✖") {
+		t.Errorf("unchecked description = %q, want no checksum status", desc)
+	}
+
+	d.checksum, d.checksumType = checksumVerified, "sha256"
+	if desc := (DownloadItem{download: d}).Description(); !strings.Contains(desc, "sha256 ✔") {
+		t.Errorf("verified description = %q, want sha256 ✔", desc)
+	}
+
+	d.checksum, d.err = checksumFailed, errors.New("checksum mismatch")
+	desc := DownloadItem{download: d}.Description()
+	if !strings.Contains(desc, "checksum ✖") || !strings.Contains(desc, "MB/s avg") {
+		t.Errorf("failed description = %q, want checksum ✖ next to the average speed", desc)
+	}
+}
+
+func TestDownloadItem_ActiveDescriptionShowsETA(t *testing.T) {
+	d := &DownloadModel{Filename: "a.bin", Total: 10 * 1024 * 1024, Downloaded: 4 * 1024 * 1024, Speed: 2 * 1024 * 1024}
+
+	desc := DownloadItem{download: d}.Description()
+	if !strings.Contains(desc, "ETA 3s") {
+		t.Errorf("active description = %q, want ETA 3s", desc)
+	}
+}
+
+func TestRenderTabTotals_Done(t *testing.T) {
+	m := RootModel{
+		activeTab: TabDone,
+		list:      NewDownloadList(80, 20),
+		downloads: []*DownloadModel{
+			{ID: "1", Filename: "a", Total: 30 * 1024 * 1024, Elapsed: 2 * time.Second, done: true},
+			{ID: "2", Filename: "b", Total: 10 * 1024 * 1024, Elapsed: 2 * time.Second, done: true},
+			{ID: "3", Filename: "c", Total: 50 * 1024 * 1024, Elapsed: time.Second, done: true, err: errors.New("boom")},
+		},
+	}
+	m.UpdateListItems()
+
+	totals := m.renderTabTotals()
+	for _, want := range []string{"3 files", "40.0 MB", "10.00 MB/s avg"} {
+		if !strings.Contains(totals, want) {
+			t.Errorf("totals %q missing %q", totals, want)
+		}
+	}
+}
+
+func TestSortByQueueOrder(t *testing.T) {
+	downloads := []*DownloadModel{{ID: "paused"}, {ID: "b"}, {ID: "scheduled"}, {ID: "a"}}
+	sortByQueueOrder(downloads, []string{"a", "b"})
+
+	var got []string
+	for _, d := range downloads {
+		got = append(got, d.ID)
+	}
+	if want := "a b paused scheduled"; strings.Join(got, " ") != want {
+		t.Errorf("order = %v, want %s", got, want)
+	}
+}
+
+func TestDownloadItem_CompactETA(t *testing.T) {
+	// 4.5 GB left at 1 MB/s
+	d := &DownloadModel{Filename: "a.iso", Total: 5 * 1024 * 1024 * 1024, Downloaded: 512 * 1024 * 1024, Speed: 1024 * 1024}
+
+	desc := DownloadItem{download: d}.Description()
+	if !strings.Contains(desc, "ETA 1h16m") {
+		t.Errorf("active description = %q, want ETA 1h16m", desc)
+	}
+}
+
+func TestCompactDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		20 * time.Second:              "20s",
+		4*time.Minute + 5*time.Second: "4m05s",
+		26*time.Hour + 3*time.Minute:  "26h03m",
+		time.Hour + 59*time.Second:    "1h00m",
+	}
+	for d, want := range tests {
+		if got := compactDuration(d); got != want {
+			t.Errorf("compactDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package tui
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,8 +19,10 @@ import (
 
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/tui/components"
 	"github.com/surge-downloader/surge/internal/version"
 )
 
@@ -37,6 +41,8 @@ const (
 	BatchFilePickerState                      //BatchFilePickerState is 9
 	BatchConfirmState                         //BatchConfirmState is 10
 	UpdateAvailableState                      //UpdateAvailableState is 11
+	PaletteState                              //PaletteState is 12
+	ClipboardConfirmationState                //ClipboardConfirmationState is 13
 )
 
 const (
@@ -54,6 +60,7 @@ type DownloadModel struct {
 	Downloaded  int64
 	Speed       float64
 	Connections int
+	Retries     int64
 
 	StartTime time.Time
 	Elapsed   time.Duration
@@ -68,6 +75,97 @@ type DownloadModel struct {
 	err     error
 	paused  bool
 	pausing bool // UI state: transitioning to pause
+
+	// Last lifecycle phase reported by the pool (empty until the first event,
+	// e.g. for downloads restored from the master list)
+	phase events.DownloadPhase
+
+	startAt     time.Time // When a scheduled download starts
+	completedAt time.Time // When it completed, for ClearCompletedAfter; zero if unknown
+
+	checksum     checksumStatus // Outcome of checking the completed file against its checksum
+	checksumType string         // Hash the checksum used, e.g. "sha256"; empty if unknown
+}
+
+// checksumStatus is the outcome of checking a completed download against its
+// checksum
+type checksumStatus int
+
+const (
+	checksumNone     checksumStatus = iota // No checksum was given or declared
+	checksumVerified                       // The file matched it
+	checksumFailed                         // The file did not match it
+)
+
+// tab returns the dashboard tab the download belongs to. Pool phase events are
+// authoritative; the speed heuristic only covers downloads without a phase yet.
+func (d *DownloadModel) tab() int {
+	if d.done {
+		return TabDone
+	}
+	switch d.phase {
+	case events.PhaseActive:
+		return TabActive
+	case events.PhaseQueued, events.PhaseScheduled, events.PhasePaused:
+		return TabQueued
+	}
+	if d.Speed > 0 || d.Connections > 0 {
+		return TabActive
+	}
+	return TabQueued
+}
+
+// status returns the display status, preferring the pool-reported phase
+func (d *DownloadModel) status() components.DownloadStatus {
+	if d.err == nil && !d.done && !d.paused {
+		switch d.phase {
+		case events.PhaseActive:
+			return components.StatusDownloading
+		case events.PhaseScheduled:
+			return components.StatusScheduled
+		}
+	}
+	return components.DetermineStatus(d.done, d.paused, d.err != nil, d.Speed, d.Downloaded)
+}
+
+// countdown returns how long until a scheduled download starts, e.g. "1h02m"
+func (d *DownloadModel) countdown(now time.Time) string {
+	left := d.startAt.Sub(now)
+	if left <= 0 {
+		return "now"
+	}
+	return compactDuration(left)
+}
+
+// compactDuration formats d to fit a list row: "1h02m", "4m05s" or "20s"
+func compactDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+// avgSpeed returns the average speed in bytes/s over the time spent downloading
+func (d *DownloadModel) avgSpeed() float64 {
+	if d.Elapsed <= 0 {
+		return 0
+	}
+	return float64(d.Total) / d.Elapsed.Seconds()
+}
+
+// eta estimates the remaining time from Speed, which the progress tracker
+// smooths from the average speed of this session, so the list and the
+// details pane agree and neither jumps with every burst; ok is false when it
+// is unknown
+func (d *DownloadModel) eta() (time.Duration, bool) {
+	if d.Speed <= 0 || d.Total <= 0 {
+		return 0, false
+	}
+	remaining := float64(d.Total-d.Downloaded) / d.Speed
+	return time.Duration(remaining * float64(time.Second)).Round(time.Second), true
 }
 
 type RootModel struct {
@@ -97,11 +195,12 @@ type RootModel struct {
 	historyCursor  int
 
 	// Duplicate detection
-	pendingURL      string   // URL pending confirmation
-	pendingPath     string   // Path pending confirmation
-	pendingFilename string   // Filename pending confirmation
-	pendingMirrors  []string // Mirrors pending confirmation
-	duplicateInfo   string   // Info about the duplicate
+	pendingURL      string         // URL pending confirmation
+	pendingPath     string         // Path pending confirmation
+	pendingFilename string         // Filename pending confirmation
+	pendingMirrors  []string       // Mirrors pending confirmation
+	pendingLimits   downloadLimits // Connection and speed overrides pending confirmation
+	duplicateInfo   string         // Info about the duplicate
 
 	// Graph Data
 	SpeedHistory           []float64 // Stores the last ~60 ticks of speed data
@@ -113,6 +212,12 @@ type RootModel struct {
 	logEntries  []string       // Log entries for download events
 	logFocused  bool           // Whether the log viewport is focused
 
+	showEngine bool // Show engine stats instead of the chunk map
+
+	// Footer status
+	status      string    // Rendered message shown in the footer, such as the space a removal freed
+	statusUntil time.Time // When status stops being shown
+
 	// Settings
 	Settings             *config.Settings // Application settings
 	SettingsActiveTab    int              // Active category tab (0-3)
@@ -121,6 +226,9 @@ type RootModel struct {
 	SettingsInput        textinput.Model  // Input for editing string/int values
 	SettingsFileBrowsing bool             // Whether browsing for a directory
 
+	// Moving completed files
+	movingID string // Download whose file the directory picker moves; empty when picking a download directory
+
 	// Selection persistence
 	SelectedDownloadID string // ID of the currently selected download
 	ManualTabSwitch    bool   // Whether the last tab switch was manual
@@ -130,6 +238,16 @@ type RootModel struct {
 	searchActive bool            // Whether search mode is active
 	searchQuery  string          // Current search query
 
+	// Command palette
+	paletteInput  textinput.Model // Text input for the palette query
+	paletteCursor int             // Selected row among matching commands
+	palettePrompt *paletteCommand // Command asking for its value, nil while choosing one
+
+	// Clipboard watching
+	clipboardWatch bool   // Prompt to add download links as they are copied
+	clipboardGen   int    // Bumped on each toggle so ticks of an earlier watch stop
+	clipboardLast  string // Last URL seen on the clipboard, offered at most once
+
 	// Batch import
 	pendingBatchURLs []string // URLs pending batch import
 	batchFilePath    string   // Path to the batch file
@@ -186,6 +304,18 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 	mirrorsInput.Width = InputWidth
 	mirrorsInput.Prompt = ""
 
+	connectionsInput := textinput.New()
+	connectionsInput.Placeholder = "(from settings)"
+	connectionsInput.Width = InputWidth
+	connectionsInput.Prompt = ""
+	connectionsInput.CharLimit = 2
+
+	rateInput := textinput.New()
+	rateInput.Placeholder = "(no limit, e.g. 500KB/s)"
+	rateInput.Width = InputWidth
+	rateInput.Prompt = ""
+	rateInput.CharLimit = 16
+
 	pwd, _ := os.Getwd()
 
 	// Initialize file picker for directory selection - default to Downloads folder
@@ -206,6 +336,16 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 		settings = config.DefaultSettings()
 	}
 
+	if pool != nil {
+		pool.SetKeepPartialOnCancel(settings.General.KeepPartialOnCancel)
+		pool.SetMarkExecutable(settings.General.MarkExecutable)
+		pool.SetFixExtensions(settings.General.FixExtensions)
+		pool.SetSortFolder(settings.General.SortFolder)
+		pool.SetAutosave(settings.Performance.AutosaveInterval)
+		pool.SetSpeedLimit(settings.Connections.SpeedLimitRate())
+		pool.SetConnectionBudget(settings.Connections.MaxGlobalConnections, settings.Connections.SchedulingPolicy)
+	}
+
 	// Override AutoResume if CLI flag provided
 	if noResume {
 		settings.General.AutoResume = false
@@ -224,7 +364,8 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 			dm.Destination = entry.DestPath // Store destination for state lookup on resume
 
 			// Load actual progress from state file (using URL+DestPath for unique lookup)
-			if state, err := state.LoadState(entry.URL, entry.DestPath); err == nil {
+			saved, _ := state.LoadState(entry.URL, entry.DestPath)
+			if state := saved; state != nil {
 				dm.Downloaded = state.Downloaded
 				dm.Total = state.TotalSize
 				dm.state.Downloaded.Store(state.Downloaded)
@@ -291,7 +432,9 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 					State:      dm.state,
 					Runtime:    runtimeConfig,
 					Mirrors:    mirrorURLs,
+					Schedule:   download.SavedSchedule(id),
 				}
+				download.RestoreSettings(&cfg, saved)
 
 				pool.Add(cfg)
 			}
@@ -303,16 +446,29 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 	// Load completed downloads from master list (for Done tab persistence)
 	if completedEntries, err := state.LoadCompletedDownloads(); err == nil {
 		for _, entry := range completedEntries {
+			var completedAt time.Time
+			if entry.CompletedAt > 0 {
+				completedAt = time.Unix(entry.CompletedAt, 0)
+			}
+			if settings.General.CompletedExpired(completedAt, time.Now()) {
+				continue // Only in history now
+			}
 			var id string
 			if entry.ID != "" {
 				id = entry.ID
 			}
 			dm := NewDownloadModel(id, entry.URL, entry.Filename, entry.TotalSize)
 			dm.done = true
+			dm.completedAt = completedAt
 			dm.Destination = entry.DestPath
 			dm.Elapsed = time.Duration(entry.TimeTaken) * time.Millisecond
 			dm.Downloaded = entry.TotalSize
 			dm.progress.SetPercent(1.0)
+			// Completed downloads with a checksum passed it, or they'd have failed
+			if entry.Checksum != "" {
+				dm.checksum = checksumVerified
+				dm.checksumType, _, _ = strings.Cut(entry.Checksum, ":")
+			}
 
 			// Populate mirrors for completed downloads
 			if len(entry.Mirrors) > 0 {
@@ -342,13 +498,19 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 
 	// Initialize search input
 	searchInput := textinput.New()
-	searchInput.Placeholder = "Type to search..."
+	searchInput.Placeholder = "name, is:paused, /regex/"
 	searchInput.Width = 30
 	searchInput.Prompt = ""
 
+	// Initialize command palette input
+	paletteInput := textinput.New()
+	paletteInput.Placeholder = paletteQueryPlaceholder
+	paletteInput.Width = 40
+	paletteInput.Prompt = ": "
+
 	m := RootModel{
 		downloads:             downloads,
-		inputs:                []textinput.Model{urlInput, mirrorsInput, pathInput, filenameInput},
+		inputs:                []textinput.Model{urlInput, mirrorsInput, pathInput, filenameInput, connectionsInput, rateInput},
 		state:                 DashboardState,
 		progressChan:          progressChan,
 		filepicker:            fp,
@@ -362,6 +524,7 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 		Settings:              settings,
 		SettingsInput:         settingsInput,
 		searchInput:           searchInput,
+		paletteInput:          paletteInput,
 		keys:                  Keys,
 		ServerPort:            serverPort,
 		CurrentVersion:        currentVersion,
@@ -384,45 +547,77 @@ func InitialRootModel(serverPort int, currentVersion string, pool *download.Work
 func (m RootModel) Init() tea.Cmd {
 	// Trigger update check if not disabled in settings
 	if !m.Settings.General.SkipUpdateCheck {
-		return checkForUpdateCmd(m.CurrentVersion)
+		return tea.Batch(checkForUpdateCmd(m.CurrentVersion), clearCompletedTickCmd())
 	}
-	return nil
+	return clearCompletedTickCmd()
+}
+
+// clearExpiredCompleted drops completed downloads older than the
+// ClearCompletedAfter setting from the list. They stay in the history view.
+func (m *RootModel) clearExpiredCompleted(now time.Time) {
+	kept := m.downloads[:0]
+	for _, d := range m.downloads {
+		if d.done && d.err == nil && m.Settings.General.CompletedExpired(d.completedAt, now) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	if len(kept) == len(m.downloads) {
+		return
+	}
+	clear(m.downloads[len(kept):])
+	m.downloads = kept
+	m.UpdateListItems()
 }
 
 // Helper to get downloads for the current tab
 func (m RootModel) getFilteredDownloads() []*DownloadModel {
 	var filtered []*DownloadModel
-	searchLower := strings.ToLower(m.searchQuery)
+	categories := config.DefaultCategories()
+	if m.Settings != nil {
+		categories = m.Settings.General.FileCategories()
+	}
+	filter := parseFilter(m.searchQuery, categories)
 
 	for _, d := range m.downloads {
 		// Apply tab filter first
-		switch m.activeTab {
-		case TabQueued:
-			if d.done || d.Speed > 0 {
-				continue
-			}
-		case TabActive:
-			if d.done || (d.Speed == 0 && d.Connections == 0) {
-				continue
-			}
-		case TabDone:
-			if !d.done {
-				continue
-			}
+		if d.tab() != m.activeTab {
+			continue
 		}
 
 		// Apply search filter if query is set
-		if m.searchQuery != "" {
-			if !strings.Contains(strings.ToLower(d.Filename), searchLower) {
-				continue
-			}
+		if !filter.empty() && !filter.matches(d) {
+			continue
 		}
 
 		filtered = append(filtered, d)
 	}
+	if m.activeTab == TabQueued && m.Pool != nil {
+		sortByQueueOrder(filtered, m.Pool.QueueOrder())
+	}
 	return filtered
 }
 
+// sortByQueueOrder puts the downloads waiting in the pool's queue first, in
+// the order they will start; the rest (paused, scheduled) keep theirs
+func sortByQueueOrder(downloads []*DownloadModel, order []string) {
+	rank := make(map[string]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+	slices.SortStableFunc(downloads, func(a, b *DownloadModel) int {
+		ra, ok := rank[a.ID]
+		if !ok {
+			ra = len(order)
+		}
+		rb, ok := rank[b.ID]
+		if !ok {
+			rb = len(order)
+		}
+		return ra - rb
+	})
+}
+
 // resetFilepicker resets the filepicker to default directory-only mode
 func (m *RootModel) resetFilepicker() {
 	m.filepicker.FileAllowed = false
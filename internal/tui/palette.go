@@ -0,0 +1,272 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sahilm/fuzzy"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// paletteVisibleRows is how many matching commands the palette lists at once
+const paletteVisibleRows = 8
+
+// paletteQueryPlaceholder is shown in the palette input before typing
+const paletteQueryPlaceholder = "Type a command..."
+
+// paletteCommand is an action offered by the command palette. Commands with a
+// Key replay that dashboard binding; commands with a Prompt ask for a value
+// and pass it to Submit; the rest run their own action.
+type paletteCommand struct {
+	Name   string
+	Key    key.Binding
+	Action func(m *RootModel) tea.Cmd
+	Prompt string
+	Submit func(m *RootModel, value string) error
+}
+
+// paletteCommands lists every palette action, most common first
+func paletteCommands(k DashboardKeyMap) []paletteCommand {
+	return []paletteCommand{
+		{Name: "Add download", Key: k.Add},
+		{Name: "Batch import from file", Key: k.BatchImport},
+		{Name: "Search downloads", Key: k.Search},
+		{Name: "Pause all downloads", Key: k.PauseAll},
+		{Name: "Resume all downloads", Key: k.ResumeAll},
+		{Name: "Watch clipboard for links", Key: k.Clipboard},
+		{Name: "Delete download and move its file to trash", Key: k.DeleteFile},
+		{Name: "Move file to another directory", Key: k.MoveFile},
+		{Name: "Start selected download next", Action: paletteStartNext},
+		{Name: "Set speed limit", Prompt: "Total speed, e.g. 2MB/s (0 for none)", Submit: paletteSetSpeedLimit},
+		{Name: "Go to queued tab", Key: k.TabQueued},
+		{Name: "Go to active tab", Key: k.TabActive},
+		{Name: "Go to done tab", Key: k.TabDone},
+		{Name: "Show history", Key: k.History},
+		{Name: "Toggle log", Key: k.Log},
+		{Name: "Toggle engine stats", Key: k.Engine},
+		{Name: "Open settings", Key: k.Settings},
+		{Name: "Open config file", Action: paletteOpenConfig},
+		{Name: "Quit", Action: paletteQuit},
+	}
+}
+
+// paletteNames adapts commands to fuzzy.Source
+type paletteNames []paletteCommand
+
+func (p paletteNames) String(i int) string { return p[i].Name }
+func (p paletteNames) Len() int            { return len(p) }
+
+// matchPalette returns the commands matching query, best match first.
+// An empty query lists every command in its default order.
+func matchPalette(commands []paletteCommand, query string) []paletteCommand {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return commands
+	}
+	matches := fuzzy.FindFrom(query, paletteNames(commands))
+	result := make([]paletteCommand, len(matches))
+	for i, match := range matches {
+		result[i] = commands[match.Index]
+	}
+	return result
+}
+
+// updatePalette handles keys while the command palette is open
+func (m RootModel) updatePalette(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.palettePrompt != nil {
+		return m.updatePalettePrompt(msg)
+	}
+	matches := matchPalette(paletteCommands(m.keys.Dashboard), m.paletteInput.Value())
+
+	switch {
+	case key.Matches(msg, m.keys.Palette.Close):
+		m.state = DashboardState
+		m.paletteInput.Blur()
+		return m, nil
+
+	case key.Matches(msg, m.keys.Palette.Up):
+		if m.paletteCursor > 0 {
+			m.paletteCursor--
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Palette.Down):
+		if m.paletteCursor < len(matches)-1 {
+			m.paletteCursor++
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Palette.Run):
+		m.state = DashboardState
+		m.paletteInput.Blur()
+		if m.paletteCursor >= len(matches) {
+			return m, nil
+		}
+		return m.runPaletteCommand(matches[m.paletteCursor])
+	}
+
+	var cmd tea.Cmd
+	m.paletteInput, cmd = m.paletteInput.Update(msg)
+	m.paletteCursor = 0
+	return m, cmd
+}
+
+// updatePalettePrompt handles keys while a command asks for its value
+func (m RootModel) updatePalettePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Palette.Close):
+		m.closePalettePrompt()
+		return m, nil
+
+	case key.Matches(msg, m.keys.Palette.Run):
+		if err := m.palettePrompt.Submit(&m, m.paletteInput.Value()); err != nil {
+			m.addLogEntry(LogStyleError.Render("✖ " + err.Error()))
+		}
+		m.closePalettePrompt()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.paletteInput, cmd = m.paletteInput.Update(msg)
+	return m, cmd
+}
+
+// closePalettePrompt leaves the palette and restores its query input
+func (m *RootModel) closePalettePrompt() {
+	m.state = DashboardState
+	m.palettePrompt = nil
+	m.paletteInput.Placeholder = paletteQueryPlaceholder
+	m.paletteInput.SetValue("")
+	m.paletteInput.Blur()
+}
+
+// runPaletteCommand executes a command from the dashboard state
+func (m RootModel) runPaletteCommand(c paletteCommand) (tea.Model, tea.Cmd) {
+	if c.Submit != nil {
+		// Stay in the palette to ask for the value
+		m.state = PaletteState
+		m.palettePrompt = &c
+		m.paletteInput.Placeholder = c.Prompt
+		m.paletteInput.SetValue("")
+		m.paletteInput.Focus()
+		return m, nil
+	}
+	if c.Action != nil {
+		cmd := c.Action(&m)
+		return m, cmd
+	}
+	keys := c.Key.Keys()
+	if len(keys) == 0 {
+		return m, nil
+	}
+	return m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(keys[0])})
+}
+
+func paletteQuit(m *RootModel) tea.Cmd {
+	m.Pool.GracefulShutdown()
+	return tea.Quit
+}
+
+func paletteOpenConfig(m *RootModel) tea.Cmd {
+	// Make sure there is a file to open on first run
+	if err := config.SaveSettings(m.Settings); err != nil {
+		m.addLogEntry(LogStyleError.Render("✖ Could not write config: " + err.Error()))
+		return nil
+	}
+	path := config.GetSettingsPath()
+	if err := openBrowser(path); err != nil {
+		utils.Debug("Failed to open config file: %v", err)
+		m.addLogEntry(LogStyleError.Render("✖ Could not open " + path))
+	}
+	return nil
+}
+
+func paletteStartNext(m *RootModel) tea.Cmd {
+	if d := m.GetSelectedDownload(); d != nil {
+		m.Pool.MoveTo(d.ID, 0)
+		m.UpdateListItems()
+	}
+	return nil
+}
+
+// paletteSetSpeedLimit sets the total speed limit of running downloads and
+// saves it as the Speed Limit setting
+func paletteSetSpeedLimit(m *RootModel, value string) error {
+	rate, err := utils.ParseRate(value)
+	if err != nil {
+		return err
+	}
+	// The setting is in whole KB/s
+	kbps := int((rate + 1023) / 1024)
+	m.Settings.Connections.SpeedLimit = kbps
+	if m.Pool != nil {
+		m.Pool.SetSpeedLimit(m.Settings.Connections.SpeedLimitRate())
+	}
+	if err := config.SaveSettings(m.Settings); err != nil {
+		return fmt.Errorf("could not save speed limit: %w", err)
+	}
+	if kbps == 0 {
+		m.addLogEntry(LogStyleStarted.Render("⚙ Speed limit removed"))
+	} else {
+		m.addLogEntry(LogStyleStarted.Render("⚙ Speed limit set to " + utils.ConvertBytesToHumanReadable(m.Settings.Connections.SpeedLimitRate()) + "/s"))
+	}
+	return nil
+}
+
+// viewPalette renders the command palette modal
+func (m RootModel) viewPalette() string {
+	commands := paletteCommands(m.keys.Dashboard)
+	matches := matchPalette(commands, m.paletteInput.Value())
+
+	// Scroll so the cursor stays visible
+	start := 0
+	if m.paletteCursor >= paletteVisibleRows {
+		start = m.paletteCursor - paletteVisibleRows + 1
+	}
+	end := min(start+paletteVisibleRows, len(matches))
+
+	const width = 60
+	nameStyle := lipgloss.NewStyle().Width(width - 14).Foreground(ColorLightGray)
+	keyStyle := lipgloss.NewStyle().Foreground(ColorGray)
+
+	rows := []string{m.paletteInput.View(), ""}
+	if m.palettePrompt != nil {
+		// Asking for a value: show which command it is for instead of the list
+		matches, start, end = nil, 0, 0
+		rows = append(rows, lipgloss.NewStyle().Foreground(ColorNeonPink).Bold(true).Render("▌ "+m.palettePrompt.Name))
+	}
+	for i := start; i < end; i++ {
+		c := matches[i]
+		style := nameStyle
+		prefix := "  "
+		if i == m.paletteCursor {
+			style = style.Foreground(ColorNeonPink).Bold(true)
+			prefix = lipgloss.NewStyle().Foreground(ColorNeonPink).Render("▌ ")
+		}
+		hint := ""
+		if h := c.Key.Help(); h.Key != "" {
+			hint = keyStyle.Render(h.Key)
+		}
+		rows = append(rows, prefix+style.Render(c.Name)+hint)
+	}
+	shown := end - start
+	if m.palettePrompt != nil {
+		shown = 1
+	} else if shown == 0 {
+		rows = append(rows, lipgloss.NewStyle().Foreground(ColorGray).Render("  No matching commands"))
+		shown = 1
+	}
+	for i := shown; i < paletteVisibleRows; i++ {
+		rows = append(rows, "")
+	}
+	rows = append(rows, "", m.help.View(m.keys.Palette))
+
+	content := lipgloss.NewStyle().Padding(0, 2).Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+	box := renderBtopBox(PaneTitleStyle.Render(" Commands "), "", content, width, paletteVisibleRows+7, ColorNeonCyan)
+	return m.renderModalWithOverlay(box)
+}
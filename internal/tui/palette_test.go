@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+)
+
+func TestMatchPalette(t *testing.T) {
+	commands := paletteCommands(Keys.Dashboard)
+
+	if got := matchPalette(commands, ""); len(got) != len(commands) {
+		t.Errorf("empty query returned %d commands, want all %d", len(got), len(commands))
+	}
+
+	got := matchPalette(commands, "pse all")
+	if len(got) == 0 || got[0].Name != "Pause all downloads" {
+		t.Errorf("fuzzy match for 'pse all' = %v", got)
+	}
+
+	if got := matchPalette(commands, "zzzz"); len(got) != 0 {
+		t.Errorf("expected no matches, got %d", len(got))
+	}
+}
+
+func TestPalette_RunsDashboardBinding(t *testing.T) {
+	m := RootModel{
+		Settings:     config.DefaultSettings(),
+		keys:         Keys,
+		list:         NewDownloadList(40, 10),
+		logViewport:  viewport.New(40, 5),
+		paletteInput: textinput.New(),
+	}
+
+	newM, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(":")})
+	m = newM.(RootModel)
+	if m.state != PaletteState {
+		t.Fatalf("expected PaletteState after ':', got %v", m.state)
+	}
+
+	for _, r := range "settings" {
+		newM, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = newM.(RootModel)
+	}
+	newM, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = newM.(RootModel)
+
+	if m.state != SettingsState {
+		t.Errorf("expected SettingsState after running 'settings', got %v", m.state)
+	}
+}
+
+func TestPalette_SetSpeedLimit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	m := RootModel{
+		Settings:     config.DefaultSettings(),
+		keys:         Keys,
+		list:         NewDownloadList(40, 10),
+		logViewport:  viewport.New(40, 5),
+		paletteInput: textinput.New(),
+		Pool:         download.NewWorkerPool(nil, 1),
+	}
+	typeKeys := func(s string) {
+		for _, r := range s {
+			newM, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			m = newM.(RootModel)
+		}
+	}
+	enter := func() {
+		newM, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		m = newM.(RootModel)
+	}
+
+	typeKeys(":")
+	typeKeys("speed limit")
+	enter()
+	if m.state != PaletteState || m.palettePrompt == nil {
+		t.Fatalf("expected the palette to ask for a speed, state %v", m.state)
+	}
+	typeKeys("2MB/s")
+	enter()
+
+	if m.state != DashboardState || m.palettePrompt != nil {
+		t.Errorf("expected the dashboard after the prompt, state %v", m.state)
+	}
+	if m.Settings.Connections.SpeedLimit != 2048 {
+		t.Errorf("SpeedLimit = %d KB/s, want 2048", m.Settings.Connections.SpeedLimit)
+	}
+	if m.Pool.SpeedLimit() != 2<<20 {
+		t.Errorf("pool limit = %d, want %d", m.Pool.SpeedLimit(), 2<<20)
+	}
+	saved, err := config.LoadSettings()
+	if err != nil || saved.Connections.SpeedLimit != 2048 {
+		t.Errorf("saved SpeedLimit = %v (%v), want 2048", saved.Connections.SpeedLimit, err)
+	}
+
+	// A bad value changes nothing
+	typeKeys(":")
+	typeKeys("speed limit")
+	enter()
+	typeKeys("fast")
+	enter()
+	if m.Settings.Connections.SpeedLimit != 2048 {
+		t.Errorf("SpeedLimit after a bad value = %d, want 2048", m.Settings.Connections.SpeedLimit)
+	}
+}
@@ -5,83 +5,78 @@ import (
 
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/progress"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-const (
-	DefaultPollInterval = 150 * time.Millisecond
-	SpeedSmoothingAlpha = 0.3 // EMA smoothing factor
-)
-
 type ProgressReporter struct {
-	state        *types.ProgressState
+	tracker      *progress.Tracker
 	pollInterval time.Duration
-	lastSpeed    float64
 }
 
 func NewProgressReporter(state *types.ProgressState) *ProgressReporter {
 	return &ProgressReporter{
-		state:        state,
-		pollInterval: DefaultPollInterval,
-		lastSpeed:    0,
+		tracker:      progress.NewTracker(state.ID, stateSource{state}),
+		pollInterval: progress.DefaultPollInterval,
 	}
 }
 
+// stateSource samples the progress of a download running in this process
+type stateSource struct {
+	state *types.ProgressState
+}
+
+func (s stateSource) Sample() (progress.Sample, error) {
+	s.state.RecordSpeed(time.Now())
+	downloaded, total, totalElapsed, sessionElapsed, connections, sessionStart := s.state.GetProgress()
+	return progress.Sample{
+		Downloaded:     downloaded,
+		Total:          total,
+		Elapsed:        totalElapsed,
+		SessionElapsed: sessionElapsed,
+		SessionStart:   sessionStart,
+		Connections:    int(connections),
+		Retries:        s.state.Retries.Load(),
+		Done:           s.state.Done.Load(),
+		Err:            s.state.GetError(),
+	}, nil
+}
+
 // PollCmd returns a tea.Cmd that polls the progress state after the interval
 func (r *ProgressReporter) PollCmd() tea.Cmd {
 	return tea.Tick(r.pollInterval, func(t time.Time) tea.Msg {
+		snap := r.tracker.Poll()
+
 		// Check if download is done
-		if r.state.Done.Load() {
-			elapsed := time.Since(r.state.StartTime)
-			// Ensure we use the total elapsed (saved + session)
-			if r.state.SavedElapsed > 0 {
-				elapsed += r.state.SavedElapsed
-			}
-			total := r.state.TotalSize
+		if snap.Done {
+			total := snap.Total
 			if total <= 0 {
-				total = r.state.Downloaded.Load()
+				total = snap.Downloaded
 			}
 			return events.DownloadCompleteMsg{
-				DownloadID: r.state.ID,
-				Elapsed:    elapsed,
+				DownloadID: snap.ID,
+				Elapsed:    snap.Elapsed,
 				Total:      total,
 			}
 		}
 
 		// Check for errors
-		if err := r.state.GetError(); err != nil {
+		if snap.Err != nil {
 			return events.DownloadErrorMsg{
-				DownloadID: r.state.ID,
-				Err:        err,
+				DownloadID: snap.ID,
+				Err:        snap.Err,
 			}
 		}
 
-		// Get current progress
-		downloaded, total, totalElapsed, sessionElapsed, connections, sessionStart := r.state.GetProgress()
-
-		// Calculate speed with EMA smoothing
-		// Use session-specific bytes to avoid speed spike on resume
-		sessionDownloaded := downloaded - sessionStart
-		var instantSpeed float64
-		// Use sessionElapsed for speed calculation
-		if sessionElapsed.Seconds() > 0 && sessionDownloaded > 0 {
-			instantSpeed = float64(sessionDownloaded) / sessionElapsed.Seconds()
-		}
-
-		if r.lastSpeed == 0 {
-			r.lastSpeed = instantSpeed
-		} else {
-			r.lastSpeed = SpeedSmoothingAlpha*instantSpeed + (1-SpeedSmoothingAlpha)*r.lastSpeed
-		}
-
 		return events.ProgressMsg{
-			DownloadID:        r.state.ID,
-			Downloaded:        downloaded,
-			Total:             total,
-			Speed:             r.lastSpeed,
-			Elapsed:           totalElapsed, // Send total elapsed for UI
-			ActiveConnections: int(connections),
+			DownloadID:        snap.ID,
+			Downloaded:        snap.Downloaded,
+			Total:             snap.Total,
+			Speed:             snap.Speed,
+			Elapsed:           snap.Elapsed, // Send total elapsed for UI
+			ActiveConnections: snap.Connections,
+			Retries:           snap.Retries,
 		}
 	})
 }
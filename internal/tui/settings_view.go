@@ -3,11 +3,14 @@ package tui
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/tui/components"
 
 	"github.com/charmbracelet/lipgloss"
@@ -63,21 +66,9 @@ func (m RootModel) viewSettings() string {
 		// Highlight selected row with better visual treatment
 		if i == m.SettingsSelectedRow {
 			style := lipgloss.NewStyle().Foreground(ColorNeonPurple).Bold(true)
-			cursor := "▸ "
-
-			if meta.Key == "max_global_connections" {
-				style = lipgloss.NewStyle().Foreground(ColorGray)
-				cursor = "# "
-			}
-
-			line = style.Render(cursor + line)
+			line = style.Render("▸ " + line)
 		} else {
 			style := lipgloss.NewStyle().Foreground(ColorLightGray)
-
-			if meta.Key == "max_global_connections" {
-				style = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#aaaaaa", Dark: "238"}) // Darker gray
-			}
-
 			line = style.Render("  " + line)
 		}
 
@@ -112,10 +103,6 @@ func (m RootModel) viewSettings() string {
 		} else {
 			// Show formatted value with unit
 			valueStr = formatSettingValueForEdit(value, meta.Type, meta.Key) + unitStyle.Render(unit)
-
-			if meta.Key == "max_global_connections" {
-				valueStr += " (Ignored)"
-			}
 		}
 
 		// Show Tab hint for directory settings
@@ -220,22 +207,46 @@ func (m RootModel) getSettingsValues(category string) map[string]interface{} {
 		values["clipboard_monitor"] = m.Settings.General.ClipboardMonitor
 		values["theme"] = m.Settings.General.Theme
 		values["log_retention_count"] = m.Settings.General.LogRetentionCount
+		values["keep_partial_on_cancel"] = m.Settings.General.KeepPartialOnCancel
+		values["part_files_in_subdir"] = m.Settings.General.PartFilesInSubdir
+		values["write_strategy"] = m.Settings.General.WriteStrategy
+		values["sparse_files"] = m.Settings.General.SparseFiles
+		values["mark_executable"] = m.Settings.General.MarkExecutable
+		values["fix_extensions"] = m.Settings.General.FixExtensions
+		values["notify"] = m.Settings.General.AfterDownload.Notify
+		values["clear_completed_after"] = m.Settings.General.ClearCompletedAfter
+		values["sort_into_folders"] = m.Settings.General.SortIntoFolders
+		values["max_filename_length"] = m.Settings.General.MaxFilenameLength
+		values["filename_truncation"] = m.Settings.General.FilenameTruncation
 
 	case "Connections":
 		values["max_connections_per_host"] = m.Settings.Connections.MaxConnectionsPerHost
+		values["adaptive_connections"] = m.Settings.Connections.AdaptiveConnections
 		values["max_global_connections"] = m.Settings.Connections.MaxGlobalConnections
+		values["speed_limit"] = m.Settings.Connections.SpeedLimit
+		values["scheduling_policy"] = m.Settings.Connections.SchedulingPolicy
 		values["user_agent"] = m.Settings.Connections.UserAgent
+		values["max_redirects"] = m.Settings.Connections.MaxRedirects
+		values["block_private_networks"] = m.Settings.Connections.BlockPrivateNetworks
+		values["proxy"] = m.Settings.Connections.Proxy
+		values["ssh_identity_file"] = m.Settings.Connections.SSHIdentityFile
+		values["ssh_known_hosts"] = m.Settings.Connections.SSHKnownHosts
 	case "Chunks":
 		values["min_chunk_size"] = m.Settings.Chunks.MinChunkSize
 		values["max_chunk_size"] = m.Settings.Chunks.MaxChunkSize
 		values["target_chunk_size"] = m.Settings.Chunks.TargetChunkSize
 		values["worker_buffer_size"] = m.Settings.Chunks.WorkerBufferSize
+		values["max_buffer_memory"] = m.Settings.Chunks.MaxBufferMemory
 	case "Performance":
 		values["max_task_retries"] = m.Settings.Performance.MaxTaskRetries
 		values["slow_worker_threshold"] = m.Settings.Performance.SlowWorkerThreshold
 		values["slow_worker_grace_period"] = m.Settings.Performance.SlowWorkerGracePeriod
 		values["stall_timeout"] = m.Settings.Performance.StallTimeout
 		values["speed_ema_alpha"] = m.Settings.Performance.SpeedEmaAlpha
+		values["retry_base_delay"] = m.Settings.Performance.RetryBaseDelay
+		values["retry_max_delay"] = m.Settings.Performance.RetryMaxDelay
+		values["retry_jitter"] = m.Settings.Performance.RetryJitter
+		values["autosave_interval"] = m.Settings.Performance.AutosaveInterval
 	}
 
 	return values
@@ -282,14 +293,25 @@ func (m *RootModel) setGeneralSetting(key, value, typ string) error {
 		m.Settings.General.SkipUpdateCheck = !m.Settings.General.SkipUpdateCheck
 	case "clipboard_monitor":
 		m.Settings.General.ClipboardMonitor = !m.Settings.General.ClipboardMonitor
+	case "keep_partial_on_cancel":
+		m.Settings.General.KeepPartialOnCancel = !m.Settings.General.KeepPartialOnCancel
+	case "part_files_in_subdir":
+		m.Settings.General.PartFilesInSubdir = !m.Settings.General.PartFilesInSubdir
+	case "sparse_files":
+		m.Settings.General.SparseFiles = !m.Settings.General.SparseFiles
+	case "mark_executable":
+		m.Settings.General.MarkExecutable = !m.Settings.General.MarkExecutable
+	case "fix_extensions":
+		m.Settings.General.FixExtensions = !m.Settings.General.FixExtensions
+	case "sort_into_folders":
+		m.Settings.General.SortIntoFolders = !m.Settings.General.SortIntoFolders
+	case "notify":
+		m.Settings.General.AfterDownload.Notify = !m.Settings.General.AfterDownload.Notify
+		m.applyNotify()
 	case "max_concurrent_downloads":
 		if v, err := strconv.Atoi(value); err == nil {
-			if v < 1 {
-				v = 1
-			} else if v > 10 {
-				v = 10
-			}
-			m.Settings.General.MaxConcurrentDownloads = v
+			m.Settings.General.MaxConcurrentDownloads = max(1, min(v, download.MaxWorkers))
+			m.applyMaxDownloads()
 		}
 	case "theme":
 		var theme int
@@ -321,6 +343,17 @@ func (m *RootModel) setGeneralSetting(key, value, typ string) error {
 			}
 			m.Settings.General.LogRetentionCount = v
 		}
+	case "clear_completed_after":
+		if v, err := strconv.Atoi(value); err == nil {
+			m.Settings.General.ClearCompletedAfter = max(v, 0)
+			m.clearExpiredCompleted(time.Now())
+		}
+	case "max_filename_length":
+		if v, err := strconv.Atoi(value); err == nil {
+			m.Settings.General.MaxFilenameLength = min(max(v, types.MinFilenameLength), 255)
+		}
+	case "filename_truncation":
+		m.Settings.General.FilenameTruncation = value
 	}
 	return nil
 }
@@ -331,12 +364,37 @@ func (m *RootModel) setConnectionsSetting(key, value, typ string) error {
 		if v, err := strconv.Atoi(value); err == nil {
 			m.Settings.Connections.MaxConnectionsPerHost = v
 		}
+	case "adaptive_connections":
+		m.Settings.Connections.AdaptiveConnections = !m.Settings.Connections.AdaptiveConnections
 	case "max_global_connections":
 		if v, err := strconv.Atoi(value); err == nil {
 			m.Settings.Connections.MaxGlobalConnections = v
 		}
+	case "speed_limit":
+		if v, err := strconv.Atoi(value); err == nil && v >= 0 {
+			m.Settings.Connections.SpeedLimit = v
+		}
+	case "scheduling_policy":
+		if !slices.Contains(types.SchedulingPolicies, value) {
+			return fmt.Errorf("unknown scheduling policy %q: use %s", value, strings.Join(types.SchedulingPolicies, ", "))
+		}
+		m.Settings.Connections.SchedulingPolicy = value
+	case "write_strategy":
+		m.Settings.General.WriteStrategy = value
 	case "user_agent":
 		m.Settings.Connections.UserAgent = value
+	case "ssh_identity_file":
+		m.Settings.Connections.SSHIdentityFile = value
+	case "ssh_known_hosts":
+		m.Settings.Connections.SSHKnownHosts = value
+	case "max_redirects":
+		if v, err := strconv.Atoi(value); err == nil {
+			m.Settings.Connections.MaxRedirects = v
+		}
+	case "block_private_networks":
+		m.Settings.Connections.BlockPrivateNetworks = !m.Settings.Connections.BlockPrivateNetworks
+	case "proxy":
+		m.Settings.Connections.Proxy = value
 	}
 	return nil
 }
@@ -361,6 +419,10 @@ func (m *RootModel) setChunksSetting(key, value, typ string) error {
 		if v, err := strconv.ParseFloat(value, 64); err == nil {
 			m.Settings.Chunks.WorkerBufferSize = int(v * 1024)
 		}
+	case "max_buffer_memory":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			m.Settings.Chunks.MaxBufferMemory = int64(v * 1024 * 1024)
+		}
 	}
 	return nil
 }
@@ -407,6 +469,31 @@ func (m *RootModel) setPerformanceSetting(key, value, typ string) error {
 			}
 			m.Settings.Performance.SpeedEmaAlpha = v
 		}
+	case "retry_base_delay", "retry_max_delay":
+		// Check if it's just a number, if so add "s"
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "s"
+		}
+		if v, err := time.ParseDuration(value); err == nil && v > 0 {
+			if key == "retry_base_delay" {
+				m.Settings.Performance.RetryBaseDelay = v
+			} else {
+				m.Settings.Performance.RetryMaxDelay = v
+			}
+		}
+	case "retry_jitter":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			// Clamp to valid range 0.0-1.0
+			m.Settings.Performance.RetryJitter = min(max(v, 0.0), 1.0)
+		}
+	case "autosave_interval":
+		// Check if it's just a number, if so add "s"
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "s"
+		}
+		if v, err := time.ParseDuration(value); err == nil && v > 0 {
+			m.Settings.Performance.AutosaveInterval = v
+		}
 	}
 	return nil
 }
@@ -449,15 +536,19 @@ func (m RootModel) getSettingsCount() int {
 func (m RootModel) getSettingUnit() string {
 	key := m.getCurrentSettingKey()
 	switch key {
-	case "min_chunk_size", "max_chunk_size", "target_chunk_size":
+	case "min_chunk_size", "max_chunk_size", "target_chunk_size", "max_buffer_memory":
 		return " MB"
 	case "worker_buffer_size":
 		return " KB"
+	case "speed_limit":
+		return " KB/s"
 	case "max_task_retries":
 		return " retries"
-	case "slow_worker_grace_period", "stall_timeout":
+	case "max_filename_length":
+		return " bytes"
+	case "slow_worker_grace_period", "stall_timeout", "retry_base_delay", "retry_max_delay", "autosave_interval":
 		return " seconds"
-	case "slow_worker_threshold", "speed_ema_alpha":
+	case "slow_worker_threshold", "speed_ema_alpha", "retry_jitter":
 		return " (0.0-1.0)"
 	default:
 		return ""
@@ -467,7 +558,7 @@ func (m RootModel) getSettingUnit() string {
 // formatSettingValueForEdit returns a plain value without units for editing
 func formatSettingValueForEdit(value interface{}, typ, key string) string {
 	switch key {
-	case "min_chunk_size", "max_chunk_size", "target_chunk_size":
+	case "min_chunk_size", "max_chunk_size", "target_chunk_size", "max_buffer_memory":
 		if v, ok := value.(int64); ok {
 			mb := float64(v) / (1024 * 1024)
 			return fmt.Sprintf("%.1f", mb)
@@ -478,11 +569,16 @@ func formatSettingValueForEdit(value interface{}, typ, key string) string {
 			kb := float64(v.Int()) / 1024
 			return fmt.Sprintf("%.0f", kb)
 		}
-	case "slow_worker_grace_period", "stall_timeout":
+	case "slow_worker_grace_period", "stall_timeout", "autosave_interval":
 		// Show duration as plain seconds number (e.g., "5" instead of "5s")
 		if d, ok := value.(time.Duration); ok {
 			return fmt.Sprintf("%.0f", d.Seconds())
 		}
+	case "retry_base_delay", "retry_max_delay":
+		// Retry delays are often below a second
+		if d, ok := value.(time.Duration); ok {
+			return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+		}
 	}
 
 	if key == "theme" {
@@ -575,22 +671,62 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.General.SkipUpdateCheck = defaults.General.SkipUpdateCheck
 		case "max_concurrent_downloads":
 			m.Settings.General.MaxConcurrentDownloads = defaults.General.MaxConcurrentDownloads
+			m.applyMaxDownloads()
 		case "clipboard_monitor":
 			m.Settings.General.ClipboardMonitor = defaults.General.ClipboardMonitor
 		case "theme":
 			m.Settings.General.Theme = defaults.General.Theme
 		case "log_retention_count":
 			m.Settings.General.LogRetentionCount = defaults.General.LogRetentionCount
+		case "notify":
+			m.Settings.General.AfterDownload.Notify = defaults.General.AfterDownload.Notify
+			m.applyNotify()
+		case "clear_completed_after":
+			m.Settings.General.ClearCompletedAfter = defaults.General.ClearCompletedAfter
+		case "sort_into_folders":
+			m.Settings.General.SortIntoFolders = defaults.General.SortIntoFolders
+		case "max_filename_length":
+			m.Settings.General.MaxFilenameLength = defaults.General.MaxFilenameLength
+		case "filename_truncation":
+			m.Settings.General.FilenameTruncation = defaults.General.FilenameTruncation
+		case "keep_partial_on_cancel":
+			m.Settings.General.KeepPartialOnCancel = defaults.General.KeepPartialOnCancel
+		case "part_files_in_subdir":
+			m.Settings.General.PartFilesInSubdir = defaults.General.PartFilesInSubdir
+		case "write_strategy":
+			m.Settings.General.WriteStrategy = defaults.General.WriteStrategy
+		case "sparse_files":
+			m.Settings.General.SparseFiles = defaults.General.SparseFiles
+		case "mark_executable":
+			m.Settings.General.MarkExecutable = defaults.General.MarkExecutable
+		case "fix_extensions":
+			m.Settings.General.FixExtensions = defaults.General.FixExtensions
 		}
 
 	case "Connections":
 		switch key {
 		case "max_connections_per_host":
 			m.Settings.Connections.MaxConnectionsPerHost = defaults.Connections.MaxConnectionsPerHost
+		case "adaptive_connections":
+			m.Settings.Connections.AdaptiveConnections = defaults.Connections.AdaptiveConnections
 		case "max_global_connections":
 			m.Settings.Connections.MaxGlobalConnections = defaults.Connections.MaxGlobalConnections
+		case "speed_limit":
+			m.Settings.Connections.SpeedLimit = defaults.Connections.SpeedLimit
+		case "scheduling_policy":
+			m.Settings.Connections.SchedulingPolicy = defaults.Connections.SchedulingPolicy
 		case "user_agent":
 			m.Settings.Connections.UserAgent = defaults.Connections.UserAgent
+		case "max_redirects":
+			m.Settings.Connections.MaxRedirects = defaults.Connections.MaxRedirects
+		case "block_private_networks":
+			m.Settings.Connections.BlockPrivateNetworks = defaults.Connections.BlockPrivateNetworks
+		case "proxy":
+			m.Settings.Connections.Proxy = defaults.Connections.Proxy
+		case "ssh_identity_file":
+			m.Settings.Connections.SSHIdentityFile = defaults.Connections.SSHIdentityFile
+		case "ssh_known_hosts":
+			m.Settings.Connections.SSHKnownHosts = defaults.Connections.SSHKnownHosts
 		}
 	case "Chunks":
 		switch key {
@@ -602,6 +738,8 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.Chunks.TargetChunkSize = defaults.Chunks.TargetChunkSize
 		case "worker_buffer_size":
 			m.Settings.Chunks.WorkerBufferSize = defaults.Chunks.WorkerBufferSize
+		case "max_buffer_memory":
+			m.Settings.Chunks.MaxBufferMemory = defaults.Chunks.MaxBufferMemory
 		}
 	case "Performance":
 		switch key {
@@ -615,6 +753,32 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.Performance.StallTimeout = defaults.Performance.StallTimeout
 		case "speed_ema_alpha":
 			m.Settings.Performance.SpeedEmaAlpha = defaults.Performance.SpeedEmaAlpha
+		case "retry_base_delay":
+			m.Settings.Performance.RetryBaseDelay = defaults.Performance.RetryBaseDelay
+		case "retry_max_delay":
+			m.Settings.Performance.RetryMaxDelay = defaults.Performance.RetryMaxDelay
+		case "retry_jitter":
+			m.Settings.Performance.RetryJitter = defaults.Performance.RetryJitter
+		case "autosave_interval":
+			m.Settings.Performance.AutosaveInterval = defaults.Performance.AutosaveInterval
 		}
 	}
 }
+
+// applyMaxDownloads starts or stops workers to match the setting, so it takes
+// effect without a restart
+func (m *RootModel) applyMaxDownloads() {
+	if m.Pool != nil {
+		m.Pool.SetMaxDownloads(m.Settings.General.MaxConcurrentDownloads)
+	}
+}
+
+// applyNotify turns the pool's desktop notifications on or off to match the
+// setting, so it takes effect without a restart
+func (m *RootModel) applyNotify() {
+	if m.Pool != nil {
+		actions := m.Pool.Actions()
+		actions.Notify = m.Settings.General.AfterDownload.Notify
+		m.Pool.SetActions(actions)
+	}
+}
@@ -106,4 +106,10 @@ var (
 
 	LogStylePaused = lipgloss.NewStyle().
 			Foreground(ColorStatePaused)
+
+	LogStyleWarning = lipgloss.NewStyle().
+			Foreground(ColorStatePaused)
+
+	LogStyleRemoved = lipgloss.NewStyle().
+			Foreground(ColorLightGray)
 )
@@ -2,19 +2,29 @@ package tui
 
 import (
 	"bufio"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/clipboard"
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/credentials"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/hooks"
+	"github.com/surge-downloader/surge/internal/oauth"
+	"github.com/surge-downloader/surge/internal/plugins"
 	"github.com/surge-downloader/surge/internal/utils"
 	"github.com/surge-downloader/surge/internal/version"
 
@@ -22,12 +32,53 @@ import (
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/google/uuid"
 )
 
 // notificationTickMsg is sent to check if a notification should be cleared
 type notificationTickMsg struct{}
 
+// clearCompletedTickMsg is sent every minute to move expired completed
+// downloads out of the list
+type clearCompletedTickMsg struct{}
+
+func clearCompletedTickCmd() tea.Cmd {
+	return tea.Tick(time.Minute, func(time.Time) tea.Msg {
+		return clearCompletedTickMsg{}
+	})
+}
+
+// clipboardTickMsg carries the URL on the clipboard, read every second while
+// watching it, or "" if there is none
+type clipboardTickMsg struct {
+	gen int
+	url string
+}
+
+func clipboardTickCmd(gen int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return clipboardTickMsg{gen: gen, url: clipboard.ReadURL()}
+	})
+}
+
+// fileMoveFailedMsg reports that the file of a completed download could
+// not be moved; success is reported as events.DownloadMovedMsg
+type fileMoveFailedMsg struct {
+	filename string
+	err      error
+}
+
+// moveFileCmd moves the file of completed download id into dir in the
+// background, as a copy across filesystems can take a while
+func moveFileCmd(id, path, dir string) tea.Cmd {
+	return func() tea.Msg {
+		dest, err := download.MoveFile(id, path, dir)
+		if err != nil {
+			return fileMoveFailedMsg{filename: filepath.Base(path), err: err}
+		}
+		return events.DownloadMovedMsg{DownloadID: id, Filename: filepath.Base(dest), DestPath: dest}
+	}
+}
+
 // UpdateCheckResultMsg is sent when the update check is complete
 type UpdateCheckResultMsg struct {
 	Info *version.UpdateInfo
@@ -66,17 +117,36 @@ func openBrowser(url string) error {
 func convertRuntimeConfig(rc *config.RuntimeConfig) *types.RuntimeConfig {
 	return &types.RuntimeConfig{
 		MaxConnectionsPerHost: rc.MaxConnectionsPerHost,
+		AdaptiveConnections:   rc.AdaptiveConnections,
 		MaxGlobalConnections:  rc.MaxGlobalConnections,
 		UserAgent:             rc.UserAgent,
 		MinChunkSize:          rc.MinChunkSize,
 		MaxChunkSize:          rc.MaxChunkSize,
 		TargetChunkSize:       rc.TargetChunkSize,
 		WorkerBufferSize:      rc.WorkerBufferSize,
+		MaxBufferMemory:       rc.MaxBufferMemory,
 		MaxTaskRetries:        rc.MaxTaskRetries,
 		SlowWorkerThreshold:   rc.SlowWorkerThreshold,
 		SlowWorkerGracePeriod: rc.SlowWorkerGracePeriod,
 		StallTimeout:          rc.StallTimeout,
 		SpeedEmaAlpha:         rc.SpeedEmaAlpha,
+		RetryBaseDelay:        rc.RetryBaseDelay,
+		RetryMaxDelay:         rc.RetryMaxDelay,
+		RetryJitter:           rc.RetryJitter,
+		CheckpointInterval:    rc.CheckpointInterval,
+		PartFilesInSubdir:     rc.PartFilesInSubdir,
+		WriteStrategy:         rc.WriteStrategy,
+		SparseFiles:           rc.SparseFiles,
+		MaxFilenameLength:     rc.MaxFilenameLength,
+		FilenameTruncation:    rc.FilenameTruncation,
+		BlockPrivateNetworks:  rc.BlockPrivateNetworks,
+		AllowedNetworks:       rc.AllowedNetworks,
+		MaxRedirects:          rc.MaxRedirects,
+		Proxy:                 rc.Proxy,
+		SSHIdentityFile:       rc.SSHIdentityFile,
+		SSHKnownHosts:         rc.SSHKnownHosts,
+		SSHUserKeys:           true, // The TUI only starts what its user asked for or approved
+		Authorizer:            types.JoinAuthorizers(credentials.NewAuthorizer(rc.Credentials), oauth.NewAuthorizer(rc.OAuth)),
 	}
 }
 
@@ -132,6 +202,32 @@ func (m *RootModel) addLogEntry(msg string) {
 	m.logViewport.GotoBottom()
 }
 
+// setStatus shows msg in the footer for StatusDuration
+func (m *RootModel) setStatus(msg string) {
+	m.status = msg
+	m.statusUntil = time.Now().Add(StatusDuration)
+}
+
+// removedLogEntry formats the log line for a removed download, including disk space freed
+func removedLogEntry(filename string, reclaimed int64, kept bool) string {
+	switch {
+	case kept:
+		return LogStyleRemoved.Render("🗑 Removed: " + filename + " (partial file kept)")
+	case reclaimed > 0:
+		return LogStyleRemoved.Render(fmt.Sprintf("🗑 Removed: %s (freed %s)", filename, utils.ConvertBytesToHumanReadable(reclaimed)))
+	default:
+		return LogStyleRemoved.Render("🗑 Removed: " + filename)
+	}
+}
+
+// reportRemoved logs a removed download and shows it, with the space freed,
+// in the footer
+func (m *RootModel) reportRemoved(filename string, reclaimed int64, kept bool) {
+	entry := removedLogEntry(filename, reclaimed, kept)
+	m.addLogEntry(entry)
+	m.setStatus(entry)
+}
+
 // checkForDuplicate checks if a compatible download already exists
 func (m RootModel) checkForDuplicate(url string) *DownloadModel {
 	if !m.Settings.General.WarnOnDuplicate {
@@ -151,18 +247,76 @@ func (m RootModel) checkForDuplicate(url string) *DownloadModel {
 	return nil
 }
 
-// startDownload initiates a new download
-func (m RootModel) startDownload(url string, mirrors []string, path, filename, id string) (RootModel, tea.Cmd) {
+// moveSelectedFile starts moving the file picked with m (see movingID) into
+// dir and returns to the dashboard
+func (m RootModel) moveSelectedFile(dir string) (RootModel, tea.Cmd) {
+	id := m.movingID
+	m.movingID = ""
+	m.state = DashboardState
+	for _, d := range m.downloads {
+		if d.ID == id {
+			m.addLogEntry(LogStyleStarted.Render("📁 Moving: " + d.Filename + " to " + dir))
+			return m, moveFileCmd(id, d.Destination, dir)
+		}
+	}
+	return m, nil
+}
+
+// downloadLimits are the add dialog's overrides for one download; zero
+// values leave the settings in charge
+type downloadLimits struct {
+	connections int   // Per-host connection limit
+	rateLimit   int64 // Bytes/sec
+}
+
+// startDownload initiates a new download.
+// limits override the connection and speed limits from settings when set.
+func (m RootModel) startDownload(url string, mirrors []string, path, filename, id string, limits downloadLimits) (RootModel, tea.Cmd) {
+	runtime := convertRuntimeConfig(m.Settings.ToRuntimeConfig())
+	if limits.connections > 0 {
+		runtime.MaxConnectionsPerHost = limits.connections
+	}
+	runtime = runtime.WithProxy(m.Pool.Proxy())
+
+	// Plugins go first so that they can take over hosts Surge resolves itself
+	res, err := plugins.ResolveURL(m.Pool.Plugins(), url, mirrors, filename)
+	if err != nil {
+		m.addLogEntry(LogStyleError.Render("✖ Not added: " + err.Error()))
+		return m, nil
+	}
+	url, mirrors, filename = res.URL, res.Mirrors, res.Filename
+
+	src, err := engine.ResolveSource(context.Background(), url, mirrors, filename, runtime)
+	if err != nil {
+		m.addLogEntry(LogStyleError.Render("✖ Not added: " + err.Error()))
+		return m, nil
+	}
+	url, mirrors, filename = src.URL, src.Mirrors, src.Filename
+
+	if err := m.Settings.CheckURL(append([]string{url}, mirrors...)...); err != nil {
+		m.addLogEntry(LogStyleError.Render("✖ Not added: " + err.Error()))
+		return m, nil
+	}
+
 	// Enforce absolute path
 	path = utils.EnsureAbsPath(path)
 
+	ev, err := hooks.Enqueue(m.Settings.General.Hooks.OnEnqueue, hooks.Event{
+		URL: url, Mirrors: mirrors, Filename: filename, Path: path,
+	})
+	if err != nil {
+		m.addLogEntry(LogStyleError.Render("✖ Not added: " + err.Error()))
+		return m, nil
+	}
+	filename, path = ev.Filename, ev.Path
+
 	// Generate unique filename to avoid overwriting
 	// Note: We do this check here because it applies to ALL new downloads
 	finalFilename := m.generateUniqueFilename(path, filename)
 
 	nextID := id
 	if nextID == "" {
-		nextID = uuid.New().String()
+		nextID = types.NewDownloadID()
 	}
 	newDownload := NewDownloadModel(nextID, url, "Queued", 0)
 	newDownload.Destination = filepath.Join(path, finalFilename) // Store absolute full path immediately
@@ -177,7 +331,12 @@ func (m RootModel) startDownload(url string, mirrors []string, path, filename, i
 		Verbose:    false,
 		ProgressCh: m.progressChan,
 		State:      newDownload.state,
-		Runtime:    convertRuntimeConfig(m.Settings.ToRuntimeConfig()),
+		Runtime:    runtime,
+
+		ExpectedSize: src.Size,
+		Cookies:      src.Cookies,
+		Torrent:      src.Torrent,
+		RateLimit:    limits.rateLimit,
 	}
 
 	utils.Debug("Adding to Queue: %s -> %s", url, finalFilename)
@@ -191,6 +350,38 @@ func (m RootModel) startDownload(url string, mirrors []string, path, filename, i
 }
 
 // Update handles messages and updates the model
+// resumeDownload re-adds a paused download to the pool and restarts its polling
+func (m *RootModel) resumeDownload(d *DownloadModel) tea.Cmd {
+	m.Pool.EndHold() // Resuming anything ends a pause-all
+	d.paused = false
+	d.state.Resume()
+	// Use the download's actual destination directory
+	outputPath := filepath.Dir(d.Destination)
+	if outputPath == "" || outputPath == "." {
+		outputPath = m.Settings.General.DefaultDownloadDir
+		if outputPath == "" {
+			outputPath = m.PWD
+		}
+	}
+	cfg := types.DownloadConfig{
+		URL:        d.URL,
+		OutputPath: outputPath,
+		DestPath:   d.Destination, // Full path for state lookup
+		ID:         d.ID,
+		Filename:   d.Filename,
+		Verbose:    false,
+		IsResume:   true, // Explicit resume - use saved state
+		ProgressCh: m.progressChan,
+		State:      d.state,
+		Runtime:    convertRuntimeConfig(m.Settings.ToRuntimeConfig()),
+	}
+	if saved, err := state.LoadState(d.URL, d.Destination); err == nil {
+		download.RestoreSettings(&cfg, saved)
+	}
+	m.Pool.Add(cfg)
+	return d.reporter.PollCmd()
+}
+
 func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
@@ -218,6 +409,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.pendingMirrors = nil
 			m.pendingPath = path
 			m.pendingFilename = msg.Filename
+			m.pendingLimits = downloadLimits{}
 			m.duplicateInfo = duplicate.Filename
 			m.state = DuplicateWarningState
 			return m, nil
@@ -229,6 +421,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.pendingMirrors = nil
 			m.pendingPath = path
 			m.pendingFilename = msg.Filename
+			m.pendingLimits = downloadLimits{}
 			m.state = ExtensionConfirmationState
 			return m, nil
 		}
@@ -237,7 +430,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// (Should not happen given root.go logic, but safe fallback)
 		// Fallback: Just start it if for some reason we got here without needing a prompt
 		// (Should not happen given root.go logic, but safe fallback)
-		return m.startDownload(msg.URL, nil, path, msg.Filename, msg.ID)
+		return m.startDownload(msg.URL, nil, path, msg.Filename, msg.ID, downloadLimits{})
 
 	case events.DownloadStartedMsg:
 
@@ -269,6 +462,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Update metadata for all matching downloads (including the one just added)
 		for _, d := range m.downloads {
 			if d.ID == msg.DownloadID {
+				// One that waited for its schedule here reports into the pool's state
+				if msg.State != nil && d.state != msg.State {
+					d.state = msg.State
+					d.reporter = NewProgressReporter(msg.State)
+				}
 				d.Filename = msg.Filename
 				d.Total = msg.Total
 				d.Destination = msg.DestPath
@@ -305,6 +503,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				d.Speed = msg.Speed
 				d.Elapsed = msg.Elapsed // Use total elapsed from engine
 				d.Connections = msg.ActiveConnections
+				d.Retries = msg.Retries
 
 				if d.Total > 0 {
 					percentage := float64(d.Downloaded) / float64(d.Total)
@@ -356,6 +555,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				d.Downloaded = d.Total
 				d.Elapsed = msg.Elapsed
 				d.done = true
+				d.completedAt = time.Now()
 				// Set progress to 100%
 				cmds = append(cmds, d.progress.SetPercent(1.0))
 
@@ -375,6 +575,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if d.ID == msg.DownloadID {
 				d.err = msg.Err
 				d.done = true
+				if errors.Is(msg.Err, download.ErrChecksumMismatch) {
+					d.checksum = checksumFailed
+				}
 				// Add log entry
 				m.addLogEntry(LogStyleError.Render("✖ Error: " + d.Filename))
 				break
@@ -398,6 +601,93 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.UpdateListItems()
 		return m, nil
 
+	case events.DownloadScheduledMsg:
+		var found *DownloadModel
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				found = d
+				break
+			}
+		}
+		// Downloads added from outside the TUI show up while they wait
+		if found == nil {
+			found = NewDownloadModel(msg.DownloadID, msg.URL, msg.Filename, 0)
+			found.paused = true
+			m.downloads = append(m.downloads, found)
+		}
+		found.startAt = msg.StartAt
+		found.phase = events.PhaseScheduled
+		found.pausing = false
+		if found.paused {
+			// Poll so the countdown keeps ticking
+			found.paused = false
+			cmds = append(cmds, found.reporter.PollCmd())
+		}
+		m.addLogEntry(LogStylePaused.Render("◷ Scheduled: " + msg.Filename + " for " + msg.StartAt.Format("2006-01-02 15:04")))
+		m.UpdateListItems()
+		return m, tea.Batch(cmds...)
+
+	case events.DownloadStateChangedMsg:
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				d.phase = msg.To
+				break
+			}
+		}
+		m.UpdateListItems()
+		return m, nil
+
+	case events.DownloadWarningMsg:
+		m.addLogEntry(LogStyleWarning.Render("⚠ " + msg.Filename + ": " + msg.Message))
+		return m, nil
+
+	case events.DownloadRemovedMsg:
+		m.reportRemoved(msg.Filename, msg.Reclaimed, msg.KeptPartial)
+		return m, nil
+
+	case events.DownloadMovedMsg:
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				d.Destination = msg.DestPath
+				break
+			}
+		}
+		m.addLogEntry(LogStyleComplete.Render("📁 Moved: " + msg.Filename + " to " + filepath.Dir(msg.DestPath)))
+		return m, nil
+
+	case events.ChecksumVerifiedMsg:
+		algo, _, _ := strings.Cut(msg.Checksum, ":")
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				d.checksum = checksumVerified
+				d.checksumType = algo
+				break
+			}
+		}
+		m.addLogEntry(LogStyleComplete.Render("🔒 Verified: " + msg.Filename + " (" + algo + ")"))
+		m.UpdateListItems()
+		return m, nil
+
+	case events.SignatureVerifiedMsg:
+		m.addLogEntry(LogStyleComplete.Render("🔏 Signed: " + msg.Filename + " by " + msg.Signer))
+		return m, nil
+
+	case events.ExtensionFixedMsg:
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				d.Filename = filepath.Base(msg.DestPath)
+				d.Destination = msg.DestPath
+				break
+			}
+		}
+		m.addLogEntry(LogStyleComplete.Render("🏷 Renamed: " + msg.Filename + " to " + filepath.Base(msg.DestPath)))
+		m.UpdateListItems()
+		return m, nil
+
+	case fileMoveFailedMsg:
+		m.addLogEntry(LogStyleError.Render(fmt.Sprintf("✖ Could not move %s: %v", msg.filename, msg.err)))
+		return m, nil
+
 	case events.DownloadResumedMsg:
 		for _, d := range m.downloads {
 			if d.ID == msg.DownloadID {
@@ -439,6 +729,28 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Notification tick is still used but logs don't expire
 		return m, nil
 
+	case clipboardTickMsg:
+		if !m.clipboardWatch || msg.gen != m.clipboardGen {
+			return m, nil
+		}
+		// A link copied while a dialog is open is offered once it closes
+		if msg.url != "" && msg.url != m.clipboardLast && m.state == DashboardState {
+			m.clipboardLast = msg.url
+			if clipboard.Downloadable(msg.url) {
+				m.pendingURL = msg.url
+				m.pendingMirrors = nil
+				m.pendingPath = cmp.Or(m.Settings.General.DefaultDownloadDir, ".")
+				m.pendingFilename = ""
+				m.pendingLimits = downloadLimits{}
+				m.state = ClipboardConfirmationState
+			}
+		}
+		return m, clipboardTickCmd(m.clipboardGen)
+
+	case clearCompletedTickMsg:
+		m.clearExpiredCompleted(time.Now())
+		return m, clearCompletedTickCmd()
+
 	case UpdateCheckResultMsg:
 		// Handle update check result
 		if msg.Info != nil && msg.Info.UpdateAvailable {
@@ -455,6 +767,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// Check if a directory was selected
 			if didSelect, path := m.filepicker.DidSelectFile(msg); didSelect {
+				if m.movingID != "" {
+					return m.moveSelectedFile(path)
+				}
 				// Check if we were browsing for settings
 				if m.SettingsFileBrowsing {
 					m.Settings.General.DefaultDownloadDir = path
@@ -595,6 +910,10 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.inputs[3].Blur()
 				m.inputs[1].SetValue("") // Clear mirrors
 				m.inputs[1].Blur()
+				m.inputs[4].SetValue("") // Clear connections override
+				m.inputs[4].Blur()
+				m.inputs[5].SetValue("") // Clear speed limit
+				m.inputs[5].Blur()
 
 				// Check clipboard for URL if setting is enabled
 				if m.Settings.General.ClipboardMonitor {
@@ -619,11 +938,21 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			// Delete download
-			if key.Matches(msg, m.keys.Dashboard.Delete) {
+			if key.Matches(msg, m.keys.Dashboard.Delete, m.keys.Dashboard.DeleteFile) {
 				// Don't process delete if list is filtering
 				if m.list.FilterState() == list.Filtering {
 					// Fall through to let list handle it
 				} else if d := m.GetSelectedDownload(); d != nil {
+					// X also moves a completed file to the trash; the entry
+					// stays if that fails, so nothing is lost
+					if key.Matches(msg, m.keys.Dashboard.DeleteFile) && d.done && d.err == nil && d.Destination != "" {
+						if err := download.DeleteFile(d.Destination, false); err != nil {
+							m.addLogEntry(LogStyleError.Render(fmt.Sprintf("✖ Could not move %s to trash: %v (surge rm --delete-file --permanent deletes it for good)", d.Filename, err)))
+							return m, nil
+						}
+						m.addLogEntry(LogStyleRemoved.Render("🗑 Moved to trash: " + d.Filename))
+					}
+
 					targetID := d.ID
 
 					// Find index in real list
@@ -638,25 +967,15 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if realIdx != -1 {
 						dl := m.downloads[realIdx]
 
-						// Cancel if active
-						m.Pool.Cancel(dl.ID)
-
-						// Delete state files
-						if dl.URL != "" && dl.Destination != "" {
-							_ = state.DeleteState(dl.ID, dl.URL, dl.Destination)
-						}
-
-						// Delete partial/incomplete files (only for non-completed downloads)
-						if !dl.done && dl.Destination != "" {
-							// Delete the .surge partial file with retries
-							// (worker may still hold file briefly after Cancel on Windows)
-							surgeFile := dl.Destination + types.IncompleteSuffix
-							for i := 0; i < 5; i++ {
-								if err := os.Remove(surgeFile); err == nil {
-									break
-								}
-								time.Sleep(50 * time.Millisecond)
+						// Cancel if active; the pool cleans up and reports via DownloadRemovedMsg
+						if !m.Pool.Cancel(dl.ID) && !dl.done {
+							// Not in the pool (e.g. paused in an earlier session): clean up here
+							keep := m.Settings.General.KeepPartialOnCancel
+							reclaimed, err := download.CleanupPartial(dl.ID, dl.URL, dl.Destination, keep)
+							if err != nil {
+								utils.Debug("Failed to clean up %s: %v", dl.ID, err)
 							}
+							m.reportRemoved(dl.Filename, reclaimed, keep)
 						}
 
 						// Remove completed downloads from master list (for Done tab persistence)
@@ -672,6 +991,29 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 
+			// Move a completed file: pick the directory first
+			if key.Matches(msg, m.keys.Dashboard.MoveFile) {
+				if d := m.GetSelectedDownload(); d != nil {
+					if !d.done || d.err != nil || d.Destination == "" {
+						m.addLogEntry(LogStyleWarning.Render("⚠ Only completed downloads can be moved: " + d.Filename))
+						return m, nil
+					}
+					m.movingID = d.ID
+					m.state = FilePickerState
+					m.filepicker = newFilepicker(filepath.Dir(d.Destination))
+					return m, m.filepicker.Init()
+				}
+			}
+
+			// Command palette
+			if key.Matches(msg, m.keys.Dashboard.Palette) {
+				m.state = PaletteState
+				m.paletteCursor = 0
+				m.paletteInput.SetValue("")
+				m.paletteInput.Focus()
+				return m, nil
+			}
+
 			// History
 			if key.Matches(msg, m.keys.Dashboard.History) {
 				// Open history view
@@ -687,33 +1029,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Dashboard.Pause) {
 				if d := m.GetSelectedDownload(); d != nil {
 					if !d.done {
-						if d.paused {
-							// Resume: create config and add to pool
-							d.paused = false
-							d.state.Resume()
-							// Use the download's actual destination directory
-							outputPath := filepath.Dir(d.Destination)
-							if outputPath == "" || outputPath == "." {
-								outputPath = m.Settings.General.DefaultDownloadDir
-								if outputPath == "" {
-									outputPath = m.PWD
-								}
-							}
-							cfg := types.DownloadConfig{
-								URL:        d.URL,
-								OutputPath: outputPath,
-								DestPath:   d.Destination, // Full path for state lookup
-								ID:         d.ID,
-								Filename:   d.Filename,
-								Verbose:    false,
-								IsResume:   true, // Explicit resume - use saved state
-								ProgressCh: m.progressChan,
-								State:      d.state,
-								Runtime:    convertRuntimeConfig(m.Settings.ToRuntimeConfig()),
-							}
-							m.Pool.Add(cfg)
-							// Restart polling
-							cmds = append(cmds, d.reporter.PollCmd())
+						if d.phase == events.PhaseScheduled && !d.paused {
+							// Start it now instead of waiting
+							m.Pool.Resume(d.ID)
+						} else if d.paused {
+							cmds = append(cmds, m.resumeDownload(d))
 						} else {
 							m.Pool.Pause(d.ID)
 							d.pausing = true // Show immediate feedback
@@ -724,12 +1044,63 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Batch(cmds...)
 			}
 
+			// Pause everything, queue included, until a resume
+			if key.Matches(msg, m.keys.Dashboard.PauseAll) {
+				// The pool reports each pause back via DownloadPausedMsg
+				m.Pool.HoldAll()
+				m.addLogEntry(LogStylePaused.Render("⏸ All downloads paused"))
+				m.UpdateListItems()
+				return m, nil
+			}
+
+			if key.Matches(msg, m.keys.Dashboard.ResumeAll) {
+				m.Pool.EndHold()
+				for _, d := range m.downloads {
+					if d.paused && !d.done {
+						cmds = append(cmds, m.resumeDownload(d))
+					}
+				}
+				m.UpdateListItems()
+				return m, tea.Batch(cmds...)
+			}
+
+			if key.Matches(msg, m.keys.Dashboard.Clipboard) {
+				m.clipboardWatch = !m.clipboardWatch
+				m.clipboardGen++
+				if !m.clipboardWatch {
+					m.addLogEntry(LogStylePaused.Render("📋 Stopped watching the clipboard"))
+					return m, nil
+				}
+				m.clipboardLast = clipboard.ReadURL() // Only links copied from now on
+				m.addLogEntry(LogStyleStarted.Render("📋 Watching the clipboard for download links"))
+				return m, clipboardTickCmd(m.clipboardGen)
+			}
+
+			// Reorder the queue
+			if key.Matches(msg, m.keys.Dashboard.MoveUp, m.keys.Dashboard.MoveDown) {
+				if d := m.GetSelectedDownload(); d != nil {
+					delta := 1
+					if key.Matches(msg, m.keys.Dashboard.MoveUp) {
+						delta = -1
+					}
+					m.Pool.Move(d.ID, delta)
+				}
+				m.UpdateListItems() // The selection follows the download
+				return m, nil
+			}
+
 			// Toggle log focus
 			if key.Matches(msg, m.keys.Dashboard.Log) {
 				m.logFocused = !m.logFocused
 				return m, nil
 			}
 
+			// Toggle engine stats in place of the chunk map
+			if key.Matches(msg, m.keys.Dashboard.Engine) {
+				m.showEngine = !m.showEngine
+				return m, nil
+			}
+
 			// Open settings
 			if key.Matches(msg, m.keys.Dashboard.Settings) {
 				m.state = SettingsState
@@ -802,8 +1173,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, m.filepicker.Init()
 			}
 			if key.Matches(msg, m.keys.Input.Enter) {
-				// Navigate through inputs: URL -> Mirrors -> Path -> Filename -> Start
-				if m.focusedInput < 3 {
+				// Navigate through inputs: URL -> Mirrors -> Path -> Filename -> Connections -> Start
+				if m.focusedInput < len(m.inputs)-1 {
 					m.inputs[m.focusedInput].Blur()
 					m.focusedInput++
 					m.inputs[m.focusedInput].Focus()
@@ -818,6 +1189,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.inputs[1].Blur()
 					m.inputs[2].Blur()
 					m.inputs[3].Blur()
+					m.inputs[4].Blur()
+					m.inputs[5].Blur()
 					return m, nil
 				}
 
@@ -868,12 +1241,36 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				filename := m.inputs[3].Value()
 
+				// Optional per-download connection and speed limits; blank uses settings
+				var limits downloadLimits
+				if v := strings.TrimSpace(m.inputs[4].Value()); v != "" {
+					n, err := strconv.Atoi(v)
+					if err != nil || n < 1 || n > types.PerHostMax {
+						m.inputs[m.focusedInput].Blur()
+						m.focusedInput = 4
+						m.inputs[4].Focus()
+						return m, nil
+					}
+					limits.connections = n
+				}
+				if v := strings.TrimSpace(m.inputs[5].Value()); v != "" {
+					rate, err := utils.ParseRate(v)
+					if err != nil {
+						m.inputs[m.focusedInput].Blur()
+						m.focusedInput = 5
+						m.inputs[5].Focus()
+						return m, nil
+					}
+					limits.rateLimit = rate
+				}
+
 				// Check for duplicate URL
 				if d := m.checkForDuplicate(url); d != nil {
 					m.pendingURL = url
 					m.pendingMirrors = mirrors
 					m.pendingPath = path
 					m.pendingFilename = filename
+					m.pendingLimits = limits
 					m.duplicateInfo = d.Filename
 					m.state = DuplicateWarningState
 					return m, nil
@@ -885,8 +1282,10 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.inputs[1].SetValue("")
 				m.inputs[2].SetValue(path) // Keep path
 				m.inputs[3].SetValue("")
+				m.inputs[4].SetValue("")
+				m.inputs[5].SetValue("")
 
-				return m.startDownload(url, mirrors, path, filename, "")
+				return m.startDownload(url, mirrors, path, filename, "", limits)
 			}
 
 			// Up/Down navigation between inputs
@@ -896,7 +1295,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.inputs[m.focusedInput].Focus()
 				return m, nil
 			}
-			if key.Matches(msg, m.keys.Input.Down) && m.focusedInput < 3 {
+			if key.Matches(msg, m.keys.Input.Down) && m.focusedInput < len(m.inputs)-1 {
 				m.inputs[m.focusedInput].Blur()
 				m.focusedInput++
 				m.inputs[m.focusedInput].Focus()
@@ -910,6 +1309,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case FilePickerState:
 			if key.Matches(msg, m.keys.FilePicker.Cancel) {
 				// Cancel and return to appropriate state
+				if m.movingID != "" {
+					m.movingID = ""
+					m.state = DashboardState
+					return m, nil
+				}
 				if m.SettingsFileBrowsing {
 					m.SettingsFileBrowsing = false
 					m.state = SettingsState
@@ -932,6 +1336,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// '.' to select current directory
 			if key.Matches(msg, m.keys.FilePicker.UseDir) {
+				if m.movingID != "" {
+					return m.moveSelectedFile(m.filepicker.CurrentDirectory)
+				}
 				if m.SettingsFileBrowsing {
 					m.Settings.General.DefaultDownloadDir = m.filepicker.CurrentDirectory
 					m.SettingsFileBrowsing = false
@@ -949,6 +1356,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// Check if a directory was selected
 			if didSelect, path := m.filepicker.DidSelectFile(msg); didSelect {
+				if m.movingID != "" {
+					return m.moveSelectedFile(path)
+				}
 				if m.SettingsFileBrowsing {
 					m.Settings.General.DefaultDownloadDir = path
 					m.SettingsFileBrowsing = false
@@ -997,7 +1407,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Duplicate.Continue) {
 				// Continue anyway - startDownload handles unique filename generation
 				m.state = DashboardState
-				return m.startDownload(m.pendingURL, m.pendingMirrors, m.pendingPath, m.pendingFilename, "")
+				return m.startDownload(m.pendingURL, m.pendingMirrors, m.pendingPath, m.pendingFilename, "", m.pendingLimits)
 			}
 			if key.Matches(msg, m.keys.Duplicate.Cancel) {
 				// Cancel - don't add
@@ -1017,7 +1427,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 
-		case ExtensionConfirmationState:
+		case ExtensionConfirmationState, ClipboardConfirmationState:
 			if key.Matches(msg, m.keys.Extension.Yes) {
 				// Confirmed - proceed to add (checking for duplicates first)
 				if d := m.checkForDuplicate(m.pendingURL); d != nil {
@@ -1029,7 +1439,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 				// No duplicate (or warning disabled) - add to queue
 				m.state = DashboardState
-				return m.startDownload(m.pendingURL, nil, m.pendingPath, m.pendingFilename, "")
+				return m.startDownload(m.pendingURL, nil, m.pendingPath, m.pendingFilename, "", downloadLimits{})
 			}
 			if key.Matches(msg, m.keys.Extension.No) {
 				// Cancelled
@@ -1110,8 +1520,12 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						skipped++
 						continue
 					}
-					m, _ = m.startDownload(url, nil, path, "", "")
-					added++
+					// startDownload logs and skips URLs the settings block
+					before := len(m.downloads)
+					m, _ = m.startDownload(url, nil, path, "", "", downloadLimits{})
+					if len(m.downloads) > before {
+						added++
+					}
 				}
 
 				if skipped > 0 {
@@ -1132,6 +1546,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 
+		case PaletteState:
+			return m.updatePalette(msg)
+
 		case SettingsState:
 			// Handle editing mode first
 			if m.SettingsIsEditing {
@@ -1146,7 +1563,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					categories := config.CategoryOrder()
 					currentCategory := categories[m.SettingsActiveTab]
 					settingKey := m.getCurrentSettingKey()
-					m.setSettingValue(currentCategory, settingKey, m.SettingsInput.Value())
+					if err := m.setSettingValue(currentCategory, settingKey, m.SettingsInput.Value()); err != nil {
+						// Keep editing so the value can be fixed
+						m.addLogEntry(LogStyleError.Render("✖ " + err.Error()))
+						return m, nil
+					}
 					m.SettingsIsEditing = false
 					m.SettingsInput.Blur()
 					return m, nil
@@ -1162,6 +1583,15 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Settings.Close) {
 				// Save settings and exit
 				_ = config.SaveSettings(m.Settings)
+				if m.Pool != nil {
+					m.Pool.SetKeepPartialOnCancel(m.Settings.General.KeepPartialOnCancel)
+					m.Pool.SetMarkExecutable(m.Settings.General.MarkExecutable)
+					m.Pool.SetFixExtensions(m.Settings.General.FixExtensions)
+					m.Pool.SetSortFolder(m.Settings.General.SortFolder)
+					m.Pool.SetAutosave(m.Settings.Performance.AutosaveInterval)
+					m.Pool.SetSpeedLimit(m.Settings.Connections.SpeedLimitRate())
+					m.Pool.SetConnectionBudget(m.Settings.Connections.MaxGlobalConnections, m.Settings.Connections.SchedulingPolicy)
+				}
 				m.state = DashboardState
 				return m, nil
 			}
@@ -1371,14 +1801,12 @@ func (m *RootModel) generateUniqueFilename(dir, filename string) string {
 	// Check if file exists on disk (including incomplete .surge files)
 	existsOnDisk := func(name string) bool {
 		path := filepath.Join(dir, name)
-		if _, err := os.Stat(path); !os.IsNotExist(err) {
+		// Lstat: a symlink (even a dangling one) makes the name taken
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
 			return true
 		}
-		// Also check for incomplete download file (.surge extension)
-		if _, err := os.Stat(path + types.IncompleteSuffix); !os.IsNotExist(err) {
-			return true
-		}
-		return false
+		// Also check for incomplete download files (.surge extension)
+		return types.HasWorkingFile(path)
 	}
 
 	if !existsInDownloads(filename) && !existsOnDisk(filename) {
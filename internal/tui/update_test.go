@@ -1,15 +1,21 @@
 package tui
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/download"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/tui/components"
 )
 
 func TestGenerateUniqueFilename(t *testing.T) {
@@ -218,3 +224,253 @@ func TestUpdate_DownloadRequestMsg(t *testing.T) {
 		t.Errorf("Expected no prompt state, got %v", newRoot.state)
 	}
 }
+
+func TestUpdate_DownloadStateChangedMsg_DrivesTab(t *testing.T) {
+	m := RootModel{
+		Settings:    config.DefaultSettings(),
+		logViewport: viewport.New(40, 5),
+		list:        NewDownloadList(40, 10),
+	}
+	d := NewDownloadModel("phase-id", "http://example.com/a.bin", "a.bin", 0)
+	m.downloads = []*DownloadModel{d}
+
+	if d.tab() != TabQueued {
+		t.Fatalf("new download should start in queued tab, got %d", d.tab())
+	}
+
+	// Active with no bytes yet (still probing): speed heuristics would call this queued
+	newM, _ := m.Update(events.DownloadStateChangedMsg{DownloadID: "phase-id", From: events.PhaseQueued, To: events.PhaseActive})
+	m = newM.(RootModel)
+	if d.tab() != TabActive {
+		t.Errorf("active phase should map to active tab, got %d", d.tab())
+	}
+	if d.status() != components.StatusDownloading {
+		t.Errorf("active phase should render as downloading, got %s", d.status().Label())
+	}
+
+	newM, _ = m.Update(events.DownloadStateChangedMsg{DownloadID: "phase-id", From: events.PhaseActive, To: events.PhasePaused})
+	m = newM.(RootModel)
+	if d.tab() != TabQueued {
+		t.Errorf("paused phase should map to queued tab, got %d", d.tab())
+	}
+}
+
+func TestUpdate_ChecksumStatus(t *testing.T) {
+	m := RootModel{
+		Settings:    config.DefaultSettings(),
+		logViewport: viewport.New(40, 5),
+		list:        NewDownloadList(40, 10),
+	}
+	good := NewDownloadModel("good", "http://example.com/a.bin", "a.bin", 0)
+	bad := NewDownloadModel("bad", "http://example.com/b.bin", "b.bin", 0)
+	m.downloads = []*DownloadModel{good, bad}
+
+	newM, _ := m.Update(events.ChecksumVerifiedMsg{DownloadID: "good", Filename: "a.bin", Checksum: "sha256:9f86d0"})
+	m = newM.(RootModel)
+	if good.checksum != checksumVerified || good.checksumType != "sha256" {
+		t.Errorf("verified download has %v %q, want verified sha256", good.checksum, good.checksumType)
+	}
+
+	err := fmt.Errorf("verifying b.bin: %w", download.ErrChecksumMismatch)
+	newM, _ = m.Update(events.DownloadErrorMsg{DownloadID: "bad", Filename: "b.bin", Err: err})
+	m = newM.(RootModel)
+	if bad.checksum != checksumFailed {
+		t.Errorf("mismatched download has %v, want failed", bad.checksum)
+	}
+	if good.checksum != checksumVerified {
+		t.Errorf("other download changed to %v", good.checksum)
+	}
+}
+
+func TestRenderEngineStats(t *testing.T) {
+	empty := renderEngineStats(types.EngineStats{}, 60)
+	if !strings.Contains(empty, "No tasks in flight") {
+		t.Errorf("no placeholder for an idle engine:\n%s", empty)
+	}
+
+	stats := types.EngineStats{Connections: 12, TargetConnections: 16, Steals: 3}
+	for i := range 12 {
+		stats.Tasks = append(stats.Tasks, types.TaskStats{Worker: i, Offset: int64(i) * types.MB, Remaining: types.MB, Speed: types.MB})
+	}
+	full := renderEngineStats(stats, 60)
+	for _, want := range []string{"target 16", "Steals: 3", "1.0 MB/s", "+5 more"} {
+		if !strings.Contains(full, want) {
+			t.Errorf("engine pane missing %q:\n%s", want, full)
+		}
+	}
+	// The pane keeps its height as tasks come and go
+	if lipgloss.Height(full) != lipgloss.Height(empty) {
+		t.Errorf("height %d with tasks, %d without", lipgloss.Height(full), lipgloss.Height(empty))
+	}
+}
+
+func TestRenderSparkline(t *testing.T) {
+	if got := renderSparkline([]float64{0, 1, 2, 4}, 4); got != "▁▃▅█" {
+		t.Errorf("renderSparkline() = %q, want %q", got, "▁▃▅█")
+	}
+	// Short history is right-aligned; long history keeps the newest values
+	if got := renderSparkline([]float64{4, 4}, 4); got != "  ██" {
+		t.Errorf("renderSparkline() = %q, want %q", got, "  ██")
+	}
+	if got := renderSparkline([]float64{9, 0, 0, 2}, 3); got != "▁▁█" {
+		t.Errorf("renderSparkline() = %q, want %q", got, "▁▁█")
+	}
+}
+
+func TestUpdate_PauseAllKeys(t *testing.T) {
+	ch := make(chan any, 100)
+	m := RootModel{
+		Settings:     config.DefaultSettings(),
+		Pool:         download.NewWorkerPool(ch, 1),
+		keys:         Keys,
+		progressChan: ch,
+		logViewport:  viewport.New(40, 5),
+		list:         NewDownloadList(40, 10),
+	}
+
+	newM, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("P")})
+	m = newM.(RootModel)
+	if !m.Pool.Held() {
+		t.Fatal("P should pause everything")
+	}
+	if banner := renderAllPausedBanner(60, m.keys.Dashboard.ResumeAll); !strings.Contains(banner, "ALL PAUSED") || !strings.Contains(banner, "R to resume") {
+		t.Errorf("banner = %q", banner)
+	}
+
+	newM, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("R")})
+	m = newM.(RootModel)
+	if m.Pool.Held() {
+		t.Error("R should end the pause-all")
+	}
+}
+
+func TestUpdate_ClearCompletedTick(t *testing.T) {
+	settings := config.DefaultSettings()
+	settings.General.ClearCompletedAfter = 2
+	m := RootModel{
+		Settings:    settings,
+		logViewport: viewport.New(40, 5),
+		list:        NewDownloadList(40, 10),
+	}
+	old := NewDownloadModel("old", "http://example.com/old.bin", "old.bin", 0)
+	old.done, old.completedAt = true, time.Now().Add(-3*time.Hour)
+	recent := NewDownloadModel("recent", "http://example.com/recent.bin", "recent.bin", 0)
+	recent.done, recent.completedAt = true, time.Now().Add(-time.Hour)
+	failed := NewDownloadModel("failed", "http://example.com/failed.bin", "failed.bin", 0)
+	failed.done, failed.err, failed.completedAt = true, os.ErrNotExist, time.Now().Add(-3*time.Hour)
+	m.downloads = []*DownloadModel{old, recent, failed}
+
+	newM, cmd := m.Update(clearCompletedTickMsg{})
+	m = newM.(RootModel)
+	if cmd == nil {
+		t.Error("the tick should be scheduled again")
+	}
+	var ids []string
+	for _, d := range m.downloads {
+		ids = append(ids, d.ID)
+	}
+	if strings.Join(ids, ",") != "recent,failed" {
+		t.Errorf("downloads after the tick = %v, want recent and failed", ids)
+	}
+}
+
+func TestUpdate_ClipboardTick(t *testing.T) {
+	m := RootModel{
+		Settings:       config.DefaultSettings(),
+		keys:           Keys,
+		logViewport:    viewport.New(40, 5),
+		list:           NewDownloadList(40, 10),
+		clipboardWatch: true,
+		clipboardGen:   2,
+	}
+
+	// A tick of an earlier watch is dropped without scheduling another
+	if _, cmd := m.Update(clipboardTickMsg{gen: 1, url: "https://example.com/file.iso"}); cmd != nil {
+		t.Error("a stale tick should stop")
+	}
+
+	// Links to pages are not offered
+	newM, cmd := m.Update(clipboardTickMsg{gen: 2, url: "https://example.com/article"})
+	m = newM.(RootModel)
+	if m.state != DashboardState || cmd == nil {
+		t.Fatalf("state = %d after a page link, want the dashboard and another tick", m.state)
+	}
+
+	newM, _ = m.Update(clipboardTickMsg{gen: 2, url: "https://example.com/file.iso"})
+	m = newM.(RootModel)
+	if m.state != ClipboardConfirmationState || m.pendingURL != "https://example.com/file.iso" {
+		t.Fatalf("state = %d, pendingURL = %q; want a prompt for the copied file", m.state, m.pendingURL)
+	}
+
+	// The same link is offered once
+	newM, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	m = newM.(RootModel)
+	newM, _ = m.Update(clipboardTickMsg{gen: 2, url: "https://example.com/file.iso"})
+	m = newM.(RootModel)
+	if m.state != DashboardState {
+		t.Errorf("state = %d, want no second prompt for the same link", m.state)
+	}
+}
+
+func TestUpdate_RemovedStatus(t *testing.T) {
+	m := RootModel{
+		Settings:    config.DefaultSettings(),
+		logViewport: viewport.New(40, 5),
+		list:        NewDownloadList(40, 10),
+	}
+
+	newM, _ := m.Update(events.DownloadRemovedMsg{DownloadID: "d1", Filename: "a.iso", Reclaimed: 3 * Megabyte})
+	m = newM.(RootModel)
+	if !strings.Contains(m.status, "freed 3.0 MB") || !m.statusUntil.After(time.Now()) {
+		t.Errorf("status = %q until %v, want the space freed shown", m.status, m.statusUntil)
+	}
+	if len(m.logEntries) != 1 || !strings.Contains(m.logEntries[0], "freed 3.0 MB") {
+		t.Errorf("log = %q, want the removal logged", m.logEntries)
+	}
+}
+
+func TestUpdate_MoveFile(t *testing.T) {
+	dir := t.TempDir()
+	done := NewDownloadModel("d1", "https://example.com/a.iso", "a.iso", 10)
+	done.done = true
+	done.Destination = filepath.Join(dir, "a.iso")
+	m := RootModel{
+		Settings:    config.DefaultSettings(),
+		keys:        Keys,
+		logViewport: viewport.New(40, 5),
+		list:        NewDownloadList(40, 10),
+		downloads:   []*DownloadModel{done},
+		activeTab:   TabDone,
+	}
+	m.UpdateListItems()
+
+	newM, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	m = newM.(RootModel)
+	if m.state != FilePickerState || m.movingID != "d1" {
+		t.Fatalf("state = %d, movingID = %q; want the directory picker for d1", m.state, m.movingID)
+	}
+	newM, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = newM.(RootModel)
+	if m.state != DashboardState || m.movingID != "" {
+		t.Fatalf("state = %d, movingID = %q after cancelling", m.state, m.movingID)
+	}
+
+	dest := filepath.Join(dir, "archive", "a.iso")
+	m.Update(events.DownloadMovedMsg{DownloadID: "d1", Filename: "a.iso", DestPath: dest})
+	if done.Destination != dest {
+		t.Errorf("Destination = %q, want %q", done.Destination, dest)
+	}
+}
+
+func TestSetSettingValue_SchedulingPolicy(t *testing.T) {
+	m := RootModel{Settings: config.DefaultSettings()}
+	if err := m.setSettingValue("Connections", "scheduling_policy", types.SchedulingPriorityStrict); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.setSettingValue("Connections", "scheduling_policy", "fastest"); err == nil {
+		t.Error("an unknown scheduling policy was accepted")
+	}
+	if got := m.Settings.Connections.SchedulingPolicy; got != types.SchedulingPriorityStrict {
+		t.Errorf("SchedulingPolicy = %q, want it left at %q", got, types.SchedulingPriorityStrict)
+	}
+}
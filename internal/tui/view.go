@@ -2,12 +2,16 @@ package tui
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/tui/components"
 	"github.com/surge-downloader/surge/internal/utils"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -56,6 +60,10 @@ func (m RootModel) View() string {
 			pathLine,
 			"", // Spacer
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Filename:"), m.inputs[3].View()),
+			"", // Spacer
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Conns:"), m.inputs[4].View()),
+			"", // Spacer
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Limit:"), m.inputs[5].View()),
 			"", // Bottom spacer
 			"",
 			// Render dynamic help
@@ -65,14 +73,18 @@ func (m RootModel) View() string {
 		// Apply padding to the content before boxing it
 		paddedContent := lipgloss.NewStyle().Padding(0, 2).Render(content)
 
-		box := renderBtopBox(PaneTitleStyle.Render(" Add Download "), "", paddedContent, 80, 11, ColorNeonPink)
+		box := renderBtopBox(PaneTitleStyle.Render(" Add Download "), "", paddedContent, 80, 15, ColorNeonPink)
 
 		return m.renderModalWithOverlay(box)
 	}
 
 	if m.state == FilePickerState {
+		title := " Select Directory "
+		if m.movingID != "" {
+			title = " Move To "
+		}
 		picker := components.NewFilePickerModal(
-			" Select Directory ",
+			title,
 			m.filepicker,
 			m.help,
 			m.keys.FilePicker,
@@ -86,6 +98,10 @@ func (m RootModel) View() string {
 		return m.viewSettings()
 	}
 
+	if m.state == PaletteState {
+		return m.viewPalette()
+	}
+
 	if m.state == DuplicateWarningState {
 		modal := components.ConfirmationModal{
 			Title:       "⚠ Duplicate Detected",
@@ -116,6 +132,21 @@ func (m RootModel) View() string {
 		return m.renderModalWithOverlay(box)
 	}
 
+	if m.state == ClipboardConfirmationState {
+		modal := components.ConfirmationModal{
+			Title:       "Copied Link",
+			Message:     "Add to queue?",
+			Detail:      truncateString(m.pendingURL, 50),
+			Keys:        m.keys.Extension,
+			Help:        m.help,
+			BorderColor: ColorNeonCyan,
+			Width:       60,
+			Height:      10,
+		}
+		box := modal.RenderWithBtopBox(renderBtopBox, PaneTitleStyle)
+		return m.renderModalWithOverlay(box)
+	}
+
 	if m.state == BatchFilePickerState {
 		picker := components.NewFilePickerModal(
 			" Select URL File (.txt) ",
@@ -163,6 +194,10 @@ func (m RootModel) View() string {
 
 	footerHeight := 1                              // Footer is just one line of text
 	availableHeight := m.height - 1 - footerHeight // maximized height with 1 line margin
+	allPaused := m.Pool != nil && m.Pool.Held()
+	if allPaused {
+		availableHeight-- // Room for the banner
+	}
 	if availableHeight < 10 {
 		availableHeight = 10 // Minimum safe height
 	}
@@ -221,7 +256,12 @@ func (m RootModel) View() string {
 		}
 	}
 
-	if showChunkMap {
+	// The engine pane takes the chunk map's place and sizes to its content
+	var engineContent string
+	if showChunkMap && m.showEngine && selected.state != nil {
+		engineContent = renderEngineStats(selected.state.EngineStats(), rightWidth-6)
+		chunkMapNeeded = lipgloss.Height(engineContent) + 2
+	} else if showChunkMap {
 		_, bitmapWidth, _, _, _ := selected.state.GetBitmap()
 		// chunkMapWidth = rightWidth - 4 (box border) - 2 (inner padding) = rightWidth - 6
 		contentLines := components.CalculateHeight(bitmapWidth, rightWidth-6)
@@ -514,9 +554,9 @@ func (m RootModel) View() string {
 				lipgloss.NewStyle().Foreground(ColorNeonCyan).Render("No downloads"))
 		}
 	} else {
-		// ensure list fills the height
-		m.list.SetHeight(listHeight - 4) // adjust for padding/tabs
-		listContent = m.list.View()
+		// ensure list fills the height, leaving a line for the totals footer
+		m.list.SetHeight(listHeight - 5) // adjust for padding/tabs/footer
+		listContent = lipgloss.JoinVertical(lipgloss.Left, m.list.View(), m.renderTabTotals())
 	}
 
 	// Build list inner content - No search bar inside
@@ -537,7 +577,9 @@ func (m RootModel) View() string {
 
 	// --- SECTION 5: CHUNK MAP PANE (Bottom Right) ---
 	var chunkBox string
-	if showChunkMap {
+	if engineContent != "" {
+		chunkBox = renderBtopBox("", PaneTitleStyle.Render(" Engine "), engineContent, rightWidth, chunkMapHeight, ColorGray)
+	} else if showChunkMap {
 		var chunkContent string
 		if selected != nil {
 			// New chunk map component
@@ -567,8 +609,22 @@ func (m RootModel) View() string {
 	// Body
 	body := lipgloss.JoinHorizontal(lipgloss.Top, leftColumn, rightColumn)
 
-	// Footer - just keybindings
+	// Footer - keybindings, then a recent status or when the queue should be
+	// through if there is room
 	footer := lipgloss.NewStyle().Padding(0, 1).Render(m.help.View(m.keys.Dashboard))
+	right := m.renderQueueFinish(time.Now())
+	if m.status != "" && time.Now().Before(m.statusUntil) {
+		right = m.status
+	}
+	if right != "" {
+		if gap := availableWidth - lipgloss.Width(footer) - lipgloss.Width(right); gap > 0 {
+			footer += strings.Repeat(" ", gap) + right
+		}
+	}
+
+	if allPaused {
+		body = lipgloss.JoinVertical(lipgloss.Left, renderAllPausedBanner(availableWidth, m.keys.Dashboard.ResumeAll), body)
+	}
 
 	return lipgloss.JoinVertical(lipgloss.Left,
 		body,
@@ -576,6 +632,19 @@ func (m RootModel) View() string {
 	)
 }
 
+// renderAllPausedBanner is the bar across the dashboard while pause-all
+// holds every download
+func renderAllPausedBanner(width int, resume key.Binding) string {
+	text := fmt.Sprintf("⏸  ALL PAUSED  ·  press %s to resume", resume.Help().Key)
+	return lipgloss.NewStyle().
+		Width(width).
+		Align(lipgloss.Center).
+		Bold(true).
+		Foreground(ColorWhite).
+		Background(ColorStatePaused).
+		Render(text)
+}
+
 // Helper to render the detailed info pane
 func renderFocusedDetails(d *DownloadModel, w int) string {
 	pct := 0.0
@@ -641,9 +710,8 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 
 	// Speed & ETA
 	if d.done {
-		if d.Elapsed.Seconds() > 0 {
-			avgSpeed := float64(d.Total) / d.Elapsed.Seconds()
-			speedStr = fmt.Sprintf("%.2f MB/s (Avg)", avgSpeed/Megabyte)
+		if avg := d.avgSpeed(); avg > 0 {
+			speedStr = fmt.Sprintf("%.2f MB/s (Avg)", avg/Megabyte)
 		} else {
 			speedStr = "N/A"
 		}
@@ -653,11 +721,8 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 		etaStr = "∞"
 	} else {
 		speedStr = fmt.Sprintf("%.2f MB/s", d.Speed/Megabyte)
-		if d.Total > 0 {
-			remaining := d.Total - d.Downloaded
-			etaSeconds := float64(remaining) / d.Speed
-			etaDuration := time.Duration(etaSeconds) * time.Second
-			etaStr = etaDuration.Round(time.Second).String()
+		if eta, ok := d.eta(); ok {
+			etaStr = eta.String()
 		} else {
 			etaStr = "∞"
 		}
@@ -675,6 +740,11 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Time:"), StatsValueStyle.Render(timeStr)),
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("ETA:"), StatsValueStyle.Render(etaStr)),
 	)
+	if d.Retries > 0 && !d.done {
+		rightCol = lipgloss.JoinVertical(lipgloss.Left, rightCol,
+			lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Retry:"), StatsValueStyle.Render(fmt.Sprintf("%d", d.Retries))),
+		)
+	}
 
 	statsContent := lipgloss.JoinHorizontal(lipgloss.Top,
 		lipgloss.NewStyle().Width(colWidth).Render(leftCol),
@@ -682,7 +752,15 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 	)
 	statsSection := sectionStyle.Render(statsContent)
 
-	// --- 5. Mirrors Section ---
+	// --- 5. Speed History Section ---
+	var historySection string
+	if d.state != nil {
+		if history := d.state.SpeedHistory(); len(history) > 1 {
+			historySection = sectionStyle.Render(renderSpeedHistory(history, contentWidth-2))
+		}
+	}
+
+	// --- 6. Mirrors Section ---
 	var mirrorSection string
 	if d.state != nil && len(d.state.GetMirrors()) > 0 {
 		activeCount := 0
@@ -703,11 +781,10 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 		mirrorSection = sectionStyle.Render(lipgloss.JoinVertical(lipgloss.Left, mirrorLabel, mirrorStats))
 	}
 
-	// --- 6. Error Section ---
+	// --- 7. Error Section ---
 	var errorSection string
 	if d.err != nil {
-		errorSection = sectionStyle.Copy().
-			Render(lipgloss.NewStyle().Foreground(ColorStateError).Render("Error: " + d.err.Error()))
+		errorSection = sectionStyle.Copy().Render(renderErrorDetails(download.Diagnose(d.err), contentWidth-2))
 	}
 
 	// Combine with Dividers
@@ -721,6 +798,11 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 	parts = append(parts, divider)
 	parts = append(parts, statsSection)
 
+	if historySection != "" {
+		parts = append(parts, divider)
+		parts = append(parts, historySection)
+	}
+
 	if mirrorSection != "" {
 		parts = append(parts, divider)
 		parts = append(parts, mirrorSection)
@@ -738,8 +820,104 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 		Render(content)
 }
 
+// renderSpeedHistory renders the per-second speeds of a download as a
+// sparkline under a label with the span it covers and its peak
+func renderSpeedHistory(history []float64, w int) string {
+	if len(history) > w {
+		history = history[len(history)-w:]
+	}
+	peak := 0.0
+	for _, v := range history {
+		peak = max(peak, v)
+	}
+	label := StatsLabelStyle.UnsetWidth().Render(fmt.Sprintf("Speed (last %ds) ", len(history))) +
+		lipgloss.NewStyle().Foreground(ColorLightGray).Render(fmt.Sprintf("peak %.2f MB/s", peak/Megabyte))
+	spark := lipgloss.NewStyle().Foreground(ColorNeonPink).Render(renderSparkline(history, w))
+	return lipgloss.JoinVertical(lipgloss.Left, label, spark)
+}
+
+// maxShownAttempts caps how many retry errors the details pane lists
+const maxShownAttempts = 3
+
+// renderErrorDetails renders a classified failure: the error, the HTTP
+// response snapshot, the most recent retry errors and a suggested fix
+func renderErrorDetails(diag download.Diagnosis, w int) string {
+	errStyle := lipgloss.NewStyle().Foreground(ColorStateError).Width(w)
+	dimStyle := lipgloss.NewStyle().Foreground(ColorLightGray)
+
+	lines := []string{errStyle.Render(fmt.Sprintf("%s: %s", diag.Kind, diag.Message))}
+
+	if diag.HTTP != nil {
+		lines = append(lines, StatsLabelStyle.Render("HTTP: ")+StatsValueStyle.Render(diag.HTTP.Status))
+		for _, h := range diag.Headers() {
+			lines = append(lines, dimStyle.Render("  "+truncateString(h, w-5)))
+		}
+	}
+
+	if n := len(diag.Attempts); n > 0 {
+		lines = append(lines, StatsLabelStyle.Render("Retries: ")+StatsValueStyle.Render(strconv.Itoa(n)))
+		for i := max(0, n-maxShownAttempts); i < n; i++ {
+			lines = append(lines, dimStyle.Render(truncateString(fmt.Sprintf("  #%d %s", i+1, diag.Attempts[i]), w-3)))
+		}
+	}
+
+	if diag.Suggestion != "" {
+		lines = append(lines, lipgloss.NewStyle().Foreground(ColorNeonCyan).Width(w).Render("Hint: "+diag.Suggestion))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// maxShownTasks caps the task rows of the engine pane. The pane always has
+// room for this many, so its height doesn't jump as tasks come and go.
+const maxShownTasks = 8
+
+// renderEngineStats renders what the concurrent engine is doing with a
+// download: its counters, then the next offset, bytes left and speed of
+// each task in flight
+func renderEngineStats(stats types.EngineStats, w int) string {
+	dimStyle := lipgloss.NewStyle().Foreground(ColorLightGray)
+	field := func(label string, value any) string {
+		return StatsLabelStyle.UnsetWidth().Render(label+" ") + StatsValueStyle.Render(fmt.Sprint(value))
+	}
+
+	conns := strconv.Itoa(stats.Connections)
+	if stats.TargetConnections > 0 {
+		conns += fmt.Sprintf(" (adaptive, target %d)", stats.TargetConnections)
+	}
+	lines := []string{
+		field("Connections:", conns),
+		field("Steals:", stats.Steals) + "  " + field("Splits:", stats.Splits) + "  " +
+			field("Reassigned:", stats.Reassignments) + "  " + field("Retries:", stats.Retries),
+		"",
+		dimStyle.Render(fmt.Sprintf("%-6s %10s %10s %12s", "WORKER", "OFFSET", "LEFT", "SPEED")),
+	}
+	size := utils.ConvertBytesToHumanReadable
+	for i := range maxShownTasks {
+		switch {
+		case i < len(stats.Tasks) && (i < maxShownTasks-1 || len(stats.Tasks) == maxShownTasks):
+			t := stats.Tasks[i]
+			speed := "-"
+			if t.Speed > 0 {
+				speed = size(int64(t.Speed)) + "/s"
+			}
+			lines = append(lines, truncateString(fmt.Sprintf("%-6d %10s %10s %12s", t.Worker, size(t.Offset), size(t.Remaining), speed), w))
+		case i < len(stats.Tasks):
+			lines = append(lines, dimStyle.Render(fmt.Sprintf("+%d more", len(stats.Tasks)-i)))
+		case i == 0:
+			lines = append(lines, dimStyle.Render("No tasks in flight"))
+		default:
+			lines = append(lines, "")
+		}
+	}
+	return lipgloss.NewStyle().Padding(0, 2).Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
 func getDownloadStatus(d *DownloadModel) string {
-	status := components.DetermineStatus(d.done, d.paused, d.err != nil, d.Speed, d.Downloaded)
+	status := d.status()
+	if status == components.StatusScheduled {
+		return status.Render() + " (starts in " + d.countdown(time.Now()) + ")"
+	}
 	return status.Render()
 }
 
@@ -768,6 +946,47 @@ func (m RootModel) CalculateStats() (active, queued, downloaded int) {
 	return
 }
 
+// renderTabTotals renders the aggregate footer for the downloads shown in the active tab
+func (m RootModel) renderTabTotals() string {
+	var files int
+	var total, downloaded int64
+	var speed float64
+	var elapsed time.Duration
+
+	for _, item := range m.list.Items() {
+		di, ok := item.(DownloadItem)
+		if !ok {
+			continue
+		}
+		d := di.download
+		files++
+		downloaded += d.Downloaded
+		if m.activeTab == TabDone && d.err != nil {
+			continue // Failed downloads don't count towards transferred bytes
+		}
+		total += d.Total
+		speed += d.Speed
+		elapsed += d.Elapsed
+	}
+
+	parts := []string{fmt.Sprintf("%d files", files)}
+	switch m.activeTab {
+	case TabDone:
+		parts = append(parts, utils.ConvertBytesToHumanReadable(total))
+		if elapsed > 0 {
+			parts = append(parts, fmt.Sprintf("%.2f MB/s avg", float64(total)/elapsed.Seconds()/Megabyte))
+		}
+	case TabActive:
+		parts = append(parts,
+			fmt.Sprintf("%s / %s", utils.ConvertBytesToHumanReadable(downloaded), utils.ConvertBytesToHumanReadable(total)),
+			fmt.Sprintf("%.2f MB/s", speed/Megabyte))
+	default:
+		parts = append(parts, utils.ConvertBytesToHumanReadable(total))
+	}
+
+	return lipgloss.NewStyle().Foreground(ColorGray).Render("Σ " + strings.Join(parts, " • "))
+}
+
 func truncateString(s string, i int) string {
 	runes := []rune(s)
 	if len(runes) > i {
@@ -0,0 +1,242 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/tui/components"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// WatchRefreshInterval is how often the watch dashboard asks for the downloads
+const WatchRefreshInterval = time.Second
+
+// WatchSource returns the downloads of the server being watched. It must
+// only read: the watch dashboard never changes anything on the server.
+type WatchSource func() ([]types.DownloadStatus, error)
+
+// watchUpdateMsg carries the result of one WatchSource call
+type watchUpdateMsg struct {
+	downloads []types.DownloadStatus
+	err       error
+}
+
+// watchTickMsg asks for the next refresh
+type watchTickMsg struct{}
+
+// WatchModel is a read-only dashboard of a running server, for status
+// displays where nobody should pause, cancel or add downloads
+type WatchModel struct {
+	source WatchSource
+	server string // Shown in the header
+
+	downloads []types.DownloadStatus
+	err       error
+	updated   time.Time
+
+	width, height int
+	offset        int // First row shown
+	help          help.Model
+}
+
+// NewWatchModel returns a dashboard of the downloads source reports for the
+// server named server
+func NewWatchModel(source WatchSource, server string) WatchModel {
+	return WatchModel{source: source, server: server, help: help.New()}
+}
+
+func (m WatchModel) Init() tea.Cmd {
+	return m.fetch
+}
+
+// fetch calls the source, off the update loop
+func (m WatchModel) fetch() tea.Msg {
+	downloads, err := m.source()
+	return watchUpdateMsg{downloads: downloads, err: err}
+}
+
+func (m WatchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.help.Width = msg.Width
+		m.offset = min(m.offset, m.maxOffset())
+	case watchUpdateMsg:
+		// Keep showing the last downloads while the server is unreachable
+		m.err = msg.err
+		if msg.err == nil {
+			m.downloads = sortWatched(msg.downloads)
+			m.updated = time.Now()
+			m.offset = min(m.offset, m.maxOffset())
+		}
+		return m, tea.Tick(WatchRefreshInterval, func(time.Time) tea.Msg { return watchTickMsg{} })
+	case watchTickMsg:
+		return m, m.fetch
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, Keys.Watch.Quit):
+			return m, tea.Quit
+		case key.Matches(msg, Keys.Watch.Up):
+			m.offset = max(m.offset-1, 0)
+		case key.Matches(msg, Keys.Watch.Down):
+			m.offset = min(m.offset+1, m.maxOffset())
+		}
+	}
+	return m, nil
+}
+
+// watchStatusRank orders the rows: what is moving first, what is over last
+var watchStatusRank = map[string]int{
+	"downloading": 0,
+	"queued":      1,
+	"scheduled":   2,
+	"paused":      3,
+	"error":       4,
+	"completed":   5,
+}
+
+// sortWatched sorts downloads by status, queued ones in queue order
+func sortWatched(downloads []types.DownloadStatus) []types.DownloadStatus {
+	sort.SliceStable(downloads, func(i, j int) bool {
+		a, b := downloads[i], downloads[j]
+		if ra, rb := watchStatusRank[a.Status], watchStatusRank[b.Status]; ra != rb {
+			return ra < rb
+		}
+		return a.Position < b.Position
+	})
+	return downloads
+}
+
+// watchStatus maps a server status to its display status
+func watchStatus(status string) components.DownloadStatus {
+	switch status {
+	case "downloading":
+		return components.StatusDownloading
+	case "paused":
+		return components.StatusPaused
+	case "completed":
+		return components.StatusComplete
+	case "error":
+		return components.StatusError
+	case "scheduled":
+		return components.StatusScheduled
+	}
+	return components.StatusQueued
+}
+
+// rowsShown is how many download rows fit between the header and footer
+func (m WatchModel) rowsShown() int {
+	if m.height == 0 {
+		return len(m.downloads)
+	}
+	return max(m.height-6, 1)
+}
+
+func (m WatchModel) maxOffset() int {
+	return max(len(m.downloads)-m.rowsShown(), 0)
+}
+
+func (m WatchModel) View() string {
+	gray := lipgloss.NewStyle().Foreground(ColorGray)
+	var b strings.Builder
+
+	b.WriteString(PaneTitleStyle.Render(" watching "+m.server+" ") + gray.Render(" · read-only") + "\n")
+	b.WriteString(m.renderWatchTotals() + "\n\n")
+
+	if len(m.downloads) == 0 {
+		if m.updated.IsZero() && m.err == nil {
+			b.WriteString(gray.Render("Connecting...") + "\n")
+		} else {
+			b.WriteString(gray.Render("No downloads") + "\n")
+		}
+	}
+	end := min(m.offset+m.rowsShown(), len(m.downloads))
+	for _, d := range m.downloads[m.offset:end] {
+		b.WriteString(m.renderWatchRow(d) + "\n")
+	}
+
+	b.WriteString("\n")
+	var footer []string
+	if !m.updated.IsZero() {
+		footer = append(footer, "updated "+m.updated.Format("15:04:05"))
+	}
+	if m.err != nil {
+		footer = append(footer, LogStyleError.Render("server unreachable: "+m.err.Error()))
+	}
+	if len(footer) > 0 {
+		b.WriteString(gray.Render(strings.Join(footer, " · ")) + "\n")
+	}
+	b.WriteString(m.help.View(Keys.Watch))
+	return b.String()
+}
+
+// renderWatchTotals counts the downloads by status and sums their speed
+func (m WatchModel) renderWatchTotals() string {
+	counts := make(map[string]int)
+	var speed float64
+	for _, d := range m.downloads {
+		counts[d.Status]++
+		if d.Status == "downloading" {
+			speed += d.Speed
+		}
+	}
+	var parts []string
+	for _, status := range []string{"downloading", "queued", "scheduled", "paused", "error", "completed"} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "0 downloads")
+	}
+	parts = append(parts, fmt.Sprintf("%.1f MB/s", speed))
+	return lipgloss.NewStyle().Foreground(ColorGray).Render(strings.Join(parts, " · "))
+}
+
+// renderWatchRow renders one download: status, name, progress, size, speed
+// and time left while it is downloading
+func (m WatchModel) renderWatchRow(d types.DownloadStatus) string {
+	nameWidth := 40
+	if m.width > 0 {
+		nameWidth = max(m.width-60, 12)
+	}
+	name := truncateString(d.Filename, nameWidth)
+	if name == "" {
+		name = truncateString(d.URL, nameWidth)
+	}
+
+	size := utils.ConvertBytesToHumanReadable(d.Downloaded)
+	if d.TotalSize > 0 {
+		size += " / " + utils.ConvertBytesToHumanReadable(d.TotalSize)
+	}
+
+	detail := ""
+	switch d.Status {
+	case "downloading":
+		detail = fmt.Sprintf("%.1f MB/s", d.Speed)
+		if d.Speed > 0 && d.TotalSize > 0 {
+			left := time.Duration(float64(d.TotalSize-d.Downloaded) / (d.Speed * Megabyte) * float64(time.Second))
+			detail += " " + compactDuration(left)
+		}
+	case "queued":
+		if d.Position > 0 {
+			detail = fmt.Sprintf("#%d", d.Position)
+		}
+	case "scheduled":
+		if d.StartAt > 0 {
+			detail = "at " + time.Unix(d.StartAt, 0).Format("Jan 2 15:04")
+		}
+	case "error":
+		detail = LogStyleError.Render(truncateString(d.Error, 30))
+	}
+
+	return fmt.Sprintf("%s %-*s %5.1f%%  %-21s %s",
+		watchStatus(d.Status).RenderIcon(), nameWidth+3, name, d.Progress, size, detail)
+}
@@ -0,0 +1,62 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestWatchModel(t *testing.T) {
+	calls := 0
+	source := func() ([]types.DownloadStatus, error) {
+		calls++
+		return []types.DownloadStatus{
+			{ID: "c", Filename: "done.iso", Status: "completed", Progress: 100, TotalSize: Megabyte, Downloaded: Megabyte},
+			{ID: "q2", Filename: "second.iso", Status: "queued", Position: 2},
+			{ID: "d", Filename: "running.iso", Status: "downloading", Progress: 50, TotalSize: 20 * Megabyte, Downloaded: 10 * Megabyte, Speed: 2},
+			{ID: "q1", Filename: "first.iso", Status: "queued", Position: 1},
+		}, nil
+	}
+
+	m := NewWatchModel(source, "http://127.0.0.1:8080")
+	updated, cmd := m.Update(m.Init()())
+	m = updated.(WatchModel)
+	if calls != 1 || cmd == nil {
+		t.Fatalf("after first fetch: %d calls, refresh %v", calls, cmd)
+	}
+
+	var order []string
+	for _, d := range m.downloads {
+		order = append(order, d.ID)
+	}
+	if got := strings.Join(order, ","); got != "d,q1,q2,c" {
+		t.Errorf("order = %s, want d,q1,q2,c", got)
+	}
+
+	view := m.View()
+	for _, want := range []string{"read-only", "1 downloading", "2 queued", "2.0 MB/s", "running.iso", "5s", "#2"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view is missing %q:\n%s", want, view)
+		}
+	}
+
+	// A failed refresh keeps the last downloads on screen
+	updated, _ = m.Update(watchUpdateMsg{err: errors.New("connection refused")})
+	m = updated.(WatchModel)
+	if len(m.downloads) != 4 || !strings.Contains(m.View(), "connection refused") {
+		t.Errorf("failed refresh: %d downloads\n%s", len(m.downloads), m.View())
+	}
+
+	// Keys that change downloads elsewhere in the TUI do nothing here
+	for _, k := range []string{"p", "x", "delete", "enter", "a"} {
+		if _, cmd := m.Update(tea.KeyMsg(tea.Key{Type: tea.KeyRunes, Runes: []rune(k)})); cmd != nil {
+			t.Errorf("key %q returned a command", k)
+		}
+	}
+	if _, cmd := m.Update(tea.KeyMsg(tea.Key{Type: tea.KeyRunes, Runes: []rune("q")})); cmd == nil {
+		t.Error("q did not quit")
+	}
+}
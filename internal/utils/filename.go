@@ -2,15 +2,17 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-
 	"strings"
+	"unicode/utf8"
 
 	"github.com/h2non/filetype"
 	"github.com/vfaronov/httpheader"
@@ -141,3 +143,96 @@ func sanitizeFilename(name string) string {
 	name = strings.ReplaceAll(name, "|", "_")
 	return name
 }
+
+// pageExts are extensions of server-side scripts and web pages. A download
+// saved under one that turns out to be, say, a ZIP was named after the page
+// that served it, not after the file.
+var pageExts = map[string]bool{
+	"php": true, "php3": true, "php4": true, "php5": true, "phtml": true,
+	"asp": true, "aspx": true, "ashx": true, "axd": true,
+	"jsp": true, "jspx": true, "do": true, "action": true,
+	"cgi": true, "pl": true, "cfm": true,
+	"html": true, "htm": true, "shtml": true, "xhtml": true,
+}
+
+// CorrectExtension returns name with the extension the content's magic
+// bytes in header (the start of the file) show, and true, when name has no
+// extension or one of a script or web page, such as "get.php" for a ZIP.
+// Other names, and content of no recognizable type, are left alone.
+func CorrectExtension(name string, header []byte) (string, bool) {
+	kind, _ := filetype.Match(header)
+	if kind == filetype.Unknown || kind.Extension == "" {
+		return name, false
+	}
+	ext := filepath.Ext(name)
+	if ext == name {
+		ext = "" // A dotfile such as ".download" has no extension
+	}
+	if ext != "" && !pageExts[strings.ToLower(ext[1:])] {
+		return name, false
+	}
+	return strings.TrimSuffix(name, ext) + "." + kind.Extension, true
+}
+
+// BinaryExtension reports whether name's extension is that of a binary
+// format recognizable by its magic bytes, such as .zip, .gz or .mp4. A file
+// so named should never hold a web page.
+func BinaryExtension(name string) bool {
+	ext := filepath.Ext(name)
+	if ext == "" || ext == name {
+		return false
+	}
+	return filetype.IsSupported(strings.ToLower(ext[1:]))
+}
+
+// maxExtLength is the longest extension TruncateFilename keeps; a longer
+// "extension" is part of the name that happens to follow a dot
+const maxExtLength = 16
+
+// TruncateFilename shortens name to at most limit bytes, keeping its
+// extension (both parts of one like .tar.gz) and whole UTF-8 characters.
+// With hashSuffix, "~" and 8 hex digits of a hash of the full name go before
+// the extension, so names that only differ past the cut stay apart. Names
+// within limit, or any name when limit is 0 or less, are returned as is.
+func TruncateFilename(name string, limit int, hashSuffix bool) string {
+	if limit <= 0 || len(name) <= limit {
+		return name
+	}
+	ext := longExt(name)
+	suffix := ext
+	if hashSuffix {
+		sum := sha256.Sum256([]byte(name))
+		suffix = "~" + hex.EncodeToString(sum[:4]) + ext
+	}
+	if len(suffix) >= limit {
+		// No room for any of the name: keep what of the suffix fits
+		return cutUTF8(suffix, limit)
+	}
+	stem := cutUTF8(name[:len(name)-len(ext)], limit-len(suffix))
+	return strings.TrimRight(stem, " .") + suffix
+}
+
+// longExt returns the extension of name, including a .tar before it, or ""
+// if it is longer than maxExtLength
+func longExt(name string) string {
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtLength || len(ext) == len(name) {
+		return ""
+	}
+	if inner := filepath.Ext(strings.TrimSuffix(name, ext)); strings.EqualFold(inner, ".tar") {
+		ext = inner + ext
+	}
+	return ext
+}
+
+// cutUTF8 returns the longest prefix of s of at most n bytes that does not
+// split a character
+func cutUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -54,6 +55,89 @@ func TestSanitizeFilename(t *testing.T) {
 	}
 }
 
+func TestCorrectExtension(t *testing.T) {
+	zipHeader := []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")
+	pngHeader := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		name   string
+		input  string
+		header []byte
+		want   string
+		ok     bool
+	}{
+		{"php serving a zip", "get.php", zipHeader, "get.zip", true},
+		{"extension case", "download.ASPX", pngHeader, "download.png", true},
+		{"html page", "index.html", zipHeader, "index.zip", true},
+		{"no extension", "download", zipHeader, "download.zip", true},
+		{"right extension", "photo.png", pngHeader, "photo.png", false},
+		{"other extension kept", "app.apk", zipHeader, "app.apk", false},
+		{"unknown content", "get.php", []byte("<?php echo 1;"), "get.php", false},
+		{"empty content", "get.php", nil, "get.php", false},
+		{"dotfile", ".download", zipHeader, ".download.zip", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := CorrectExtension(tt.input, tt.header)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("CorrectExtension(%q) = %q, %v; want %q, %v", tt.input, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBinaryExtension(t *testing.T) {
+	for name, want := range map[string]bool{
+		"dataset.tar.gz": true,
+		"movie.MP4":      true,
+		"setup.exe":      true,
+		"index.html":     false,
+		"notes.txt":      false,
+		"download":       false,
+		".zip":           false,
+	} {
+		if got := BinaryExtension(name); got != want {
+			t.Errorf("BinaryExtension(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestTruncateFilename(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name  string
+		input string
+		limit int
+		hash  bool
+		want  string
+	}{
+		{"within limit", "file.zip", 10, true, "file.zip"},
+		{"no limit", long + ".zip", 0, true, long + ".zip"},
+		{"end keeps extension", long + ".zip", 20, false, strings.Repeat("a", 16) + ".zip"},
+		{"double extension", long + ".tar.gz", 20, false, strings.Repeat("a", 13) + ".tar.gz"},
+		{"no extension", long, 20, false, strings.Repeat("a", 20)},
+		{"long extension is name", "file." + long, 20, false, "file." + strings.Repeat("a", 15)},
+		{"whole characters", strings.Repeat("é", 20) + ".txt", 11, false, "ééé.txt"},
+		{"trailing dots and spaces", "ab . c" + long + ".zip", 9, false, "ab.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncateFilename(tt.input, tt.limit, tt.hash); got != tt.want {
+				t.Errorf("TruncateFilename(%q, %d) = %q, want %q", tt.input, tt.limit, got, tt.want)
+			}
+		})
+	}
+
+	// Names that only differ past the cut get different hashes
+	a := TruncateFilename(long+"-one.iso", 40, true)
+	b := TruncateFilename(long+"-two.iso", 40, true)
+	if len(a) != 40 || !strings.HasSuffix(a, ".iso") || !strings.Contains(a, "~") || a == b {
+		t.Errorf("hashed names = %q and %q", a, b)
+	}
+	if TruncateFilename(long+"-one.iso", 40, true) != a {
+		t.Error("the same name should truncate the same way every time")
+	}
+}
+
 func TestDetermineFilename_PriorityOrder(t *testing.T) {
 	// Helper to create a minimal ZIP header
 	makeZipHeader := func(internalName string) []byte {
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 // EnsureAbsPath takes a clean path and forces it to be absolute.
@@ -16,3 +19,38 @@ func EnsureAbsPath(path string) string {
 	}
 	return path
 }
+
+// LongPath returns path in the extended-length form Windows needs for paths
+// longer than MAX_PATH: `C:\dir` becomes `\\?\C:\dir` and `\\server\share`
+// becomes `\\?\UNC\server\share`. Use it only when handing a path to the OS;
+// keep the plain form for display and for deriving other names.
+// Relative paths, already-prefixed paths and other platforms are unchanged.
+func LongPath(path string) string {
+	return longPath(path, runtime.GOOS)
+}
+
+func longPath(p, goos string) string {
+	if goos != "windows" || strings.HasPrefix(p, `\\?\`) || strings.HasPrefix(p, `\\.\`) {
+		return p
+	}
+
+	// Extended-length paths bypass normalisation, so clean them ourselves
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	switch {
+	case strings.HasPrefix(slashed, "//"):
+		// UNC: \\server\share\rest
+		rest := path.Clean("/" + strings.TrimLeft(slashed, "/"))
+		return `\\?\UNC` + strings.ReplaceAll(rest, "/", `\`)
+	case len(slashed) >= 3 && isDriveLetter(slashed[0]) && slashed[1] == ':' && slashed[2] == '/':
+		cleaned := path.Clean(slashed)
+		if len(cleaned) == 2 {
+			cleaned += "/" // Keep the root of "C:\"
+		}
+		return `\\?\` + strings.ReplaceAll(cleaned, "/", `\`)
+	}
+	return p // Relative or drive-relative: Windows resolves these itself
+}
+
+func isDriveLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -48,3 +48,30 @@ func TestEnsureAbsPath(t *testing.T) {
 		})
 	}
 }
+
+func TestLongPath(t *testing.T) {
+	tests := []struct {
+		name string
+		goos string
+		in   string
+		want string
+	}{
+		{"non-windows unchanged", "linux", "/home/user/file.bin", "/home/user/file.bin"},
+		{"drive path", "windows", `C:\Users\me\file.bin`, `\\?\C:\Users\me\file.bin`},
+		{"drive root", "windows", `D:\`, `\\?\D:\`},
+		{"forward slashes cleaned", "windows", `C:/a/./b/../file.bin`, `\\?\C:\a\file.bin`},
+		{"unc share", "windows", `\\server\share\dir\file.bin`, `\\?\UNC\server\share\dir\file.bin`},
+		{"already extended", "windows", `\\?\C:\file.bin`, `\\?\C:\file.bin`},
+		{"device path", "windows", `\\.\pipe\x`, `\\.\pipe\x`},
+		{"relative unchanged", "windows", `dir\file.bin`, `dir\file.bin`},
+		{"drive relative unchanged", "windows", `C:file.bin`, `C:file.bin`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := longPath(tt.in, tt.goos); got != tt.want {
+				t.Errorf("longPath(%q, %q) = %q, want %q", tt.in, tt.goos, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 // ConvertBytesToHumanReadable converts a given number of bytes into a human-readable format (e.g., KB, MB, GB).
@@ -20,3 +22,41 @@ func ConvertBytesToHumanReadable(bytes int64) string {
 	pre := "KMGTPE"[exp-1]
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/math.Pow(unit, float64(exp)), pre)
 }
+
+// ParseByteSize parses a size such as "500MB", "1.5G" or "2048" into bytes.
+// Units are powers of 1024, like ConvertBytesToHumanReadable's, and may be
+// written K, KB or KiB in any case.
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	exp := 0
+	if n := len(value); n > 0 {
+		if i := strings.IndexByte("KMGTPE", value[n-1]); i >= 0 {
+			exp = i + 1
+			value = strings.TrimSpace(value[:n-1])
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size %q: use a number of bytes or e.g. 500MB, 2GB", s)
+	}
+	bytes := n * math.Pow(1024, float64(exp))
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return int64(bytes), nil
+}
+
+// ParseRate parses a speed such as "500K", "2MB/s" or "0" into bytes per
+// second, in the units of ParseByteSize
+func ParseRate(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+	if v, ok := strings.CutSuffix(strings.ToLower(value), "/s"); ok {
+		value = v
+	}
+	rate, err := ParseByteSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid speed %q: use e.g. 500KB/s or 2MB/s", s)
+	}
+	return rate, nil
+}
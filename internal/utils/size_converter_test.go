@@ -84,3 +84,48 @@ func TestConvertBytesToHumanReadable_BoundaryValues(t *testing.T) {
 		})
 	}
 }
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "2048", want: 2048},
+		{in: "512B", want: 512},
+		{in: "500MB", want: 500 << 20},
+		{in: "1.5g", want: 3 << 29},
+		{in: "2 GiB", want: 2 << 30},
+		{in: "1T", want: 1 << 40},
+		{in: "", wantErr: true},
+		{in: "MB", wantErr: true},
+		{in: "-1GB", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "9000EB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]int64{
+		"0":       0,
+		"500K":    500 << 10,
+		"2MB/s":   2 << 20,
+		"1.5 m/S": 3 << 19,
+	}
+	for in, want := range tests {
+		if got, err := ParseRate(in); err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "fast", "/s", "-1M/s"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package progress turns raw download counters into what a progress bar
+// shows: percentage, smoothed speed and ETA. It does not depend on any UI
+// library; see the teaprogress package for a Bubble Tea adapter.
+package progress
+
+import (
+	"time"
+)
+
+const (
+	// DefaultPollInterval is how often surge's own TUI samples progress
+	DefaultPollInterval = 150 * time.Millisecond
+	// SpeedSmoothingAlpha is the EMA factor applied to speed samples
+	SpeedSmoothingAlpha = 0.3
+)
+
+// Sample is a raw reading of a download's counters
+type Sample struct {
+	Downloaded     int64
+	Total          int64         // 0 if unknown
+	Elapsed        time.Duration // Time spent downloading, including earlier sessions
+	SessionElapsed time.Duration // Time since the download was last started or resumed
+	SessionStart   int64         // Downloaded when the current session started
+	Speed          float64       // Bytes per second, for sources that measure it themselves
+	Connections    int
+	Retries        int64 // Failed requests retried so far
+	Done           bool
+	Err            error
+}
+
+// Source provides samples of one download
+type Source interface {
+	Sample() (Sample, error)
+}
+
+// Snapshot is a download's progress ready for display
+type Snapshot struct {
+	ID          string
+	Downloaded  int64
+	Total       int64
+	Percent     float64 // 0-100, or 0 while the size is unknown
+	Speed       float64 // Smoothed, in bytes per second
+	ETA         time.Duration
+	Elapsed     time.Duration
+	Connections int
+	Retries     int64
+	Done        bool
+	Err         error
+}
+
+// Tracker samples a Source and smooths its speed between calls. It is not
+// safe for concurrent use.
+type Tracker struct {
+	ID        string
+	source    Source
+	lastSpeed float64
+}
+
+// NewTracker returns a Tracker for the download id read from source
+func NewTracker(id string, source Source) *Tracker {
+	return &Tracker{ID: id, source: source}
+}
+
+// Poll samples the source and returns the resulting snapshot. A failing
+// source is reported through Snapshot.Err.
+func (t *Tracker) Poll() Snapshot {
+	s, err := t.source.Sample()
+	if err != nil {
+		return Snapshot{ID: t.ID, Err: err}
+	}
+
+	// Speed only counts this session, so resuming doesn't cause a spike
+	instant := s.Speed
+	if sessionBytes := s.Downloaded - s.SessionStart; instant == 0 && s.SessionElapsed > 0 && sessionBytes > 0 {
+		instant = float64(sessionBytes) / s.SessionElapsed.Seconds()
+	}
+	if t.lastSpeed == 0 {
+		t.lastSpeed = instant
+	} else {
+		t.lastSpeed = SpeedSmoothingAlpha*instant + (1-SpeedSmoothingAlpha)*t.lastSpeed
+	}
+
+	snap := Snapshot{
+		ID:          t.ID,
+		Downloaded:  s.Downloaded,
+		Total:       s.Total,
+		Speed:       t.lastSpeed,
+		Elapsed:     s.Elapsed,
+		Connections: s.Connections,
+		Retries:     s.Retries,
+		Done:        s.Done,
+		Err:         s.Err,
+	}
+	if s.Total > 0 {
+		snap.Percent = float64(s.Downloaded) * 100 / float64(s.Total)
+		if remaining := s.Total - s.Downloaded; remaining > 0 && snap.Speed > 0 {
+			snap.ETA = time.Duration(float64(remaining) / snap.Speed * float64(time.Second))
+		}
+	}
+	return snap
+}
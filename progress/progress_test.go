@@ -0,0 +1,93 @@
+package progress
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	samples []Sample
+	err     error
+}
+
+func (f *fakeSource) Sample() (Sample, error) {
+	if f.err != nil {
+		return Sample{}, f.err
+	}
+	s := f.samples[0]
+	if len(f.samples) > 1 {
+		f.samples = f.samples[1:]
+	}
+	return s, nil
+}
+
+func TestTracker_Poll(t *testing.T) {
+	src := &fakeSource{samples: []Sample{
+		{Downloaded: 1500, Total: 4000, SessionStart: 500, SessionElapsed: time.Second, Elapsed: 3 * time.Second, Connections: 4},
+		{Downloaded: 3000, Total: 4000, SessionStart: 500, SessionElapsed: time.Second},
+	}}
+	tracker := NewTracker("dl", src)
+
+	snap := tracker.Poll()
+	if snap.ID != "dl" || snap.Percent != 37.5 || snap.Connections != 4 || snap.Elapsed != 3*time.Second {
+		t.Errorf("first snapshot = %+v", snap)
+	}
+	// Only the 1000 bytes of this session count towards speed
+	if snap.Speed != 1000 {
+		t.Errorf("first speed = %v, want 1000", snap.Speed)
+	}
+	if snap.ETA != 2500*time.Millisecond {
+		t.Errorf("ETA = %v, want 2.5s", snap.ETA)
+	}
+
+	// Later samples are smoothed: 0.3*2500 + 0.7*1000
+	if snap := tracker.Poll(); snap.Speed != 1450 {
+		t.Errorf("smoothed speed = %v, want 1450", snap.Speed)
+	}
+}
+
+func TestTracker_SourceError(t *testing.T) {
+	want := errors.New("gone")
+	snap := NewTracker("dl", &fakeSource{err: want}).Poll()
+	if !errors.Is(snap.Err, want) || snap.ID != "dl" {
+		t.Errorf("snapshot = %+v, want the source error", snap)
+	}
+}
+
+func TestRemoteSource(t *testing.T) {
+	status := map[string]any{"id": "abc", "total_size": 2048, "downloaded": 1024, "speed": 1.0, "status": "downloading"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/download" || r.URL.Query().Get("id") != "abc" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(status)
+	}))
+	defer server.Close()
+
+	tracker := NewTracker("abc", &RemoteSource{BaseURL: server.URL + "/", ID: "abc", Token: "secret"})
+	snap := tracker.Poll()
+	if snap.Err != nil {
+		t.Fatalf("Poll failed: %v", snap.Err)
+	}
+	if snap.Percent != 50 || snap.Speed != 1024*1024 || snap.Done {
+		t.Errorf("snapshot = %+v", snap)
+	}
+
+	status["status"], status["error"] = "error", "disk full"
+	if snap := tracker.Poll(); snap.Err == nil || snap.Err.Error() != "disk full" {
+		t.Errorf("expected the server's error, got %v", snap.Err)
+	}
+
+	if snap := NewTracker("abc", &RemoteSource{BaseURL: server.URL, ID: "abc"}).Poll(); snap.Err == nil {
+		t.Error("expected an error without the token")
+	}
+}
@@ -0,0 +1,78 @@
+package progress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RemoteSource samples a download held by a running surge server through
+// its HTTP API, so other programs can show downloads they hand to surge
+type RemoteSource struct {
+	BaseURL string       // e.g. http://127.0.0.1:8080
+	ID      string       // Download ID returned when the download was added
+	Token   string       // Bearer token, if the server requires one
+	Client  *http.Client // Defaults to http.DefaultClient
+
+	started time.Time // First sample, as the API reports no elapsed time
+}
+
+// remoteStatus mirrors the JSON of GET /download?id=
+type remoteStatus struct {
+	TotalSize  int64   `json:"total_size"`
+	Downloaded int64   `json:"downloaded"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error"`
+	Speed      float64 `json:"speed"` // MB/s
+}
+
+// Sample fetches the download's status from the server
+func (r *RemoteSource) Sample() (Sample, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(r.BaseURL, "/")+"/download?id="+url.QueryEscape(r.ID), nil)
+	if err != nil {
+		return Sample{}, err
+	}
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Sample{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Sample{}, fmt.Errorf("surge server: %s", resp.Status)
+	}
+
+	var st remoteStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return Sample{}, fmt.Errorf("surge server: invalid status: %w", err)
+	}
+
+	now := time.Now()
+	if r.started.IsZero() {
+		r.started = now
+	}
+	s := Sample{
+		Downloaded: st.Downloaded,
+		Total:      st.TotalSize,
+		Elapsed:    now.Sub(r.started),
+		Speed:      st.Speed * 1024 * 1024,
+		Done:       st.Status == "completed",
+	}
+	if st.Status == "error" {
+		s.Err = errors.New(st.Error)
+		if st.Error == "" {
+			s.Err = errors.New("download failed")
+		}
+	}
+	return s, nil
+}
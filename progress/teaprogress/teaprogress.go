@@ -0,0 +1,39 @@
+// Package teaprogress adapts progress.Tracker to Bubble Tea, so other Bubble
+// Tea programs can show surge downloads in their own views.
+//
+//	func (m model) Init() tea.Cmd {
+//		return teaprogress.Poll(m.tracker, progress.DefaultPollInterval)
+//	}
+//
+//	func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+//		if p, ok := msg.(teaprogress.Msg); ok && p.ID == m.tracker.ID {
+//			m.snapshot = p.Snapshot
+//			if p.Done || p.Err != nil {
+//				return m, nil
+//			}
+//			return m, teaprogress.Poll(m.tracker, progress.DefaultPollInterval)
+//		}
+//		return m, nil
+//	}
+package teaprogress
+
+import (
+	"time"
+
+	"github.com/surge-downloader/surge/progress"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Msg carries a snapshot taken by Poll
+type Msg struct {
+	progress.Snapshot
+}
+
+// Poll returns a command that polls tracker after interval and delivers the
+// result as a Msg. Return it again from Update to keep polling.
+func Poll(tracker *progress.Tracker, interval time.Duration) tea.Cmd {
+	return tea.Tick(interval, func(time.Time) tea.Msg {
+		return Msg{tracker.Poll()}
+	})
+}
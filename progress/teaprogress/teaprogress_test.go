@@ -0,0 +1,25 @@
+package teaprogress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/progress"
+)
+
+type doneSource struct{}
+
+func (doneSource) Sample() (progress.Sample, error) {
+	return progress.Sample{Downloaded: 10, Total: 10, Done: true}, nil
+}
+
+func TestPoll(t *testing.T) {
+	msg := Poll(progress.NewTracker("dl", doneSource{}), time.Millisecond)()
+	p, ok := msg.(Msg)
+	if !ok {
+		t.Fatalf("Poll produced %T, want Msg", msg)
+	}
+	if p.ID != "dl" || !p.Done || p.Percent != 100 {
+		t.Errorf("Msg = %+v", p)
+	}
+}